@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyEntry is one action in the history file: what the log records as an action
+// (tokens fetched, scripts run, SSH opened, ...) with its fields. Like the log, it never
+// holds token or secret values.
+type historyEntry struct {
+	Time    time.Time              `json:"time"`
+	Action  string                 `json:"action"`
+	Details string                 `json:"details"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// historyMutex serializes appends and pruning within the tray
+var historyMutex sync.Mutex
+
+// HistoryPath returns the path of the action history file
+func HistoryPath() string {
+	return filepath.Join(ConfigDir(), "history.jsonl")
+}
+
+// recordHistory appends an action to the history file. Only the tray records (it is the
+// process with a logger); history.disabled turns it off.
+func recordHistory(action string, details string, fields map[string]interface{}) {
+	if log == nil || configOrFile().GetHistoryConfigWithDefaults().Disabled {
+		return
+	}
+	line, err := json.Marshal(historyEntry{Time: time.Now(), Action: action, Details: details, Fields: fields})
+	if err != nil {
+		return
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	f, err := os.OpenFile(HistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Debugf("Failed to open the action history: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Debugf("Failed to write the action history: %v", err)
+	}
+}
+
+// pruneHistory drops entries older than history.max_age_days from the history file
+func pruneHistory(cfg HistoryConfig) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	data, err := os.ReadFile(HistoryPath())
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -cfg.MaxAgeDays)
+	var kept bytes.Buffer
+	dropped := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry historyEntry
+		if json.Unmarshal(line, &entry) != nil || entry.Time.Before(cutoff) {
+			dropped++
+			continue
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if dropped == 0 {
+		return
+	}
+	tmp := HistoryPath() + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0600); err != nil {
+		LogWarn("Failed to prune the action history: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, HistoryPath()); err != nil {
+		LogWarn("Failed to prune the action history: %v", err)
+		return
+	}
+	LogDebug("Dropped %d history entries older than %d days", dropped, cfg.MaxAgeDays)
+}
+
+// historyFilter selects history entries for the history command
+type historyFilter struct {
+	since  time.Time
+	until  time.Time
+	action string // Prefix of the action name, e.g. "ssh" or "ticket_request"
+	text   string // Lowercase text the details or a field value must contain
+}
+
+func (f historyFilter) matches(entry historyEntry) bool {
+	if !f.since.IsZero() && entry.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !entry.Time.Before(f.until) {
+		return false
+	}
+	if f.action != "" && !strings.HasPrefix(entry.Action, f.action) {
+		return false
+	}
+	if f.text == "" || strings.Contains(strings.ToLower(entry.Details), f.text) {
+		return true
+	}
+	for _, v := range entry.Fields {
+		if strings.Contains(strings.ToLower(fmt.Sprint(v)), f.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHistory returns the entries of the history file that match filter, oldest first
+func readHistory(filter historyFilter) ([]historyEntry, error) {
+	f, err := os.Open(HistoryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry historyEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, scanner.Err()
+}
+
+// parseHistoryTime reads a --since or --until value: a duration back from now ("24h",
+// "7d", "90m") or a local date or time ("2006-01-02", "2006-01-02 15:04")
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use a duration like 24h or 7d, or a date like 2006-01-02)", value)
+}
+
+// runHistoryCommand prints the actions recorded by the tray
+func runHistoryCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	since := fs.String("since", "", "Only actions after this: a duration back from now (24h, 7d) or a date (2006-01-02[ 15:04])")
+	until := fs.String("until", "", "Only actions before this, in the same forms as --since")
+	action := fs.String("action", "", "Only actions whose name starts with this, e.g. ssh or ticket_request")
+	asJSON := fs.Bool("json", false, "Print one {\"time\", \"action\", \"details\", \"fields\"} record per line")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray history [--since 24h] [--until time] [--action name] [--json] [text]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintf(stderr, "Lists the actions the tray recorded in %s; text filters on the details and fields.\n", HistoryPath())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	now := time.Now()
+	filter := historyFilter{action: *action, text: strings.ToLower(fs.Arg(0))}
+	for _, bound := range []struct {
+		value string
+		t     *time.Time
+	}{{*since, &filter.since}, {*until, &filter.until}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseHistoryTime(bound.value, now)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+			return exitUsage
+		}
+		*bound.t = t
+	}
+
+	entries, err := readHistory(filter)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	for _, entry := range entries {
+		if *asJSON {
+			writeCLIJSON(stdout, stderr, entry)
+			continue
+		}
+		_, _ = fmt.Fprintf(stdout, "%s  %-18s %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Action, entry.Details)
+	}
+	return exitOK
+}
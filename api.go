@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAPIPort is the default port of the localhost REST API
+const DefaultAPIPort = 47800
+
+// apiServer is the running REST API server
+type apiServer struct {
+	server *http.Server
+	port   int
+}
+
+var (
+	activeAPI *apiServer
+	apiMutex  sync.Mutex
+	apiSecret string // Generated once per process, see APISecret
+)
+
+// APISecret returns the bearer secret for this session, creating it on first use.
+// It is also written to APISecretPath so local tools can read it.
+func APISecret() string {
+	apiMutex.Lock()
+	defer apiMutex.Unlock()
+	return apiSecretLocked()
+}
+
+func apiSecretLocked() string {
+	if apiSecret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			LogError("Failed to generate API secret: %v", err)
+			return ""
+		}
+		apiSecret = hex.EncodeToString(b)
+	}
+	return apiSecret
+}
+
+// APISecretPath returns the file the session's API secret is written to
+func APISecretPath() string {
+	return filepath.Join(ConfigDir(), "api-secret")
+}
+
+// ApplyAPIConfig starts, restarts, or stops the REST API to match the configuration
+func ApplyAPIConfig(cfg APIConfig) {
+	apiMutex.Lock()
+	defer apiMutex.Unlock()
+
+	if activeAPI != nil && (!cfg.Enabled || activeAPI.port != cfg.Port) {
+		activeAPI.stop()
+		activeAPI = nil
+		clearOnceLinks()
+	}
+	if !cfg.Enabled || activeAPI != nil {
+		return
+	}
+
+	secret := apiSecretLocked()
+	if secret == "" {
+		return
+	}
+	if err := os.WriteFile(APISecretPath(), []byte(secret+"\n"), 0600); err != nil {
+		LogError("Failed to write API secret: %v", err)
+		return
+	}
+
+	api, err := startAPIServer(cfg.Port, secret)
+	if err != nil {
+		LogError("Failed to start REST API: %v", err)
+		return
+	}
+	activeAPI = api
+	LogInfo("REST API listening on http://127.0.0.1:%d", cfg.Port)
+}
+
+// StopAPIServer stops the REST API and removes the secret file
+func StopAPIServer() {
+	apiMutex.Lock()
+	defer apiMutex.Unlock()
+
+	if activeAPI != nil {
+		activeAPI.stop()
+		activeAPI = nil
+	}
+	clearOnceLinks()
+	_ = os.Remove(APISecretPath())
+}
+
+func startAPIServer(port int, secret string) (*apiServer, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleAPIHealth)
+	mux.Handle("/token", requireAPISecret(secret, http.HandlerFunc(handleAPIToken)))
+	mux.Handle("/jwt/", requireAPISecret(secret, http.HandlerFunc(handleAPIJWT)))
+	mux.Handle("/cache", requireAPISecret(secret, http.HandlerFunc(handleAPICache)))
+	mux.HandleFunc("/once/", handleAPIOnce)
+
+	api := &apiServer{
+		server: &http.Server{
+			Handler:           checkAPIHost(port, mux),
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		port: port,
+	}
+	go func() {
+		if err := api.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			LogError("REST API stopped: %v", err)
+		}
+	}()
+	return api, nil
+}
+
+func (a *apiServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = a.server.Shutdown(ctx)
+}
+
+// checkAPIHost rejects requests whose Host isn't the loopback address, guarding against DNS rebinding
+func checkAPIHost(port int, next http.Handler) http.Handler {
+	allowed := map[string]bool{
+		fmt.Sprintf("127.0.0.1:%d", port): true,
+		fmt.Sprintf("localhost:%d", port): true,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowed[r.Host] {
+			writeAPIError(w, http.StatusForbidden, "invalid host")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPISecret checks the Authorization: Bearer header against the session secret
+func requireAPISecret(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid bearer secret")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
+
+// handleAPIHealth reports that the tray is running (no secret required)
+func handleAPIHealth(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, map[string]string{
+		"status":  "ok",
+		"version": Version,
+	})
+}
+
+// handleAPIToken returns a Negotiate token: GET /token?spn=<name-or-spn>[&fresh=1]
+func handleAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	cfg := currentConfig()
+	stateMutex.RLock()
+	spn := currentSPN
+	stateMutex.RUnlock()
+
+	if name := r.URL.Query().Get("spn"); name != "" {
+		spn = cfg.ResolveSPN(name)
+	} else if target := r.URL.Query().Get("url"); target != "" {
+		mapped, err := cfg.SPNForURL(target)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		spn = mapped
+	}
+	if spn == "" {
+		writeAPIError(w, http.StatusBadRequest, "no spn given and none selected")
+		return
+	}
+
+	if err := requireSecurityKey(securityKeyTokens, fmt.Sprintf("Serve a token for %s to the REST API", spn)); err != nil {
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	fresh := r.URL.Query().Get("fresh") == "1"
+	token, err := getCachedServiceToken(cfg, spn, fresh)
+	if err != nil {
+		LogWarn("REST API token request failed: %v", err)
+		writeAPIError(w, http.StatusBadGateway, fmt.Sprintf("failed to get token: %v", err))
+		return
+	}
+	_, expiresAt, _ := GetCache().GetTokenWithExpiry(spn)
+
+	LogAction("api_token", "Token served via REST API")
+	resp := map[string]interface{}{
+		"spn":        spn,
+		"token":      token,
+		"header":     "Negotiate " + token,
+		"expires_at": expiresAt,
+	}
+	// The token may be one cached before the KDC became unreachable
+	if since := offlineSince(); !since.IsZero() {
+		resp["offline_since"] = since
+	}
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIJWT returns a JWT cached with ktray.jwt_set: GET /jwt/<name>. Other cache
+// values, such as secrets or script results under the same name, are never served.
+func handleAPIJWT(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/jwt/")
+	if name == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing JWT name")
+		return
+	}
+
+	jwt, found := GetCache().GetJWT(name)
+	if !found {
+		writeAPIError(w, http.StatusNotFound, "JWT not cached: "+name)
+		return
+	}
+	if err := requireSecurityKey(securityKeyTokens, fmt.Sprintf("Serve the JWT %s to the REST API", name)); err != nil {
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	LogAction("api_jwt", fmt.Sprintf("JWT served via REST API: %s", name))
+	writeAPIJSON(w, http.StatusOK, map[string]string{
+		"name":  name,
+		"token": jwt,
+	})
+}
+
+// handleAPICache lists cache keys with their type and expiry (never values): GET /cache
+func handleAPICache(w http.ResponseWriter, r *http.Request) {
+	type apiCacheEntry struct {
+		Key       string    `json:"key"`
+		Type      string    `json:"type"`
+		ExpiresAt time.Time `json:"expires_at,omitempty"`
+	}
+
+	entries := GetCache().ListEntries()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	out := make([]apiCacheEntry, len(entries))
+	for i, e := range entries {
+		out[i] = apiCacheEntry{Key: e.Key, Type: e.Type, ExpiresAt: e.ExpiresAt}
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+		"namespace": GetCache().NamespaceName(),
+		"entries":   out,
+		"stats":     GetCache().Metrics(),
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAPIJWT covers GET /jwt/<name> serving JWTs and nothing else cached under a name
+func TestAPIJWT(t *testing.T) {
+	newHeadlessTray(t, `{}`)
+	GetCache().SetJWT("api", "eyJhbGciOiJub25lIn0.e30.", time.Minute)
+	GetCache().Set("result", "not a jwt", time.Minute)
+	GetCache().SetSecret("db", "hunter2", time.Minute)
+
+	get := func(name string) (int, string) {
+		w := httptest.NewRecorder()
+		handleAPIJWT(w, httptest.NewRequest(http.MethodGet, "/jwt/"+name, nil))
+		return w.Code, w.Body.String()
+	}
+	if code, body := get("api"); code != http.StatusOK || !strings.Contains(body, "eyJhbGciOiJub25lIn0") {
+		t.Errorf("jwt: %d %s", code, body)
+	}
+	for _, name := range []string{"result", "db"} {
+		if code, body := get(name); code != http.StatusNotFound {
+			t.Errorf("%s was served: %d %s", name, code, body)
+		}
+	}
+}
+
+// TestAPIJWTSecurityKey checks that /jwt/<name> is refused when security_key requires a
+// touch for tokens and the key check fails
+func TestAPIJWTSecurityKey(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _ := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	newHeadlessTray(t, `{"security_key": {"credential": "Y3JlZA==", "public_key": `+string(publicKey)+`, "require": ["tokens"]}}`)
+	// Without fido2-token there is no key to touch
+	t.Setenv("PATH", t.TempDir())
+	GetCache().SetJWT("api", "eyJhbGciOiJub25lIn0.e30.", time.Minute)
+
+	w := httptest.NewRecorder()
+	handleAPIJWT(w, httptest.NewRequest(http.MethodGet, "/jwt/api", nil))
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "eyJhbGciOiJub25lIn0") {
+		t.Errorf("jwt without a touch: %d %s", w.Code, w.Body.String())
+	}
+}
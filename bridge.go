@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBridgeTTLSec is how many seconds a one-time link or a remote copy lasts
+	DefaultBridgeTTLSec = 60
+
+	// DefaultBridgeRemotePath is the file a value is written to, relative to the remote home
+	DefaultBridgeRemotePath = ".krb5tray-share"
+)
+
+// Where the newest clipboard history value is handed over to
+const (
+	bridgeLink   = "link"
+	bridgeRemote = "remote"
+)
+
+// onceEntry is a value waiting to be fetched once through its link. It is sealed with a
+// key that is only in the link, so the tray doesn't hold it in the clear meanwhile.
+type onceEntry struct {
+	label  string
+	sealed []byte
+	timer  *time.Timer
+}
+
+var (
+	onceMutex   sync.Mutex
+	onceEntries = map[string]*onceEntry{} // By hex SHA-256 of the link key
+)
+
+// createOnceLink seals value and returns the URL that serves it once on the REST API
+func createOnceLink(label string, value string, ttl time.Duration) (string, error) {
+	apiMutex.Lock()
+	api := activeAPI
+	apiMutex.Unlock()
+	if api == nil {
+		return "", fmt.Errorf("REST API is not enabled (set api.enabled in the config)")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	sealed, err := sealOnce(key, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	id := onceID(key)
+
+	onceMutex.Lock()
+	onceEntries[id] = &onceEntry{
+		label:  label,
+		sealed: sealed,
+		timer: time.AfterFunc(ttl, func() {
+			if takeOnceEntry(id) != nil {
+				LogDebug("One-time link for %s expired unused", label)
+			}
+		}),
+	}
+	onceMutex.Unlock()
+
+	return fmt.Sprintf("http://127.0.0.1:%d/once/%s", api.port, base64.RawURLEncoding.EncodeToString(key)), nil
+}
+
+func onceID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// takeOnceEntry removes and returns the entry for id, or nil if there isn't one
+func takeOnceEntry(id string) *onceEntry {
+	onceMutex.Lock()
+	defer onceMutex.Unlock()
+	entry := onceEntries[id]
+	if entry != nil {
+		delete(onceEntries, id)
+		entry.timer.Stop()
+	}
+	return entry
+}
+
+// clearOnceLinks drops every link that hasn't been fetched
+func clearOnceLinks() {
+	onceMutex.Lock()
+	defer onceMutex.Unlock()
+	for id, entry := range onceEntries {
+		entry.timer.Stop()
+		zeroBytes(entry.sealed)
+		delete(onceEntries, id)
+	}
+}
+
+func sealOnce(key []byte, plain []byte) ([]byte, error) {
+	aead, err := onceCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func openOnce(key []byte, sealed []byte) ([]byte, error) {
+	aead, err := onceCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func onceCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// handleAPIOnce serves a shared value once: GET /once/<key>. The link is the credential,
+// so no bearer secret is required; a second request gets 404.
+func handleAPIOnce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, "/once/"))
+	if err != nil || len(key) != 32 {
+		writeAPIError(w, http.StatusNotFound, "unknown or used link")
+		return
+	}
+	entry := takeOnceEntry(onceID(key))
+	if entry == nil {
+		writeAPIError(w, http.StatusNotFound, "unknown or used link")
+		return
+	}
+	plain, err := openOnce(key, entry.sealed)
+	zeroBytes(entry.sealed)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "unknown or used link")
+		return
+	}
+	defer zeroBytes(plain)
+
+	LogAction("bridge_link_fetched", fmt.Sprintf("One-time link fetched: %s", entry.label))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(plain)
+}
+
+// sendToRemoteFile writes value to the bridge's remote file over the builtin SSH client,
+// readable only by the remote user, and has the host delete it after ttl
+func sendToRemoteFile(bridge BridgeConfig, value string, ttl time.Duration) (string, error) {
+	if bridge.Host == "" {
+		return "", fmt.Errorf("no bridge.host configured")
+	}
+	entry, err := transferSSHEntry(currentConfig(), TransferEntry{Name: "Bridge", Host: bridge.Host})
+	if err != nil {
+		return "", err
+	}
+	remotePath := bridge.RemotePath
+
+	setStatus(fmt.Sprintf("Connecting to %s...", entry.Host))
+	client, err := dialBuiltinSSH(entry, traySSHAuthOptions("Bridge: "+entry.Host))
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	// umask keeps the file private from the moment it exists; chmod covers an existing
+	// file. The delayed rm is detached from the session so it outlives it.
+	quoted := shellQuote(remotePath)
+	command := fmt.Sprintf(`umask 077 && cat > %s && chmod 600 %s && (nohup sh -c 'sleep %d; rm -f "$0"' %s </dev/null >/dev/null 2>&1 &)`,
+		quoted, quoted, int(ttl.Seconds()), quoted)
+	session.Stdin = strings.NewReader(value)
+	if output, err := session.CombinedOutput(command); err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return fmt.Sprintf("%s:%s", entry.Host, remotePath), nil
+}
+
+// shareLatestCopy hands the newest clipboard history value to a remote session: as a
+// one-time link (target "link") or a file on bridge.host (target "remote"). It returns
+// the link or where the file is, or "" without an error if the user declined.
+func shareLatestCopy(target string, requester string) (string, error) {
+	history := GetClipboardHistory()
+	entries := history.List()
+	if len(entries) == 0 {
+		return "", fmt.Errorf("nothing copied yet (the clipboard history is empty or disabled)")
+	}
+	latest := entries[0]
+	if latest.Secret && !confirmSensitiveCopy(latest.Label, requester) {
+		return "", nil
+	}
+	value, err := history.Value(0)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := currentConfig()
+	bridge := cfg.GetBridgeConfigWithDefaults()
+	ttl := time.Duration(bridge.TTLSec) * time.Second
+
+	var where string
+	switch target {
+	case bridgeLink:
+		where, err = createOnceLink(latest.Label, value, ttl)
+	case bridgeRemote:
+		where, err = sendToRemoteFile(bridge, value, ttl)
+	default:
+		return "", fmt.Errorf("unknown share target %q (use link or remote)", target)
+	}
+	if err != nil {
+		return "", err
+	}
+	LogActionWithFields("bridge_share", fmt.Sprintf("Shared %s via %s", latest.Label, target), map[string]interface{}{
+		"target":    target,
+		"label":     latest.Label,
+		"ttl_sec":   bridge.TTLSec,
+		"requester": requester,
+	})
+	return where, nil
+}
+
+func handleShareLinkClick() {
+	link, err := shareLatestCopy(bridgeLink, requesterMenu)
+	switch {
+	case err != nil:
+		LogError("Share failed: %v", err)
+		setStatusError(fmt.Sprintf("Share failed: %s", truncateError(err)))
+	case link != "":
+		// The link isn't the value, so it goes to the clipboard without a history entry
+		if err := copyToClipboard(link); err != nil {
+			setStatusError(fmt.Sprintf("Share failed: %s", truncateError(err)))
+			return
+		}
+		setStatus(fmt.Sprintf("Copied one-time link (valid %ds)", currentConfig().GetBridgeConfigWithDefaults().TTLSec))
+	}
+}
+
+func handleShareRemoteClick() {
+	where, err := shareLatestCopy(bridgeRemote, requesterMenu)
+	switch {
+	case err != nil:
+		LogError("Share failed: %v", err)
+		setStatusError(fmt.Sprintf("Share failed: %s", truncateError(err)))
+	case where != "":
+		setStatus(fmt.Sprintf("Sent to %s", truncateString(where, 40)))
+	}
+}
+
+func ctlShare(args []string) (string, error) {
+	target := bridgeLink
+	switch len(args) {
+	case 0:
+	case 1:
+		target = args[0]
+	default:
+		return "", fmt.Errorf("usage: share [link|remote]")
+	}
+	where, err := shareLatestCopy(target, requesterCtl)
+	if err != nil {
+		return "", err
+	}
+	if where == "" {
+		return "", fmt.Errorf("not shared")
+	}
+	return where, nil
+}
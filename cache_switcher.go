@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/pkg/krb"
+)
+
+var mCachesMenu *systray.MenuItem
+
+// cachesMenu lists the user's credential caches, checking the one tickets are requested
+// from. Like credentialsMenu, slots are created as the list grows and hidden when it shrinks.
+var cachesMenu struct {
+	mu          sync.Mutex
+	useDefault  *systray.MenuItem
+	placeholder *systray.MenuItem
+	slots       []*systray.MenuItem
+	names       []string // Cache each slot selects
+}
+
+// describeCache is a cache's title in the Caches menu, like "user@EXAMPLE.COM (7h 58m left)"
+func describeCache(c krb.CacheInfo, now time.Time) string {
+	title := truncateString(valueOrDash(c.Principal), 45)
+	switch {
+	case c.TGTExpiry.IsZero():
+		return title + " (no TGT)"
+	case c.TGTExpiry.After(now):
+		return title + fmt.Sprintf(" (%s left)", formatDuration(c.TGTExpiry.Sub(now)))
+	}
+	return title + " (expired)"
+}
+
+// loadAndBuildCachesMenu fills the Caches menu and keeps it current. It stays hidden for
+// transports with a single credential store, like SSPI.
+func loadAndBuildCachesMenu() {
+	cachesMenu.useDefault = mCachesMenu.AddSubMenuItemCheckbox("Default Cache", "Request tickets from KRB5CCNAME or the system's default cache", false)
+	go func() {
+		for range cachesMenu.useDefault.ClickedCh {
+			noteUserActivity()
+			if err := selectCCache(""); err != nil {
+				setStatusError(fmt.Sprintf("Switching caches failed: %s", truncateError(err)))
+			}
+		}
+	}()
+	cachesMenu.placeholder = mCachesMenu.AddSubMenuItem("No other caches", "Run kinit as another principal to add a cache")
+	cachesMenu.placeholder.Disable()
+
+	updateCachesMenu()
+	go func() {
+		for range time.Tick(credentialsMenuRefresh) {
+			updateCachesMenu()
+		}
+	}()
+}
+
+// updateCachesMenu lists the caches again and checks the one in use
+func updateCachesMenu() {
+	if mCachesMenu == nil {
+		return
+	}
+	caches, err := krb.ListCaches(krbOptions())
+
+	cachesMenu.mu.Lock()
+	defer cachesMenu.mu.Unlock()
+
+	if errors.Is(err, krb.ErrUnsupported) {
+		mCachesMenu.Hide()
+		return
+	}
+	mCachesMenu.Show()
+	if configOrFile().CCache == "" {
+		cachesMenu.useDefault.Check()
+	} else {
+		cachesMenu.useDefault.Uncheck()
+	}
+
+	for len(cachesMenu.slots) < len(caches) {
+		slot := mCachesMenu.AddSubMenuItemCheckbox("", "", false)
+		cachesMenu.slots = append(cachesMenu.slots, slot)
+		cachesMenu.names = append(cachesMenu.names, "")
+		go handleCCacheClick(slot, len(cachesMenu.slots)-1)
+	}
+	now := time.Now()
+	for i, slot := range cachesMenu.slots {
+		if i >= len(caches) {
+			slot.Hide()
+			continue
+		}
+		cachesMenu.names[i] = caches[i].Name
+		slot.SetTitle(describeCache(caches[i], now))
+		slot.SetTooltip("Request tickets from " + caches[i].Name)
+		if caches[i].Current {
+			slot.Check()
+		} else {
+			slot.Uncheck()
+		}
+		slot.Show()
+	}
+
+	switch {
+	case err != nil:
+		cachesMenu.placeholder.SetTitle("Can't list caches: " + truncateError(err))
+		cachesMenu.placeholder.Show()
+	case len(caches) == 0:
+		cachesMenu.placeholder.SetTitle("No caches")
+		cachesMenu.placeholder.Show()
+	default:
+		cachesMenu.placeholder.Hide()
+	}
+	mCachesMenu.SetTitle(fmt.Sprintf("Caches (%d)", len(caches)))
+}
+
+func handleCCacheClick(item *systray.MenuItem, index int) {
+	for range item.ClickedCh {
+		noteUserActivity()
+		cachesMenu.mu.Lock()
+		name := cachesMenu.names[index]
+		cachesMenu.mu.Unlock()
+		if err := selectCCache(name); err != nil {
+			setStatusError(fmt.Sprintf("Switching caches failed: %s", truncateError(err)))
+		}
+	}
+}
+
+// selectCCache saves name as the ccache tickets are requested from ("" for the default), then
+// replaces the current token, which came from the previous cache
+func selectCCache(name string) error {
+	if configOrFile().CCache == name {
+		updateCachesMenu()
+		return nil
+	}
+	err := editConfigFile(func(cfg *Config) (string, error) {
+		cfg.CCache = name
+		if name == "" {
+			return "Requesting tickets from the default cache", nil
+		}
+		return "Requesting tickets from " + name, nil
+	})
+	if err != nil {
+		return err
+	}
+	LogActionWithFields("ccache_selected", "Switched credential cache", map[string]interface{}{
+		"ccache": valueOrDash(name),
+	})
+	updateCachesMenu()
+	refreshStaleToken()
+	return nil
+}
+
+// findCache returns the cache name or principal refers to (case-insensitive)
+func findCache(caches []krb.CacheInfo, nameOrPrincipal string) (krb.CacheInfo, bool) {
+	for _, c := range caches {
+		if strings.EqualFold(c.Name, nameOrPrincipal) || strings.EqualFold(strings.TrimPrefix(nameOrPrincipal, "API:"), c.Name) {
+			return c, true
+		}
+	}
+	for _, c := range caches {
+		if strings.EqualFold(c.Principal, nameOrPrincipal) {
+			return c, true
+		}
+	}
+	return krb.CacheInfo{}, false
+}
+
+// ctlCaches lists the caches, marking the one in use, or switches to the one named (by name
+// or principal, or "default")
+func ctlCaches(args []string) (string, error) {
+	caches, err := krb.ListCaches(krbOptions())
+	if errors.Is(err, krb.ErrUnsupported) {
+		return "", fmt.Errorf("the %s transport has a single credential store", configOrFile().GetTransport())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(args) == 0 {
+		if len(caches) == 0 {
+			return "No credential caches", nil
+		}
+		now := time.Now()
+		lines := make([]string, len(caches))
+		for i, c := range caches {
+			mark := " "
+			if c.Current {
+				mark = "*"
+			}
+			lines[i] = fmt.Sprintf("%s %s  %s", mark, describeCache(c, now), c.Name)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if len(args) > 1 {
+		return "", fmt.Errorf("usage: caches [<cache>|<principal>|default]")
+	}
+
+	if strings.EqualFold(args[0], "default") {
+		if err := selectCCache(""); err != nil {
+			return "", err
+		}
+		return "Requesting tickets from the default cache", nil
+	}
+	c, ok := findCache(caches, args[0])
+	if !ok {
+		return "", fmt.Errorf("no cache %q (see caches)", args[0])
+	}
+	if err := selectCCache(c.Name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Requesting tickets from %s (%s)", c.Name, c.Principal), nil
+}
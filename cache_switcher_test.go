@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"krb5tray/pkg/krb"
+)
+
+// TestHeadlessCaches covers the Caches menu's listing of the mock caches and finding one
+func TestHeadlessCaches(t *testing.T) {
+	newHeadlessTray(t, `{"ccache": "MOCK:other@MOCK.TEST"}`)
+	caches, err := krb.ListCaches(krbOptions())
+	if err != nil || len(caches) != 2 {
+		t.Fatalf("caches = %+v, %v", caches, err)
+	}
+	c, ok := findCache(caches, "OTHER@mock.test")
+	if !ok || !c.Current || c.Name != "MOCK:other@MOCK.TEST" {
+		t.Errorf("found %+v, %v", c, ok)
+	}
+	if got := describeCache(c, time.Now()); !strings.HasPrefix(got, "other@MOCK.TEST (") || !strings.HasSuffix(got, " left)") {
+		t.Errorf("title = %q", got)
+	}
+	out, err := ctlCaches(nil)
+	if err != nil || !strings.Contains(out, "* other@MOCK.TEST") || strings.Count(out, "\n") != 1 {
+		t.Errorf("ctl caches = %q, %v", out, err)
+	}
+	if _, err := ctlCaches([]string{"nobody@MOCK.TEST"}); err == nil {
+		t.Error("switching to an unknown cache succeeded")
+	}
+}
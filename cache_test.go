@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestCachePersistOff covers turning persist off deleting the entries saved while it was on
+func TestCachePersistOff(t *testing.T) {
+	newHeadlessTray(t, `{}`)
+	t.Cleanup(func() { GetCache().DisablePersistence() })
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		fakeSecretTool(t)
+	}
+
+	ApplyCacheConfig(CacheConfig{Persist: true})
+	GetCache().SetSecret("db", "hunter2", time.Minute)
+	FlushCachePersistence()
+	if _, err := os.Stat(CachePersistPath()); err != nil {
+		t.Fatalf("cache.db wasn't written: %v", err)
+	}
+
+	ApplyCacheConfig(CacheConfig{})
+	if _, err := os.Stat(CachePersistPath()); !os.IsNotExist(err) {
+		t.Errorf("cache.db is still there: %v", err)
+	}
+}
+
+// fakeSecretTool puts a secret-tool on the PATH that keeps the stored secret in a file,
+// since the cache isn't persisted without a keystore
+func fakeSecretTool(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = store ]; then cat > " + dir + "/secret; else cat " + dir + "/secret 2>/dev/null; fi\n"
+	if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
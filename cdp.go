@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"krb5tray/internal/httpclient"
+)
+
+// defaultDebugPort is the port Chrome and Edge use for --remote-debugging-port by convention
+const defaultDebugPort = 9222
+
+// cdpTimeout bounds a whole exchange with the browser
+const cdpTimeout = 10 * time.Second
+
+// websocketGUID is appended to the handshake key to compute Sec-WebSocket-Accept (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// cdpCookie is a Storage.setCookies CookieParam. Either URL (host-only cookie) or Domain
+// is set.
+type cdpCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	URL      string  `json:"url,omitempty"`
+	Domain   string  `json:"domain,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	HTTPOnly bool    `json:"httpOnly,omitempty"`
+	SameSite string  `json:"sameSite,omitempty"`
+	Expires  float64 `json:"expires,omitempty"` // Seconds since the epoch; session cookie when 0
+}
+
+// cdpConn is a DevTools protocol connection to a browser's remote debugging endpoint.
+// Only what's needed to send a few commands is implemented: unfragmented text frames,
+// and no ping handling, since the browser doesn't ping during such a short exchange.
+type cdpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+// dialCDP connects to the browser-level target of the browser listening on port 127.0.0.1:port
+func dialCDP(ctx context.Context, port int) (*cdpConn, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://127.0.0.1:%d/json/version", port), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpclient.Client(false).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no browser with remote debugging on port %d (start it with --remote-debugging-port=%d): %w", port, port, err)
+	}
+	defer resp.Body.Close()
+	var version struct {
+		Browser string `json:"Browser"`
+		WSURL   string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil || version.WSURL == "" {
+		return nil, fmt.Errorf("port %d does not look like a DevTools endpoint", port)
+	}
+	wsURL, err := url.Parse(version.WSURL)
+	if err != nil || wsURL.Scheme != "ws" {
+		return nil, fmt.Errorf("unexpected DevTools websocket URL %q", version.WSURL)
+	}
+	LogDebug("Connecting to %s over DevTools", version.Browser)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", wsURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c := &cdpConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.handshake(wsURL); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake upgrades the connection to a websocket. No Origin header is sent: browsers
+// only refuse DevTools connections whose Origin isn't allowed.
+func (c *cdpConn) handshake(u *url.URL) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		u.RequestURI(), u.Host, key)
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(c.reader, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("DevTools refused the connection: %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return fmt.Errorf("DevTools handshake failed")
+	}
+	return nil
+}
+
+// call sends a command and waits for its result, skipping events
+func (c *cdpConn) call(method string, params interface{}) (json.RawMessage, error) {
+	c.nextID++
+	msg, err := json.Marshal(map[string]interface{}{"id": c.nextID, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeFrame(msg); err != nil {
+		return nil, err
+	}
+	for {
+		data, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		var resp struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, err
+		}
+		if resp.ID != c.nextID {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("%s: %s", method, resp.Error.Message)
+		}
+		return resp.Result, nil
+	}
+}
+
+// writeFrame sends data as one masked text frame, as clients must
+func (c *cdpConn) writeFrame(data []byte) error {
+	header := []byte{0x81} // FIN, text
+	switch n := len(data); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 0x80|126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	header = append(header, mask...)
+
+	masked := make([]byte, len(data))
+	for i, b := range data {
+		masked[i] = b ^ mask[i%4]
+	}
+	_, err := c.conn.Write(append(header, masked...))
+	return err
+}
+
+// readFrame reads one unfragmented text frame
+func (c *cdpConn) readFrame() ([]byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[0]&0x80 == 0 || (opcode != 0x1 && opcode != 0x8) {
+		return nil, fmt.Errorf("unsupported websocket frame (opcode %d)", opcode)
+	}
+
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > 16<<20 {
+		return nil, fmt.Errorf("websocket frame too large")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return nil, err
+	}
+	if opcode == 0x8 {
+		return nil, fmt.Errorf("the browser closed the DevTools connection")
+	}
+	return data, nil
+}
+
+func (c *cdpConn) Close() error {
+	return c.conn.Close()
+}
+
+// pushBrowserCookies sets cookies in the browser with remote debugging on port and, if
+// openURL is set, opens it in a new tab
+func pushBrowserCookies(port int, cookies []cdpCookie, openURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cdpTimeout)
+	defer cancel()
+
+	conn, err := dialCDP(ctx, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.call("Storage.setCookies", map[string]interface{}{"cookies": cookies}); err != nil {
+		return err
+	}
+	if openURL != "" {
+		if _, err := conn.call("Target.createTarget", map[string]string{"url": openURL}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cdpCookieFrom converts a cookie as the server set it for u
+func cdpCookieFrom(c *http.Cookie, u *url.URL) cdpCookie {
+	p := cdpCookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HTTPOnly: c.HttpOnly,
+	}
+	if c.Domain != "" {
+		p.Domain = c.Domain
+	} else {
+		p.URL = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+	}
+	if p.Path == "" {
+		p.Path = "/"
+	}
+	switch {
+	case c.MaxAge > 0:
+		p.Expires = float64(time.Now().Add(time.Duration(c.MaxAge) * time.Second).Unix())
+	case !c.Expires.IsZero():
+		p.Expires = float64(c.Expires.Unix())
+	}
+	switch c.SameSite {
+	case http.SameSiteStrictMode:
+		p.SameSite = "Strict"
+	case http.SameSiteLaxMode:
+		p.SameSite = "Lax"
+	case http.SameSiteNoneMode:
+		p.SameSite = "None"
+	}
+	if strings.HasPrefix(c.Name, "__Host-") {
+		// Must be host-only
+		p.Domain = ""
+		p.URL = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+	}
+	return p
+}
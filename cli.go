@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CLI exit codes
+const (
+	exitOK          = 0
+	exitFailure     = 1 // The requested operation failed (e.g. no ticket could be obtained)
+	exitUsage       = 2 // Invalid command line
+	exitUnsupported = 3 // Not supported on this platform
+	exitNotRunning  = 4 // No running tray instance to control
+
+	// Ticket failures that wrappers may want to handle differently (see classifyTicketError)
+	exitNoTGT          = 5 // No TGT, or it expired: kinit or sign in again
+	exitKDCUnreachable = 6 // The KDC couldn't be reached
+	exitBadSPN         = 7 // The SPN is malformed or unknown to the KDC
+	exitClockSkew      = 8 // The clock is too far from the KDC's
+)
+
+// cliCommand is a headless subcommand
+type cliCommand struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string, stdout io.Writer, stderr io.Writer) int
+}
+
+// cliCommands lists the available subcommands
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{
+			name:    "tray",
+			usage:   "tray [--<ctl-command> [args...]]",
+			summary: "Start the system tray application (the default with no command)",
+			run:     runTrayCommand,
+		},
+		{
+			name:    "token",
+			usage:   "token [--header] [--json] [--debug] <spn-or-name | ->",
+			summary: "Print a base64 Kerberos token (or Negotiate header) for an SPN",
+			run:     runTokenCommand,
+		},
+		{
+			name:    "token-set",
+			usage:   "token-set [--out file] [--json] [--debug] <set>",
+			summary: "Print the Negotiate headers of a token set's SPNs, or write them to a JSON file",
+			run:     runTokenSetCommand,
+		},
+		{
+			name:    "curl",
+			usage:   "curl [--spn spn] [--debug] <curl arguments...>",
+			summary: "Run curl with a Negotiate header for the SPN that spn_map maps the URL to",
+			run:     runCurlCommand,
+		},
+		{
+			name:    "env",
+			usage:   "env [--spn name[=VAR]]... [--token name[=VAR]]... [--secret key[=VAR]]... [--powershell] [--file]",
+			summary: "Print shell export lines for tokens and the running tray's cached secrets",
+			run:     runEnvCommand,
+		},
+		{
+			name:    "run-script",
+			usage:   "run-script [--json] [--debug] <name.lua> [key=value...]",
+			summary: "Run a Lua script headless and print its result",
+			run:     runScriptCommand,
+		},
+		{
+			name:    "validate-config",
+			usage:   "validate-config [--json] [path]",
+			summary: "Check the config file for errors",
+			run:     runValidateConfigCommand,
+		},
+		{
+			name:    "trust-path",
+			usage:   "trust-path [--json] [--debug] <spn-or-name>",
+			summary: "Follow the cross-realm path to an SPN's realm and report where it breaks",
+			run:     runTrustPathCommand,
+		},
+		{
+			name:    "delegate-token",
+			usage:   "delegate-token [--ccache file] [--header] [--json] [--debug] <user> <spn-or-name>",
+			summary: "Print a token for an SPN on behalf of a user, to test constrained delegation (S4U2Proxy)",
+			run:     runDelegateTokenCommand,
+		},
+		{
+			name:    "sspi-packages",
+			usage:   "sspi-packages [--json]",
+			summary: "List the SSPI security packages installed on Windows",
+			run:     runSSPIPackagesCommand,
+		},
+		{
+			name:    "ssh-proxy",
+			usage:   "ssh-proxy [--gateway host:port] [--spn spn] <host> <port>",
+			summary: "Tunnel stdin/stdout through a Kerberos HTTP CONNECT gateway (ssh ProxyCommand)",
+			run:     runSSHProxyCommand,
+		},
+		{
+			name:    "ssh-session",
+			usage:   "ssh-session [--debug] <name> [command...]",
+			summary: "Open a shell (or run a command) for a builtin SSH entry",
+			run:     runSSHSessionCommand,
+		},
+		{
+			name:    "ctl",
+			usage:   "ctl [--json] <command> [args...]",
+			summary: "Control the running tray instance (see: ctl help)",
+			run:     runCtlCommand,
+		},
+		{
+			name:    "import-env",
+			usage:   "import-env [--bookmarks] [--dry-run] [--json]",
+			summary: "Add SPNs, SSH hosts and URLs found in krb5.conf, the ccache, ~/.ssh/config and bookmarks to the config",
+			run:     runImportEnvCommand,
+		},
+		{
+			name:    "history",
+			usage:   "history [--since 24h] [--until time] [--action name] [--json] [text]",
+			summary: "List the actions the tray recorded (tokens fetched, scripts run, SSH opened, ...)",
+			run:     runHistoryCommand,
+		},
+		{
+			name:    "hash-pin",
+			usage:   "hash-pin",
+			summary: "Read a PIN and print the bcrypt hash for secrets_lock.pin_hash",
+			run:     runHashPINCommand,
+		},
+		{
+			name:    "enroll-security-key",
+			usage:   "enroll-security-key [device]",
+			summary: "Make a credential on a FIDO2 security key and print the security_key config section",
+			run:     runEnrollSecurityKeyCommand,
+		},
+		{
+			name:    "install-service",
+			usage:   "install-service [--print]",
+			summary: "Start the tray at login (systemd user unit, LaunchAgent, or scheduled task)",
+			run:     runInstallServiceCommand,
+		},
+		{
+			name:    "uninstall-service",
+			usage:   "uninstall-service",
+			summary: "Remove the login service installed by install-service",
+			run:     runUninstallServiceCommand,
+		},
+		{
+			name:    "completion",
+			usage:   "completion <bash|zsh|fish>",
+			summary: "Print a shell completion script",
+			run:     runCompletionCommand,
+		},
+		{
+			name:    "version",
+			usage:   "version [--json]",
+			summary: "Print version information",
+			run:     runVersionCommand,
+		},
+	}
+}
+
+// isCLIInvocation reports whether the command line requests a headless subcommand
+func isCLIInvocation(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		return true
+	}
+	for _, cmd := range cliCommands() {
+		if cmd.name == args[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLI runs a headless subcommand and returns the process exit code
+func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
+	for _, cmd := range cliCommands() {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	printCLIUsage(stdout)
+	return exitOK
+}
+
+// printCLIUsage prints the list of subcommands
+func printCLIUsage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: krb5tray [command]")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "Without a command, krb5tray starts the system tray application.")
+	_, _ = fmt.Fprintln(w, "Any ctl command can be given as an option, e.g. \"krb5tray --copy-header\": it is sent to")
+	_, _ = fmt.Fprintln(w, "the running instance if there is one, or run once the new tray has started.")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, cmd := range cliCommands() {
+		_, _ = fmt.Fprintf(w, "  %-58s %s\n", cmd.usage, cmd.summary)
+	}
+}
+
+// runTrayCommand starts the tray, same as running without a command or with only options
+func runTrayCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	return runTray(args)
+}
+
+// runTokenCommand prints a token for an SPN given by config name or literal SPN.
+// With "-" as the argument, SPNs are read from stdin one per line.
+func runTokenCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	header := fs.Bool("header", false, "Print an HTTP Authorization header value (Negotiate <token>)")
+	asJSON := fs.Bool("json", false, "Print a JSON record per SPN ({\"spn\", \"token\"} or {\"spn\", \"error\"})")
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray token [--header] [--json] [--debug] <spn-or-name | ->")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "The argument is matched against SPN names in the config first,")
+		_, _ = fmt.Fprintln(stderr, "otherwise it is used as the SPN itself (e.g. HTTP/host.example.com).")
+		_, _ = fmt.Fprintln(stderr, "With -, SPNs are read from stdin one per line and a token is printed per line.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+	out := tokenPrinter{stdout: stdout, stderr: stderr, header: *header, asJSON: *asJSON}
+
+	if fs.Arg(0) != "-" {
+		return ticketErrorExitCode(out.print(cfg.ResolveSPN(fs.Arg(0))))
+	}
+
+	// Batch mode: keep going after failures so each input line gets an output line.
+	// The exit code is that of the first failure.
+	code := exitOK
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if class := out.print(cfg.ResolveSPN(line)); class != "" && code == exitOK {
+			code = ticketErrorExitCode(class)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: failed to read stdin: %v\n", err)
+		return exitFailure
+	}
+	return code
+}
+
+// tokenPrinter writes token command output in the selected format
+type tokenPrinter struct {
+	stdout io.Writer
+	stderr io.Writer
+	header bool
+	asJSON bool
+}
+
+// tokenRecord is one line of "token --json" output
+type tokenRecord struct {
+	SPN        string     `json:"spn"`
+	Token      string     `json:"token,omitempty"`
+	TokenSize  int        `json:"token_size,omitempty"` // Size of the raw (decoded) token in bytes
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // When the tray would stop reusing this token
+	Error      string     `json:"error,omitempty"`
+	ErrorClass string     `json:"error_class,omitempty"` // One of the ticketErr* classes
+	Hint       string     `json:"hint,omitempty"`        // What to do about the error, if anything specific
+}
+
+// print gets a token for spn and writes it, returning the failure class ("" on success).
+// On failure a blank line (or an error record) is still written so batch output stays line-aligned.
+func (p tokenPrinter) print(spn string) string {
+	issued := time.Now()
+	token, err := getServiceTicket(spn)
+	if err != nil {
+		class := classifyTicketError(err)
+		_, _ = fmt.Fprintf(p.stderr, "krb5tray: failed to get ticket for %s: %v\n", spn, err)
+		if hint := ticketErrorHint(class); hint != "" {
+			_, _ = fmt.Fprintf(p.stderr, "krb5tray: %s\n", hint)
+		}
+		if class == ticketErrBadSPN || class == ticketErrOther {
+			if hint := trustPathHint(spn); hint != "" {
+				_, _ = fmt.Fprintf(p.stderr, "krb5tray: %s\n", hint)
+			}
+		}
+		if p.asJSON {
+			writeCLIJSON(p.stdout, p.stderr, tokenRecord{SPN: spn, Error: err.Error(), ErrorClass: class, Hint: ticketErrorHint(class)})
+		} else {
+			_, _ = fmt.Fprintln(p.stdout)
+		}
+		return class
+	}
+	size := len(token)
+
+	// Build the output line in a byte slice that is zeroed afterwards, like the raw token
+	prefix := ""
+	if p.header {
+		prefix = "Negotiate "
+	}
+	line := make([]byte, len(prefix)+base64.StdEncoding.EncodedLen(size)+1)
+	copy(line, prefix)
+	base64.StdEncoding.Encode(line[len(prefix):], token)
+	line[len(line)-1] = '\n'
+	zeroBytes(token)
+	defer zeroBytes(line)
+
+	if p.asJSON {
+		expires := issued.Add(configOrFile().GetTokenTTL(spn))
+		writeCLIJSON(p.stdout, p.stderr, tokenRecord{SPN: spn, Token: string(line[:len(line)-1]), TokenSize: size, ExpiresAt: &expires})
+	} else {
+		_, _ = p.stdout.Write(line)
+	}
+	return ""
+}
+
+// writeCLIJSON writes v as a single line of JSON
+func writeCLIJSON(stdout io.Writer, stderr io.Writer, v interface{}) {
+	if err := json.NewEncoder(stdout).Encode(v); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+	}
+}
+
+// runScriptCommand runs a Lua script without the tray, printing its result to stdout
+func runScriptCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("run-script", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Print {\"script\", \"ok\", \"result\"} or {\"script\", \"ok\", \"error\", \"error_class\"} as JSON")
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray run-script [--json] [--debug] <name.lua> [key=value...]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintf(stderr, "Scripts are loaded from %s; key=value pairs become ctx variables.\n", ScriptsDir())
+		_, _ = fmt.Fprintln(stderr, "Use 'krb5tray ctl run-script' instead to run it inside the running tray.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	ctx, err := scriptContextFromArgs(fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitUsage
+	}
+
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+	setConfig(cfg)
+
+	// The cache lives only for this run; persistence is left to the tray
+	InitCache()
+	refreshCacheNamespace(cfg)
+	if err := InitLuaEngine(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+
+	result, err := GetLuaEngine().RunScript(fs.Arg(0), ctx)
+	if *asJSON {
+		record := scriptRecord{Script: fs.Arg(0), OK: err == nil, Result: result}
+		if err != nil {
+			record.Error = err.Error()
+			record.ErrorClass = "script_error"
+			if _, statErr := os.Stat(ScriptPath(fs.Arg(0))); statErr != nil {
+				record.ErrorClass = "script_not_found"
+			}
+		}
+		writeCLIJSON(stdout, stderr, record)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	if result != "" && !*asJSON {
+		_, _ = fmt.Fprintln(stdout, result)
+	}
+	return exitOK
+}
+
+// scriptRecord is the "run-script --json" output
+type scriptRecord struct {
+	Script     string `json:"script"`
+	OK         bool   `json:"ok"`
+	Result     string `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"` // "script_not_found" or "script_error"
+}
+
+// runValidateConfigCommand loads the config strictly and reports any problems
+func runValidateConfigCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Print {\"path\", \"ok\", \"problems\"} as JSON")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray validate-config [--json] [path]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	path := DefaultConfigPath()
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+
+	record := configRecord{Path: path}
+	cfg, err := LoadConfigStrict(path)
+	if err != nil {
+		record.Problems = []string{err.Error()}
+		record.ErrorClass = "invalid_json"
+		if errors.Is(err, os.ErrNotExist) {
+			record.ErrorClass = "not_found"
+		}
+	} else if record.Problems = cfg.Validate(); len(record.Problems) > 0 {
+		record.ErrorClass = "invalid"
+	}
+	record.OK = len(record.Problems) == 0
+
+	if *asJSON {
+		writeCLIJSON(stdout, stderr, record)
+	} else {
+		for _, problem := range record.Problems {
+			_, _ = fmt.Fprintf(stderr, "%s: %s\n", path, problem)
+		}
+		if record.OK {
+			_, _ = fmt.Fprintf(stdout, "%s: OK (%d SPNs, %d secrets, %d URLs, %d snippets, %d SSH entries)\n",
+				path, len(cfg.SPNs), len(cfg.Secrets), len(cfg.URLs), len(cfg.Snippets), len(cfg.SSH))
+		}
+	}
+	if !record.OK {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// configRecord is the "validate-config --json" output
+type configRecord struct {
+	Path       string   `json:"path"`
+	OK         bool     `json:"ok"`
+	Problems   []string `json:"problems,omitempty"`
+	ErrorClass string   `json:"error_class,omitempty"` // "not_found", "invalid_json", or "invalid"
+}
+
+// runVersionCommand prints version information
+func runVersionCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Print version information as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *asJSON {
+		writeCLIJSON(stdout, stderr, map[string]string{
+			"version":    Version,
+			"commit":     commit,
+			"build_date": buildDate,
+		})
+		return exitOK
+	}
+	_, _ = fmt.Fprintf(stdout, "krb5tray %s (commit %s, built %s)\n", Version, getShortCommit(), buildDate)
+	return exitOK
+}
+
+// runCtlCommand sends a command to the running tray instance over the control socket
+func runCtlCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	// --json must come before the command, since later arguments belong to the command
+	asJSON := len(args) > 0 && args[0] == "--json"
+	if asJSON {
+		args = args[1:]
+	}
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printCtlUsage(stdout)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	if _, ok := controlCommands()[args[0]]; !ok {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: unknown ctl command: %s\n", args[0])
+		printCtlUsage(stderr)
+		return exitUsage
+	}
+
+	resp, err := sendControlRequest(controlRequest{Command: args[0], Args: args[1:]})
+	if err != nil {
+		if asJSON {
+			writeCLIJSON(stdout, stderr, ctlRecord{Command: args[0], Message: err.Error(), ErrorClass: "not_running"})
+		}
+		_, _ = fmt.Fprintf(stderr, "krb5tray: cannot reach the running instance (is the tray running?): %v\n", err)
+		return exitNotRunning
+	}
+	if asJSON {
+		record := ctlRecord{Command: args[0], OK: resp.OK, Message: resp.Message}
+		if !resp.OK {
+			record.ErrorClass = "failed"
+		}
+		writeCLIJSON(stdout, stderr, record)
+		if !resp.OK {
+			return exitFailure
+		}
+		return exitOK
+	}
+	if !resp.OK {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %s\n", resp.Message)
+		return exitFailure
+	}
+	if resp.Message != "" {
+		_, _ = fmt.Fprintln(stdout, resp.Message)
+	}
+	return exitOK
+}
+
+// ctlRecord is the "ctl --json" output
+type ctlRecord struct {
+	Command    string `json:"command"`
+	OK         bool   `json:"ok"`
+	Message    string `json:"message,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"` // "not_running" or "failed"
+}
+
+// printCtlUsage prints the commands accepted by the running instance
+func printCtlUsage(w io.Writer) {
+	commands := controlCommands()
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	_, _ = fmt.Fprintln(w, "Usage: krb5tray ctl [--json] <command> [args...]")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		cmd := commands[name]
+		_, _ = fmt.Fprintf(w, "  %-40s %s\n", cmd.usage, cmd.summary)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// runCompletionCommand prints a completion script for the given shell
+func runCompletionCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 1 {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray completion <bash|zsh|fish>")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "  bash:  source <(krb5tray completion bash)")
+		_, _ = fmt.Fprintln(stderr, "  zsh:   krb5tray completion zsh > \"${fpath[1]}/_krb5tray\"")
+		_, _ = fmt.Fprintln(stderr, "  fish:  krb5tray completion fish > ~/.config/fish/completions/krb5tray.fish")
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "bash":
+		_, _ = io.WriteString(stdout, bashCompletion())
+	case "zsh":
+		_, _ = io.WriteString(stdout, zshCompletion())
+	case "fish":
+		_, _ = io.WriteString(stdout, fishCompletion())
+	default:
+		_, _ = fmt.Fprintf(stderr, "krb5tray: unsupported shell %q (use bash, zsh, or fish)\n", args[0])
+		return exitUsage
+	}
+	return exitOK
+}
+
+// completionWord is a completion candidate with its description
+type completionWord struct {
+	word    string
+	summary string
+}
+
+func subcommandWords() []completionWord {
+	var words []completionWord
+	for _, cmd := range cliCommands() {
+		words = append(words, completionWord{cmd.name, cmd.summary})
+	}
+	return words
+}
+
+func ctlCommandWords() []completionWord {
+	var words []completionWord
+	for name, cmd := range controlCommands() {
+		words = append(words, completionWord{name, cmd.summary})
+	}
+	sort.Slice(words, func(i, j int) bool { return words[i].word < words[j].word })
+	return words
+}
+
+func joinWords(words []completionWord) string {
+	names := make([]string, len(words))
+	for i, w := range words {
+		names[i] = w.word
+	}
+	return strings.Join(names, " ")
+}
+
+// shellQuote quotes s for single-quoted shell strings
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func bashCompletion() string {
+	return fmt.Sprintf(`# bash completion for krb5tray
+_krb5tray() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W %s -- "$cur"))
+        return
+    fi
+    case "${COMP_WORDS[1]}" in
+        token)
+            COMPREPLY=($(compgen -W "--header --json --debug" -- "$cur"))
+            ;;
+        token-set)
+            COMPREPLY=($(compgen -W "--out --json --debug" -- "$cur"))
+            ;;
+        delegate-token)
+            COMPREPLY=($(compgen -W "--ccache --header --json --debug" -- "$cur"))
+            ;;
+        run-script)
+            if [ "$COMP_CWORD" -eq 2 ]; then
+                COMPREPLY=($(cd %s 2>/dev/null && compgen -f -X '!*.lua' -- "$cur"))
+            fi
+            ;;
+        validate-config)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            ;;
+        import-env)
+            COMPREPLY=($(compgen -W "--bookmarks --dry-run --json" -- "$cur"))
+            ;;
+        history)
+            COMPREPLY=($(compgen -W "--since --until --action --json" -- "$cur"))
+            ;;
+        ctl)
+            if [ "$COMP_CWORD" -eq 2 ]; then
+                COMPREPLY=($(compgen -W %s -- "$cur"))
+            fi
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+            ;;
+    esac
+}
+complete -F _krb5tray krb5tray
+`, shellQuote(joinWords(subcommandWords())), shellQuote(ScriptsDir()), shellQuote(joinWords(ctlCommandWords())))
+}
+
+// zshDescribe formats words as a zsh array for _describe
+func zshDescribe(words []completionWord) string {
+	var b strings.Builder
+	for _, w := range words {
+		b.WriteString("        " + shellQuote(w.word+":"+strings.ReplaceAll(w.summary, ":", `\:`)) + "\n")
+	}
+	return b.String()
+}
+
+func zshCompletion() string {
+	return fmt.Sprintf(`#compdef krb5tray
+
+_krb5tray() {
+    local -a commands ctl_commands
+    commands=(
+%s    )
+    ctl_commands=(
+%s    )
+
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+    case $words[2] in
+        token)
+            compadd -- --header --json --debug
+            ;;
+        token-set)
+            compadd -- --out --json --debug
+            ;;
+        delegate-token)
+            compadd -- --ccache --header --json --debug
+            ;;
+        run-script)
+            (( CURRENT == 3 )) && _files -W %s -g '*.lua'
+            ;;
+        validate-config)
+            _files
+            ;;
+        import-env)
+            compadd -- --bookmarks --dry-run --json
+            ;;
+        history)
+            compadd -- --since --until --action --json
+            ;;
+        ctl)
+            (( CURRENT == 3 )) && _describe 'ctl command' ctl_commands
+            ;;
+        completion)
+            compadd bash zsh fish
+            ;;
+    esac
+}
+
+if [ "$funcstack[1]" = "_krb5tray" ]; then
+    _krb5tray "$@"
+else
+    compdef _krb5tray krb5tray
+fi
+`, zshDescribe(subcommandWords()), zshDescribe(ctlCommandWords()), shellQuote(ScriptsDir()))
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for krb5tray\n")
+	b.WriteString("complete -c krb5tray -f\n")
+	for _, w := range subcommandWords() {
+		fmt.Fprintf(&b, "complete -c krb5tray -n __fish_use_subcommand -a %s -d %s\n", w.word, shellQuote(w.summary))
+	}
+	for _, w := range ctlCommandWords() {
+		fmt.Fprintf(&b, "complete -c krb5tray -n '__fish_seen_subcommand_from ctl' -a %s -d %s\n", w.word, shellQuote(w.summary))
+	}
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from token delegate-token' -l header -d 'Print a Negotiate header'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from token delegate-token' -l json -d 'Print JSON records'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from delegate-token' -l ccache -r -F -d 'Credential cache of the service account'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from token-set' -l out -r -F -d 'Write the set to a JSON file'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from token-set' -l json -d 'Print JSON records'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from token token-set delegate-token run-script' -l debug -d 'Enable transport debug output'\n")
+	fmt.Fprintf(&b, "complete -c krb5tray -n '__fish_seen_subcommand_from run-script' -a \"(ls %s 2>/dev/null | string match '*.lua')\"\n", shellQuote(ScriptsDir()))
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from validate-config' -F\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from import-env' -l bookmarks -d 'Also add browser bookmarks in the Kerberos domains'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from import-env' -l dry-run -d 'Only print what would be added'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from import-env' -l json -d 'Print JSON records'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from history' -l since -r -d 'Only actions after a duration back or a date'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from history' -l until -r -d 'Only actions before a duration back or a date'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from history' -l action -r -d 'Only actions whose name starts with this'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from history' -l json -d 'Print JSON records'\n")
+	b.WriteString("complete -c krb5tray -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n")
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"krb5tray/internal/cache"
+)
+
+// DefaultClipboardMaxSizeKB is the largest value copied as is unless clipboard.max_size_kb
+// says otherwise
+const DefaultClipboardMaxSizeKB = 1024
+
+// What values larger than clipboard.max_size_kb become
+const (
+	clipboardOversizeTruncate = "truncate"
+	clipboardOversizeFile     = "file"
+)
+
+var (
+	// clipboardFilesMutex guards clipboardFiles
+	clipboardFilesMutex sync.Mutex
+
+	// clipboardFiles are the files oversized values were saved to, removed on exit
+	clipboardFiles []string
+)
+
+// clipboardOptions holds the active clipboard settings used by the platform implementations
+var clipboardOptions = DefaultClipboardConfig()
+
+// ApplyClipboardConfig applies clipboard settings from the configuration
+func ApplyClipboardConfig(cfg ClipboardConfig) {
+	clipboardOptions = cfg
+	GetClipboardHistory().Configure(cfg)
+}
+
+// typeStartDelay gives the target window time to regain focus (e.g. after a menu closes)
+const typeStartDelay = 300 * time.Millisecond
+
+// typeText injects text into the focused window as simulated keystrokes, bypassing the clipboard
+func typeText(text string) error {
+	time.Sleep(typeStartDelay)
+	delay := time.Duration(clipboardOptions.TypeDelayMs) * time.Millisecond
+	return typeTextPlatform(text, delay)
+}
+
+// shouldTypeOut reports whether a snippet should be typed rather than copied
+func shouldTypeOut(entry SnippetEntry) bool {
+	return entry.TypeOut || clipboardOptions.TypeOut
+}
+
+// fitClipboard returns what to copy for text, which label describes: text itself, or if it
+// is larger than clipboard.max_size_kb, its start or the path of a temporary file holding
+// it. Huge values make some clipboard managers and X11 clients hang, so they are cut down
+// with a warning instead.
+func fitClipboard(label string, text string) (string, error) {
+	limit := clipboardOptions.MaxSizeKB * 1024
+	if limit < 0 || len(text) <= limit {
+		return text, nil
+	}
+
+	if clipboardOptions.Oversize == clipboardOversizeFile {
+		path, err := writeClipboardFile(text)
+		if err != nil {
+			return "", fmt.Errorf("%s is larger than %d KB and couldn't be saved to a file: %w", label, clipboardOptions.MaxSizeKB, err)
+		}
+		LogWarn("%s is %s, more than clipboard.max_size_kb; copying the path of %s instead", label, cache.FormatBytes(len(text)), path)
+		notifyUser("Copied a file path", fmt.Sprintf("%s is %s, so it was saved to %s", label, cache.FormatBytes(len(text)), path))
+		return path, nil
+	}
+
+	// Cut at a character boundary
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	LogWarn("%s is %s, more than clipboard.max_size_kb; copying the first %s", label, cache.FormatBytes(len(text)), cache.FormatBytes(limit))
+	notifyUser("Clipboard value truncated", fmt.Sprintf("Only the first %s of %s (%s) were copied", cache.FormatBytes(limit), label, cache.FormatBytes(len(text))))
+	return text[:limit], nil
+}
+
+// writeClipboardFile saves an oversized value to a new temporary file readable only by the
+// user, and returns its path
+func writeClipboardFile(text string) (string, error) {
+	f, err := os.CreateTemp("", "krb5tray-clipboard-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	if _, err := f.WriteString(text); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	clipboardFilesMutex.Lock()
+	clipboardFiles = append(clipboardFiles, path)
+	clipboardFilesMutex.Unlock()
+	return path, nil
+}
+
+// removeClipboardFiles deletes the files oversized values were saved to
+func removeClipboardFiles() {
+	clipboardFilesMutex.Lock()
+	files := clipboardFiles
+	clipboardFiles = nil
+	clipboardFilesMutex.Unlock()
+	for _, path := range files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			LogWarn("Failed to remove clipboard file %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What asked for a copy, recorded in the audit log
+const (
+	requesterMenu         = "menu"
+	requesterHotkey       = "hotkey"
+	requesterScript       = "script"
+	requesterCtl          = "ctl"
+	requesterNotification = "notification"
+)
+
+// confirmSensitiveCopy asks the user before a token or secret is copied, if the clipboard
+// config requires it, and logs an audit event either way. target names what would be
+// copied, never the value.
+func confirmSensitiveCopy(target string, requester string) bool {
+	if !currentConfig().GetClipboardConfigWithDefaults().ConfirmCopy {
+		return true
+	}
+
+	message := fmt.Sprintf("Copy %s to the clipboard?\n\nRequested by: %s", target, requester)
+	confirmed := ConfirmDialog("Copy Sensitive Value", message)
+	LogActionWithFields("sensitive_copy", fmt.Sprintf("Copy of %s requested by %s", target, requester), map[string]interface{}{
+		"target":    target,
+		"requester": requester,
+		"confirmed": confirmed,
+	})
+	if !confirmed {
+		setStatus(fmt.Sprintf("Not copied: %s", truncateString(target, 30)))
+	}
+	return confirmed
+}
+
+// containsHeldToken reports whether text contains the current token or a cached token,
+// JWT, or secret. It's used for values whose origin isn't known, such as script output.
+func containsHeldToken(text string) bool {
+	if text == "" {
+		return false
+	}
+	stateMutex.RLock()
+	current := lastToken.String()
+	stateMutex.RUnlock()
+	if current != "" && strings.Contains(text, current) {
+		return true
+	}
+
+	for _, entry := range GetCache().ListEntries() {
+		if entry.Type == "custom" || len(entry.Value) < 8 {
+			continue
+		}
+		if strings.Contains(text, entry.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// copySecretToClipboard copies a token or secret after confirmSensitiveCopy allows it,
+// marking the history entry so restoring it asks again, or with clipboard.type_out_secrets
+// types it into the focused window instead. It reports false if the user declined.
+func copySecretToClipboard(label string, text string, requester string) (bool, error) {
+	if !confirmSensitiveCopy(label, requester) {
+		return false, nil
+	}
+	if clipboardOptions.TypeOutSecrets {
+		return true, typeText(text)
+	}
+	return true, addSecretToClipboard(label, text)
+}
+
+// putSecretOnClipboard is copySecretToClipboard for values meant for another application
+// than the focused window, which always go on the clipboard
+func putSecretOnClipboard(label string, text string, requester string) (bool, error) {
+	if !confirmSensitiveCopy(label, requester) {
+		return false, nil
+	}
+	return true, addSecretToClipboard(label, text)
+}
+
+// addSecretToClipboard copies a token or secret the user agreed to, marking its history
+// entry as secret
+func addSecretToClipboard(label string, text string) error {
+	text, err := fitClipboard(label, text)
+	if err != nil {
+		return err
+	}
+	if err := copyToClipboard(text); err != nil {
+		return err
+	}
+	GetClipboardHistory().Add(label, text, true)
+	if historyMenu != nil {
+		updateHistoryMenu()
+	}
+	return nil
+}
+
+// secretCopyVerb is how status messages describe a copySecretToClipboard that succeeded
+func secretCopyVerb() string {
+	if clipboardOptions.TypeOutSecrets {
+		return "Typed"
+	}
+	return "Copied"
+}
+
+// logSecretCopy logs a token or secret handed over by copySecretToClipboard
+func logSecretCopy(itemType string, itemName string) {
+	if clipboardOptions.TypeOutSecrets {
+		LogAction("text_typed", fmt.Sprintf("Typed %s: %s", itemType, itemName))
+		return
+	}
+	LogClipboardCopy(itemType, itemName)
+}
+
+// copyOutputToClipboard copies script output, asking first like copySecretToClipboard if
+// confirm_copy is set and the output contains a token or secret the tray holds
+func copyOutputToClipboard(label string, text string, requester string) (bool, error) {
+	if currentConfig().GetClipboardConfigWithDefaults().ConfirmCopy && containsHeldToken(text) {
+		return putSecretOnClipboard(label, text, requester)
+	}
+	return true, copyToClipboardWithHistory(label, text)
+}
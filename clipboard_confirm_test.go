@@ -0,0 +1,32 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestTypeOutSecrets checks that with clipboard.type_out_secrets a token is typed rather
+// than copied, and never lands in the clipboard history
+func TestTypeOutSecrets(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("typing is only checked against XTest")
+	}
+	newHeadlessTray(t, `{"clipboard": {"type_out_secrets": true}}`)
+	ApplyClipboardConfig(currentConfig().GetClipboardConfigWithDefaults())
+	t.Cleanup(func() { ApplyClipboardConfig(DefaultClipboardConfig()) })
+	GetClipboardHistory().Clear()
+
+	// Without a display the keystrokes can't be sent, which shows the value took the typing path
+	t.Setenv("DISPLAY", "")
+	copied, err := copySecretToClipboard("Token", "c2VjcmV0LXRva2Vu", requesterMenu)
+	if !copied || err == nil || !strings.Contains(err.Error(), "X display") {
+		t.Errorf("copySecretToClipboard = %v, %v, want a typing error", copied, err)
+	}
+	if got := GetClipboardHistory().Len(); got != 0 {
+		t.Errorf("%d history entries for a typed token", got)
+	}
+	if got := secretCopyVerb(); got != "Typed" {
+		t.Errorf("status verb = %q", got)
+	}
+}
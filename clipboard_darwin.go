@@ -18,6 +18,13 @@ void copyToClipboardNative(const char *text) {
     [pasteboard setString:str forType:NSPasteboardTypeString];
 }
 
+// readClipboardNative returns a copy of the pasteboard's text, or NULL; the caller frees it
+char *readClipboardNative(void) {
+    NSString *str = [[NSPasteboard generalPasteboard] stringForType:NSPasteboardTypeString];
+    if (str == nil) return NULL;
+    return strdup([str UTF8String]);
+}
+
 // simulatePaste simulates Cmd+V keystroke to paste from clipboard
 void simulatePaste(void) {
     CGEventSourceRef source = CGEventSourceCreate(kCGEventSourceStateHIDSystemState);
@@ -47,9 +54,51 @@ void simulatePaste(void) {
 
     CFRelease(source);
 }
+
+// frontWindowNumber returns the number of the frontmost normal window, or 0. The window
+// list runs front to back, and numbers (unlike titles) need no screen recording access.
+long frontWindowNumber(void) {
+    CFArrayRef windows = CGWindowListCopyWindowInfo(
+        kCGWindowListOptionOnScreenOnly | kCGWindowListExcludeDesktopElements, kCGNullWindowID);
+    if (windows == NULL) return 0;
+    long number = 0;
+    for (CFIndex i = 0; i < CFArrayGetCount(windows); i++) {
+        NSDictionary *info = (NSDictionary *)CFArrayGetValueAtIndex(windows, i);
+        if ([info[(id)kCGWindowLayer] intValue] == 0) {
+            number = [info[(id)kCGWindowNumber] longValue];
+            break;
+        }
+    }
+    CFRelease(windows);
+    return number;
+}
+
+// typeUnicodeChar types one character (given as UTF-16 code units) as a key down/up pair
+void typeUnicodeChar(const UniChar *chars, int count, useconds_t delay) {
+    CGEventSourceRef source = CGEventSourceCreate(kCGEventSourceStateHIDSystemState);
+    if (source == NULL) return;
+
+    CGEventRef down = CGEventCreateKeyboardEvent(source, 0, true);
+    CGEventKeyboardSetUnicodeString(down, count, chars);
+    CGEventPost(kCGHIDEventTap, down);
+    CFRelease(down);
+
+    CGEventRef up = CGEventCreateKeyboardEvent(source, 0, false);
+    CGEventKeyboardSetUnicodeString(up, count, chars);
+    CGEventPost(kCGHIDEventTap, up);
+    CFRelease(up);
+
+    CFRelease(source);
+    if (delay > 0) usleep(delay);
+}
 */
 import "C"
-import "unsafe"
+import (
+	"fmt"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
 
 func copyToClipboardPlatform(text string) error {
 	cstr := C.CString(text)
@@ -58,7 +107,42 @@ func copyToClipboardPlatform(text string) error {
 	return nil
 }
 
+// readClipboardPlatform returns the text on the pasteboard
+func readClipboardPlatform() (string, error) {
+	cstr := C.readClipboardNative()
+	if cstr == nil {
+		return "", fmt.Errorf("no text on the clipboard")
+	}
+	defer C.free(unsafe.Pointer(cstr))
+	return C.GoString(cstr), nil
+}
+
 // pasteFromClipboard simulates Cmd+V to paste the current clipboard contents
 func pasteFromClipboard() {
 	C.simulatePaste()
 }
+
+// typeTextPlatform types text into the focused window using Unicode keyboard events
+func typeTextPlatform(text string, charDelay time.Duration) error {
+	for _, r := range text {
+		units := utf16.Encode([]rune{r})
+		chars := make([]C.UniChar, len(units))
+		for i, u := range units {
+			chars[i] = C.UniChar(u)
+		}
+		C.typeUnicodeChar(&chars[0], C.int(len(chars)), C.useconds_t(charDelay/time.Microsecond))
+		for i := range chars {
+			chars[i] = 0
+		}
+	}
+	return nil
+}
+
+// focusedWindowPlatform returns the number of the frontmost window
+func focusedWindowPlatform() (uint64, error) {
+	number := uint64(C.frontWindowNumber())
+	if number == 0 {
+		return 0, fmt.Errorf("no frontmost window")
+	}
+	return number, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClipboardHistoryEntry represents a value previously copied by the app
+type ClipboardHistoryEntry struct {
+	Label    string    // What was copied (e.g. "snippet: API Key"), never the value itself
+	CopiedAt time.Time // When the value was copied
+	Size     int       // Length of the plaintext value in bytes
+	Secret   bool      // A token or secret; restoring it asks first when confirm_copy is set
+
+	value []byte // Plaintext value, or ciphertext when encryption is enabled
+}
+
+// ClipboardHistory keeps a bounded, in-memory list of copied values (newest first)
+type ClipboardHistory struct {
+	mu      sync.Mutex
+	entries []ClipboardHistoryEntry
+	maxSize int
+	aead    cipher.AEAD // Non-nil when values are encrypted at rest in memory
+}
+
+var clipboardHistory = NewClipboardHistory(DefaultClipboardConfig())
+
+// NewClipboardHistory creates a clipboard history from the given configuration
+func NewClipboardHistory(cfg ClipboardConfig) *ClipboardHistory {
+	h := &ClipboardHistory{}
+	h.Configure(cfg)
+	return h
+}
+
+// GetClipboardHistory returns the application clipboard history
+func GetClipboardHistory() *ClipboardHistory {
+	return clipboardHistory
+}
+
+// Configure applies size and encryption settings, discarding entries that no longer fit.
+// Toggling encryption clears the history since existing values can't be converted safely.
+func (h *ClipboardHistory) Configure(cfg ClipboardConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.maxSize = cfg.HistorySize
+	if cfg.DisableHistory {
+		h.maxSize = 0
+	}
+
+	encrypted := h.aead != nil
+	if cfg.EncryptHistory != encrypted {
+		h.clearLocked()
+		h.aead = nil
+		if cfg.EncryptHistory {
+			aead, err := newSessionCipher()
+			if err != nil {
+				LogError("Failed to initialize clipboard history encryption, history disabled: %v", err)
+				h.maxSize = 0
+			} else {
+				h.aead = aead
+			}
+		}
+	}
+
+	if len(h.entries) > h.maxSize {
+		for i := h.maxSize; i < len(h.entries); i++ {
+			zeroBytes(h.entries[i].value)
+		}
+		h.entries = h.entries[:h.maxSize]
+	}
+}
+
+// Add records a copied value under the given label; secret marks tokens and secrets
+func (h *ClipboardHistory) Add(label string, value string, secret bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.maxSize <= 0 {
+		return
+	}
+
+	stored, err := h.seal([]byte(value))
+	if err != nil {
+		LogError("Failed to store clipboard history entry: %v", err)
+		return
+	}
+
+	entry := ClipboardHistoryEntry{
+		Label:    label,
+		CopiedAt: time.Now(),
+		Size:     len(value),
+		Secret:   secret,
+		value:    stored,
+	}
+
+	h.entries = append([]ClipboardHistoryEntry{entry}, h.entries...)
+	if len(h.entries) > h.maxSize {
+		zeroBytes(h.entries[h.maxSize].value)
+		h.entries = h.entries[:h.maxSize]
+	}
+}
+
+// List returns the history entries, newest first
+func (h *ClipboardHistory) List() []ClipboardHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]ClipboardHistoryEntry, len(h.entries))
+	for i, e := range h.entries {
+		entries[i] = ClipboardHistoryEntry{Label: e.Label, CopiedAt: e.CopiedAt, Size: e.Size, Secret: e.Secret}
+	}
+	return entries
+}
+
+// Value returns the plaintext value of the entry at index (0 = newest)
+func (h *ClipboardHistory) Value(index int) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if index < 0 || index >= len(h.entries) {
+		return "", fmt.Errorf("history entry %d not found", index)
+	}
+
+	plain, err := h.open(h.entries[index].value)
+	if err != nil {
+		return "", err
+	}
+	value := string(plain)
+	if h.aead != nil {
+		zeroBytes(plain)
+	}
+	return value, nil
+}
+
+// Len returns the number of entries in the history
+func (h *ClipboardHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// Clear removes all history entries
+func (h *ClipboardHistory) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clearLocked()
+}
+
+func (h *ClipboardHistory) clearLocked() {
+	for i := range h.entries {
+		zeroBytes(h.entries[i].value)
+	}
+	h.entries = nil
+}
+
+// seal encrypts a value when encryption is enabled, otherwise returns a copy
+func (h *ClipboardHistory) seal(plain []byte) ([]byte, error) {
+	if h.aead == nil {
+		return plain, nil
+	}
+	nonce := make([]byte, h.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := h.aead.Seal(nonce, nonce, plain, nil)
+	zeroBytes(plain)
+	return sealed, nil
+}
+
+// open decrypts a stored value when encryption is enabled
+func (h *ClipboardHistory) open(stored []byte) ([]byte, error) {
+	if h.aead == nil {
+		return stored, nil
+	}
+	nonceSize := h.aead.NonceSize()
+	if len(stored) < nonceSize {
+		return nil, fmt.Errorf("corrupt history entry")
+	}
+	return h.aead.Open(nil, stored[:nonceSize], stored[nonceSize:], nil)
+}
+
+// newSessionCipher creates an AES-256-GCM cipher with a random key that lives only in this process
+func newSessionCipher() (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	defer zeroBytes(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// zeroBytes overwrites a byte slice with zeros
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -10,6 +10,7 @@ package main
 #include <X11/Xatom.h>
 #include <X11/extensions/XTest.h>
 #include <X11/keysym.h>
+#include <X11/XKBlib.h>
 #include <stdlib.h>
 #include <string.h>
 #include <unistd.h>
@@ -21,9 +22,18 @@ static size_t clipboard_len = 0;
 static Display* clip_display = NULL;
 static Window clip_window = 0;
 static Atom clipboard_atom;
+static Atom primary_atom;
 static Atom targets_atom;
 static Atom utf8_atom;
 static Atom text_atom;
+static Atom incr_atom;
+
+// Transfer in chunks (the ICCCM INCR protocol) in progress, if incr_requestor is set.
+// Values larger than a single X request are sent this way; one transfer runs at a time.
+static Window incr_requestor = 0;
+static Atom incr_property;
+static Atom incr_target;
+static size_t incr_offset = 0;
 
 // Initialize clipboard support
 int init_clipboard() {
@@ -33,9 +43,11 @@ int init_clipboard() {
     if (clip_display == NULL) return 0;
 
     clipboard_atom = XInternAtom(clip_display, "CLIPBOARD", False);
+    primary_atom = XA_PRIMARY;
     targets_atom = XInternAtom(clip_display, "TARGETS", False);
     utf8_atom = XInternAtom(clip_display, "UTF8_STRING", False);
     text_atom = XInternAtom(clip_display, "TEXT", False);
+    incr_atom = XInternAtom(clip_display, "INCR", False);
 
     // Create a hidden window for clipboard ownership
     clip_window = XCreateSimpleWindow(clip_display,
@@ -45,10 +57,13 @@ int init_clipboard() {
     return 1;
 }
 
-// Set clipboard content
-int set_clipboard(const char* text, size_t len) {
+// Set clipboard content, optionally also claiming the PRIMARY selection
+int set_clipboard(const char* text, size_t len, int use_primary) {
     if (!init_clipboard()) return 0;
 
+    // Abandon a transfer of the old data
+    incr_requestor = 0;
+
     // Free old data
     if (clipboard_data != NULL) {
         free(clipboard_data);
@@ -63,6 +78,10 @@ int set_clipboard(const char* text, size_t len) {
 
     // Claim clipboard ownership
     XSetSelectionOwner(clip_display, clipboard_atom, clip_window, CurrentTime);
+    if (use_primary) {
+        // PRIMARY is served from the same buffer (middle-click paste)
+        XSetSelectionOwner(clip_display, primary_atom, clip_window, CurrentTime);
+    }
     XFlush(clip_display);
 
     // Check if we got ownership
@@ -73,6 +92,35 @@ int set_clipboard(const char* text, size_t len) {
     return 1;
 }
 
+// Size of the chunks values are sent in: what fits in a request, at most 256 KB
+static size_t incr_chunk_size() {
+    long max = XExtendedMaxRequestSize(clip_display);
+    if (max == 0) max = XMaxRequestSize(clip_display);
+    size_t size = (size_t)max * 4 - 100;
+    return size > 262144 ? 262144 : size;
+}
+
+// Send the next chunk once the requestor has deleted the previous one; a chunk of zero
+// length ends the transfer
+static void send_incr_chunk(XPropertyEvent* ev) {
+    if (incr_requestor == 0 || ev->window != incr_requestor ||
+        ev->atom != incr_property || ev->state != PropertyDelete) {
+        return;
+    }
+    size_t n = clipboard_len - incr_offset;
+    size_t chunk = incr_chunk_size();
+    if (n > chunk) n = chunk;
+    XChangeProperty(clip_display, incr_requestor, incr_property,
+        incr_target, 8, PropModeReplace,
+        (unsigned char*)clipboard_data + incr_offset, n);
+    incr_offset += n;
+    if (n == 0) {
+        XSelectInput(clip_display, incr_requestor, NoEventMask);
+        incr_requestor = 0;
+    }
+    XFlush(clip_display);
+}
+
 // Handle clipboard selection requests (must be called periodically or in event loop)
 void handle_clipboard_events() {
     if (clip_display == NULL) return;
@@ -81,7 +129,9 @@ void handle_clipboard_events() {
     while (XPending(clip_display)) {
         XNextEvent(clip_display, &event);
 
-        if (event.type == SelectionRequest) {
+        if (event.type == PropertyNotify) {
+            send_incr_chunk(&event.xproperty);
+        } else if (event.type == SelectionRequest) {
             XSelectionRequestEvent* req = &event.xselectionrequest;
             XSelectionEvent response;
 
@@ -101,8 +151,22 @@ void handle_clipboard_events() {
                     (unsigned char*)targets, 4);
                 response.property = req->property;
             } else if (req->target == utf8_atom || req->target == XA_STRING || req->target == text_atom) {
-                // Return clipboard data
-                if (clipboard_data != NULL) {
+                // Return clipboard data, in chunks if it doesn't fit in one request
+                if (clipboard_data != NULL && clipboard_len > incr_chunk_size()) {
+                    if (incr_requestor != 0) {
+                        XSelectInput(clip_display, incr_requestor, NoEventMask);
+                    }
+                    long size = (long)clipboard_len;
+                    XSelectInput(clip_display, req->requestor, PropertyChangeMask);
+                    XChangeProperty(clip_display, req->requestor, req->property,
+                        incr_atom, 32, PropModeReplace,
+                        (unsigned char*)&size, 1);
+                    incr_requestor = req->requestor;
+                    incr_property = req->property;
+                    incr_target = req->target;
+                    incr_offset = 0;
+                    response.property = req->property;
+                } else if (clipboard_data != NULL) {
                     XChangeProperty(clip_display, req->requestor, req->property,
                         req->target, 8, PropModeReplace,
                         (unsigned char*)clipboard_data, clipboard_len);
@@ -141,6 +205,66 @@ void simulate_paste() {
     XCloseDisplay(dpy);
 }
 
+// Type a single Unicode code point via XTest
+// Returns 1 on success, 0 if no keycode is mapped for the character
+int type_codepoint(Display* dpy, unsigned int cp, unsigned int delay_us) {
+    KeySym sym;
+    if (cp == '\n') {
+        sym = XK_Return;
+    } else if (cp == '\t') {
+        sym = XK_Tab;
+    } else if (cp < 0x100) {
+        sym = cp;
+    } else {
+        sym = 0x01000000 | cp;
+    }
+
+    KeyCode code = XKeysymToKeycode(dpy, sym);
+    if (code == 0) return 0;
+
+    // Use Shift if the keysym lives at the shifted level of this key
+    int shift = XkbKeycodeToKeysym(dpy, code, 0, 0) != sym &&
+                XkbKeycodeToKeysym(dpy, code, 0, 1) == sym;
+    KeyCode shift_code = XKeysymToKeycode(dpy, XK_Shift_L);
+
+    if (shift) XTestFakeKeyEvent(dpy, shift_code, True, 0);
+    XTestFakeKeyEvent(dpy, code, True, 0);
+    XTestFakeKeyEvent(dpy, code, False, 0);
+    if (shift) XTestFakeKeyEvent(dpy, shift_code, False, 0);
+    XFlush(dpy);
+
+    if (delay_us > 0) usleep(delay_us);
+    return 1;
+}
+
+// Type a string of code points; returns the index of the first untypeable one, or -1
+int type_codepoints(const unsigned int* cps, int count, unsigned int delay_us) {
+    Display* dpy = XOpenDisplay(NULL);
+    if (dpy == NULL) return -2;
+
+    int failed = -1;
+    for (int i = 0; i < count; i++) {
+        if (!type_codepoint(dpy, cps[i], delay_us)) {
+            failed = i;
+            break;
+        }
+    }
+
+    XCloseDisplay(dpy);
+    return failed;
+}
+
+// Return the window with the input focus, or 0 if there is no display
+unsigned long focused_window() {
+    Display* dpy = XOpenDisplay(NULL);
+    if (dpy == NULL) return 0;
+    Window w;
+    int revert;
+    XGetInputFocus(dpy, &w, &revert);
+    XCloseDisplay(dpy);
+    return w;
+}
+
 // Cleanup
 void cleanup_clipboard() {
     if (clipboard_data != NULL) {
@@ -160,6 +284,8 @@ import "C"
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
 	"sync"
 	"time"
 	"unsafe"
@@ -206,7 +332,12 @@ func copyToClipboardPlatform(text string) error {
 	cstr := C.CString(text)
 	defer C.free(unsafe.Pointer(cstr))
 
-	ret := C.set_clipboard(cstr, C.size_t(len(text)))
+	usePrimary := C.int(0)
+	if clipboardOptions.PrimarySelection {
+		usePrimary = 1
+	}
+
+	ret := C.set_clipboard(cstr, C.size_t(len(text)), usePrimary)
 	if ret == 0 {
 		return fmt.Errorf("failed to set clipboard")
 	}
@@ -214,7 +345,70 @@ func copyToClipboardPlatform(text string) error {
 	return nil
 }
 
+// clipboardReaders are the tools tried, in order, to read the clipboard. Reading means
+// answering X11 selection requests of another owner, which is left to them.
+var clipboardReaders = [][]string{
+	{"wl-paste", "--no-newline"},
+	{"xclip", "-o", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--output"},
+}
+
+// readClipboardPlatform returns the text on the clipboard, read with wl-paste, xclip or xsel
+func readClipboardPlatform() (string, error) {
+	for _, reader := range clipboardReaders {
+		if reader[0] == "wl-paste" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		path, err := exec.LookPath(reader[0])
+		if err != nil {
+			continue
+		}
+		output, err := exec.Command(path, reader[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", reader[0], err)
+		}
+		return string(output), nil
+	}
+	return "", fmt.Errorf("no clipboard tool found (install xclip, xsel or wl-clipboard)")
+}
+
 // pasteFromClipboard simulates Ctrl+V to paste the current clipboard contents
 func pasteFromClipboard() {
 	C.simulate_paste()
 }
+
+// typeTextPlatform types text into the focused window using XTest key events
+func typeTextPlatform(text string, charDelay time.Duration) error {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil
+	}
+
+	cps := make([]C.uint, len(runes))
+	for i, r := range runes {
+		cps[i] = C.uint(r)
+	}
+	defer func() {
+		for i := range cps {
+			cps[i] = 0
+		}
+	}()
+
+	ret := C.type_codepoints(&cps[0], C.int(len(cps)), C.uint(charDelay/time.Microsecond))
+	switch {
+	case ret == -2:
+		return fmt.Errorf("failed to open X display")
+	case ret >= 0:
+		return fmt.Errorf("cannot type character at position %d (no key mapped)", int(ret))
+	}
+	return nil
+}
+
+// focusedWindowPlatform returns the X window with the input focus
+func focusedWindowPlatform() (uint64, error) {
+	w := uint64(C.focused_window())
+	if w == 0 {
+		return 0, fmt.Errorf("failed to open X display")
+	}
+	return w, nil
+}
@@ -3,13 +3,31 @@
 
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 func copyToClipboardPlatform(text string) error {
 	return fmt.Errorf("clipboard not supported on this platform")
 }
 
+// readClipboardPlatform is not implemented on this platform
+func readClipboardPlatform() (string, error) {
+	return "", fmt.Errorf("clipboard not supported on this platform")
+}
+
 // pasteFromClipboard is not implemented on this platform
 func pasteFromClipboard() {
 	// Not implemented
 }
+
+// typeTextPlatform is not implemented on this platform
+func typeTextPlatform(text string, charDelay time.Duration) error {
+	return fmt.Errorf("typing not supported on this platform")
+}
+
+// focusedWindowPlatform is not implemented on this platform
+func focusedWindowPlatform() (uint64, error) {
+	return 0, fmt.Errorf("typing not supported on this platform")
+}
@@ -4,28 +4,37 @@
 package main
 
 import (
+	"fmt"
 	"syscall"
 	"time"
 	"unsafe"
+
+	"golang.org/x/sys/windows"
 )
 
 var (
-	user32   = syscall.NewLazyDLL("user32.dll")
-	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+	user32   = windows.NewLazySystemDLL("user32.dll")
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
 
 	// Clipboard functions
 	openClipboard    = user32.NewProc("OpenClipboard")
 	closeClipboard   = user32.NewProc("CloseClipboard")
 	emptyClipboard   = user32.NewProc("EmptyClipboard")
 	setClipboardData = user32.NewProc("SetClipboardData")
+	getClipboardData = user32.NewProc("GetClipboardData")
 
 	// Memory functions
 	globalAlloc  = kernel32.NewProc("GlobalAlloc")
 	globalLock   = kernel32.NewProc("GlobalLock")
 	globalUnlock = kernel32.NewProc("GlobalUnlock")
+	globalSize   = kernel32.NewProc("GlobalSize")
+
+	// Copies between Go memory and a locked block, whose address is only a uintptr
+	rtlMoveMemory = kernel32.NewProc("RtlMoveMemory")
 
 	// Input simulation
-	sendInput = user32.NewProc("SendInput")
+	sendInput           = user32.NewProc("SendInput")
+	getForegroundWindow = user32.NewProc("GetForegroundWindow")
 )
 
 const (
@@ -35,8 +44,9 @@ const (
 
 // INPUT structure for SendInput
 const (
-	inputKeyboard  = 1
-	keyEventFKeyUp = 0x0002
+	inputKeyboard    = 1
+	keyEventFKeyUp   = 0x0002
+	keyEventFUnicode = 0x0004
 )
 
 type keyboardInput struct {
@@ -54,6 +64,7 @@ type input struct {
 }
 
 const (
+	vkReturn  = 0x0D
 	vkControl = 0x11
 	vkV       = 0x56
 )
@@ -89,8 +100,7 @@ func copyToClipboardPlatform(text string) error {
 	}
 
 	// Copy UTF-16 data
-	dst := unsafe.Slice((*uint16)(unsafe.Pointer(ptr)), len(utf16))
-	copy(dst, utf16)
+	rtlMoveMemory.Call(ptr, uintptr(unsafe.Pointer(&utf16[0])), uintptr(size))
 
 	globalUnlock.Call(hMem)
 
@@ -103,6 +113,34 @@ func copyToClipboardPlatform(text string) error {
 	return nil
 }
 
+// readClipboardPlatform returns the text on the clipboard
+func readClipboardPlatform() (string, error) {
+	ret, _, _ := openClipboard.Call(0)
+	if ret == 0 {
+		return "", syscall.GetLastError()
+	}
+	defer closeClipboard.Call()
+
+	hMem, _, _ := getClipboardData.Call(cfUnicodeText)
+	if hMem == 0 {
+		return "", fmt.Errorf("no text on the clipboard")
+	}
+	size, _, _ := globalSize.Call(hMem)
+	ptr, _, _ := globalLock.Call(hMem)
+	if ptr == 0 {
+		return "", syscall.GetLastError()
+	}
+	defer globalUnlock.Call(hMem)
+
+	// The text ends at its NUL, which may come before the end of the block
+	text := make([]uint16, size/2)
+	if len(text) == 0 {
+		return "", nil
+	}
+	rtlMoveMemory.Call(uintptr(unsafe.Pointer(&text[0])), ptr, uintptr(len(text)*2))
+	return syscall.UTF16ToString(text), nil
+}
+
 // pasteFromClipboard simulates Ctrl+V to paste the current clipboard contents
 func pasteFromClipboard() {
 	// Small delay to ensure clipboard is ready
@@ -151,3 +189,56 @@ func pasteFromClipboard() {
 		uintptr(unsafe.Sizeof(inputs[0])),
 	)
 }
+
+// typeTextPlatform types text into the focused window using Unicode SendInput events
+func typeTextPlatform(text string, charDelay time.Duration) error {
+	units, err := syscall.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for i := range units {
+			units[i] = 0
+		}
+	}()
+
+	// Drop the trailing NUL added by UTF16FromString
+	units = units[:len(units)-1]
+	for i, unit := range units {
+		inputs := []input{
+			{inputType: inputKeyboard, ki: keyboardInput{wScan: unit, dwFlags: keyEventFUnicode}},
+			{inputType: inputKeyboard, ki: keyboardInput{wScan: unit, dwFlags: keyEventFUnicode | keyEventFKeyUp}},
+		}
+		// A Unicode line feed isn't Enter to consoles, so line breaks press the Return key
+		if unit == '\r' && i+1 < len(units) && units[i+1] == '\n' {
+			continue
+		}
+		if unit == '\r' || unit == '\n' {
+			inputs = []input{
+				{inputType: inputKeyboard, ki: keyboardInput{wVk: vkReturn}},
+				{inputType: inputKeyboard, ki: keyboardInput{wVk: vkReturn, dwFlags: keyEventFKeyUp}},
+			}
+		}
+		ret, _, callErr := sendInput.Call(
+			uintptr(len(inputs)),
+			uintptr(unsafe.Pointer(&inputs[0])),
+			uintptr(unsafe.Sizeof(inputs[0])),
+		)
+		if ret == 0 {
+			return fmt.Errorf("SendInput failed: %v", callErr)
+		}
+		if charDelay > 0 {
+			time.Sleep(charDelay)
+		}
+	}
+	return nil
+}
+
+// focusedWindowPlatform returns the handle of the foreground window
+func focusedWindowPlatform() (uint64, error) {
+	hwnd, _, _ := getForegroundWindow.Call()
+	if hwnd == 0 {
+		return 0, fmt.Errorf("no foreground window")
+	}
+	return uint64(hwnd), nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getlantern/systray"
+)
+
+var (
+	mCommandsMenu  *systray.MenuItem
+	commandMenu    *menuList
+	commandEntries []CommandEntry
+)
+
+// errCommandCancelled is returned when a param prompt or the confirmation was cancelled
+var errCommandCancelled = errors.New("command cancelled")
+
+// findCommandEntry returns the command called name (case-insensitive)
+func findCommandEntry(cfg *Config, name string) (CommandEntry, bool) {
+	if cfg == nil {
+		return CommandEntry{}, false
+	}
+	for _, entry := range cfg.Commands {
+		if strings.EqualFold(entry.Name, name) {
+			return entry, true
+		}
+	}
+	return CommandEntry{}, false
+}
+
+// loadAndBuildCommandsMenu fills the Commands menu
+func loadAndBuildCommandsMenu() {
+	commandMenu = newMenuList(mCommandsMenu, handleCommandClick, nil)
+
+	updateCommandsMenu()
+}
+
+// updateCommandsMenu lists the configured commands
+func updateCommandsMenu() {
+	if commandMenu == nil {
+		return
+	}
+
+	cfg := currentConfig()
+	var entries []CommandEntry
+	if cfg != nil {
+		entries = cfg.Commands
+	}
+	stateMutex.Lock()
+	commandEntries = entries
+	stateMutex.Unlock()
+
+	if len(entries) == 0 {
+		commandMenu.ShowPlaceholder("No commands configured", "Edit config file to add commands")
+		return
+	}
+	commandMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		entry := entries[i]
+		title := entry.Name
+		if len(entry.Params) > 0 {
+			title += "…"
+		}
+		item.SetTitle(title)
+		item.SetTooltip(fmt.Sprintf("Run %s", entry.Script))
+	})
+}
+
+func handleCommandClick(index int) {
+	stateMutex.RLock()
+	var entry CommandEntry
+	if index < len(commandEntries) {
+		entry = commandEntries[index]
+	}
+	stateMutex.RUnlock()
+	if entry.Script == "" {
+		return
+	}
+
+	status, err := runCommand(entry, map[string]string{}, requesterMenu)
+	switch {
+	case errors.Is(err, errCommandCancelled):
+		setStatus(fmt.Sprintf("Cancelled: %s", entry.Name))
+	case err != nil:
+		LogError("Command %s failed: %v", entry.Name, err)
+		setStatusError(fmt.Sprintf("Script error: %s", truncateError(err)))
+	default:
+		setStatus(status)
+	}
+}
+
+// runCommand asks for the params of entry that aren't in given, runs its script and copies
+// what it sets result to. It returns a status line.
+func runCommand(entry CommandEntry, given map[string]string, requester string) (string, error) {
+	engine := GetLuaEngine()
+
+	ctx := map[string]string{}
+	for k, v := range given {
+		ctx[k] = v
+	}
+	for _, p := range entry.Params {
+		if _, ok := ctx[p.Name]; ok {
+			continue
+		}
+		value, ok := askCommandParam(entry, p)
+		if !ok {
+			return "", errCommandCancelled
+		}
+		ctx[p.Name] = value
+	}
+	ctx["name"] = entry.Name
+
+	if entry.Confirm && !confirmEntry("Command", entry.Name, confirmCommandPreview(entry, ctx)) {
+		return "", errCommandCancelled
+	}
+
+	result, err := engine.RunScript(entry.Script, ctx)
+	LogScriptExecuted(entry.Script, "command", err)
+	if err != nil {
+		return "", err
+	}
+	updateCacheMenu()
+	if result == "" {
+		return fmt.Sprintf("Ran: %s", entry.Name), nil
+	}
+	copied, err := copyOutputToClipboard("command: "+entry.Name, result, requester)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy the result: %w", err)
+	}
+	if !copied {
+		return fmt.Sprintf("Ran: %s (result not copied)", entry.Name), nil
+	}
+	LogClipboardCopy("command", entry.Name)
+	return fmt.Sprintf("Copied: %s", entry.Name), nil
+}
+
+// askCommandParam asks for the value of p, picking one of its choices by number if it has
+// them. It reports false if the dialog was cancelled.
+func askCommandParam(entry CommandEntry, p CommandParam) (string, bool) {
+	title := fmt.Sprintf("Run %s", entry.Name)
+	prompt := p.Prompt
+	if prompt == "" {
+		prompt = p.Name
+	}
+	if len(p.Choices) > 0 {
+		items := make([]quickPickItem, len(p.Choices))
+		for i, choice := range p.Choices {
+			items[i] = quickPickItem{Index: i + 1, Name: choice}
+		}
+		i, ok := pickEntry(fmt.Sprintf("%s: %s", title, prompt), items)
+		if !ok {
+			return "", false
+		}
+		return p.Choices[i], true
+	}
+	return PromptForInput(title, prompt+":", p.Default, p.Secret)
+}
+
+// confirmCommandPreview describes running entry's script with the values in ctx; secret
+// ones are not shown
+func confirmCommandPreview(entry CommandEntry, ctx map[string]string) string {
+	if len(entry.Params) == 0 {
+		return confirmScriptPreview(entry.Script, "", "")
+	}
+	lines := make([]string, len(entry.Params))
+	for i, p := range entry.Params {
+		value := ctx[p.Name]
+		if p.Secret {
+			value = "(hidden)"
+		}
+		lines[i] = fmt.Sprintf("%s = %s", p.Name, value)
+	}
+	return confirmScriptPreview(entry.Script, "the values", strings.Join(lines, "\n"))
+}
+
+// ctlCommand runs a command like its menu item. Params given as key=value aren't asked for.
+func ctlCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: command <name> [param=value...]")
+	}
+	entry, ok := findCommandEntry(currentConfig(), args[0])
+	if !ok {
+		return "", fmt.Errorf("no command named %q", args[0])
+	}
+	given, err := scriptContextFromArgs(entry.Name, args[1:])
+	if err != nil {
+		return "", err
+	}
+	delete(given, "name")
+	return runCommand(entry, given, requesterCtl)
+}
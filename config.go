@@ -2,17 +2,33 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"krb5tray/internal/cache"
+	"krb5tray/pkg/krb"
 )
 
 // LogConfig represents logging configuration
 type LogConfig struct {
-	MaxSizeMB  int  `json:"max_size_mb,omitempty"`  // Max log file size in MB before rotation (default: 10)
-	MaxBackups int  `json:"max_backups,omitempty"`  // Max number of old log files to keep (default: 7)
-	MaxAgeDays int  `json:"max_age_days,omitempty"` // Max days to retain old log files (default: 7)
-	Compress   bool `json:"compress,omitempty"`     // Compress rotated log files (default: true)
-	ToStdout   bool `json:"to_stdout,omitempty"`    // Also write logs to stdout (default: true)
+	MaxSizeMB  int    `json:"max_size_mb,omitempty"`  // Max log file size in MB before rotation (default: 10)
+	MaxBackups int    `json:"max_backups,omitempty"`  // Max number of old log files to keep (default: 7)
+	MaxAgeDays int    `json:"max_age_days,omitempty"` // Max days to retain old log files (default: 7)
+	Compress   bool   `json:"compress,omitempty"`     // Compress rotated log files (default: true)
+	ToStdout   bool   `json:"to_stdout,omitempty"`    // Also write logs to stdout (default: true)
+	Level      string `json:"level,omitempty"`        // Log level: "error", "warn", "info", "debug", or "trace" (default: "info")
+	Syslog     bool   `json:"syslog,omitempty"`       // Also send logs to the local syslog daemon (Linux/macOS)
+	EventLog   bool   `json:"event_log,omitempty"`    // Also send logs to the Windows Event Log (Application log)
+	ViewLines  int    `json:"view_lines,omitempty"`   // Number of lines shown by View Log (default: 500)
+
+	OTLPEndpoint string            `json:"otlp_endpoint,omitempty"` // OTLP/HTTP collector base URL for tracing, e.g. http://localhost:4318 (default: disabled)
+	OTLPHeaders  map[string]string `json:"otlp_headers,omitempty"`  // Extra headers sent to the collector (e.g. authentication)
 }
 
 // DefaultLogConfig returns the default logging configuration
@@ -23,17 +39,317 @@ func DefaultLogConfig() LogConfig {
 		MaxAgeDays: 7,
 		Compress:   true,
 		ToStdout:   true,
+		Level:      "info",
+		ViewLines:  DefaultLogViewLines,
 	}
 }
 
+// ClipboardConfig represents clipboard behavior configuration
+type ClipboardConfig struct {
+	HistorySize      int  `json:"history_size,omitempty"`      // Number of copied values to remember (default: 10)
+	DisableHistory   bool `json:"disable_history,omitempty"`   // Do not keep a clipboard history at all
+	EncryptHistory   bool `json:"encrypt_history,omitempty"`   // Encrypt history values in memory with a per-session key
+	PrimarySelection bool `json:"primary_selection,omitempty"` // Linux: also set the X11 PRIMARY selection (middle-click paste)
+	TypeOut          bool `json:"type_out,omitempty"`          // Type snippet values as keystrokes instead of using the clipboard
+	TypeOutSecrets   bool `json:"type_out_secrets,omitempty"`  // Type tokens and secrets as keystrokes instead of using the clipboard
+	TypeDelayMs      int  `json:"type_delay_ms,omitempty"`     // Delay between typed characters in milliseconds (default: 5)
+	ConfirmCopy      bool `json:"confirm_copy,omitempty"`      // Ask before a token or secret is copied to the clipboard
+
+	MaxSizeKB int    `json:"max_size_kb,omitempty"` // Largest value copied as is, in KB (default: 1024, -1 = unlimited)
+	Oversize  string `json:"oversize,omitempty"`    // What larger values become: "truncate" (default) or "file", a temporary file whose path is copied
+}
+
+// DefaultClipboardConfig returns the default clipboard configuration
+func DefaultClipboardConfig() ClipboardConfig {
+	return ClipboardConfig{
+		HistorySize: 10,
+		TypeDelayMs: 5,
+		MaxSizeKB:   DefaultClipboardMaxSizeKB,
+		Oversize:    clipboardOversizeTruncate,
+	}
+}
+
+// CacheConfig represents cache behavior configuration
+type CacheConfig struct {
+	Persist    bool `json:"persist,omitempty"`     // Persist JWTs, secrets, and custom entries to an encrypted file (default: false)
+	MaxEntries int  `json:"max_entries,omitempty"` // Maximum number of cached entries before LRU eviction (default: 500, -1 = unlimited)
+	MaxSizeKB  int  `json:"max_size_kb,omitempty"` // Maximum total size of cached values in KB (default: 4096, -1 = unlimited)
+
+	// How long entries are cached for when whatever stores them doesn't say
+	TokenTTLSec  int `json:"token_ttl_sec,omitempty"`  // Kerberos tokens (default: 600); spns entries can override it
+	JWTTTLSec    int `json:"jwt_ttl_sec,omitempty"`    // JWTs without an exp claim (default: 300)
+	SecretTTLSec int `json:"secret_ttl_sec,omitempty"` // secret: entries set by scripts (default: 1800)
+
+	// KeepCred saves the Kerberos credential in the Keychain on exit and restores it on the
+	// next start (macOS native transport only)
+	KeepCred bool `json:"persist_credential,omitempty"`
+}
+
+// APIConfig represents the localhost REST API configuration
+type APIConfig struct {
+	Enabled bool `json:"enabled,omitempty"` // Serve the REST API on 127.0.0.1 (default: false)
+	Port    int  `json:"port,omitempty"`    // Port to listen on (default: 47800)
+}
+
+// ProxyConfig represents the SPNEGO-injecting forward proxy configuration
+type ProxyConfig struct {
+	Enabled bool             `json:"enabled,omitempty"` // Serve the proxy on 127.0.0.1 (default: false)
+	Port    int              `json:"port,omitempty"`    // Port to listen on (default: 47801)
+	Hosts   []ProxyHostEntry `json:"hosts,omitempty"`   // Hosts that get a Negotiate header, first match wins
+}
+
+// ProxyHostEntry maps a target host to the SPN used for it
+type ProxyHostEntry struct {
+	Host string `json:"host"`          // Host name, or "*.example.com" for any subdomain
+	SPN  string `json:"spn,omitempty"` // SPN name from "spns" or a literal SPN, "{host}" is replaced (default: "HTTP/{host}")
+}
+
+// SPNMapRule maps the hosts matching a glob to the SPN used for them
+type SPNMapRule struct {
+	Host string `json:"host"`          // Host name or glob, e.g. "*.corp.example.com"
+	SPN  string `json:"spn,omitempty"` // SPN template, "{host}" is replaced; or an SPN name from "spns" (default: "HTTP/{host}")
+}
+
+// SSHProxyConfig represents the gateway used by "krb5tray ssh-proxy"
+type SSHProxyConfig struct {
+	Gateway string `json:"gateway,omitempty"` // HTTP CONNECT gateway as host:port
+	SPN     string `json:"spn,omitempty"`     // SPN or config name for the gateway (default: "HTTP/<gateway host>")
+	TLS     bool   `json:"tls,omitempty"`     // Connect to the gateway over TLS (default: false)
+}
+
+// SSHImportConfig controls importing Host entries from an OpenSSH client config
+type SSHImportConfig struct {
+	Path     string `json:"path,omitempty"`      // ssh_config file to read (default: ~/.ssh/config)
+	AutoSync bool   `json:"auto_sync,omitempty"` // Add its hosts to the SSH menu on every load without saving them (default: false)
+	Mode     string `json:"mode,omitempty"`      // Mode for imported entries: "" runs "ssh <alias>", "builtin" uses the embedded client
+}
+
+// SSHProbeConfig controls background reachability checks of the SSH menu's hosts
+type SSHProbeConfig struct {
+	Enabled     bool `json:"enabled,omitempty"`      // Probe hosts with a TCP connect and mark menu entries (default: false)
+	IntervalSec int  `json:"interval_sec,omitempty"` // Seconds between probe rounds (default: 60)
+	TimeoutMs   int  `json:"timeout_ms,omitempty"`   // Connect timeout per host in milliseconds (default: 2000)
+}
+
+// PrefetchConfig controls background requests that keep the configured SPNs' tokens cached
+type PrefetchConfig struct {
+	Enabled     *bool `json:"enabled,omitempty"`      // Request tokens for all SPNs at startup and on an interval; false turns prefetch off for auto_refresh SPNs too (default: only auto_refresh SPNs)
+	IntervalSec int   `json:"interval_sec,omitempty"` // Seconds between rounds; keep it below the 600s token lifetime (default: 480)
+	Concurrency int   `json:"concurrency,omitempty"`  // Maximum tokens requested at once (default: 4)
+	JitterSec   int   `json:"jitter_sec,omitempty"`   // Random delay of up to this many seconds before each request (default: 30)
+}
+
+// IsEnabled reports whether prefetch runs; Enabled is always set once defaults are applied
+func (p PrefetchConfig) IsEnabled() bool {
+	return p.Enabled != nil && *p.Enabled
+}
+
+// KeytabConfig gets and renews the TGT with a keytab instead of kinit, for machines where
+// nobody is around to type a password
+type KeytabConfig struct {
+	Path           string `json:"path"`                       // Keytab file
+	Principal      string `json:"principal"`                  // Principal to get the TGT for: user@REALM, or user in krb5.conf's default_realm
+	RenewBeforeSec int    `json:"renew_before_sec,omitempty"` // Get a new TGT when the current one expires within this many seconds (default: 1800)
+}
+
+// LockConfig requires the user to authenticate before secrets are selected or copied
+type LockConfig struct {
+	Enabled   bool   `json:"enabled,omitempty"`   // Lock the Secrets menu and secret cache entries (default: false)
+	PINHash   string `json:"pin_hash,omitempty"`  // bcrypt hash of the PIN, as printed by "krb5tray hash-pin"
+	Biometric bool   `json:"biometric,omitempty"` // Use Touch ID (macOS) or Windows Hello when available, the PIN otherwise
+	IdleSec   int    `json:"idle_sec,omitempty"`  // Lock again after this many seconds without using a secret (default: 300)
+}
+
+// IdleLockConfig locks the tray after a period without user interaction
+type IdleLockConfig struct {
+	Enabled    bool `json:"enabled,omitempty"`     // Lock after idle_min minutes without a menu click or hotkey (default: false)
+	IdleMin    int  `json:"idle_min,omitempty"`    // Minutes without interaction before locking (default: 15)
+	RequirePIN bool `json:"require_pin,omitempty"` // Ask for the secrets_lock PIN or biometrics to unlock
+}
+
+// WakeCheckConfig controls checking the credentials and refreshing the current token after
+// the system wakes from sleep or the network changes
+type WakeCheckConfig struct {
+	Disabled bool `json:"disabled,omitempty"`  // Don't check after wake and network changes (default: false)
+	DelaySec int  `json:"delay_sec,omitempty"` // Seconds to let the network settle before checking (default: 5)
+}
+
+// OfflineConfig controls how the tray behaves while the KDC can't be reached
+type OfflineConfig struct {
+	Disabled bool `json:"disabled,omitempty"`  // Keep requesting tokens as usual when no KDC answers (default: false)
+	ProbeSec int  `json:"probe_sec,omitempty"` // Seconds between checks whether the KDC is back (default: 60)
+}
+
+// VPNConfig detects whether the VPN is connected, for the Status menu and the actions run
+// when it comes up. It counts as connected when every check that is set passes.
+type VPNConfig struct {
+	Interface   string `json:"interface,omitempty"`    // Name or name prefix of the VPN's interface, e.g. "utun", "tun", "wg" (it must be up with an address)
+	Network     string `json:"network,omitempty"`      // CIDR an interface address is in while connected, e.g. "10.8.0.0/16"
+	ProbeURL    string `json:"probe_url,omitempty"`    // URL that only answers through the VPN; any HTTP response counts
+	IntervalSec int    `json:"interval_sec,omitempty"` // Seconds between checks (default: 15)
+	RefreshTGT  bool   `json:"refresh_tgt,omitempty"`  // Renew the TGT when the VPN comes up (the LSA on Windows, kinit -R elsewhere)
+	OnConnect   string `json:"on_connect,omitempty"`   // Lua script to run when the VPN comes up
+}
+
+// HistoryConfig controls the local action history read by "krb5tray history"
+type HistoryConfig struct {
+	Disabled   bool `json:"disabled,omitempty"`     // Don't record actions (default: false)
+	MaxAgeDays int  `json:"max_age_days,omitempty"` // Days entries are kept, pruned at startup (default: 30)
+}
+
+// SigningConfig controls signature checks of scripts and config reloads
+type SigningConfig struct {
+	PublicKey     string `json:"public_key,omitempty"`     // minisign public key (the base64 line of minisign.pub)
+	RequireSigned bool   `json:"require_signed,omitempty"` // Refuse scripts and config reloads without a valid .minisig
+}
+
+// PolicyConfig holds settings that restrict what scripts and snippets may do
+type PolicyConfig struct {
+	AllowInsecureTLS *bool  `json:"allow_insecure_tls,omitempty"` // Allow requests that skip TLS certificate verification (default: true)
+	SnippetSecrets   string `json:"snippet_secrets,omitempty"`    // Snippets that look like raw credentials: "warn" (default), "block", or "off"
+}
+
+// NotifyConfig controls desktop notifications
+type NotifyConfig struct {
+	Disabled   bool `json:"disabled,omitempty"`           // Never show notifications, only update the status line
+	ExpiryWarn bool `json:"expiry_warning,omitempty"`     // Warn a minute before the selected SPN's token expires
+	JWTWarn    bool `json:"jwt_expiry_warning,omitempty"` // Warn a minute before a JWT in the JWTs menu expires
+}
+
+// BridgeConfig controls handing the newest copied value to a remote session
+type BridgeConfig struct {
+	TTLSec     int    `json:"ttl_sec,omitempty"`     // Seconds a one-time link or remote file lasts (default: 60)
+	Host       string `json:"host,omitempty"`        // SSH entry name or "[user@]host[:port]" to write the value to
+	RemotePath string `json:"remote_path,omitempty"` // File on the host, relative to its home directory (default: ".krb5tray-share")
+}
+
+// StatusConfig sets what the status line and the tray icon's tooltip show. Templates
+// use {name} variables such as {spn}, {token_age} and {tgt_expiry}.
+type StatusConfig struct {
+	Format  string `json:"format,omitempty"`  // Status line when no message is showing (default: the time of the current ticket)
+	Tooltip string `json:"tooltip,omitempty"` // Tray icon tooltip (default: the selected SPN's token countdown)
+
+	ExpiringMin int  `json:"expiring_min,omitempty"` // Minutes before the selected SPN's token expires that the countdown says it is expiring (default: 2)
+	AutoRefresh bool `json:"auto_refresh,omitempty"` // Request a new token for the selected SPN once its token is expiring
+}
+
+// HotkeyConfig controls the global hotkeys beyond the digit hotkeys
+type HotkeyConfig struct {
+	QuickPick bool `json:"quick_pick,omitempty"` // Modifiers+G shows a numbered list of the entries to pick from by typing an index (default: false)
+}
+
+// SecurityKeyConfig requires touching a FIDO2 security key before secrets are used or
+// tokens are exported. The credential is made by "krb5tray enroll-security-key".
+type SecurityKeyConfig struct {
+	Credential string   `json:"credential,omitempty"` // Base64 credential ID printed by enroll-security-key
+	PublicKey  string   `json:"public_key,omitempty"` // PEM ES256 public key printed by enroll-security-key
+	RPID       string   `json:"rp_id,omitempty"`      // Relying party ID the credential was made for (default: "krb5tray")
+	Device     string   `json:"device,omitempty"`     // Device path, as listed by "fido2-token -L" (default: the first one listed)
+	Require    []string `json:"require,omitempty"`    // Operations that need a touch: "secrets", "tokens" (default: both)
+	GraceSec   int      `json:"grace_sec,omitempty"`  // Seconds a touch covers further operations (default: 0, a touch every time)
+}
+
+// EnvExportConfig sets what Export Env and "krb5tray env" write when no variables are given
+type EnvExportConfig struct {
+	Vars   []EnvVar `json:"vars,omitempty"`    // Variables to export (default: AUTH_HEADER for the selected SPN)
+	TTLSec int      `json:"ttl_sec,omitempty"` // Seconds before the file written by Export Env is deleted (default: 300)
+}
+
+// Formats an SPN's token can be exported in
+const (
+	envFormatHeader = "header"
+	envFormatToken  = "token"
+)
+
+// EnvVar is an environment variable holding an SPN's token or a cached secret
+type EnvVar struct {
+	Name   string `json:"name"`             // Variable name (default: AUTH_HEADER, KRB5_TOKEN, or the secret's key in upper case)
+	SPN    string `json:"spn,omitempty"`    // SPN name from the spns list, or the SPN itself
+	Secret string `json:"secret,omitempty"` // Key of a cached secret, instead of an SPN
+	Format string `json:"format,omitempty"` // For SPNs: "header" (Negotiate <token>) or "token" (default: header)
+}
+
+// MenuSortConfig sets the order each menu lists its entries in: "config" (file order),
+// "index", "name", "group" (by group, then index) or "usage" (most used first). SPNs have
+// no index.
+type MenuSortConfig struct {
+	SPNs     string `json:"spns,omitempty"`     // Order of the SPN menu (default: "config", or "usage" with usage.sort_menus)
+	URLs     string `json:"urls,omitempty"`     // Order of the URLs menu (same default)
+	Snippets string `json:"snippets,omitempty"` // Order of the Snippets menu (same default)
+	SSH      string `json:"ssh,omitempty"`      // Order of the SSH menu (same default)
+}
+
+// UsageConfig controls counting how often SPN, URL, snippet and SSH entries are used
+type UsageConfig struct {
+	Disabled  bool `json:"disabled,omitempty"`   // Don't count uses
+	SortMenus bool `json:"sort_menus,omitempty"` // List the most used entries first in their menus (default: config order)
+}
+
+// LuaConfig controls how Lua scripts are run
+type LuaConfig struct {
+	DisablePool bool     `json:"disable_pool,omitempty"` // Run every script in a new Lua state instead of reusing pooled ones
+	Isolated    []string `json:"isolated,omitempty"`     // Scripts that always get a new Lua state
+
+	// Permissions lists the scripts allowed to run and the capabilities each one gets
+	// ("exec", "http", "clipboard", "secrets"); "*" applies to scripts not listed.
+	// When absent, every script may run with every capability.
+	Permissions map[string][]string `json:"permissions,omitempty"`
+}
+
 // Config represents the application configuration
 type Config struct {
-	SPNs     []SPNEntry     `json:"spns"`
-	Secrets  []SecretEntry  `json:"secrets,omitempty"`
-	URLs     []URLEntry     `json:"urls,omitempty"`
-	Snippets []SnippetEntry `json:"snippets,omitempty"`
-	SSH      []SSHEntry     `json:"ssh,omitempty"`
-	Logging  *LogConfig     `json:"logging,omitempty"`
+	Profile     string             `json:"profile,omitempty"` // Profile name used to namespace cached tokens and secrets (default: "default")
+	SPNs        []SPNEntry         `json:"spns"`
+	Secrets     []SecretEntry      `json:"secrets,omitempty"`
+	URLs        []URLEntry         `json:"urls,omitempty"`
+	Snippets    []SnippetEntry     `json:"snippets,omitempty"`
+	SSH         []SSHEntry         `json:"ssh,omitempty"`
+	Transfers   []TransferEntry    `json:"transfers,omitempty"`
+	Sessions    []SessionEntry     `json:"sessions,omitempty"`
+	TokenSets   []TokenSet         `json:"token_sets,omitempty"`
+	Commands    []CommandEntry     `json:"commands,omitempty"`
+	MenuSort    *MenuSortConfig    `json:"menu_sort,omitempty"`
+	Terminal    string             `json:"terminal,omitempty"`        // Terminal template for SSH entries without one (default: detected per platform)
+	Shell       string             `json:"shell,omitempty"`           // Shell whose snippet variants are copied: bash, zsh, powershell or cmd (default: from $SHELL, powershell on Windows)
+	SPNMap      []SPNMapRule       `json:"spn_map,omitempty"`         // Host globs to SPNs, for the proxy, "krb5tray curl", ktray.http_negotiate and the REST API; first match wins
+	Transport   string             `json:"transport,omitempty"`       // Ticket transport (default: "native"; "gokrb5" reads a file ccache on any platform)
+	CCache      string             `json:"ccache,omitempty"`          // Credential cache for the gokrb5 transport, or a GSSCred cache UUID on macOS (default: KRB5CCNAME, then the platform's usual file)
+	SSPIPackage string             `json:"sspi_package,omitempty"`    // SSPI package Windows makes tokens with: "negotiate" (default) or "kerberos", which never falls back to NTLM; spns entries can override it
+	KDCTimeout  int                `json:"kdc_timeout_sec,omitempty"` // Seconds to wait for the KDC before giving up on a ticket request (default: 30)
+	Keytab      *KeytabConfig      `json:"keytab,omitempty"`          // Get the TGT from a keytab into the ccache (gokrb5 transport)
+	Logging     *LogConfig         `json:"logging,omitempty"`
+	Clipboard   *ClipboardConfig   `json:"clipboard,omitempty"`
+	Cache       *CacheConfig       `json:"cache,omitempty"`
+	API         *APIConfig         `json:"api,omitempty"`
+	Proxy       *ProxyConfig       `json:"proxy,omitempty"`
+	SSHProxy    *SSHProxyConfig    `json:"ssh_proxy,omitempty"`
+	SSHImport   *SSHImportConfig   `json:"ssh_import,omitempty"`
+	SSHProbe    *SSHProbeConfig    `json:"ssh_probe,omitempty"`
+	Prefetch    *PrefetchConfig    `json:"token_prefetch,omitempty"`
+	Lua         *LuaConfig         `json:"lua,omitempty"`
+	Lock        *LockConfig        `json:"secrets_lock,omitempty"`
+	IdleLock    *IdleLockConfig    `json:"idle_lock,omitempty"`
+	Signing     *SigningConfig     `json:"signing,omitempty"`
+	Policy      *PolicyConfig      `json:"policy,omitempty"`
+	Notify      *NotifyConfig      `json:"notifications,omitempty"`
+	Hotkeys     *HotkeyConfig      `json:"hotkeys,omitempty"`
+	Status      *StatusConfig      `json:"status,omitempty"`
+	Bridge      *BridgeConfig      `json:"bridge,omitempty"`
+	Usage       *UsageConfig       `json:"usage,omitempty"`
+	EnvExport   *EnvExportConfig   `json:"env_export,omitempty"`
+	SecurityKey *SecurityKeyConfig `json:"security_key,omitempty"`
+	WakeCheck   *WakeCheckConfig   `json:"wake_check,omitempty"`
+	Offline     *OfflineConfig     `json:"offline,omitempty"`
+	VPN         *VPNConfig         `json:"vpn,omitempty"`
+	History     *HistoryConfig     `json:"history,omitempty"`
+}
+
+// GetProfile returns the configured profile name, or cache.DefaultProfile if unset
+func (c *Config) GetProfile() string {
+	if c == nil || c.Profile == "" {
+		return cache.DefaultProfile
+	}
+	return c.Profile
 }
 
 // GetLogConfig returns the logging config with defaults applied
@@ -55,6 +371,12 @@ func (c *Config) GetLogConfig() LogConfig {
 	if cfg.MaxAgeDays <= 0 {
 		cfg.MaxAgeDays = defaults.MaxAgeDays
 	}
+	if cfg.Level == "" {
+		cfg.Level = defaults.Level
+	}
+	if cfg.ViewLines <= 0 {
+		cfg.ViewLines = defaults.ViewLines
+	}
 	// Note: Compress and ToStdout use their zero value (false) if not set,
 	// but we want true as default. Handle this with a pointer or explicit check.
 	// For simplicity, if Logging section exists but these are false, we respect that.
@@ -81,37 +403,594 @@ func (c *Config) GetLogConfigWithDefaults() LogConfig {
 	if c.Logging.MaxAgeDays > 0 {
 		cfg.MaxAgeDays = c.Logging.MaxAgeDays
 	}
+	if c.Logging.Level != "" {
+		cfg.Level = c.Logging.Level
+	}
+	if c.Logging.ViewLines > 0 {
+		cfg.ViewLines = c.Logging.ViewLines
+	}
 	// For booleans, only override if the logging section exists
 	// This allows users to explicitly set false
 	cfg.Compress = c.Logging.Compress
 	cfg.ToStdout = c.Logging.ToStdout
+	cfg.Syslog = c.Logging.Syslog
+	cfg.EventLog = c.Logging.EventLog
+	cfg.OTLPEndpoint = c.Logging.OTLPEndpoint
+	cfg.OTLPHeaders = c.Logging.OTLPHeaders
+
+	return cfg
+}
+
+// GetAPIConfigWithDefaults returns the REST API config, using defaults for absent values
+func (c *Config) GetAPIConfigWithDefaults() APIConfig {
+	cfg := APIConfig{Port: DefaultAPIPort}
+	if c == nil || c.API == nil {
+		return cfg
+	}
+	cfg.Enabled = c.API.Enabled
+	if c.API.Port > 0 {
+		cfg.Port = c.API.Port
+	}
+	return cfg
+}
+
+// GetProxyConfigWithDefaults returns the proxy config, using defaults for absent values
+func (c *Config) GetProxyConfigWithDefaults() ProxyConfig {
+	cfg := ProxyConfig{Port: DefaultProxyPort}
+	if c == nil || c.Proxy == nil {
+		return cfg
+	}
+	cfg.Enabled = c.Proxy.Enabled
+	cfg.Hosts = c.Proxy.Hosts
+	if c.Proxy.Port > 0 {
+		cfg.Port = c.Proxy.Port
+	}
+	return cfg
+}
+
+// GetSSHProxyConfig returns the ssh-proxy gateway config, or an empty config if absent
+func (c *Config) GetSSHProxyConfig() SSHProxyConfig {
+	if c == nil || c.SSHProxy == nil {
+		return SSHProxyConfig{}
+	}
+	return *c.SSHProxy
+}
+
+// GetSSHProbeConfigWithDefaults returns the SSH probe settings, using defaults for absent values
+func (c *Config) GetSSHProbeConfigWithDefaults() SSHProbeConfig {
+	cfg := SSHProbeConfig{IntervalSec: 60, TimeoutMs: 2000}
+	if c == nil || c.SSHProbe == nil {
+		return cfg
+	}
+	cfg.Enabled = c.SSHProbe.Enabled
+	if c.SSHProbe.IntervalSec > 0 {
+		cfg.IntervalSec = c.SSHProbe.IntervalSec
+	}
+	if c.SSHProbe.TimeoutMs > 0 {
+		cfg.TimeoutMs = c.SSHProbe.TimeoutMs
+	}
+	return cfg
+}
+
+// GetPrefetchConfigWithDefaults returns the token prefetch settings, using defaults for absent
+// values. Unless enabled is set either way, prefetch is enabled while any SPN has
+// auto_refresh set.
+func (c *Config) GetPrefetchConfigWithDefaults() PrefetchConfig {
+	enabled := len(c.autoRefreshSPNs()) > 0
+	cfg := PrefetchConfig{Enabled: &enabled, IntervalSec: 480, Concurrency: 4, JitterSec: 30}
+	if c == nil || c.Prefetch == nil {
+		return cfg
+	}
+	if c.Prefetch.Enabled != nil {
+		enabled = *c.Prefetch.Enabled
+	}
+	if c.Prefetch.IntervalSec > 0 {
+		cfg.IntervalSec = c.Prefetch.IntervalSec
+	}
+	if c.Prefetch.Concurrency > 0 {
+		cfg.Concurrency = c.Prefetch.Concurrency
+	}
+	if c.Prefetch.JitterSec > 0 {
+		cfg.JitterSec = c.Prefetch.JitterSec
+	}
+	return cfg
+}
+
+// GetKeytabConfigWithDefaults returns the keytab settings with defaults applied; Path is
+// empty when no keytab is configured
+func (c *Config) GetKeytabConfigWithDefaults() KeytabConfig {
+	cfg := KeytabConfig{RenewBeforeSec: 1800}
+	if c == nil || c.Keytab == nil {
+		return cfg
+	}
+	cfg.Path = expandHomePath(c.Keytab.Path)
+	cfg.Principal = c.Keytab.Principal
+	if c.Keytab.RenewBeforeSec > 0 {
+		cfg.RenewBeforeSec = c.Keytab.RenewBeforeSec
+	}
+	return cfg
+}
+
+// PrefetchSPNs returns the distinct SPNs token prefetch requests tokens for: all of them
+// with token_prefetch on, else those with auto_refresh set
+func (c *Config) PrefetchSPNs() []string {
+	if c != nil && c.Prefetch != nil && c.Prefetch.IsEnabled() {
+		return c.distinctSPNs(func(SPNEntry) bool { return true })
+	}
+	return c.autoRefreshSPNs()
+}
+
+func (c *Config) autoRefreshSPNs() []string {
+	return c.distinctSPNs(func(entry SPNEntry) bool { return entry.AutoRefresh })
+}
+
+// distinctSPNs returns the SPNs of the entries keep accepts, each once
+func (c *Config) distinctSPNs(keep func(SPNEntry) bool) []string {
+	if c == nil {
+		return nil
+	}
+	var spns []string
+	seen := make(map[string]bool)
+	for _, entry := range c.SPNs {
+		if entry.SPN == "" || seen[entry.SPN] || !keep(entry) {
+			continue
+		}
+		seen[entry.SPN] = true
+		spns = append(spns, entry.SPN)
+	}
+	return spns
+}
+
+// GetLockConfigWithDefaults returns the secrets lock settings, using defaults for absent values
+func (c *Config) GetLockConfigWithDefaults() LockConfig {
+	cfg := LockConfig{IdleSec: 300}
+	if c == nil || c.Lock == nil {
+		return cfg
+	}
+	cfg.Enabled = c.Lock.Enabled
+	cfg.PINHash = c.Lock.PINHash
+	cfg.Biometric = c.Lock.Biometric
+	if c.Lock.IdleSec > 0 {
+		cfg.IdleSec = c.Lock.IdleSec
+	}
+	return cfg
+}
+
+// GetIdleLockConfigWithDefaults returns the idle lock settings, using defaults for absent values
+func (c *Config) GetIdleLockConfigWithDefaults() IdleLockConfig {
+	cfg := IdleLockConfig{IdleMin: 15}
+	if c == nil || c.IdleLock == nil {
+		return cfg
+	}
+	cfg.Enabled = c.IdleLock.Enabled
+	cfg.RequirePIN = c.IdleLock.RequirePIN
+	if c.IdleLock.IdleMin > 0 {
+		cfg.IdleMin = c.IdleLock.IdleMin
+	}
+	return cfg
+}
+
+// GetNotifyConfigWithDefaults returns the notification settings; notifications are on and
+// expiry warnings off by default
+func (c *Config) GetNotifyConfigWithDefaults() NotifyConfig {
+	if c == nil || c.Notify == nil {
+		return NotifyConfig{}
+	}
+	return *c.Notify
+}
+
+// GetBridgeConfigWithDefaults returns the bridge settings with defaults applied
+func (c *Config) GetBridgeConfigWithDefaults() BridgeConfig {
+	var cfg BridgeConfig
+	if c != nil && c.Bridge != nil {
+		cfg = *c.Bridge
+	}
+	if cfg.TTLSec <= 0 {
+		cfg.TTLSec = DefaultBridgeTTLSec
+	}
+	if cfg.RemotePath == "" {
+		cfg.RemotePath = DefaultBridgeRemotePath
+	}
+	return cfg
+}
+
+// GetStatusConfigWithDefaults returns the status settings; the templates are empty by
+// default and a token is expiring DefaultExpiringMin minutes before it expires
+func (c *Config) GetStatusConfigWithDefaults() StatusConfig {
+	var status StatusConfig
+	if c != nil && c.Status != nil {
+		status = *c.Status
+	}
+	if status.ExpiringMin <= 0 {
+		status.ExpiringMin = DefaultExpiringMin
+	}
+	return status
+}
+
+// GetHotkeyConfigWithDefaults returns the hotkey settings; the quick pick is off by default
+func (c *Config) GetHotkeyConfigWithDefaults() HotkeyConfig {
+	if c == nil || c.Hotkeys == nil {
+		return HotkeyConfig{}
+	}
+	return *c.Hotkeys
+}
+
+// GetWakeCheckConfigWithDefaults returns the wake check settings with defaults applied
+func (c *Config) GetWakeCheckConfigWithDefaults() WakeCheckConfig {
+	cfg := WakeCheckConfig{DelaySec: 5}
+	if c == nil || c.WakeCheck == nil {
+		return cfg
+	}
+	cfg.Disabled = c.WakeCheck.Disabled
+	if c.WakeCheck.DelaySec > 0 {
+		cfg.DelaySec = c.WakeCheck.DelaySec
+	}
+	return cfg
+}
+
+// GetOfflineConfigWithDefaults returns the offline mode settings with defaults applied
+func (c *Config) GetOfflineConfigWithDefaults() OfflineConfig {
+	cfg := OfflineConfig{ProbeSec: 60}
+	if c == nil || c.Offline == nil {
+		return cfg
+	}
+	cfg.Disabled = c.Offline.Disabled
+	if c.Offline.ProbeSec > 0 {
+		cfg.ProbeSec = c.Offline.ProbeSec
+	}
+	return cfg
+}
+
+// GetVPNConfigWithDefaults returns the VPN detection settings with defaults applied
+func (c *Config) GetVPNConfigWithDefaults() VPNConfig {
+	cfg := VPNConfig{IntervalSec: 15}
+	if c == nil || c.VPN == nil {
+		return cfg
+	}
+	interval := cfg.IntervalSec
+	cfg = *c.VPN
+	if cfg.IntervalSec <= 0 {
+		cfg.IntervalSec = interval
+	}
+	return cfg
+}
+
+// GetHistoryConfigWithDefaults returns the action history settings with defaults applied
+func (c *Config) GetHistoryConfigWithDefaults() HistoryConfig {
+	cfg := HistoryConfig{MaxAgeDays: 30}
+	if c == nil || c.History == nil {
+		return cfg
+	}
+	cfg.Disabled = c.History.Disabled
+	if c.History.MaxAgeDays > 0 {
+		cfg.MaxAgeDays = c.History.MaxAgeDays
+	}
+	return cfg
+}
+
+// Enabled reports whether any VPN check is set
+func (v VPNConfig) Enabled() bool {
+	return v.Interface != "" || v.Network != "" || v.ProbeURL != ""
+}
+
+// GetSecurityKeyConfigWithDefaults returns the security key settings with defaults applied;
+// no touch is required unless a credential is configured
+func (c *Config) GetSecurityKeyConfigWithDefaults() SecurityKeyConfig {
+	var cfg SecurityKeyConfig
+	if c != nil && c.SecurityKey != nil {
+		cfg = *c.SecurityKey
+	}
+	if cfg.RPID == "" {
+		cfg.RPID = DefaultSecurityKeyRPID
+	}
+	if len(cfg.Require) == 0 {
+		cfg.Require = securityKeyOperations
+	}
+	return cfg
+}
+
+// GetEnvExportConfigWithDefaults returns the env export settings with defaults applied
+func (c *Config) GetEnvExportConfigWithDefaults() EnvExportConfig {
+	var cfg EnvExportConfig
+	if c != nil && c.EnvExport != nil {
+		cfg = *c.EnvExport
+	}
+	vars := make([]EnvVar, len(cfg.Vars))
+	for i, v := range cfg.Vars {
+		vars[i] = v.withDefaultName()
+	}
+	cfg.Vars = vars
+	if cfg.TTLSec <= 0 {
+		cfg.TTLSec = DefaultEnvExportTTLSec
+	}
+	return cfg
+}
+
+// GetUsageConfigWithDefaults returns the usage settings; uses are counted and menus keep
+// the config order by default
+func (c *Config) GetUsageConfigWithDefaults() UsageConfig {
+	if c == nil || c.Usage == nil {
+		return UsageConfig{}
+	}
+	return *c.Usage
+}
+
+// GetMenuSortConfigWithDefaults returns the menu orders with defaults applied; usage.sort_menus
+// makes "usage" the default
+func (c *Config) GetMenuSortConfigWithDefaults() MenuSortConfig {
+	var cfg MenuSortConfig
+	if c != nil && c.MenuSort != nil {
+		cfg = *c.MenuSort
+	}
+	order := menuSortConfig
+	if c.GetUsageConfigWithDefaults().SortMenus {
+		order = menuSortUsage
+	}
+	for _, field := range []*string{&cfg.SPNs, &cfg.URLs, &cfg.Snippets, &cfg.SSH} {
+		if *field == "" {
+			*field = order
+		}
+	}
+	return cfg
+}
+
+// GetSigningConfigWithDefaults returns the signing settings; both are off by default
+func (c *Config) GetSigningConfigWithDefaults() SigningConfig {
+	if c == nil || c.Signing == nil {
+		return SigningConfig{}
+	}
+	return *c.Signing
+}
+
+// InsecureTLSAllowed reports whether HTTP requests may skip TLS certificate verification
+func (c *Config) InsecureTLSAllowed() bool {
+	if c == nil || c.Policy == nil || c.Policy.AllowInsecureTLS == nil {
+		return true
+	}
+	return *c.Policy.AllowInsecureTLS
+}
+
+// ScriptIsolated reports whether scriptName must run in a new Lua state rather than a pooled one
+func (c *Config) ScriptIsolated(scriptName string) bool {
+	if c == nil || c.Lua == nil {
+		return false
+	}
+	if c.Lua.DisablePool {
+		return true
+	}
+	for _, name := range c.Lua.Isolated {
+		if name == scriptName {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSSHImportConfigWithDefaults returns the ssh_config import settings, using defaults for absent values
+func (c *Config) GetSSHImportConfigWithDefaults() SSHImportConfig {
+	cfg := SSHImportConfig{Path: "~/.ssh/config"}
+	if c == nil || c.SSHImport == nil {
+		return cfg
+	}
+	if c.SSHImport.Path != "" {
+		cfg.Path = c.SSHImport.Path
+	}
+	cfg.AutoSync = c.SSHImport.AutoSync
+	cfg.Mode = c.SSHImport.Mode
+	return cfg
+}
+
+// GetClipboardConfigWithDefaults returns clipboard config, using defaults for absent values
+func (c *Config) GetClipboardConfigWithDefaults() ClipboardConfig {
+	cfg := DefaultClipboardConfig()
+	if c == nil || c.Clipboard == nil {
+		return cfg
+	}
+
+	if c.Clipboard.HistorySize > 0 {
+		cfg.HistorySize = c.Clipboard.HistorySize
+	}
+	cfg.DisableHistory = c.Clipboard.DisableHistory
+	cfg.EncryptHistory = c.Clipboard.EncryptHistory
+	cfg.PrimarySelection = c.Clipboard.PrimarySelection
+	cfg.TypeOut = c.Clipboard.TypeOut
+	cfg.TypeOutSecrets = c.Clipboard.TypeOutSecrets
+	cfg.ConfirmCopy = c.Clipboard.ConfirmCopy
+	if c.Clipboard.TypeDelayMs > 0 {
+		cfg.TypeDelayMs = c.Clipboard.TypeDelayMs
+	}
+	if c.Clipboard.MaxSizeKB != 0 {
+		cfg.MaxSizeKB = c.Clipboard.MaxSizeKB
+	}
+	if c.Clipboard.Oversize != "" {
+		cfg.Oversize = c.Clipboard.Oversize
+	}
+
+	return cfg
+}
+
+// GetCacheConfigWithDefaults returns cache config, using defaults if the cache section is absent
+func (c *Config) GetCacheConfigWithDefaults() CacheConfig {
+	cfg := CacheConfig{
+		MaxEntries:   cache.DefaultMaxEntries,
+		MaxSizeKB:    cache.DefaultMaxSizeKB,
+		TokenTTLSec:  int(cache.DefaultTokenExpiration / time.Second),
+		JWTTTLSec:    int(cache.DefaultJWTExpiration / time.Second),
+		SecretTTLSec: int(cache.DefaultSecretExpiration / time.Second),
+	}
+	if c == nil || c.Cache == nil {
+		return cfg
+	}
+
+	cfg.Persist = c.Cache.Persist
+	cfg.KeepCred = c.Cache.KeepCred
+	// Negative values disable a limit, zero keeps the default
+	if c.Cache.MaxEntries != 0 {
+		cfg.MaxEntries = max(c.Cache.MaxEntries, 0)
+	}
+	if c.Cache.MaxSizeKB != 0 {
+		cfg.MaxSizeKB = max(c.Cache.MaxSizeKB, 0)
+	}
+	if c.Cache.TokenTTLSec > 0 {
+		cfg.TokenTTLSec = c.Cache.TokenTTLSec
+	}
+	if c.Cache.JWTTTLSec > 0 {
+		cfg.JWTTTLSec = c.Cache.JWTTTLSec
+	}
+	if c.Cache.SecretTTLSec > 0 {
+		cfg.SecretTTLSec = c.Cache.SecretTTLSec
+	}
 
 	return cfg
 }
 
 // SnippetEntry represents a text snippet that can be copied to clipboard
 type SnippetEntry struct {
-	Index  int    `json:"index"`            // Numeric index for ordering/reference
-	Name   string `json:"name"`             // Display name in menu
-	Value  string `json:"value"`            // The value to copy to clipboard
-	Script string `json:"script,omitempty"` // Optional Lua script to run (filename in scripts folder)
+	Index   int    `json:"index"`              // Numeric index for ordering/reference
+	Name    string `json:"name"`               // Display name in menu
+	Value   string `json:"value"`              // The value to copy to clipboard
+	Script  string `json:"script,omitempty"`   // Optional Lua script to run (filename in scripts folder)
+	TypeOut bool   `json:"type_out,omitempty"` // Type the value as keystrokes instead of copying it to the clipboard
+	Confirm bool   `json:"confirm,omitempty"`  // Ask before copying the value or running the script, showing what it does
+	Group   string `json:"group,omitempty"`    // Group the entry is listed with when the menu is sorted by group
+
+	// Values for particular shells ("bash", "zsh", "powershell", "cmd"), e.g. one-liners that
+	// quote differently; the one for the shell setting is copied instead of value
+	Variants map[string]string `json:"variants,omitempty"`
 }
 
 // URLEntry represents a URL bookmark
 type URLEntry struct {
-	Index  int    `json:"index"`            // Numeric index for hotkey access
-	Name   string `json:"name"`             // Display name in menu
-	URL    string `json:"url"`              // The URL to open
-	Script string `json:"script,omitempty"` // Optional Lua script to run instead of opening URL
+	Index   int    `json:"index"`             // Numeric index for hotkey access
+	Name    string `json:"name"`              // Display name in menu
+	URL     string `json:"url"`               // The URL to open
+	Script  string `json:"script,omitempty"`  // Optional Lua script to run instead of opening URL
+	Confirm bool   `json:"confirm,omitempty"` // Ask before opening the URL or running the script
+	Group   string `json:"group,omitempty"`   // Group the entry is listed with when the menu is sorted by group
+
+	// Kerberos authentication before the browser opens the URL, for sites where its own
+	// SPNEGO is blocked or not configured
+	AuthSPN     string `json:"auth_spn,omitempty"`          // SPN name or template ({host} is the URL's host); enables authentication
+	AuthMode    string `json:"auth_mode,omitempty"`         // "header" (default) copies a fresh Negotiate header, "exchange" gets a one-time token
+	ExchangeURL string `json:"auth_exchange_url,omitempty"` // Gateway that returns a one-time token for a Negotiate request (mode "exchange")
+	TokenField  string `json:"auth_token_field,omitempty"`  // JSON field of the gateway's response holding the token (default: "token", or the whole body if it isn't JSON)
+	TokenParam  string `json:"auth_param,omitempty"`        // Query parameter the token is added to the URL as (default: "token")
 }
 
 // SSHEntry represents an SSH connection configuration
 type SSHEntry struct {
-	Index    int    `json:"index"`            // Numeric index for hotkey access
-	Name     string `json:"name"`             // Display name in menu
-	Command  string `json:"command"`          // SSH command to execute (e.g., "ssh user@host")
-	Terminal string `json:"terminal"`         // Terminal command template with {cmd} placeholder
-	Script   string `json:"script,omitempty"` // Optional Lua script to run before/instead of SSH
+	Index    int    `json:"index"`             // Numeric index for hotkey access
+	Name     string `json:"name"`              // Display name in menu
+	Command  string `json:"command"`           // SSH command to execute (e.g., "ssh user@host")
+	Terminal string `json:"terminal"`          // Terminal command template with {cmd} placeholder
+	Script   string `json:"script,omitempty"`  // Optional Lua script to run before/instead of SSH
+	Tmux     string `json:"tmux,omitempty"`    // tmux session to open the connection in as a window, created if needed
+	Confirm  bool   `json:"confirm,omitempty"` // Ask before connecting or running the script, showing the command
+	Group    string `json:"group,omitempty"`   // Group the entry is listed with when the menu is sorted by group
+
+	Env map[string]string `json:"env,omitempty"` // Environment for the terminal process; {NAME} in command is replaced with the value
+	Cwd string            `json:"cwd,omitempty"` // Working directory for the terminal process
+
+	SendAfter []SSHSendStep `json:"send_after,omitempty"` // Lines typed into a new session once it is open, in order
+
+	// Built-in client (mode "builtin") settings; Command is not used in this mode
+	Mode           string `json:"mode,omitempty"`            // "" runs Command in a terminal, "builtin" uses the embedded SSH client, "serial"/"telnet" open a console
+	Host           string `json:"host,omitempty"`            // Server hostname (also used for the host/<host> GSSAPI SPN)
+	Port           int    `json:"port,omitempty"`            // Server port (default: 22)
+	User           string `json:"user,omitempty"`            // Login name (default: current user)
+	KeyFile        string `json:"key_file,omitempty"`        // Private key file (default: ~/.ssh/id_ed25519, id_ecdsa, id_rsa)
+	PasswordSecret string `json:"password_secret,omitempty"` // Cache key holding the password (e.g. set by a script)
+	Exec           string `json:"exec,omitempty"`            // Run this command and copy its output instead of opening a shell
+
+	// Console (mode "serial" or "telnet") settings; telnet uses Host and Port (default: 23)
+	Device string `json:"device,omitempty"` // Serial device (e.g. /dev/ttyUSB0, COM3)
+	Baud   int    `json:"baud,omitempty"`   // Serial speed (default: 9600)
+
+	JumpHosts []SSHJumpHost `json:"jump_hosts,omitempty"` // Bastions to connect through, in order (ssh -J, or multi-hop in builtin mode)
+}
+
+// SSHJumpHost is a bastion an SSH entry connects through. It can also be given as a
+// "[user@]host[:port]" string. Key and password apply to the builtin client only.
+type SSHJumpHost struct {
+	Host           string `json:"host"`                      // Bastion hostname
+	Port           int    `json:"port,omitempty"`            // Bastion port (default: 22)
+	User           string `json:"user,omitempty"`            // Login name on the bastion (default: current user)
+	KeyFile        string `json:"key_file,omitempty"`        // Private key for the bastion (default: same defaults as the entry)
+	PasswordSecret string `json:"password_secret,omitempty"` // Cache key holding the bastion password
+}
+
+// Transfer directions
+const (
+	transferDownload = "download"
+	transferUpload   = "upload"
+)
+
+// TransferEntry copies a file to or from a host over the builtin SSH client
+type TransferEntry struct {
+	Name       string `json:"name"`                // Display name in menu
+	Host       string `json:"host"`                // SSH entry name (its settings and jump hosts are used), or "[user@]host[:port]"
+	RemotePath string `json:"remote_path"`         // File to download, or destination of an upload (a trailing "/" keeps the local name)
+	Direction  string `json:"direction,omitempty"` // "download" (default) or "upload"
+}
+
+// TokenSet is a named group of SPNs whose tokens are exported together, e.g. for a test
+// suite that needs Negotiate headers for several services
+type TokenSet struct {
+	Name string   `json:"name"`           // Display name in menu, and the name "krb5tray token-set" takes
+	SPNs []string `json:"spns"`           // SPN names from the spns list, or SPNs
+	File string   `json:"file,omitempty"` // JSON file the menu writes, replaced each time (default: a new temporary file)
+}
+
+// CommandEntry runs a Lua script from the Commands menu, asking for its params first
+type CommandEntry struct {
+	Name    string         `json:"name"`              // Display name in menu, and ctx.name
+	Script  string         `json:"script"`            // Lua script to run (filename in scripts folder)
+	Params  []CommandParam `json:"params,omitempty"`  // Values asked for before the script runs, in this order
+	Confirm bool           `json:"confirm,omitempty"` // Ask before running the script, showing the values
+}
+
+// CommandParam is a value a command asks for, handed to its script as ctx.<name>
+type CommandParam struct {
+	Name    string   `json:"name"`              // Key in ctx
+	Prompt  string   `json:"prompt,omitempty"`  // Text of the prompt (default: the name)
+	Default string   `json:"default,omitempty"` // Value the prompt starts with
+	Choices []string `json:"choices,omitempty"` // Values to pick from by number instead of typing one
+	Secret  bool     `json:"secret,omitempty"`  // Hide the input, and the value in the confirmation
+}
+
+// SessionEntry signs in to a web SSO endpoint with Kerberos and hands on the session cookies
+type SessionEntry struct {
+	Name      string   `json:"name"`                 // Display name in menu
+	URL       string   `json:"url"`                  // Page to sign in at; redirects and Negotiate challenges along the way are followed
+	SPN       string   `json:"spn,omitempty"`        // SPN name or template for challenges, {host} is the challenging host (default: "HTTP/{host}")
+	Cookies   []string `json:"cookies,omitempty"`    // Cookie names to hand on (default: all that are sent to cookie_url)
+	CookieURL string   `json:"cookie_url,omitempty"` // URL whose cookies are handed on (default: the page the sign-in ends on)
+	Target    string   `json:"target,omitempty"`     // "header" (default) copies a Cookie header value, "browser" sets them in the browser
+	DebugPort int      `json:"debug_port,omitempty"` // Browser's --remote-debugging-port for target "browser" (default: 9222)
+}
+
+// SSHSendStep is a line sent to a session after a delay. It can also be given as a plain
+// string, which uses the default delay.
+type SSHSendStep struct {
+	Text    string `json:"text"`               // Line to send; Enter is pressed after it
+	DelayMs int    `json:"delay_ms,omitempty"` // Wait before sending, from the previous step or the session opening (default: 1000)
+}
+
+// UnmarshalJSON accepts either a string or an object
+func (s *SSHSendStep) UnmarshalJSON(data []byte) error {
+	var simpleString string
+	if err := json.Unmarshal(data, &simpleString); err == nil {
+		*s = SSHSendStep{Text: simpleString}
+		return nil
+	}
+
+	type sshSendStepAlias SSHSendStep
+	var obj sshSendStepAlias
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*s = SSHSendStep(obj)
+	return nil
 }
 
 // SecretEntry represents a secret configuration
@@ -127,8 +1006,50 @@ type SecretEntry struct {
 // SPNEntry represents a single SPN configuration
 // Supports both simple string format and object format
 type SPNEntry struct {
-	Name string `json:"name"` // Display name in menu
-	SPN  string `json:"spn"`  // The actual SPN value
+	Name  string `json:"name"`            // Display name in menu
+	SPN   string `json:"spn"`             // The actual SPN value
+	Group string `json:"group,omitempty"` // Group the entry is listed with when the menu is sorted by group
+
+	// SSPIPackage overrides sspi_package for this SPN on Windows
+	SSPIPackage string `json:"sspi_package,omitempty"`
+
+	// AutoRefresh has token prefetch keep a fresh token for this SPN cached, even while
+	// token_prefetch is off
+	AutoRefresh bool `json:"auto_refresh,omitempty"`
+
+	// TokenTTLSec overrides cache.token_ttl_sec for this SPN
+	TokenTTLSec int `json:"token_ttl_sec,omitempty"`
+
+	// CCache overrides ccache for this SPN: a file ccache for gokrb5 (the Linux native
+	// transport), or a GSSCred cache UUID on macOS, e.g. for a service in another realm
+	CCache string `json:"ccache,omitempty"`
+}
+
+// FindSPN finds an SPN entry by name (case-insensitive, exact match or substring)
+func (c *Config) FindSPN(name string) (SPNEntry, bool) {
+	if c == nil || name == "" {
+		return SPNEntry{}, false
+	}
+	nameLower := strings.ToLower(name)
+	for _, entry := range c.SPNs {
+		if strings.ToLower(entry.Name) == nameLower ||
+			strings.Contains(strings.ToLower(entry.Name), nameLower) {
+			return entry, true
+		}
+	}
+	return SPNEntry{}, false
+}
+
+// ResolveSPN maps an SPN name from the config to its SPN. Arguments that look like an SPN
+// (containing "/" or "@") or that match no entry are returned unchanged.
+func (c *Config) ResolveSPN(nameOrSPN string) string {
+	if strings.ContainsAny(nameOrSPN, "/@") {
+		return nameOrSPN
+	}
+	if entry, found := c.FindSPN(nameOrSPN); found {
+		return entry.SPN
+	}
+	return nameOrSPN
 }
 
 // UnmarshalJSON implements custom unmarshaling to support both string and object formats
@@ -148,8 +1069,7 @@ func (e *SPNEntry) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	e.Name = obj.Name
-	e.SPN = obj.SPN
+	*e = SPNEntry(obj)
 
 	// If name is empty, use SPN as name
 	if e.Name == "" {
@@ -159,6 +1079,62 @@ func (e *SPNEntry) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// UnmarshalJSON accepts a "[user@]host[:port]" string as well as an object
+func (j *SSHJumpHost) UnmarshalJSON(data []byte) error {
+	var simpleString string
+	if err := json.Unmarshal(data, &simpleString); err == nil {
+		hop, err := parseJumpHost(simpleString)
+		if err != nil {
+			return err
+		}
+		*j = hop
+		return nil
+	}
+
+	type sshJumpHostAlias SSHJumpHost
+	var obj sshJumpHostAlias
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*j = SSHJumpHost(obj)
+	return nil
+}
+
+// parseJumpHost parses a "[user@]host[:port]" jump host, as used by ssh -J and ProxyJump
+func parseJumpHost(s string) (SSHJumpHost, error) {
+	var hop SSHJumpHost
+	s = strings.TrimPrefix(strings.TrimSpace(s), "ssh://")
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		hop.User = s[:i]
+		s = s[i+1:]
+	}
+	hop.Host = s
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return SSHJumpHost{}, fmt.Errorf("invalid jump host port %q", port)
+		}
+		hop.Host = host
+		hop.Port = p
+	}
+	if hop.Host == "" {
+		return SSHJumpHost{}, fmt.Errorf("invalid jump host %q", s)
+	}
+	return hop, nil
+}
+
+// String formats the jump host for ssh -J
+func (j SSHJumpHost) String() string {
+	s := j.Host
+	if j.Port != 0 {
+		s = net.JoinHostPort(j.Host, strconv.Itoa(j.Port))
+	}
+	if j.User != "" {
+		s = j.User + "@" + s
+	}
+	return s
+}
+
 // ConfigDir returns the configuration directory path
 func ConfigDir() string {
 	home, err := os.UserHomeDir()
@@ -183,6 +1159,123 @@ func ScriptPath(scriptName string) string {
 	return filepath.Join(ScriptsDir(), scriptName)
 }
 
+// currentConfig returns the loaded config, or nil before the first load. The snapshot is
+// never modified once published: a reload stores a new one, so callers can keep using the
+// one they got without holding a lock.
+func currentConfig() *Config {
+	return appConfig.Load()
+}
+
+var (
+	headlessConfig     *Config
+	headlessConfigOnce sync.Once
+)
+
+// configOrFile returns the current config or, for headless commands that don't publish
+// one, the config file as read the first time it is needed
+func configOrFile() *Config {
+	if cfg := currentConfig(); cfg != nil {
+		return cfg
+	}
+	headlessConfigOnce.Do(func() {
+		headlessConfig, _ = loadStartupConfig()
+	})
+	return headlessConfig
+}
+
+// GetTransport returns the configured ticket transport, or krb.TransportNative
+func (c *Config) GetTransport() string {
+	if c == nil || c.Transport == "" {
+		return krb.TransportNative
+	}
+	return c.Transport
+}
+
+func validSSPIPackage(pkg string) bool {
+	return pkg == krb.PackageNegotiate || pkg == krb.PackageKerberos
+}
+
+// GetSSPIPackage returns the SSPI package tokens for spn are made with on Windows: the
+// sspi_package of its spns entry, else the top-level one, else krb.PackageNegotiate
+func (c *Config) GetSSPIPackage(spn string) string {
+	if c == nil {
+		return krb.PackageNegotiate
+	}
+	for _, entry := range c.SPNs {
+		if entry.SSPIPackage != "" && strings.EqualFold(entry.SPN, spn) {
+			return entry.SSPIPackage
+		}
+	}
+	if c.SSPIPackage != "" {
+		return c.SSPIPackage
+	}
+	return krb.PackageNegotiate
+}
+
+// GetCCache returns the credential cache tickets for spn are requested from: the ccache of
+// its spns entry, else the top-level one (empty for the transport's default)
+func (c *Config) GetCCache(spn string) string {
+	if c == nil {
+		return ""
+	}
+	for _, entry := range c.SPNs {
+		if entry.CCache != "" && strings.EqualFold(entry.SPN, spn) {
+			return expandHomePath(entry.CCache)
+		}
+	}
+	return c.CCache
+}
+
+// GetTokenTTL returns how long tokens for spn are cached and used for: the token_ttl_sec of
+// its spns entry, else cache.token_ttl_sec
+func (c *Config) GetTokenTTL(spn string) time.Duration {
+	if c != nil {
+		for _, entry := range c.SPNs {
+			if entry.TokenTTLSec > 0 && strings.EqualFold(entry.SPN, spn) {
+				return time.Duration(entry.TokenTTLSec) * time.Second
+			}
+		}
+	}
+	return time.Duration(c.GetCacheConfigWithDefaults().TokenTTLSec) * time.Second
+}
+
+// shortestTokenTTL returns the shortest time any token is cached for
+func (c *Config) shortestTokenTTL() time.Duration {
+	ttl := c.GetTokenTTL("")
+	if c != nil {
+		for _, entry := range c.SPNs {
+			if entry.TokenTTLSec > 0 {
+				ttl = min(ttl, time.Duration(entry.TokenTTLSec)*time.Second)
+			}
+		}
+	}
+	return ttl
+}
+
+// GetJWTTTL returns how long JWTs without an exp claim are cached
+func (c *Config) GetJWTTTL() time.Duration {
+	return time.Duration(c.GetCacheConfigWithDefaults().JWTTTLSec) * time.Second
+}
+
+// GetSecretTTL returns how long secrets set without a TTL are cached
+func (c *Config) GetSecretTTL() time.Duration {
+	return time.Duration(c.GetCacheConfigWithDefaults().SecretTTLSec) * time.Second
+}
+
+// GetKDCTimeout returns how long to wait for the KDC to answer a ticket request
+func (c *Config) GetKDCTimeout() time.Duration {
+	if c == nil || c.KDCTimeout <= 0 {
+		return DefaultKDCTimeoutSec * time.Second
+	}
+	return time.Duration(c.KDCTimeout) * time.Second
+}
+
+// setConfig publishes a newly loaded config. It must be fully prepared (e.g. auto-synced
+// SSH hosts added) before this, since readers may see it immediately.
+func setConfig(cfg *Config) {
+	appConfig.Store(cfg)
+}
+
 // LoadConfig loads configuration from the specified path
 // If path is empty, uses the default path
 func LoadConfig(path string) (*Config, error) {
@@ -194,7 +1287,11 @@ func LoadConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseConfig(data)
+}
 
+// parseConfig decodes a config file's contents
+func parseConfig(data []byte) (*Config, error) {
 	var cfg Config
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
@@ -224,6 +1321,12 @@ func SaveConfig(cfg *Config, path string) error {
 	return os.WriteFile(path, data, 0600)
 }
 
+// exampleSPNEntry is the SPN a new config file starts with
+var exampleSPNEntry = SPNEntry{
+	Name: "Example Service",
+	SPN:  "HTTP/example.com@REALM.COM",
+}
+
 // CreateDefaultConfig creates a default configuration file if it doesn't exist
 func CreateDefaultConfig() error {
 	path := DefaultConfigPath()
@@ -233,12 +1336,7 @@ func CreateDefaultConfig() error {
 	}
 
 	cfg := &Config{
-		SPNs: []SPNEntry{
-			{
-				Name: "Example Service",
-				SPN:  "HTTP/example.com@REALM.COM",
-			},
-		},
+		SPNs: []SPNEntry{exampleSPNEntry},
 	}
 
 	return SaveConfig(cfg, path)
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"krb5tray/pkg/krb"
+)
+
+// LoadConfigStrict loads the config like LoadConfig but also rejects unknown fields,
+// which are usually typos that LoadConfig would silently ignore
+func LoadConfigStrict(path string) (*Config, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the config for mistakes that loading alone doesn't catch
+// and returns a description of each problem found
+func (c *Config) Validate() []string {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	signing := c.GetSigningConfigWithDefaults()
+	checkSignatures := false
+	switch {
+	case signing.PublicKey != "":
+		if _, err := parseMinisignKey(signing.PublicKey); err != nil {
+			addf("signing.public_key: %v", err)
+		} else {
+			checkSignatures = true
+		}
+	case signing.RequireSigned:
+		addf("signing: require_signed without a public_key")
+	}
+	checkScript := func(section string, name string, script string) {
+		if script == "" {
+			return
+		}
+		if _, err := os.Stat(ScriptPath(script)); err != nil {
+			addf("%s %q: script not found: %s", section, name, ScriptPath(script))
+			return
+		}
+		if c.Lua != nil && len(c.Lua.Permissions) > 0 {
+			if _, ok := scriptPermissions(c.Lua, script); !ok {
+				addf("%s %q: %s is not listed in lua.permissions, so it can't run", section, name, script)
+			}
+		}
+		if checkSignatures {
+			if _, err := readSignedFile(ScriptPath(script), signing); err != nil {
+				addf("%s %q: %v", section, name, err)
+			}
+		}
+	}
+
+	spnNames := make(map[string]bool)
+	for i, entry := range c.SPNs {
+		if strings.TrimSpace(entry.SPN) == "" {
+			addf("spns[%d]: spn is empty", i)
+		}
+		key := strings.ToLower(entry.Name)
+		if spnNames[key] {
+			addf("spns[%d]: duplicate name %q", i, entry.Name)
+		}
+		spnNames[key] = true
+		if entry.SSPIPackage != "" && !validSSPIPackage(entry.SSPIPackage) {
+			addf("spns %q: sspi_package must be %q or %q", entry.Name, krb.PackageNegotiate, krb.PackageKerberos)
+		}
+		if entry.CCache != "" && c.GetTransport() == krb.TransportNative {
+			switch {
+			case krb.IsWindows():
+				addf("spns %q: ccache: SSPI has no caches to choose from (set transport to %q to read file ccaches)", entry.Name, krb.TransportGokrb5)
+			case (krb.IsMacOS11OrLater() || krb.IsLegacyMacOS()) && !krb.IsCacheUUID(entry.CCache):
+				addf("spns %q: ccache: %s isn't a GSSCred cache UUID (see klist -l)", entry.Name, entry.CCache)
+			}
+		}
+		if entry.TokenTTLSec < 0 {
+			addf("spns %q: token_ttl_sec: %d is negative", entry.Name, entry.TokenTTLSec)
+		} else if entry.TokenTTLSec > 0 && entry.TokenTTLSec < minTokenTTLSec {
+			addf("spns %q: token_ttl_sec: %d is under %d, so cached tokens would never be used", entry.Name, entry.TokenTTLSec, minTokenTTLSec)
+		}
+	}
+
+	if c.Cache != nil {
+		for _, f := range []struct {
+			name  string
+			value int
+		}{
+			{"token_ttl_sec", c.Cache.TokenTTLSec},
+			{"jwt_ttl_sec", c.Cache.JWTTTLSec},
+			{"secret_ttl_sec", c.Cache.SecretTTLSec},
+		} {
+			if f.value < 0 {
+				addf("cache.%s: %d is negative", f.name, f.value)
+			}
+		}
+		if c.Cache.TokenTTLSec > 0 && c.Cache.TokenTTLSec < minTokenTTLSec {
+			addf("cache.token_ttl_sec: %d is under %d, so cached tokens would never be used", c.Cache.TokenTTLSec, minTokenTTLSec)
+		}
+	}
+
+	for i, entry := range c.Secrets {
+		if entry.Name == "" {
+			addf("secrets[%d]: name is empty", i)
+		}
+		if entry.AuthURL == "" {
+			addf("secrets %q: auth_url is empty", entry.Name)
+		}
+	}
+
+	urlIndex := make(map[int]string)
+	for _, entry := range c.URLs {
+		if entry.URL == "" && entry.Script == "" {
+			addf("urls %q: needs a url or a script", entry.Name)
+		}
+		if other, dup := urlIndex[entry.Index]; dup {
+			addf("urls %q: index %d is also used by %q", entry.Name, entry.Index, other)
+		}
+		urlIndex[entry.Index] = entry.Name
+		checkScript("urls", entry.Name, entry.Script)
+		if entry.AuthSPN == "" {
+			if entry.AuthMode != "" || entry.ExchangeURL != "" || entry.TokenField != "" || entry.TokenParam != "" {
+				addf("urls %q: auth settings need auth_spn", entry.Name)
+			}
+			continue
+		}
+		if entry.Script != "" {
+			addf("urls %q: auth_spn is not used with a script", entry.Name)
+		}
+		switch urlAuthMode(entry) {
+		case urlAuthPreauth:
+			addf("urls %q: auth_mode \"preauth\" was removed, since the browser never got the session; use a sessions entry with target \"browser\"", entry.Name)
+		case urlAuthHeader:
+			if entry.ExchangeURL != "" {
+				addf("urls %q: auth_exchange_url is only used with auth_mode \"exchange\"", entry.Name)
+			}
+		case urlAuthExchange:
+			if u, err := url.Parse(entry.ExchangeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				addf("urls %q: auth_mode \"exchange\" needs an http(s) auth_exchange_url", entry.Name)
+			}
+		default:
+			addf("urls %q: unknown auth_mode %q (use \"header\" or \"exchange\")", entry.Name, entry.AuthMode)
+		}
+	}
+
+	snippetIndex := make(map[int]string)
+	for _, entry := range c.Snippets {
+		if other, dup := snippetIndex[entry.Index]; dup {
+			addf("snippets %q: index %d is also used by %q", entry.Name, entry.Index, other)
+		}
+		snippetIndex[entry.Index] = entry.Name
+		if snippetBlocked(c, entry) {
+			addf("snippets %q: value looks like %s, which policy.snippet_secrets blocks; keep it in secrets", entry.Name, snippetCredential(c, entry))
+		}
+		checkScript("snippets", entry.Name, entry.Script)
+		for shell := range entry.Variants {
+			if !validSnippetShell(shell) {
+				addf("snippets %q: variants: unknown shell %q (use \"bash\", \"zsh\", \"powershell\" or \"cmd\")", entry.Name, shell)
+			}
+		}
+	}
+	if c.Shell != "" && !validSnippetShell(c.Shell) {
+		addf("shell: unknown shell %q (use \"bash\", \"zsh\", \"powershell\" or \"cmd\")", c.Shell)
+	}
+
+	sshIndex := make(map[int]string)
+	for _, entry := range c.SSH {
+		switch entry.Mode {
+		case "":
+			if entry.Command == "" && entry.Script == "" {
+				addf("ssh %q: needs a command or a script", entry.Name)
+			}
+		case sshModeBuiltin:
+			if entry.Host == "" {
+				addf("ssh %q: builtin mode needs a host", entry.Name)
+			}
+			if entry.Port < 0 || entry.Port > 65535 {
+				addf("ssh %q: port %d is out of range", entry.Name, entry.Port)
+			}
+			if entry.KeyFile != "" {
+				if _, err := os.Stat(expandHomePath(entry.KeyFile)); err != nil {
+					addf("ssh %q: key_file not found: %s", entry.Name, entry.KeyFile)
+				}
+			}
+		case sshModeSerial:
+			if entry.Device == "" && entry.Command == "" {
+				addf("ssh %q: serial mode needs a device", entry.Name)
+			}
+			if entry.Baud < 0 {
+				addf("ssh %q: baud %d is negative", entry.Name, entry.Baud)
+			}
+		case sshModeTelnet:
+			if entry.Host == "" && entry.Command == "" {
+				addf("ssh %q: telnet mode needs a host", entry.Name)
+			}
+			if entry.Port < 0 || entry.Port > 65535 {
+				addf("ssh %q: port %d is out of range", entry.Name, entry.Port)
+			}
+		default:
+			addf("ssh %q: unknown mode %q (use \"builtin\", \"serial\", \"telnet\", or leave it empty)", entry.Name, entry.Mode)
+		}
+		if isConsoleMode(entry.Mode) && len(entry.JumpHosts) > 0 {
+			addf("ssh %q: jump_hosts don't apply to %s entries", entry.Name, entry.Mode)
+		}
+		if strings.ContainsAny(entry.Tmux, ".:") {
+			addf("ssh %q: tmux session name can't contain '.' or ':'", entry.Name)
+		}
+		if entry.Tmux != "" && entry.Exec != "" {
+			addf("ssh %q: exec entries don't open a terminal, so tmux is ignored", entry.Name)
+		}
+		for name := range entry.Env {
+			if name == "" || strings.ContainsAny(name, "= ") {
+				addf("ssh %q: invalid env variable name %q", entry.Name, name)
+			}
+		}
+		if dir := sshEntryDir(entry); dir != "" {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				addf("ssh %q: cwd is not a directory: %s", entry.Name, entry.Cwd)
+			}
+		}
+		for i, jump := range entry.JumpHosts {
+			if jump.Host == "" {
+				addf("ssh %q: jump_hosts[%d]: host is empty", entry.Name, i)
+			}
+		}
+		for i, step := range entry.SendAfter {
+			if step.DelayMs < 0 {
+				addf("ssh %q: send_after[%d]: delay_ms %d is negative", entry.Name, i, step.DelayMs)
+			}
+		}
+		if len(entry.SendAfter) > 0 && entry.Exec != "" {
+			addf("ssh %q: exec entries have no interactive session, so send_after is ignored", entry.Name)
+		}
+		if entry.Terminal != "" && !strings.Contains(entry.Terminal, "{cmd}") {
+			addf("ssh %q: terminal has no {cmd} placeholder", entry.Name)
+		}
+		if other, dup := sshIndex[entry.Index]; dup {
+			addf("ssh %q: index %d is also used by %q", entry.Name, entry.Index, other)
+		}
+		sshIndex[entry.Index] = entry.Name
+		checkScript("ssh", entry.Name, entry.Script)
+	}
+
+	sessionNames := make(map[string]bool)
+	for i, entry := range c.Sessions {
+		if entry.Name == "" {
+			addf("sessions[%d]: name is empty", i)
+		} else if sessionNames[strings.ToLower(entry.Name)] {
+			addf("sessions %q: name is used twice", entry.Name)
+		}
+		sessionNames[strings.ToLower(entry.Name)] = true
+		if u, err := url.Parse(entry.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addf("sessions %q: url %q is not an http(s) URL", entry.Name, entry.URL)
+		}
+		if entry.CookieURL != "" {
+			if u, err := url.Parse(entry.CookieURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				addf("sessions %q: cookie_url %q is not an http(s) URL", entry.Name, entry.CookieURL)
+			}
+		}
+		switch sessionTarget(entry) {
+		case sessionTargetHeader:
+			if entry.DebugPort != 0 {
+				addf("sessions %q: debug_port is only used with target \"browser\"", entry.Name)
+			}
+		case sessionTargetBrowser:
+			if entry.DebugPort < 0 || entry.DebugPort > 65535 {
+				addf("sessions %q: debug_port %d is out of range", entry.Name, entry.DebugPort)
+			}
+		default:
+			addf("sessions %q: unknown target %q (use \"header\" or \"browser\")", entry.Name, entry.Target)
+		}
+	}
+
+	for i, t := range c.Transfers {
+		if t.Name == "" {
+			addf("transfers[%d]: name is empty", i)
+		}
+		if t.RemotePath == "" {
+			addf("transfers %q: remote_path is empty", t.Name)
+		}
+		switch transferDirection(t) {
+		case transferDownload:
+			if strings.HasSuffix(t.RemotePath, "/") {
+				addf("transfers %q: a download needs a file, not a directory", t.Name)
+			}
+		case transferUpload:
+		default:
+			addf("transfers %q: unknown direction %q (use \"download\" or \"upload\")", t.Name, t.Direction)
+		}
+		if t.Host == "" {
+			addf("transfers %q: host is empty", t.Name)
+		} else if entry, ok := findSSHEntry(c, t.Host); ok && entry.Host == "" {
+			addf("transfers %q: SSH entry %q has no host for the builtin client", t.Name, entry.Name)
+		}
+	}
+
+	setNames := make(map[string]bool)
+	for i, set := range c.TokenSets {
+		key := strings.ToLower(set.Name)
+		if set.Name == "" {
+			addf("token_sets[%d]: name is empty", i)
+		} else if setNames[key] {
+			addf("token_sets[%d]: duplicate name %q", i, set.Name)
+		}
+		setNames[key] = true
+		if len(set.SPNs) == 0 {
+			addf("token_sets %q: spns is empty", set.Name)
+		}
+		for j, spn := range set.SPNs {
+			if strings.TrimSpace(spn) == "" {
+				addf("token_sets %q: spns[%d] is empty", set.Name, j)
+			}
+		}
+	}
+
+	commandNames := make(map[string]bool)
+	for i, entry := range c.Commands {
+		key := strings.ToLower(entry.Name)
+		if entry.Name == "" {
+			addf("commands[%d]: name is empty", i)
+		} else if commandNames[key] {
+			addf("commands %q: name is used twice", entry.Name)
+		}
+		commandNames[key] = true
+		if entry.Script == "" {
+			addf("commands %q: script is empty", entry.Name)
+		}
+		checkScript("commands", entry.Name, entry.Script)
+		paramNames := make(map[string]bool)
+		for j, p := range entry.Params {
+			switch {
+			case p.Name == "":
+				addf("commands %q: params[%d]: name is empty", entry.Name, j)
+			case p.Name == "name":
+				addf("commands %q: params[%d]: \"name\" is taken by ctx.name", entry.Name, j)
+			case paramNames[p.Name]:
+				addf("commands %q: param %q is listed twice", entry.Name, p.Name)
+			}
+			paramNames[p.Name] = true
+			if p.Secret && len(p.Choices) > 0 {
+				addf("commands %q: param %q: secret has no effect with choices", entry.Name, p.Name)
+			}
+		}
+	}
+
+	if c.Clipboard != nil {
+		if c.Clipboard.MaxSizeKB < -1 {
+			addf("clipboard.max_size_kb: %d is negative (use -1 for unlimited)", c.Clipboard.MaxSizeKB)
+		}
+		switch c.Clipboard.Oversize {
+		case "", clipboardOversizeTruncate, clipboardOversizeFile:
+		default:
+			addf("clipboard.oversize: unknown value %q (use \"truncate\" or \"file\")", c.Clipboard.Oversize)
+		}
+	}
+	if c.Bridge != nil {
+		if c.Bridge.TTLSec < 0 {
+			addf("bridge.ttl_sec: %d is negative", c.Bridge.TTLSec)
+		}
+		if c.Bridge.Host != "" {
+			if _, err := transferSSHEntry(c, TransferEntry{Name: "Bridge", Host: c.Bridge.Host}); err != nil {
+				addf("bridge.host: %v", err)
+			}
+		}
+	}
+
+	if c.SSHImport != nil {
+		importCfg := c.GetSSHImportConfigWithDefaults()
+		if importCfg.Mode != "" && importCfg.Mode != sshModeBuiltin {
+			addf("ssh_import.mode: unknown mode %q", importCfg.Mode)
+		}
+		if _, err := os.Stat(expandHomePath(importCfg.Path)); err != nil {
+			addf("ssh_import.path: %s not found", importCfg.Path)
+		}
+	}
+
+	if c.SSHProbe != nil {
+		if c.SSHProbe.IntervalSec < 0 {
+			addf("ssh_probe.interval_sec: %d is negative", c.SSHProbe.IntervalSec)
+		}
+		if c.SSHProbe.TimeoutMs < 0 {
+			addf("ssh_probe.timeout_ms: %d is negative", c.SSHProbe.TimeoutMs)
+		}
+	}
+
+	if c.Prefetch != nil {
+		if c.Prefetch.IntervalSec < 0 {
+			addf("token_prefetch.interval_sec: %d is negative", c.Prefetch.IntervalSec)
+		} else if lifetime := int(c.shortestTokenTTL() / time.Second); c.Prefetch.IntervalSec >= lifetime {
+			addf("token_prefetch.interval_sec: %d is not below the %ds token lifetime, so tokens expire between rounds", c.Prefetch.IntervalSec, lifetime)
+		}
+		if c.Prefetch.Concurrency < 0 {
+			addf("token_prefetch.concurrency: %d is negative", c.Prefetch.Concurrency)
+		}
+		if c.Prefetch.JitterSec < 0 {
+			addf("token_prefetch.jitter_sec: %d is negative", c.Prefetch.JitterSec)
+		}
+	}
+
+	if c.Lock != nil {
+		if c.Lock.Enabled && c.Lock.PINHash == "" && !c.Lock.Biometric {
+			addf("secrets_lock: enabled without a pin_hash or biometric")
+		}
+		if c.Lock.PINHash != "" {
+			if _, err := bcrypt.Cost([]byte(c.Lock.PINHash)); err != nil {
+				addf("secrets_lock.pin_hash: not a bcrypt hash (create one with \"krb5tray hash-pin\")")
+			}
+		}
+		if c.Lock.IdleSec < 0 {
+			addf("secrets_lock.idle_sec: %d is negative", c.Lock.IdleSec)
+		}
+	}
+
+	switch c.GetSnippetSecretsPolicy() {
+	case snippetSecretsWarn, snippetSecretsBlock, snippetSecretsOff:
+	default:
+		addf("policy.snippet_secrets: must be \"warn\", \"block\" or \"off\"")
+	}
+
+	if c.Transport != "" && !containsString(krb.TransportNames(), c.Transport) {
+		addf("transport: unknown transport %q (have %s)", c.Transport, strings.Join(krb.TransportNames(), ", "))
+	}
+	if c.SSPIPackage != "" && !validSSPIPackage(c.SSPIPackage) {
+		addf("sspi_package: must be %q or %q", krb.PackageNegotiate, krb.PackageKerberos)
+	}
+	if c.KDCTimeout < 0 {
+		addf("kdc_timeout_sec: %d is negative", c.KDCTimeout)
+	}
+	if c.Keytab != nil {
+		if c.Keytab.Path == "" {
+			addf("keytab.path: is empty")
+		} else if _, err := os.Stat(expandHomePath(c.Keytab.Path)); err != nil {
+			addf("keytab.path: %s not found", c.Keytab.Path)
+		}
+		if c.Keytab.Principal == "" {
+			addf("keytab.principal: is empty")
+		}
+		if c.Keytab.RenewBeforeSec < 0 {
+			addf("keytab.renew_before_sec: %d is negative", c.Keytab.RenewBeforeSec)
+		}
+		if !keytabTransport(c) {
+			addf("keytab: only works with the gokrb5 transport, which reads the ccache it writes (set transport to %q)", krb.TransportGokrb5)
+		}
+	}
+
+	for i, rule := range c.SPNMap {
+		if rule.Host == "" {
+			addf("spn_map[%d]: host is empty", i)
+		} else if _, err := path.Match(rule.Host, ""); err != nil {
+			addf("spn_map[%d].host: %q is not a valid glob", i, rule.Host)
+		}
+	}
+
+	if c.EnvExport != nil {
+		for i, v := range c.EnvExport.Vars {
+			v = v.withDefaultName()
+			switch {
+			case (v.SPN == "") == (v.Secret == ""):
+				addf("env_export.vars[%d]: set exactly one of spn and secret", i)
+			case !envVarNamePattern.MatchString(v.Name):
+				addf("env_export.vars[%d].name: %q is not a valid variable name", i, v.Name)
+			case v.Format != "" && v.Format != envFormatHeader && v.Format != envFormatToken:
+				addf("env_export.vars[%d].format: unknown format %q (use header or token)", i, v.Format)
+			case v.Secret != "" && v.Format != "":
+				addf("env_export.vars[%d].format: only applies to spn", i)
+			}
+		}
+		if c.EnvExport.TTLSec < 0 {
+			addf("env_export.ttl_sec: %d is negative", c.EnvExport.TTLSec)
+		}
+	}
+
+	if c.SecurityKey != nil {
+		if c.SecurityKey.Credential == "" {
+			addf("security_key: no credential (create one with \"krb5tray enroll-security-key\")")
+		} else if _, err := base64.StdEncoding.DecodeString(c.SecurityKey.Credential); err != nil {
+			addf("security_key.credential: not base64")
+		}
+		if _, err := parseSecurityKeyPublicKey(c.SecurityKey.PublicKey); err != nil {
+			addf("security_key.public_key: %v", err)
+		}
+		for _, op := range c.SecurityKey.Require {
+			if !containsString(securityKeyOperations, op) {
+				addf("security_key.require: unknown operation %q (use %s)", op, strings.Join(securityKeyOperations, " or "))
+			}
+		}
+		if c.SecurityKey.GraceSec < 0 {
+			addf("security_key.grace_sec: %d is negative", c.SecurityKey.GraceSec)
+		}
+	}
+
+	if c.Lua != nil {
+		scripts := make([]string, 0, len(c.Lua.Permissions))
+		for script := range c.Lua.Permissions {
+			scripts = append(scripts, script)
+		}
+		sort.Strings(scripts)
+		for _, script := range scripts {
+			if _, err := parseLuaCaps(c.Lua.Permissions[script]); err != nil {
+				addf("lua.permissions %q: %v", script, err)
+			}
+		}
+	}
+
+	if c.IdleLock != nil {
+		if c.IdleLock.IdleMin < 0 {
+			addf("idle_lock.idle_min: %d is negative", c.IdleLock.IdleMin)
+		}
+		if c.IdleLock.RequirePIN && (c.Lock == nil || (c.Lock.PINHash == "" && !c.Lock.Biometric)) {
+			addf("idle_lock.require_pin: no secrets_lock.pin_hash or biometric to unlock with")
+		}
+	}
+
+	if c.WakeCheck != nil && c.WakeCheck.DelaySec < 0 {
+		addf("wake_check.delay_sec: %d is negative", c.WakeCheck.DelaySec)
+	}
+	if c.VPN != nil {
+		if c.VPN.Network != "" {
+			if _, _, err := net.ParseCIDR(c.VPN.Network); err != nil {
+				addf("vpn.network: %v", err)
+			}
+		}
+		if c.VPN.ProbeURL != "" {
+			if u, err := url.Parse(c.VPN.ProbeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				addf("vpn.probe_url: not an http(s) URL: %s", c.VPN.ProbeURL)
+			}
+		}
+		if c.VPN.IntervalSec < 0 {
+			addf("vpn.interval_sec: %d is negative", c.VPN.IntervalSec)
+		}
+		if (c.VPN.RefreshTGT || c.VPN.OnConnect != "") && !c.GetVPNConfigWithDefaults().Enabled() {
+			addf("vpn: refresh_tgt and on_connect need an interface, network or probe_url to detect the VPN")
+		}
+		checkScript("vpn", "on_connect", c.VPN.OnConnect)
+	}
+	if c.Offline != nil && c.Offline.ProbeSec < 0 {
+		addf("offline.probe_sec: %d is negative", c.Offline.ProbeSec)
+	}
+	if c.MenuSort != nil {
+		for _, f := range []struct{ kind, name, order string }{
+			{usageSPN, "spns", c.MenuSort.SPNs},
+			{usageURL, "urls", c.MenuSort.URLs},
+			{usageSnippet, "snippets", c.MenuSort.Snippets},
+			{usageSSH, "ssh", c.MenuSort.SSH},
+		} {
+			switch {
+			case f.order == "" || validMenuSort(f.kind, f.order):
+			case f.order == menuSortIndex:
+				addf("menu_sort.%s: SPNs have no index (use config, name, group or usage)", f.name)
+			default:
+				addf("menu_sort.%s: unknown order %q (use config, index, name, group or usage)", f.name, f.order)
+			}
+		}
+	}
+	if c.History != nil && c.History.MaxAgeDays < 0 {
+		addf("history.max_age_days: %d is negative", c.History.MaxAgeDays)
+	}
+
+	if c.Status != nil {
+		for _, name := range unknownStatusVariables(c.Status.Format) {
+			addf("status.format: unknown variable {%s}", name)
+		}
+		for _, name := range unknownStatusVariables(c.Status.Tooltip) {
+			addf("status.tooltip: unknown variable {%s}", name)
+		}
+		if c.Status.ExpiringMin < 0 {
+			addf("status.expiring_min: %d is negative", c.Status.ExpiringMin)
+		} else if lifetime := int(c.shortestTokenTTL() / time.Minute); c.Status.ExpiringMin >= lifetime {
+			// Every new token would be expiring, and auto_refresh would request one on every tick
+			addf("status.expiring_min: must be under %d, the minutes a token is used for", lifetime)
+		}
+	}
+
+	if c.Terminal != "" && !strings.Contains(c.Terminal, "{cmd}") {
+		addf("terminal: no {cmd} placeholder")
+	}
+
+	if c.Logging != nil && c.Logging.Level != "" {
+		if _, err := ParseLogLevel(c.Logging.Level); err != nil {
+			addf("logging.level: %v", err)
+		}
+	}
+
+	api := c.GetAPIConfigWithDefaults()
+	proxy := c.GetProxyConfigWithDefaults()
+	if api.Port > 65535 {
+		addf("api.port: %d is out of range", api.Port)
+	}
+	if proxy.Port > 65535 {
+		addf("proxy.port: %d is out of range", proxy.Port)
+	}
+	if api.Enabled && proxy.Enabled && api.Port == proxy.Port {
+		addf("api.port and proxy.port are both %d", api.Port)
+	}
+	for i, entry := range proxy.Hosts {
+		if entry.Host == "" {
+			addf("proxy.hosts[%d]: host is empty", i)
+		}
+	}
+
+	return problems
+}
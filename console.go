@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Console entry modes, opened in a terminal like command entries
+const (
+	sshModeSerial = "serial"
+	sshModeTelnet = "telnet"
+)
+
+// defaultSerialBaud is the console speed most network gear ships with
+const defaultSerialBaud = 9600
+
+// serialTools are the serial terminal programs tried in order, with their argument
+// templates for device and baud
+var serialTools = []struct {
+	program string
+	args    func(device string, baud string) []string
+}{
+	{"picocom", func(device, baud string) []string { return []string{"-b", baud, device} }},
+	{"minicom", func(device, baud string) []string { return []string{"-D", device, "-b", baud} }},
+	{"screen", func(device, baud string) []string { return []string{device, baud} }},
+	{"cu", func(device, baud string) []string { return []string{"-l", device, "-s", baud} }},
+	{"plink", func(device, baud string) []string { return []string{"-serial", device, "-sercfg", baud} }},
+	{"putty", func(device, baud string) []string { return []string{"-serial", device, "-sercfg", baud} }},
+}
+
+// isConsoleMode reports whether mode is a serial or telnet console
+func isConsoleMode(mode string) bool {
+	return mode == sshModeSerial || mode == sshModeTelnet
+}
+
+// consoleCommand returns the terminal command for a serial or telnet entry.
+// An entry's own command takes precedence, to pick a different program.
+func consoleCommand(entry SSHEntry) (string, error) {
+	if entry.Command != "" {
+		return entry.Command, nil
+	}
+
+	switch entry.Mode {
+	case sshModeTelnet:
+		if _, err := exec.LookPath("telnet"); err != nil {
+			return "", fmt.Errorf("telnet not found on PATH")
+		}
+		return strings.Join(append([]string{"telnet"}, telnetArgs(entry)...), " "), nil
+	case sshModeSerial:
+		baud := strconv.Itoa(serialBaud(entry))
+		for _, tool := range serialTools {
+			if _, err := exec.LookPath(tool.program); err != nil {
+				continue
+			}
+			return strings.Join(append([]string{tool.program}, tool.args(entry.Device, baud)...), " "), nil
+		}
+		return "", fmt.Errorf("no serial terminal found (install picocom, minicom, or screen; plink or putty on Windows)")
+	}
+	return "", fmt.Errorf("not a console entry")
+}
+
+// telnetArgs returns the host and, if set, the port for telnet
+func telnetArgs(entry SSHEntry) []string {
+	if entry.Port != 0 {
+		return []string{entry.Host, strconv.Itoa(entry.Port)}
+	}
+	return []string{entry.Host}
+}
+
+// serialBaud returns the entry's baud rate, or the default
+func serialBaud(entry SSHEntry) int {
+	if entry.Baud > 0 {
+		return entry.Baud
+	}
+	return defaultSerialBaud
+}
+
+// consoleTooltip describes a console entry's target for the menu
+func consoleTooltip(entry SSHEntry) string {
+	if entry.Mode == sshModeSerial {
+		return fmt.Sprintf("serial: %s @ %d", entry.Device, serialBaud(entry))
+	}
+	port := entry.Port
+	if port == 0 {
+		port = 23
+	}
+	return fmt.Sprintf("telnet: %s:%d", entry.Host, port)
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// controlTimeout bounds how long a control connection may take (scripts can prompt the user)
+const controlTimeout = 5 * time.Minute
+
+// controlRequest is sent by "krb5tray ctl" to the running instance
+type controlRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// controlResponse is the running instance's reply
+type controlResponse struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// controlCommand handles one control command
+type controlCommand struct {
+	usage   string
+	summary string
+	run     func(args []string) (string, error)
+}
+
+var (
+	controlListener net.Listener
+	controlMutex    sync.Mutex // Serializes commands, since menu actions aren't designed to run concurrently
+)
+
+// controlCommands lists the commands accepted over the control socket
+func controlCommands() map[string]controlCommand {
+	return map[string]controlCommand{
+		"refresh":           {"refresh", "Request a new ticket for the selected SPN", ctlRefresh},
+		"copy-header":       {"copy-header", "Copy the Negotiate header to the clipboard", ctlCopyHeader},
+		"copy-token":        {"copy-token", "Copy the base64 token to the clipboard", ctlCopyToken},
+		"copy-as":           {"copy-as <curl|httpie|powershell|python> [url]", "Copy a request with the Negotiate header to the selected SPN's host (or url)", ctlCopyAs},
+		"run-script":        {"run-script <name.lua> [key=value...]", "Run a Lua script in the tray", ctlRunScript},
+		"reload":            {"reload", "Reload the configuration file", ctlReload},
+		"restart":           {"restart", "Restart the tray (e.g. after updating the binary), keeping the selected SPN", ctlRestart},
+		"status":            {"status", "Show the selected SPN and token age", ctlStatus},
+		"api-secret":        {"api-secret", "Print the REST API bearer secret for this session", ctlAPISecret},
+		"proxy-url":         {"proxy-url", "Print the Kerberos proxy URL with this session's password, for HTTP_PROXY", ctlProxyURL},
+		"import-ssh-config": {"import-ssh-config", "Add the hosts from ~/.ssh/config to the SSH menu", ctlImportSSHConfig},
+		"ssh-password":      {"ssh-password <ssh-name> [password_secret]", "Print the cached password_secret of a builtin SSH entry or its jump host", ctlSSHPassword},
+		"lock-secrets":      {"lock-secrets", "Lock the secrets until the PIN or biometrics are given again", ctlLockSecrets},
+		"session":           {"session <name>", "Sign in for a sessions entry and copy its cookies (or send them to the browser)", ctlSession},
+		"command":           {"command <name> [param=value...]", "Run a commands entry, asking for the params not given", ctlCommand},
+		"share":             {"share [link|remote]", "Hand the last copied value to a remote session as a one-time link or a file on bridge.host", ctlShare},
+		"purge-tickets":     {"purge-tickets", "Remove the logon session's Kerberos tickets and the cached tokens (Windows)", ctlPurgeTickets},
+		"caches":            {"caches [<cache>|<principal>|default]", "List the credential caches, or request tickets from the one given", ctlCaches},
+		"destroy":           {"destroy", "Destroy the credential cache tickets are requested from, like kdestroy, and the cached tokens", ctlDestroy},
+		"renew-tgt":         {"renew-tgt", "Get a new TGT from the domain controller (Windows)", ctlRenewTGT},
+		"lock":              {"lock", "Lock the tray and wipe tokens and secrets, as after being idle", ctlLock},
+		"env":               {"env [--powershell] [spn:<name>[=VAR] | token:<name>[=VAR] | secret:<key>[=VAR]]...", "Print shell export lines for tokens and cached secrets", ctlEnv},
+		"usage":             {"usage [reset]", "Show how often each SPN, URL, snippet and SSH entry was used, or forget the counts", ctlUsage},
+		"refresh-all":       {"refresh-all", "Renew the TGT, refresh the cached tokens, and run the scripts of expiring JWTs and values again", ctlRefreshAll},
+		"view-response":     {"view-response [jq-query]", "Open the last response of a script or URL entry request, pretty-printed or filtered by the query", ctlViewResponse},
+		"cancel":            {"cancel", "Stop waiting for the ticket requests in flight", ctlCancel},
+	}
+}
+
+// ControlSocketPath returns the path of the control socket
+func ControlSocketPath() string {
+	return filepath.Join(ConfigDir(), "ktray.sock")
+}
+
+// StartControlServer listens on the control socket so "krb5tray ctl" can drive this instance.
+// Must be called while holding the single-instance lock, since any existing socket is removed.
+func StartControlServer() error {
+	path := ControlSocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	_ = os.Remove(path) // Left over from a crashed instance
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		LogWarn("Failed to restrict control socket permissions: %v", err)
+	}
+	controlListener = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					LogError("Control socket accept failed: %v", err)
+				}
+				return
+			}
+			go handleControlConn(conn)
+		}
+	}()
+
+	LogInfo("Control socket listening on %s", path)
+	return nil
+}
+
+// StopControlServer closes the control socket
+func StopControlServer() {
+	if controlListener != nil {
+		_ = controlListener.Close()
+		_ = os.Remove(ControlSocketPath())
+		controlListener = nil
+	}
+}
+
+// handleControlConn reads one request, runs it, and writes the response
+func handleControlConn(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	var req controlRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		writeControlResponse(conn, controlResponse{Message: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	cmd, ok := controlCommands()[req.Command]
+	if !ok {
+		writeControlResponse(conn, controlResponse{Message: fmt.Sprintf("unknown command: %s", req.Command)})
+		return
+	}
+
+	var message string
+	var err error
+	if req.Command == "cancel" {
+		// The command holding the mutex may be the one waiting for the KDC
+		message, err = cmd.run(req.Args)
+	} else {
+		controlMutex.Lock()
+		message, err = cmd.run(req.Args)
+		controlMutex.Unlock()
+	}
+
+	LogAction("control_command", fmt.Sprintf("Control command: %s", req.Command))
+	if err != nil {
+		writeControlResponse(conn, controlResponse{Message: err.Error()})
+		return
+	}
+	writeControlResponse(conn, controlResponse{OK: true, Message: message})
+}
+
+func writeControlResponse(conn net.Conn, resp controlResponse) {
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		LogDebug("Failed to write control response: %v", err)
+	}
+}
+
+// sendControlRequest sends a command to the running instance and returns its response
+func sendControlRequest(req controlRequest) (controlResponse, error) {
+	conn, err := net.DialTimeout("unix", ControlSocketPath(), 2*time.Second)
+	if err != nil {
+		return controlResponse{}, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return controlResponse{}, err
+	}
+	var resp controlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return controlResponse{}, err
+	}
+	return resp, nil
+}
+
+func ctlRefresh(args []string) (string, error) {
+	stateMutex.RLock()
+	spn := currentSPN
+	before := lastTokenTime
+	stateMutex.RUnlock()
+
+	if spn == "" {
+		return "", fmt.Errorf("no SPN selected")
+	}
+
+	refreshToken()
+
+	stateMutex.RLock()
+	after := lastTokenTime
+	stateMutex.RUnlock()
+	if !after.After(before) {
+		if trayOffline() {
+			return "", fmt.Errorf("no KDC could be reached, still using the cached token")
+		}
+		return "", fmt.Errorf("ticket request failed (see log)")
+	}
+	return "Ticket refreshed", nil
+}
+
+func ctlCopyHeader(args []string) (string, error) {
+	if !hasToken() {
+		return "", fmt.Errorf("no token available, run refresh first")
+	}
+	if !copyHTTPHeader(requesterCtl) {
+		return "", fmt.Errorf("not copied")
+	}
+	if clipboardOptions.TypeOutSecrets {
+		return "Typed HTTP header into the focused window", nil
+	}
+	return "Copied HTTP header to clipboard", nil
+}
+
+func ctlCopyToken(args []string) (string, error) {
+	if !hasToken() {
+		return "", fmt.Errorf("no token available, run refresh first")
+	}
+	if !copyToken(requesterCtl) {
+		return "", fmt.Errorf("not copied")
+	}
+	if clipboardOptions.TypeOutSecrets {
+		return "Typed token into the focused window", nil
+	}
+	return "Copied token to clipboard", nil
+}
+
+func ctlRunScript(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: run-script <name.lua> [key=value...]")
+	}
+	engine := GetLuaEngine()
+
+	ctx, err := scriptContextFromArgs(args[0], args[1:])
+	if err != nil {
+		return "", err
+	}
+
+	result, err := engine.RunScript(args[0], ctx)
+	LogScriptExecuted(args[0], "control", err)
+	if err != nil {
+		return "", err
+	}
+	updateCacheMenu()
+	return result, nil
+}
+
+func ctlReload(args []string) (string, error) {
+	if _, err := loadSignedConfig(currentConfig().GetSigningConfigWithDefaults()); err != nil {
+		return "", fmt.Errorf("config error: %w", err)
+	}
+	reloadConfig()
+	return "Config reloaded", nil
+}
+
+func ctlStatus(args []string) (string, error) {
+	stateMutex.RLock()
+	spn := currentSPN
+	tokenTime := lastTokenTime
+	stateMutex.RUnlock()
+
+	offline := ""
+	if since := offlineSince(); !since.IsZero() {
+		offline = fmt.Sprintf(" (offline since %s)", since.Format("15:04"))
+	}
+	if vpn := vpnStatus(); vpn != "" {
+		offline += "; " + vpn
+	}
+	if spn == "" {
+		return "No SPN selected" + offline, nil
+	}
+	if tokenTime.IsZero() {
+		return fmt.Sprintf("SPN: %s (no token)%s", spn, offline), nil
+	}
+	return fmt.Sprintf("SPN: %s, token obtained %s ago%s", spn, time.Since(tokenTime).Round(time.Second), offline), nil
+}
+
+func ctlAPISecret(args []string) (string, error) {
+	cfg := currentConfig()
+
+	if !cfg.GetAPIConfigWithDefaults().Enabled {
+		return "", fmt.Errorf("REST API is not enabled (set api.enabled in the config)")
+	}
+	return APISecret(), nil
+}
+
+func ctlProxyURL(args []string) (string, error) {
+	url := ProxyURL()
+	if url == "" {
+		return "", fmt.Errorf("the proxy is not running (set proxy.enabled in the config)")
+	}
+	return url, nil
+}
+
+func ctlImportSSHConfig(args []string) (string, error) {
+	count, err := importSSHConfigHosts()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Imported %d SSH hosts", count), nil
+}
+
+// ctlSSHPassword hands an SSH entry's password_secret (or a jump host's) to its
+// "ssh-session" process. Only keys named by that entry can be read this way.
+func ctlSSHPassword(args []string) (string, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", fmt.Errorf("usage: ssh-password <ssh-name> [password_secret]")
+	}
+	cfg := currentConfig()
+
+	entry, ok := findSSHEntry(cfg, args[0])
+	if !ok {
+		return "", fmt.Errorf("no SSH entry named %q", args[0])
+	}
+	hop := entry
+	if len(args) == 2 && args[1] != entry.PasswordSecret {
+		found := false
+		for _, jump := range jumpHostEntries(entry) {
+			if jump.PasswordSecret == args[1] {
+				hop, found = jump, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%q is not a password_secret of SSH entry %q", args[1], entry.Name)
+		}
+	}
+	if hop.PasswordSecret == "" {
+		return "", fmt.Errorf("SSH entry %q has no password_secret", entry.Name)
+	}
+	password := cachedSSHPassword(hop)
+	if password == "" {
+		return "", fmt.Errorf("%q is not in the cache", hop.PasswordSecret)
+	}
+	if err := unlockSecrets(fmt.Sprintf("Unlock secrets to log in to %s", hop.Name)); err != nil {
+		return "", fmt.Errorf("secrets are locked: %w", err)
+	}
+	return password, nil
+}
+
+// scriptContextFromArgs builds a script's ctx table from key=value arguments
+func scriptContextFromArgs(name string, args []string) (map[string]string, error) {
+	ctx := map[string]string{"name": name}
+	for _, arg := range args {
+		k, v, found := strings.Cut(arg, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid script argument %q (use key=value)", arg)
+		}
+		ctx[k] = v
+	}
+	return ctx, nil
+}
+
+// hasToken reports whether a token has been obtained
+func hasToken() bool {
+	stateMutex.RLock()
+	defer stateMutex.RUnlock()
+	return lastToken.Len() > 0
+}
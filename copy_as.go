@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/getlantern/systray"
+)
+
+var (
+	mCopyAsMenu *systray.MenuItem
+	copyAsItems []*systray.MenuItem
+)
+
+// copyAsFormat is a request to the selected SPN's host with the token, ready to paste
+type copyAsFormat struct {
+	name   string // As given to "ctl copy-as"
+	title  string // Menu item title
+	render func(url string, header string) string
+}
+
+// copyAsFormats are the requests Copy As offers, in menu order
+var copyAsFormats = []copyAsFormat{
+	{"curl", "curl", func(url, header string) string {
+		return fmt.Sprintf("curl --fail -H %s %s", shellQuote("Authorization: "+header), shellQuote(url))
+	}},
+	{"httpie", "HTTPie", func(url, header string) string {
+		return fmt.Sprintf("http %s %s", shellQuote(url), shellQuote("Authorization:"+header))
+	}},
+	{"powershell", "PowerShell Invoke-WebRequest", func(url, header string) string {
+		return fmt.Sprintf("Invoke-WebRequest -Uri %s -Headers @{ Authorization = %s }", powerShellQuote(url), powerShellQuote(header))
+	}},
+	{"python", "Python requests", func(url, header string) string {
+		return fmt.Sprintf(`import requests
+
+response = requests.get(
+    %s,
+    headers={"Authorization": %s},
+)
+print(response.status_code, response.text)
+`, strconv.Quote(url), strconv.Quote(header))
+	}},
+}
+
+// powerShellQuote quotes s for single-quoted PowerShell strings
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// findCopyAsFormat returns the format called name (case-insensitive)
+func findCopyAsFormat(name string) (copyAsFormat, bool) {
+	for _, f := range copyAsFormats {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return copyAsFormat{}, false
+}
+
+// spnURL is the URL of the host an SPN names, like https://app.example.com/ for
+// HTTP/app.example.com@EXAMPLE.COM, or "" if it names none
+func spnURL(spn string) string {
+	_, host, found := strings.Cut(spn, "/")
+	if !found {
+		_, host, found = strings.Cut(spn, "@") // HTTP@host
+	}
+	host, _, _ = strings.Cut(host, "@")
+	if !found || host == "" {
+		return ""
+	}
+	return "https://" + host + "/"
+}
+
+// buildCopyAsMenu adds an item per format to the Copy As menu
+func buildCopyAsMenu() {
+	for _, f := range copyAsFormats {
+		item := mCopyAsMenu.AddSubMenuItem(f.title, fmt.Sprintf("Copy a %s request to the selected SPN's host with the token", f.title))
+		copyAsItems = append(copyAsItems, item)
+		go func(f copyAsFormat, item *systray.MenuItem) {
+			for range item.ClickedCh {
+				noteUserActivity()
+				copyTokenAs(f, "", requesterMenu)
+			}
+		}(f, item)
+	}
+}
+
+// copyTokenAs copies the request of format f to url (the selected SPN's host when empty)
+// with the current token; requester is what asked for it (menu or ctl). It reports false if
+// nothing was copied.
+func copyTokenAs(f copyAsFormat, url string, requester string) bool {
+	stateMutex.RLock()
+	token := lastToken.String()
+	spn := currentSPN
+	stateMutex.RUnlock()
+
+	if token == "" {
+		return false
+	}
+	if url == "" {
+		url = spnURL(spn)
+	}
+	if url == "" {
+		setStatusError(fmt.Sprintf("No host in SPN %s", spn))
+		return false
+	}
+
+	if err := requireSecurityKey(securityKeyTokens, "Copy the "+f.title+" request"); err != nil {
+		setStatusError(truncateError(err))
+		return false
+	}
+	copied, err := copySecretToClipboard(f.title+" request", f.render(url, "Negotiate "+token), requester)
+	if err != nil {
+		LogError("Failed to copy %s request: %v", f.title, err)
+		setStatusError(fmt.Sprintf("Copy failed: %v", err))
+		return false
+	}
+	if !copied {
+		return false
+	}
+	logSecretCopy("copy_as", f.name)
+	setStatus(fmt.Sprintf("%s %s request for %s", secretCopyVerb(), f.title, url))
+	return true
+}
+
+// ctlCopyAs copies a request in the named format, to the URL if one is given
+func ctlCopyAs(args []string) (string, error) {
+	names := make([]string, len(copyAsFormats))
+	for i, f := range copyAsFormats {
+		names[i] = f.name
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return "", fmt.Errorf("usage: copy-as <%s> [url]", strings.Join(names, "|"))
+	}
+	f, ok := findCopyAsFormat(args[0])
+	if !ok {
+		return "", fmt.Errorf("unknown format %q (have %s)", args[0], strings.Join(names, ", "))
+	}
+	url := ""
+	if len(args) == 2 {
+		url = args[1]
+	}
+	if !hasToken() {
+		return "", fmt.Errorf("no token available, run refresh first")
+	}
+	if !copyTokenAs(f, url, requesterCtl) {
+		return "", fmt.Errorf("not copied")
+	}
+	return fmt.Sprintf("Copied %s request to the clipboard", f.title), nil
+}
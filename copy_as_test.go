@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCopyAsFormats(t *testing.T) {
+	for spn, want := range map[string]string{
+		"HTTP/app.example.com":             "https://app.example.com/",
+		"HTTP/app.example.com@EXAMPLE.COM": "https://app.example.com/",
+		"HTTP@app.example.com":             "https://app.example.com/",
+		"app.example.com":                  "",
+	} {
+		if got := spnURL(spn); got != want {
+			t.Errorf("spnURL(%q) = %q, want %q", spn, got, want)
+		}
+	}
+
+	f, ok := findCopyAsFormat("CURL")
+	if !ok {
+		t.Fatal("no curl format")
+	}
+	if got, want := f.render("https://app.example.com/it's", "Negotiate YII="), `curl --fail -H 'Authorization: Negotiate YII=' 'https://app.example.com/it'\''s'`; got != want {
+		t.Errorf("curl = %s, want %s", got, want)
+	}
+	f, _ = findCopyAsFormat("powershell")
+	if got := f.render("https://app.example.com/", "Negotiate YII="); got != "Invoke-WebRequest -Uri 'https://app.example.com/' -Headers @{ Authorization = 'Negotiate YII=' }" {
+		t.Errorf("powershell = %s", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/user"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"krb5tray/internal/keychain"
+	"krb5tray/pkg/krb"
+)
+
+// credentialKeychainService is the Keychain service the exported credential is saved under
+const credentialKeychainService = "ktray-credential"
+
+// errNoSavedCredential means the Keychain has no credential from an earlier run
+var errNoSavedCredential = errors.New("no saved credential")
+
+var (
+	credentialRestoreOnce sync.Once
+
+	// credentialPersisting is set while cache.persist_credential is on, so turning it off
+	// deletes the saved credential
+	credentialPersisting atomic.Bool
+)
+
+// keychainAccount is the Keychain account items are saved for: the user's login name
+func keychainAccount() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "ktray"
+}
+
+// credentialPersistence reports whether cfg has the credential saved across restarts; only
+// the macOS native transport can export one
+func credentialPersistence(cfg *Config) bool {
+	return runtime.GOOS == "darwin" && cfg.GetCacheConfigWithDefaults().KeepCred && cfg.GetTransport() == krb.TransportNative
+}
+
+// ApplyCredentialPersistence restores the credential the last run saved, once, if
+// cache.persist_credential is set. Turning it off deletes the saved credential.
+func ApplyCredentialPersistence(cfg *Config) {
+	if !credentialPersistence(cfg) {
+		if credentialPersisting.Swap(false) {
+			krb.ForgetImportedCredential()
+			if err := deleteSavedCredential(); err != nil && !errors.Is(err, errNoSavedCredential) {
+				LogWarn("Failed to delete the saved Kerberos credential: %v", err)
+			}
+		}
+		return
+	}
+	credentialPersisting.Store(true)
+	credentialRestoreOnce.Do(restoreCredential)
+}
+
+// restoreCredential imports the saved credential, so the first tickets after a restart are
+// requested with it. One for another principal than the default credential's isn't used.
+func restoreCredential() {
+	data, err := loadSavedCredential()
+	if errors.Is(err, errNoSavedCredential) {
+		return
+	}
+	if err != nil {
+		LogWarn("Failed to read the saved Kerberos credential: %v", err)
+		return
+	}
+	defer zeroBytes(data)
+
+	principal, expires, err := krb.ImportCredential(data)
+	if err != nil {
+		LogInfo("Saved Kerberos credential not restored: %v", err)
+		_ = deleteSavedCredential()
+		return
+	}
+	if current := currentPrincipal(); current == "" || !strings.EqualFold(current, principal) {
+		krb.ForgetImportedCredential()
+		LogInfo("Saved Kerberos credential for %s not restored: the default credential is for %q", principal, current)
+		_ = deleteSavedCredential()
+		return
+	}
+	LogAction("credential_restored", fmt.Sprintf("Restored the Kerberos credential for %s, valid until %s", principal, expires.Format("2006-01-02 15:04")))
+}
+
+// saveCredential exports the default credential to the Keychain for the next run, if
+// cache.persist_credential is set
+func saveCredential() {
+	if !credentialPersistence(currentConfig()) {
+		return
+	}
+	data, err := krb.ExportCredential(krbOptions())
+	if err != nil {
+		LogWarn("Kerberos credential not saved: %v", err)
+		return
+	}
+	defer zeroBytes(data)
+	if err := storeSavedCredential(data); err != nil {
+		LogWarn("Failed to save the Kerberos credential: %v", err)
+	}
+}
+
+func loadSavedCredential() ([]byte, error) {
+	out, err := keychain.Find(credentialKeychainService, keychainAccount())
+	if err != nil {
+		if errors.Is(err, keychain.ErrNotFound) {
+			return nil, errNoSavedCredential
+		}
+		return nil, err
+	}
+	defer zeroBytes(out)
+	return base64.StdEncoding.DecodeString(string(out))
+}
+
+func storeSavedCredential(data []byte) error {
+	return keychain.Save(credentialKeychainService, keychainAccount(), base64.StdEncoding.EncodeToString(data))
+}
+
+func deleteSavedCredential() error {
+	err := keychain.Delete(credentialKeychainService, keychainAccount())
+	if errors.Is(err, keychain.ErrNotFound) {
+		return errNoSavedCredential
+	}
+	return err
+}
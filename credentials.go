@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/pkg/krb"
+)
+
+// credentialsMenuRefresh is how often the Credentials menu reads the tickets again
+const credentialsMenuRefresh = time.Minute
+
+// credentialTimeFormat is how the Credentials menu shows ticket times
+const credentialTimeFormat = "Jan 2 15:04:05"
+
+var mCredentialsMenu *systray.MenuItem
+
+// credentialsMenu lists the user's Kerberos tickets like klist. Like jwtMenu, ticket slots
+// are created as the list grows and hidden when it shrinks, since systray can't remove items.
+var credentialsMenu struct {
+	mu          sync.Mutex
+	principal   *systray.MenuItem
+	cache       *systray.MenuItem
+	placeholder *systray.MenuItem
+	slots       []*credentialSlot
+}
+
+// credentialSlot is a ticket's item in the Credentials menu, with its details below it
+type credentialSlot struct {
+	item      *systray.MenuItem
+	client    *systray.MenuItem
+	start     *systray.MenuItem
+	expires   *systray.MenuItem
+	renewTill *systray.MenuItem
+	enctype   *systray.MenuItem
+}
+
+// credentialListing is what the transport reports about the user's credentials
+type credentialListing struct {
+	principal string
+	cache     string
+	creds     []krb.CredInfo
+	err       error
+}
+
+// credentialText is a ticket as the Credentials menu shows it
+type credentialText struct {
+	title     string
+	client    string
+	start     string
+	expires   string
+	renewTill string
+	enctype   string
+}
+
+// readCredentials lists the tickets of the current user, TGTs first
+func readCredentials() credentialListing {
+	var l credentialListing
+	t, err := krb.Open(krbOptions())
+	if err != nil {
+		l.err = err
+		return l
+	}
+	defer t.Close()
+
+	l.principal, _ = t.GetDefaultPrincipal()
+	l.cache, _ = t.GetDefaultCache()
+	l.creds, l.err = t.GetCredentials()
+	sort.SliceStable(l.creds, func(i, j int) bool {
+		ti, tj := isTGT(l.creds[i].ServerPrincipal), isTGT(l.creds[j].ServerPrincipal)
+		if ti != tj {
+			return ti
+		}
+		return l.creds[i].ServerPrincipal < l.creds[j].ServerPrincipal
+	})
+	return l
+}
+
+// isTGT reports whether server is a ticket-granting service; macOS names it just "krbtgt"
+func isTGT(server string) bool {
+	return server == "krbtgt" || strings.HasPrefix(server, "krbtgt/")
+}
+
+// describeCredential formats c for the Credentials menu
+func describeCredential(c krb.CredInfo, now time.Time) credentialText {
+	end := time.Unix(c.EndTime, 0)
+	text := credentialText{
+		title:   truncateString(c.ServerPrincipal, 45),
+		client:  "Client: " + valueOrDash(c.ClientPrincipal),
+		start:   "Valid from: -",
+		enctype: "Encryption: " + krb.EnctypeName(c.KeyType),
+	}
+	if c.StartTime > 0 {
+		text.start = "Valid from: " + time.Unix(c.StartTime, 0).Format(credentialTimeFormat)
+	}
+	if remaining := end.Sub(now); remaining > 0 {
+		text.title += fmt.Sprintf(" (%s)", formatDuration(remaining))
+		text.expires = fmt.Sprintf("Expires: %s (in %s)", end.Format(credentialTimeFormat), formatDuration(remaining))
+	} else {
+		text.title += " (expired)"
+		text.expires = "Expired: " + end.Format(credentialTimeFormat)
+	}
+	if c.RenewTill > 0 {
+		text.renewTill = "Renew till: " + time.Unix(c.RenewTill, 0).Format(credentialTimeFormat)
+	} else {
+		text.renewTill = "Renew till: - (not renewable)"
+	}
+	return text
+}
+
+// loadAndBuildCredentialsMenu fills the Credentials menu and keeps it current
+func loadAndBuildCredentialsMenu() {
+	credentialsMenu.principal = mCredentialsMenu.AddSubMenuItem("Principal: -", "The client principal of the default credentials")
+	credentialsMenu.principal.Disable()
+	credentialsMenu.cache = mCredentialsMenu.AddSubMenuItem("Cache: -", "The credential cache the tickets are read from")
+	credentialsMenu.cache.Disable()
+	credentialsMenu.placeholder = mCredentialsMenu.AddSubMenuItem("No tickets", "Run kinit or sign in to get a TGT")
+	credentialsMenu.placeholder.Disable()
+
+	updateCredentialsMenu()
+	go func() {
+		for range time.Tick(credentialsMenuRefresh) {
+			updateCredentialsMenu()
+		}
+	}()
+}
+
+// updateCredentialsMenu reads the tickets again and shows them with their times
+func updateCredentialsMenu() {
+	if mCredentialsMenu == nil {
+		return
+	}
+	l := readCredentials()
+
+	credentialsMenu.mu.Lock()
+	defer credentialsMenu.mu.Unlock()
+
+	if l.principal != "" {
+		credentialsMenu.principal.SetTitle(fmt.Sprintf("Principal: %s (realm %s)", l.principal, valueOrDash(realmOf(l.principal))))
+	} else {
+		credentialsMenu.principal.SetTitle("Principal: -")
+	}
+	credentialsMenu.cache.SetTitle("Cache: " + valueOrDash(l.cache))
+
+	for len(credentialsMenu.slots) < len(l.creds) {
+		credentialsMenu.slots = append(credentialsMenu.slots, newCredentialSlot())
+	}
+	now := time.Now()
+	for i, slot := range credentialsMenu.slots {
+		if i >= len(l.creds) {
+			slot.item.Hide()
+			continue
+		}
+		text := describeCredential(l.creds[i], now)
+		slot.item.SetTitle(text.title)
+		slot.item.SetTooltip(l.creds[i].ServerPrincipal)
+		slot.client.SetTitle(text.client)
+		slot.start.SetTitle(text.start)
+		slot.expires.SetTitle(text.expires)
+		slot.renewTill.SetTitle(text.renewTill)
+		slot.enctype.SetTitle(text.enctype)
+		slot.item.Show()
+	}
+
+	switch {
+	case l.err != nil:
+		credentialsMenu.placeholder.SetTitle("Can't list tickets: " + truncateError(l.err))
+		credentialsMenu.placeholder.SetTooltip(l.err.Error())
+		credentialsMenu.placeholder.Show()
+		mCredentialsMenu.SetTitle("Credentials")
+	case len(l.creds) == 0:
+		credentialsMenu.placeholder.SetTitle("No tickets")
+		credentialsMenu.placeholder.SetTooltip("Run kinit or sign in to get a TGT")
+		credentialsMenu.placeholder.Show()
+		mCredentialsMenu.SetTitle("Credentials")
+	default:
+		credentialsMenu.placeholder.Hide()
+		mCredentialsMenu.SetTitle(fmt.Sprintf("Credentials (%d)", len(l.creds)))
+	}
+}
+
+// newCredentialSlot adds a ticket item with its details to the Credentials menu
+func newCredentialSlot() *credentialSlot {
+	slot := &credentialSlot{item: mCredentialsMenu.AddSubMenuItem("", "")}
+	slot.client = slot.item.AddSubMenuItem("", "The principal the ticket was issued to")
+	slot.start = slot.item.AddSubMenuItem("", "When the ticket became valid")
+	slot.expires = slot.item.AddSubMenuItem("", "When the ticket expires")
+	slot.renewTill = slot.item.AddSubMenuItem("", "Until when the ticket can be renewed")
+	slot.enctype = slot.item.AddSubMenuItem("", "The session key's encryption type")
+	for _, detail := range []*systray.MenuItem{slot.client, slot.start, slot.expires, slot.renewTill, slot.enctype} {
+		detail.Disable()
+	}
+	return slot
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"krb5tray/pkg/krb"
+)
+
+// TestHeadlessCredentials covers the Credentials menu's listing of the mock TGT
+func TestHeadlessCredentials(t *testing.T) {
+	newHeadlessTray(t, harnessConfig)
+	l := readCredentials()
+	if l.err != nil || l.principal != krb.MockPrincipal || len(l.creds) != 1 {
+		t.Fatalf("listing = %+v", l)
+	}
+	text := describeCredential(l.creds[0], time.Now())
+	if !strings.HasPrefix(text.title, "krbtgt/") || strings.HasSuffix(text.title, "(expired)") {
+		t.Errorf("title = %q", text.title)
+	}
+	if text.client != "Client: "+krb.MockPrincipal || !strings.HasPrefix(text.expires, "Expires: ") {
+		t.Errorf("details = %+v", text)
+	}
+	if text.renewTill != "Renew till: - (not renewable)" {
+		t.Errorf("renew till = %q", text.renewTill)
+	}
+	if got := describeCredential(l.creds[0], time.Now().Add(krb.MockTGTLifetime+time.Minute)); !strings.HasSuffix(got.title, "(expired)") {
+		t.Errorf("title after expiry = %q", got.title)
+	}
+}
+
+// TestHeadlessDestroyCredentials covers Destroy Credentials: the cache is destroyed and the
+// cached tokens go with it
+func TestHeadlessDestroyCredentials(t *testing.T) {
+	h := newHeadlessTray(t, `{"spns": [{"name": "App", "spn": "HTTP/app.example.com"}]}`)
+	h.clickSPN("App")
+	if h.token() == "" {
+		t.Fatal("no token before destroying")
+	}
+
+	msg, err := ctlDestroy(nil)
+	if err != nil || !strings.Contains(msg, "1 cached tokens dropped") {
+		t.Fatalf("destroy = %q, %v", msg, err)
+	}
+	if !krb.MockCacheDestroyed.Load() {
+		t.Error("the cache wasn't destroyed")
+	}
+	if h.token() != "" {
+		t.Error("the current token survived")
+	}
+	if _, found := GetCache().GetToken("HTTP/app.example.com"); found {
+		t.Error("the cached token survived")
+	}
+	if _, err := ctlRefresh(nil); err == nil {
+		t.Error("refresh succeeded without a cache")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// confirmPreviewMax is how much of a command or value the confirmation shows
+const confirmPreviewMax = 400
+
+// confirmEntry asks before an entry with confirm set runs, showing preview (what it is
+// about to do). A cancelled entry is noted in the status line.
+func confirmEntry(kind string, name string, preview string) bool {
+	if r := []rune(preview); len(r) > confirmPreviewMax {
+		preview = string(r[:confirmPreviewMax-1]) + "…"
+	}
+	if ConfirmDialog(fmt.Sprintf("Confirm %s", name), preview+"\n\nContinue?") {
+		return true
+	}
+	LogDebug("%s entry %q cancelled at the confirmation", kind, name)
+	setStatus(fmt.Sprintf("Cancelled: %s", name))
+	return false
+}
+
+// confirmScriptPreview describes running script with the value it is given
+func confirmScriptPreview(script string, what string, value string) string {
+	if value == "" {
+		return fmt.Sprintf("Runs the script %s.", script)
+	}
+	return fmt.Sprintf("Runs the script %s with %s:\n%s", script, what, value)
+}
+
+// confirmSSHPreview describes what an SSH entry runs; entry.Command has been expanded
+func confirmSSHPreview(entry SSHEntry) string {
+	switch {
+	case entry.Script != "":
+		return confirmScriptPreview(entry.Script, "the command", entry.Command)
+	case entry.Mode == sshModeBuiltin && entry.Exec != "":
+		return fmt.Sprintf("Runs on %s@%s:\n%s", sshEntryUser(entry), sshEntryAddress(entry), entry.Exec)
+	case entry.Mode == sshModeBuiltin:
+		return fmt.Sprintf("Opens a shell on %s@%s.", sshEntryUser(entry), sshEntryAddress(entry))
+	}
+	preview := entry.Command
+	if len(entry.SendAfter) > 0 {
+		var lines []string
+		for _, step := range entry.SendAfter {
+			lines = append(lines, step.Text)
+		}
+		preview += "\n\nThen types:\n" + strings.Join(lines, "\n")
+	}
+	return preview
+}
+
+// confirmSnippetPreview describes what a snippet copies or types; values that look like
+// credentials aren't shown
+func confirmSnippetPreview(entry SnippetEntry, autoPaste bool) string {
+	value := snippetValue(entry, currentConfig().GetSnippetShell())
+	if snippetCredential(currentConfig(), entry) != "" {
+		value = "(hidden, it looks like a credential)"
+	}
+	switch {
+	case entry.Script != "":
+		return confirmScriptPreview(entry.Script, "the value", value)
+	case shouldTypeOut(entry):
+		return "Types:\n" + value
+	case autoPaste:
+		return "Pastes:\n" + value
+	}
+	return "Copies:\n" + value
+}
+
+// confirmURLPreview describes what a URL entry opens or runs
+func confirmURLPreview(entry URLEntry) string {
+	if entry.Script != "" {
+		return confirmScriptPreview(entry.Script, "the URL", entry.URL)
+	}
+	return "Opens " + entry.URL
+}
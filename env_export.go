@@ -0,0 +1,375 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultEnvExportTTLSec is how many seconds a file written by Export Env lasts
+const DefaultEnvExportTTLSec = 300
+
+// Shells that export lines are written for
+const (
+	envShellSh         = "sh"
+	envShellPowerShell = "powershell"
+)
+
+var (
+	// envVarNamePattern matches a portable environment variable name
+	envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// envVarUnsafe matches what a secret key can't keep in a default variable name
+	envVarUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// parseEnvSpec parses "spn:<name>[=VAR]", "token:<name>[=VAR]" or "secret:<key>[=VAR]", the
+// form ctl env takes variables in
+func parseEnvSpec(spec string) (EnvVar, error) {
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok || rest == "" {
+		return EnvVar{}, fmt.Errorf("invalid variable %q (use spn:<name>, token:<name> or secret:<key>, optionally with =VAR)", spec)
+	}
+	source, name, _ := strings.Cut(rest, "=")
+	var v EnvVar
+	switch kind {
+	case "spn":
+		v = EnvVar{Name: name, SPN: source}
+	case "token":
+		v = EnvVar{Name: name, SPN: source, Format: envFormatToken}
+	case "secret":
+		v = EnvVar{Name: name, Secret: source}
+	default:
+		return EnvVar{}, fmt.Errorf("invalid variable %q (use spn:, token: or secret:)", spec)
+	}
+	return v.withDefaultName(), nil
+}
+
+// withDefaultName names the variable AUTH_HEADER, KRB5_TOKEN or after the secret's key
+// when no name is given
+func (v EnvVar) withDefaultName() EnvVar {
+	if v.Name != "" {
+		return v
+	}
+	switch {
+	case v.Secret != "":
+		v.Name = strings.ToUpper(envVarUnsafe.ReplaceAllString(v.Secret, "_"))
+	case v.Format == envFormatToken:
+		v.Name = "KRB5_TOKEN"
+	default:
+		v.Name = "AUTH_HEADER"
+	}
+	return v
+}
+
+// spec is the inverse of parseEnvSpec
+func (v EnvVar) spec() string {
+	switch {
+	case v.Secret != "":
+		return fmt.Sprintf("secret:%s=%s", v.Secret, v.Name)
+	case v.Format == envFormatToken:
+		return fmt.Sprintf("token:%s=%s", v.SPN, v.Name)
+	}
+	return fmt.Sprintf("spn:%s=%s", v.SPN, v.Name)
+}
+
+// envExportVars returns env_export.vars, or AUTH_HEADER for the selected SPN if there are none
+func envExportVars(cfg *Config) ([]EnvVar, error) {
+	if vars := cfg.GetEnvExportConfigWithDefaults().Vars; len(vars) > 0 {
+		return vars, nil
+	}
+	stateMutex.RLock()
+	spn := currentSPN
+	stateMutex.RUnlock()
+	if spn == "" {
+		return nil, fmt.Errorf("no SPN selected and no env_export.vars configured")
+	}
+	return []EnvVar{{Name: "AUTH_HEADER", SPN: spn}}, nil
+}
+
+// envExportLines renders vars as export lines for shell, requesting tokens and reading
+// cached secrets. Secrets need the secrets lock (and a security key touch, if configured)
+// to be passed first, as do tokens when the security key requires it for them.
+func envExportLines(cfg *Config, vars []EnvVar, shell string) (string, error) {
+	var needTokens, needSecrets bool
+	for _, v := range vars {
+		if !envVarNamePattern.MatchString(v.Name) {
+			return "", fmt.Errorf("invalid variable name %q", v.Name)
+		}
+		needTokens = needTokens || v.Secret == ""
+		needSecrets = needSecrets || v.Secret != ""
+	}
+	if needTokens && trayIdleLocked() {
+		return "", errIdleLocked
+	}
+	if needTokens {
+		if err := requireSecurityKey(securityKeyTokens, "Export tokens to the environment"); err != nil {
+			return "", err
+		}
+	}
+	if needSecrets {
+		if err := unlockSecrets("Unlock secrets to export them to the environment"); err != nil {
+			return "", fmt.Errorf("secrets are locked: %w", err)
+		}
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		var value string
+		if v.Secret != "" {
+			secret, found := GetCache().GetSecret(v.Secret)
+			if !found {
+				return "", fmt.Errorf("secret %q is not in the cache", v.Secret)
+			}
+			value = secret
+		} else {
+			token, err := getCachedServiceToken(cfg, cfg.ResolveSPN(v.SPN), false)
+			if err != nil {
+				return "", fmt.Errorf("failed to get token for %s: %w", v.SPN, err)
+			}
+			value = token
+			if v.Format != envFormatToken {
+				value = "Negotiate " + token
+			}
+		}
+		b.WriteString(envExportLine(shell, v.Name, value))
+	}
+	return b.String(), nil
+}
+
+// envExportLine is a line setting name to value in shell
+func envExportLine(shell string, name string, value string) string {
+	if shell == envShellPowerShell {
+		return fmt.Sprintf("$env:%s = '%s'\n", name, strings.ReplaceAll(value, "'", "''"))
+	}
+	return fmt.Sprintf("export %s=%s\n", name, shellQuote(value))
+}
+
+// defaultEnvShell is PowerShell on Windows and sh elsewhere
+func defaultEnvShell() string {
+	if runtime.GOOS == "windows" {
+		return envShellPowerShell
+	}
+	return envShellSh
+}
+
+// writeEnvFile writes lines to a new file readable only by the user and returns its path
+func writeEnvFile(lines string, shell string) (string, error) {
+	suffix := ".sh"
+	if shell == envShellPowerShell {
+		suffix = ".ps1"
+	}
+	f, err := os.CreateTemp("", "krb5tray-env-*"+suffix)
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	if err := f.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	if _, err := f.WriteString(lines); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// sourceCommand is what loads path into a shell
+func sourceCommand(shell string, path string) string {
+	if shell == envShellPowerShell {
+		return fmt.Sprintf(". '%s'", strings.ReplaceAll(path, "'", "''"))
+	}
+	return ". " + shellQuote(path)
+}
+
+// handleExportEnvClick writes the env_export variables to a temporary file, copies the
+// command that sources it, and deletes the file after ttl_sec
+func handleExportEnvClick() {
+	cfg := currentConfig()
+	vars, err := envExportVars(cfg)
+	if err != nil {
+		setStatusError(truncateError(err))
+		return
+	}
+	shell := defaultEnvShell()
+	lines, err := envExportLines(cfg, vars, shell)
+	if err != nil {
+		LogError("Export env failed: %v", err)
+		setStatusError(fmt.Sprintf("Export failed: %s", truncateError(err)))
+		return
+	}
+	path, err := writeEnvFile(lines, shell)
+	if err != nil {
+		LogError("Export env failed: %v", err)
+		setStatusError(fmt.Sprintf("Export failed: %s", truncateError(err)))
+		return
+	}
+	ttl := time.Duration(cfg.GetEnvExportConfigWithDefaults().TTLSec) * time.Second
+	time.AfterFunc(ttl, func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			LogWarn("Failed to remove env file %s: %v", path, err)
+		}
+	})
+
+	// The command isn't the value, so it goes to the clipboard without a history entry
+	if err := copyToClipboard(sourceCommand(shell, path)); err != nil {
+		setStatusError(fmt.Sprintf("Copy failed: %v", err))
+		return
+	}
+	LogActionWithFields("env_export", fmt.Sprintf("Exported %d variables to %s", len(vars), path), map[string]interface{}{
+		"vars":    envVarNames(vars),
+		"ttl_sec": int(ttl.Seconds()),
+	})
+	setStatus(fmt.Sprintf("Copied source command (file lasts %ds)", int(ttl.Seconds())))
+}
+
+func envVarNames(vars []EnvVar) []string {
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// ctlEnv prints export lines: env [--powershell] [spn:<name>[=VAR] | token:<name>[=VAR] | secret:<key>[=VAR]]...
+func ctlEnv(args []string) (string, error) {
+	shell := envShellSh
+	if len(args) > 0 && args[0] == "--powershell" {
+		shell = envShellPowerShell
+		args = args[1:]
+	}
+	cfg := currentConfig()
+	var vars []EnvVar
+	for _, arg := range args {
+		v, err := parseEnvSpec(arg)
+		if err != nil {
+			return "", err
+		}
+		vars = append(vars, v)
+	}
+	if len(vars) == 0 {
+		var err error
+		if vars, err = envExportVars(cfg); err != nil {
+			return "", err
+		}
+	}
+	lines, err := envExportLines(cfg, vars, shell)
+	if err != nil {
+		return "", err
+	}
+	LogActionWithFields("env_export", fmt.Sprintf("Exported %d variables with ctl", len(vars)), map[string]interface{}{
+		"vars": envVarNames(vars),
+	})
+	return strings.TrimSuffix(lines, "\n"), nil
+}
+
+// envFlag collects repeated --spn, --token and --secret flags in order
+type envFlag struct {
+	vars *[]EnvVar
+	kind string
+}
+
+func (f envFlag) String() string { return "" }
+
+func (f envFlag) Set(value string) error {
+	v, err := parseEnvSpec(f.kind + ":" + value)
+	if err != nil {
+		return err
+	}
+	*f.vars = append(*f.vars, v)
+	return nil
+}
+
+// runEnvCommand prints export lines for tokens and secrets. It asks the running tray,
+// which holds the secrets; without one, tokens are requested directly.
+func runEnvCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var vars []EnvVar
+	fs.Var(envFlag{&vars, "spn"}, "spn", "Export `name[=VAR]`'s Negotiate header (default variable: AUTH_HEADER)")
+	fs.Var(envFlag{&vars, "token"}, "token", "Export `name[=VAR]`'s base64 token (default variable: KRB5_TOKEN)")
+	fs.Var(envFlag{&vars, "secret"}, "secret", "Export the cached secret `key[=VAR]` (default variable: the key in upper case)")
+	powershell := fs.Bool("powershell", runtime.GOOS == "windows", "Print PowerShell $env: lines instead of sh export lines")
+	toFile := fs.Bool("file", false, "Write the lines to a new file readable only by you and print its path")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray env [--spn name[=VAR]]... [--token name[=VAR]]... [--secret key[=VAR]]... [--powershell] [--file]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Prints shell export lines, e.g. for: eval \"$(krb5tray env --spn 'Production API')\"")
+		_, _ = fmt.Fprintln(stderr, "Without variables, env_export.vars from the config (or the selected SPN) is used.")
+		_, _ = fmt.Fprintln(stderr, "Secrets are read from the running tray's cache.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	shell := envShellSh
+	if *powershell {
+		shell = envShellPowerShell
+	}
+
+	ctlArgs := make([]string, 0, len(vars)+1)
+	if shell == envShellPowerShell {
+		ctlArgs = append(ctlArgs, "--powershell")
+	}
+	for _, v := range vars {
+		ctlArgs = append(ctlArgs, v.spec())
+	}
+
+	var lines string
+	resp, err := sendControlRequest(controlRequest{Command: "env", Args: ctlArgs})
+	switch {
+	case err == nil && !resp.OK:
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %s\n", resp.Message)
+		return exitFailure
+	case err == nil:
+		lines = resp.Message + "\n"
+	default:
+		// No tray: tokens can still be requested here, secrets can't
+		cfg, _ := LoadConfig("")
+		if len(vars) == 0 {
+			vars = cfg.GetEnvExportConfigWithDefaults().Vars
+		}
+		if len(vars) == 0 {
+			_, _ = fmt.Fprintln(stderr, "krb5tray: no variables given and no env_export.vars configured")
+			return exitUsage
+		}
+		for _, v := range vars {
+			if v.Secret != "" {
+				_, _ = fmt.Fprintf(stderr, "krb5tray: secrets need the running tray (is it running?): %v\n", err)
+				return exitNotRunning
+			}
+		}
+		if lines, err = envExportLines(cfg, vars, shell); err != nil {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+			return ticketErrorExitCode(classifyTicketError(err))
+		}
+	}
+
+	if !*toFile {
+		_, _ = io.WriteString(stdout, lines)
+		return exitOK
+	}
+	path, err := writeEnvFile(lines, shell)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	_, _ = fmt.Fprintln(stdout, path)
+	return exitOK
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"krb5tray/pkg/krb"
+)
+
+// envImportPreviewMax is how many entries the import confirmation lists
+const envImportPreviewMax = 30
+
+// envImport is what the Kerberos environment has that the config doesn't yet
+type envImport struct {
+	SPNs   []SPNEntry   `json:"spns,omitempty"`
+	SPNMap []SPNMapRule `json:"spn_map,omitempty"`
+	SSH    []SSHEntry   `json:"ssh,omitempty"`
+	URLs   []URLEntry   `json:"urls,omitempty"`
+	Notes  []string     `json:"notes,omitempty"` // Sources that couldn't be read, and why
+
+	spns  map[string]bool // Lowercase SPNs in the config or found so far
+	names map[string]bool // Lowercase SPN names in the config or found so far
+}
+
+// chromeBookmark is a node of a Chromium-based browser's Bookmarks file
+type chromeBookmark struct {
+	Type     string           `json:"type"` // "url" or "folder"
+	Name     string           `json:"name"`
+	URL      string           `json:"url"`
+	Children []chromeBookmark `json:"children"`
+}
+
+// scanEnvironment looks for what cfg (as read from the file) could be populated with:
+// realms' domains in krb5.conf become spn_map rules, service tickets in the ccache SPNs,
+// ~/.ssh/config hosts SSH entries, and, with bookmarks, browser bookmarks for hosts in
+// those domains URL entries with their SPNs
+func scanEnvironment(cfg *Config, bookmarks bool) envImport {
+	found := envImport{spns: map[string]bool{}, names: map[string]bool{}}
+	for _, entry := range cfg.SPNs {
+		found.spns[strings.ToLower(entry.SPN)] = true
+		found.names[strings.ToLower(entry.Name)] = true
+	}
+
+	var domains []string
+	conf, err := loadKrb5Conf()
+	if err != nil {
+		found.note("krb5.conf: %v", err)
+	} else {
+		domains = krb5ConfDomains(conf)
+		found.addSPNMapRules(cfg, domains)
+	}
+
+	found.addCCacheSPNs()
+
+	importCfg := cfg.GetSSHImportConfigWithDefaults()
+	if hosts, err := parseSSHConfigFile(importCfg.Path); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			found.note("ssh_config: %v", err)
+		}
+	} else {
+		found.SSH = sshEntriesFromHosts(hosts, cfg.SSH, importCfg.Mode)
+	}
+
+	if bookmarks {
+		if len(domains) == 0 {
+			found.note("bookmarks: krb5.conf names no domains to pick bookmarks by")
+		} else {
+			found.addBookmarks(cfg, domains)
+		}
+	}
+	return found
+}
+
+func (e *envImport) note(format string, args ...interface{}) {
+	e.Notes = append(e.Notes, fmt.Sprintf(format, args...))
+}
+
+// addSPN adds an entry for spn unless it's known, named after its host
+func (e *envImport) addSPN(spn string) {
+	if e.spns[strings.ToLower(spn)] {
+		return
+	}
+	e.spns[strings.ToLower(spn)] = true
+
+	service, host, _ := strings.Cut(spn, "/")
+	host, _, _ = strings.Cut(host, "@")
+	label, _, _ := strings.Cut(host, ".")
+	name := label
+	if !strings.EqualFold(service, "HTTP") {
+		name = fmt.Sprintf("%s (%s)", label, service)
+	}
+	if e.names[strings.ToLower(name)] {
+		name = spn
+	}
+	e.names[strings.ToLower(name)] = true
+	e.SPNs = append(e.SPNs, SPNEntry{Name: name, SPN: spn})
+}
+
+// krb5ConfDomains returns the domains of [domain_realm], without the leading dot
+func krb5ConfDomains(conf *krb5Conf) []string {
+	seen := map[string]bool{}
+	var domains []string
+	for domain := range conf.domainRealm {
+		domain = strings.TrimPrefix(domain, ".")
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// inDomains reports whether host is one of domains or under one
+func inDomains(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// addSPNMapRules maps the hosts of each domain to HTTP SPNs, unless spn_map has the glob
+func (e *envImport) addSPNMapRules(cfg *Config, domains []string) {
+	known := map[string]bool{}
+	for _, rule := range cfg.SPNMap {
+		known[strings.ToLower(rule.Host)] = true
+	}
+	for _, domain := range domains {
+		glob := "*." + domain
+		if !known[glob] {
+			known[glob] = true
+			e.SPNMap = append(e.SPNMap, SPNMapRule{Host: glob})
+		}
+	}
+}
+
+// addCCacheSPNs adds the services the credential cache (the LSA's on Windows) holds
+// tickets for
+func (e *envImport) addCCacheSPNs() {
+	t, err := krb.Open(krbOptions())
+	if err != nil {
+		e.note("ccache: %v", err)
+		return
+	}
+	defer t.Close()
+	creds, err := t.GetCredentials()
+	if err != nil {
+		e.note("ccache: %v", err)
+		return
+	}
+	for _, c := range creds {
+		server := c.ServerPrincipal
+		if strings.HasPrefix(server, "krbtgt/") || !strings.Contains(server, "/") {
+			continue
+		}
+		// Tickets in the user's own realm are asked for without one
+		if realm := realmOf(server); realm != "" && strings.EqualFold(realm, realmOf(c.ClientPrincipal)) {
+			server = strings.TrimSuffix(server, "@"+realm)
+		}
+		e.addSPN(server)
+	}
+}
+
+// addBookmarks adds the bookmarks for hosts in domains as URL entries, grouped by their
+// folder, and an SPN for each host
+func (e *envImport) addBookmarks(cfg *Config, domains []string) {
+	known := map[string]bool{}
+	next := 0
+	for _, entry := range cfg.URLs {
+		known[entry.URL] = true
+		if entry.Index >= next {
+			next = entry.Index + 1
+		}
+	}
+
+	var walk func(node chromeBookmark, group string)
+	walk = func(node chromeBookmark, group string) {
+		if node.Type == "folder" {
+			for _, child := range node.Children {
+				walk(child, node.Name)
+			}
+			return
+		}
+		u, err := url.Parse(node.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !inDomains(u.Hostname(), domains) || known[node.URL] {
+			return
+		}
+		known[node.URL] = true
+		name := node.Name
+		if name == "" {
+			name = u.Hostname()
+		}
+		e.URLs = append(e.URLs, URLEntry{Index: next, Name: name, URL: node.URL, Group: group})
+		next++
+		e.addSPN("HTTP/" + strings.ToLower(u.Hostname()))
+	}
+
+	files := browserBookmarkFiles()
+	if len(files) == 0 {
+		e.note("bookmarks: no Chrome, Edge, Brave or Chromium profile found")
+		return
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			e.note("bookmarks: %v", err)
+			continue
+		}
+		var file struct {
+			Roots map[string]json.RawMessage `json:"roots"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			e.note("bookmarks: %s: %v", path, err)
+			continue
+		}
+		// The roots are the bookmarks bar, other and mobile bookmarks; their entries are ungrouped
+		names := make([]string, 0, len(file.Roots))
+		for name := range file.Roots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var root chromeBookmark
+			if json.Unmarshal(file.Roots[name], &root) != nil {
+				continue
+			}
+			for _, child := range root.Children {
+				walk(child, "")
+			}
+		}
+	}
+}
+
+// browserBookmarkFiles returns the Bookmarks files of the Chromium-based browsers'
+// profiles. Firefox keeps its bookmarks in a database and isn't read.
+func browserBookmarkFiles() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	switch runtime.GOOS {
+	case "darwin":
+		base := filepath.Join(home, "Library", "Application Support")
+		dirs = []string{
+			filepath.Join(base, "Google", "Chrome"),
+			filepath.Join(base, "Microsoft Edge"),
+			filepath.Join(base, "BraveSoftware", "Brave-Browser"),
+			filepath.Join(base, "Chromium"),
+		}
+	case "windows":
+		base := os.Getenv("LOCALAPPDATA")
+		dirs = []string{
+			filepath.Join(base, "Google", "Chrome", "User Data"),
+			filepath.Join(base, "Microsoft", "Edge", "User Data"),
+			filepath.Join(base, "BraveSoftware", "Brave-Browser", "User Data"),
+			filepath.Join(base, "Chromium", "User Data"),
+		}
+	default:
+		base := os.Getenv("XDG_CONFIG_HOME")
+		if base == "" {
+			base = filepath.Join(home, ".config")
+		}
+		dirs = []string{
+			filepath.Join(base, "google-chrome"),
+			filepath.Join(base, "microsoft-edge"),
+			filepath.Join(base, "BraveSoftware", "Brave-Browser"),
+			filepath.Join(base, "chromium"),
+		}
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*", "Bookmarks"))
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// empty reports whether nothing new was found
+func (e envImport) empty() bool {
+	return len(e.SPNs)+len(e.SPNMap)+len(e.SSH)+len(e.URLs) == 0
+}
+
+// summary counts what was found, e.g. "3 SPNs, 1 spn_map rule and 5 SSH hosts"
+func (e envImport) summary() string {
+	var parts []string
+	for _, p := range []struct {
+		n                int
+		singular, plural string
+	}{
+		{len(e.SPNs), "SPN", "SPNs"},
+		{len(e.SPNMap), "spn_map rule", "spn_map rules"},
+		{len(e.SSH), "SSH host", "SSH hosts"},
+		{len(e.URLs), "URL", "URLs"},
+	} {
+		switch p.n {
+		case 0:
+		case 1:
+			parts = append(parts, "1 "+p.singular)
+		default:
+			parts = append(parts, fmt.Sprintf("%d %s", p.n, p.plural))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing new"
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// lines describes each entry found, one per line
+func (e envImport) lines() []string {
+	var lines []string
+	for _, entry := range e.SPNs {
+		lines = append(lines, fmt.Sprintf("SPN %s: %s", entry.Name, entry.SPN))
+	}
+	for _, rule := range e.SPNMap {
+		lines = append(lines, fmt.Sprintf("spn_map %s: HTTP/{host}", rule.Host))
+	}
+	for _, entry := range e.SSH {
+		target := entry.Command
+		if entry.Mode == sshModeBuiltin {
+			target = fmt.Sprintf("%s@%s", sshEntryUser(entry), sshEntryAddress(entry))
+		}
+		lines = append(lines, fmt.Sprintf("SSH [%d] %s: %s", entry.Index, entry.Name, target))
+	}
+	for _, entry := range e.URLs {
+		lines = append(lines, fmt.Sprintf("URL [%d] %s: %s", entry.Index, entry.Name, entry.URL))
+	}
+	return lines
+}
+
+// apply adds what was found to cfg. The example SPN of a new config goes once there are
+// real ones.
+func (e envImport) apply(cfg *Config) {
+	if len(e.SPNs) > 0 && len(cfg.SPNs) == 1 && cfg.SPNs[0] == exampleSPNEntry {
+		cfg.SPNs = nil
+	}
+	cfg.SPNs = append(cfg.SPNs, e.SPNs...)
+	cfg.SPNMap = append(cfg.SPNMap, e.SPNMap...)
+	cfg.SSH = append(cfg.SSH, e.SSH...)
+	cfg.URLs = append(cfg.URLs, e.URLs...)
+}
+
+// handleEnvImportClick scans the environment and adds what the user confirms to the config
+func handleEnvImportClick() {
+	for range mEnvImport.ClickedCh {
+		noteUserActivity()
+		bookmarks := ConfirmDialog("Import from Environment", "Also add bookmarks for sites in the Kerberos domains from Chrome, Edge, Brave and Chromium?")
+		err := editConfigFile(func(cfg *Config) (string, error) {
+			setStatus("Scanning the environment...")
+			found := scanEnvironment(cfg, bookmarks)
+			for _, note := range found.Notes {
+				LogDebug("Import from environment: %s", note)
+			}
+			if found.empty() {
+				setStatus("Nothing new to import")
+				return "", nil
+			}
+			lines := found.lines()
+			if len(lines) > envImportPreviewMax {
+				lines = append(lines[:envImportPreviewMax], fmt.Sprintf("… and %d more", len(lines)-envImportPreviewMax))
+			}
+			if !ConfirmDialog("Import from Environment", fmt.Sprintf("Add %s to the config?\n\n%s", found.summary(), strings.Join(lines, "\n"))) {
+				setStatus("Import cancelled")
+				return "", nil
+			}
+			found.apply(cfg)
+			return fmt.Sprintf("Imported %s", found.summary()), nil
+		})
+		if err != nil {
+			LogError("Import from environment failed: %v", err)
+			setStatusError(fmt.Sprintf("Import failed: %s", truncateError(err)))
+		}
+	}
+}
+
+// runImportEnvCommand adds what the Kerberos environment has to the config file
+func runImportEnvCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("import-env", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	bookmarks := fs.Bool("bookmarks", false, "Also add browser bookmarks for hosts in the krb5.conf domains")
+	dryRun := fs.Bool("dry-run", false, "Only print what would be added")
+	asJSON := fs.Bool("json", false, "Print {\"spns\", \"spn_map\", \"ssh\", \"urls\", \"notes\"} as JSON")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray import-env [--bookmarks] [--dry-run] [--json]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Adds spn_map rules for the krb5.conf domains, SPNs for the tickets in the ccache")
+		_, _ = fmt.Fprintln(stderr, "and SSH entries for the ~/.ssh/config hosts that the config doesn't have yet.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := CreateDefaultConfig(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	cfg, err := LoadConfig("")
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: config error: %v\n", err)
+		return exitFailure
+	}
+	found := scanEnvironment(cfg, *bookmarks)
+	for _, note := range found.Notes {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %s\n", note)
+	}
+	if *asJSON {
+		writeCLIJSON(stdout, stderr, found)
+	} else {
+		for _, line := range found.lines() {
+			_, _ = fmt.Fprintln(stdout, line)
+		}
+	}
+	if *dryRun || found.empty() {
+		return exitOK
+	}
+
+	// Rewriting a signed config would break its signature
+	if err := checkConfigRewritable(cfg, "add the entries"); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	found.apply(cfg)
+	if err := SaveConfig(cfg, ""); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: failed to save config: %v\n", err)
+		return exitFailure
+	}
+	// A running tray picks the entries up right away
+	if _, err := sendControlRequest(controlRequest{Command: "reload"}); err == nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: added %s to %s and reloaded the tray\n", found.summary(), DefaultConfigPath())
+	} else {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: added %s to %s\n", found.summary(), DefaultConfigPath())
+	}
+	return exitOK
+}
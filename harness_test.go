@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"krb5tray/internal/cache"
+	"krb5tray/pkg/krb"
+)
+
+// headlessTray runs the tray's logic without systray: no menu is built, so the menu
+// handlers only update state, and tickets come from the mock transport
+type headlessTray struct {
+	t *testing.T
+}
+
+// newHeadlessTray publishes the config in cfgJSON, with the mock transport unless it sets
+// another one, under a temporary home directory
+func newHeadlessTray(t *testing.T, cfgJSON string) *headlessTray {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("KRB5CCNAME", "")
+
+	h := &headlessTray{t: t}
+	h.setConfig(cfgJSON)
+	InitCache()
+	setSPNState("", "")
+	setLastToken(nil, time.Time{})
+
+	t.Cleanup(func() {
+		krb.MockKDCDown.Store(false)
+		krb.MockCacheDestroyed.Store(false)
+		krb.MockDelay.Store(0)
+		markOnline()
+		setLastToken(nil, time.Time{})
+		setSPNState("", "")
+		setConfig(nil)
+		appCache = nil
+		cachedValueRunsMutex.Lock()
+		cachedValueRuns = map[string]*scriptRun{}
+		cachedValueRunsMutex.Unlock()
+	})
+	return h
+}
+
+// setConfig publishes cfgJSON as a reload would
+func (h *headlessTray) setConfig(cfgJSON string) {
+	h.t.Helper()
+	cfg, err := parseConfig([]byte(cfgJSON))
+	if err != nil {
+		h.t.Fatalf("config: %v", err)
+	}
+	if cfg.Transport == "" {
+		cfg.Transport = krb.TransportMock
+	}
+	if cfg.Notify == nil {
+		cfg.Notify = &NotifyConfig{Disabled: true}
+	}
+	if errs := cfg.Validate(); len(errs) > 0 {
+		h.t.Fatalf("config: %v", errs)
+	}
+	setConfig(cfg)
+	updateSPNMenu()
+}
+
+// clickSPN selects the SPN entry called name, as its menu item does
+func (h *headlessTray) clickSPN(name string) {
+	h.t.Helper()
+	stateMutex.RLock()
+	entries := spnEntries
+	stateMutex.RUnlock()
+	for i, entry := range entries {
+		if entry.Name == name {
+			handleSPNClick(i)
+			return
+		}
+	}
+	h.t.Fatalf("no SPN entry %q in the menu", name)
+}
+
+// token returns the current token, decoded
+func (h *headlessTray) token() string {
+	h.t.Helper()
+	stateMutex.RLock()
+	encoded := lastToken.String()
+	stateMutex.RUnlock()
+	if encoded == "" {
+		return ""
+	}
+	token, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		h.t.Fatalf("token isn't base64: %v", err)
+	}
+	return string(token)
+}
+
+// runScript saves source as a script and runs it as "ktray ctl run-script" would
+func (h *headlessTray) runScript(name string, source string) (string, error) {
+	h.t.Helper()
+	if err := os.MkdirAll(ScriptsDir(), 0755); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ScriptsDir(), name), []byte(source), 0644); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := InitLuaEngine(); err != nil {
+		h.t.Fatal(err)
+	}
+	return ctlRunScript([]string{name})
+}
+
+func setSPNState(spn string, name string) {
+	stateMutex.Lock()
+	currentSPN = spn
+	currentSPNName = name
+	stateMutex.Unlock()
+}
+
+func mockTokenFor(spn string) func(string) bool {
+	return func(token string) bool {
+		return strings.HasPrefix(token, "mock:"+spn+":")
+	}
+}
+
+const harnessConfig = `{
+  "spns": [
+    {"name": "App", "spn": "HTTP/app.example.com"},
+    {"name": "Wiki", "spn": "HTTP/wiki.example.com"},
+    {"name": "Gone", "spn": "HTTP/gone.invalid"},
+    {"name": "Offline", "spn": "HTTP/app.kdc.unreachable"}
+  ]
+}`
+
+// TestHeadlessSelectSPN covers picking an SPN from the menu: a new ticket the first time,
+// the cached one when it's picked again, and a new one on Refresh
+func TestHeadlessSelectSPN(t *testing.T) {
+	h := newHeadlessTray(t, harnessConfig)
+
+	h.clickSPN("App")
+	first := h.token()
+	if !mockTokenFor("HTTP/app.example.com")(first) {
+		t.Fatalf("token after selecting App = %q", first)
+	}
+	if _, found := GetCache().GetToken("HTTP/app.example.com"); !found {
+		t.Error("token wasn't cached")
+	}
+
+	h.clickSPN("Wiki")
+	if got := h.token(); !mockTokenFor("HTTP/wiki.example.com")(got) {
+		t.Fatalf("token after selecting Wiki = %q", got)
+	}
+
+	h.clickSPN("App")
+	if got := h.token(); got != first {
+		t.Errorf("selecting App again gave %q, want the cached %q", got, first)
+	}
+	if status, _ := ctlStatus(nil); !strings.Contains(status, "HTTP/app.example.com") {
+		t.Errorf("status = %q", status)
+	}
+
+	if _, err := ctlRefresh(nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := h.token(); got == first || !mockTokenFor("HTTP/app.example.com")(got) {
+		t.Errorf("token after refresh = %q, want a new one", got)
+	}
+}
+
+// TestHeadlessTicketErrors checks that failed requests leave no token and are classified
+// for the CLI exit codes and the hints
+func TestHeadlessTicketErrors(t *testing.T) {
+	h := newHeadlessTray(t, harnessConfig)
+
+	tests := []struct {
+		name  string
+		spn   string
+		class string
+		kind  error
+	}{
+		{"Gone", "HTTP/gone.invalid", ticketErrBadSPN, krb.ErrBadSPN},
+		{"Offline", "HTTP/app.kdc.unreachable", ticketErrKDCUnreachable, krb.ErrKDCUnreachable},
+	}
+	for _, tt := range tests {
+		h.clickSPN(tt.name)
+		if got := h.token(); got != "" {
+			t.Errorf("%s: token %q after a failed request", tt.name, got)
+		}
+		if _, err := ctlRefresh(nil); err == nil {
+			t.Errorf("%s: refresh succeeded", tt.name)
+		}
+		_, err := getServiceTicket(tt.spn)
+		if got := classifyTicketError(err); got != tt.class {
+			t.Errorf("%s: error class %q, want %q (%v)", tt.name, got, tt.class, err)
+		}
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s: %v is not %v", tt.name, err, tt.kind)
+		}
+	}
+
+	if _, err := getServiceTicket("not-an-spn"); classifyTicketError(err) != ticketErrBadSPN {
+		t.Errorf("malformed SPN: %v", err)
+	}
+
+	// Errors only recognized by their message get the kind too
+	err := asTicketError(errors.New("failed to initialize security context: KRB_AP_ERR_SKEW: clock skew too great"))
+	if !errors.Is(err, krb.ErrClockSkew) {
+		t.Errorf("clock skew: %v is not %v", err, krb.ErrClockSkew)
+	}
+	if got, want := describeTicketError(err), "Clock skew: sync the system clock with the domain"; got != want {
+		t.Errorf("status %q, want %q", got, want)
+	}
+}
+
+// TestHeadlessLuaBindings runs a script that gets a token and uses the cache
+func TestHeadlessLuaBindings(t *testing.T) {
+	h := newHeadlessTray(t, harnessConfig)
+
+	result, err := h.runScript("token.lua", `
+local token, err = ktray.get_token("Wiki")
+if not token then error(err) end
+ktray.cache_set("wiki_token", token, 60)
+local cached = ktray.cache_get("wiki_token")
+local _, missing = ktray.get_token("Nope")
+result = ktray.base64_decode(cached) .. "|" .. missing
+`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	token, missing, _ := strings.Cut(result, "|")
+	if !mockTokenFor("HTTP/wiki.example.com")(token) {
+		t.Errorf("script token = %q", token)
+	}
+	if missing != "SPN not found: Nope" {
+		t.Errorf("unknown SPN error = %q", missing)
+	}
+
+	// The script's token came through the token cache, so the menu reuses it
+	h.clickSPN("Wiki")
+	if got := h.token(); got != token {
+		t.Errorf("menu token %q, want the one the script cached %q", got, token)
+	}
+	if value, found := GetCache().Get("wiki_token"); !found || value == "" {
+		t.Error("cache_set value missing")
+	}
+}
+
+// TestHeadlessCacheNamespaces checks that cached tokens are kept apart per principal and
+// profile
+func TestHeadlessCacheNamespaces(t *testing.T) {
+	h := newHeadlessTray(t, `{"ccache": "MOCK:alice@MOCK.TEST", "spns": [{"name": "App", "spn": "HTTP/app.example.com"}]}`)
+	const spn = "HTTP/app.example.com"
+
+	alice, err := getCachedServiceToken(currentConfig(), spn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := getCachedServiceToken(currentConfig(), spn, false); again != alice {
+		t.Errorf("second request wasn't served from the cache")
+	}
+	if fresh, _ := getCachedServiceToken(currentConfig(), spn, true); fresh == alice {
+		t.Errorf("fresh request was served from the cache")
+	}
+	alice, _ = getCachedServiceToken(currentConfig(), spn, false)
+
+	h.setConfig(`{"ccache": "MOCK:bob@MOCK.TEST"}`)
+	bob, err := getCachedServiceToken(currentConfig(), spn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob == alice {
+		t.Error("bob was given alice's cached token")
+	}
+	if got := GetCache().NamespaceName(); got != "default / bob@MOCK.TEST" {
+		t.Errorf("namespace = %q", got)
+	}
+
+	h.setConfig(`{"ccache": "MOCK:alice@MOCK.TEST", "profile": "staging"}`)
+	if staging, _ := getCachedServiceToken(currentConfig(), spn, false); staging == alice {
+		t.Error("the staging profile was given the default profile's token")
+	}
+
+	h.setConfig(`{"ccache": "MOCK:alice@MOCK.TEST"}`)
+	if got, _ := getCachedServiceToken(currentConfig(), spn, false); got != alice {
+		t.Errorf("alice's cached token is gone after switching back: %q", got)
+	}
+}
+
+// TestHeadlessOffline takes the KDC away: the cached token keeps being served, and the
+// probe brings the tray back online with a new one
+func TestHeadlessOffline(t *testing.T) {
+	h := newHeadlessTray(t, `{"offline": {"probe_sec": 1}, "spns": [{"name": "App", "spn": "HTTP/app.example.com"}]}`)
+	const spn = "HTTP/app.example.com"
+
+	h.clickSPN("App")
+	first := h.token()
+
+	krb.MockKDCDown.Store(true)
+	if _, err := ctlRefresh(nil); err == nil {
+		t.Error("refresh succeeded without a KDC")
+	}
+	if !trayOffline() {
+		t.Fatal("not offline after the KDC didn't answer")
+	}
+	if got := h.token(); got != first {
+		t.Errorf("token %q while offline, want the cached %q", got, first)
+	}
+	if token, err := getCachedServiceToken(currentConfig(), spn, true); err != nil || token == "" {
+		t.Errorf("fresh request while offline = %q, %v; want the cached token", token, err)
+	}
+	if status, _ := ctlStatus(nil); !strings.Contains(status, "offline since") {
+		t.Errorf("status = %q", status)
+	}
+
+	krb.MockKDCDown.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for trayOffline() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if trayOffline() {
+		t.Fatal("still offline after the KDC came back")
+	}
+	for h.token() == first && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := h.token(); got == first || !mockTokenFor(spn)(got) {
+		t.Errorf("token after going back online = %q, want a new one", got)
+	}
+}
+
+// TestHeadlessConcurrentTickets requests the same SPN from the menu and from scripts at
+// once: they share one KDC request, and whoever comes later is served from the cache
+func TestHeadlessConcurrentTickets(t *testing.T) {
+	h := newHeadlessTray(t, `{"spns": [{"name": "App", "spn": "HTTP/app.example.com"}]}`)
+	const spn = "HTTP/app.example.com"
+	krb.MockDelay.Store(int64(200 * time.Millisecond))
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 4)
+	wg.Add(len(tokens) + 1)
+	go func() {
+		defer wg.Done()
+		h.clickSPN("App")
+	}()
+	for i := range tokens {
+		go func(i int) {
+			defer wg.Done()
+			encoded, err := getCachedServiceToken(currentConfig(), spn, false)
+			if err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+			raw, _ := base64.StdEncoding.DecodeString(encoded)
+			tokens[i] = string(raw)
+		}(i)
+	}
+	wg.Wait()
+
+	want := h.token()
+	if !mockTokenFor(spn)(want) {
+		t.Fatalf("menu token %q", want)
+	}
+	for i, got := range tokens {
+		if got != want {
+			t.Errorf("request %d got %q, the menu %q: the KDC was asked more than once", i, got, want)
+		}
+	}
+}
+
+// TestHeadlessTicketTimeout gives up on a KDC slower than kdc_timeout_sec, which takes the
+// tray offline, and cancels a request in flight
+func TestHeadlessTicketTimeout(t *testing.T) {
+	newHeadlessTray(t, `{"spns": [{"name": "App", "spn": "HTTP/app.example.com"}], "kdc_timeout_sec": 1}`)
+	const spn = "HTTP/app.example.com"
+	krb.MockDelay.Store(int64(1500 * time.Millisecond))
+
+	start := time.Now()
+	if _, err := getServiceTicket(spn); !errors.Is(err, errTicketTimeout) {
+		t.Fatalf("slow KDC: %v, want a timeout", err)
+	}
+	if waited := time.Since(start); waited > 1400*time.Millisecond {
+		t.Errorf("waited %s for a 1s timeout", waited)
+	}
+	if !trayOffline() {
+		t.Error("a timeout should take the tray offline")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := getServiceTicket(spn)
+		done <- err
+	}()
+	for cancelTicketRequests() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-done; !errors.Is(err, errTicketCancelled) {
+		t.Errorf("cancelled request: %v", err)
+	}
+}
+
+// TestHeadlessTokenCountdown covers the countdown of the selected SPN's token and its
+// refresh once it is expiring
+func TestHeadlessTokenCountdown(t *testing.T) {
+	h := newHeadlessTray(t, harnessConfig)
+	if got := tokenCountdown(currentConfig()); got != "" {
+		t.Errorf("countdown without a token = %q", got)
+	}
+	h.clickSPN("App")
+	if got := tokenCountdown(currentConfig()); !strings.HasPrefix(got, "App – ") || !strings.HasSuffix(got, " left") {
+		t.Errorf("countdown = %q", got)
+	}
+	if autoRefreshExpiringToken(currentConfig()) {
+		t.Error("refreshed a token that isn't expiring or with auto_refresh off")
+	}
+
+	// A token requested nine and a half minutes ago, no longer cached, has 30s left
+	h.setConfig(`{"spns": [{"name": "App", "spn": "HTTP/app.example.com"}], "status": {"expiring_min": 1, "auto_refresh": true}}`)
+	GetCache().DeleteToken("HTTP/app.example.com")
+	stateMutex.Lock()
+	lastTokenTime = time.Now().Add(-cache.DefaultTokenExpiration + 30*time.Second)
+	stateMutex.Unlock()
+	if got := tokenCountdown(currentConfig()); !strings.HasPrefix(got, "App – expiring in ") {
+		t.Errorf("countdown within expiring_min = %q", got)
+	}
+	first := h.token()
+	if !autoRefreshExpiringToken(currentConfig()) {
+		t.Fatal("expiring token wasn't refreshed")
+	}
+	if got := h.token(); got == first || !mockTokenFor("HTTP/app.example.com")(got) {
+		t.Errorf("token after auto-refresh = %q, want a new one", got)
+	}
+	if autoRefreshExpiringToken(currentConfig()) {
+		t.Error("refreshed the new token, which isn't expiring")
+	}
+}
+
+// TestHeadlessTokenTTL checks that tokens are cached for cache.token_ttl_sec, or their spns
+// entry's token_ttl_sec
+func TestHeadlessTokenTTL(t *testing.T) {
+	h := newHeadlessTray(t, `{"spns": [
+    {"name": "App", "spn": "HTTP/app.example.com"},
+    {"name": "Wiki", "spn": "HTTP/wiki.example.com", "token_ttl_sec": 3600}
+  ], "cache": {"token_ttl_sec": 300, "jwt_ttl_sec": 120}}`)
+	for _, c := range []struct {
+		name string
+		spn  string
+		ttl  time.Duration
+	}{
+		{"App", "HTTP/app.example.com", 5 * time.Minute},
+		{"Wiki", "HTTP/wiki.example.com", time.Hour},
+	} {
+		h.clickSPN(c.name)
+		expires, found := GetCache().TokenExpiry(c.spn)
+		if !found {
+			t.Fatalf("%s: no cached token", c.name)
+		}
+		if left := time.Until(expires); left > c.ttl || left < c.ttl-time.Minute {
+			t.Errorf("%s: token cached for %s, want %s", c.name, left.Round(time.Second), c.ttl)
+		}
+		if life, _ := currentTokenLife(); !life.expires.Equal(expires) {
+			t.Errorf("%s: token life ends %s, want %s", c.name, life.expires, expires)
+		}
+	}
+	if got := currentConfig().GetJWTTTL(); got != 2*time.Minute {
+		t.Errorf("JWT TTL = %s", got)
+	}
+	if got := currentConfig().GetSecretTTL(); got != cache.DefaultSecretExpiration {
+		t.Errorf("secret TTL = %s, want the default", got)
+	}
+}
+
+// ccacheRecorder is a transport that calls record for each ticket requested from it
+type ccacheRecorder struct {
+	krb.Transport
+	record func()
+}
+
+func (r ccacheRecorder) GetServiceTicket(spn string) ([]byte, error) {
+	r.record()
+	return r.Transport.GetServiceTicket(spn)
+}
+
+// TestHeadlessSPNCCache checks that tickets for an SPN with its own ccache are requested
+// from that cache, and all others from the top-level one
+func TestHeadlessSPNCCache(t *testing.T) {
+	var used []string
+	krb.RegisterTransport("recording", func(opts krb.Options) krb.Transport {
+		ccache := opts.CCache
+		opts.Transport = krb.TransportMock
+		transport, err := krb.Open(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ccacheRecorder{transport, func() { used = append(used, ccache) }}
+	})
+	h := newHeadlessTray(t, `{"transport": "recording", "ccache": "MOCK:user@MOCK.TEST", "spns": [
+    {"name": "App", "spn": "HTTP/app.example.com"},
+    {"name": "Partner", "spn": "HTTP/app.partner.test", "ccache": "MOCK:user@PARTNER.TEST"}
+  ]}`)
+	h.clickSPN("App")
+	h.clickSPN("Partner")
+	want := []string{"MOCK:user@MOCK.TEST", "MOCK:user@PARTNER.TEST"}
+	if strings.Join(used, " ") != strings.Join(want, " ") {
+		t.Errorf("ccaches used = %q, want %q", used, want)
+	}
+}
+
+// cachedMockToken returns the cached token of spn, decoded
+func cachedMockToken(t *testing.T, spn string) string {
+	t.Helper()
+	encoded, found := GetCache().GetToken(spn)
+	if !found {
+		t.Fatalf("no cached token for %s", spn)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(encoded)
+	return string(raw)
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.design/x/hotkey"
@@ -13,6 +16,7 @@ var (
 	snippetHotkeys [10]*hotkey.Hotkey // Cmd+Option+0 through Cmd+Option+9
 	urlHotkeys     [10]*hotkey.Hotkey // Ctrl+Cmd+0 through Ctrl+Cmd+9
 	sshHotkeys     [10]*hotkey.Hotkey // Ctrl+Option+0 through Ctrl+Option+9
+	hotkeysMutex   sync.RWMutex       // Guards the hotkey arrays, read by the menus for their hints
 
 	snippetInput   string      // Accumulated digit input (e.g., "1", "15")
 	snippetTimeout *time.Timer // Timeout for multi-digit input
@@ -26,15 +30,13 @@ var (
 	inputTimeout = 400 * time.Millisecond // Reduced for faster response
 )
 
-// InitHotkeys initializes global hotkey support
-// Called from onReady after systray is initialized
-func InitHotkeys() {
-	go initHotkeysAsync()
-}
-
-func initHotkeysAsync() {
+// initHotkeys registers the global hotkeys
+// Called from finishStartup after systray is initialized
+func initHotkeys() {
 	// Small delay to ensure systray is fully initialized
 	time.Sleep(500 * time.Millisecond)
+	begin := time.Now()
+	defer func() { startup.record("hotkeys", time.Since(begin)) }()
 
 	keys := []hotkey.Key{
 		hotkey.Key0, hotkey.Key1, hotkey.Key2, hotkey.Key3, hotkey.Key4,
@@ -50,7 +52,9 @@ func initHotkeysAsync() {
 			LogDebug("Failed to register hotkey %s+%d: %v", snippetDesc, i, err)
 			continue
 		}
+		hotkeysMutex.Lock()
 		snippetHotkeys[i] = hk
+		hotkeysMutex.Unlock()
 		snippetCount++
 
 		// Start listener for this hotkey
@@ -70,7 +74,9 @@ func initHotkeysAsync() {
 			LogDebug("Failed to register hotkey %s+%d: %v", urlDesc, i, err)
 			continue
 		}
+		hotkeysMutex.Lock()
 		urlHotkeys[i] = hk
+		hotkeysMutex.Unlock()
 		urlCount++
 
 		// Start listener for this hotkey
@@ -90,7 +96,9 @@ func initHotkeysAsync() {
 			LogDebug("Failed to register hotkey %s+%d: %v", sshDesc, i, err)
 			continue
 		}
+		hotkeysMutex.Lock()
 		sshHotkeys[i] = hk
+		hotkeysMutex.Unlock()
 		sshCount++
 
 		// Start listener for this hotkey
@@ -102,16 +110,65 @@ func initHotkeysAsync() {
 	}
 
 	if snippetCount > 0 || urlCount > 0 || sshCount > 0 {
-		mStatus.SetTitle(fmt.Sprintf("Hotkeys: %s (snippets), %s (URLs), %s (SSH)", snippetDesc, urlDesc, sshDesc))
+		setStatus(fmt.Sprintf("Hotkeys: %s (snippets), %s (URLs), %s (SSH)", snippetDesc, urlDesc, sshDesc))
 	}
 
 	LogDebug("Registered %d snippet hotkeys (%s+[0-9])", snippetCount, snippetDesc)
 	LogDebug("Registered %d URL hotkeys (%s+[0-9])", urlCount, urlDesc)
 	LogDebug("Registered %d SSH hotkeys (%s+[0-9])", sshCount, sshDesc)
+
+	applyQuickPickConfig(currentConfig().GetHotkeyConfigWithDefaults())
+
+	// The menus were built before the hotkeys, without their shortcuts
+	updateSnippetsMenu()
+	updateURLsMenu()
+	updateSSHMenu()
+}
+
+// hotkeyHint is the shortcut that reaches the entry with index, like "Cmd+Option+3" (or
+// "Cmd+Option+1 2" for 12, the digits pressed in turn), or "" if the hotkey of one of its
+// digits isn't registered
+func hotkeyHint(hotkeys *[10]*hotkey.Hotkey, desc string, index int) string {
+	if index < 0 {
+		return ""
+	}
+	digits := strconv.Itoa(index)
+
+	hotkeysMutex.RLock()
+	defer hotkeysMutex.RUnlock()
+	for _, d := range digits {
+		if hotkeys[d-'0'] == nil {
+			return ""
+		}
+	}
+	hint := desc + "+" + digits[:1]
+	if len(digits) > 1 {
+		hint += " " + strings.Join(strings.Split(digits[1:], ""), " ")
+	}
+	return hint
+}
+
+// snippetMenuTitle, urlMenuTitle and sshMenuTitle are the menu titles of entries, with the
+// hotkey that reaches them
+func snippetMenuTitle(entry SnippetEntry) string {
+	_, desc := getSnippetHotkeyModifiers()
+	return menuTitleWithShortcut(fmt.Sprintf("[%d] %s", entry.Index, entry.Name), hotkeyHint(&snippetHotkeys, desc, entry.Index))
+}
+
+func urlMenuTitle(entry URLEntry) string {
+	_, desc := getURLHotkeyModifiers()
+	return menuTitleWithShortcut(fmt.Sprintf("[%d] %s", entry.Index, entry.Name), hotkeyHint(&urlHotkeys, desc, entry.Index))
+}
+
+func sshMenuTitle(entry SSHEntry) string {
+	_, desc := getSSHHotkeyModifiers()
+	return menuTitleWithShortcut(fmt.Sprintf("[%d] %s", entry.Index, entry.Name), hotkeyHint(&sshHotkeys, desc, entry.Index))
 }
 
 // handleSnippetDigit handles Cmd+Option+N presses and accumulates digits
 func handleSnippetDigit(num int) {
+	noteUserActivity()
+
 	stateMutex.Lock()
 	wasEmpty := snippetInput == ""
 	snippetInput += fmt.Sprintf("%d", num)
@@ -128,7 +185,7 @@ func handleSnippetDigit(num int) {
 	}
 
 	// Update status to show current input
-	mStatus.SetTitle(fmt.Sprintf("Snippet #%s...", currentInput))
+	setStatus(fmt.Sprintf("Snippet #%s...", currentInput))
 
 	// Reset/start timeout - after timeout, select the snippet
 	if snippetTimeout != nil {
@@ -150,7 +207,7 @@ func finalizeSnippetSelection() {
 
 func selectSnippetByInput(input string) {
 	if input == "" {
-		mStatus.SetTitle("No snippet number entered")
+		setStatus("No snippet number entered")
 		return
 	}
 
@@ -163,30 +220,33 @@ func selectSnippetByInput(input string) {
 
 func copySnippetByIndex(num int) {
 	// Find snippet with matching index
-	if appConfig == nil || len(appConfig.Snippets) == 0 {
-		mStatus.SetTitle("No snippets configured")
+	cfg := currentConfig()
+	if cfg == nil || len(cfg.Snippets) == 0 {
+		setStatus("No snippets configured")
 		return
 	}
 
-	for _, snippet := range appConfig.Snippets {
+	for _, snippet := range cfg.Snippets {
 		if snippet.Index == num {
 			executeSnippetEntry(snippet, true) // Hotkey: copy and paste
 			return
 		}
 	}
 
-	mStatus.SetTitle(fmt.Sprintf("No snippet with index %d", num))
+	setStatus(fmt.Sprintf("No snippet with index %d", num))
 }
 
 // handleURLDigit handles Ctrl+Cmd+N presses and accumulates digits
 func handleURLDigit(num int) {
+	noteUserActivity()
+
 	stateMutex.Lock()
 	urlInput += fmt.Sprintf("%d", num)
 	currentInput := urlInput
 	stateMutex.Unlock()
 
 	// Update status to show current input
-	mStatus.SetTitle(fmt.Sprintf("URL #%s...", currentInput))
+	setStatus(fmt.Sprintf("URL #%s...", currentInput))
 
 	// Reset/start timeout - after 1 second of no more digits, open the URL
 	if urlTimeout != nil {
@@ -208,7 +268,7 @@ func finalizeURLSelection() {
 
 func selectURLByInput(input string) {
 	if input == "" {
-		mStatus.SetTitle("No URL number entered")
+		setStatus("No URL number entered")
 		return
 	}
 
@@ -221,30 +281,33 @@ func selectURLByInput(input string) {
 
 func openURLByIndex(num int) {
 	// Find URL with matching index
-	if appConfig == nil || len(appConfig.URLs) == 0 {
-		mStatus.SetTitle("No URLs configured")
+	cfg := currentConfig()
+	if cfg == nil || len(cfg.URLs) == 0 {
+		setStatus("No URLs configured")
 		return
 	}
 
-	for _, url := range appConfig.URLs {
+	for _, url := range cfg.URLs {
 		if url.Index == num {
-			executeURLEntry(url)
+			executeURLEntry(url, requesterHotkey)
 			return
 		}
 	}
 
-	mStatus.SetTitle(fmt.Sprintf("No URL with index %d", num))
+	setStatus(fmt.Sprintf("No URL with index %d", num))
 }
 
 // handleSSHDigit handles Ctrl+Option+N presses and accumulates digits
 func handleSSHDigit(num int) {
+	noteUserActivity()
+
 	stateMutex.Lock()
 	sshInput += fmt.Sprintf("%d", num)
 	currentInput := sshInput
 	stateMutex.Unlock()
 
 	// Update status to show current input
-	mStatus.SetTitle(fmt.Sprintf("SSH #%s...", currentInput))
+	setStatus(fmt.Sprintf("SSH #%s...", currentInput))
 
 	// Reset/start timeout - after 1 second of no more digits, open SSH
 	if sshTimeout != nil {
@@ -266,7 +329,7 @@ func finalizeSSHSelection() {
 
 func selectSSHByInput(input string) {
 	if input == "" {
-		mStatus.SetTitle("No SSH number entered")
+		setStatus("No SSH number entered")
 		return
 	}
 
@@ -279,27 +342,29 @@ func selectSSHByInput(input string) {
 
 func openSSHByIndex(num int) {
 	// Find SSH with matching index
-	if appConfig == nil || len(appConfig.SSH) == 0 {
-		mStatus.SetTitle("No SSH connections configured")
+	cfg := currentConfig()
+	if cfg == nil || len(cfg.SSH) == 0 {
+		setStatus("No SSH connections configured")
 		return
 	}
 
-	for _, ssh := range appConfig.SSH {
+	for _, ssh := range cfg.SSH {
 		if ssh.Index == num {
 			executeSSHEntry(ssh)
 			return
 		}
 	}
 
-	mStatus.SetTitle(fmt.Sprintf("No SSH with index %d", num))
+	setStatus(fmt.Sprintf("No SSH with index %d", num))
 }
 
 // hasMultiDigitSnippets checks if any snippets have index >= 10
 func hasMultiDigitSnippets() bool {
-	if appConfig == nil {
+	cfg := currentConfig()
+	if cfg == nil {
 		return false
 	}
-	for _, snippet := range appConfig.Snippets {
+	for _, snippet := range cfg.Snippets {
 		if snippet.Index >= 10 {
 			return true
 		}
@@ -324,4 +389,5 @@ func CleanupHotkeys() {
 			hk.Unregister()
 		}
 	}
+	applyQuickPickConfig(HotkeyConfig{})
 }
@@ -20,4 +20,14 @@ func getURLHotkeyModifiers() ([]hotkey.Modifier, string) {
 // macOS: Control+Option+[0-9]
 func getSSHHotkeyModifiers() ([]hotkey.Modifier, string) {
 	return []hotkey.Modifier{hotkey.ModCtrl, hotkey.ModOption}, "Ctrl+Option"
-}
\ No newline at end of file
+}
+
+// menuTitleWithShortcut adds the shortcut to a menu title. systray has no key equivalents
+// for NSMenuItem, and global hotkeys aren't menu key equivalents anyway, so it is shown
+// after the title.
+func menuTitleWithShortcut(title, shortcut string) string {
+	if shortcut == "" {
+		return title
+	}
+	return title + "    " + shortcut
+}
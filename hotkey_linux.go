@@ -20,4 +20,13 @@ func getURLHotkeyModifiers() ([]hotkey.Modifier, string) {
 // Linux: Alt+Shift+[0-9] (Mod1 is typically Alt on X11)
 func getSSHHotkeyModifiers() ([]hotkey.Modifier, string) {
 	return []hotkey.Modifier{hotkey.Mod1, hotkey.ModShift}, "Alt+Shift"
-}
\ No newline at end of file
+}
+
+// menuTitleWithShortcut adds the shortcut to a menu title. The app indicator menu has no
+// accelerator column (systray doesn't expose one), so it is shown after the title.
+func menuTitleWithShortcut(title, shortcut string) string {
+	if shortcut == "" {
+		return title
+	}
+	return title + "    " + shortcut
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"golang.design/x/hotkey"
+)
+
+func TestHotkeyHint(t *testing.T) {
+	var hotkeys [10]*hotkey.Hotkey
+	for _, d := range []int{1, 2, 5} {
+		hotkeys[d] = &hotkey.Hotkey{}
+	}
+	for index, want := range map[int]string{
+		5:   "Mods+5",
+		12:  "Mods+1 2",
+		121: "Mods+1 2 1",
+		3:   "", // Not registered
+		13:  "",
+		-1:  "",
+	} {
+		if got := hotkeyHint(&hotkeys, "Mods", index); got != want {
+			t.Errorf("hotkeyHint(%d) = %q, want %q", index, got, want)
+		}
+	}
+	if got := menuTitleWithShortcut("[5] Name", ""); got != "[5] Name" {
+		t.Errorf("title without a shortcut = %q", got)
+	}
+}
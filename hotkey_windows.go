@@ -20,4 +20,13 @@ func getURLHotkeyModifiers() ([]hotkey.Modifier, string) {
 // Windows: Alt+Shift+[0-9]
 func getSSHHotkeyModifiers() ([]hotkey.Modifier, string) {
 	return []hotkey.Modifier{hotkey.ModAlt, hotkey.ModShift}, "Alt+Shift"
-}
\ No newline at end of file
+}
+
+// menuTitleWithShortcut adds the shortcut to a menu title. Windows menus right-align the
+// text after a tab in the accelerator column, as for Ctrl+C in an Edit menu.
+func menuTitleWithShortcut(title, shortcut string) string {
+	if shortcut == "" {
+		return title
+	}
+	return title + "\t" + shortcut
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
@@ -10,16 +11,20 @@ import (
 	"time"
 
 	"golang.org/x/net/publicsuffix"
+
+	"krb5tray/internal/httpclient"
 )
 
-// DefaultHTTPTimeout is the default timeout for HTTP requests (30 seconds)
-const DefaultHTTPTimeout = 30 * time.Second
+// errInsecureTLSForbidden is returned for requests that would skip certificate verification
+// while the policy forbids it
+var errInsecureTLSForbidden = errors.New("skip_verify is not allowed by policy (allow_insecure_tls is false)")
 
-// insecureClient is an HTTP client that skips TLS certificate verification
-var insecureClient = &http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	},
+// checkTLSPolicy returns errInsecureTLSForbidden if skipVerify is set and not allowed
+func checkTLSPolicy(skipVerify bool) error {
+	if skipVerify && !currentConfig().InsecureTLSAllowed() {
+		return errInsecureTLSForbidden
+	}
+	return nil
 }
 
 // HTTPSession maintains cookies across multiple HTTP requests
@@ -27,10 +32,15 @@ type HTTPSession struct {
 	jar        *cookiejar.Jar
 	client     *http.Client
 	skipVerify bool
+	span       *Span  // Parent span for requests (the script run), nil when tracing is off
+	source     string // What the requests are made for (the script), shown by View Response
 }
 
 // NewHTTPSession creates a new HTTP session with cookie jar support
 func NewHTTPSession(skipVerify bool) (*HTTPSession, error) {
+	if err := checkTLSPolicy(skipVerify); err != nil {
+		return nil, err
+	}
 	jar, err := cookiejar.New(&cookiejar.Options{
 		PublicSuffixList: publicsuffix.List,
 	})
@@ -38,16 +48,10 @@ func NewHTTPSession(skipVerify bool) (*HTTPSession, error) {
 		return nil, err
 	}
 
-	transport := http.DefaultTransport
-	if skipVerify {
-		transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-	}
-
+	// The jar is per session; connections come from the shared transport
 	client := &http.Client{
 		Jar:       jar,
-		Transport: transport,
+		Transport: httpclient.Client(skipVerify).Transport,
 	}
 
 	return &HTTPSession{
@@ -60,7 +64,7 @@ func NewHTTPSession(skipVerify bool) (*HTTPSession, error) {
 // Get performs an HTTP GET request using the session's cookie jar
 func (s *HTTPSession) Get(url string, headers map[string]string, timeout time.Duration) (string, error) {
 	if timeout <= 0 {
-		timeout = DefaultHTTPTimeout
+		timeout = httpclient.DefaultTimeout
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -75,24 +79,13 @@ func (s *HTTPSession) Get(url string, headers map[string]string, timeout time.Du
 		req.Header.Set(k, v)
 	}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(body), nil
+	return doTracedRequest(s.client, req, s.span, s.source)
 }
 
 // Post performs an HTTP POST request using the session's cookie jar
 func (s *HTTPSession) Post(url string, body string, headers map[string]string, timeout time.Duration) (string, error) {
 	if timeout <= 0 {
-		timeout = DefaultHTTPTimeout
+		timeout = httpclient.DefaultTimeout
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -110,24 +103,16 @@ func (s *HTTPSession) Post(url string, body string, headers map[string]string, t
 		req.Header.Set(k, v)
 	}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(respBody), nil
+	return doTracedRequest(s.client, req, s.span, s.source)
 }
 
 // httpGet performs an HTTP GET request with optional headers, timeout, and skip_verify
 func httpGet(url string, headers map[string]string, timeout time.Duration, skipVerify bool) (string, error) {
+	if err := checkTLSPolicy(skipVerify); err != nil {
+		return "", err
+	}
 	if timeout <= 0 {
-		timeout = DefaultHTTPTimeout
+		timeout = httpclient.DefaultTimeout
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -142,29 +127,16 @@ func httpGet(url string, headers map[string]string, timeout time.Duration, skipV
 		req.Header.Set(k, v)
 	}
 
-	client := http.DefaultClient
-	if skipVerify {
-		client = insecureClient
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(body), nil
+	return doTracedRequest(httpclient.Client(skipVerify), req, nil, "")
 }
 
 // httpPost performs an HTTP POST request with body, optional headers, timeout, and skip_verify
 func httpPost(url string, body string, headers map[string]string, timeout time.Duration, skipVerify bool) (string, error) {
+	if err := checkTLSPolicy(skipVerify); err != nil {
+		return "", err
+	}
 	if timeout <= 0 {
-		timeout = DefaultHTTPTimeout
+		timeout = httpclient.DefaultTimeout
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -182,21 +154,40 @@ func httpPost(url string, body string, headers map[string]string, timeout time.D
 		req.Header.Set(k, v)
 	}
 
-	client := http.DefaultClient
-	if skipVerify {
-		client = insecureClient
+	return doTracedRequest(httpclient.Client(skipVerify), req, nil, "")
+}
+
+// doTracedRequest sends the request and returns the response body, recording a client span
+// (and propagating it via traceparent) when tracing is enabled. The response is kept for
+// View Response.
+func doTracedRequest(client *http.Client, req *http.Request, parent *Span, source string) (string, error) {
+	span := StartClientSpan(req.Method, parent)
+	span.SetAttr("http.request.method", req.Method)
+	span.SetAttr("url.full", httpclient.RedactURL(req.URL))
+	span.SetAttr("server.address", req.URL.Hostname())
+	if span != nil && req.Header.Get("traceparent") == "" {
+		req.Header.Set("traceparent", span.TraceParent())
 	}
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		span.End(err)
 		return "", err
 	}
 	defer resp.Body.Close()
+	span.SetAttr("http.response.status_code", fmt.Sprintf("%d", resp.StatusCode))
 
-	respBody, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode >= 500 {
+		span.End(fmt.Errorf("HTTP %s", resp.Status))
+	} else {
+		span.End(err)
+	}
 	if err != nil {
 		return "", err
 	}
+	recordHTTPResponse(source, req, resp, body, time.Since(start))
 
-	return string(respBody), nil
-}
\ No newline at end of file
+	return string(body), nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// errIdleLocked is returned for tokens and secrets while the tray is idle-locked
+var errIdleLocked = errors.New("locked after being idle, click Unlock in the menu")
+
+// idleLock locks the tray when nobody has used it for a while, so a token or secret
+// can't be taken from an unattended desk. Locking wipes the cache, the current token,
+// and the clipboard history; no new tokens are requested until it's unlocked.
+var idleLock struct {
+	mu           sync.Mutex
+	cfg          IdleLockConfig
+	locked       bool
+	lastActivity time.Time
+	timer        *time.Timer
+}
+
+// mUnlock is shown at the top of the menu while the tray is idle-locked
+var mUnlock *systray.MenuItem
+
+// ApplyIdleLockConfig starts or stops watching for idle time to match cfg. Disabling
+// the lock also releases it.
+func ApplyIdleLockConfig(cfg IdleLockConfig) {
+	idleLock.mu.Lock()
+	idleLock.cfg = cfg
+	wasLocked := idleLock.locked
+	if !cfg.Enabled {
+		idleLock.locked = false
+		if idleLock.timer != nil {
+			idleLock.timer.Stop()
+		}
+		idleLock.mu.Unlock()
+		if wasLocked {
+			LogInfo("Idle lock disabled, unlocking")
+			updateUnlockMenu()
+		}
+		return
+	}
+
+	if !idleLock.locked {
+		idleLock.lastActivity = time.Now()
+		resetIdleTimerLocked()
+	}
+	idleLock.mu.Unlock()
+	LogDebug("Locking after %d minutes without interaction", cfg.IdleMin)
+}
+
+// noteUserActivity restarts the idle countdown; it's called for menu clicks and hotkeys
+func noteUserActivity() {
+	idleLock.mu.Lock()
+	defer idleLock.mu.Unlock()
+
+	if !idleLock.cfg.Enabled || idleLock.locked {
+		return
+	}
+	idleLock.lastActivity = time.Now()
+	resetIdleTimerLocked()
+}
+
+// trayIdleLocked reports whether the tray is locked until the user clicks Unlock
+func trayIdleLocked() bool {
+	idleLock.mu.Lock()
+	defer idleLock.mu.Unlock()
+	return idleLock.locked
+}
+
+// resetIdleTimerLocked starts the countdown again; idleLock.mu is held
+func resetIdleTimerLocked() {
+	d := time.Duration(idleLock.cfg.IdleMin) * time.Minute
+	if idleLock.timer == nil {
+		idleLock.timer = time.AfterFunc(d, onIdleTimer)
+	} else {
+		idleLock.timer.Stop()
+		idleLock.timer.Reset(d)
+	}
+}
+
+func onIdleTimer() {
+	idleLock.mu.Lock()
+	if !idleLock.cfg.Enabled || idleLock.locked {
+		idleLock.mu.Unlock()
+		return
+	}
+	// Activity may have been noted just as the timer fired
+	d := time.Duration(idleLock.cfg.IdleMin) * time.Minute
+	if remaining := d - time.Since(idleLock.lastActivity); remaining > 0 {
+		idleLock.timer.Reset(remaining)
+		idleLock.mu.Unlock()
+		return
+	}
+	idleMin := idleLock.cfg.IdleMin
+	idleLock.mu.Unlock()
+
+	lockTray(fmt.Sprintf("idle for %d min", idleMin))
+}
+
+// lockTray locks the tray and wipes what it holds: cached tokens, secrets and script
+// results, the current token, and the clipboard history
+func lockTray(why string) {
+	idleLock.mu.Lock()
+	if idleLock.locked {
+		idleLock.mu.Unlock()
+		return
+	}
+	idleLock.locked = true
+	if idleLock.timer != nil {
+		idleLock.timer.Stop()
+	}
+	idleLock.mu.Unlock()
+
+	GetCache().Clear()
+	setLastToken(nil, time.Time{})
+	GetClipboardHistory().Clear()
+	clearOnceLinks()
+	clearLastResponse()
+	forgetSecurityKeyTouch()
+	lockSecrets(why)
+
+	setTokenItemsEnabled(false)
+	updateCacheMenu()
+	updateHistoryMenu()
+	updateUnlockMenu()
+
+	LogAction("tray_locked", fmt.Sprintf("Tray locked (%s), cache and clipboard history wiped", why))
+	setStatus("Locked - click Unlock")
+}
+
+// unlockTray releases the idle lock, asking for the PIN or biometrics first if the config
+// requires it
+func unlockTray() error {
+	if !trayIdleLocked() {
+		return nil
+	}
+
+	cfg := currentConfig()
+	if cfg.GetIdleLockConfigWithDefaults().RequirePIN {
+		secretsLock.prompt.Lock()
+		err := authenticateUser(cfg.GetLockConfigWithDefaults(), "Unlock krb5tray", "Unlock krb5tray to use tokens and secrets again")
+		secretsLock.prompt.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	idleLock.mu.Lock()
+	idleLock.locked = false
+	idleLock.lastActivity = time.Now()
+	if idleLock.cfg.Enabled {
+		resetIdleTimerLocked()
+	}
+	idleLock.mu.Unlock()
+
+	updateUnlockMenu()
+	LogAction("tray_unlocked", "Tray unlocked")
+	return nil
+}
+
+// updateUnlockMenu shows the Unlock item while the tray is locked
+func updateUnlockMenu() {
+	if mUnlock == nil {
+		return
+	}
+	if trayIdleLocked() {
+		mUnlock.Show()
+	} else {
+		mUnlock.Hide()
+	}
+}
+
+func handleUnlockClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		if err := unlockTray(); err != nil {
+			setStatusError(fmt.Sprintf("Still locked: %s", truncateError(err)))
+			continue
+		}
+		setStatus("Unlocked")
+	}
+}
+
+func ctlLock(args []string) (string, error) {
+	if !currentConfig().GetIdleLockConfigWithDefaults().Enabled {
+		return "", fmt.Errorf("idle_lock is not enabled")
+	}
+	lockTray("locked with ctl")
+	return "Locked", nil
+}
@@ -0,0 +1,621 @@
+// Package cache holds the tray's tokens, JWTs, secrets and script values: go-cache with LRU
+// limits, a namespace per profile and principal, values in locked memory, and an optional
+// encrypted file that keeps all but the Kerberos tokens across restarts.
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Cache prefixes for different types of cached items
+const (
+	PrefixJWT    = "jwt:"
+	PrefixSecret = "secret:"
+	PrefixToken  = "token:"
+)
+
+// Default expiration times, see the token_ttl_sec, jwt_ttl_sec and secret_ttl_sec cache settings
+const (
+	DefaultJWTExpiration    = 5 * time.Minute
+	DefaultSecretExpiration = 30 * time.Minute
+	DefaultTokenExpiration  = 10 * time.Minute
+	CleanupInterval         = 1 * time.Minute
+	NoExpiration            = gocache.NoExpiration
+)
+
+// Default size limits
+const (
+	DefaultMaxEntries = 500
+	DefaultMaxSizeKB  = 4096
+)
+
+// Cache wraps go-cache with convenience methods for tokens and secrets.
+// It also tracks recency and approximate size per key to enforce LRU limits.
+type Cache struct {
+	c *gocache.Cache
+
+	mu         sync.Mutex
+	lru        *list.List               // Front = most recently used
+	lruIndex   map[string]*list.Element // Key -> element holding *lruItem
+	totalBytes int
+	maxEntries int // 0 = unlimited
+	maxBytes   int // 0 = unlimited
+
+	// Counters for tuning TTLs and limits, see Metrics
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	sets      atomic.Uint64
+	refreshes atomic.Uint64 // Sets that replaced an existing entry
+	evictions atomic.Uint64 // Entries removed to stay within limits
+
+	namespace string // Active key prefix, see namespacePrefix
+	profile   string
+	principal string
+
+	// persister is set once persistence is enabled; the tray does that in the background,
+	// while the cache may already be in use
+	persister atomic.Pointer[persister]
+}
+
+// Metrics is a snapshot of the cache counters
+type Metrics struct {
+	Hits      uint64
+	Misses    uint64
+	Sets      uint64
+	Refreshes uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int
+}
+
+// HitRate returns the fraction of lookups that were served from the cache (0 when unused)
+func (m Metrics) HitRate() float64 {
+	total := m.Hits + m.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(m.Hits) / float64(total)
+}
+
+// lruItem is the bookkeeping stored in the LRU list
+type lruItem struct {
+	key  string
+	size int
+}
+
+// CachedToken represents a cached Kerberos or JWT token
+type CachedToken struct {
+	Value     *LockedBuffer
+	ExpiresAt time.Time
+	SPN       string
+}
+
+// CachedSecret represents a cached secret
+type CachedSecret struct {
+	Value     *LockedBuffer
+	ExpiresAt time.Time
+	Metadata  map[string]string
+}
+
+// destroyCachedValue wipes the locked memory held by a cached token or secret
+func destroyCachedValue(v interface{}) {
+	switch v := v.(type) {
+	case *CachedToken:
+		v.Value.Destroy()
+	case *CachedSecret:
+		v.Value.Destroy()
+	}
+}
+
+// New returns an empty cache with the default limits, in the default profile's namespace
+func New() *Cache {
+	ac := &Cache{
+		c:          gocache.New(DefaultTokenExpiration, CleanupInterval),
+		lru:        list.New(),
+		lruIndex:   make(map[string]*list.Element),
+		maxEntries: DefaultMaxEntries,
+		maxBytes:   DefaultMaxSizeKB * 1024,
+		namespace:  namespacePrefix(DefaultProfile, ""),
+	}
+	// Keep LRU bookkeeping in sync with expirations and deletes done by go-cache
+	ac.c.OnEvicted(func(key string, value interface{}) {
+		ac.forget(key)
+		destroyCachedValue(value)
+	})
+	return ac
+}
+
+// SetLimits sets the maximum number of entries and total bytes (0 = unlimited),
+// evicting least recently used entries if the cache is already over the new limits
+func (ac *Cache) SetLimits(maxEntries int, maxBytes int) {
+	ac.mu.Lock()
+	ac.maxEntries = maxEntries
+	ac.maxBytes = maxBytes
+	victims := ac.collectVictimsLocked("")
+	ac.mu.Unlock()
+
+	ac.evict(victims)
+}
+
+// track records a write of key with the given approximate size and enforces limits
+func (ac *Cache) track(key string, size int) {
+	ac.mu.Lock()
+	ac.sets.Add(1)
+	if el, ok := ac.lruIndex[key]; ok {
+		ac.refreshes.Add(1)
+		item := el.Value.(*lruItem)
+		ac.totalBytes += size - item.size
+		item.size = size
+		ac.lru.MoveToFront(el)
+	} else {
+		ac.lruIndex[key] = ac.lru.PushFront(&lruItem{key: key, size: size})
+		ac.totalBytes += size
+	}
+	victims := ac.collectVictimsLocked(key)
+	ac.mu.Unlock()
+
+	ac.evict(victims)
+}
+
+// hit records a cache hit and marks key as recently used
+func (ac *Cache) hit(key string) {
+	ac.hits.Add(1)
+	ac.touch(key)
+}
+
+// miss records a cache miss
+func (ac *Cache) miss() {
+	ac.misses.Add(1)
+}
+
+// touch marks key as recently used
+func (ac *Cache) touch(key string) {
+	ac.mu.Lock()
+	if el, ok := ac.lruIndex[key]; ok {
+		ac.lru.MoveToFront(el)
+	}
+	ac.mu.Unlock()
+}
+
+// forget removes key from the LRU bookkeeping
+func (ac *Cache) forget(key string) {
+	ac.mu.Lock()
+	if el, ok := ac.lruIndex[key]; ok {
+		ac.totalBytes -= el.Value.(*lruItem).size
+		ac.lru.Remove(el)
+		delete(ac.lruIndex, key)
+	}
+	ac.mu.Unlock()
+}
+
+// collectVictimsLocked removes least recently used keys from the bookkeeping until
+// the cache fits its limits, never evicting keep (the entry just written).
+// Must be called with ac.mu held; the returned keys must then be passed to evict.
+func (ac *Cache) collectVictimsLocked(keep string) []string {
+	var victims []string
+	over := func() bool {
+		return (ac.maxEntries > 0 && ac.lru.Len() > ac.maxEntries) ||
+			(ac.maxBytes > 0 && ac.totalBytes > ac.maxBytes)
+	}
+	for el := ac.lru.Back(); el != nil && over(); {
+		prev := el.Prev()
+		item := el.Value.(*lruItem)
+		if item.key != keep {
+			ac.totalBytes -= item.size
+			ac.lru.Remove(el)
+			delete(ac.lruIndex, item.key)
+			victims = append(victims, item.key)
+		}
+		el = prev
+	}
+	return victims
+}
+
+// evict deletes the given keys from the underlying cache (called without ac.mu held,
+// since go-cache invokes the OnEvicted callback synchronously)
+func (ac *Cache) evict(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, key := range keys {
+		ac.c.Delete(key)
+		logger.Debugf("Cache evicted (LRU): %s", key)
+	}
+	ac.evictions.Add(uint64(len(keys)))
+	ac.schedulePersist()
+}
+
+// Usage returns the current number of entries and approximate size in bytes
+func (ac *Cache) Usage() (entries int, bytes int) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return ac.lru.Len(), ac.totalBytes
+}
+
+// UsageSummary returns a short human-readable description of cache usage and limits
+func (ac *Cache) UsageSummary() string {
+	entries, bytes := ac.Usage()
+	ac.mu.Lock()
+	maxEntries, maxBytes := ac.maxEntries, ac.maxBytes
+	ac.mu.Unlock()
+
+	entryLimit, byteLimit := "unlimited", "unlimited"
+	if maxEntries > 0 {
+		entryLimit = fmt.Sprintf("%d", maxEntries)
+	}
+	if maxBytes > 0 {
+		byteLimit = FormatBytes(maxBytes)
+	}
+	return fmt.Sprintf("%d/%s items, %s/%s", entries, entryLimit, FormatBytes(bytes), byteLimit)
+}
+
+// FormatBytes formats a byte count as B, KB, or MB
+func FormatBytes(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	}
+}
+
+// entrySize estimates the memory used by a cache entry
+func entrySize(key string, value string, metadata map[string]string) int {
+	size := len(key) + len(value)
+	for k, v := range metadata {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// SetJWT stores a JWT token with the given key and expiration
+func (ac *Cache) SetJWT(key string, token string, expiration time.Duration) {
+	k := ac.qualify(PrefixJWT + key)
+	ct := &CachedToken{
+		Value:     NewLockedBuffer(token),
+		ExpiresAt: time.Now().Add(expiration),
+	}
+	ac.store(k, ct, entrySize(k, token, nil), expiration)
+	ac.schedulePersist()
+}
+
+// GetJWT retrieves a JWT token by key
+func (ac *Cache) GetJWT(key string) (string, bool) {
+	k := ac.qualify(PrefixJWT + key)
+	if val, found := ac.c.Get(k); found {
+		if ct, ok := val.(*CachedToken); ok {
+			ac.hit(k)
+			return ct.Value.String(), true
+		}
+	}
+	ac.miss()
+	return "", false
+}
+
+// SetSecret stores a secret with the given key and expiration
+func (ac *Cache) SetSecret(key string, secret string, expiration time.Duration) {
+	k := ac.qualify(PrefixSecret + key)
+	cs := &CachedSecret{
+		Value:     NewLockedBuffer(secret),
+		ExpiresAt: time.Now().Add(expiration),
+		Metadata:  make(map[string]string),
+	}
+	ac.store(k, cs, entrySize(k, secret, nil), expiration)
+	ac.schedulePersist()
+}
+
+// SetSecretWithMetadata stores a secret with metadata
+func (ac *Cache) SetSecretWithMetadata(key string, secret string, metadata map[string]string, expiration time.Duration) {
+	k := ac.qualify(PrefixSecret + key)
+	cs := &CachedSecret{
+		Value:     NewLockedBuffer(secret),
+		ExpiresAt: time.Now().Add(expiration),
+		Metadata:  metadata,
+	}
+	ac.store(k, cs, entrySize(k, secret, metadata), expiration)
+	ac.schedulePersist()
+}
+
+// GetSecret retrieves a secret by key
+func (ac *Cache) GetSecret(key string) (string, bool) {
+	k := ac.qualify(PrefixSecret + key)
+	if val, found := ac.c.Get(k); found {
+		if cs, ok := val.(*CachedSecret); ok {
+			ac.hit(k)
+			return cs.Value.String(), true
+		}
+	}
+	ac.miss()
+	return "", false
+}
+
+// GetSecretWithMetadata retrieves a secret with its metadata
+func (ac *Cache) GetSecretWithMetadata(key string) (*CachedSecret, bool) {
+	k := ac.qualify(PrefixSecret + key)
+	if val, found := ac.c.Get(k); found {
+		if cs, ok := val.(*CachedSecret); ok {
+			ac.hit(k)
+			return cs, true
+		}
+	}
+	ac.miss()
+	return nil, false
+}
+
+// SetToken stores a Kerberos token for an SPN. The token is passed in locked memory so
+// it's never copied through a string; the cache takes ownership of buf and destroys it
+// when the entry goes away.
+func (ac *Cache) SetToken(spn string, buf *LockedBuffer, expiration time.Duration) {
+	k := ac.qualify(PrefixToken + spn)
+	ct := &CachedToken{
+		Value:     buf,
+		ExpiresAt: time.Now().Add(expiration),
+		SPN:       spn,
+	}
+	ac.store(k, ct, len(k)+buf.Len(), expiration)
+}
+
+// GetToken retrieves a cached Kerberos token for an SPN
+func (ac *Cache) GetToken(spn string) (string, bool) {
+	k := ac.qualify(PrefixToken + spn)
+	if val, found := ac.c.Get(k); found {
+		if ct, ok := val.(*CachedToken); ok {
+			ac.hit(k)
+			return ct.Value.String(), true
+		}
+	}
+	ac.miss()
+	return "", false
+}
+
+// GetTokenWithExpiry retrieves a cached token with its expiry time
+func (ac *Cache) GetTokenWithExpiry(spn string) (string, time.Time, bool) {
+	k := ac.qualify(PrefixToken + spn)
+	if val, found := ac.c.Get(k); found {
+		if ct, ok := val.(*CachedToken); ok {
+			ac.hit(k)
+			return ct.Value.String(), ct.ExpiresAt, true
+		}
+	}
+	ac.miss()
+	return "", time.Time{}, false
+}
+
+// TokenExpiry returns when the cached token for an SPN expires, without reading it
+func (ac *Cache) TokenExpiry(spn string) (time.Time, bool) {
+	if val, found := ac.c.Get(ac.qualify(PrefixToken + spn)); found {
+		if ct, ok := val.(*CachedToken); ok {
+			return ct.ExpiresAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Delete removes an item from the cache
+func (ac *Cache) Delete(key string) {
+	ac.c.Delete(ac.qualify(key))
+	ac.schedulePersist()
+}
+
+// DeleteJWT removes a JWT from the cache
+func (ac *Cache) DeleteJWT(key string) {
+	ac.c.Delete(ac.qualify(PrefixJWT + key))
+	ac.schedulePersist()
+}
+
+// DeleteSecret removes a secret from the cache
+func (ac *Cache) DeleteSecret(key string) {
+	ac.c.Delete(ac.qualify(PrefixSecret + key))
+	ac.schedulePersist()
+}
+
+// DeleteToken removes a token from the cache
+func (ac *Cache) DeleteToken(spn string) {
+	ac.c.Delete(ac.qualify(PrefixToken + spn))
+}
+
+// Clear removes all items from the cache
+func (ac *Cache) Clear() {
+	// Flush doesn't call OnEvicted, so wipe values first
+	for _, item := range ac.c.Items() {
+		destroyCachedValue(item.Object)
+	}
+	ac.c.Flush()
+	ac.mu.Lock()
+	ac.lru.Init()
+	ac.lruIndex = make(map[string]*list.Element)
+	ac.totalBytes = 0
+	ac.mu.Unlock()
+	ac.schedulePersist()
+}
+
+// ItemCount returns the number of items in the cache
+func (ac *Cache) ItemCount() int {
+	return ac.c.ItemCount()
+}
+
+// Stats returns cache statistics as a formatted string
+func (ac *Cache) Stats() string {
+	m := ac.Metrics()
+	return fmt.Sprintf("Cache items: %d (%s), hits: %d, misses: %d (%.0f%% hit rate), sets: %d, refreshes: %d, evictions: %d",
+		ac.c.ItemCount(), ac.UsageSummary(), m.Hits, m.Misses, m.HitRate()*100, m.Sets, m.Refreshes, m.Evictions)
+}
+
+// Metrics returns a snapshot of the cache counters and current usage
+func (ac *Cache) Metrics() Metrics {
+	entries, bytes := ac.Usage()
+	return Metrics{
+		Hits:      ac.hits.Load(),
+		Misses:    ac.misses.Load(),
+		Sets:      ac.sets.Load(),
+		Refreshes: ac.refreshes.Load(),
+		Evictions: ac.evictions.Load(),
+		Entries:   entries,
+		Bytes:     bytes,
+	}
+}
+
+// MetricsSummary returns a short description of the hit/miss counters for the menu
+func (ac *Cache) MetricsSummary() string {
+	m := ac.Metrics()
+	return fmt.Sprintf("%d hits / %d misses (%.0f%%), %d evicted", m.Hits, m.Misses, m.HitRate()*100, m.Evictions)
+}
+
+// Entry represents a cache entry for display
+type Entry struct {
+	Key       string
+	Value     string
+	ExpiresAt time.Time
+	Type      string // "jwt", "secret", "token", or "custom"
+}
+
+// ListKeys returns all cache keys in the active namespace
+func (ac *Cache) ListKeys() []string {
+	items := ac.c.Items()
+	keys := make([]string, 0, len(items))
+	for fullKey := range items {
+		if k, ok := ac.unqualify(fullKey); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// ListEntries returns all cache entries in the active namespace with metadata
+func (ac *Cache) ListEntries() []Entry {
+	items := ac.c.Items()
+	entries := make([]Entry, 0, len(items))
+
+	for fullKey, item := range items {
+		k, ok := ac.unqualify(fullKey)
+		if !ok {
+			continue
+		}
+		entry := Entry{
+			Key: k,
+		}
+
+		// Determine type and extract value
+		switch v := item.Object.(type) {
+		case *CachedToken:
+			entry.Value = v.Value.String()
+			entry.ExpiresAt = v.ExpiresAt
+			if len(k) > len(PrefixToken) && k[:len(PrefixToken)] == PrefixToken {
+				entry.Type = "token"
+			} else if len(k) > len(PrefixJWT) && k[:len(PrefixJWT)] == PrefixJWT {
+				entry.Type = "jwt"
+			}
+		case *CachedSecret:
+			entry.Value = v.Value.String()
+			entry.ExpiresAt = v.ExpiresAt
+			entry.Type = "secret"
+		case string:
+			entry.Value = v
+			entry.Type = "custom"
+			// Calculate expiry from item.Expiration (Unix nano timestamp)
+			if item.Expiration > 0 {
+				entry.ExpiresAt = time.Unix(0, item.Expiration)
+			}
+		default:
+			entry.Value = fmt.Sprintf("%v", item.Object)
+			entry.Type = "custom"
+			if item.Expiration > 0 {
+				entry.ExpiresAt = time.Unix(0, item.Expiration)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// GetValue retrieves any cached value as a string by its key (including any type prefix)
+func (ac *Cache) GetValue(key string) (string, bool) {
+	k := ac.qualify(key)
+	item, found := ac.c.Get(k)
+	if !found {
+		ac.miss()
+		return "", false
+	}
+	ac.hit(k)
+
+	switch v := item.(type) {
+	case *CachedToken:
+		return v.Value.String(), true
+	case *CachedSecret:
+		return v.Value.String(), true
+	case string:
+		return v, true
+	default:
+		return fmt.Sprintf("%v", item), true
+	}
+}
+
+// Set stores a custom string value with the given key and expiration
+func (ac *Cache) Set(key string, value string, expiration time.Duration) {
+	k := ac.qualify(key)
+	ac.store(k, value, entrySize(k, value, nil), expiration)
+	ac.schedulePersist()
+}
+
+// store sets a fully qualified key directly, bypassing the active namespace.
+// All writes go through here so replaced tokens and secrets are wiped.
+func (ac *Cache) store(fullKey string, value interface{}, size int, expiration time.Duration) {
+	// go-cache doesn't report overwritten values, so wipe the previous one here
+	if old, found := ac.c.Get(fullKey); found {
+		destroyCachedValue(old)
+	}
+	ac.c.Set(fullKey, value, expiration)
+	ac.track(fullKey, size)
+}
+
+// Get retrieves a custom string value by key
+func (ac *Cache) Get(key string) (string, bool) {
+	k := ac.qualify(key)
+	if val, found := ac.c.Get(k); found {
+		if s, ok := val.(string); ok {
+			ac.hit(k)
+			return s, true
+		}
+	}
+	ac.miss()
+	return "", false
+}
+
+// persistableEntries returns the entries that survive restarts: JWTs, secrets, and custom values.
+// Keys are stored fully qualified so every namespace is persisted.
+// Kerberos tokens are never persisted since they are cheap to re-request and replay-sensitive.
+func (ac *Cache) persistableEntries() []persistedCacheEntry {
+	items := ac.c.Items()
+	entries := make([]persistedCacheEntry, 0, len(items))
+
+	for k, item := range items {
+		var expiresAt time.Time
+		if item.Expiration > 0 {
+			expiresAt = time.Unix(0, item.Expiration)
+		}
+
+		switch v := item.Object.(type) {
+		case *CachedToken:
+			if v.SPN != "" {
+				continue
+			}
+			entries = append(entries, persistedCacheEntry{Key: k, Kind: "jwt", Value: v.Value.String(), ExpiresAt: expiresAt})
+		case *CachedSecret:
+			entries = append(entries, persistedCacheEntry{Key: k, Kind: "secret", Value: v.Value.String(), Metadata: v.Metadata, ExpiresAt: expiresAt})
+		case string:
+			entries = append(entries, persistedCacheEntry{Key: k, Kind: "custom", Value: v, ExpiresAt: expiresAt})
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// cacheKeyService is the keystore service name used for the cache encryption key
+const cacheKeyService = "ktray-cache"
+
+// newCacheKey generates a random 256-bit key
+func newCacheKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// decodeCacheKey parses a hex-encoded key and validates its length
+func decodeCacheKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache key encoding: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid cache key length: %d", len(key))
+	}
+	return key, nil
+}
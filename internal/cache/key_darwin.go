@@ -0,0 +1,28 @@
+//go:build darwin
+
+package cache
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"krb5tray/internal/keychain"
+)
+
+// loadKey returns the cache encryption key stored in the login Keychain,
+// creating it on first use. Persistence is refused if the Keychain is unavailable.
+func loadKey(opts PersistOptions) ([]byte, error) {
+	if saved, err := keychain.Find(cacheKeyService, opts.Account); err == nil {
+		defer zeroBytes(saved)
+		return decodeCacheKey(string(saved))
+	}
+
+	key, err := newCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := keychain.Save(cacheKeyService, opts.Account, hex.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("the login Keychain is unavailable: %w", err)
+	}
+	return key, nil
+}
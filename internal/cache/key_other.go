@@ -0,0 +1,36 @@
+//go:build !darwin && !windows
+
+package cache
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// loadKey returns the cache encryption key from the Secret Service (via secret-tool),
+// creating it on first use. Without a keystore there is nowhere to keep the key apart from
+// the cache file, so persistence is refused.
+func loadKey(opts PersistOptions) ([]byte, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, fmt.Errorf("secret-tool not found; install libsecret-tools to keep the key in the Secret Service")
+	}
+
+	out, err := exec.Command(path, "lookup", "service", cacheKeyService).Output()
+	if err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		return decodeCacheKey(string(out))
+	}
+
+	key, err := newCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	store := exec.Command(path, "store", "--label=ktray cache key", "service", cacheKeyService)
+	store.Stdin = strings.NewReader(hex.EncodeToString(key))
+	if err := store.Run(); err != nil {
+		return nil, fmt.Errorf("the Secret Service is unavailable: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,24 @@
+//go:build !darwin && !windows
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPersistenceWithoutKeystore checks that the cache isn't persisted when there is no
+// keystore to keep its key in, rather than leaving the key next to the cache file
+func TestPersistenceWithoutKeystore(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	dir := t.TempDir()
+	ac := New()
+	ac.EnablePersistence(PersistOptions{Path: filepath.Join(dir, "cache.db"), KeyFile: filepath.Join(dir, "cache.key")})
+	if ac.persister.Load() != nil {
+		t.Error("persistence enabled without secret-tool")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files written without a keystore", len(entries))
+	}
+}
@@ -0,0 +1,61 @@
+//go:build windows
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// loadKey returns the cache encryption key, stored in a file protected with DPAPI
+// so that only the current Windows user can decrypt it.
+func loadKey(opts PersistOptions) ([]byte, error) {
+	path := opts.KeyFile
+	if protected, err := os.ReadFile(path); err == nil {
+		return dpapiUnprotect(protected)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := newCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	protected, err := dpapiProtect(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, protected, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return append([]byte(nil), unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	plain := unsafe.Slice(out.Data, out.Size)
+	key := append([]byte(nil), plain...)
+	zeroBytes(plain)
+	return key, nil
+}
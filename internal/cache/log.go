@@ -0,0 +1,24 @@
+package cache
+
+// Logger receives the cache's log messages
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// logger discards messages until SetLogger is called
+var logger Logger = discardLogger{}
+
+// SetLogger sends the cache's log messages to l
+func SetLogger(l Logger) {
+	logger = l
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Debugf(string, ...interface{}) {}
+func (discardLogger) Infof(string, ...interface{})  {}
+func (discardLogger) Warnf(string, ...interface{})  {}
+func (discardLogger) Errorf(string, ...interface{}) {}
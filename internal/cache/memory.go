@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"encoding/base64"
+	"runtime"
+	"sync"
+)
+
+// LockedBuffer holds a sensitive value outside the Go heap where the platform allows it:
+// the memory is locked so it is never swapped out, excluded from core dumps on Linux,
+// and zeroed before it is released. Falls back to a heap slice when locking fails.
+type LockedBuffer struct {
+	mu     sync.RWMutex
+	data   []byte       // Backing memory; its capacity is what was allocated
+	size   int          // Length of the stored value
+	locked bool         // True when data is locked memory
+	arena  *lockedArena // Arena data was carved from, nil for a mapping of its own
+	block  int          // First block of data in arena
+}
+
+var lockFailureOnce sync.Once
+
+const (
+	// lockedArenaSize is the size of the locked regions values share. A page per value
+	// would reach RLIMIT_MEMLOCK, often 64 KiB, after a dozen or so cached tokens.
+	lockedArenaSize = 32 << 10
+	// lockedBlockSize is the granularity values are carved from an arena in
+	lockedBlockSize = 64
+)
+
+// lockedArena is a locked region split into blocks, each either free or part of a value
+type lockedArena struct {
+	data []byte
+	used [lockedArenaSize / lockedBlockSize]bool
+	busy int // Blocks in use
+}
+
+// lockedArenas are the arenas with values in them. An arena is released when its last
+// value is destroyed.
+var lockedArenas struct {
+	mu     sync.Mutex
+	arenas []*lockedArena
+}
+
+// allocFromArena carves size bytes out of the first arena with room, locking a new arena
+// when none has. It returns the arena and the first block used.
+func allocFromArena(size int) ([]byte, *lockedArena, int, error) {
+	blocks := (size + lockedBlockSize - 1) / lockedBlockSize
+	lockedArenas.mu.Lock()
+	defer lockedArenas.mu.Unlock()
+
+	for _, a := range lockedArenas.arenas {
+		if first, ok := a.take(blocks); ok {
+			return a.slice(first, blocks, size), a, first, nil
+		}
+	}
+	data, err := allocLocked(lockedArenaSize)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	a := &lockedArena{data: data}
+	lockedArenas.arenas = append(lockedArenas.arenas, a)
+	first, _ := a.take(blocks)
+	return a.slice(first, blocks, size), a, first, nil
+}
+
+// take marks the first run of n free blocks as used
+func (a *lockedArena) take(n int) (int, bool) {
+	run := 0
+	for i, used := range a.used {
+		if used {
+			run = 0
+			continue
+		}
+		run++
+		if run == n {
+			first := i - n + 1
+			for j := first; j <= i; j++ {
+				a.used[j] = true
+			}
+			a.busy += n
+			return first, true
+		}
+	}
+	return 0, false
+}
+
+// slice returns the size bytes at block first, with the capacity of n blocks
+func (a *lockedArena) slice(first int, n int, size int) []byte {
+	start := first * lockedBlockSize
+	return a.data[start : start+size : start+n*lockedBlockSize]
+}
+
+// freeToArena returns the blocks of data, which must already be zeroed, to a, releasing a
+// once nothing is left in it
+func freeToArena(a *lockedArena, first int, data []byte) error {
+	lockedArenas.mu.Lock()
+	defer lockedArenas.mu.Unlock()
+
+	n := cap(data) / lockedBlockSize
+	for j := first; j < first+n; j++ {
+		a.used[j] = false
+	}
+	a.busy -= n
+	if a.busy > 0 {
+		return nil
+	}
+	for i, other := range lockedArenas.arenas {
+		if other == a {
+			lockedArenas.arenas = append(lockedArenas.arenas[:i], lockedArenas.arenas[i+1:]...)
+			break
+		}
+	}
+	return freeLocked(a.data)
+}
+
+// NewLockedBuffer copies value into locked memory
+func NewLockedBuffer(value string) *LockedBuffer {
+	b := newLockedBuffer(len(value))
+	copy(b.data, value)
+	return b
+}
+
+// NewLockedBase64 base64-encodes raw straight into locked memory and zeroes raw, so the
+// encoded token never exists as a Go string
+func NewLockedBase64(raw []byte) *LockedBuffer {
+	b := newLockedBuffer(base64.StdEncoding.EncodedLen(len(raw)))
+	base64.StdEncoding.Encode(b.data, raw)
+	zeroBytes(raw)
+	return b
+}
+
+// newLockedBuffer allocates an empty buffer for a value of size bytes
+func newLockedBuffer(size int) *LockedBuffer {
+	b := &LockedBuffer{size: size}
+	if size == 0 {
+		return b
+	}
+
+	var data []byte
+	var err error
+	if size <= lockedArenaSize {
+		data, b.arena, b.block, err = allocFromArena(size)
+	} else {
+		data, err = allocLocked(size)
+	}
+	if err != nil {
+		lockFailureOnce.Do(func() {
+			logger.Warnf("Cannot lock memory for cached secrets, using regular memory: %v", err)
+		})
+		data = make([]byte, size)
+	} else {
+		b.locked = true
+	}
+	b.data = data
+
+	// Make sure memory is wiped even if the owner forgets to call Destroy
+	runtime.SetFinalizer(b, (*LockedBuffer).Destroy)
+	return b
+}
+
+// Clone copies the value into a new locked buffer without going through a string
+func (b *LockedBuffer) Clone() *LockedBuffer {
+	if b == nil {
+		return nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	c := newLockedBuffer(b.size)
+	if b.data != nil {
+		copy(c.data, b.data[:b.size])
+	} else {
+		c.size = 0
+	}
+	return c
+}
+
+// String returns a copy of the stored value ("" once destroyed)
+func (b *LockedBuffer) String() string {
+	if b == nil {
+		return ""
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.data == nil {
+		return ""
+	}
+	return string(b.data[:b.size])
+}
+
+// Len returns the length of the stored value
+func (b *LockedBuffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.size
+}
+
+// Destroy zeroes and releases the memory. Safe to call more than once.
+func (b *LockedBuffer) Destroy() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.data == nil {
+		return
+	}
+
+	zeroBytes(b.data[:cap(b.data)])
+	if b.locked {
+		var err error
+		if b.arena != nil {
+			err = freeToArena(b.arena, b.block, b.data)
+		} else {
+			err = freeLocked(b.data)
+		}
+		if err != nil {
+			logger.Debugf("Failed to release locked memory: %v", err)
+		}
+	}
+	b.data = nil
+	b.arena = nil
+	b.size = 0
+	runtime.SetFinalizer(b, nil)
+}
+
+// zeroBytes overwrites b with zeros
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !windows && !linux
+// +build !darwin,!windows,!linux
+
+package cache
+
+import "fmt"
+
+// allocLocked is not supported on this platform; callers fall back to regular memory
+func allocLocked(n int) ([]byte, error) {
+	return nil, fmt.Errorf("memory locking not supported on this platform")
+}
+
+// freeLocked is never called on this platform since allocLocked always fails
+func freeLocked(data []byte) error {
+	return nil
+}
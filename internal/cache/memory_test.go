@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestLockedArenas checks that small values share locked arenas instead of a page each, and
+// that an arena is released with its last value
+func TestLockedArenas(t *testing.T) {
+	probe := NewLockedBuffer("probe")
+	defer probe.Destroy()
+	if !probe.locked {
+		t.Skip("memory can't be locked here")
+	}
+	before := len(lockedArenas.arenas)
+
+	var buffers []*LockedBuffer
+	for i := 0; i < 200; i++ {
+		buffers = append(buffers, NewLockedBuffer(fmt.Sprintf("secret-%03d", i)))
+	}
+	big := NewLockedBuffer(strings.Repeat("x", lockedArenaSize+1))
+	if big.arena != nil || !big.locked || big.String() != strings.Repeat("x", lockedArenaSize+1) {
+		t.Error("a value larger than an arena wasn't given a mapping of its own")
+	}
+	big.Destroy()
+
+	if got := len(lockedArenas.arenas); got != before {
+		t.Errorf("200 short values took %d new arenas", got-before)
+	}
+	for i, b := range buffers {
+		if want := fmt.Sprintf("secret-%03d", i); b.String() != want {
+			t.Fatalf("buffer %d = %q, want %q", i, b.String(), want)
+		}
+	}
+
+	// A freed run is reused for the next value that fits
+	arena, block := buffers[10].arena, buffers[10].block
+	buffers[10].Destroy()
+	reused := NewLockedBuffer("again")
+	if reused.arena != arena || reused.block != block {
+		t.Error("freed blocks weren't reused")
+	}
+	reused.Destroy()
+
+	for _, b := range buffers {
+		b.Destroy()
+	}
+	probe.Destroy()
+	if got := len(lockedArenas.arenas); got != 0 {
+		t.Errorf("%d arenas left after destroying every value", got)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package cache
+
+import (
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// madvDontDump is MADV_DONTDUMP on Linux (not available on macOS)
+const madvDontDump = 0x10
+
+// allocLocked maps anonymous memory of at least n bytes and locks it into RAM
+func allocLocked(n int) ([]byte, error) {
+	pageSize := os.Getpagesize()
+	size := (n + pageSize - 1) / pageSize * pageSize
+
+	data, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Mlock(data); err != nil {
+		_ = unix.Munmap(data)
+		return nil, err
+	}
+	if runtime.GOOS == "linux" {
+		// Best effort: keep secrets out of core dumps
+		_ = unix.Madvise(data, madvDontDump)
+	}
+	return data[:n], nil
+}
+
+// freeLocked unlocks and unmaps memory returned by allocLocked
+func freeLocked(data []byte) error {
+	data = data[:cap(data)]
+	if err := unix.Munlock(data); err != nil {
+		return err
+	}
+	return unix.Munmap(data)
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package cache
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocLocked allocates committed pages of at least n bytes and locks them into RAM
+func allocLocked(n int) ([]byte, error) {
+	pageSize := os.Getpagesize()
+	size := (n + pageSize - 1) / pageSize * pageSize
+
+	addr, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, err
+	}
+	if err := windows.VirtualLock(addr, uintptr(size)); err != nil {
+		_ = windows.VirtualFree(addr, 0, windows.MEM_RELEASE)
+		return nil, err
+	}
+	// unsafe.Add avoids converting the uintptr directly (memory is outside the Go heap)
+	return unsafe.Slice((*byte)(unsafe.Add(nil, addr)), size)[:n], nil
+}
+
+// freeLocked unlocks and releases memory returned by allocLocked
+func freeLocked(data []byte) error {
+	data = data[:cap(data)]
+	addr := uintptr(unsafe.Pointer(&data[0]))
+	if err := windows.VirtualUnlock(addr, uintptr(len(data))); err != nil {
+		return err
+	}
+	return windows.VirtualFree(addr, 0, windows.MEM_RELEASE)
+}
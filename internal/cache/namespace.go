@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultProfile is the profile name used when the config doesn't set one
+const DefaultProfile = "default"
+
+// prefixNamespace marks a fully qualified cache key: ns:<profile>/<principal>|<key>
+const prefixNamespace = "ns:"
+
+// namespacePrefix builds the key prefix for a profile and principal
+func namespacePrefix(profile string, principal string) string {
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	if principal == "" {
+		principal = "unknown"
+	}
+	return fmt.Sprintf("%s%s/%s|", prefixNamespace, profile, principal)
+}
+
+// SetNamespace switches the active cache namespace. Entries from other namespaces are kept
+// but are no longer visible through the cache API until their namespace becomes active again.
+func (ac *Cache) SetNamespace(profile string, principal string) {
+	prefix := namespacePrefix(profile, principal)
+
+	ac.mu.Lock()
+	changed := ac.namespace != prefix
+	ac.namespace = prefix
+	ac.profile = profile
+	ac.principal = principal
+	ac.mu.Unlock()
+
+	if changed {
+		logger.Infof("Cache namespace: %s", ac.NamespaceName())
+	}
+}
+
+// NamespaceName returns a human-readable name for the active namespace
+func (ac *Cache) NamespaceName() string {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	profile, principal := ac.profile, ac.principal
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	if principal == "" {
+		principal = "unknown principal"
+	}
+	return fmt.Sprintf("%s / %s", profile, principal)
+}
+
+// qualify prefixes a key with the active namespace
+func (ac *Cache) qualify(key string) string {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return ac.namespace + key
+}
+
+// unqualify strips the active namespace from a full key, reporting whether it belongs to it
+func (ac *Cache) unqualify(fullKey string) (string, bool) {
+	ac.mu.Lock()
+	prefix := ac.namespace
+	ac.mu.Unlock()
+
+	if !strings.HasPrefix(fullKey, prefix) {
+		return "", false
+	}
+	return fullKey[len(prefix):], true
+}
+
+// ClearNamespace removes all entries in the active namespace and returns how many were removed
+func (ac *Cache) ClearNamespace() int {
+	ac.mu.Lock()
+	prefix := ac.namespace
+	ac.mu.Unlock()
+
+	removed := 0
+	for k := range ac.c.Items() {
+		if strings.HasPrefix(k, prefix) {
+			ac.c.Delete(k)
+			removed++
+		}
+	}
+	if removed > 0 {
+		ac.schedulePersist()
+	}
+	return removed
+}
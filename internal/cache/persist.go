@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// persistDebounce delays writes so bursts of cache updates produce a single save
+const persistDebounce = 2 * time.Second
+
+// persistedCacheEntry is the on-disk representation of a cache item
+type persistedCacheEntry struct {
+	Key       string            `json:"key"`
+	Kind      string            `json:"kind"` // "jwt", "secret", or "custom"
+	Value     string            `json:"value"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at,omitempty"` // Zero means no expiration
+}
+
+// PersistOptions says where the encrypted cache file and its key are kept
+type PersistOptions struct {
+	Path    string // The encrypted cache file
+	KeyFile string // The DPAPI-protected key file on Windows
+	Account string // The Keychain account the key is saved under on macOS
+}
+
+// persister writes selected cache entries to an encrypted file
+type persister struct {
+	mu      sync.Mutex // Held while saving, so stop waits for a save in progress
+	path    string
+	aead    cipher.AEAD
+	timer   *time.Timer
+	stopped bool
+}
+
+// EnablePersistence loads the entries saved in opts.Path with their remaining TTL, and from
+// then on saves the cache there shortly after it changes. Enabling it again does nothing.
+func (ac *Cache) EnablePersistence(opts PersistOptions) {
+	if ac.persister.Load() != nil {
+		return
+	}
+
+	key, err := loadKey(opts)
+	if err != nil {
+		logger.Errorf("Cache persistence disabled: failed to obtain encryption key: %v", err)
+		return
+	}
+	defer zeroBytes(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		logger.Errorf("Cache persistence disabled: %v", err)
+		return
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		logger.Errorf("Cache persistence disabled: %v", err)
+		return
+	}
+
+	p := &persister{path: opts.Path, aead: aead}
+	loaded, err := p.load(ac)
+	if err != nil {
+		logger.Warnf("Failed to load persisted cache (starting empty): %v", err)
+	} else {
+		logger.Infof("Loaded %d persisted cache entries", loaded)
+	}
+	ac.persister.Store(p)
+}
+
+// DisablePersistence stops saving the cache. Once it returns no save is in progress, so
+// the caller can delete the file.
+func (ac *Cache) DisablePersistence() {
+	if p := ac.persister.Swap(nil); p != nil {
+		p.stop()
+	}
+}
+
+// schedulePersist queues a debounced save of the cache, if persistence is enabled
+func (ac *Cache) schedulePersist() {
+	p := ac.persister.Load()
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(persistDebounce, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.stopped {
+			return
+		}
+		if err := p.save(ac); err != nil {
+			logger.Errorf("Failed to persist cache: %v", err)
+		}
+	})
+}
+
+// FlushPersistence writes the cache to disk immediately (used on shutdown)
+func (ac *Cache) FlushPersistence() {
+	p := ac.persister.Load()
+	if p == nil {
+		return
+	}
+	p.stop()
+	if err := p.save(ac); err != nil {
+		logger.Errorf("Failed to persist cache: %v", err)
+	}
+}
+
+func (p *persister) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+// save encrypts and atomically writes all persistable cache entries
+func (p *persister) save(ac *Cache) error {
+	entries := ac.persistableEntries()
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(plain)
+
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := p.aead.Seal(nonce, nonce, plain, nil)
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// load decrypts the cache file and restores unexpired entries with their remaining TTL
+func (p *persister) load(ac *Cache) (int, error) {
+	sealed, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	nonceSize := p.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return 0, fmt.Errorf("cache file is truncated")
+	}
+	plain, err := p.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt cache file: %w", err)
+	}
+	defer zeroBytes(plain)
+
+	var entries []persistedCacheEntry
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	loaded := 0
+	for _, e := range entries {
+		ttl := NoExpiration
+		if !e.ExpiresAt.IsZero() {
+			ttl = e.ExpiresAt.Sub(now)
+			if ttl <= 0 {
+				continue // Expired while the app wasn't running
+			}
+		}
+
+		// Entries written before namespacing existed belong to the active namespace
+		key := e.Key
+		if !strings.HasPrefix(key, prefixNamespace) {
+			key = ac.qualify(key)
+		}
+
+		size := entrySize(key, e.Value, e.Metadata)
+		switch e.Kind {
+		case "jwt":
+			ac.store(key, &CachedToken{Value: NewLockedBuffer(e.Value), ExpiresAt: e.ExpiresAt}, size, ttl)
+		case "secret":
+			if e.Metadata == nil {
+				e.Metadata = make(map[string]string)
+			}
+			ac.store(key, &CachedSecret{Value: NewLockedBuffer(e.Value), ExpiresAt: e.ExpiresAt, Metadata: e.Metadata}, size, ttl)
+		default:
+			ac.store(key, e.Value, size, ttl)
+		}
+		loaded++
+	}
+	return loaded, nil
+}
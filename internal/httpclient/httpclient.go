@@ -0,0 +1,74 @@
+// Package httpclient holds the tray's shared HTTP transports: keep-alive connections with
+// connect and handshake timeouts, one set verifying certificates and one that doesn't.
+// Policy (whether skipping verification is allowed), tracing and response recording are
+// the callers'.
+package httpclient
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout is the default timeout for HTTP requests (30 seconds)
+const DefaultTimeout = 30 * time.Second
+
+// Timeouts for the parts of a request that the caller's overall timeout shouldn't have to
+// cover on its own: a host that doesn't answer should fail fast, not after 30 seconds
+const (
+	dialTimeout         = 10 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+	idleConnTimeout     = 90 * time.Second
+)
+
+// maxIdleConnsPerHost bounds the connections kept open to one host between requests
+const maxIdleConnsPerHost = 4
+
+// The shared transports keep connections alive between requests, so scripts that call
+// the same API on every run don't pay for a new TCP and TLS handshake each time. There is
+// one per verification mode, since connections can't be shared between them.
+var (
+	secureClient   = &http.Client{Transport: newTransport(false)}
+	insecureClient = &http.Client{Transport: newTransport(true)} // Skips TLS certificate verification
+)
+
+// newTransport returns a keep-alive transport with connect and handshake timeouts
+func newTransport(skipVerify bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if skipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport
+}
+
+// Client returns the shared client for the verification mode
+func Client(skipVerify bool) *http.Client {
+	if skipVerify {
+		return insecureClient
+	}
+	return secureClient
+}
+
+// RedactURL drops the query string and credentials, which may carry secrets
+func RedactURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	clean.RawQuery = ""
+	clean.Fragment = ""
+	return clean.String()
+}
@@ -0,0 +1,87 @@
+// Package keychain keeps generic passwords in the macOS login Keychain, through the security
+// tool. Passwords are handed to it on stdin, never as arguments, since any process can read
+// another's arguments.
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound means the Keychain has no item for the service and account
+var ErrNotFound = errors.New("no such Keychain item")
+
+// Find returns the password saved for service and account. The caller should zero it
+// when done.
+func Find(service string, account string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		if isItemNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return bytes.TrimSpace(out), nil
+}
+
+// Save adds the password for service and account, replacing any saved before. security
+// reads the command from stdin (-i), so the password stays out of the process list.
+func Save(service string, account string, password string) error {
+	args := []string{service, account, password}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "\"\\\n\r") {
+			return fmt.Errorf("keychain: quotes, backslashes and newlines aren't supported")
+		}
+	}
+	add := exec.Command("security", "-i")
+	add.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -w \"%s\"\n", service, account, password))
+	out, err := add.CombinedOutput()
+	if err != nil {
+		return securityError(out, err)
+	}
+
+	// In interactive mode security's exit status doesn't always reflect the command's, so
+	// read the item back
+	saved, err := Find(service, account)
+	if err != nil {
+		return securityError(out, err)
+	}
+	defer zeroBytes(saved)
+	if string(saved) != password {
+		return securityError(out, fmt.Errorf("the saved item doesn't match"))
+	}
+	return nil
+}
+
+// Delete removes the item for service and account
+func Delete(service string, account string) error {
+	err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run()
+	if err != nil && isItemNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// securityError prefers what security printed to err
+func securityError(out []byte, err error) error {
+	// Interactive mode may echo its prompt
+	if text := strings.TrimSpace(strings.ReplaceAll(string(out), "security>", "")); text != "" {
+		return fmt.Errorf("security: %s", text)
+	}
+	return err
+}
+
+// isItemNotFound reports whether security exited with errSecItemNotFound
+func isItemNotFound(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 44
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/internal/cache"
+)
+
+// jwtMenuRefresh is how often the expiry countdowns in the JWTs menu are updated
+const jwtMenuRefresh = 30 * time.Second
+
+// jwtClaims are the registered claims the JWTs menu shows
+type jwtClaims struct {
+	Subject  string
+	Audience string
+	Issuer   string
+	Expires  time.Time // Zero if the token has no exp claim
+}
+
+// splitJWT decodes a JWT's header and payload without verifying it
+func splitJWT(token string) (headerJSON []byte, payloadJSON []byte, signature string, err error) {
+	token = strings.TrimPrefix(token, "Bearer ")
+	token = strings.TrimPrefix(token, "bearer ")
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, "", fmt.Errorf("invalid JWT format: expected 3 parts separated by '.'")
+	}
+	if headerJSON, err = base64URLDecode(parts[0]); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to decode header: %w", err)
+	}
+	if payloadJSON, err = base64URLDecode(parts[1]); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return headerJSON, payloadJSON, parts[2], nil
+}
+
+// parseJWTClaims returns the registered claims of a JWT, without verifying it
+func parseJWTClaims(token string) (jwtClaims, error) {
+	_, payloadJSON, _, err := splitJWT(token)
+	if err != nil {
+		return jwtClaims{}, err
+	}
+	var payload struct {
+		Sub string          `json:"sub"`
+		Iss string          `json:"iss"`
+		Aud json.RawMessage `json:"aud"` // A string or a list of strings
+		Exp json.Number     `json:"exp"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(payloadJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return jwtClaims{}, fmt.Errorf("failed to parse payload JSON: %w", err)
+	}
+
+	claims := jwtClaims{Subject: payload.Sub, Issuer: payload.Iss}
+	var audience []string
+	if err := json.Unmarshal(payload.Aud, &audience); err != nil {
+		var single string
+		if json.Unmarshal(payload.Aud, &single) == nil {
+			audience = []string{single}
+		}
+	}
+	claims.Audience = strings.Join(audience, ", ")
+	if exp, err := payload.Exp.Float64(); err == nil && exp > 0 {
+		claims.Expires = time.Unix(int64(exp), 0)
+	}
+	return claims, nil
+}
+
+// storeJWT caches a JWT under key. Without a ttl it's kept until its exp claim, or for
+// cache.jwt_ttl_sec if it has none. Expired tokens are refused.
+func storeJWT(key string, token string, ttl time.Duration) error {
+	claims, err := parseJWTClaims(token)
+	if err != nil {
+		return err
+	}
+	if !claims.Expires.IsZero() {
+		remaining := time.Until(claims.Expires)
+		if remaining <= 0 {
+			return fmt.Errorf("JWT expired at %s", claims.Expires.Format("2006-01-02 15:04:05"))
+		}
+		if ttl <= 0 || ttl > remaining {
+			ttl = remaining
+		}
+	}
+	if ttl <= 0 {
+		ttl = configOrFile().GetJWTTTL()
+	}
+	GetCache().SetJWT(key, token, ttl)
+	updateCacheMenu()
+	return nil
+}
+
+// formatJWTDecoded renders a JWT's header and claims for the decode dialog, with the time
+// claims also shown as local times
+func formatJWTDecoded(token string) (string, error) {
+	headerJSON, payloadJSON, _, err := splitJWT(token)
+	if err != nil {
+		return "", err
+	}
+	var header, payload bytes.Buffer
+	if err := json.Indent(&header, headerJSON, "", "  "); err != nil {
+		return "", fmt.Errorf("failed to parse header JSON: %w", err)
+	}
+	if err := json.Indent(&payload, payloadJSON, "", "  "); err != nil {
+		return "", fmt.Errorf("failed to parse payload JSON: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Header:\n%s\n\nPayload:\n%s\n", header.String(), payload.String())
+
+	var times map[string]interface{}
+	if json.Unmarshal(payloadJSON, &times) == nil {
+		for _, claim := range []string{"iat", "nbf", "exp"} {
+			if v, ok := times[claim].(float64); ok {
+				fmt.Fprintf(&b, "\n%s: %s", claim, time.Unix(int64(v), 0).Format("2006-01-02 15:04:05 MST"))
+			}
+		}
+	}
+	b.WriteString("\n\nThe signature is not verified.")
+	return b.String(), nil
+}
+
+// jwtMenuSlot is one JWT in the JWTs menu: the claims are shown as disabled items in its
+// submenu, followed by the actions
+type jwtMenuSlot struct {
+	item     *systray.MenuItem
+	subject  *systray.MenuItem
+	audience *systray.MenuItem
+	expires  *systray.MenuItem
+	copy     *systray.MenuItem
+	decode   *systray.MenuItem
+}
+
+// jwtMenu lists the cached JWTs. Like menuList, slots are created as the list grows and
+// hidden when it shrinks, since systray can't remove items.
+var jwtMenu struct {
+	mu          sync.Mutex
+	parent      *systray.MenuItem
+	placeholder *systray.MenuItem
+	slots       []*jwtMenuSlot
+	keys        []string // JWT keys shown, by slot
+
+	warnings map[string]*time.Timer // Expiry warnings, by key and expiry
+}
+
+var mJWTsMenu *systray.MenuItem
+
+// loadAndBuildJWTMenu fills the JWTs menu and keeps its countdowns current
+func loadAndBuildJWTMenu() {
+	jwtMenu.parent = mJWTsMenu
+	jwtMenu.placeholder = mJWTsMenu.AddSubMenuItem("No JWTs cached", "Scripts add JWTs with ktray.jwt_set")
+	jwtMenu.placeholder.Disable()
+
+	updateJWTMenu()
+	go func() {
+		for range time.Tick(jwtMenuRefresh) {
+			updateJWTMenu()
+		}
+	}()
+}
+
+// updateJWTMenu lists the cached JWTs with their claims and time left, and schedules an
+// expiry warning for each if jwt_expiry_warning is set
+func updateJWTMenu() {
+	if jwtMenu.parent == nil {
+		return
+	}
+
+	entries := GetCache().ListEntries()
+	jwts := entries[:0]
+	for _, entry := range entries {
+		if entry.Type == "jwt" {
+			jwts = append(jwts, entry)
+		}
+	}
+	sort.Slice(jwts, func(i, j int) bool { return jwts[i].Key < jwts[j].Key })
+
+	jwtMenu.mu.Lock()
+	defer jwtMenu.mu.Unlock()
+
+	for len(jwtMenu.slots) < len(jwts) {
+		jwtMenu.slots = append(jwtMenu.slots, newJWTMenuSlot(len(jwtMenu.slots)))
+	}
+	jwtMenu.keys = make([]string, len(jwts))
+	warn := currentConfig().GetNotifyConfigWithDefaults().JWTWarn
+	active := make(map[string]bool)
+	for i, slot := range jwtMenu.slots {
+		if i >= len(jwts) {
+			slot.item.Hide()
+			continue
+		}
+		entry := jwts[i]
+		name := entry.Key[len(cache.PrefixJWT):]
+		jwtMenu.keys[i] = name
+
+		claims, err := parseJWTClaims(entry.Value)
+		expires := claims.Expires
+		if expires.IsZero() {
+			expires = entry.ExpiresAt
+		}
+		remaining := time.Until(expires)
+
+		title := truncateString(name, 30)
+		if err == nil && claims.Subject != "" {
+			title += " - " + truncateString(claims.Subject, 20)
+		}
+		if remaining > 0 {
+			title += fmt.Sprintf(" (%s)", formatDuration(remaining))
+		} else {
+			title += " (expired)"
+		}
+		slot.item.SetTitle(title)
+		slot.subject.SetTitle("Subject: " + valueOrDash(claims.Subject))
+		slot.audience.SetTitle("Audience: " + valueOrDash(truncateString(claims.Audience, 50)))
+		if remaining > 0 {
+			slot.expires.SetTitle(fmt.Sprintf("Expires: %s (in %s)", expires.Format("15:04:05"), formatDuration(remaining)))
+		} else {
+			slot.expires.SetTitle(fmt.Sprintf("Expired: %s", expires.Format("15:04:05")))
+		}
+		if err != nil {
+			slot.item.SetTooltip(fmt.Sprintf("Not a readable JWT: %v", err))
+			slot.decode.Disable()
+		} else {
+			slot.item.SetTooltip(fmt.Sprintf("Issuer: %s", valueOrDash(claims.Issuer)))
+			slot.decode.Enable()
+		}
+		slot.item.Show()
+
+		if warn && remaining > expiryWarningLead {
+			warnKey := fmt.Sprintf("%s@%d", name, expires.Unix())
+			active[warnKey] = true
+			scheduleJWTWarningLocked(warnKey, name, expires)
+		}
+	}
+
+	// Drop warnings for tokens that were replaced or removed
+	for warnKey, timer := range jwtMenu.warnings {
+		if !active[warnKey] {
+			timer.Stop()
+			delete(jwtMenu.warnings, warnKey)
+		}
+	}
+
+	if len(jwts) == 0 {
+		jwtMenu.placeholder.Show()
+		mJWTsMenu.SetTitle("JWTs")
+	} else {
+		jwtMenu.placeholder.Hide()
+		mJWTsMenu.SetTitle(fmt.Sprintf("JWTs (%d)", len(jwts)))
+	}
+}
+
+// scheduleJWTWarningLocked arranges for a notification shortly before a JWT expires,
+// unless one is scheduled already. The caller holds jwtMenu.mu.
+func scheduleJWTWarningLocked(warnKey string, name string, expires time.Time) {
+	if _, scheduled := jwtMenu.warnings[warnKey]; scheduled {
+		return
+	}
+	if jwtMenu.warnings == nil {
+		jwtMenu.warnings = make(map[string]*time.Timer)
+	}
+	jwtMenu.warnings[warnKey] = time.AfterFunc(time.Until(expires)-expiryWarningLead, func() {
+		// Only if it's still the cached token
+		if token, found := GetCache().GetJWT(name); found {
+			if claims, err := parseJWTClaims(token); err != nil || claims.Expires.IsZero() || claims.Expires.Equal(expires) {
+				notifyUser("JWT expires soon", fmt.Sprintf("%s expires in %s.", name, formatDuration(time.Until(expires))))
+			}
+		}
+	})
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// newJWTMenuSlot adds a JWT item with its claims and actions to the JWTs menu
+func newJWTMenuSlot(index int) *jwtMenuSlot {
+	slot := &jwtMenuSlot{item: jwtMenu.parent.AddSubMenuItem("", "")}
+	slot.subject = slot.item.AddSubMenuItem("", "The sub claim")
+	slot.subject.Disable()
+	slot.audience = slot.item.AddSubMenuItem("", "The aud claim")
+	slot.audience.Disable()
+	slot.expires = slot.item.AddSubMenuItem("", "The exp claim, or when the cache drops the token")
+	slot.expires.Disable()
+	slot.copy = slot.item.AddSubMenuItem("Copy", "Copy the JWT to the clipboard")
+	slot.decode = slot.item.AddSubMenuItem("Decode...", "Show the header and claims")
+
+	go func() {
+		for range slot.copy.ClickedCh {
+			noteUserActivity()
+			copyJWTByIndex(index)
+		}
+	}()
+	go func() {
+		for range slot.decode.ClickedCh {
+			noteUserActivity()
+			decodeJWTByIndex(index)
+		}
+	}()
+	return slot
+}
+
+// jwtKeyAt returns the name of the JWT shown in slot index
+func jwtKeyAt(index int) string {
+	jwtMenu.mu.Lock()
+	defer jwtMenu.mu.Unlock()
+	if index < len(jwtMenu.keys) {
+		return jwtMenu.keys[index]
+	}
+	return ""
+}
+
+func copyJWTByIndex(index int) {
+	name := jwtKeyAt(index)
+	token, found := GetCache().GetJWT(name)
+	if name == "" || !found {
+		setStatusError("JWT not cached anymore")
+		updateCacheMenu()
+		return
+	}
+	if err := requireSecurityKey(securityKeyTokens, "Copy the JWT "+name); err != nil {
+		setStatusError(fmt.Sprintf("Copy failed: %s", truncateError(err)))
+		return
+	}
+	copied, err := copySecretToClipboard("jwt: "+name, token, requesterMenu)
+	if err != nil {
+		LogError("Failed to copy JWT: %v", err)
+		setStatusError(fmt.Sprintf("Copy failed: %v", truncateError(err)))
+	} else if copied {
+		logSecretCopy("jwt", name)
+		setStatus(fmt.Sprintf("%s JWT: %s", secretCopyVerb(), truncateString(name, 30)))
+	}
+}
+
+func decodeJWTByIndex(index int) {
+	name := jwtKeyAt(index)
+	token, found := GetCache().GetJWT(name)
+	if name == "" || !found {
+		setStatusError("JWT not cached anymore")
+		updateCacheMenu()
+		return
+	}
+	text, err := formatJWTDecoded(token)
+	if err != nil {
+		setStatusError(fmt.Sprintf("Decode failed: %s", truncateError(err)))
+		return
+	}
+	ShowMessageDialog("JWT: "+name, text)
+}
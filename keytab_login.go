@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"krb5tray/pkg/krb"
+)
+
+// keytabCheckInterval is how often the keytab renewer checks the TGT in the ccache
+const keytabCheckInterval = time.Minute
+
+// keytabRenewer gets a new TGT from the keytab whenever the one in the ccache is missing or
+// about to expire, until stopped
+type keytabRenewer struct {
+	cfg  KeytabConfig
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	keytabMutex  sync.Mutex
+	activeKeytab *keytabRenewer
+
+	// keytabLoginMutex makes concurrent callers of ensureKeytabTGT wait for one login
+	keytabLoginMutex sync.Mutex
+
+	// keytabFailing is set while logins fail, so the failure is reported once
+	keytabFailing bool
+
+	// keytabLifetime is how long the last TGT from the keytab was valid for
+	keytabLifetime time.Duration
+)
+
+// keytabTransport reports whether the configured transport reads the ccache a keytab
+// login writes: gokrb5, which is the native transport on Linux
+func keytabTransport(cfg *Config) bool {
+	transport := cfg.GetTransport()
+	return transport == krb.TransportGokrb5 || (transport == krb.TransportNative && krb.IsLinux())
+}
+
+// keytabConfig returns the keytab settings, or false if no keytab is configured or the
+// transport wouldn't use its TGT
+func keytabConfig(cfg *Config) (KeytabConfig, bool) {
+	kt := cfg.GetKeytabConfigWithDefaults()
+	return kt, kt.Path != "" && kt.Principal != "" && keytabTransport(cfg)
+}
+
+// ApplyKeytabConfig starts, restarts, or stops the keytab renewer to match cfg
+func ApplyKeytabConfig(cfg *Config) {
+	kt, enabled := keytabConfig(cfg)
+
+	keytabMutex.Lock()
+	defer keytabMutex.Unlock()
+	if activeKeytab != nil && enabled && activeKeytab.cfg == kt {
+		return
+	}
+	if activeKeytab != nil {
+		close(activeKeytab.stop)
+		<-activeKeytab.done
+		activeKeytab = nil
+	}
+
+	if !enabled {
+		return
+	}
+	activeKeytab = &keytabRenewer{
+		cfg:  kt,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go activeKeytab.run()
+	LogDebug("Renewing the TGT of %s from %s", kt.Principal, kt.Path)
+}
+
+// StopKeytabRenewal stops the keytab renewer
+func StopKeytabRenewal() {
+	keytabMutex.Lock()
+	defer keytabMutex.Unlock()
+
+	if activeKeytab != nil {
+		close(activeKeytab.stop)
+		<-activeKeytab.done
+		activeKeytab = nil
+	}
+}
+
+func (r *keytabRenewer) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(keytabCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		// Logins would only time out; the check after going back online catches up
+		if !trayOffline() && !trayIdleLocked() {
+			_, _ = ensureKeytabTGT(r.cfg, "on schedule")
+		}
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// keytabLoginDue reports whether the TGT expiring at expiry (or unreadable, with err)
+// should be replaced with one from the keytab. A KDC that issues TGTs for less than twice
+// renewBefore gets asked again at half their lifetime, not every minute.
+func keytabLoginDue(expiry time.Time, err error, renewBefore, lifetime time.Duration, now time.Time) bool {
+	if lifetime > 0 && renewBefore > lifetime/2 {
+		renewBefore = lifetime / 2
+	}
+	return err != nil || expiry.Sub(now) < renewBefore
+}
+
+// ensureKeytabTGT gets a TGT from the keytab if the ccache has none that is valid for
+// more than renew_before_sec. It reports whether it logged in; why is logged with it.
+func ensureKeytabTGT(kt KeytabConfig, why string) (bool, error) {
+	keytabLoginMutex.Lock()
+	defer keytabLoginMutex.Unlock()
+
+	expiry, err := krb.TGTExpiry(krbOptions())
+	if !keytabLoginDue(expiry, err, time.Duration(kt.RenewBeforeSec)*time.Second, keytabLifetime, time.Now()) {
+		return false, nil
+	}
+	if _, err := keytabLogin(kt, why); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// renewFromKeytab gets a new TGT from the keytab, whatever the one in the ccache, and
+// returns a status line
+func renewFromKeytab(kt KeytabConfig, why string) (string, error) {
+	keytabLoginMutex.Lock()
+	defer keytabLoginMutex.Unlock()
+	return keytabLogin(kt, why)
+}
+
+// keytabLogin gets a new TGT from the keytab and returns a status line. A failure is logged
+// and notified once, until a login succeeds again. The caller holds keytabLoginMutex.
+func keytabLogin(kt KeytabConfig, why string) (string, error) {
+	expiry, err := krb.KeytabLogin(kt.Path, kt.Principal, krbOptions())
+	if err != nil {
+		err = asTicketError(err)
+		LogWarn("Getting a TGT for %s from the keytab %s failed: %v", kt.Principal, kt.Path, err)
+		if !keytabFailing {
+			keytabFailing = true
+			notifyUser("Keytab login failed", fmt.Sprintf("%s: %s", kt.Principal, ticketErrorNotice(err)))
+		}
+		return "", err
+	}
+	keytabFailing = false
+	keytabLifetime = time.Until(expiry)
+
+	// A credential restored from the last run would still hold the old TGT
+	krb.ForgetImportedCredential()
+	refreshStatusFormat()
+	updateCredentialsMenu()
+	msg := fmt.Sprintf("TGT for %s from the keytab, valid until %s", kt.Principal, expiry.Format("2006-01-02 15:04"))
+	LogActionWithFields("keytab_login", msg+" ("+why+")", map[string]interface{}{
+		"principal": kt.Principal,
+		"keytab":    kt.Path,
+	})
+	return msg, nil
+}
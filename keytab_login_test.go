@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"krb5tray/pkg/krb"
+)
+
+func TestKeytabLoginDue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		expiry   time.Time
+		err      error
+		lifetime time.Duration
+		want     bool
+	}{
+		{"no TGT", time.Time{}, krb.ErrNoTGT, 0, true},
+		{"valid", now.Add(8 * time.Hour), nil, 0, false},
+		{"expiring", now.Add(20 * time.Minute), nil, 10 * time.Hour, true},
+		{"expired", now.Add(-time.Minute), nil, 0, true},
+		{"short lifetime", now.Add(25 * time.Minute), nil, 40 * time.Minute, false},
+		{"short lifetime, half gone", now.Add(15 * time.Minute), nil, 40 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		if got := keytabLoginDue(tt.expiry, tt.err, 30*time.Minute, tt.lifetime, now); got != tt.want {
+			t.Errorf("%s: keytabLoginDue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	cfg := &Config{Transport: krb.TransportMock, Keytab: &KeytabConfig{Path: "svc.keytab", Principal: "svc@EXAMPLE.COM"}}
+	if _, ok := keytabConfig(cfg); ok {
+		t.Error("keytab enabled with the mock transport")
+	}
+	cfg.Transport = krb.TransportGokrb5
+	if kt, ok := keytabConfig(cfg); !ok || kt.RenewBeforeSec != 1800 {
+		t.Errorf("keytabConfig = %+v, %v", kt, ok)
+	}
+}
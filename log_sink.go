@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// systemLogSource is the program name reported to syslog and the Event Log
+const systemLogSource = "krb5tray"
+
+// systemLogSink is a platform log destination (syslog, Windows Event Log)
+type systemLogSink interface {
+	write(level logrus.Level, msg string) error
+	close() error
+}
+
+// systemLogHook forwards log entries to a system log sink
+type systemLogHook struct {
+	sink      systemLogSink
+	formatter logrus.Formatter
+}
+
+var systemLogSinks []systemLogSink
+
+// newSystemLogHook creates a logrus hook for a sink. Entries are formatted without
+// timestamps since the system log records its own.
+func newSystemLogHook(sink systemLogSink) *systemLogHook {
+	return &systemLogHook{
+		sink: sink,
+		formatter: &logrus.TextFormatter{
+			DisableTimestamp: true,
+			DisableColors:    true,
+		},
+	}
+}
+
+// Levels returns all levels; the logger's own level already filters entries
+func (h *systemLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire writes a log entry to the sink
+func (h *systemLogHook) Fire(entry *logrus.Entry) error {
+	line, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	return h.sink.write(entry.Level, strings.TrimSpace(string(line)))
+}
+
+// attachSystemLogSinks adds the system log sinks enabled in the config to the logger
+func attachSystemLogSinks(cfg LogConfig) {
+	sinks, err := openSystemLogSinks(cfg)
+	if err != nil {
+		log.Warnf("Failed to open system log: %v", err)
+	}
+	for _, sink := range sinks {
+		log.AddHook(newSystemLogHook(sink))
+	}
+	systemLogSinks = sinks
+}
+
+// closeSystemLogSinks closes all open system log sinks
+func closeSystemLogSinks() {
+	for _, sink := range systemLogSinks {
+		_ = sink.close()
+	}
+	systemLogSinks = nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !windows && !linux
+// +build !darwin,!windows,!linux
+
+package main
+
+// openSystemLogSinks is not supported on this platform
+func openSystemLogSinks(cfg LogConfig) ([]systemLogSink, error) {
+	if cfg.Syslog || cfg.EventLog {
+		log.Warn("System log outputs are not supported on this platform")
+	}
+	return nil, nil
+}
@@ -0,0 +1,50 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package main
+
+import (
+	"log/syslog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogSink writes log entries to the local syslog daemon
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// openSystemLogSinks opens syslog when enabled (the Event Log is Windows-only)
+func openSystemLogSinks(cfg LogConfig) ([]systemLogSink, error) {
+	if cfg.EventLog {
+		log.Warn("event_log is only supported on Windows, ignoring")
+	}
+	if !cfg.Syslog {
+		return nil, nil
+	}
+
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, systemLogSource)
+	if err != nil {
+		return nil, err
+	}
+	return []systemLogSink{&syslogSink{w: w}}, nil
+}
+
+func (s *syslogSink) write(level logrus.Level, msg string) error {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return s.w.Crit(msg)
+	case logrus.ErrorLevel:
+		return s.w.Err(msg)
+	case logrus.WarnLevel:
+		return s.w.Warning(msg)
+	case logrus.InfoLevel:
+		return s.w.Info(msg)
+	default:
+		return s.w.Debug(msg)
+	}
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,58 @@
+//go:build windows
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows"
+)
+
+// eventLogID is the event ID used for all krb5tray entries
+const eventLogID = 1
+
+// eventLogSink writes log entries to the Windows Application event log
+type eventLogSink struct {
+	handle windows.Handle
+}
+
+// openSystemLogSinks opens the Event Log when enabled (syslog is not available on Windows)
+func openSystemLogSinks(cfg LogConfig) ([]systemLogSink, error) {
+	if cfg.Syslog {
+		log.Warn("syslog is not supported on Windows, use event_log instead")
+	}
+	if !cfg.EventLog {
+		return nil, nil
+	}
+
+	source, err := windows.UTF16PtrFromString(systemLogSource)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.RegisterEventSource(nil, source)
+	if err != nil {
+		return nil, err
+	}
+	return []systemLogSink{&eventLogSink{handle: handle}}, nil
+}
+
+func (s *eventLogSink) write(level logrus.Level, msg string) error {
+	var etype uint16
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		etype = windows.EVENTLOG_ERROR_TYPE
+	case logrus.WarnLevel:
+		etype = windows.EVENTLOG_WARNING_TYPE
+	default:
+		etype = windows.EVENTLOG_INFORMATION_TYPE
+	}
+
+	str, err := windows.UTF16PtrFromString(msg)
+	if err != nil {
+		return err
+	}
+	return windows.ReportEvent(s.handle, etype, 0, eventLogID, 0, 1, 0, &str, nil)
+}
+
+func (s *eventLogSink) close() error {
+	return windows.DeregisterEventSource(s.handle)
+}
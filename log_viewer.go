@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultLogViewLines is the number of log lines shown by View Log
+const DefaultLogViewLines = 500
+
+// maxLogTailBytes bounds how much of the log file is read to find the last lines
+const maxLogTailBytes = 1 << 20
+
+// logViewLine is a log line with the CSS class for its severity
+type logViewLine struct {
+	Text  string
+	Level string
+}
+
+var logViewTemplate = template.Must(template.New("logview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>krb5tray log</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 0; background: #1e1e1e; color: #d4d4d4; }
+header { position: sticky; top: 0; padding: 8px 12px; background: #2d2d2d; border-bottom: 1px solid #444; }
+header span { color: #999; font-size: 12px; margin-left: 12px; }
+button { font-size: 13px; padding: 3px 10px; }
+pre { margin: 0; padding: 8px 12px; font: 12px/1.4 Menlo, Consolas, monospace; white-space: pre-wrap; word-break: break-all; }
+.error, .fatal, .panic { color: #f48771; }
+.warning { color: #dcdcaa; }
+.info { color: #d4d4d4; }
+.debug, .trace { color: #808080; }
+</style>
+</head>
+<body>
+<header>
+<button onclick="copyLog()">Copy</button>
+<span>{{.Path}} &mdash; last {{len .Lines}} lines at {{.Generated}}</span>
+<span id="copied"></span>
+</header>
+<pre id="log">{{range .Lines}}<span class="{{.Level}}">{{.Text}}</span>
+{{end}}</pre>
+<script>
+function copyLog() {
+  var text = document.getElementById("log").innerText;
+  var done = function() { document.getElementById("copied").textContent = "Copied"; };
+  if (navigator.clipboard && window.isSecureContext) {
+    navigator.clipboard.writeText(text).then(done);
+    return;
+  }
+  var ta = document.createElement("textarea");
+  ta.value = text;
+  document.body.appendChild(ta);
+  ta.select();
+  document.execCommand("copy");
+  document.body.removeChild(ta);
+  done();
+}
+window.scrollTo(0, document.body.scrollHeight);
+</script>
+</body>
+</html>
+`))
+
+// tailLogLines returns up to n of the last lines of the file at path
+func tailLogLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-maxLogTailBytes, 0)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if offset > 0 && len(lines) > 1 {
+		lines = lines[1:] // First line is probably partial
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// logLineLevel extracts the logrus level from a text-formatted line
+func logLineLevel(line string) string {
+	_, rest, found := strings.Cut(line, "level=")
+	if !found {
+		return "info"
+	}
+	level, _, _ := strings.Cut(rest, " ")
+	return level
+}
+
+// renderLogView renders the log lines as an HTML page
+func renderLogView(path string, lines []string) ([]byte, error) {
+	viewLines := make([]logViewLine, len(lines))
+	for i, line := range lines {
+		viewLines[i] = logViewLine{Text: line, Level: logLineLevel(line)}
+	}
+
+	var buf bytes.Buffer
+	err := logViewTemplate.Execute(&buf, struct {
+		Path      string
+		Generated string
+		Lines     []logViewLine
+	}{
+		Path:      path,
+		Generated: time.Now().Format("15:04:05"),
+		Lines:     viewLines,
+	})
+	return buf.Bytes(), err
+}
+
+// fileURL converts a local path to a file:// URL
+func fileURL(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // Windows drive letter paths
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// openLogViewer writes a snapshot of the last n log lines to an HTML page and opens it
+func openLogViewer(n int) error {
+	logPath := GetLogPath()
+	lines, err := tailLogLines(logPath, n)
+	if err != nil {
+		return err
+	}
+
+	page, err := renderLogView(logPath, lines)
+	if err != nil {
+		return err
+	}
+
+	viewPath := filepath.Join(ConfigDir(), "log-view.html")
+	if err := os.WriteFile(viewPath, page, 0600); err != nil {
+		return err
+	}
+	return openBrowser(fileURL(viewPath))
+}
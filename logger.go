@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,6 +15,32 @@ import (
 
 var log *logrus.Logger
 
+// LogLevels lists the selectable log levels, least to most verbose
+var LogLevels = []string{"error", "warn", "info", "debug", "trace"}
+
+var (
+	levelMutex    sync.Mutex
+	selectedLevel = logrus.InfoLevel // Level chosen in config or the Log Level menu
+	debugOverride bool               // Debug Mode raises the effective level to at least debug
+)
+
+// ParseLogLevel converts a level name from the config into a logrus level
+func ParseLogLevel(name string) (logrus.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "error":
+		return logrus.ErrorLevel, nil
+	case "warn", "warning":
+		return logrus.WarnLevel, nil
+	case "info", "":
+		return logrus.InfoLevel, nil
+	case "debug":
+		return logrus.DebugLevel, nil
+	case "trace":
+		return logrus.TraceLevel, nil
+	}
+	return logrus.InfoLevel, fmt.Errorf("unknown log level %q (use error, warn, info, debug, or trace)", name)
+}
+
 // InitLogger initializes the logger with file rotation using default config
 // Logs are written to ~/.config/ktray/ktray.log
 func InitLogger() error {
@@ -56,30 +84,99 @@ func InitLoggerWithConfig(cfg LogConfig) error {
 		DisableColors:   true, // No colors in log file
 	})
 
-	// Default to Info level, Debug mode will change this
-	log.SetLevel(logrus.InfoLevel)
+	// Apply the configured level (Debug mode may raise it later)
+	level, err := ParseLogLevel(cfg.Level)
+	levelMutex.Lock()
+	selectedLevel = level
+	levelMutex.Unlock()
+	applyLogLevel()
+	if err != nil {
+		log.Warnf("%v, using info", err)
+	}
+
+	// Optionally mirror logs to syslog / the Windows Event Log
+	attachSystemLogSinks(cfg)
 
 	log.WithFields(logrus.Fields{
+		"level":        level.String(),
 		"max_size_mb":  cfg.MaxSizeMB,
 		"max_backups":  cfg.MaxBackups,
 		"max_age_days": cfg.MaxAgeDays,
 		"compress":     cfg.Compress,
 		"to_stdout":    cfg.ToStdout,
+		"syslog":       cfg.Syslog,
+		"event_log":    cfg.EventLog,
 	}).Info("Logger initialized")
 	return nil
 }
 
-// SetLogLevel sets the logging level based on debug mode
+// SetLogLevel raises the log level to at least debug while debug mode is on,
+// restoring the selected level when it is turned off
 func SetLogLevel(debug bool) {
+	levelMutex.Lock()
+	debugOverride = debug
+	levelMutex.Unlock()
+	applyLogLevel()
+
 	if log == nil {
 		return
 	}
 	if debug {
-		log.SetLevel(logrus.DebugLevel)
 		log.Debug("Debug logging enabled")
 	} else {
-		log.SetLevel(logrus.InfoLevel)
-		log.Info("Debug logging disabled")
+		log.Infof("Debug logging disabled (level: %s)", CurrentLogLevel())
+	}
+}
+
+// SetLogLevelName selects the log level by name (used by the config and the Log Level menu)
+func SetLogLevelName(name string) error {
+	level, err := ParseLogLevel(name)
+	if err != nil {
+		return err
+	}
+	levelMutex.Lock()
+	selectedLevel = level
+	levelMutex.Unlock()
+	applyLogLevel()
+
+	LogInfo("Log level set to %s", level.String())
+	return nil
+}
+
+// SelectedLogLevel returns the name of the level chosen in the config or menu
+func SelectedLogLevel() string {
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	return normalizeLevelName(selectedLevel)
+}
+
+// CurrentLogLevel returns the name of the effective log level
+func CurrentLogLevel() string {
+	return normalizeLevelName(effectiveLogLevel())
+}
+
+// normalizeLevelName maps a logrus level to the names used in LogLevels
+func normalizeLevelName(level logrus.Level) string {
+	if level == logrus.WarnLevel {
+		return "warn"
+	}
+	return level.String()
+}
+
+// effectiveLogLevel combines the selected level with the debug mode override
+func effectiveLogLevel() logrus.Level {
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+	if debugOverride && selectedLevel < logrus.DebugLevel {
+		return logrus.DebugLevel
+	}
+	return selectedLevel
+}
+
+// applyLogLevel updates the logger to the effective level
+func applyLogLevel() {
+	if log != nil {
+		log.SetLevel(effectiveLogLevel())
 	}
 }
 
@@ -90,6 +187,13 @@ func LogInfo(format string, args ...interface{}) {
 	}
 }
 
+// LogTrace logs a trace level message (only at trace level)
+func LogTrace(format string, args ...interface{}) {
+	if log != nil {
+		log.Tracef(format, args...)
+	}
+}
+
 // LogDebug logs a debug level message (only when debug mode is on)
 func LogDebug(format string, args ...interface{}) {
 	if log != nil {
@@ -119,6 +223,7 @@ func LogAction(action string, details string) {
 			"action": action,
 		}).Info(details)
 	}
+	recordHistory(action, details, nil)
 }
 
 // LogActionWithFields logs a business action with additional fields
@@ -130,6 +235,7 @@ func LogActionWithFields(action string, details string, fields map[string]interf
 		}
 		log.WithFields(f).Info(details)
 	}
+	recordHistory(action, details, fields)
 }
 
 // LogStartup logs application startup information
@@ -149,6 +255,7 @@ func LogStartup() {
 func LogShutdown() {
 	if log != nil {
 		log.Info("krb5tray shutting down")
+		closeSystemLogSinks()
 	}
 }
 
@@ -172,6 +279,9 @@ func LogSPNSelected(displayName string) {
 
 // LogTicketRequested logs when a ticket is requested
 func LogTicketRequested(displayName string, success bool, tokenSize int) {
+	if log == nil {
+		return
+	}
 	if success {
 		log.WithFields(logrus.Fields{
 			"action":     "ticket_request",
@@ -184,6 +294,11 @@ func LogTicketRequested(displayName string, success bool, tokenSize int) {
 			"spn":    displayName,
 		}).Warn("Ticket request failed")
 	}
+	if success {
+		recordHistory("ticket_request", fmt.Sprintf("Ticket obtained: %s", displayName), map[string]interface{}{"spn": displayName, "token_size": tokenSize})
+	} else {
+		recordHistory("ticket_request", fmt.Sprintf("Ticket request failed: %s", displayName), map[string]interface{}{"spn": displayName, "failed": true})
+	}
 }
 
 // LogClipboardCopy logs clipboard operations (without exposing content)
@@ -203,6 +318,9 @@ func LogSSHOpened(name string) {
 
 // LogScriptExecuted logs when a Lua script is executed
 func LogScriptExecuted(scriptName string, entryType string, err error) {
+	if log == nil {
+		return
+	}
 	status := "success"
 	fields := logrus.Fields{
 		"action":     "script_executed",
@@ -215,6 +333,8 @@ func LogScriptExecuted(scriptName string, entryType string, err error) {
 	}
 	fields["status"] = status
 	log.WithFields(fields).Info(fmt.Sprintf("Script executed: %s", scriptName))
+	delete(fields, "action")
+	recordHistory("script_executed", fmt.Sprintf("Script executed: %s", scriptName), fields)
 }
 
 // LogHotkeyTriggered logs when a hotkey is triggered
@@ -243,4 +363,4 @@ func GetLogPath() string {
 // Helper to get current timestamp for logging
 func logTimestamp() string {
 	return time.Now().Format("2006-01-02 15:04:05")
-}
\ No newline at end of file
+}
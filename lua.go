@@ -1,17 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/itchyny/gojq"
 	lua "github.com/yuin/gopher-lua"
+
+	"krb5tray/internal/cache"
 )
 
 // LuaEngine manages Lua script execution
@@ -20,16 +24,28 @@ type LuaEngine struct {
 }
 
 // Global Lua engine instance
-var luaEngine *LuaEngine
+var (
+	luaEngine      *LuaEngine
+	luaEngineOnce  sync.Once
+	luaEngineReady = make(chan struct{})
+)
 
 // InitLuaEngine initializes the global Lua engine
 func InitLuaEngine() error {
-	luaEngine = &LuaEngine{}
-	return luaEngine.Init()
+	var err error
+	luaEngineOnce.Do(func() {
+		luaEngine = &LuaEngine{}
+		err = luaEngine.Init()
+		close(luaEngineReady)
+	})
+	return err
 }
 
-// GetLuaEngine returns the global Lua engine
+// GetLuaEngine returns the global Lua engine, waiting for InitLuaEngine if the tray is
+// still starting up. It never returns nil: a failed Init still leaves an engine, whose
+// scripts fail on their own.
 func GetLuaEngine() *LuaEngine {
+	<-luaEngineReady
 	return luaEngine
 }
 
@@ -62,6 +78,7 @@ func (e *LuaEngine) registerKtrayModule() {
 	// Clipboard functions
 	e.state.SetField(ktray, "copy", e.state.NewFunction(luaCopy))
 	e.state.SetField(ktray, "paste", e.state.NewFunction(luaPaste))
+	e.state.SetField(ktray, "type_text", e.state.NewFunction(luaTypeText))
 
 	// Browser/URL functions
 	e.state.SetField(ktray, "open_url", e.state.NewFunction(luaOpenURL))
@@ -73,6 +90,8 @@ func (e *LuaEngine) registerKtrayModule() {
 	// Kerberos functions
 	e.state.SetField(ktray, "get_token", e.state.NewFunction(luaGetToken))
 	e.state.SetField(ktray, "get_spn", e.state.NewFunction(luaGetSPN))
+	e.state.SetField(ktray, "spn_for_url", e.state.NewFunction(luaSPNForURL))
+	e.state.SetField(ktray, "http_negotiate", e.state.NewFunction(luaHTTPNegotiate))
 
 	// Shell execution
 	e.state.SetField(ktray, "exec", e.state.NewFunction(luaExec))
@@ -93,6 +112,8 @@ func (e *LuaEngine) registerKtrayModule() {
 	e.state.SetField(ktray, "cache_set", e.state.NewFunction(luaCacheSet))
 	e.state.SetField(ktray, "cache_delete", e.state.NewFunction(luaCacheDelete))
 	e.state.SetField(ktray, "cache_keys", e.state.NewFunction(luaCacheKeys))
+	e.state.SetField(ktray, "jwt_set", e.state.NewFunction(luaJWTSet))
+	e.state.SetField(ktray, "jwt_get", e.state.NewFunction(luaJWTGet))
 
 	// Encoding functions
 	e.state.SetField(ktray, "base64_encode", e.state.NewFunction(luaBase64Encode))
@@ -117,13 +138,17 @@ func (e *LuaEngine) registerKtrayModule() {
 
 	// Register the module
 	e.state.SetGlobal("ktray", ktray)
+	installSignedLoaders(e.state)
 }
 
-// Registry key for HTTP session
-const httpSessionKey = "ktray_http_session"
+// Registry keys for the HTTP session and the script run (a *scriptRun)
+const (
+	httpSessionKey = "ktray_http_session"
+	scriptRunKey   = "ktray_script_run"
+)
 
 // RunScript executes a Lua script file with optional context variables
-func (e *LuaEngine) RunScript(scriptName string, context map[string]string) (string, error) {
+func (e *LuaEngine) RunScript(scriptName string, context map[string]string) (output string, runErr error) {
 	scriptPath := ScriptPath(scriptName)
 
 	// Check if script exists
@@ -131,24 +156,46 @@ func (e *LuaEngine) RunScript(scriptName string, context map[string]string) (str
 		return "", fmt.Errorf("script not found: %s", scriptPath)
 	}
 
-	// Create a new Lua state for this execution (isolation)
-	L := lua.NewState()
-	defer L.Close()
+	// Run what was verified, so the file can't be swapped between the check and the run
+	cfg := currentConfig()
+	source, err := readSignedFile(scriptPath, cfg.GetSigningConfigWithDefaults())
+	if err != nil {
+		LogWarn("Refusing to run script %s: %v", scriptName, err)
+		return "", fmt.Errorf("script rejected: %w", err)
+	}
+	caps, err := scriptCapabilities(cfg, scriptName)
+	if err != nil {
+		LogWarn("Refusing to run script %s: %v", scriptName, err)
+		return "", fmt.Errorf("script rejected: %w", err)
+	}
+
+	// Take a pooled state with those capabilities, or a new one if the script needs full isolation
+	L, release := acquireLuaState(scriptName, caps)
+	defer func() { release(runErr != nil) }()
 
 	// Create HTTP session with cookie jar for this script execution
-	// Using skipVerify=true as default since most scripts need it
-	httpSession, err := NewHTTPSession(true)
+	// Using skipVerify=true as default since most scripts need it, unless the policy forbids it
+	httpSession, err := NewHTTPSession(currentConfig().InsecureTLSAllowed())
 	if err != nil {
 		return "", fmt.Errorf("failed to create HTTP session: %w", err)
 	}
 
+	// Trace the script run; HTTP requests made through the session become child spans
+	span := StartSpan("lua.script")
+	span.SetAttr("script.name", scriptName)
+	defer func() { span.End(runErr) }()
+	httpSession.span = span
+	httpSession.source = scriptName
+
 	// Store session in registry so HTTP functions can access it
 	ud := L.NewUserData()
 	ud.Value = httpSession
 	L.SetField(L.Get(lua.RegistryIndex).(*lua.LTable), httpSessionKey, ud)
 
-	// Copy ktray module to new state
-	e.registerKtrayModuleToState(L)
+	// Values the script caches remember this run, so Refresh All can run it again
+	run := L.NewUserData()
+	run.Value = &scriptRun{script: scriptName, ctx: context}
+	L.SetField(L.Get(lua.RegistryIndex).(*lua.LTable), scriptRunKey, run)
 
 	// Set context variables
 	ctx := L.NewTable()
@@ -161,7 +208,12 @@ func (e *LuaEngine) RunScript(scriptName string, context map[string]string) (str
 	L.SetGlobal("result", lua.LNil)
 
 	// Execute script
-	if err := L.DoFile(scriptPath); err != nil {
+	fn, err := L.Load(bytes.NewReader(source), scriptPath)
+	if err != nil {
+		return "", fmt.Errorf("script error: %w", err)
+	}
+	L.Push(fn)
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
 		return "", fmt.Errorf("script error: %w", err)
 	}
 
@@ -174,19 +226,47 @@ func (e *LuaEngine) RunScript(scriptName string, context map[string]string) (str
 	return "", nil
 }
 
-// registerKtrayModuleToState registers ktray functions to a specific Lua state
-func (e *LuaEngine) registerKtrayModuleToState(L *lua.LState) {
+// registerKtrayModuleToState registers the ktray functions that caps permits to a specific
+// Lua state
+func (e *LuaEngine) registerKtrayModuleToState(L *lua.LState, caps luaCaps) {
 	ktray := L.NewTable()
 
-	L.SetField(ktray, "copy", L.NewFunction(luaCopy))
-	L.SetField(ktray, "paste", L.NewFunction(luaPaste))
-	L.SetField(ktray, "open_url", L.NewFunction(luaOpenURL))
-	L.SetField(ktray, "http_get", L.NewFunction(luaHTTPGet))
-	L.SetField(ktray, "http_post", L.NewFunction(luaHTTPPost))
-	L.SetField(ktray, "get_token", L.NewFunction(luaGetToken))
+	if caps&luaCapClipboard != 0 {
+		L.SetField(ktray, "copy", L.NewFunction(luaCopy))
+		L.SetField(ktray, "paste", L.NewFunction(luaPaste))
+		L.SetField(ktray, "type_text", L.NewFunction(luaTypeText))
+	}
+	if caps&luaCapBrowser != 0 {
+		L.SetField(ktray, "open_url", L.NewFunction(luaOpenURL))
+	}
+	if caps&luaCapHTTP != 0 {
+		L.SetField(ktray, "http_get", L.NewFunction(luaHTTPGet))
+		L.SetField(ktray, "http_post", L.NewFunction(luaHTTPPost))
+	}
+	if caps&luaCapSecrets != 0 {
+		L.SetField(ktray, "get_token", L.NewFunction(luaGetToken))
+	}
 	L.SetField(ktray, "get_spn", L.NewFunction(luaGetSPN))
-	L.SetField(ktray, "exec", L.NewFunction(luaExec))
-	L.SetField(ktray, "shell", L.NewFunction(luaShell))
+	L.SetField(ktray, "spn_for_url", L.NewFunction(luaSPNForURL))
+	if caps&luaCapHTTP != 0 && caps&luaCapSecrets != 0 {
+		L.SetField(ktray, "http_negotiate", L.NewFunction(luaHTTPNegotiate))
+	}
+	if caps&luaCapExec != 0 {
+		L.SetField(ktray, "exec", L.NewFunction(luaExec))
+		L.SetField(ktray, "shell", L.NewFunction(luaShell))
+	} else {
+		// The standard library can run commands too, and end the tray's process
+		if osLib, ok := L.GetGlobal("os").(*lua.LTable); ok {
+			L.SetField(osLib, "execute", lua.LNil)
+			L.SetField(osLib, "exit", lua.LNil)
+		}
+		if ioLib, ok := L.GetGlobal("io").(*lua.LTable); ok {
+			L.SetField(ioLib, "popen", lua.LNil)
+		}
+	}
+	if caps&luaCapFiles == 0 {
+		restrictLuaFileWrites(L)
+	}
 	L.SetField(ktray, "set_status", L.NewFunction(luaSetStatus))
 	L.SetField(ktray, "notify", L.NewFunction(luaNotify))
 	L.SetField(ktray, "sleep", L.NewFunction(luaSleep))
@@ -195,10 +275,14 @@ func (e *LuaEngine) registerKtrayModuleToState(L *lua.LState) {
 	L.SetField(ktray, "info", L.NewFunction(luaInfo))
 
 	// Cache functions
-	L.SetField(ktray, "cache_get", L.NewFunction(luaCacheGet))
-	L.SetField(ktray, "cache_set", L.NewFunction(luaCacheSet))
-	L.SetField(ktray, "cache_delete", L.NewFunction(luaCacheDelete))
-	L.SetField(ktray, "cache_keys", L.NewFunction(luaCacheKeys))
+	if caps&luaCapSecrets != 0 {
+		L.SetField(ktray, "cache_get", L.NewFunction(luaCacheGet))
+		L.SetField(ktray, "cache_set", L.NewFunction(luaCacheSet))
+		L.SetField(ktray, "cache_delete", L.NewFunction(luaCacheDelete))
+		L.SetField(ktray, "cache_keys", L.NewFunction(luaCacheKeys))
+		L.SetField(ktray, "jwt_set", L.NewFunction(luaJWTSet))
+		L.SetField(ktray, "jwt_get", L.NewFunction(luaJWTGet))
+	}
 
 	// Encoding functions
 	L.SetField(ktray, "base64_encode", L.NewFunction(luaBase64Encode))
@@ -222,6 +306,7 @@ func (e *LuaEngine) registerKtrayModuleToState(L *lua.LState) {
 	L.SetField(ktray, "html_val", L.NewFunction(luaHTMLVal))
 
 	L.SetGlobal("ktray", ktray)
+	installSignedLoaders(L)
 }
 
 // Lua function implementations
@@ -229,7 +314,10 @@ func (e *LuaEngine) registerKtrayModuleToState(L *lua.LState) {
 // luaCopy copies text to clipboard: ktray.copy(text)
 func luaCopy(L *lua.LState) int {
 	text := L.CheckString(1)
-	err := copyToClipboard(text)
+	copied, err := copyOutputToClipboard("script", text, requesterScript)
+	if err == nil && !copied {
+		err = fmt.Errorf("copy declined")
+	}
 	if err != nil {
 		L.Push(lua.LFalse)
 		L.Push(lua.LString(err.Error()))
@@ -247,6 +335,19 @@ func luaPaste(L *lua.LState) int {
 	return 1
 }
 
+// luaTypeText types text into the focused window as keystrokes: ktray.type_text(text) -> ok, error
+// The text never goes through the clipboard, so clipboard managers can't record it
+func luaTypeText(L *lua.LState) int {
+	text := L.CheckString(1)
+	if err := typeText(text); err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
+
 // luaOpenURL opens a URL in the browser: ktray.open_url(url)
 func luaOpenURL(L *lua.LState) int {
 	url := L.CheckString(1)
@@ -261,6 +362,17 @@ func luaOpenURL(L *lua.LState) int {
 }
 
 // getHTTPSession retrieves the HTTP session from the Lua state's registry
+// currentScriptRun returns the run of the script L is executing, or nil
+func currentScriptRun(L *lua.LState) *scriptRun {
+	reg := L.Get(lua.RegistryIndex).(*lua.LTable)
+	if userData, ok := L.GetField(reg, scriptRunKey).(*lua.LUserData); ok {
+		if run, ok := userData.Value.(*scriptRun); ok {
+			return run
+		}
+	}
+	return nil
+}
+
 func getHTTPSession(L *lua.LState) *HTTPSession {
 	reg := L.Get(lua.RegistryIndex).(*lua.LTable)
 	ud := L.GetField(reg, httpSessionKey)
@@ -282,6 +394,11 @@ func luaHTTPGet(L *lua.LState) int {
 	headersTable := L.OptTable(2, nil)
 	timeoutSec := L.OptNumber(3, 0)   // 0 means use default
 	skipVerify := L.OptBool(4, false) // Skip TLS certificate verification (ignored when session exists)
+	if err := checkTLSPolicy(skipVerify); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
 
 	// Build headers map
 	headers := make(map[string]string)
@@ -321,6 +438,11 @@ func luaHTTPPost(L *lua.LState) int {
 	headersTable := L.OptTable(3, nil)
 	timeoutSec := L.OptNumber(4, 0)   // 0 means use default
 	skipVerify := L.OptBool(5, false) // Skip TLS certificate verification (ignored when session exists)
+	if err := checkTLSPolicy(skipVerify); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
 
 	// Build headers map
 	headers := make(map[string]string)
@@ -357,11 +479,16 @@ func luaHTTPPost(L *lua.LState) int {
 // If spn_name is not provided, it returns the current cached token
 func luaGetToken(L *lua.LState) int {
 	spnName := L.OptString(1, "")
+	if err := requireSecurityKey(securityKeyTokens, "Hand a token to a script"); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
 
 	// If no SPN name provided, return the current token
 	if spnName == "" {
 		stateMutex.RLock()
-		token := lastToken
+		token := lastToken.String()
 		stateMutex.RUnlock()
 
 		if token == "" {
@@ -374,9 +501,7 @@ func luaGetToken(L *lua.LState) int {
 	}
 
 	// Look up the SPN by name in config
-	stateMutex.RLock()
-	cfg := appConfig
-	stateMutex.RUnlock()
+	cfg := currentConfig()
 
 	if cfg == nil {
 		L.Push(lua.LNil)
@@ -386,13 +511,8 @@ func luaGetToken(L *lua.LState) int {
 
 	// Find SPN entry by name (case-insensitive partial match)
 	var spnValue string
-	spnNameLower := strings.ToLower(spnName)
-	for _, entry := range cfg.SPNs {
-		if strings.ToLower(entry.Name) == spnNameLower ||
-			strings.Contains(strings.ToLower(entry.Name), spnNameLower) {
-			spnValue = entry.SPN
-			break
-		}
+	if entry, found := cfg.FindSPN(spnName); found {
+		spnValue = entry.SPN
 	}
 
 	if spnValue == "" {
@@ -401,25 +521,13 @@ func luaGetToken(L *lua.LState) int {
 		return 2
 	}
 
-	// Check cache first
-	if cachedToken, found := GetCache().GetToken(spnValue); found {
-		L.Push(lua.LString(cachedToken))
-		return 1
-	}
-
-	// Request a new token for this SPN
-	token, err := getServiceTicket(spnValue)
+	encodedToken, err := getCachedServiceToken(cfg, spnValue, false)
 	if err != nil {
 		L.Push(lua.LNil)
 		L.Push(lua.LString("failed to get token: " + err.Error()))
 		return 2
 	}
 
-	// Encode and cache the token
-	encodedToken := base64.StdEncoding.EncodeToString(token)
-	GetCache().SetToken(spnValue, encodedToken, DefaultTokenExpiration)
-	updateCacheMenu()
-
 	L.Push(lua.LString(encodedToken))
 	return 1
 }
@@ -477,24 +585,36 @@ func luaShell(L *lua.LState) int {
 // luaSetStatus sets the status line: ktray.set_status(text)
 func luaSetStatus(L *lua.LState) int {
 	text := L.CheckString(1)
-	mStatus.SetTitle(text)
+	setScriptStatus(text)
 	return 0
 }
 
-// luaNotify shows a notification (placeholder): ktray.notify(title, message)
+// luaNotify shows a desktop notification where supported, and the text in the status
+// line: ktray.notify(title, message)
 func luaNotify(L *lua.LState) int {
 	title := L.CheckString(1)
 	message := L.OptString(2, "")
 
-	// For now, just update status - could add proper notifications later
+	if mStatus != nil {
+		notifyUser(title, message)
+	}
 	if message != "" {
-		mStatus.SetTitle(fmt.Sprintf("%s: %s", title, message))
+		setScriptStatus(fmt.Sprintf("%s: %s", title, message))
 	} else {
-		mStatus.SetTitle(title)
+		setScriptStatus(title)
 	}
 	return 0
 }
 
+// setScriptStatus shows a script's status text in the tray, or on stderr when run headless
+func setScriptStatus(text string) {
+	if mStatus == nil {
+		_, _ = fmt.Fprintln(os.Stderr, text)
+		return
+	}
+	setStatus(text)
+}
+
 // luaSleep pauses execution: ktray.sleep(milliseconds)
 func luaSleep(L *lua.LState) int {
 	ms := L.CheckInt(1)
@@ -547,14 +667,17 @@ func luaCacheGet(L *lua.LState) int {
 }
 
 // luaCacheSet stores a value in cache: ktray.cache_set(key, value, ttl_seconds)
-// ttl_seconds is optional, defaults to 10 minutes
+// ttl_seconds is optional, defaults to 10 minutes, or cache.secret_ttl_sec for "secret:" keys
 func luaCacheSet(L *lua.LState) int {
 	key := L.CheckString(1)
 	value := L.CheckString(2)
-	ttlSeconds := L.OptInt(3, 600) // Default: 10 minutes
-
-	ttl := time.Duration(ttlSeconds) * time.Second
+	defaultTTL := 10 * time.Minute
+	if strings.HasPrefix(key, cache.PrefixSecret) {
+		defaultTTL = configOrFile().GetSecretTTL()
+	}
+	ttl := time.Duration(L.OptInt(3, int(defaultTTL/time.Second))) * time.Second
 	GetCache().Set(key, value, ttl)
+	trackCachedValue(key, currentScriptRun(L))
 
 	// Update the cache menu to reflect the new entry
 	updateCacheMenu()
@@ -563,6 +686,33 @@ func luaCacheSet(L *lua.LState) int {
 	return 1
 }
 
+// luaJWTSet caches a JWT for the JWTs menu: ktray.jwt_set(key, token, ttl_seconds) -> true or nil, error
+// ttl_seconds is optional; by default the token is kept until its exp claim
+func luaJWTSet(L *lua.LState) int {
+	key := L.CheckString(1)
+	token := L.CheckString(2)
+	ttl := time.Duration(L.OptInt(3, 0)) * time.Second
+
+	if err := storeJWT(key, token, ttl); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	trackCachedValue(cache.PrefixJWT+key, currentScriptRun(L))
+	L.Push(lua.LTrue)
+	return 1
+}
+
+// luaJWTGet returns a JWT cached with jwt_set: ktray.jwt_get(key) -> token, found
+func luaJWTGet(L *lua.LState) int {
+	key := L.CheckString(1)
+
+	token, found := GetCache().GetJWT(key)
+	L.Push(lua.LString(token))
+	L.Push(lua.LBool(found))
+	return 2
+}
+
 // luaCacheDelete removes a value from cache: ktray.cache_delete(key)
 func luaCacheDelete(L *lua.LState) int {
 	key := L.CheckString(1)
@@ -628,31 +778,10 @@ func luaBase64Decode(L *lua.LState) int {
 func luaJWTDecode(L *lua.LState) int {
 	token := L.CheckString(1)
 
-	// Remove "Bearer " prefix if present
-	token = strings.TrimPrefix(token, "Bearer ")
-	token = strings.TrimPrefix(token, "bearer ")
-
-	// Split JWT into parts
-	parts := strings.Split(token, ".")
-	if len(parts) != 3 {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("invalid JWT format: expected 3 parts separated by '.'"))
-		return 2
-	}
-
-	// Decode header
-	headerJSON, err := base64URLDecode(parts[0])
+	headerJSON, payloadJSON, signature, err := splitJWT(token)
 	if err != nil {
 		L.Push(lua.LNil)
-		L.Push(lua.LString("failed to decode header: " + err.Error()))
-		return 2
-	}
-
-	// Decode payload
-	payloadJSON, err := base64URLDecode(parts[1])
-	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("failed to decode payload: " + err.Error()))
+		L.Push(lua.LString(err.Error()))
 		return 2
 	}
 
@@ -684,7 +813,7 @@ func luaJWTDecode(L *lua.LState) int {
 	L.SetField(result, "payload", payloadTable)
 
 	// Keep signature as base64 string
-	L.SetField(result, "signature", lua.LString(parts[2]))
+	L.SetField(result, "signature", lua.LString(signature))
 
 	// Also provide raw JSON strings for convenience
 	L.SetField(result, "header_json", lua.LString(string(headerJSON)))
@@ -748,14 +877,6 @@ func luaJQ(L *lua.LState) int {
 	jsonStr := L.CheckString(1)
 	queryStr := L.CheckString(2)
 
-	// Parse the jq query
-	query, err := gojq.Parse(queryStr)
-	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("jq parse error: " + err.Error()))
-		return 2
-	}
-
 	// Parse the JSON input
 	var input interface{}
 	if err := json.Unmarshal([]byte(jsonStr), &input); err != nil {
@@ -764,22 +885,11 @@ func luaJQ(L *lua.LState) int {
 		return 2
 	}
 
-	// Execute the query
-	iter := query.Run(input)
-
-	// Collect all results
-	var results []interface{}
-	for {
-		v, ok := iter.Next()
-		if !ok {
-			break
-		}
-		if err, isErr := v.(error); isErr {
-			L.Push(lua.LNil)
-			L.Push(lua.LString("jq error: " + err.Error()))
-			return 2
-		}
-		results = append(results, v)
+	results, err := runJQ(input, queryStr)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
 	}
 
 	// Return results
@@ -797,6 +907,28 @@ func luaJQ(L *lua.LState) int {
 	}
 }
 
+// runJQ runs a jq query on parsed JSON and returns all its results
+func runJQ(input interface{}, queryStr string) ([]interface{}, error) {
+	query, err := gojq.Parse(queryStr)
+	if err != nil {
+		return nil, fmt.Errorf("jq parse error: %w", err)
+	}
+
+	iter := query.Run(input)
+	var results []interface{}
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := v.(error); isErr {
+			return nil, fmt.Errorf("jq error: %w", err)
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
 // luaJSONParse parses a JSON string into a Lua table: ktray.json_parse(json_string) -> table, error
 func luaJSONParse(L *lua.LState) int {
 	jsonStr := L.CheckString(1)
@@ -1093,4 +1225,4 @@ func luaHTMLVal(L *lua.LState) int {
 
 	L.Push(lua.LString(value))
 	return 1
-}
\ No newline at end of file
+}
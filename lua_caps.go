@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaCaps is the set of capabilities a script was granted. Functions outside it aren't
+// registered in the script's state, so the script can't call them at all.
+type luaCaps uint8
+
+const (
+	luaCapExec      luaCaps = 1 << iota // ktray.exec, ktray.shell, os.execute, io.popen, os.exit
+	luaCapHTTP                          // ktray.http_get, ktray.http_post (and ktray.http_negotiate with secrets)
+	luaCapClipboard                     // ktray.copy, ktray.paste, ktray.type_text
+	luaCapSecrets                       // ktray.get_token, ktray.cache_*
+	luaCapFiles                         // io.open for writing, io.output, os.remove, os.rename, os.tmpname
+	luaCapBrowser                       // ktray.open_url
+
+	luaCapAll = luaCapExec | luaCapHTTP | luaCapClipboard | luaCapSecrets | luaCapFiles | luaCapBrowser
+)
+
+// luaCapNames maps the names used in lua.permissions to capabilities
+var luaCapNames = map[string]luaCaps{
+	"exec":      luaCapExec,
+	"http":      luaCapHTTP,
+	"clipboard": luaCapClipboard,
+	"secrets":   luaCapSecrets,
+	"files":     luaCapFiles,
+	"browser":   luaCapBrowser,
+}
+
+// parseLuaCaps converts capability names to a set, rejecting unknown names
+func parseLuaCaps(names []string) (luaCaps, error) {
+	var caps luaCaps
+	for _, name := range names {
+		c, ok := luaCapNames[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown capability %q (want %s)", name, strings.Join(luaCapNameList(), ", "))
+		}
+		caps |= c
+	}
+	return caps, nil
+}
+
+func luaCapNameList() []string {
+	names := make([]string, 0, len(luaCapNames))
+	for name := range luaCapNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scriptCapabilities returns what scriptName may do under cfg's lua.permissions, or an
+// error if it may not run at all
+func scriptCapabilities(cfg *Config, scriptName string) (luaCaps, error) {
+	if cfg == nil || cfg.Lua == nil || len(cfg.Lua.Permissions) == 0 {
+		return luaCapAll, nil
+	}
+	names, ok := scriptPermissions(cfg.Lua, scriptName)
+	if !ok {
+		return 0, fmt.Errorf("%s is not listed in lua.permissions", scriptName)
+	}
+	return parseLuaCaps(names)
+}
+
+// scriptPermissions returns the capability names granted to scriptName, falling back to
+// the "*" entry, and false if neither exists
+func scriptPermissions(cfg *LuaConfig, scriptName string) ([]string, bool) {
+	if names, ok := cfg.Permissions[scriptName]; ok {
+		return names, true
+	}
+	names, ok := cfg.Permissions["*"]
+	return names, ok
+}
+
+// restrictLuaFileWrites removes the standard functions that write, rename or delete files,
+// and limits io.open to reading, for a script without the files capability
+func restrictLuaFileWrites(L *lua.LState) {
+	if osLib, ok := L.GetGlobal("os").(*lua.LTable); ok {
+		for _, name := range []string{"remove", "rename", "tmpname"} {
+			L.SetField(osLib, name, lua.LNil)
+		}
+	}
+	ioLib, ok := L.GetGlobal("io").(*lua.LTable)
+	if !ok {
+		return
+	}
+	L.SetField(ioLib, "output", lua.LNil)
+	if open, ok := L.GetField(ioLib, "open").(*lua.LFunction); ok {
+		L.SetField(ioLib, "open", L.NewFunction(readOnlyIOOpen(open)))
+	}
+}
+
+// readOnlyIOOpen wraps io.open so it only opens files for reading, failing like io.open
+// does (nil and a message) for any other mode
+func readOnlyIOOpen(open *lua.LFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		if mode := L.OptString(2, "r"); strings.TrimSuffix(mode, "b") != "r" {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("%s: opening files with mode %q needs the files capability", L.CheckString(1), mode)))
+			return 2
+		}
+		top := L.GetTop()
+		L.Push(open)
+		for i := 1; i <= top; i++ {
+			L.Push(L.Get(i))
+		}
+		L.Call(top, lua.MultRet)
+		return L.GetTop() - top
+	}
+}
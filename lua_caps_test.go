@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// TestLuaFileCapability covers the standard library's file writes needing the files capability
+func TestLuaFileCapability(t *testing.T) {
+	h := newHeadlessTray(t, `{"lua": {"permissions": {"writer.lua": ["files"], "*": []}}}`)
+	target := filepath.ToSlash(filepath.Join(t.TempDir(), "out.txt"))
+	script := `
+local f, err = io.open("` + target + `", "w")
+if not f then
+	result = "refused: " .. err
+	return
+end
+f:write("written")
+f:close()
+result = "wrote " .. tostring(os.remove ~= nil) .. " " .. tostring(ktray.open_url ~= nil) .. " " .. tostring(os.exit ~= nil)
+`
+	out, err := h.runScript("reader.lua", script)
+	if err != nil {
+		t.Fatalf("reader.lua: %v", err)
+	}
+	if _, statErr := os.Stat(target); statErr == nil || !strings.HasPrefix(out, "refused: ") {
+		t.Errorf("reader.lua wrote a file: %q", out)
+	}
+
+	out, err = h.runScript("writer.lua", script)
+	if err != nil {
+		t.Fatalf("writer.lua: %v", err)
+	}
+	if out != "wrote true false false" {
+		t.Errorf("writer.lua = %q", out)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "written" {
+		t.Errorf("out.txt = %q, %v", data, err)
+	}
+
+	out, err = h.runScript("reads.lua", `local f = io.open("`+target+`") result = f:read("*a") f:close()`)
+	if err != nil || out != "written" {
+		t.Errorf("reading without files = %q, %v", out, err)
+	}
+}
+
+// TestScriptCapabilities covers lua.permissions: a script's own entry, the "*" fallback,
+// and scripts that may not run at all
+func TestScriptCapabilities(t *testing.T) {
+	if caps, err := scriptCapabilities(&Config{}, "any.lua"); err != nil || caps != luaCapAll {
+		t.Errorf("without permissions = %b, %v", caps, err)
+	}
+	cfg := &Config{Lua: &LuaConfig{Permissions: map[string][]string{
+		"fetch.lua": {"HTTP", "secrets"},
+		"bad.lua":   {"network"},
+	}}}
+	if caps, err := scriptCapabilities(cfg, "fetch.lua"); err != nil || caps != luaCapHTTP|luaCapSecrets {
+		t.Errorf("fetch.lua = %b, %v", caps, err)
+	}
+	if _, err := scriptCapabilities(cfg, "bad.lua"); err == nil || !strings.Contains(err.Error(), "network") {
+		t.Errorf("unknown capability: %v", err)
+	}
+	if _, err := scriptCapabilities(cfg, "other.lua"); err == nil {
+		t.Error("unlisted script may run")
+	}
+	cfg.Lua.Permissions["*"] = []string{}
+	if caps, err := scriptCapabilities(cfg, "other.lua"); err != nil || caps != 0 {
+		t.Errorf("other.lua under \"*\" = %b, %v", caps, err)
+	}
+}
+
+// TestLuaPoolReset checks that a pooled state forgets what the previous script changed
+func TestLuaPoolReset(t *testing.T) {
+	newHeadlessTray(t, `{}`)
+	if err := InitLuaEngine(); err != nil {
+		t.Fatal(err)
+	}
+	p := newPooledLuaState(luaCapClipboard)
+	L := p.L
+	defer L.Close()
+	if L.GetField(L.GetGlobal("ktray"), "exec") != lua.LNil {
+		t.Error("ktray.exec registered without the exec capability")
+	}
+
+	err := L.DoString(`
+leaked = "yes"
+string.upper = function() return "patched" end
+ktray.copy = nil
+setmetatable(_G, {__index = function() return "meta" end})
+package.loaded.fake = true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.reset()
+	if err := L.DoString(`result = tostring(leaked) .. " " .. string.upper("a") .. " " .. tostring(ktray.copy ~= nil) .. " " .. tostring(package.loaded.fake)`); err != nil {
+		t.Fatal(err)
+	}
+	if got := L.GetGlobal("result").String(); got != "nil A true nil" {
+		t.Errorf("after reset = %q", got)
+	}
+}
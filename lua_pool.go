@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// pooledLuaState is a Lua state with the ktray module registered, plus a snapshot of its
+// globals taken before any script ran, used to undo what a script changed
+type pooledLuaState struct {
+	L        *lua.LState
+	snapshot map[*lua.LTable]luaTableSnapshot
+}
+
+// luaTableSnapshot holds the fields and metatable of a table as they were when pooled
+type luaTableSnapshot struct {
+	fields    map[lua.LValue]lua.LValue
+	metatable lua.LValue
+}
+
+// luaStatePools keep initialized states between script runs, so a hotkey doesn't pay for
+// opening the standard libraries and registering the ktray module every time. There is
+// one pool per capability set, since a state only has the functions its script may call.
+var luaStatePools [luaCapAll + 1]sync.Pool
+
+func init() {
+	for i := range luaStatePools {
+		caps := luaCaps(i)
+		luaStatePools[i].New = func() interface{} {
+			return newPooledLuaState(caps)
+		}
+	}
+}
+
+func newPooledLuaState(caps luaCaps) *pooledLuaState {
+	L := lua.NewState()
+	GetLuaEngine().registerKtrayModuleToState(L, caps)
+
+	p := &pooledLuaState{L: L, snapshot: make(map[*lua.LTable]luaTableSnapshot)}
+	p.save(L.G.Global)
+	// Tables reachable from the globals (string, os, ktray, ...), and the modules that
+	// require() has loaded, can be changed by a script too
+	L.G.Global.ForEach(func(_, v lua.LValue) {
+		if t, ok := v.(*lua.LTable); ok && t != L.G.Global {
+			p.save(t)
+		}
+	})
+	if loaded, ok := L.GetField(L.Get(lua.RegistryIndex), "_LOADED").(*lua.LTable); ok {
+		p.save(loaded)
+	}
+	// A script swapping a loader mustn't change how the next script's modules are checked
+	if loaders, ok := L.GetField(L.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable); ok {
+		p.save(loaders)
+	}
+	return p
+}
+
+func (p *pooledLuaState) save(t *lua.LTable) {
+	snap := luaTableSnapshot{fields: make(map[lua.LValue]lua.LValue), metatable: p.L.GetMetatable(t)}
+	t.ForEach(func(k, v lua.LValue) {
+		snap.fields[k] = v
+	})
+	p.snapshot[t] = snap
+}
+
+// reset puts every snapshotted table back the way it was, dropping globals and fields
+// the script added
+func (p *pooledLuaState) reset() {
+	L := p.L
+	L.SetTop(0)
+	L.Env = L.G.Global
+	L.SetField(L.Get(lua.RegistryIndex), httpSessionKey, lua.LNil)
+	L.SetField(L.Get(lua.RegistryIndex), scriptRunKey, lua.LNil)
+
+	for t, snap := range p.snapshot {
+		var added []lua.LValue
+		t.ForEach(func(k, _ lua.LValue) {
+			if _, ok := snap.fields[k]; !ok {
+				added = append(added, k)
+			}
+		})
+		for _, k := range added {
+			t.RawSet(k, lua.LNil)
+		}
+		for k, v := range snap.fields {
+			t.RawSet(k, v)
+		}
+		L.SetMetatable(t, snap.metatable)
+	}
+}
+
+// acquireLuaState returns a state with the functions caps permits to run scriptName in,
+// and a function to call when the script is done. Isolated scripts get a new state that
+// is closed afterwards; others get a pooled one that is reset and returned to the pool,
+// unless the script failed.
+func acquireLuaState(scriptName string, caps luaCaps) (*lua.LState, func(failed bool)) {
+	if currentConfig().ScriptIsolated(scriptName) {
+		L := lua.NewState()
+		GetLuaEngine().registerKtrayModuleToState(L, caps)
+		return L, func(bool) { L.Close() }
+	}
+
+	pool := &luaStatePools[caps]
+	p := pool.Get().(*pooledLuaState)
+	return p.L, func(failed bool) {
+		// A failed script may have been stopped halfway through changing the state
+		if failed {
+			p.L.Close()
+			return
+		}
+		p.reset()
+		pool.Put(p)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// installSignedLoaders makes require, dofile and loadfile check signatures like RunScript
+// does, so a module planted next to a signed script can't run unchecked. The signing
+// settings are read when a file is loaded, so a reload applies to pooled states too.
+func installSignedLoaders(L *lua.LState) {
+	if loaders, ok := L.GetField(L.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable); ok {
+		// Slot 1 is package.preload, slot 2 gopher-lua's unchecked file loader
+		L.RawSetInt(loaders, 2, L.NewFunction(luaSignedModuleLoader))
+	}
+	L.SetGlobal("loadfile", L.NewFunction(luaSignedLoadFile))
+	L.SetGlobal("dofile", L.NewFunction(luaSignedDoFile))
+}
+
+// loadSignedChunk compiles the file at path from the bytes its signature was checked over
+func loadSignedChunk(L *lua.LState, path string) (*lua.LFunction, error) {
+	source, err := readSignedFile(path, currentConfig().GetSigningConfigWithDefaults())
+	if err != nil {
+		LogWarn("Refusing to load Lua file %s: %v", path, err)
+		return nil, err
+	}
+	return L.Load(bytes.NewReader(source), path)
+}
+
+// luaSignedModuleLoader finds a module on package.path, as gopher-lua's loader does, and
+// loads it once its signature checks out
+func luaSignedModuleLoader(L *lua.LState) int {
+	name := L.CheckString(1)
+	pathList, ok := L.GetField(L.GetGlobal("package"), "path").(lua.LString)
+	if !ok {
+		L.RaiseError("package.path must be a string")
+	}
+	file := strings.ReplaceAll(name, ".", string(os.PathSeparator))
+	var tried []string
+	for _, pattern := range strings.Split(string(pathList), ";") {
+		path := strings.ReplaceAll(pattern, "?", file)
+		if _, err := os.Stat(path); err != nil {
+			tried = append(tried, err.Error())
+			continue
+		}
+		fn, err := loadSignedChunk(L, path)
+		if err != nil {
+			L.RaiseError("module %s rejected: %v", name, err)
+		}
+		L.Push(fn)
+		return 1
+	}
+	L.Push(lua.LString(strings.Join(tried, "\n\t")))
+	return 1
+}
+
+// luaSignedLoadFile is loadfile(path) for signed files: the chunk, or nil and the error
+func luaSignedLoadFile(L *lua.LState) int {
+	fn, err := loadSignedChunk(L, L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(fn)
+	return 1
+}
+
+// luaSignedDoFile is dofile(path) for signed files: runs the chunk and returns its results
+func luaSignedDoFile(L *lua.LState) int {
+	fn, err := loadSignedChunk(L, L.CheckString(1))
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	top := L.GetTop()
+	L.Push(fn)
+	L.Call(0, lua.MultRet)
+	return L.GetTop() - top
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/getlantern/systray"
+
+	"krb5tray/internal/cache"
+	"krb5tray/pkg/krb"
 )
 
 var (
@@ -18,11 +23,12 @@ var (
 
 var (
 	// Global state
-	currentSPN    string
-	lastToken     string
-	lastTokenTime time.Time
-	stateMutex    sync.RWMutex
-	appConfig     *Config
+	currentSPN     string
+	currentSPNName string // Display name of currentSPN, for restoring it after a restart
+	lastToken      *cache.LockedBuffer
+	lastTokenTime  time.Time
+	stateMutex     sync.RWMutex
+	appConfig      atomic.Pointer[Config] // Read with currentConfig, replaced with setConfig
 
 	// Menu items
 	mStatus       *systray.MenuItem
@@ -32,21 +38,30 @@ var (
 	mSnippetsMenu *systray.MenuItem
 	mSSHMenu      *systray.MenuItem
 	mCacheMenu    *systray.MenuItem
+	mHistoryMenu  *systray.MenuItem
 	mCopyToken    *systray.MenuItem
+	mExportEnv    *systray.MenuItem
 	mCopyHeader   *systray.MenuItem
 	mRefresh      *systray.MenuItem
+	mPurgeTickets *systray.MenuItem
+	mRenewTGT     *systray.MenuItem
 	mDebug        *systray.MenuItem
+	mViewLog      *systray.MenuItem
+	mUsageStats   *systray.MenuItem
 	mReloadCfg    *systray.MenuItem
+	mEnvImport    *systray.MenuItem
 	mAbout        *systray.MenuItem
+	mRestart      *systray.MenuItem
 	mQuit         *systray.MenuItem
 
-	// SPN submenu items with their click handlers
-	spnMenuItems     []*systray.MenuItem
-	secretMenuItems  []*systray.MenuItem
-	urlMenuItems     []*systray.MenuItem
-	snippetMenuItems []*systray.MenuItem
-	sshMenuItems     []*systray.MenuItem
-	cacheMenuItems   []*systray.MenuItem
+	// Submenu lists, with an item per entry
+	spnMenu     *menuList
+	secretMenu  *menuList
+	urlMenu     *menuList
+	snippetMenu *menuList
+	sshMenu     *menuList
+	cacheMenu   *menuList
+	historyMenu *menuList
 
 	// Data bound to menu items (used for click handling after reload)
 	spnEntries     []SPNEntry
@@ -61,17 +76,44 @@ var (
 )
 
 func main() {
+	// Subcommands (e.g. "krb5tray token <spn>") run headless; no arguments starts the tray
+	if isCLIInvocation(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
+	os.Exit(runTray(os.Args[1:]))
+}
+
+// runTray starts the system tray application and returns once it quits.
+// args may name a ctl command as an option (e.g. --copy-header), which is forwarded to
+// the running instance if there is one, or run once this one is up.
+func runTray(args []string) int {
+	req, err := parseTrayArgs(args)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "krb5tray: %v\n", err)
+		_, _ = fmt.Fprintln(os.Stderr, "Run 'krb5tray help' for commands, or 'krb5tray ctl help' for tray options.")
+		return exitUsage
+	}
+
 	// Ensure only one instance is running
 	if err := EnsureSingleInstance(); err != nil {
+		if errors.Is(err, errAlreadyRunning) {
+			return forwardToRunningInstance(req, os.Stdout, os.Stderr)
+		}
 		_, _ = fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return exitFailure
 	}
+	pendingTrayRequest = req
 
 	// Try to load config early for logging settings
 	// If config doesn't exist, use defaults
 	var logCfg LogConfig
-	if cfg, err := LoadConfig(""); err == nil {
-		logCfg = cfg.GetLogConfigWithDefaults()
+	var startupCfg *Config
+	startup.timePhase("config", func() {
+		startupCfg, err = loadStartupConfig()
+	})
+	if err == nil {
+		logCfg = startupCfg.GetLogConfigWithDefaults()
+		startupConfig = startupCfg
 	} else {
 		logCfg = DefaultLogConfig()
 	}
@@ -82,16 +124,13 @@ func main() {
 	}
 
 	LogStartup()
+	ConfigureTracing(logCfg)
 
-	// Initialize the cache
-	InitCache()
-
-	// Initialize Lua scripting engine
-	if err := InitLuaEngine(); err != nil {
-		LogWarn("Failed to initialize Lua engine: %v", err)
-	}
+	// Restore the cache and set up Lua while the icon comes up
+	startBackgroundInit(startupCfg)
 
 	systray.Run(onReady, onExit)
+	return exitOK
 }
 
 func onReady() {
@@ -99,11 +138,20 @@ func onReady() {
 	// Use SetIcon for colored icon (SetTemplateIcon would make it monochrome)
 	systray.SetIcon(getIcon())
 	systray.SetTitle("") // No text, just the icon
-	systray.SetTooltip("Kerberos Service Ticket Tool")
+	systray.SetTooltip(defaultTooltip)
+	startup.record("icon", time.Since(startup.start))
+	menusStart := time.Now()
 
 	// Status display as submenu (kept enabled for better contrast)
 	mStatusMenu := systray.AddMenuItem("Status", "Current status")
 	mStatus = mStatusMenu.AddSubMenuItem("Ready", "")
+	mVPNStatus = mStatusMenu.AddSubMenuItem("VPN", "")
+	mVPNStatus.Hide() // Shown once vpn detection has checked
+
+	// Shown only while idle-locked
+	mUnlock = systray.AddMenuItem("Unlock", "Unlock tokens and secrets")
+	mUnlock.Hide()
+	go handleUnlockClick(mUnlock)
 
 	systray.AddSeparator()
 
@@ -127,15 +175,59 @@ func onReady() {
 	mSSHMenu = systray.AddMenuItem("SSH", "Open SSH connections in terminal")
 	loadAndBuildSSHMenu()
 
+	// Transfers submenu
+	mTransfersMenu = systray.AddMenuItem("Transfers", "Copy files to and from SSH hosts")
+	loadAndBuildTransfersMenu()
+
+	// Sessions submenu
+	mSessionsMenu = systray.AddMenuItem("Sessions", "Sign in to web apps and copy their session cookies")
+	loadAndBuildSessionsMenu()
+
+	// Commands submenu
+	mCommandsMenu = systray.AddMenuItem("Commands", "Run scripts, asking for their parameters")
+	loadAndBuildCommandsMenu()
+
 	// Cache submenu
 	mCacheMenu = systray.AddMenuItem("Cache", "View and copy cached values")
 	loadAndBuildCacheMenu()
 
+	// JWTs submenu
+	mJWTsMenu = systray.AddMenuItem("JWTs", "Inspect and copy cached JWTs")
+	loadAndBuildJWTMenu()
+
+	// Clipboard history submenu
+	mHistoryMenu = systray.AddMenuItem("Clipboard History", "Restore previously copied values")
+	loadAndBuildHistoryMenu()
+
+	// Kerberos tickets, like klist
+	mCredentialsMenu = systray.AddMenuItem("Credentials", "Kerberos tickets of the current user, like klist")
+	loadAndBuildCredentialsMenu()
+
+	// Credential caches of other principals, to request tickets from
+	mCachesMenu = systray.AddMenuItem("Caches", "Switch the credential cache tickets are requested from")
+	loadAndBuildCachesMenu()
+
 	systray.AddSeparator()
 
 	// Actions
 	mRefresh = systray.AddMenuItem("Refresh Ticket", "Re-request service ticket for current SPN")
 	mRefresh.Disable() // Disabled until SPN is selected
+	mRefreshAll = systray.AddMenuItem("Refresh All", "Renew the TGT, request new tokens for the cached SPNs, and run the scripts of expiring JWTs again")
+	go handleRefreshAllClick(mRefreshAll)
+	mCancelTicket = systray.AddMenuItem("Cancel Ticket Request", "Stop waiting for the KDC")
+	mCancelTicket.Hide() // Shown while a request is in flight
+	go handleCancelTicketClick(mCancelTicket)
+
+	// klist purge and renew through the LSA; other platforms have kdestroy and kinit -R
+	if krb.IsWindows() {
+		mPurgeTickets = systray.AddMenuItem("Purge Tickets", "Remove this logon session's Kerberos tickets and the cached tokens (klist purge)")
+		go handlePurgeTicketsClick()
+		mRenewTGT = systray.AddMenuItem("Renew TGT", "Get a new ticket-granting ticket from the domain controller")
+		go handleRenewTGTClick()
+	}
+	// kdestroy on every platform, to leave nothing to use when stepping away
+	mDestroyCredentials = systray.AddMenuItem("Destroy Credentials", "Destroy the credential cache tickets are requested from and the cached tokens (kdestroy)")
+	go handleDestroyCredentialsClick()
 
 	mCopyHeader = systray.AddMenuItem("Copy HTTP Header", "Copy 'Negotiate <token>' to clipboard")
 	mCopyHeader.Disable()
@@ -143,11 +235,28 @@ func onReady() {
 	mCopyToken = systray.AddMenuItem("Copy Token", "Copy base64 token to clipboard")
 	mCopyToken.Disable()
 
+	mCopyAsMenu = systray.AddMenuItem("Copy As", "Copy a curl, HTTPie, PowerShell or Python request with the token")
+	buildCopyAsMenu()
+	mCopyAsMenu.Disable()
+
+	mExportEnv = systray.AddMenuItem("Export Env", "Write tokens and secrets to a file to source in a terminal, and copy the command")
+
+	// Token sets submenu
+	mTokenSetsMenu = systray.AddMenuItem("Export Token Set", "Write tokens for a group of SPNs to a JSON file and copy its path")
+	loadAndBuildTokenSetsMenu()
+
 	systray.AddSeparator()
 
 	// Settings
 	mDebug = systray.AddMenuItemCheckbox("Debug Mode", "Enable debug output", false)
+	buildLogLevelMenu()
+	mViewLog = systray.AddMenuItem("View Log", "Show the most recent log entries")
+	mViewResponse = systray.AddMenuItem("View Response", "")
+	updateViewResponseItem()
+	mUsageStats = systray.AddMenuItem("Usage Statistics", "Show how often each entry is used")
 	mReloadCfg = systray.AddMenuItem("Reload Config", "Reload configuration from file")
+	mEnvImport = systray.AddMenuItem("Import from Environment…", "Add SPNs, SSH hosts and URLs found in krb5.conf, the ccache, ~/.ssh/config and browser bookmarks to the config")
+	go handleEnvImportClick()
 
 	systray.AddSeparator()
 
@@ -173,153 +282,139 @@ func onReady() {
 
 	systray.AddSeparator()
 
-	// Quit
+	// Restart and quit
+	mRestart = systray.AddMenuItem("Restart", "Restart the application, e.g. after updating it")
+	go handleRestartClick()
 	mQuit = systray.AddMenuItem("Quit", "Quit the application")
 
 	// Handle menu clicks
 	go handleMenuClicks()
+	startup.record("menus", time.Since(menusStart))
 
-	// Check for initial SPN from environment (fallback)
-	if spn := os.Getenv("KRB5_SPN"); spn != "" && currentSPN == "" {
-		setSPN(spn, "Environment")
-	}
-
-	// Show platform info in status
-	updatePlatformStatus()
-
-	// Initialize global hotkeys for snippet selection
-	InitHotkeys()
+	// The rest of startup runs in the background
+	go finishStartup()
 }
 
-const maxMenuItems = 50 // Maximum items per menu type
-
 func loadAndBuildSPNMenu() {
-	// Try to load config
-	cfg, err := LoadConfig("")
+	// Use the config loaded at startup, or try to load it again
+	cfg := startupConfig
+	var err error
+	if cfg == nil {
+		cfg, err = loadStartupConfig()
+	}
 	if err != nil {
 		// Config doesn't exist, create default
 		if os.IsNotExist(err) {
 			if createErr := CreateDefaultConfig(); createErr == nil {
-				cfg, _ = LoadConfig("")
+				cfg, _ = loadStartupConfig()
 			}
 		}
 	}
 
-	appConfig = cfg
-
-	// Pre-allocate menu items pool
-	spnMenuItems = make([]*systray.MenuItem, maxMenuItems)
-	spnEntries = make([]SPNEntry, maxMenuItems)
-
-	for i := 0; i < maxMenuItems; i++ {
-		item := mSPNMenu.AddSubMenuItem("", "")
-		item.Hide()
-		spnMenuItems[i] = item
-		go handleSPNClickByIndex(item, i)
-	}
+	applySSHAutoSync(cfg)
+	setConfig(cfg)
+	ApplyClipboardConfig(cfg.GetClipboardConfigWithDefaults())
 
-	// Add config path info at the end (always visible)
-	mSPNMenu.AddSubMenuItem("", "")
-	configInfo := mSPNMenu.AddSubMenuItem(fmt.Sprintf("Config: %s", DefaultConfigPath()), "Configuration file location")
-	configInfo.Disable()
+	// Config path info at the end (always visible)
+	spnMenu = newMenuList(mSPNMenu, handleSPNClick, func() []*systray.MenuItem {
+		separator := mSPNMenu.AddSubMenuItem("", "")
+		sorting := menuSortFooter(mSPNMenu, usageSPN, "SPN", nil)
+		configInfo := mSPNMenu.AddSubMenuItem(fmt.Sprintf("Config: %s", DefaultConfigPath()), "Configuration file location")
+		configInfo.Disable()
+		return append(append([]*systray.MenuItem{separator}, sorting...), configInfo)
+	})
 
 	// Now populate with actual data
 	updateSPNMenu()
 }
 
 func updateSPNMenu() {
-	// Hide all items first
-	for i := 0; i < maxMenuItems; i++ {
-		spnMenuItems[i].Hide()
+	cfg := currentConfig()
+	var entries []SPNEntry
+	if cfg != nil {
+		entries = sortMenuEntries(cfg, usageSPN, cfg.SPNs, func(e SPNEntry) menuSortKey { return menuSortKey{Name: e.Name, Group: e.Group} })
 	}
+	stateMutex.Lock()
+	spnEntries = entries
+	stateMutex.Unlock()
 
-	if appConfig == nil || len(appConfig.SPNs) == 0 {
-		// Show "No SPNs configured" in first slot
-		spnMenuItems[0].SetTitle("No SPNs configured")
-		spnMenuItems[0].SetTooltip("Edit config file to add SPNs")
-		spnMenuItems[0].Disable()
-		spnMenuItems[0].Show()
+	// Headless subcommands have no tray menu
+	if spnMenu == nil {
 		return
 	}
-
-	// Update entries and show items
-	for i, entry := range appConfig.SPNs {
-		if i >= maxMenuItems {
-			break
-		}
-		spnEntries[i] = entry
-		spnMenuItems[i].SetTitle(entry.Name)
-		spnMenuItems[i].SetTooltip(entry.SPN)
-		spnMenuItems[i].Enable()
-		spnMenuItems[i].Show()
+	if len(entries) == 0 {
+		spnMenu.ShowPlaceholder("No SPNs configured", "Edit config file to add SPNs")
+		return
 	}
+	spnMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		item.SetTitle(entries[i].Name)
+		item.SetTooltip(entries[i].SPN)
+	})
 }
 
-func handleSPNClickByIndex(item *systray.MenuItem, index int) {
-	for range item.ClickedCh {
-		stateMutex.RLock()
-		entry := spnEntries[index]
-		stateMutex.RUnlock()
-		if entry.SPN != "" {
-			setSPN(entry.SPN, entry.Name)
-		}
+func handleSPNClick(index int) {
+	stateMutex.RLock()
+	var entry SPNEntry
+	if index < len(spnEntries) {
+		entry = spnEntries[index]
+	}
+	stateMutex.RUnlock()
+	if entry.SPN != "" {
+		setSPN(entry.SPN, entry.Name)
+		recordUsage(usageSPN, entry.Name)
 	}
 }
 
 func loadAndBuildSecretsMenu() {
-	// Pre-allocate menu items pool
-	secretMenuItems = make([]*systray.MenuItem, maxMenuItems)
-	secretEntries = make([]*SecretEntry, maxMenuItems)
-
-	for i := 0; i < maxMenuItems; i++ {
-		item := mSecretsMenu.AddSubMenuItem("", "")
-		item.Hide()
-		secretMenuItems[i] = item
-		go handleSecretClickByIndex(item, i)
-	}
+	secretMenu = newMenuList(mSecretsMenu, handleSecretClick, func() []*systray.MenuItem {
+		mLockSecrets = mSecretsMenu.AddSubMenuItem("Lock Secrets", "Require the PIN or biometrics before the next secret is used")
+		go handleLockSecretsClick(mLockSecrets)
+		updateLockMenu()
+		return []*systray.MenuItem{mLockSecrets}
+	})
 
 	// Now populate with actual data
 	updateSecretsMenu()
 }
 
 func updateSecretsMenu() {
-	// Hide all items first
-	for i := 0; i < maxMenuItems; i++ {
-		secretMenuItems[i].Hide()
+	cfg := currentConfig()
+	var entries []*SecretEntry
+	if cfg != nil {
+		for i := range cfg.Secrets {
+			entries = append(entries, &cfg.Secrets[i])
+		}
 	}
+	stateMutex.Lock()
+	secretEntries = entries
+	stateMutex.Unlock()
 
-	if appConfig == nil || len(appConfig.Secrets) == 0 {
-		// Show "No secrets configured" in first slot
-		secretMenuItems[0].SetTitle("No secrets configured")
-		secretMenuItems[0].SetTooltip("Edit config file to add secrets")
-		secretMenuItems[0].Disable()
-		secretMenuItems[0].Show()
+	if len(entries) == 0 {
+		secretMenu.ShowPlaceholder("No secrets configured", "Edit config file to add secrets")
 		return
 	}
-
-	// Update entries and show items
-	for i := range appConfig.Secrets {
-		if i >= maxMenuItems {
-			break
-		}
-		entry := &appConfig.Secrets[i]
-		secretEntries[i] = entry
-		secretMenuItems[i].SetTitle(entry.Name)
-		secretMenuItems[i].SetTooltip(fmt.Sprintf("Role: %s (%s)", entry.RoleName, entry.RoleType))
-		secretMenuItems[i].Enable()
-		secretMenuItems[i].Show()
-	}
+	secretMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		item.SetTitle(entries[i].Name)
+		item.SetTooltip(fmt.Sprintf("Role: %s (%s)", entries[i].RoleName, entries[i].RoleType))
+	})
+	updateLockMenu()
 }
 
-func handleSecretClickByIndex(item *systray.MenuItem, index int) {
-	for range item.ClickedCh {
-		stateMutex.RLock()
-		entry := secretEntries[index]
-		stateMutex.RUnlock()
-		if entry != nil {
-			setSecret(entry)
-		}
+func handleSecretClick(index int) {
+	stateMutex.RLock()
+	var entry *SecretEntry
+	if index < len(secretEntries) {
+		entry = secretEntries[index]
 	}
+	stateMutex.RUnlock()
+	if entry == nil {
+		return
+	}
+	if err := unlockSecrets(fmt.Sprintf("Unlock secrets to use %s", entry.Name)); err != nil {
+		setStatusError(fmt.Sprintf("Secrets locked: %s", truncateError(err)))
+		return
+	}
+	setSecret(entry)
 }
 
 func setSecret(entry *SecretEntry) {
@@ -329,378 +424,501 @@ func setSecret(entry *SecretEntry) {
 
 	LogSecretSelected(entry.Name)
 	mSecretsMenu.SetTitle(fmt.Sprintf("Secret: %s", entry.Name))
-	mStatus.SetTitle(fmt.Sprintf("Selected: %s", entry.Name))
+	setStatus(fmt.Sprintf("Selected: %s", entry.Name))
 }
 
 func loadAndBuildURLsMenu() {
-	// Pre-allocate menu items pool
-	urlMenuItems = make([]*systray.MenuItem, maxMenuItems)
-	urlEntries = make([]URLEntry, maxMenuItems)
-
-	for i := 0; i < maxMenuItems; i++ {
-		item := mURLsMenu.AddSubMenuItem("", "")
-		item.Hide()
-		urlMenuItems[i] = item
-		go handleURLClickByIndex(item, i)
-	}
+	// Add, edit and delete actions after the entries
+	urlMenu = newMenuList(mURLsMenu, handleURLClick, func() []*systray.MenuItem {
+		footer := editMenuFooter(mURLsMenu, "URL", addURLFromClipboard, editURL, deleteURL)
+		return append(footer, menuSortFooter(mURLsMenu, usageURL, "URL", moveURL)...)
+	})
 
 	// Now populate with actual data
 	updateURLsMenu()
 }
 
 func updateURLsMenu() {
-	// Hide all items first
-	for i := 0; i < maxMenuItems; i++ {
-		urlMenuItems[i].Hide()
+	cfg := currentConfig()
+	var entries []URLEntry
+	if cfg != nil {
+		entries = sortMenuEntries(cfg, usageURL, cfg.URLs, func(e URLEntry) menuSortKey { return menuSortKey{e.Index, e.Name, e.Group} })
 	}
+	stateMutex.Lock()
+	urlEntries = entries
+	stateMutex.Unlock()
 
-	if appConfig == nil || len(appConfig.URLs) == 0 {
-		// Show "No URLs configured" in first slot
-		urlMenuItems[0].SetTitle("No URLs configured")
-		urlMenuItems[0].SetTooltip("Edit config file to add URLs")
-		urlMenuItems[0].Disable()
-		urlMenuItems[0].Show()
+	if len(entries) == 0 {
+		urlMenu.ShowPlaceholder("No URLs configured", "Add one from the clipboard below or in the config file")
 		return
 	}
+	urlMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		item.SetTitle(urlMenuTitle(entries[i]))
+		item.SetTooltip(entries[i].URL)
+	})
+}
 
-	// Update entries and show items
-	for i, entry := range appConfig.URLs {
-		if i >= maxMenuItems {
-			break
-		}
-		urlEntries[i] = entry
-		displayName := fmt.Sprintf("[%d] %s", entry.Index, entry.Name)
-		urlMenuItems[i].SetTitle(displayName)
-		urlMenuItems[i].SetTooltip(entry.URL)
-		urlMenuItems[i].Enable()
-		urlMenuItems[i].Show()
+func handleURLClick(index int) {
+	stateMutex.RLock()
+	var entry URLEntry
+	if index < len(urlEntries) {
+		entry = urlEntries[index]
+	}
+	stateMutex.RUnlock()
+	if entry.URL != "" || entry.Script != "" {
+		executeURLEntry(entry, requesterMenu)
 	}
 }
 
-func handleURLClickByIndex(item *systray.MenuItem, index int) {
-	for range item.ClickedCh {
-		stateMutex.RLock()
-		entry := urlEntries[index]
-		stateMutex.RUnlock()
-		if entry.URL != "" || entry.Script != "" {
-			executeURLEntry(entry)
-		}
+// executeURLEntry runs the entry's script, or opens its URL after authenticating for
+// auth_spn; requester is what asked for it (menu or hotkey)
+func executeURLEntry(entry URLEntry, requester string) {
+	if entry.Confirm && !confirmEntry("URL", entry.Name, confirmURLPreview(entry)) {
+		return
 	}
-}
+	recordUsage(usageURL, entry.Name)
 
-func executeURLEntry(entry URLEntry) {
 	// If script is defined, run it instead of opening URL directly
 	if entry.Script != "" {
 		engine := GetLuaEngine()
-		if engine != nil {
-			ctx := map[string]string{
-				"url":   entry.URL,
-				"name":  entry.Name,
-				"index": fmt.Sprintf("%d", entry.Index),
-			}
-			_, err := engine.RunScript(entry.Script, ctx)
-			LogScriptExecuted(entry.Script, "url", err)
-			if err != nil {
-				mStatus.SetTitle(fmt.Sprintf("Script error: %s", truncateError(err)))
-			} else {
-				mStatus.SetTitle(fmt.Sprintf("Script: %s", entry.Name))
-			}
+		ctx := map[string]string{
+			"url":   entry.URL,
+			"name":  entry.Name,
+			"index": fmt.Sprintf("%d", entry.Index),
+		}
+		_, err := engine.RunScript(entry.Script, ctx)
+		LogScriptExecuted(entry.Script, "url", err)
+		if err != nil {
+			setStatusError(fmt.Sprintf("Script error: %s", truncateError(err)))
+		} else {
+			setStatus(fmt.Sprintf("Script: %s", entry.Name))
+		}
+		return
+	}
+
+	target := entry.URL
+	if entry.AuthSPN != "" {
+		setStatus(fmt.Sprintf("Authenticating: %s...", entry.Name))
+		authURL, err := prepareURLAuth(entry, requester)
+		if err != nil {
+			LogError("Authentication for URL %s failed: %v", entry.Name, err)
+			setStatusError(fmt.Sprintf("Auth failed: %s", truncateError(err)))
 			return
 		}
+		target = authURL
 	}
 
 	// Default behavior: open URL in browser
-	if err := openBrowser(entry.URL); err != nil {
+	if err := openBrowser(target); err != nil {
 		LogError("Failed to open URL %s: %v", entry.Name, err)
-		mStatus.SetTitle(fmt.Sprintf("Failed to open: %s", entry.Name))
+		setStatusError(fmt.Sprintf("Failed to open: %s", entry.Name))
 	} else {
 		LogURLOpened(entry.Name)
-		mStatus.SetTitle(fmt.Sprintf("Opened: %s", entry.Name))
+		if entry.AuthSPN != "" && urlAuthMode(entry) == urlAuthHeader {
+			setStatus(fmt.Sprintf("Opened: %s (header copied)", entry.Name))
+		} else {
+			setStatus(fmt.Sprintf("Opened: %s", entry.Name))
+		}
 	}
 }
 
 func loadAndBuildSnippetsMenu() {
-	// Pre-allocate menu items pool (flat list, no grouping for simplicity in reload)
-	snippetMenuItems = make([]*systray.MenuItem, maxMenuItems)
-	snippetEntries = make([]SnippetEntry, maxMenuItems)
-
-	for i := 0; i < maxMenuItems; i++ {
-		item := mSnippetsMenu.AddSubMenuItem("", "")
-		item.Hide()
-		snippetMenuItems[i] = item
-		go handleSnippetClickByIndex(item, i)
-	}
+	// Flat list, no grouping for simplicity in reload; add, edit and delete actions after it
+	snippetMenu = newMenuList(mSnippetsMenu, handleSnippetClick, func() []*systray.MenuItem {
+		footer := editMenuFooter(mSnippetsMenu, "Snippet", addSnippetFromClipboard, editSnippet, deleteSnippet)
+		footer = append(footer, menuSortFooter(mSnippetsMenu, usageSnippet, "Snippet", moveSnippet)...)
+		return append(footer, snippetShellFooter(mSnippetsMenu))
+	})
 
 	// Now populate with actual data
 	updateSnippetsMenu()
+	warnSnippetSecrets(currentConfig())
 }
 
 func updateSnippetsMenu() {
-	// Hide all items first
-	for i := 0; i < maxMenuItems; i++ {
-		snippetMenuItems[i].Hide()
+	cfg := currentConfig()
+	var entries []SnippetEntry
+	if cfg != nil {
+		entries = sortMenuEntries(cfg, usageSnippet, cfg.Snippets, func(e SnippetEntry) menuSortKey { return menuSortKey{e.Index, e.Name, e.Group} })
 	}
+	stateMutex.Lock()
+	snippetEntries = entries
+	stateMutex.Unlock()
 
-	if appConfig == nil || len(appConfig.Snippets) == 0 {
-		// Show "No snippets configured" in first slot
-		snippetMenuItems[0].SetTitle("No snippets configured")
-		snippetMenuItems[0].SetTooltip("Edit config file to add snippets")
-		snippetMenuItems[0].Disable()
-		snippetMenuItems[0].Show()
+	if len(entries) == 0 {
+		snippetMenu.ShowPlaceholder("No snippets configured", "Add one from the clipboard below or in the config file")
 		return
 	}
-
-	// Update entries and show items
-	for i, entry := range appConfig.Snippets {
-		if i >= maxMenuItems {
-			break
-		}
-		snippetEntries[i] = entry
-		displayName := fmt.Sprintf("[%d] %s", entry.Index, entry.Name)
-		tooltip := entry.Value
+	shell := cfg.GetSnippetShell()
+	snippetMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		tooltip := snippetValue(entries[i], shell)
 		if len(tooltip) > 50 {
 			tooltip = tooltip[:50] + "..."
 		}
-		snippetMenuItems[i].SetTitle(displayName)
-		snippetMenuItems[i].SetTooltip(tooltip)
-		snippetMenuItems[i].Enable()
-		snippetMenuItems[i].Show()
-	}
+		// Don't put what looks like a credential on screen
+		if kind := snippetCredential(cfg, entries[i]); kind != "" {
+			tooltip = fmt.Sprintf("Looks like %s (value hidden)", kind)
+		}
+		item.SetTitle(snippetMenuTitle(entries[i]))
+		item.SetTooltip(tooltip)
+	})
 }
 
-func handleSnippetClickByIndex(item *systray.MenuItem, index int) {
-	for range item.ClickedCh {
-		stateMutex.RLock()
-		entry := snippetEntries[index]
-		stateMutex.RUnlock()
-		if entry.Name != "" || entry.Script != "" {
-			executeSnippetEntry(entry, false) // Menu click: copy only, no paste
-		}
+func handleSnippetClick(index int) {
+	stateMutex.RLock()
+	var entry SnippetEntry
+	if index < len(snippetEntries) {
+		entry = snippetEntries[index]
+	}
+	stateMutex.RUnlock()
+	if entry.Name != "" || entry.Script != "" {
+		executeSnippetEntry(entry, false) // Menu click: copy only, no paste
 	}
 }
 
 // executeSnippetEntry copies the snippet to clipboard
 // If autoPaste is true, it also simulates Cmd+V/Ctrl+V to paste immediately
 func executeSnippetEntry(entry SnippetEntry, autoPaste bool) {
+	if snippetBlocked(currentConfig(), entry) {
+		LogWarn("Not copying snippet %q: it looks like a credential and policy.snippet_secrets is \"block\"", entry.Name)
+		setStatusError(fmt.Sprintf("Blocked: %s looks like a credential", entry.Name))
+		return
+	}
+	if entry.Confirm && !confirmEntry("Snippet", entry.Name, confirmSnippetPreview(entry, autoPaste)) {
+		return
+	}
+	recordUsage(usageSnippet, entry.Name)
+	// The variant for the selected shell is copied, typed or handed to the script
+	shell := currentConfig().GetSnippetShell()
+	entry.Value = snippetValue(entry, shell)
+
 	// If script is defined, run it instead of copying value directly
 	if entry.Script != "" {
 		engine := GetLuaEngine()
-		if engine != nil {
-			ctx := map[string]string{
-				"value": entry.Value,
-				"name":  entry.Name,
-				"index": fmt.Sprintf("%d", entry.Index),
+		ctx := map[string]string{
+			"value": entry.Value,
+			"name":  entry.Name,
+			"index": fmt.Sprintf("%d", entry.Index),
+			"shell": shell,
+		}
+		result, err := engine.RunScript(entry.Script, ctx)
+		LogScriptExecuted(entry.Script, "snippet", err)
+		if err != nil {
+			setStatusError(fmt.Sprintf("Script error: %s", truncateError(err)))
+		} else if result != "" && shouldTypeOut(entry) {
+			// Type the result instead of going through the clipboard
+			typeSnippetValue(entry, result)
+		} else if result != "" {
+			// If script returns a result, copy that to clipboard
+			requester := requesterMenu
+			if autoPaste {
+				requester = requesterHotkey
 			}
-			result, err := engine.RunScript(entry.Script, ctx)
-			LogScriptExecuted(entry.Script, "snippet", err)
-			if err != nil {
-				mStatus.SetTitle(fmt.Sprintf("Script error: %s", truncateError(err)))
-			} else if result != "" {
-				// If script returns a result, copy that to clipboard
-				if err := copyToClipboard(result); err != nil {
-					mStatus.SetTitle(fmt.Sprintf("Copy failed: %s", entry.Name))
+			if copied, err := copyOutputToClipboard("snippet: "+entry.Name, result, requester); err != nil {
+				setStatusError(fmt.Sprintf("Copy failed: %s", entry.Name))
+			} else if copied {
+				LogClipboardCopy("snippet", entry.Name)
+				if autoPaste {
+					pasteFromClipboard()
+					setStatus(fmt.Sprintf("Pasted: %s", entry.Name))
 				} else {
-					LogClipboardCopy("snippet", entry.Name)
-					if autoPaste {
-						pasteFromClipboard()
-						mStatus.SetTitle(fmt.Sprintf("Pasted: %s", entry.Name))
-					} else {
-						mStatus.SetTitle(fmt.Sprintf("Copied: %s", entry.Name))
-					}
+					setStatus(fmt.Sprintf("Copied: %s", entry.Name))
 				}
-			} else {
-				mStatus.SetTitle(fmt.Sprintf("Script: %s", entry.Name))
 			}
-			return
+		} else {
+			setStatus(fmt.Sprintf("Script: %s", entry.Name))
 		}
+		return
+	}
+
+	// Type-out mode: inject keystrokes, never touching the clipboard
+	if shouldTypeOut(entry) {
+		typeSnippetValue(entry, entry.Value)
+		return
 	}
 
 	// Default behavior: copy value to clipboard
-	if err := copyToClipboard(entry.Value); err != nil {
+	if err := copyToClipboardWithHistory("snippet: "+entry.Name, entry.Value); err != nil {
 		LogError("Failed to copy snippet %s: %v", entry.Name, err)
-		mStatus.SetTitle(fmt.Sprintf("Copy failed: %s", entry.Name))
+		setStatusError(fmt.Sprintf("Copy failed: %s", entry.Name))
 	} else {
 		LogClipboardCopy("snippet", entry.Name)
 		if autoPaste {
 			pasteFromClipboard()
-			mStatus.SetTitle(fmt.Sprintf("Pasted: %s", entry.Name))
+			setStatus(fmt.Sprintf("Pasted: %s", entry.Name))
 		} else {
-			mStatus.SetTitle(fmt.Sprintf("Copied: %s", entry.Name))
+			setStatus(fmt.Sprintf("Copied: %s", entry.Name))
 		}
 	}
 }
 
-func loadAndBuildSSHMenu() {
-	// Pre-allocate menu items pool
-	sshMenuItems = make([]*systray.MenuItem, maxMenuItems)
-	sshEntries = make([]SSHEntry, maxMenuItems)
-
-	for i := 0; i < maxMenuItems; i++ {
-		item := mSSHMenu.AddSubMenuItem("", "")
-		item.Hide()
-		sshMenuItems[i] = item
-		go handleSSHClickByIndex(item, i)
+// typeSnippetValue types a snippet value into the focused window
+func typeSnippetValue(entry SnippetEntry, value string) {
+	if err := typeText(value); err != nil {
+		LogError("Failed to type snippet %s: %v", entry.Name, err)
+		setStatusError(fmt.Sprintf("Type failed: %s", entry.Name))
+		return
 	}
+	LogAction("text_typed", fmt.Sprintf("Typed snippet: %s", entry.Name))
+	setStatus(fmt.Sprintf("Typed: %s", entry.Name))
+}
+
+func loadAndBuildSSHMenu() {
+	// The import action and tmux sessions go above the entries, so they are built once
+	// rather than with every footer
+	mSSHImport := mSSHMenu.AddSubMenuItem("Import from ssh_config", "Add the Host entries from ~/.ssh/config to the config file")
+	go handleSSHImportClick(mSSHImport)
+	loadAndBuildTmuxMenu()
+	mSSHMenu.AddSubMenuItem("", "")
+
+	// Separator and sorting after the entries
+	sshMenu = newMenuList(mSSHMenu, handleSSHClick, func() []*systray.MenuItem {
+		separator := mSSHMenu.AddSubMenuItem("", "")
+		return append([]*systray.MenuItem{separator}, menuSortFooter(mSSHMenu, usageSSH, "SSH", moveSSH)...)
+	})
 
 	// Now populate with actual data
 	updateSSHMenu()
 }
 
+func handleSSHImportClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		count, err := importSSHConfigHosts()
+		switch {
+		case err != nil:
+			LogError("ssh_config import failed: %v", err)
+			setStatusError(fmt.Sprintf("Import failed: %s", truncateError(err)))
+		case count == 0:
+			setStatus("No new hosts in ssh_config")
+		default:
+			setStatus(fmt.Sprintf("Imported %d SSH hosts", count))
+		}
+	}
+}
+
 func updateSSHMenu() {
-	// Hide all items first
-	for i := 0; i < maxMenuItems; i++ {
-		sshMenuItems[i].Hide()
+	cfg := currentConfig()
+	var entries []SSHEntry
+	if cfg != nil {
+		entries = sortMenuEntries(cfg, usageSSH, cfg.SSH, func(e SSHEntry) menuSortKey { return menuSortKey{e.Index, e.Name, e.Group} })
 	}
+	stateMutex.Lock()
+	sshEntries = entries
+	stateMutex.Unlock()
 
-	if appConfig == nil || len(appConfig.SSH) == 0 {
-		// Show "No SSH configured" in first slot
-		sshMenuItems[0].SetTitle("No SSH connections configured")
-		sshMenuItems[0].SetTooltip("Edit config file to add SSH connections")
-		sshMenuItems[0].Disable()
-		sshMenuItems[0].Show()
+	if len(entries) == 0 {
+		sshMenu.ShowPlaceholder("No SSH connections configured", "Edit config file to add SSH connections")
 		return
 	}
+	aliases := sshProbeAliases(cfg)
+	sshMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		title, tooltip := sshMenuItemText(entries[i], aliases)
+		item.SetTitle(title)
+		item.SetTooltip(tooltip)
+	})
+}
 
-	// Update entries and show items
-	for i, entry := range appConfig.SSH {
-		if i >= maxMenuItems {
-			break
-		}
-		sshEntries[i] = entry
-		displayName := fmt.Sprintf("[%d] %s", entry.Index, entry.Name)
-		sshMenuItems[i].SetTitle(displayName)
-		sshMenuItems[i].SetTooltip(entry.Command)
-		sshMenuItems[i].Enable()
-		sshMenuItems[i].Show()
+func handleSSHClick(index int) {
+	stateMutex.RLock()
+	var entry SSHEntry
+	if index < len(sshEntries) {
+		entry = sshEntries[index]
+	}
+	stateMutex.RUnlock()
+	if entry.Command != "" || entry.Script != "" || entry.Mode != "" {
+		executeSSHEntry(entry)
 	}
 }
 
-func handleSSHClickByIndex(item *systray.MenuItem, index int) {
-	for range item.ClickedCh {
-		stateMutex.RLock()
-		entry := sshEntries[index]
-		stateMutex.RUnlock()
-		if entry.Command != "" || entry.Script != "" {
-			executeSSHEntry(entry)
+func executeSSHEntry(entry SSHEntry) {
+	switch entry.Mode {
+	case "":
+		entry.Command = sshCommandWithJumpHosts(entry)
+	case sshModeSerial, sshModeTelnet:
+		command, err := consoleCommand(entry)
+		if err != nil {
+			LogError("Failed to open console %s: %v", entry.Name, err)
+			setStatusError(fmt.Sprintf("Console failed: %s", truncateError(err)))
+			return
 		}
+		entry.Command = command
 	}
-}
+	if entry.Mode != sshModeBuiltin {
+		entry.Command = expandSSHCommand(entry)
+	}
+	// Show the command as it will run, after jump hosts and {NAME}s are filled in
+	if entry.Confirm && !confirmEntry("SSH", entry.Name, confirmSSHPreview(entry)) {
+		return
+	}
+	recordUsage(usageSSH, entry.Name)
 
-func executeSSHEntry(entry SSHEntry) {
 	// If script is defined, run it instead of/before opening terminal
 	if entry.Script != "" {
 		engine := GetLuaEngine()
-		if engine != nil {
-			ctx := map[string]string{
-				"command":  entry.Command,
-				"terminal": entry.Terminal,
-				"name":     entry.Name,
-				"index":    fmt.Sprintf("%d", entry.Index),
-			}
-			_, err := engine.RunScript(entry.Script, ctx)
-			LogScriptExecuted(entry.Script, "ssh", err)
-			if err != nil {
-				mStatus.SetTitle(fmt.Sprintf("Script error: %s", truncateError(err)))
-			} else {
-				mStatus.SetTitle(fmt.Sprintf("Script: %s", entry.Name))
-			}
-			return
+		cfg := currentConfig()
+
+		ctx := map[string]string{
+			"command":  entry.Command,
+			"terminal": resolveTerminal(cfg, entry),
+			"name":     entry.Name,
+			"index":    fmt.Sprintf("%d", entry.Index),
 		}
+		_, err := engine.RunScript(entry.Script, ctx)
+		LogScriptExecuted(entry.Script, "ssh", err)
+		if err != nil {
+			setStatusError(fmt.Sprintf("Script error: %s", truncateError(err)))
+		} else {
+			setStatus(fmt.Sprintf("Script: %s", entry.Name))
+		}
+		return
+	}
+
+	if entry.Mode == sshModeBuiltin {
+		executeBuiltinSSHEntry(entry)
+		return
 	}
 
 	// Default behavior: open terminal with SSH command
-	if err := openTerminal(entry); err != nil {
+	if err := launchSSHTerminal(entry); err != nil {
 		LogError("Failed to open SSH %s: %v", entry.Name, err)
-		mStatus.SetTitle(fmt.Sprintf("SSH failed: %s", entry.Name))
+		setStatusError(fmt.Sprintf("SSH failed: %s", entry.Name))
 	} else {
 		LogSSHOpened(entry.Name)
-		mStatus.SetTitle(fmt.Sprintf("SSH: %s", entry.Name))
+		setStatus(fmt.Sprintf("SSH: %s", entry.Name))
 	}
 }
 
-var mCacheClear *systray.MenuItem
+// executeBuiltinSSHEntry runs a builtin entry's exec command and copies its output,
+// or opens its interactive session in a terminal
+func executeBuiltinSSHEntry(entry SSHEntry) {
+	if entry.Exec != "" {
+		setStatus(fmt.Sprintf("SSH: running on %s...", entry.Name))
+		output, err := runBuiltinSSHExec(entry)
+		if err != nil {
+			LogError("SSH exec on %s failed: %v", entry.Name, err)
+			setStatusError(fmt.Sprintf("SSH failed: %s", truncateError(err)))
+			return
+		}
+		if err := copyToClipboardWithHistory("ssh: "+entry.Name, output); err != nil {
+			LogError("Failed to copy SSH output: %v", err)
+			setStatusError("Copy failed")
+			return
+		}
+		LogSSHOpened(entry.Name)
+		setStatus(fmt.Sprintf("SSH: copied output of %s", entry.Name))
+		return
+	}
 
-func loadAndBuildCacheMenu() {
-	// Pre-allocate menu items pool
-	cacheMenuItems = make([]*systray.MenuItem, maxMenuItems)
-	cacheKeys = make([]string, maxMenuItems)
+	command, err := builtinSSHCommand(entry)
+	if err == nil {
+		entry.Command = command
+		err = launchSSHTerminal(entry)
+	}
+	if err != nil {
+		LogError("Failed to open SSH %s: %v", entry.Name, err)
+		setStatusError(fmt.Sprintf("SSH failed: %s", entry.Name))
+		return
+	}
+	LogSSHOpened(entry.Name)
+	setStatus(fmt.Sprintf("SSH: %s", entry.Name))
+}
 
-	for i := 0; i < maxMenuItems; i++ {
-		item := mCacheMenu.AddSubMenuItem("", "")
-		item.Hide()
-		cacheMenuItems[i] = item
-		go handleCacheClickByIndex(item, i)
+// launchSSHTerminal opens entry.Command in the entry's tmux session if it has one,
+// otherwise in a new terminal window
+func launchSSHTerminal(entry SSHEntry) error {
+	if entry.Tmux != "" {
+		return openInTmux(entry)
+	}
+	// send_after is only typed once focus has moved from this window to the new terminal
+	previous, _ := focusedWindowPlatform()
+	if err := openTerminal(entry); err != nil {
+		return err
 	}
+	// Builtin sessions send their send_after lines over the connection
+	if entry.Mode != sshModeBuiltin {
+		typeSendAfter(entry, previous)
+	}
+	return nil
+}
+
+var (
+	mCacheClear        *systray.MenuItem
+	mCacheClearProfile *systray.MenuItem
+	mCacheUsage        *systray.MenuItem
+	mCacheStats        *systray.MenuItem
+)
 
-	// Add separator and clear button
-	mCacheMenu.AddSubMenuItem("", "")
-	mCacheClear = mCacheMenu.AddSubMenuItem("Clear Cache", "Remove all cached items")
-	go handleCacheClearClick()
+func loadAndBuildCacheMenu() {
+	// Separator, usage info, and clear buttons after the entries
+	cacheMenu = newMenuList(mCacheMenu, handleCacheClick, func() []*systray.MenuItem {
+		separator := mCacheMenu.AddSubMenuItem("", "")
+		mCacheUsage = mCacheMenu.AddSubMenuItem("", "Cache usage and limits")
+		mCacheUsage.Disable()
+		mCacheStats = mCacheMenu.AddSubMenuItem("", "Cache hit/miss statistics")
+		mCacheStats.Disable()
+		mCacheClearProfile = mCacheMenu.AddSubMenuItem("Clear Profile Cache", "Remove cached items for the current profile and principal")
+		go handleCacheClearProfileClick(mCacheClearProfile)
+		mCacheClear = mCacheMenu.AddSubMenuItem("Clear Cache", "Remove all cached items")
+		go handleCacheClearClick(mCacheClear)
+		return []*systray.MenuItem{separator, mCacheUsage, mCacheStats, mCacheClearProfile, mCacheClear}
+	})
 
 	// Now populate with actual data
 	updateCacheMenu()
 }
 
 func updateCacheMenu() {
-	// Hide all items first
-	for i := 0; i < maxMenuItems; i++ {
-		cacheMenuItems[i].Hide()
-		cacheKeys[i] = ""
-	}
-
-	entries := GetCache().ListEntries()
-
-	if len(entries) == 0 {
-		// Show "Cache is empty" in first slot
-		cacheMenuItems[0].SetTitle("Cache is empty")
-		cacheMenuItems[0].SetTooltip("No cached values")
-		cacheMenuItems[0].Disable()
-		cacheMenuItems[0].Show()
-		mCacheMenu.SetTitle("Cache (0)")
+	// Headless subcommands have no tray menu
+	if cacheMenu == nil {
 		return
 	}
 
-	// Update entries and show items
+	entries := GetCache().ListEntries()
+	keys := make([]string, len(entries))
 	for i, entry := range entries {
-		if i >= maxMenuItems {
-			break
-		}
-		stateMutex.Lock()
-		cacheKeys[i] = entry.Key
-		stateMutex.Unlock()
-
-		// Format display name based on type
-		displayName := formatCacheEntryName(entry)
-		tooltip := formatCacheEntryTooltip(entry)
+		keys[i] = entry.Key
+	}
+	stateMutex.Lock()
+	cacheKeys = keys
+	stateMutex.Unlock()
 
-		cacheMenuItems[i].SetTitle(displayName)
-		cacheMenuItems[i].SetTooltip(tooltip)
-		cacheMenuItems[i].Enable()
-		cacheMenuItems[i].Show()
+	if len(entries) == 0 {
+		cacheMenu.ShowPlaceholder("Cache is empty", "No cached values")
+	} else {
+		cacheMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+			// Format display name based on type
+			item.SetTitle(formatCacheEntryName(entries[i]))
+			item.SetTooltip(formatCacheEntryTooltip(entries[i]))
+		})
 	}
 
+	// The footer exists once the list has been shown
+	mCacheUsage.SetTitle(fmt.Sprintf("Usage: %s", GetCache().UsageSummary()))
+	mCacheStats.SetTitle(fmt.Sprintf("Stats: %s", GetCache().MetricsSummary()))
+	mCacheClearProfile.SetTitle(fmt.Sprintf("Clear Profile Cache (%s)", truncateString(GetCache().NamespaceName(), 40)))
 	mCacheMenu.SetTitle(fmt.Sprintf("Cache (%d)", len(entries)))
+	updateJWTMenu()
 }
 
-func formatCacheEntryName(entry CacheEntry) string {
+func formatCacheEntryName(entry cache.Entry) string {
 	// Strip prefix from key for display
 	displayKey := entry.Key
 	switch entry.Type {
 	case "token":
-		displayKey = entry.Key[len(PrefixToken):]
+		displayKey = entry.Key[len(cache.PrefixToken):]
 		return fmt.Sprintf("[token] %s", truncateString(displayKey, 30))
 	case "jwt":
-		displayKey = entry.Key[len(PrefixJWT):]
+		displayKey = entry.Key[len(cache.PrefixJWT):]
 		return fmt.Sprintf("[jwt] %s", truncateString(displayKey, 30))
 	case "secret":
-		displayKey = entry.Key[len(PrefixSecret):]
+		displayKey = entry.Key[len(cache.PrefixSecret):]
 		return fmt.Sprintf("[secret] %s", truncateString(displayKey, 30))
 	default:
 		return fmt.Sprintf("[custom] %s", truncateString(displayKey, 30))
 	}
 }
 
-func formatCacheEntryTooltip(entry CacheEntry) string {
+func formatCacheEntryTooltip(entry cache.Entry) string {
 	valuePreview := truncateString(entry.Value, 50)
 	if !entry.ExpiresAt.IsZero() {
 		remaining := time.Until(entry.ExpiresAt)
@@ -729,68 +947,268 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
 }
 
-func handleCacheClickByIndex(item *systray.MenuItem, index int) {
-	for range item.ClickedCh {
-		stateMutex.RLock()
-		key := cacheKeys[index]
-		stateMutex.RUnlock()
+func handleCacheClick(index int) {
+	stateMutex.RLock()
+	var key string
+	if index < len(cacheKeys) {
+		key = cacheKeys[index]
+	}
+	stateMutex.RUnlock()
 
-		if key == "" {
-			continue
+	if key == "" {
+		return
+	}
+	if strings.HasPrefix(key, cache.PrefixSecret) {
+		if err := unlockSecrets(fmt.Sprintf("Unlock secrets to copy %s", key[len(cache.PrefixSecret):])); err != nil {
+			setStatusError(fmt.Sprintf("Secrets locked: %s", truncateError(err)))
+			return
 		}
-
-		// Get the value and copy to clipboard
-		value, found := GetCache().GetValue(key)
-		if !found {
-			mStatus.SetTitle("Cache entry not found")
-			updateCacheMenu() // Refresh the menu
-			continue
+	}
+	if strings.HasPrefix(key, cache.PrefixToken) || strings.HasPrefix(key, cache.PrefixJWT) {
+		if err := requireSecurityKey(securityKeyTokens, "Copy "+key); err != nil {
+			setStatusError(fmt.Sprintf("Copy failed: %s", truncateError(err)))
+			return
 		}
+	}
 
-		if err := copyToClipboard(value); err != nil {
-			LogError("Failed to copy cache value: %v", err)
-			mStatus.SetTitle(fmt.Sprintf("Copy failed: %v", truncateError(err)))
+	// Get the value and copy to clipboard
+	value, found := GetCache().GetValue(key)
+	if !found {
+		setStatusError("Cache entry not found")
+		updateCacheMenu() // Refresh the menu
+		return
+	}
+
+	copied := true
+	var err error
+	secret := strings.HasPrefix(key, cache.PrefixToken) || strings.HasPrefix(key, cache.PrefixJWT) || strings.HasPrefix(key, cache.PrefixSecret)
+	if secret {
+		copied, err = copySecretToClipboard("cache: "+key, value, requesterMenu)
+	} else {
+		err = copyToClipboardWithHistory("cache: "+key, value)
+	}
+	if err != nil {
+		LogError("Failed to copy cache value: %v", err)
+		setStatusError(fmt.Sprintf("Copy failed: %v", truncateError(err)))
+	} else if copied {
+		verb := "Copied"
+		if secret {
+			logSecretCopy("cache", key)
+			verb = secretCopyVerb()
 		} else {
 			LogClipboardCopy("cache", key)
-			mStatus.SetTitle(fmt.Sprintf("Copied: %s", truncateString(key, 30)))
 		}
+		setStatus(fmt.Sprintf("%s: %s", verb, truncateString(key, 30)))
 	}
 }
 
-func handleCacheClearClick() {
-	for range mCacheClear.ClickedCh {
+func handleCacheClearClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
 		GetCache().Clear()
 		LogAction("cache_cleared", "Cache cleared")
-		mStatus.SetTitle("Cache cleared")
+		setStatus("Cache cleared")
 		updateCacheMenu()
 	}
 }
 
+func handleCacheClearProfileClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		namespace := GetCache().NamespaceName()
+		removed := GetCache().ClearNamespace()
+		LogAction("cache_profile_cleared", fmt.Sprintf("Profile cache cleared: %s (%d items)", namespace, removed))
+		setStatus(fmt.Sprintf("Profile cache cleared (%d items)", removed))
+		updateCacheMenu()
+	}
+}
+
+var (
+	mHistoryClear     *systray.MenuItem
+	mHistoryShareLink *systray.MenuItem
+	mHistoryShareSSH  *systray.MenuItem
+)
+
+func loadAndBuildHistoryMenu() {
+	// Separator, share and clear buttons after the entries
+	historyMenu = newMenuList(mHistoryMenu, handleHistoryClick, func() []*systray.MenuItem {
+		separator := mHistoryMenu.AddSubMenuItem("", "")
+		mHistoryShareLink = mHistoryMenu.AddSubMenuItem("Share Latest as One-Time Link", "Copy a link that serves the newest value once, on the REST API")
+		mHistoryShareSSH = mHistoryMenu.AddSubMenuItem("Send Latest to Remote File", "Write the newest value to bridge.remote_path on bridge.host (mode 0600)")
+		mHistoryClear = mHistoryMenu.AddSubMenuItem("Clear History", "Forget all copied values")
+		go handleHistoryClearClick(mHistoryClear)
+		go func(link *systray.MenuItem, ssh *systray.MenuItem) {
+			for {
+				select {
+				case <-link.ClickedCh:
+					noteUserActivity()
+					handleShareLinkClick()
+				case <-ssh.ClickedCh:
+					noteUserActivity()
+					handleShareRemoteClick()
+				}
+			}
+		}(mHistoryShareLink, mHistoryShareSSH)
+		return []*systray.MenuItem{separator, mHistoryShareLink, mHistoryShareSSH, mHistoryClear}
+	})
+
+	// Now populate with actual data
+	updateHistoryMenu()
+}
+
+func updateHistoryMenu() {
+	// Headless subcommands have no tray menu
+	if historyMenu == nil {
+		return
+	}
+
+	entries := GetClipboardHistory().List()
+
+	if len(entries) == 0 {
+		historyMenu.ShowPlaceholder("History is empty", "Copied values will appear here")
+		updateHistoryShareItems(false)
+		mHistoryMenu.SetTitle("Clipboard History")
+		return
+	}
+
+	// Values are never displayed
+	historyMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		item.SetTitle(fmt.Sprintf("[%s] %s", entries[i].CopiedAt.Format("15:04:05"), truncateString(entries[i].Label, 40)))
+		item.SetTooltip(fmt.Sprintf("Restore to clipboard (%d bytes)", entries[i].Size))
+	})
+	updateHistoryShareItems(true)
+	mHistoryMenu.SetTitle(fmt.Sprintf("Clipboard History (%d)", len(entries)))
+}
+
+// updateHistoryShareItems enables the share items while there is something to share, and
+// shows the remote file item only if bridge.host is set
+func updateHistoryShareItems(haveEntries bool) {
+	if mHistoryShareLink == nil {
+		return
+	}
+	for _, item := range []*systray.MenuItem{mHistoryShareLink, mHistoryShareSSH} {
+		if haveEntries {
+			item.Enable()
+		} else {
+			item.Disable()
+		}
+	}
+	if currentConfig().GetBridgeConfigWithDefaults().Host != "" {
+		mHistoryShareSSH.Show()
+	} else {
+		mHistoryShareSSH.Hide()
+	}
+}
+
+func handleHistoryClick(index int) {
+	entries := GetClipboardHistory().List()
+	if index >= len(entries) {
+		return
+	}
+
+	if entries[index].Secret {
+		if err := unlockSecrets(fmt.Sprintf("Unlock secrets to restore %s", entries[index].Label)); err != nil {
+			setStatusError(fmt.Sprintf("Secrets locked: %s", truncateError(err)))
+			return
+		}
+		// The entry may be a token rather than a secret
+		if err := requireSecurityKey(securityKeyTokens, "Restore "+entries[index].Label); err != nil {
+			setStatusError(fmt.Sprintf("Restore failed: %s", truncateError(err)))
+			return
+		}
+		if !confirmSensitiveCopy(entries[index].Label, requesterMenu) {
+			return
+		}
+	}
+
+	value, err := GetClipboardHistory().Value(index)
+	if err != nil {
+		LogError("Failed to restore clipboard history entry: %v", err)
+		setStatusError(fmt.Sprintf("Restore failed: %v", truncateError(err)))
+		updateHistoryMenu()
+		return
+	}
+
+	// Restore without recording a new history entry
+	if err := copyToClipboard(value); err != nil {
+		LogError("Failed to restore clipboard history entry: %v", err)
+		setStatusError(fmt.Sprintf("Restore failed: %v", truncateError(err)))
+		return
+	}
+	LogClipboardCopy("history", entries[index].Label)
+	setStatus(fmt.Sprintf("Restored: %s", truncateString(entries[index].Label, 30)))
+}
+
+func handleHistoryClearClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		GetClipboardHistory().Clear()
+		LogAction("clipboard_history_cleared", "Clipboard history cleared")
+		setStatus("Clipboard history cleared")
+		updateHistoryMenu()
+	}
+}
+
 func onExit() {
+	LogInfo("%s", GetCache().Stats())
 	LogShutdown()
 
+	// Write persisted cache entries, the credential and usage counts before exiting
+	FlushCachePersistence()
+	saveCredential()
+	flushUsage()
+	removeClipboardFiles()
+
+	// Export any pending trace spans
+	ShutdownTracing()
+
+	// Stop accepting control commands, API, and proxy requests
+	StopControlServer()
+	StopAPIServer()
+	StopProxyServer()
+	StopSSHProbe()
+	StopTokenPrefetch()
+	StopKeytabRenewal()
+	StopVPNWatch()
+	StopNotifications()
+
 	// Cleanup hotkeys
 	CleanupHotkeys()
 
-	// Release single instance lock
-	ReleaseSingleInstance()
+	// Start again if restarting, handing over the single instance lock; otherwise release it
+	if !restartRequested.Load() || !relaunchTray() {
+		ReleaseSingleInstance()
+	}
 }
 
 func handleMenuClicks() {
 	for {
 		select {
 		case <-mRefresh.ClickedCh:
+			noteUserActivity()
 			refreshToken()
 
 		case <-mCopyHeader.ClickedCh:
-			copyHTTPHeader()
+			noteUserActivity()
+			copyHTTPHeader(requesterMenu)
 
 		case <-mCopyToken.ClickedCh:
-			copyToken()
+			noteUserActivity()
+			copyToken(requesterMenu)
+
+		case <-mExportEnv.ClickedCh:
+			noteUserActivity()
+			go handleExportEnvClick()
 
 		case <-mDebug.ClickedCh:
 			toggleDebug()
 
+		case <-mViewLog.ClickedCh:
+			viewLog()
+
+		case <-mViewResponse.ClickedCh:
+			viewResponse()
+
+		case <-mUsageStats.ClickedCh:
+			go showUsageStats()
+
 		case <-mReloadCfg.ClickedCh:
 			reloadConfig()
 
@@ -802,33 +1220,66 @@ func handleMenuClicks() {
 }
 
 func reloadConfig() {
-	cfg, err := LoadConfig("")
+	cfg, err := loadSignedConfig(currentConfig().GetSigningConfigWithDefaults())
 	if err != nil {
 		LogError("Config reload failed: %v", err)
-		mStatus.SetTitle(fmt.Sprintf("Config error: %v", truncateError(err)))
+		setStatusError(fmt.Sprintf("Config error: %v", truncateError(err)))
 		return
 	}
-	appConfig = cfg
+	applySSHAutoSync(cfg)
+	setConfig(cfg)
+	if err := SetLogLevelName(cfg.GetLogConfigWithDefaults().Level); err != nil {
+		LogWarn("Ignoring log level from config: %v", err)
+	}
+	updateLogLevelMenu()
+	ConfigureTracing(cfg.GetLogConfigWithDefaults())
+	ApplyClipboardConfig(cfg.GetClipboardConfigWithDefaults())
+	ApplyCacheConfig(cfg.GetCacheConfigWithDefaults())
+	refreshCacheNamespace(cfg)
+	ApplyCredentialPersistence(cfg)
+	ApplyAPIConfig(cfg.GetAPIConfigWithDefaults())
+	ApplyProxyConfig(cfg.GetProxyConfigWithDefaults())
+	ApplyIdleLockConfig(cfg.GetIdleLockConfigWithDefaults())
 
 	// Update all menus with new config data
 	updateSPNMenu()
 	updateSecretsMenu()
 	updateURLsMenu()
 	updateSnippetsMenu()
+	warnSnippetSecrets(cfg)
 	updateSSHMenu()
+	for _, k := range usageKinds {
+		updateMenuSortChecks(k.kind)
+	}
+	updateSnippetShellChecks()
+	ApplySSHProbeConfig(cfg.GetSSHProbeConfigWithDefaults())
+	updateTmuxMenu()
+	updateTransfersMenu()
+	updateTokenSetsMenu()
+	updateCommandsMenu()
+	updateSessionsMenu()
+	updateCacheMenu()
+	updateHistoryMenu()
+	updateCredentialsMenu() // The transport or ccache may have changed
+	updateCachesMenu()
+	ApplyPrefetchConfig(cfg.GetPrefetchConfigWithDefaults())
+	ApplyKeytabConfig(cfg)
+	ApplyVPNConfig(cfg.GetVPNConfigWithDefaults())
+	applyQuickPickConfig(cfg.GetHotkeyConfigWithDefaults())
+	refreshStatusFormat()
 
 	LogConfigLoaded(len(cfg.SPNs), len(cfg.Secrets), len(cfg.URLs), len(cfg.Snippets), len(cfg.SSH))
-	mStatus.SetTitle(fmt.Sprintf("Config reloaded (%d SPNs, %d snippets, %d SSH)", len(cfg.SPNs), len(cfg.Snippets), len(cfg.SSH)))
+	setStatus(fmt.Sprintf("Config reloaded (%d SPNs, %d snippets, %d SSH)", len(cfg.SPNs), len(cfg.Snippets), len(cfg.SSH)))
 }
 
 func updatePlatformStatus() {
 	var platform string
 	switch runtime.GOOS {
 	case "darwin":
-		if IsMacOS11OrLater() {
+		if krb.IsMacOS11OrLater() {
 			platform = "macOS (GSS API)"
 		} else {
-			platform = "macOS (unsupported version)"
+			platform = "macOS (GSS API, KCM)"
 		}
 	case "windows":
 		platform = "Windows (SSPI)"
@@ -837,128 +1288,376 @@ func updatePlatformStatus() {
 	default:
 		platform = runtime.GOOS + " (unsupported)"
 	}
-	mStatus.SetTitle(fmt.Sprintf("Platform: %s", platform))
+	if transport := currentConfig().GetTransport(); transport != krb.TransportNative {
+		platform = fmt.Sprintf("%s, %s transport", platform, transport)
+	}
+	setStatus(fmt.Sprintf("Platform: %s", platform))
+}
+
+// updateSPNMenuTitle shows the selected SPN in the SPN menu's title, and whether the tray
+// is offline
+func updateSPNMenuTitle() {
+	if mSPNMenu == nil {
+		return
+	}
+	stateMutex.RLock()
+	title := currentSPNName
+	if title == "" {
+		title = currentSPN
+	}
+	stateMutex.RUnlock()
+	if title == "" {
+		return
+	}
+	if trayOffline() {
+		title += " (offline)"
+	}
+	mSPNMenu.SetTitle(fmt.Sprintf("SPN: %s", title))
 }
 
 func setSPN(spn string, displayName string) {
 	stateMutex.Lock()
 	currentSPN = spn
+	currentSPNName = displayName
 	stateMutex.Unlock()
 
 	LogSPNSelected(displayName)
 
-	if displayName != "" {
-		mSPNMenu.SetTitle(fmt.Sprintf("SPN: %s", displayName))
-	} else {
-		mSPNMenu.SetTitle(fmt.Sprintf("SPN: %s", spn))
+	// Headless runs have no tray menu
+	if mSPNMenu != nil {
+		updateSPNMenuTitle()
+		mRefresh.Enable()
 	}
-	mRefresh.Enable()
 
-	// Auto-refresh token when SPN is selected
+	// Use a token that's still cached (e.g. prefetched), otherwise request one
+	if useCachedToken(spn) {
+		return
+	}
 	refreshToken()
 }
 
+// useCachedToken makes a cached token for spn the current one. It reports false if
+// there's none, or it expires too soon to be worth copying.
+func useCachedToken(spn string) bool {
+	cfg := currentConfig()
+	refreshCacheNamespace(cfg)
+	token, expires, found := GetCache().GetTokenWithExpiry(spn)
+	if !found || time.Until(expires) < time.Minute {
+		return false
+	}
+
+	tokenTime := expires.Add(-cfg.GetTokenTTL(spn))
+	setLastToken(cache.NewLockedBuffer(token), tokenTime)
+
+	LogDebug("Using cached ticket for SPN")
+	if note := staleTokenNote(tokenTime); note != "" {
+		setStatus(fmt.Sprintf("Ticket OK (cached, %s)", note))
+	} else {
+		setStatus(fmt.Sprintf("Ticket OK (cached) - %s", tokenTime.Format("15:04:05")))
+	}
+	setTokenItemsEnabled(true)
+	return true
+}
+
 func refreshToken() {
 	stateMutex.RLock()
 	spn := currentSPN
+	name := currentSPNName
 	stateMutex.RUnlock()
+	cfg := currentConfig()
 
 	if spn == "" {
-		mStatus.SetTitle("Error: No SPN selected")
+		setStatusError("Error: No SPN selected")
 		return
 	}
 
 	LogDebug("Requesting ticket for SPN")
-	mStatus.SetTitle("Requesting ticket...")
+	setStatus("Requesting ticket...")
 
 	// Get the service ticket
 	token, err := getServiceTicket(spn)
+	if errors.Is(err, errTicketCancelled) {
+		// The previous token, if any, is still good
+		setStatus("Ticket request cancelled")
+		return
+	}
 	if err != nil {
-		LogTicketRequested("(current)", false, 0)
-		mStatus.SetTitle(fmt.Sprintf("Error: %v", truncateError(err)))
-		mCopyHeader.Disable()
-		mCopyToken.Disable()
+		LogTicketRequested(name, false, 0)
+		// Offline, keep working with the cached token; going offline was already announced
+		if classifyTicketError(err) == ticketErrKDCUnreachable && trayOffline() && useOfflineToken(spn) {
+			return
+		}
+		LogWarn("Ticket request for %s failed: %v", name, err)
+		setStatusError(describeTicketError(err))
+		setTokenItemsEnabled(false)
+		if !errors.Is(err, errIdleLocked) {
+			notifyUser("Ticket request failed", fmt.Sprintf("%s: %s", spn, ticketErrorNotice(err)))
+		}
 		return
 	}
 
-	// Store token in memory
-	stateMutex.Lock()
-	lastToken = base64.StdEncoding.EncodeToString(token)
-	lastTokenTime = time.Now()
-	stateMutex.Unlock()
+	// Encode straight into locked memory; the raw token is zeroed
+	size := len(token)
+	encoded := cache.NewLockedBase64(token)
 
-	// Cache the token for this SPN
-	GetCache().SetToken(spn, lastToken, DefaultTokenExpiration)
+	// Cache the token for this SPN under the principal it was minted for
+	refreshCacheNamespace(cfg)
+	GetCache().SetToken(spn, encoded.Clone(), cfg.GetTokenTTL(spn))
 	updateCacheMenu()
 
-	LogTicketRequested("(current)", true, len(token))
+	now := time.Now()
+	setLastToken(encoded, now)
+
+	LogTicketRequested(name, true, size)
 
 	// Update UI
-	mStatus.SetTitle(fmt.Sprintf("Ticket OK (%d bytes) - %s", len(token), lastTokenTime.Format("15:04:05")))
-	mCopyHeader.Enable()
-	mCopyToken.Enable()
+	setStatus(fmt.Sprintf("Ticket OK (%d bytes) - %s", size, now.Format("15:04:05")))
+	setTokenItemsEnabled(true)
 }
 
-func getServiceTicket(spn string) ([]byte, error) {
-	// Check platform support
-	if !IsMacOS11OrLater() && !IsWindows() && !IsLinux() {
-		return nil, fmt.Errorf("unsupported platform")
+// krbOptions returns the options for opening a ticket transport, with the transport and
+// ccache from the config
+func krbOptions() krb.Options {
+	opts := krb.Options{Debug: debugMode}
+	if cfg := configOrFile(); cfg != nil {
+		opts.Transport = cfg.Transport
+		opts.CCache = cfg.CCache
 	}
+	return opts
+}
+
+// getServiceTicket requests a ticket for spn. Concurrent requests for the same SPN share
+// one KDC request; each caller gets its own copy of the token to zero. Callers give up after
+// kdc_timeout_sec, or when the request is cancelled.
+func getServiceTicket(spn string) ([]byte, error) {
+	if trayIdleLocked() {
+		return nil, errIdleLocked
+	}
+
+	token, err := sharedTicketRequest(spn, configOrFile().GetKDCTimeout(), func() ([]byte, error) {
+		opts := krbOptions()
+		opts.Package = configOrFile().GetSSPIPackage(spn)
+		opts.CCache = configOrFile().GetCCache(spn)
+		span := StartSpan("kerberos.get_service_ticket")
+		span.SetAttr("krb.spn", spn)
+		span.SetAttr("krb.platform", runtime.GOOS)
+		span.SetAttr("krb.transport", configOrFile().GetTransport())
+		if runtime.GOOS == "windows" {
+			span.SetAttr("krb.sspi_package", opts.Package)
+		}
 
-	transport := NewGSSCredTransport()
-	transport.SetDebug(debugMode)
+		// Without a tray to renew it on schedule, as for the CLI, the TGT may be gone. The
+		// keytab only fills the default ccache, not an SPN's own.
+		if kt, ok := keytabConfig(configOrFile()); ok && opts.CCache == configOrFile().CCache {
+			if _, err := ensureKeytabTGT(kt, "for a ticket request"); err != nil {
+				span.End(err)
+				noteTicketResult(spn, err)
+				return nil, err
+			}
+		}
+		token, err := krb.ServiceToken(spn, opts)
+		span.SetAttr("krb.token_size", fmt.Sprintf("%d", len(token)))
+		span.End(err)
+		noteTicketResult(spn, err)
+		return token, err
+	})
+	if errors.Is(err, errTicketTimeout) {
+		LogWarn("Ticket request for %s: %v", spn, err)
+		noteTicketResult(spn, err)
+	}
+	return token, asTicketError(err)
+}
 
-	// On Linux, check for ccache
-	if IsLinux() {
-		ccache := os.Getenv("KRB5CCNAME")
-		if ccache != "" {
-			transport.SetCCachePath(ccache)
+// getCachedServiceToken returns a base64 token for spn, served from the cache (in the namespace
+// of the current principal) unless fresh is set, requesting and caching a new one otherwise.
+// If no KDC answers, a cached token is served even when fresh is set. Callers for the same
+// SPN take turns, so the ones that wait are served the token the first one cached.
+func getCachedServiceToken(cfg *Config, spn string, fresh bool) (string, error) {
+	refreshCacheNamespace(cfg)
+	if !fresh {
+		unlock := lockSPN(spn)
+		defer unlock()
+		if cachedToken, found := GetCache().GetToken(spn); found {
+			return cachedToken, nil
 		}
 	}
 
-	if err := transport.Connect(); err != nil {
-		return nil, err
+	token, err := getServiceTicket(spn)
+	if err != nil {
+		if classifyTicketError(err) == ticketErrKDCUnreachable {
+			if cachedToken, expires, found := GetCache().GetTokenWithExpiry(spn); found {
+				LogWarn("KDC unreachable, serving the cached token for %s from %s", spn, expires.Add(-cfg.GetTokenTTL(spn)).Format("15:04:05"))
+				return cachedToken, nil
+			}
+		}
+		return "", err
 	}
-	defer transport.Close()
 
-	return transport.GetServiceTicket(spn)
+	// Encode into locked memory and cache the token; the caller gets the only string copy
+	encoded := cache.NewLockedBase64(token)
+	value := encoded.String()
+	GetCache().SetToken(spn, encoded, cfg.GetTokenTTL(spn))
+	updateCacheMenu()
+
+	return value, nil
 }
 
-func copyHTTPHeader() {
+// setLastToken makes token the current one, destroying the one it replaces
+func setLastToken(token *cache.LockedBuffer, tokenTime time.Time) {
+	stateMutex.Lock()
+	previous := lastToken
+	lastToken = token
+	lastTokenTime = tokenTime
+	stateMutex.Unlock()
+	previous.Destroy()
+
+	if token != nil {
+		scheduleExpiryWarning(tokenTime)
+	}
+	renderStatusTemplates()
+}
+
+// setTokenItemsEnabled enables or disables Copy HTTP Header, Copy Token and Copy As;
+// headless runs have no tray menu
+func setTokenItemsEnabled(enabled bool) {
+	if mCopyHeader == nil {
+		return
+	}
+	if enabled {
+		mCopyHeader.Enable()
+		mCopyToken.Enable()
+		mCopyAsMenu.Enable()
+	} else {
+		mCopyHeader.Disable()
+		mCopyToken.Disable()
+		mCopyAsMenu.Disable()
+	}
+}
+
+// copyHTTPHeader copies "Negotiate <token>"; requester is what asked for it (menu or ctl).
+// It reports false if nothing was copied.
+func copyHTTPHeader(requester string) bool {
 	stateMutex.RLock()
-	token := lastToken
+	token := lastToken.String()
 	stateMutex.RUnlock()
 
 	if token == "" {
-		return
+		return false
 	}
 
+	if err := requireSecurityKey(securityKeyTokens, "Copy the HTTP header"); err != nil {
+		setStatusError(truncateError(err))
+		return false
+	}
 	header := "Negotiate " + token
-	if err := copyToClipboard(header); err != nil {
+	copied, err := copySecretToClipboard("HTTP header", header, requester)
+	if err != nil {
 		LogError("Failed to copy HTTP header: %v", err)
-		mStatus.SetTitle(fmt.Sprintf("Copy failed: %v", err))
-		return
+		setStatusError(fmt.Sprintf("Copy failed: %v", err))
+		return false
 	}
-	LogClipboardCopy("http_header", "Negotiate token")
-	mStatus.SetTitle("Copied HTTP header to clipboard")
+	if !copied {
+		return false
+	}
+	logSecretCopy("http_header", "Negotiate token")
+	stateMutex.RLock()
+	note := staleTokenNote(lastTokenTime)
+	stateMutex.RUnlock()
+	if note != "" {
+		setStatus(fmt.Sprintf("%s HTTP header (%s)", secretCopyVerb(), note))
+	} else if clipboardOptions.TypeOutSecrets {
+		setStatus("Typed HTTP header")
+	} else {
+		setStatus("Copied HTTP header to clipboard")
+	}
+	return true
 }
 
-func copyToken() {
+// copyToken copies the base64 token; requester is what asked for it (menu or ctl).
+// It reports false if nothing was copied.
+func copyToken(requester string) bool {
 	stateMutex.RLock()
-	token := lastToken
+	token := lastToken.String()
 	stateMutex.RUnlock()
 
 	if token == "" {
-		return
+		return false
 	}
 
-	if err := copyToClipboard(token); err != nil {
+	if err := requireSecurityKey(securityKeyTokens, "Copy the token"); err != nil {
+		setStatusError(truncateError(err))
+		return false
+	}
+	copied, err := copySecretToClipboard("Token", token, requester)
+	if err != nil {
 		LogError("Failed to copy token: %v", err)
-		mStatus.SetTitle(fmt.Sprintf("Copy failed: %v", err))
+		setStatusError(fmt.Sprintf("Copy failed: %v", err))
+		return false
+	}
+	if !copied {
+		return false
+	}
+	logSecretCopy("token", "Base64 token")
+	if clipboardOptions.TypeOutSecrets {
+		setStatus("Typed token")
+	} else {
+		setStatus("Copied token to clipboard")
+	}
+	return true
+}
+
+var (
+	mLogLevelMenu *systray.MenuItem
+	logLevelItems []*systray.MenuItem
+)
+
+func buildLogLevelMenu() {
+	mLogLevelMenu = systray.AddMenuItem("Log Level", "Select logging verbosity")
+	logLevelItems = make([]*systray.MenuItem, len(LogLevels))
+	for i, level := range LogLevels {
+		item := mLogLevelMenu.AddSubMenuItemCheckbox(level, fmt.Sprintf("Log %s messages and above", level), false)
+		logLevelItems[i] = item
+		go handleLogLevelClick(item, level)
+	}
+	updateLogLevelMenu()
+}
+
+func handleLogLevelClick(item *systray.MenuItem, level string) {
+	for range item.ClickedCh {
+		if err := SetLogLevelName(level); err != nil {
+			LogError("Failed to set log level: %v", err)
+			continue
+		}
+		updateLogLevelMenu()
+		setStatus(fmt.Sprintf("Log level: %s", CurrentLogLevel()))
+	}
+}
+
+func updateLogLevelMenu() {
+	selected := SelectedLogLevel()
+	for i, level := range LogLevels {
+		if level == selected {
+			logLevelItems[i].Check()
+		} else {
+			logLevelItems[i].Uncheck()
+		}
+	}
+	title := fmt.Sprintf("Log Level: %s", selected)
+	if current := CurrentLogLevel(); current != selected {
+		title = fmt.Sprintf("Log Level: %s (%s while debugging)", selected, current)
+	}
+	mLogLevelMenu.SetTitle(title)
+}
+
+func viewLog() {
+	cfg := currentConfig()
+
+	if err := openLogViewer(cfg.GetLogConfigWithDefaults().ViewLines); err != nil {
+		LogError("Failed to open log viewer: %v", err)
+		setStatusError(fmt.Sprintf("View log failed: %v", truncateError(err)))
 		return
 	}
-	LogClipboardCopy("token", "Base64 token")
-	mStatus.SetTitle("Copied token to clipboard")
+	setStatus("Opened log viewer")
 }
 
 func toggleDebug() {
@@ -970,6 +1669,7 @@ func toggleDebug() {
 	}
 	SetDebugMode(debugMode)
 	SetLogLevel(debugMode)
+	updateLogLevelMenu()
 }
 
 func truncateError(err error) string {
@@ -1000,3 +1700,20 @@ func getShortCommit() string {
 func copyToClipboard(text string) error {
 	return copyToClipboardPlatform(text)
 }
+
+// copyToClipboardWithHistory copies text and records it in the clipboard history under label.
+// Values larger than clipboard.max_size_kb are truncated or saved to a file (see fitClipboard).
+func copyToClipboardWithHistory(label string, text string) error {
+	text, err := fitClipboard(label, text)
+	if err != nil {
+		return err
+	}
+	if err := copyToClipboard(text); err != nil {
+		return err
+	}
+	GetClipboardHistory().Add(label, text, false)
+	if historyMenu != nil {
+		updateHistoryMenu()
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/getlantern/systray"
+)
+
+// editNameWidth is how much of the clipboard text is suggested as a new entry's name
+const editNameWidth = 30
+
+// editConfigFile loads the config file as written (without auto-synced SSH entries), lets
+// edit change it, saves it and reloads. edit returns what to show in the status line, or
+// "" to leave the file alone, e.g. when a dialog was cancelled.
+func editConfigFile(edit func(cfg *Config) (string, error)) error {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	// Rewriting a signed config would break its signature
+	if err := checkConfigRewritable(cfg, "edit it"); err != nil {
+		return err
+	}
+
+	status, err := edit(cfg)
+	if err != nil || status == "" {
+		return err
+	}
+	if err := SaveConfig(cfg, ""); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	LogAction("config_edited", status)
+	reloadConfig()
+	setStatus(status)
+	return nil
+}
+
+// pickEntry asks for the index of one of items, as the quick pick does, and returns its
+// position in items, or false if the dialog was cancelled or the index doesn't exist
+func pickEntry(title string, items []quickPickItem) (int, bool) {
+	if len(items) == 0 {
+		setStatus(fmt.Sprintf("Nothing to %s", strings.ToLower(title)))
+		return 0, false
+	}
+	input, ok := QuickPickDialog(title, quickPickGrid(items))
+	input = strings.TrimSpace(input)
+	if !ok || input == "" {
+		return 0, false
+	}
+	num, err := strconv.Atoi(input)
+	if err == nil {
+		for i, item := range items {
+			if item.Index == num {
+				return i, true
+			}
+		}
+	}
+	setStatus(fmt.Sprintf("No entry with index %s", input))
+	return 0, false
+}
+
+// nextEntryIndex returns the index after the highest one in use, for a new entry
+func nextEntryIndex(items []quickPickItem) int {
+	next := 0
+	for _, item := range items {
+		if item.Index >= next {
+			next = item.Index + 1
+		}
+	}
+	return next
+}
+
+// suggestedName returns the start of text's first line, as the default name for an entry
+func suggestedName(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if r := []rune(strings.TrimSpace(line)); len(r) > editNameWidth {
+		return string(r[:editNameWidth-1]) + "…"
+	}
+	return strings.TrimSpace(line)
+}
+
+// confirmSnippetValue applies policy.snippet_secrets to a value about to be saved: an error
+// if it blocks what looks like a credential, a confirmation if it warns. It reports false
+// if the user chose not to save.
+func confirmSnippetValue(cfg *Config, name string, value string) (bool, error) {
+	kind := snippetCredential(cfg, SnippetEntry{Name: name, Value: value})
+	if kind == "" {
+		return true, nil
+	}
+	if cfg.GetSnippetSecretsPolicy() == snippetSecretsBlock {
+		return false, fmt.Errorf("the value looks like %s, which policy.snippet_secrets blocks", kind)
+	}
+	return ConfirmDialog("Save Snippet", fmt.Sprintf("The value looks like %s. Snippets are kept in plaintext in ktray.json; secrets or the keychain are safer. Save it anyway?", kind)), nil
+}
+
+// addSnippetFromClipboard saves the clipboard text as a new snippet under a name the user
+// gives
+func addSnippetFromClipboard() error {
+	text, err := readClipboardPlatform()
+	if err != nil {
+		return fmt.Errorf("failed to read the clipboard: %w", err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("the clipboard holds no text")
+	}
+
+	return editConfigFile(func(cfg *Config) (string, error) {
+		name, ok := PromptForInput("Add Snippet", "Name for the snippet with the clipboard text:", suggestedName(text), false)
+		if !ok || strings.TrimSpace(name) == "" {
+			return "", nil
+		}
+		if ok, err := confirmSnippetValue(cfg, name, text); !ok {
+			return "", err
+		}
+		index := nextEntryIndex(snippetItems(cfg))
+		cfg.Snippets = append(cfg.Snippets, SnippetEntry{Index: index, Name: strings.TrimSpace(name), Value: text})
+		return fmt.Sprintf("Added snippet [%d] %s", index, strings.TrimSpace(name)), nil
+	})
+}
+
+// editSnippet renames a snippet and changes its value, or its variant for the selected shell
+// if it has one. Multi-line values can't be edited in a single-line prompt, so only their
+// name is asked for.
+func editSnippet() error {
+	return editConfigFile(func(cfg *Config) (string, error) {
+		i, ok := pickEntry("Edit Snippet", snippetItems(cfg))
+		if !ok {
+			return "", nil
+		}
+		entry := &cfg.Snippets[i]
+
+		name, ok := PromptForInput("Edit Snippet", "Name:", entry.Name, false)
+		if !ok || strings.TrimSpace(name) == "" {
+			return "", nil
+		}
+		shell := currentConfig().GetSnippetShell()
+		current, variant := entry.Variants[shell]
+		if !variant {
+			current = entry.Value
+		}
+		value := current
+		if !strings.Contains(value, "\n") && entry.Script == "" {
+			label := fmt.Sprintf("Value of %s:", strings.TrimSpace(name))
+			if variant {
+				label = fmt.Sprintf("Value of %s for %s:", strings.TrimSpace(name), shell)
+			}
+			if value, ok = PromptForInput("Edit Snippet", label, current, false); !ok {
+				return "", nil
+			}
+			if value != current {
+				if ok, err := confirmSnippetValue(cfg, name, value); !ok {
+					return "", err
+				}
+			}
+		}
+		entry.Name = strings.TrimSpace(name)
+		if variant {
+			entry.Variants[shell] = value
+		} else {
+			entry.Value = value
+		}
+		return fmt.Sprintf("Saved snippet [%d] %s", entry.Index, entry.Name), nil
+	})
+}
+
+// deleteSnippet removes a snippet after asking for confirmation
+func deleteSnippet() error {
+	return editConfigFile(func(cfg *Config) (string, error) {
+		i, ok := pickEntry("Delete Snippet", snippetItems(cfg))
+		if !ok {
+			return "", nil
+		}
+		entry := cfg.Snippets[i]
+		if !ConfirmDialog("Delete Snippet", fmt.Sprintf("Delete snippet [%d] %s?", entry.Index, entry.Name)) {
+			return "", nil
+		}
+		cfg.Snippets = slices.Delete(cfg.Snippets, i, i+1)
+		return fmt.Sprintf("Deleted snippet [%d] %s", entry.Index, entry.Name), nil
+	})
+}
+
+// addURLFromClipboard saves the URL on the clipboard as a new bookmark
+func addURLFromClipboard() error {
+	text, err := readClipboardPlatform()
+	if err != nil {
+		return fmt.Errorf("failed to read the clipboard: %w", err)
+	}
+	target := strings.TrimSpace(text)
+	if u, err := url.Parse(target); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("the clipboard holds no URL")
+	}
+
+	return editConfigFile(func(cfg *Config) (string, error) {
+		name, ok := PromptForInput("Add URL", fmt.Sprintf("Name for %s:", target), suggestedName(target), false)
+		if !ok || strings.TrimSpace(name) == "" {
+			return "", nil
+		}
+		index := nextEntryIndex(urlItems(cfg))
+		cfg.URLs = append(cfg.URLs, URLEntry{Index: index, Name: strings.TrimSpace(name), URL: target})
+		return fmt.Sprintf("Added URL [%d] %s", index, strings.TrimSpace(name)), nil
+	})
+}
+
+// editURL renames a bookmark and changes its URL; the script and authentication settings
+// are kept
+func editURL() error {
+	return editConfigFile(func(cfg *Config) (string, error) {
+		i, ok := pickEntry("Edit URL", urlItems(cfg))
+		if !ok {
+			return "", nil
+		}
+		entry := &cfg.URLs[i]
+
+		name, ok := PromptForInput("Edit URL", "Name:", entry.Name, false)
+		if !ok || strings.TrimSpace(name) == "" {
+			return "", nil
+		}
+		target, ok := PromptForInput("Edit URL", fmt.Sprintf("URL of %s:", strings.TrimSpace(name)), entry.URL, false)
+		if !ok {
+			return "", nil
+		}
+		target = strings.TrimSpace(target)
+		if u, err := url.Parse(target); err != nil || u.Scheme == "" || u.Host == "" {
+			return "", fmt.Errorf("not a URL: %s", target)
+		}
+		entry.Name = strings.TrimSpace(name)
+		entry.URL = target
+		return fmt.Sprintf("Saved URL [%d] %s", entry.Index, entry.Name), nil
+	})
+}
+
+// deleteURL removes a bookmark after asking for confirmation
+func deleteURL() error {
+	return editConfigFile(func(cfg *Config) (string, error) {
+		i, ok := pickEntry("Delete URL", urlItems(cfg))
+		if !ok {
+			return "", nil
+		}
+		entry := cfg.URLs[i]
+		if !ConfirmDialog("Delete URL", fmt.Sprintf("Delete URL [%d] %s?", entry.Index, entry.Name)) {
+			return "", nil
+		}
+		cfg.URLs = slices.Delete(cfg.URLs, i, i+1)
+		return fmt.Sprintf("Deleted URL [%d] %s", entry.Index, entry.Name), nil
+	})
+}
+
+// editMenuFooter adds a separator and the add, edit and delete items to a submenu, each
+// running its action when clicked
+func editMenuFooter(parent *systray.MenuItem, noun string, add, edit, remove func() error) []*systray.MenuItem {
+	separator := parent.AddSubMenuItem("", "")
+	items := []*systray.MenuItem{separator}
+	actions := []struct {
+		title   string
+		tooltip string
+		run     func() error
+	}{
+		{fmt.Sprintf("Add %s from Clipboard", noun), fmt.Sprintf("Save the clipboard text as a new %s in the config file", strings.ToLower(noun)), add},
+		{fmt.Sprintf("Edit %s…", noun), fmt.Sprintf("Rename a %s or change it", strings.ToLower(noun)), edit},
+		{fmt.Sprintf("Delete %s…", noun), fmt.Sprintf("Remove a %s from the config file", strings.ToLower(noun)), remove},
+	}
+	for _, action := range actions {
+		item := parent.AddSubMenuItem(action.title, action.tooltip)
+		go handleEditClick(item, action.run)
+		items = append(items, item)
+	}
+	return items
+}
+
+func handleEditClick(item *systray.MenuItem, run func() error) {
+	for range item.ClickedCh {
+		noteUserActivity()
+		if err := run(); err != nil {
+			LogError("Editing the config failed: %v", err)
+			setStatusError(fmt.Sprintf("Edit failed: %s", truncateError(err)))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/getlantern/systray"
+)
+
+// menuListGrowth is the step that lists with a footer grow by
+const menuListGrowth = 10
+
+// menuList is the part of a submenu that shows one item per entry (SPNs, snippets, cache
+// entries, ...). Items and their click goroutines are created as the list grows. systray
+// can't remove items, so when the list shrinks the spare items are hidden and reused the
+// next time it grows.
+//
+// New items can only be appended to the submenu, which would put them below any fixed
+// items that follow the list (such as "Clear Cache"). The footer function adds those fixed
+// items; when the list grows it is called again and the previous footer items are hidden.
+// A footer should therefore only add items: submenus with state of their own, like the tmux
+// sessions, belong above the list, where they are built once.
+type menuList struct {
+	mu          sync.Mutex
+	parent      *systray.MenuItem
+	items       []*systray.MenuItem
+	onClick     func(index int)
+	footer      func() []*systray.MenuItem
+	footerItems []*systray.MenuItem
+}
+
+// newMenuList starts an empty list in parent; items and the footer are added when it is
+// first shown. onClick is called with the index of the clicked item. footer may be nil if
+// nothing follows the list.
+func newMenuList(parent *systray.MenuItem, onClick func(index int), footer func() []*systray.MenuItem) *menuList {
+	return &menuList{parent: parent, onClick: onClick, footer: footer}
+}
+
+// Show displays n items, calling set to fill in each one's title and tooltip, and hides
+// the rest
+func (l *menuList) Show(n int, set func(i int, item *systray.MenuItem)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.grow(n)
+	for i, item := range l.items {
+		if i >= n {
+			item.Hide()
+			continue
+		}
+		set(i, item)
+		item.Enable()
+		item.Show()
+	}
+}
+
+// ShowPlaceholder displays a single disabled item, such as "No SPNs configured"
+func (l *menuList) ShowPlaceholder(title string, tooltip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.grow(1)
+	for i, item := range l.items {
+		if i > 0 {
+			item.Hide()
+			continue
+		}
+		item.SetTitle(title)
+		item.SetTooltip(tooltip)
+		item.Disable()
+		item.Show()
+	}
+}
+
+// Update changes the text of the first n items without touching their visibility
+func (l *menuList) Update(n int, set func(i int, item *systray.MenuItem)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := 0; i < n && i < len(l.items); i++ {
+		set(i, l.items[i])
+	}
+}
+
+// grow adds items until there are at least n, then (re)builds the footer below them
+func (l *menuList) grow(n int) {
+	if n <= len(l.items) && (l.footer == nil || l.footerItems != nil) {
+		return
+	}
+	if l.footer != nil {
+		// Leave room to grow, so the footer isn't rebuilt for every new entry
+		n = (n + menuListGrowth - 1) / menuListGrowth * menuListGrowth
+	}
+	for i := len(l.items); i < n; i++ {
+		item := l.parent.AddSubMenuItem("", "")
+		l.items = append(l.items, item)
+		go l.handleClicks(item, i)
+	}
+	if l.footer != nil {
+		for _, item := range l.footerItems {
+			item.Hide()
+		}
+		l.footerItems = l.footer()
+	}
+}
+
+func (l *menuList) handleClicks(item *systray.MenuItem, index int) {
+	for range item.ClickedCh {
+		noteUserActivity()
+		l.onClick(index)
+	}
+}
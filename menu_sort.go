@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getlantern/systray"
+)
+
+// Orders a menu can list its entries in
+const (
+	menuSortConfig = "config"
+	menuSortIndex  = "index"
+	menuSortName   = "name"
+	menuSortGroup  = "group"
+	menuSortUsage  = "usage"
+)
+
+// menuSortOrders lists the orders with their titles in the Sort By menus
+var menuSortOrders = []struct {
+	order string
+	title string
+}{
+	{menuSortConfig, "Config Order"},
+	{menuSortIndex, "Index"},
+	{menuSortName, "Name"},
+	{menuSortGroup, "Group"},
+	{menuSortUsage, "Most Used"},
+}
+
+var (
+	// menuSortItemsMutex guards menuSortItems
+	menuSortItemsMutex sync.Mutex
+
+	// menuSortItems holds the Sort By checkboxes of each menu, by usage kind and order
+	menuSortItems = map[string]map[string]*systray.MenuItem{}
+)
+
+// order returns the order configured for the menu of kind (one of the usage kinds)
+func (m MenuSortConfig) order(kind string) string {
+	switch kind {
+	case usageSPN:
+		return m.SPNs
+	case usageURL:
+		return m.URLs
+	case usageSnippet:
+		return m.Snippets
+	case usageSSH:
+		return m.SSH
+	}
+	return menuSortConfig
+}
+
+// setOrder sets the order of the menu of kind
+func (m *MenuSortConfig) setOrder(kind string, order string) {
+	switch kind {
+	case usageSPN:
+		m.SPNs = order
+	case usageURL:
+		m.URLs = order
+	case usageSnippet:
+		m.Snippets = order
+	case usageSSH:
+		m.SSH = order
+	}
+}
+
+// validMenuSort reports whether order is one the menu of kind can use; SPNs have no index
+func validMenuSort(kind string, order string) bool {
+	if kind == usageSPN && order == menuSortIndex {
+		return false
+	}
+	for _, o := range menuSortOrders {
+		if o.order == order {
+			return true
+		}
+	}
+	return false
+}
+
+// menuSortKey is what entries are sorted by
+type menuSortKey struct {
+	Index int
+	Name  string
+	Group string
+}
+
+// sortMenuEntries returns entries in the order menu_sort sets for kind. Entries that compare
+// equal keep their config order.
+func sortMenuEntries[T any](cfg *Config, kind string, entries []T, key func(T) menuSortKey) []T {
+	order := cfg.GetMenuSortConfigWithDefaults().order(kind)
+	if order == menuSortConfig || len(entries) < 2 {
+		return entries
+	}
+	keys := make([]menuSortKey, len(entries))
+	counts := make([]int, len(entries))
+	positions := make([]int, len(entries))
+	for i, e := range entries {
+		keys[i] = key(e)
+		positions[i] = i
+		if order == menuSortUsage {
+			counts[i] = usageCount(kind, keys[i].Name)
+		}
+	}
+	sort.SliceStable(positions, func(a, b int) bool {
+		x, y := keys[positions[a]], keys[positions[b]]
+		switch order {
+		case menuSortIndex:
+			return x.Index < y.Index
+		case menuSortName:
+			return strings.ToLower(x.Name) < strings.ToLower(y.Name)
+		case menuSortGroup:
+			// Ungrouped entries come last
+			gx, gy := strings.ToLower(x.Group), strings.ToLower(y.Group)
+			if gx != gy {
+				return gy == "" || (gx != "" && gx < gy)
+			}
+			return x.Index < y.Index
+		case menuSortUsage:
+			return counts[positions[a]] > counts[positions[b]]
+		}
+		return false
+	})
+
+	sorted := make([]T, len(entries))
+	for i, j := range positions {
+		sorted[i] = entries[j]
+	}
+	return sorted
+}
+
+// updateMenuForKind lists the entries of kind's menu again, e.g. after its order changed
+func updateMenuForKind(kind string) {
+	switch kind {
+	case usageSPN:
+		updateSPNMenu()
+	case usageURL:
+		updateURLsMenu()
+	case usageSnippet:
+		updateSnippetsMenu()
+	case usageSSH:
+		updateSSHMenu()
+	}
+}
+
+// menuSortFooter adds a Sort By submenu to parent and, if move is set, the Move Up and
+// Move Down items, which change an entry's index
+func menuSortFooter(parent *systray.MenuItem, kind string, noun string, move func(up bool) error) []*systray.MenuItem {
+	var items []*systray.MenuItem
+	if move != nil {
+		up := parent.AddSubMenuItem(fmt.Sprintf("Move %s Up…", noun), fmt.Sprintf("Swap a %s's index and place with the one before it", strings.ToLower(noun)))
+		down := parent.AddSubMenuItem(fmt.Sprintf("Move %s Down…", noun), fmt.Sprintf("Swap a %s's index and place with the one after it", strings.ToLower(noun)))
+		go handleEditClick(up, func() error { return move(true) })
+		go handleEditClick(down, func() error { return move(false) })
+		items = append(items, up, down)
+	}
+
+	sortMenu := parent.AddSubMenuItem("Sort By", fmt.Sprintf("Order the %s entries are listed in (saved to menu_sort)", strings.ToLower(noun)))
+	checks := map[string]*systray.MenuItem{}
+	for _, o := range menuSortOrders {
+		if !validMenuSort(kind, o.order) {
+			continue
+		}
+		item := sortMenu.AddSubMenuItemCheckbox(o.title, fmt.Sprintf("List %s entries by %s", strings.ToLower(noun), strings.ToLower(o.title)), false)
+		checks[o.order] = item
+		go handleEditClick(item, func(order string) func() error {
+			return func() error { return setMenuSort(kind, order) }
+		}(o.order))
+	}
+	menuSortItemsMutex.Lock()
+	menuSortItems[kind] = checks
+	menuSortItemsMutex.Unlock()
+	updateMenuSortChecks(kind)
+
+	return append(items, sortMenu)
+}
+
+// updateMenuSortChecks checks the order kind's menu is sorted by
+func updateMenuSortChecks(kind string) {
+	order := currentConfig().GetMenuSortConfigWithDefaults().order(kind)
+	menuSortItemsMutex.Lock()
+	defer menuSortItemsMutex.Unlock()
+	for o, item := range menuSortItems[kind] {
+		if o == order {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+}
+
+// setMenuSort saves order as menu_sort for kind's menu
+func setMenuSort(kind string, order string) error {
+	if currentConfig().GetMenuSortConfigWithDefaults().order(kind) == order {
+		updateMenuSortChecks(kind)
+		return nil
+	}
+	return editConfigFile(func(cfg *Config) (string, error) {
+		if cfg.MenuSort == nil {
+			cfg.MenuSort = &MenuSortConfig{}
+		}
+		cfg.MenuSort.setOrder(kind, order)
+		return fmt.Sprintf("%s menu sorted by %s", usageKindTitle(kind), order), nil
+	})
+}
+
+// usageKindTitle returns the menu title of a usage kind
+func usageKindTitle(kind string) string {
+	for _, k := range usageKinds {
+		if k.kind == kind {
+			return k.title
+		}
+	}
+	return kind
+}
+
+// moveIndexedEntry swaps the entry at i with the one before it (up) or after it in index
+// order, exchanging their indexes and their places in entries so the config file reads in
+// the same order. Entries with the same index are ordered by place. It returns the
+// entry's new place, or false if it is already first or last.
+func moveIndexedEntry[T any](entries []T, i int, up bool, index func(*T) *int) (int, bool) {
+	before := func(a, b int) bool {
+		ia, ib := *index(&entries[a]), *index(&entries[b])
+		return ia < ib || (ia == ib && a < b)
+	}
+	j := -1
+	for k := range entries {
+		if k == i {
+			continue
+		}
+		if up && before(k, i) && (j < 0 || before(j, k)) {
+			j = k
+		}
+		if !up && before(i, k) && (j < 0 || before(k, j)) {
+			j = k
+		}
+	}
+	if j < 0 {
+		return 0, false
+	}
+	a, b := index(&entries[i]), index(&entries[j])
+	*a, *b = *b, *a
+	entries[i], entries[j] = entries[j], entries[i]
+	return j, true
+}
+
+// moveEntry asks for one of the entries of kind's menu and moves it with move; name
+// describes the entry at a place for the status line
+func moveEntry(kind string, noun string, up bool, items func(cfg *Config) []quickPickItem, move func(cfg *Config, i int) (int, bool), name func(cfg *Config, i int) string) error {
+	direction := "Down"
+	if up {
+		direction = "Up"
+	}
+	return editConfigFile(func(cfg *Config) (string, error) {
+		i, ok := pickEntry(fmt.Sprintf("Move %s %s", noun, direction), items(cfg))
+		if !ok {
+			return "", nil
+		}
+		j, ok := move(cfg, i)
+		if !ok {
+			setStatus(fmt.Sprintf("%s can't move %s", name(cfg, i), strings.ToLower(direction)))
+			return "", nil
+		}
+		status := fmt.Sprintf("Moved %s %s", name(cfg, j), strings.ToLower(direction))
+		if order := cfg.GetMenuSortConfigWithDefaults().order(kind); order != menuSortConfig && order != menuSortIndex {
+			status += fmt.Sprintf(" (the menu is sorted by %s)", order)
+		}
+		return status, nil
+	})
+}
+
+func moveURL(up bool) error {
+	return moveEntry(usageURL, "URL", up, urlItems,
+		func(cfg *Config, i int) (int, bool) {
+			return moveIndexedEntry(cfg.URLs, i, up, func(e *URLEntry) *int { return &e.Index })
+		},
+		func(cfg *Config, i int) string { return fmt.Sprintf("[%d] %s", cfg.URLs[i].Index, cfg.URLs[i].Name) })
+}
+
+func moveSnippet(up bool) error {
+	return moveEntry(usageSnippet, "Snippet", up, snippetItems,
+		func(cfg *Config, i int) (int, bool) {
+			return moveIndexedEntry(cfg.Snippets, i, up, func(e *SnippetEntry) *int { return &e.Index })
+		},
+		func(cfg *Config, i int) string {
+			return fmt.Sprintf("[%d] %s", cfg.Snippets[i].Index, cfg.Snippets[i].Name)
+		})
+}
+
+func moveSSH(up bool) error {
+	return moveEntry(usageSSH, "SSH", up, sshItems,
+		func(cfg *Config, i int) (int, bool) {
+			return moveIndexedEntry(cfg.SSH, i, up, func(e *SSHEntry) *int { return &e.Index })
+		},
+		func(cfg *Config, i int) string { return fmt.Sprintf("[%d] %s", cfg.SSH[i].Index, cfg.SSH[i].Name) })
+}
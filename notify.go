@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errNotificationsUnsupported means the platform has no notification backend
+var errNotificationsUnsupported = errors.New("notifications are not supported on this platform")
+
+// Actions of the buttons on an expiry warning
+const (
+	notifyActionRefresh    = "refresh"
+	notifyActionCopyHeader = "copy_header"
+)
+
+// expiryWarningLead is how long before the current token expires the warning is shown
+const expiryWarningLead = time.Minute
+
+var (
+	expiryMutex sync.Mutex
+	expiryTimer *time.Timer
+)
+
+// notifyUser shows a desktop notification unless notifications are disabled. It doesn't
+// wait for the notification to be shown; failures are only logged.
+func notifyUser(title string, message string) {
+	postNotification(title, message, false)
+}
+
+// postNotification is notifyUser; withActions adds "Refresh now" and "Copy header" buttons
+// where the platform supports them (macOS, and Linux daemons that show actions)
+func postNotification(title string, message string, withActions bool) {
+	if currentConfig().GetNotifyConfigWithDefaults().Disabled {
+		return
+	}
+	go func() {
+		err := showNotification(title, message, withActions)
+		if err != nil && !errors.Is(err, errNotificationsUnsupported) {
+			LogDebug("Failed to show notification: %v", err)
+		}
+	}()
+}
+
+// scheduleExpiryWarning warns shortly before the token obtained at tokenTime expires,
+// unless expiry warnings are off or another token becomes current first
+func scheduleExpiryWarning(tokenTime time.Time) {
+	expiryMutex.Lock()
+	defer expiryMutex.Unlock()
+
+	if expiryTimer != nil {
+		expiryTimer.Stop()
+		expiryTimer = nil
+	}
+	if !currentConfig().GetNotifyConfigWithDefaults().ExpiryWarn {
+		return
+	}
+	life, ok := currentTokenLife()
+	if !ok {
+		return
+	}
+	wait := time.Until(life.expires.Add(-expiryWarningLead))
+	if wait <= 0 {
+		return
+	}
+	expiryTimer = time.AfterFunc(wait, func() {
+		stateMutex.RLock()
+		current := lastTokenTime.Equal(tokenTime) && lastToken.Len() > 0
+		name := currentSPNName
+		if name == "" {
+			name = currentSPN
+		}
+		stateMutex.RUnlock()
+		if current {
+			postNotification("Token expires soon", fmt.Sprintf("The token for %s expires in %s.", name, formatDuration(expiryWarningLead)), true)
+		}
+	})
+}
+
+// handleNotificationAction runs the action of a notification button the user clicked
+func handleNotificationAction(action string) {
+	LogDebug("Notification action: %s", action)
+	noteUserActivity()
+	switch action {
+	case notifyActionRefresh:
+		refreshToken()
+	case notifyActionCopyHeader:
+		if !copyHTTPHeader(requesterNotification) {
+			LogDebug("Header not copied from the notification")
+		}
+	}
+}
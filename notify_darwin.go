@@ -0,0 +1,62 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+/*
+#cgo LDFLAGS: -framework Foundation -framework UserNotifications
+
+#include <stdlib.h>
+
+// Implemented in notify_darwin.m: it has to be a separate file because this one exports
+// a Go function, and cgo allows only declarations in the preamble then
+int showUserNotification(const char *title, const char *message, int withActions);
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// notifyMutex serializes notifications, so only the first one sets up Notification Center
+// and asks for permission
+var notifyMutex sync.Mutex
+
+// showNotification posts a notification to Notification Center. withActions adds the
+// "Refresh now" and "Copy header" buttons; they're shown when the user hovers over the
+// notification, or always if krb5tray's alert style is set to Alerts in System Settings.
+// Notification Center only accepts notifications from an app bundle, so a bare binary
+// falls back to the status line.
+func showNotification(title string, message string, withActions bool) error {
+	ctitle := C.CString(title)
+	defer C.free(unsafe.Pointer(ctitle))
+	cmessage := C.CString(message)
+	defer C.free(unsafe.Pointer(cmessage))
+
+	actions := C.int(0)
+	if withActions {
+		actions = 1
+	}
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	switch C.showUserNotification(ctitle, cmessage, actions) {
+	case 1:
+		return nil
+	case 0:
+		return fmt.Errorf("notifications are turned off for krb5tray in System Settings")
+	case -1:
+		return errNotificationsUnsupported
+	}
+	return fmt.Errorf("Notification Center did not accept the notification")
+}
+
+//export krb5trayNotificationAction
+func krb5trayNotificationAction(action *C.char) {
+	// Called on Notification Center's queue; don't block it on a KDC request or a dialog
+	go handleNotificationAction(C.GoString(action))
+}
+
+// StopNotifications has nothing to stop on this platform
+func StopNotifications() {}
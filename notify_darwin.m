@@ -0,0 +1,110 @@
+#import <Foundation/Foundation.h>
+#import <UserNotifications/UserNotifications.h>
+
+#include "_cgo_export.h"
+
+// Identifiers of the expiry warning's category and buttons; the button identifiers are
+// the action names passed back to Go
+static NSString *const kExpiryCategory = @"KRB5TRAY_EXPIRY";
+static NSString *const kActionRefresh = @"refresh";
+static NSString *const kActionCopyHeader = @"copy_header";
+
+@interface Krb5TrayNotificationDelegate : NSObject <UNUserNotificationCenterDelegate>
+@end
+
+@implementation Krb5TrayNotificationDelegate
+
+// Show notifications posted while the tray counts as the frontmost app (its menu is open,
+// or a dialog is up); they'd be dropped otherwise
+- (void)userNotificationCenter:(UNUserNotificationCenter *)center
+       willPresentNotification:(UNNotification *)notification
+         withCompletionHandler:(void (^)(UNNotificationPresentationOptions))completionHandler {
+    completionHandler(UNNotificationPresentationOptionAlert | UNNotificationPresentationOptionSound);
+}
+
+- (void)userNotificationCenter:(UNUserNotificationCenter *)center
+didReceiveNotificationResponse:(UNNotificationResponse *)response
+         withCompletionHandler:(void (^)(void))completionHandler {
+    NSString *action = response.actionIdentifier;
+    if ([action isEqualToString:kActionRefresh] || [action isEqualToString:kActionCopyHeader]) {
+        krb5trayNotificationAction((char *)[action UTF8String]);
+    }
+    completionHandler();
+}
+
+@end
+
+static Krb5TrayNotificationDelegate *notificationDelegate = nil;
+static int notificationsAuthorized = -1; // -1 not asked yet, 0 denied, 1 granted
+
+// setupNotifications sets the delegate and the expiry category and asks for permission
+// the first time it's called. Returns 1 if notifications may be shown, 0 if the user
+// denied them, and -1 if the process isn't running from an app bundle, which
+// UNUserNotificationCenter requires (it throws otherwise). Calls are serialized by the
+// caller.
+static int setupNotifications(void) {
+    if ([[NSBundle mainBundle] bundleIdentifier] == nil) {
+        return -1;
+    }
+    if (notificationsAuthorized >= 0) {
+        return notificationsAuthorized;
+    }
+
+    UNUserNotificationCenter *center = [UNUserNotificationCenter currentNotificationCenter];
+    notificationDelegate = [[Krb5TrayNotificationDelegate alloc] init];
+    center.delegate = notificationDelegate;
+
+    UNNotificationAction *refresh = [UNNotificationAction actionWithIdentifier:kActionRefresh
+                                                                         title:@"Refresh now"
+                                                                       options:UNNotificationActionOptionNone];
+    UNNotificationAction *copyHeader = [UNNotificationAction actionWithIdentifier:kActionCopyHeader
+                                                                            title:@"Copy header"
+                                                                          options:UNNotificationActionOptionAuthenticationRequired];
+    UNNotificationCategory *expiry = [UNNotificationCategory categoryWithIdentifier:kExpiryCategory
+                                                                            actions:@[refresh, copyHeader]
+                                                                  intentIdentifiers:@[]
+                                                                            options:UNNotificationCategoryOptionNone];
+    [center setNotificationCategories:[NSSet setWithObject:expiry]];
+
+    __block int granted = 0;
+    dispatch_semaphore_t done = dispatch_semaphore_create(0);
+    [center requestAuthorizationWithOptions:(UNAuthorizationOptionAlert | UNAuthorizationOptionSound)
+                          completionHandler:^(BOOL ok, NSError *error) {
+        granted = ok ? 1 : 0;
+        dispatch_semaphore_signal(done);
+    }];
+    dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+    notificationsAuthorized = granted;
+    return granted;
+}
+
+int showUserNotification(const char *title, const char *message, int withActions) {
+    @autoreleasepool {
+        int status = setupNotifications();
+        if (status != 1) {
+            return status;
+        }
+
+        UNMutableNotificationContent *content = [[[UNMutableNotificationContent alloc] init] autorelease];
+        content.title = [NSString stringWithUTF8String:title];
+        content.body = [NSString stringWithUTF8String:message];
+        if (withActions) {
+            content.categoryIdentifier = kExpiryCategory;
+        }
+        UNNotificationRequest *request = [UNNotificationRequest requestWithIdentifier:[[NSUUID UUID] UUIDString]
+                                                                              content:content
+                                                                              trigger:nil];
+
+        __block int result = 1;
+        dispatch_semaphore_t done = dispatch_semaphore_create(0);
+        [[UNUserNotificationCenter currentNotificationCenter] addNotificationRequest:request
+                                                               withCompletionHandler:^(NSError *error) {
+            if (error != nil) {
+                result = -2;
+            }
+            dispatch_semaphore_signal(done);
+        }];
+        dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+        return result;
+    }
+}
@@ -0,0 +1,220 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The freedesktop notification service, talked to with gdbus (part of GLib, so present on
+// any desktop that runs a notification daemon)
+const (
+	notifyDest   = "org.freedesktop.Notifications"
+	notifyObject = "/org/freedesktop/Notifications"
+)
+
+var (
+	notifyIDPattern      = regexp.MustCompile(`^\(uint32 (\d+),\)`)
+	notifyActionPattern  = regexp.MustCompile(`ActionInvoked \(uint32 (\d+), '([^']*)'\)`)
+	notifyClosedPattern  = regexp.MustCompile(`NotificationClosed \(uint32 (\d+), uint32 \d+\)`)
+	notifyActionsWarning sync.Once
+)
+
+// dbusNotify tracks the notifications with buttons that are still shown, and the
+// "gdbus monitor" process that reports clicks on them
+var dbusNotify struct {
+	mu         sync.Mutex
+	checked    bool // Whether hasActions was looked up
+	hasActions bool
+	monitoring bool
+	stop       context.CancelFunc // Kills the monitor
+	pending    map[uint32]bool
+}
+
+// showNotification sends a notification to the desktop's notification daemon through
+// D-Bus. withActions adds "Refresh now" and "Copy header" buttons if the daemon supports
+// actions; clicks are picked up by watching its ActionInvoked signal. Without gdbus,
+// notify-send is used, and without either the status line is all there is.
+func showNotification(title string, message string, withActions bool) error {
+	gdbus, err := exec.LookPath("gdbus")
+	if err != nil {
+		if notifySend, err := exec.LookPath("notify-send"); err == nil {
+			return runNotifyCommand(notifySend, "--app-name=krb5tray", title, message)
+		}
+		return errNotificationsUnsupported
+	}
+
+	actions := "@as []"
+	buttons := false
+	if withActions && dbusNotifyHasActions(gdbus) {
+		if err := startNotifyMonitor(gdbus); err != nil {
+			LogDebug("Not watching notification actions: %v", err)
+		} else {
+			buttons = true
+			actions = fmt.Sprintf("[%s, %s, %s, %s]",
+				gvariantString(notifyActionRefresh), gvariantString("Refresh now"),
+				gvariantString(notifyActionCopyHeader), gvariantString("Copy header"))
+		}
+	} else if withActions {
+		notifyActionsWarning.Do(func() {
+			LogDebug("The notification daemon doesn't support actions, sending expiry warnings without buttons")
+		})
+	}
+
+	cmd := exec.Command(gdbus, "call", "--session", "--dest", notifyDest, "--object-path", notifyObject,
+		"--method", notifyDest+".Notify",
+		gvariantString("krb5tray"), "uint32 0", gvariantString("dialog-password"),
+		gvariantString(title), gvariantString(message), actions, "@a{sv} {}", "int32 -1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if buttons {
+		m := notifyIDPattern.FindStringSubmatch(strings.TrimSpace(string(output)))
+		if m == nil {
+			return fmt.Errorf("unexpected reply from Notify: %s", strings.TrimSpace(string(output)))
+		}
+		id, _ := strconv.ParseUint(m[1], 10, 32)
+		dbusNotify.mu.Lock()
+		dbusNotify.pending[uint32(id)] = true
+		dbusNotify.mu.Unlock()
+	}
+	return nil
+}
+
+func runNotifyCommand(path string, args ...string) error {
+	if output, err := exec.Command(path, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// dbusNotifyHasActions asks the notification daemon once whether it shows buttons. Some
+// (notify-osd, some phone shells) don't.
+func dbusNotifyHasActions(gdbus string) bool {
+	dbusNotify.mu.Lock()
+	defer dbusNotify.mu.Unlock()
+	if dbusNotify.checked {
+		return dbusNotify.hasActions
+	}
+
+	output, err := exec.Command(gdbus, "call", "--session", "--dest", notifyDest, "--object-path", notifyObject,
+		"--method", notifyDest+".GetCapabilities").Output()
+	if err != nil {
+		// Not remembered: the daemon may not have been started yet
+		return false
+	}
+	dbusNotify.checked = true
+	dbusNotify.hasActions = strings.Contains(string(output), "'actions'")
+	return dbusNotify.hasActions
+}
+
+// startNotifyMonitor starts "gdbus monitor" on the notification service unless it's
+// running. It returns once the monitor is subscribed, so a click on the notification sent
+// next can't be missed.
+func startNotifyMonitor(gdbus string) error {
+	dbusNotify.mu.Lock()
+	defer dbusNotify.mu.Unlock()
+	if dbusNotify.monitoring {
+		return nil
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, gdbus, "monitor", "--session", "--dest", notifyDest, "--object-path", notifyObject)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stop()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		stop()
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	// The first line ("Monitoring signals on object ...") is printed once subscribed
+	if !scanner.Scan() {
+		stop()
+		_ = cmd.Wait()
+		return fmt.Errorf("gdbus monitor exited")
+	}
+
+	dbusNotify.monitoring = true
+	dbusNotify.stop = stop
+	if dbusNotify.pending == nil {
+		dbusNotify.pending = make(map[uint32]bool)
+	}
+	go watchNotifySignals(cmd, scanner)
+	return nil
+}
+
+// watchNotifySignals runs the action of a button clicked on one of our notifications,
+// and forgets notifications once they're closed
+func watchNotifySignals(cmd *exec.Cmd, scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := notifyActionPattern.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			dbusNotify.mu.Lock()
+			ours := dbusNotify.pending[uint32(id)]
+			dbusNotify.mu.Unlock()
+			if ours {
+				go handleNotificationAction(m[2])
+			}
+		} else if m := notifyClosedPattern.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			dbusNotify.mu.Lock()
+			delete(dbusNotify.pending, uint32(id))
+			dbusNotify.mu.Unlock()
+		}
+	}
+	err := cmd.Wait()
+	LogDebug("Notification monitor exited: %v", err)
+
+	// Started again with the next notification that has buttons
+	dbusNotify.mu.Lock()
+	dbusNotify.monitoring = false
+	dbusNotify.pending = make(map[uint32]bool)
+	dbusNotify.mu.Unlock()
+}
+
+// StopNotifications kills the "gdbus monitor" process, which would otherwise outlive the
+// tray (or a restart, which keeps the process but not its goroutines)
+func StopNotifications() {
+	dbusNotify.mu.Lock()
+	defer dbusNotify.mu.Unlock()
+	if dbusNotify.stop != nil {
+		dbusNotify.stop()
+		dbusNotify.stop = nil
+	}
+}
+
+// gvariantString quotes s as a GVariant text format string, the form gdbus parses its
+// arguments in
+func gvariantString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !darwin && !linux
+// +build !windows,!darwin,!linux
+
+package main
+
+// showNotification has no backend on this platform yet; callers show the status line instead
+func showNotification(title string, message string, withActions bool) error {
+	return errNotificationsUnsupported
+}
+
+// StopNotifications has nothing to stop on this platform
+func StopNotifications() {}
@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// toastScript shows a WinRT toast, falling back to a notification area balloon where
+// toasts aren't available (Windows 7 and 8, or toasts turned off by policy). An unpackaged
+// app has no AppUserModelID of its own, so the toast is shown as PowerShell's. The text is
+// passed in the environment so it needs no quoting.
+const toastScript = `
+$title = [Security.SecurityElement]::Escape($env:KRB5TRAY_NOTIFY_TITLE)
+$message = [Security.SecurityElement]::Escape($env:KRB5TRAY_NOTIFY_MESSAGE)
+try {
+  [Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+  [Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+  $xml = New-Object Windows.Data.Xml.Dom.XmlDocument
+  $xml.LoadXml("<toast><visual><binding template='ToastGeneric'><text>$title</text><text>$message</text></binding></visual></toast>")
+  $toast = New-Object Windows.UI.Notifications.ToastNotification $xml
+  $appID = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+  [Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($appID).Show($toast)
+} catch {
+  Add-Type -AssemblyName System.Windows.Forms
+  $icon = New-Object System.Windows.Forms.NotifyIcon
+  $icon.Icon = [System.Drawing.SystemIcons]::Information
+  $icon.Visible = $true
+  $icon.ShowBalloonTip(5000, $env:KRB5TRAY_NOTIFY_TITLE, $env:KRB5TRAY_NOTIFY_MESSAGE, 'Info')
+  Start-Sleep -Seconds 6
+  $icon.Dispose()
+}
+`
+
+// showNotification shows a toast (or a balloon on older Windows). Toasts shown as
+// PowerShell's can't call back into the tray, so withActions is ignored.
+func showNotification(title string, message string, withActions bool) error {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "KRB5TRAY_NOTIFY_TITLE="+title, "KRB5TRAY_NOTIFY_MESSAGE="+message)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// StopNotifications has nothing to stop on this platform
+func StopNotifications() {}
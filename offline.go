@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"krb5tray/internal/cache"
+)
+
+// offlineState tracks whether the KDC can be reached. A ticket request that fails because
+// no KDC answered (e.g. the VPN is down) puts the tray offline: prefetching stops, cached
+// tokens are served with a note of their age, and the KDC is probed until it answers again.
+var offlineState struct {
+	mu      sync.Mutex
+	offline bool
+	since   time.Time
+	spn     string // Requested when probing, the last one that couldn't be served
+	timer   *time.Timer
+}
+
+// trayOffline reports whether the last ticket request found no KDC
+func trayOffline() bool {
+	offlineState.mu.Lock()
+	defer offlineState.mu.Unlock()
+	return offlineState.offline
+}
+
+// offlineSince returns when the tray went offline, or the zero time if it is online
+func offlineSince() time.Time {
+	offlineState.mu.Lock()
+	defer offlineState.mu.Unlock()
+	if !offlineState.offline {
+		return time.Time{}
+	}
+	return offlineState.since
+}
+
+// noteTicketResult updates the offline state after a ticket request for spn. Only a KDC
+// that didn't answer counts as offline, and only an answer (a ticket, an unknown SPN, or a
+// clock skew error) as back online; a missing TGT says nothing about the network.
+func noteTicketResult(spn string, err error) {
+	cfg := currentConfig()
+	// Headless commands that don't publish a config stop at the first error
+	if cfg == nil {
+		return
+	}
+	if cfg.GetOfflineConfigWithDefaults().Disabled {
+		markOnline()
+		return
+	}
+	switch classifyTicketError(err) {
+	case ticketErrKDCUnreachable:
+		markOffline(spn, err)
+	case "", ticketErrBadSPN, ticketErrClockSkew:
+		markOnline()
+	}
+}
+
+func markOffline(spn string, err error) {
+	probe := time.Duration(currentConfig().GetOfflineConfigWithDefaults().ProbeSec) * time.Second
+
+	offlineState.mu.Lock()
+	offlineState.spn = spn
+	if offlineState.offline {
+		offlineState.mu.Unlock()
+		return
+	}
+	offlineState.offline = true
+	offlineState.since = time.Now()
+	scheduleOfflineProbeLocked(probe)
+	offlineState.mu.Unlock()
+
+	LogWarn("KDC unreachable, working offline: %v", err)
+	LogAction("offline", "No KDC answered, serving cached tokens until it does")
+	updateOfflineMenu()
+	renderStatusTemplates()
+	notifyUser("Working offline", fmt.Sprintf("No KDC could be reached (is the VPN down?). Cached tokens are used until it answers again; checking every %s.", formatDuration(probe)))
+}
+
+func markOnline() {
+	offlineState.mu.Lock()
+	if !offlineState.offline {
+		offlineState.mu.Unlock()
+		return
+	}
+	offlineState.offline = false
+	if offlineState.timer != nil {
+		offlineState.timer.Stop()
+	}
+	since := offlineState.since
+	offlineState.mu.Unlock()
+
+	LogAction("online", fmt.Sprintf("KDC reachable again after %s offline", formatDuration(time.Since(since))))
+	updateOfflineMenu()
+	renderStatusTemplates()
+	notifyUser("Back online", "The KDC answers again; tokens are requested as usual.")
+
+	// Catch up on what was skipped while offline
+	go ApplyPrefetchConfig(currentConfig().GetPrefetchConfigWithDefaults())
+}
+
+// scheduleOfflineProbeLocked probes the KDC after d; offlineState.mu is held
+func scheduleOfflineProbeLocked(d time.Duration) {
+	if offlineState.timer == nil {
+		offlineState.timer = time.AfterFunc(d, probeKDC)
+	} else {
+		offlineState.timer.Stop()
+		offlineState.timer.Reset(d)
+	}
+}
+
+// probeKDC requests a ticket for the SPN that couldn't be served, keeping it if the KDC
+// answers, and schedules the next probe while it doesn't
+func probeKDC() {
+	offlineState.mu.Lock()
+	spn := offlineState.spn
+	offline := offlineState.offline
+	offlineState.mu.Unlock()
+	if !offline {
+		return
+	}
+
+	// While locked nothing may be requested; try again later
+	if !trayIdleLocked() {
+		token, err := getServiceTicket(spn)
+		if err == nil {
+			cfg := currentConfig()
+			refreshCacheNamespace(cfg)
+			GetCache().SetToken(spn, cache.NewLockedBase64(token), cfg.GetTokenTTL(spn))
+			updateCacheMenu()
+			refreshStaleToken()
+			return
+		}
+		LogDebug("KDC still unreachable: %v", err)
+	}
+
+	offlineState.mu.Lock()
+	if offlineState.offline {
+		scheduleOfflineProbeLocked(time.Duration(currentConfig().GetOfflineConfigWithDefaults().ProbeSec) * time.Second)
+	}
+	offlineState.mu.Unlock()
+}
+
+// probeKDCNow probes right away instead of at the next interval, e.g. when the VPN has
+// come up
+func probeKDCNow() {
+	offlineState.mu.Lock()
+	defer offlineState.mu.Unlock()
+	if offlineState.offline {
+		scheduleOfflineProbeLocked(0)
+	}
+}
+
+// refreshStaleToken replaces the current token if it was obtained before the tray went
+// back online, so it isn't left to expire
+func refreshStaleToken() {
+	stateMutex.RLock()
+	spn := currentSPN
+	tokenTime := lastTokenTime
+	stateMutex.RUnlock()
+	if spn == "" || tokenTime.IsZero() {
+		return
+	}
+	if useCachedToken(spn) {
+		stateMutex.RLock()
+		renewed := lastTokenTime.After(tokenTime)
+		stateMutex.RUnlock()
+		if renewed {
+			return
+		}
+	}
+	refreshToken()
+}
+
+// staleTokenNote describes a token obtained at tokenTime while the tray is offline, e.g.
+// "offline, token from 14:02:11"; it is "" while online
+func staleTokenNote(tokenTime time.Time) string {
+	if !trayOffline() {
+		return ""
+	}
+	return fmt.Sprintf("offline, token from %s", tokenTime.Format("15:04:05"))
+}
+
+// useOfflineToken makes the cached token for spn the current one after the KDC couldn't
+// be reached, however soon it expires. It reports false if there's none.
+func useOfflineToken(spn string) bool {
+	cfg := currentConfig()
+	refreshCacheNamespace(cfg)
+	token, expires, found := GetCache().GetTokenWithExpiry(spn)
+	if !found {
+		return false
+	}
+	tokenTime := expires.Add(-cfg.GetTokenTTL(spn))
+	setLastToken(cache.NewLockedBuffer(token), tokenTime)
+	setTokenItemsEnabled(true)
+
+	LogWarn("KDC unreachable, using the cached token from %s (expires in %s)", tokenTime.Format("15:04:05"), formatDuration(time.Until(expires)))
+	setStatusError(fmt.Sprintf("Offline - cached ticket from %s, expires in %s", tokenTime.Format("15:04"), formatDuration(time.Until(expires))))
+	return true
+}
+
+// updateOfflineMenu marks the SPN menu and the Refresh item while the tray is offline
+func updateOfflineMenu() {
+	// Headless subcommands have no tray menu
+	if mRefresh == nil {
+		return
+	}
+	updateSPNMenuTitle()
+	if since := offlineSince(); !since.IsZero() {
+		mRefresh.SetTitle("Refresh Ticket (offline)")
+		mRefresh.SetTooltip(fmt.Sprintf("No KDC has answered since %s; try again now", since.Format("15:04")))
+	} else {
+		mRefresh.SetTitle("Refresh Ticket")
+		mRefresh.SetTooltip("Re-request service ticket for current SPN")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !darwin
+// +build !darwin
+
+package krb
+
+import "time"
+
+// ImportCredential is only implemented on macOS, whose GSS API can export credentials
+func ImportCredential(data []byte) (string, time.Time, error) {
+	return "", time.Time{}, ErrUnsupported
+}
+
+// ForgetImportedCredential does nothing where credentials can't be imported
+func ForgetImportedCredential() {}
@@ -0,0 +1,39 @@
+//go:build darwin
+// +build darwin
+
+// This file covers what GSSCred provides on macOS 11+ for macOS 10.14 and 10.15, where the
+// credential caches are kept by KCM.
+
+package krb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// legacyDefaultCache returns the default cache name, KRB5CCNAME or the one /usr/bin/klist
+// reports (e.g. "API:5CDB1C9C-..."), since there is no GSSCred to ask
+func legacyDefaultCache() (string, error) {
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		return name, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "/usr/bin/klist").Output()
+	if err != nil {
+		return "", fmt.Errorf("klist: %w (no credentials in KCM?)", err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "Credentials cache:"); ok {
+			return strings.TrimSpace(name), nil
+		}
+	}
+	return "", fmt.Errorf("klist didn't report a credentials cache")
+}
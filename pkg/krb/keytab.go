@@ -0,0 +1,174 @@
+// This file gets a TGT with a keytab, like kinit -k, and writes it to the file ccache, so the
+// gokrb5 transport and every other Kerberos tool on the machine use it. It is for machines
+// nobody types a password on, such as jump boxes and CI runners.
+
+package krb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ccacheVersion is the file ccache format written, the one MIT Kerberos has used since 1.2
+const ccacheVersion = 0x0504
+
+// KeytabLogin gets a TGT for principal ("user@REALM", or just "user" in krb5.conf's
+// default_realm) with the keys in the keytab at path, and replaces the file ccache of opts
+// (opts.CCache, KRB5CCNAME, then the usual file) with it. It returns when the TGT expires.
+func KeytabLogin(path, principal string, opts Options) (time.Time, error) {
+	kt, err := keytab.Load(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load keytab %s: %w", path, err)
+	}
+	krb5ConfPath := krb5ConfFilePath()
+	cfg, err := config.Load(krb5ConfPath)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load krb5.conf from %s: %w", krb5ConfPath, err)
+	}
+
+	user, realm := principal, cfg.LibDefaults.DefaultRealm
+	if i := strings.LastIndex(principal, "@"); i >= 0 {
+		user, realm = principal[:i], principal[i+1:]
+	}
+	if user == "" || realm == "" {
+		return time.Time{}, newError(ErrNoTGT, "keytab principal %q has no realm, and krb5.conf has no default_realm", principal)
+	}
+
+	cl := client.NewWithKeytab(user, realm, kt, cfg, client.DisablePAFXFAST(true))
+	defer cl.Destroy()
+	req, err := messages.NewASReqForTGT(realm, cfg, cl.Credentials.CName())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create AS-REQ: %w", err)
+	}
+	if opts.Debug {
+		fmt.Printf("DEBUG: Requesting a TGT for %s@%s with keytab %s\n", user, realm, path)
+	}
+	rep, err := cl.ASExchange(realm, req, 0)
+	if err != nil {
+		return time.Time{}, keytabLoginError(user+"@"+realm, err)
+	}
+	defer zeroBytes(rep.DecryptedEncPart.Key.KeyValue)
+
+	data, err := marshalCCache(rep)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer zeroBytes(data)
+	ccachePath := ccacheFilePath(opts.CCache)
+	if err := writeFileAtomic(ccachePath, data); err != nil {
+		return time.Time{}, fmt.Errorf("failed to write ccache %s: %w", ccachePath, err)
+	}
+	if opts.Debug {
+		fmt.Printf("DEBUG: Wrote TGT valid until %s to %s\n", rep.DecryptedEncPart.EndTime, ccachePath)
+	}
+	return rep.DecryptedEncPart.EndTime, nil
+}
+
+// keytabLoginError explains a failed AS exchange; gokrb5 only hands on the KDC's error as text
+func keytabLoginError(principal string, err error) error {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "KDC_ERR_PREAUTH_FAILED"), strings.Contains(msg, "keytab incorrect"):
+		return fmt.Errorf("the keytab's keys for %s were rejected (is it out of date, with an old kvno?): %w", principal, err)
+	case strings.Contains(msg, "KDC_ERR_C_PRINCIPAL_UNKNOWN"):
+		return fmt.Errorf("the KDC doesn't know %s: %w", principal, err)
+	case strings.Contains(msg, krberror.NetworkingError):
+		return &Error{Kind: ErrKDCUnreachable, Msg: "no KDC answered the AS-REQ for " + principal, Err: err}
+	}
+	return fmt.Errorf("failed to get a TGT for %s: %w", principal, err)
+}
+
+// marshalCCache encodes the TGT of an AS-REP as a version 4 file ccache holding only it
+func marshalCCache(rep messages.ASRep) ([]byte, error) {
+	ticket, err := rep.Ticket.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the TGT: %w", err)
+	}
+	part := rep.DecryptedEncPart
+	start := part.StartTime
+	if start.IsZero() {
+		start = part.AuthTime
+	}
+	var flags uint32
+	if len(part.Flags.Bytes) >= 4 {
+		flags = binary.BigEndian.Uint32(part.Flags.Bytes)
+	}
+
+	b := binary.BigEndian.AppendUint16(nil, ccacheVersion)
+	b = binary.BigEndian.AppendUint16(b, 0) // No header fields
+
+	b = appendCCachePrincipal(b, rep.CName, rep.CRealm) // The default principal
+
+	// The TGT's credential
+	b = appendCCachePrincipal(b, rep.CName, rep.CRealm)
+	b = appendCCachePrincipal(b, rep.Ticket.SName, rep.Ticket.Realm)
+	b = binary.BigEndian.AppendUint16(b, uint16(part.Key.KeyType))
+	b = appendCCacheData(b, part.Key.KeyValue)
+	for _, t := range []time.Time{part.AuthTime, start, part.EndTime, part.RenewTill} {
+		b = binary.BigEndian.AppendUint32(b, ccacheTime(t))
+	}
+	b = append(b, 0) // Not a user-to-user ticket
+	b = binary.BigEndian.AppendUint32(b, flags)
+	b = binary.BigEndian.AppendUint32(b, 0) // No addresses
+	b = binary.BigEndian.AppendUint32(b, 0) // No authorization data
+	b = appendCCacheData(b, ticket)
+	b = appendCCacheData(b, nil) // No second ticket
+	return b, nil
+}
+
+// appendCCachePrincipal appends name@realm as a ccache principal
+func appendCCachePrincipal(b []byte, name types.PrincipalName, realm string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(name.NameType))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(name.NameString)))
+	b = appendCCacheData(b, []byte(realm))
+	for _, component := range name.NameString {
+		b = appendCCacheData(b, []byte(component))
+	}
+	return b
+}
+
+// appendCCacheData appends data with its 32-bit length
+func appendCCacheData(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// ccacheTime is t in seconds since the epoch, or 0 if it isn't set
+func ccacheTime(t time.Time) uint32 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint32(t.Unix())
+}
+
+// writeFileAtomic replaces the file at path with data, readable only by the user, so
+// nothing reading the ccache meanwhile sees half of it
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".krb5cc-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
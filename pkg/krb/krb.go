@@ -0,0 +1,354 @@
+// Package krb acquires Kerberos service tickets from the platform's credential store: the
+// GSS API on macOS (GSSCred on 11+, KCM before), SSPI on Windows and the ccache through
+// gokrb5 on Linux.
+// It is the part of ktray other tools can embed without the tray: no configuration,
+// caching or UI, just the user's existing credentials.
+//
+//	token, err := krb.ServiceToken("HTTP/app.example.com", krb.Options{})
+//	req.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(token))
+package krb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnsupported is returned on platforms without a transport
+	ErrUnsupported = errors.New("unsupported platform")
+
+	// ErrNoTGT is returned by TGTExpiry when the credentials hold no ticket-granting ticket,
+	// and is the kind of ticket errors for missing or expired credentials
+	ErrNoTGT = errors.New("no ticket-granting ticket")
+
+	// ErrKDCUnreachable is the kind of ticket errors for which no KDC answered
+	ErrKDCUnreachable = errors.New("KDC unreachable")
+
+	// ErrClockSkew is the kind of ticket errors for a clock too far from the KDC's
+	ErrClockSkew = errors.New("clock skew too great")
+
+	// ErrBadSPN is the kind of ticket errors for SPNs that are malformed or unknown to the KDC
+	ErrBadSPN = errors.New("bad SPN")
+)
+
+// Error is a ticket failure the transport recognized. errors.Is reports its Kind (one of
+// ErrNoTGT, ErrKDCUnreachable, ErrClockSkew and ErrBadSPN), while the message stays the
+// transport's own.
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error // The underlying error, if any
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Msg
+	case e.Msg == "":
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+// newError returns an Error of kind with a formatted message
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Options configures how a transport is opened
+type Options struct {
+	Debug bool // Print transport debug output to stdout
+
+	// Transport names the registered transport to use; TransportNative when empty
+	Transport string
+
+	// CCache is the credential cache to read with gokrb5 (the Linux native transport).
+	// KRB5CCNAME, then /tmp/krb5cc_<uid>, is used when empty. The macOS native transport
+	// takes a GSSCred cache UUID, and uses the default credential for anything else.
+	// Ignored on Windows.
+	CCache string
+
+	// Package is the SSPI package Windows makes tokens with: PackageNegotiate (SPNEGO, which
+	// may fall back to NTLM) when empty, or PackageKerberos. Tokens are Kerberos elsewhere.
+	Package string
+}
+
+// Transport acquires tickets from one credential source. Each platform registers its
+// native transport; gokrb5 and mock are available everywhere.
+type Transport interface {
+	Connect() error
+	Close() error
+	GetDefaultCache() (string, error)
+	GetDefaultPrincipal() (string, error)
+	GetCredentials() ([]CredInfo, error)
+	ExportCredential() ([]byte, error)
+	GetServiceTicket(spn string) ([]byte, error)
+}
+
+// TransportFactory returns an unconnected transport for opts
+type TransportFactory func(opts Options) Transport
+
+// CacheInfo describes one of the user's credential caches
+type CacheInfo struct {
+	Name      string    // What Options.CCache selects it with: a file path, or a GSSCred UUID
+	Principal string    // Its default principal
+	TGTExpiry time.Time // When its TGT expires; zero if it holds none
+	Current   bool      // Tickets are requested from it with the Options it was listed with
+}
+
+// cacheLister is implemented by transports that can choose between several caches
+type cacheLister interface {
+	ListCaches() ([]CacheInfo, error)
+}
+
+// cacheDestroyer is implemented by transports whose credential cache can be destroyed
+type cacheDestroyer interface {
+	DestroyCache() error
+}
+
+// CredInfo holds credential information
+type CredInfo struct {
+	ClientPrincipal string
+	ServerPrincipal string
+	Lifetime        uint32
+	AuthTime        int64
+	StartTime       int64
+	EndTime         int64
+	RenewTill       int64
+	KeyType         int32
+}
+
+// enctypeNames names the encryption types a CredInfo's KeyType can have (RFC 3961, 8009)
+var enctypeNames = map[int32]string{
+	1:  "des-cbc-crc",
+	3:  "des-cbc-md5",
+	16: "des3-cbc-sha1",
+	17: "aes128-cts-hmac-sha1-96",
+	18: "aes256-cts-hmac-sha1-96",
+	19: "aes128-cts-hmac-sha256-128",
+	20: "aes256-cts-hmac-sha384-192",
+	23: "rc4-hmac",
+	24: "rc4-hmac-exp",
+}
+
+// EnctypeName returns the name klist shows for an encryption type
+func EnctypeName(keyType int32) string {
+	if name, ok := enctypeNames[keyType]; ok {
+		return name
+	}
+	return fmt.Sprintf("etype %d", keyType)
+}
+
+// Names of the built-in transports
+const (
+	TransportNative = "native" // GSS API on macOS, SSPI on Windows, gokrb5 on Linux
+	TransportGokrb5 = "gokrb5" // Pure Go, reading a file ccache and krb5.conf
+)
+
+// SSPI packages a token can be made with on Windows
+const (
+	PackageNegotiate = "negotiate" // SPNEGO-wrapped Kerberos, or NTLM if Kerberos fails
+	PackageKerberos  = "kerberos"  // A raw Kerberos AP-REQ, never NTLM
+)
+
+// PackageInfo describes an SSPI security package installed on Windows
+type PackageInfo struct {
+	Name         string `json:"name"`
+	Comment      string `json:"comment"`
+	Capabilities uint32 `json:"capabilities"` // SECPKG_FLAG_* bits
+	MaxToken     uint32 `json:"max_token"`    // Largest token the package makes, in bytes
+}
+
+var (
+	transportsMu sync.RWMutex
+	transports   = map[string]TransportFactory{
+		TransportGokrb5: newGokrb5Transport,
+		TransportMock:   newMockTransport,
+	}
+)
+
+// RegisterTransport makes a transport available to Open under name, replacing any
+// transport registered under it before
+func RegisterTransport(name string, factory TransportFactory) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	transports[name] = factory
+}
+
+// TransportNames returns the names of the registered transports, sorted
+func TransportNames() []string {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Supported reports whether this platform has a working native transport
+func Supported() bool {
+	return IsMacOS11OrLater() || IsLegacyMacOS() || IsWindows() || IsLinux()
+}
+
+// Open returns a connected transport for the current user. The caller must Close it.
+func Open(opts Options) (Transport, error) {
+	t, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Connect(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// newTransport returns the unconnected transport opts names
+func newTransport(opts Options) (Transport, error) {
+	name := opts.Transport
+	if name == "" {
+		name = TransportNative
+	}
+	transportsMu.RLock()
+	factory, ok := transports[name]
+	transportsMu.RUnlock()
+	if !ok {
+		if name == TransportNative {
+			return nil, ErrUnsupported
+		}
+		return nil, fmt.Errorf("unknown transport %q (have %s)", name, strings.Join(TransportNames(), ", "))
+	}
+	return factory(opts), nil
+}
+
+// ListCaches returns the current user's credential caches the transport of opts can
+// request tickets from, sorted by principal. It returns ErrUnsupported for transports with a
+// single credential store, like SSPI.
+func ListCaches(opts Options) ([]CacheInfo, error) {
+	t, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := t.(cacheLister)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	caches, err := lister.ListCaches()
+	sort.Slice(caches, func(i, j int) bool {
+		if caches[i].Principal != caches[j].Principal {
+			return caches[i].Principal < caches[j].Principal
+		}
+		return caches[i].Name < caches[j].Name
+	})
+	return caches, err
+}
+
+// DestroyCache destroys the credential cache of opts with its tickets, like kdestroy, so
+// none are requested from it until the next kinit. It returns ErrUnsupported for transports
+// that can't, like SSPI, whose logon session's tickets PurgeTickets removes instead.
+func DestroyCache(opts Options) error {
+	t, err := newTransport(opts)
+	if err != nil {
+		return err
+	}
+	destroyer, ok := t.(cacheDestroyer)
+	if !ok {
+		return ErrUnsupported
+	}
+	return destroyer.DestroyCache()
+}
+
+// ServiceToken returns a SPNEGO token for spn ("HTTP/host" or "HTTP@host"), ready to be
+// base64-encoded into a Negotiate header. The caller should wipe it once used.
+func ServiceToken(spn string, opts Options) ([]byte, error) {
+	t, err := Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return t.GetServiceTicket(spn)
+}
+
+// DefaultPrincipal returns the principal of the current user's default credentials
+func DefaultPrincipal(opts Options) (string, error) {
+	t, err := Open(opts)
+	if err != nil {
+		return "", err
+	}
+	defer t.Close()
+	return t.GetDefaultPrincipal()
+}
+
+// ExportCredential returns the current user's default credential in a form ImportCredential
+// restores, e.g. in a later run. Only the macOS native transport can export it.
+func ExportCredential(opts Options) ([]byte, error) {
+	t, err := Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return t.ExportCredential()
+}
+
+// TGTExpiry returns when the current user's ticket-granting ticket expires
+func TGTExpiry(opts Options) (time.Time, error) {
+	t, err := Open(opts)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer t.Close()
+
+	creds, err := t.GetCredentials()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var expiry time.Time
+	for _, c := range creds {
+		// macOS names it just "krbtgt"
+		if c.ServerPrincipal != "krbtgt" && !strings.HasPrefix(c.ServerPrincipal, "krbtgt/") {
+			continue
+		}
+		if end := time.Unix(c.EndTime, 0); end.After(expiry) {
+			expiry = end
+		}
+	}
+	if expiry.IsZero() {
+		return time.Time{}, ErrNoTGT
+	}
+	return expiry, nil
+}
+
+// IsCacheUUID reports whether name is a GSSCred cache UUID, with or without the "API:"
+// prefix klist -l shows, e.g. API:6F9A1D3C-4B2E-4F11-9D5A-0C7E2B8F1A44
+func IsCacheUUID(name string) bool {
+	uuid := strings.TrimPrefix(name, "API:")
+	if len(uuid) != 36 {
+		return false
+	}
+	for i, r := range uuid {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if r != '-' {
+				return false
+			}
+		case !strings.ContainsRune("0123456789abcdefABCDEF", r):
+			return false
+		}
+	}
+	return true
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package krb
+
+import "time"
+
+// PurgeTickets is only implemented on Windows; elsewhere kdestroy does the same
+func PurgeTickets() error {
+	return ErrUnsupported
+}
+
+// RenewTGT is only implemented on Windows; elsewhere kinit -R does the same
+func RenewTGT() (time.Time, error) {
+	return time.Time{}, ErrUnsupported
+}
+
+// SecurityPackages is only implemented on Windows, the only platform with SSPI
+func SecurityPackages() ([]PackageInfo, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,247 @@
+//go:build windows
+// +build windows
+
+// This file talks to the Kerberos package in the LSA, for what klist does on Windows.
+
+package krb
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	secur32 = windows.NewLazySystemDLL("secur32.dll")
+
+	lsaConnectUntrusted            = secur32.NewProc("LsaConnectUntrusted")
+	lsaLookupAuthenticationPackage = secur32.NewProc("LsaLookupAuthenticationPackage")
+	lsaCallAuthenticationPackage   = secur32.NewProc("LsaCallAuthenticationPackage")
+	lsaFreeReturnBuffer            = secur32.NewProc("LsaFreeReturnBuffer")
+	lsaDeregisterLogonProcess      = secur32.NewProc("LsaDeregisterLogonProcess")
+)
+
+// KERB_PROTOCOL_MESSAGE_TYPE values (ntsecapi.h)
+const (
+	kerbRetrieveEncodedTicketMessage = 8
+	kerbPurgeTicketCacheMessage      = 7
+	kerbQueryTicketCacheExMessage    = 14
+)
+
+// kerbRetrieveTicketDontUseCache makes the LSA ask the KDC instead of returning a cached ticket
+const kerbRetrieveTicketDontUseCache = 0x1
+
+// lsaString is LSA_STRING
+type lsaString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *byte
+}
+
+// unicodeString is UNICODE_STRING; the requests here leave it empty
+type unicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *uint16
+}
+
+// String returns the string, whose Length is in bytes and which isn't NUL-terminated
+func (s unicodeString) String() string {
+	if s.Buffer == nil || s.Length == 0 {
+		return ""
+	}
+	return windows.UTF16ToString(unsafe.Slice(s.Buffer, s.Length/2))
+}
+
+// kerbPurgeTicketCacheRequest is KERB_PURGE_TKT_CACHE_REQUEST. Empty names purge every
+// ticket of the logon session.
+type kerbPurgeTicketCacheRequest struct {
+	MessageType uint32
+	LogonID     windows.LUID
+	ServerName  unicodeString
+	RealmName   unicodeString
+}
+
+// kerbQueryTicketCacheRequest is KERB_QUERY_TKT_CACHE_REQUEST; a zero LogonID is the
+// caller's logon session
+type kerbQueryTicketCacheRequest struct {
+	MessageType uint32
+	LogonID     windows.LUID
+}
+
+// kerbTicketCacheInfoEx is KERB_TICKET_CACHE_INFO_EX
+type kerbTicketCacheInfoEx struct {
+	ClientName     unicodeString
+	ClientRealm    unicodeString
+	ServerName     unicodeString
+	ServerRealm    unicodeString
+	StartTime      int64
+	EndTime        int64
+	RenewTime      int64
+	EncryptionType int32
+	TicketFlags    uint32
+}
+
+// kerbQueryTicketCacheExResponse is KERB_QUERY_TKT_CACHE_EX_RESPONSE. Tickets is a
+// variable-length array of CountOfTickets entries.
+type kerbQueryTicketCacheExResponse struct {
+	MessageType    uint32
+	CountOfTickets uint32
+	Tickets        [1]kerbTicketCacheInfoEx
+}
+
+// kerbRetrieveTicketRequest is KERB_RETRIEVE_TKT_REQUEST. An empty target name retrieves
+// the TGT.
+type kerbRetrieveTicketRequest struct {
+	MessageType       uint32
+	LogonID           windows.LUID
+	TargetName        unicodeString
+	TicketFlags       uint32
+	CacheOptions      uint32
+	EncryptionType    int32
+	CredentialsHandle [2]uintptr // SecHandle
+}
+
+// kerbExternalTicket is KERB_EXTERNAL_TICKET, the body of KERB_RETRIEVE_TKT_RESPONSE
+type kerbExternalTicket struct {
+	ServiceName         uintptr
+	TargetName          uintptr
+	ClientName          uintptr
+	DomainName          unicodeString
+	TargetDomainName    unicodeString
+	AltTargetDomainName unicodeString
+	SessionKeyType      int32
+	SessionKeyLength    uint32
+	SessionKeyValue     *byte
+	TicketFlags         uint32
+	Flags               uint32
+	KeyExpirationTime   int64
+	StartTime           int64
+	EndTime             int64
+	RenewUntil          int64
+	TimeSkew            int64
+	EncodedTicketSize   uint32
+	EncodedTicket       *byte
+}
+
+// PurgeTickets removes the Kerberos tickets of the current logon session, like
+// "klist purge". Windows gets a new TGT with the logon credentials when one is needed.
+func PurgeTickets() error {
+	req := kerbPurgeTicketCacheRequest{MessageType: kerbPurgeTicketCacheMessage}
+	response, err := callKerberosPackage(unsafe.Pointer(&req), unsafe.Sizeof(req))
+	if response != nil {
+		lsaFreeReturnBuffer.Call(uintptr(response))
+	}
+	return err
+}
+
+// RenewTGT has the LSA get a new TGT from the KDC, bypassing its cache, and returns when
+// the new one expires
+func RenewTGT() (time.Time, error) {
+	req := kerbRetrieveTicketRequest{
+		MessageType:  kerbRetrieveEncodedTicketMessage,
+		CacheOptions: kerbRetrieveTicketDontUseCache,
+	}
+	response, err := callKerberosPackage(unsafe.Pointer(&req), unsafe.Sizeof(req))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if response == nil {
+		return time.Time{}, fmt.Errorf("LSA returned no ticket")
+	}
+	defer lsaFreeReturnBuffer.Call(uintptr(response))
+
+	// Only the expiry is used; wipe the ticket and its session key before freeing them
+	ticket := (*kerbExternalTicket)(response)
+	if ticket.EncodedTicket != nil {
+		zeroBytes(unsafe.Slice(ticket.EncodedTicket, ticket.EncodedTicketSize))
+	}
+	if ticket.SessionKeyValue != nil {
+		zeroBytes(unsafe.Slice(ticket.SessionKeyValue, ticket.SessionKeyLength))
+	}
+	return fileTimeToTime(ticket.EndTime), nil
+}
+
+// queryTicketCache lists the Kerberos tickets of the current logon session, like "klist".
+// The LSA doesn't report when the user authenticated, so AuthTime is left zero.
+func queryTicketCache() ([]CredInfo, error) {
+	req := kerbQueryTicketCacheRequest{MessageType: kerbQueryTicketCacheExMessage}
+	response, err := callKerberosPackage(unsafe.Pointer(&req), unsafe.Sizeof(req))
+	if response != nil {
+		defer lsaFreeReturnBuffer.Call(uintptr(response))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return []CredInfo{}, nil
+	}
+
+	cache := (*kerbQueryTicketCacheExResponse)(response)
+	tickets := unsafe.Slice(&cache.Tickets[0], cache.CountOfTickets)
+	now := time.Now()
+	creds := make([]CredInfo, 0, len(tickets))
+	for _, ticket := range tickets {
+		end := fileTimeToTime(ticket.EndTime)
+		var lifetime uint32
+		if end.After(now) {
+			lifetime = uint32(end.Sub(now) / time.Second)
+		}
+		var renewTill int64
+		if ticket.RenewTime != 0 {
+			renewTill = fileTimeToTime(ticket.RenewTime).Unix()
+		}
+		creds = append(creds, CredInfo{
+			ClientPrincipal: ticket.ClientName.String() + "@" + ticket.ClientRealm.String(),
+			ServerPrincipal: ticket.ServerName.String() + "@" + ticket.ServerRealm.String(),
+			Lifetime:        lifetime,
+			StartTime:       fileTimeToTime(ticket.StartTime).Unix(),
+			EndTime:         end.Unix(),
+			RenewTill:       renewTill,
+			KeyType:         ticket.EncryptionType,
+		})
+	}
+	return creds, nil
+}
+
+// callKerberosPackage sends a request to the Kerberos package over an untrusted LSA
+// connection and returns the response buffer, which the caller frees
+func callKerberosPackage(req unsafe.Pointer, size uintptr) (unsafe.Pointer, error) {
+	var lsa windows.Handle
+	if status, _, _ := lsaConnectUntrusted.Call(uintptr(unsafe.Pointer(&lsa))); status != 0 {
+		return nil, fmt.Errorf("LsaConnectUntrusted: %w", windows.NTStatus(status))
+	}
+	defer lsaDeregisterLogonProcess.Call(uintptr(lsa))
+
+	name := []byte("Kerberos")
+	pkgName := lsaString{Length: uint16(len(name)), MaximumLength: uint16(len(name)), Buffer: &name[0]}
+	var pkg uint32
+	if status, _, _ := lsaLookupAuthenticationPackage.Call(uintptr(lsa), uintptr(unsafe.Pointer(&pkgName)), uintptr(unsafe.Pointer(&pkg))); status != 0 {
+		return nil, fmt.Errorf("LsaLookupAuthenticationPackage: %w", windows.NTStatus(status))
+	}
+
+	var response unsafe.Pointer
+	var responseSize uint32
+	var protocolStatus uint32
+	status, _, _ := lsaCallAuthenticationPackage.Call(
+		uintptr(lsa), uintptr(pkg), uintptr(req), size,
+		uintptr(unsafe.Pointer(&response)), uintptr(unsafe.Pointer(&responseSize)), uintptr(unsafe.Pointer(&protocolStatus)),
+	)
+	if status != 0 {
+		return response, fmt.Errorf("LsaCallAuthenticationPackage: %w", windows.NTStatus(status))
+	}
+	if protocolStatus != 0 {
+		// The Kerberos package reports its own NTSTATUS, e.g. STATUS_NO_LOGON_SERVERS
+		return response, fmt.Errorf("kerberos: %w", windows.NTStatus(protocolStatus))
+	}
+	return response, nil
+}
+
+// fileTimeToTime converts a LARGE_INTEGER in FILETIME units
+func fileTimeToTime(ft int64) time.Time {
+	filetime := syscall.Filetime{LowDateTime: uint32(ft), HighDateTime: uint32(ft >> 32)}
+	return time.Unix(0, filetime.Nanoseconds())
+}
@@ -0,0 +1,374 @@
+// This file mints tokens on behalf of another user with the Kerberos S4U extensions
+// (MS-SFU): S4U2Self gets the service account a ticket to itself for the user, and
+// S4U2Proxy trades that for a ticket to the backend. It is for checking constrained
+// delegation from a workstation, so it always uses gokrb5 and the service account's
+// ccache; SSPI only offers S4U to code running as the service.
+
+package krb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4757"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	// kdcOptionCnameInAddlTkt marks a TGS-REQ as S4U2Proxy (MS-SFU 2.2.3)
+	kdcOptionCnameInAddlTkt = 14
+
+	// paPACOptions is the PA-PAC-OPTIONS padata type (MS-KILE 2.2.10), which gokrb5 lacks
+	paPACOptions int32 = 167
+
+	// pacOptionRBCD asks the KDC to consider resource-based constrained delegation
+	pacOptionRBCD = 3
+
+	// s4uChecksumUsage is the key usage of the PA-FOR-USER checksum
+	s4uChecksumUsage = 17
+
+	// s4uChecksumType is KERB_CHECKSUM_HMAC_MD5, which PA-FOR-USER uses whatever the key
+	s4uChecksumType int32 = -138
+
+	// kdcTimeout bounds each connection to a KDC
+	kdcTimeout = 5 * time.Second
+)
+
+// paForUser is the PA-FOR-USER padata of an S4U2Self request (MS-SFU 2.2.1)
+type paForUser struct {
+	UserName    types.PrincipalName `asn1:"explicit,tag:0"`
+	UserRealm   string              `asn1:"generalstring,explicit,tag:1"`
+	Cksum       types.Checksum      `asn1:"explicit,tag:2"`
+	AuthPackage string              `asn1:"generalstring,explicit,tag:3"`
+}
+
+// pacOptions is the value of PA-PAC-OPTIONS
+type pacOptions struct {
+	Flags asn1.BitString `asn1:"explicit,tag:0"`
+}
+
+// DelegatedToken returns a SPNEGO token for spn ("HTTP/host" or "HTTP@host") on behalf of
+// user ("alice" or "alice@REALM"), as a service trusted for constrained delegation would
+// get one. The ccache (opts.CCache or KRB5CCNAME) must hold a TGT of that service account,
+// and the KDC must allow it to delegate to spn with protocol transition. The caller should
+// wipe the token once used.
+func DelegatedToken(user, spn string, opts Options) ([]byte, error) {
+	opts.Transport = TransportGokrb5
+	tr, err := Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Close()
+	t, ok := tr.(*Gokrb5Transport)
+	if !ok {
+		return nil, fmt.Errorf("delegated tokens need the gokrb5 transport")
+	}
+	return t.delegatedToken(user, spn)
+}
+
+// delegatedToken runs S4U2Self and S4U2Proxy with the ccache's TGT
+func (t *Gokrb5Transport) delegatedToken(user, spn string) ([]byte, error) {
+	service := strings.Replace(spn, "@", "/", 1)
+	if !strings.Contains(service, "/") {
+		return nil, newError(ErrBadSPN, "invalid SPN format: %s (expected service/hostname or service@hostname)", spn)
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, service)
+
+	realm := t.ccache.GetClientRealm()
+	userName, userRealm := types.ParseSPNString(user)
+	if userRealm == "" {
+		userRealm = realm
+	}
+	if !strings.EqualFold(userRealm, realm) {
+		return nil, fmt.Errorf("user %s is not in the service account's realm %s; cross-realm S4U is not supported", user, realm)
+	}
+
+	tgt, key, err := t.ccacheTGT(realm)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: S4U2Self for %s@%s as %s@%s\n", userName.PrincipalNameString(), userRealm,
+			t.ccache.GetClientPrincipalName().PrincipalNameString(), realm)
+	}
+	evidence, forwardable, err := t.s4u2Self(userName, userRealm, tgt, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: S4U2Proxy to %s (evidence ticket forwardable: %v)\n", service, forwardable)
+	}
+	ticket, sessionKey, err := t.s4u2Proxy(sname, evidence, tgt, key)
+	if err != nil {
+		if !forwardable {
+			return nil, fmt.Errorf("%w (the KDC issued a non-forwardable S4U2Self ticket: the service account may not be trusted for protocol transition, or %s may be sensitive and not delegatable)", err, user)
+		}
+		return nil, err
+	}
+
+	creds := credentials.NewFromPrincipalName(userName, userRealm)
+	init, err := spnego.NewNegTokenInitKRB5(&client.Client{Credentials: creds}, ticket, sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the SPNEGO token: %w", err)
+	}
+	token := spnego.SPNEGOToken{Init: true, NegTokenInit: init}
+	tokenBytes, err := token.Marshal()
+	zeroBytes(init.MechTokenBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SPNEGO token: %w", err)
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: Got delegated SPNEGO token of %d bytes\n", len(tokenBytes))
+	}
+	return tokenBytes, nil
+}
+
+// ccacheTGT returns the TGT for realm from the ccache and its session key
+func (t *Gokrb5Transport) ccacheTGT(realm string) (messages.Ticket, types.EncryptionKey, error) {
+	var tgt messages.Ticket
+	cred, ok := t.ccache.GetEntry(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm))
+	if !ok {
+		return tgt, types.EncryptionKey{}, &Error{Kind: ErrNoTGT, Msg: fmt.Sprintf("no TGT for %s in the ccache", realm)}
+	}
+	if time.Now().After(cred.EndTime) {
+		return tgt, types.EncryptionKey{}, &Error{Kind: ErrNoTGT, Msg: fmt.Sprintf("the TGT for %s in the ccache expired at %s", realm, cred.EndTime.Format(time.RFC3339))}
+	}
+	if err := tgt.Unmarshal(cred.Ticket); err != nil {
+		return tgt, types.EncryptionKey{}, fmt.Errorf("failed to read the TGT from the ccache: %w", err)
+	}
+	return tgt, cred.Key, nil
+}
+
+// s4u2Self asks for a ticket to the service account itself on behalf of user. It also
+// reports whether the ticket is forwardable, which S4U2Proxy needs unless the backend
+// allows the service with resource-based constrained delegation.
+func (t *Gokrb5Transport) s4u2Self(user types.PrincipalName, userRealm string, tgt messages.Ticket, key types.EncryptionKey) (messages.Ticket, bool, error) {
+	self := t.ccache.GetClientPrincipalName()
+	req, err := messages.NewTGSReq(self, tgt.Realm, t.client.Config, tgt, key, self, false)
+	if err != nil {
+		return messages.Ticket{}, false, fmt.Errorf("failed to build the S4U2Self request: %w", err)
+	}
+	forUser, err := forUserPAData(user, userRealm, key)
+	if err != nil {
+		return messages.Ticket{}, false, err
+	}
+	req.PAData = append(req.PAData, forUser)
+
+	rep, err := t.exchangeTGS(req, key, "S4U2Self")
+	if err != nil {
+		return messages.Ticket{}, false, err
+	}
+	if !strings.EqualFold(rep.CName.PrincipalNameString(), user.PrincipalNameString()) {
+		return messages.Ticket{}, false, fmt.Errorf("S4U2Self returned a ticket for %s instead of %s", rep.CName.PrincipalNameString(), user.PrincipalNameString())
+	}
+	return rep.Ticket, types.IsFlagSet(&rep.DecryptedEncPart.Flags, flags.Forwardable), nil
+}
+
+// s4u2Proxy trades the S4U2Self ticket for one to sname on behalf of the same user
+func (t *Gokrb5Transport) s4u2Proxy(sname types.PrincipalName, evidence, tgt messages.Ticket, key types.EncryptionKey) (messages.Ticket, types.EncryptionKey, error) {
+	self := t.ccache.GetClientPrincipalName()
+	req, err := messages.NewTGSReq(self, tgt.Realm, t.client.Config, tgt, key, sname, false)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("failed to build the S4U2Proxy request: %w", err)
+	}
+	types.SetFlag(&req.ReqBody.KDCOptions, kdcOptionCnameInAddlTkt)
+	req.ReqBody.AdditionalTickets = []messages.Ticket{evidence}
+	// The body changed, so its checksum in the authenticator has to be made again
+	if err := signTGSReq(&req, tgt, key); err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	opts := pacOptions{Flags: types.NewKrbFlags()}
+	types.SetFlag(&opts.Flags, pacOptionRBCD)
+	b, err := asn1.Marshal(opts)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("failed to encode PA-PAC-OPTIONS: %w", err)
+	}
+	req.PAData = append(req.PAData, types.PAData{PADataType: paPACOptions, PADataValue: b})
+
+	rep, err := t.exchangeTGS(req, key, "S4U2Proxy")
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	if len(rep.Ticket.SName.NameString) > 0 && rep.Ticket.SName.NameString[0] == "krbtgt" {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("the KDC referred S4U2Proxy for %s to %s; cross-realm S4U is not supported", sname.PrincipalNameString(), rep.Ticket.SName.PrincipalNameString())
+	}
+	return rep.Ticket, rep.DecryptedEncPart.Key, nil
+}
+
+// forUserPAData returns the PA-FOR-USER padata naming user, signed with the TGT session key
+func forUserPAData(user types.PrincipalName, userRealm string, key types.EncryptionKey) (types.PAData, error) {
+	const authPackage = "Kerberos"
+	data := binary.LittleEndian.AppendUint32(nil, uint32(user.NameType))
+	for _, s := range user.NameString {
+		data = append(data, s...)
+	}
+	data = append(data, userRealm...)
+	data = append(data, authPackage...)
+	cksum, err := rfc4757.Checksum(key.KeyValue, s4uChecksumUsage, data)
+	if err != nil {
+		return types.PAData{}, fmt.Errorf("failed to sign PA-FOR-USER: %w", err)
+	}
+
+	b, err := asn1.Marshal(paForUser{
+		UserName:    user,
+		UserRealm:   userRealm,
+		Cksum:       types.Checksum{CksumType: s4uChecksumType, Checksum: cksum},
+		AuthPackage: authPackage,
+	})
+	if err != nil {
+		return types.PAData{}, fmt.Errorf("failed to encode PA-FOR-USER: %w", err)
+	}
+	return types.PAData{PADataType: patype.PA_FOR_USER, PADataValue: b}, nil
+}
+
+// signTGSReq replaces the PA-TGS-REQ padata of req with an authenticator over its current
+// body, as messages.NewTGSReq makes it
+func signTGSReq(req *messages.TGSReq, tgt messages.Ticket, key types.EncryptionKey) error {
+	b, err := req.ReqBody.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode the TGS-REQ body: %w", err)
+	}
+	etype, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return err
+	}
+	cb, err := etype.GetChecksumHash(key.KeyValue, b, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR_CHKSUM)
+	if err != nil {
+		return fmt.Errorf("failed to checksum the TGS-REQ body: %w", err)
+	}
+	auth, err := types.NewAuthenticator(tgt.Realm, req.ReqBody.CName)
+	if err != nil {
+		return err
+	}
+	auth.Cksum = types.Checksum{CksumType: etype.GetHashID(), Checksum: cb}
+	apReq, err := messages.NewAPReq(tgt, key, auth)
+	if err != nil {
+		return err
+	}
+	apb, err := apReq.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode the TGS-REQ authenticator: %w", err)
+	}
+	req.PAData = types.PADataSequence{{PADataType: patype.PA_TGS_REQ, PADataValue: apb}}
+	return nil
+}
+
+// exchangeTGS sends req to a KDC of its realm and returns the decrypted reply. The checks of
+// gokrb5's own exchange expect the reply's client to be the requester, which S4U replies
+// aren't, so only the nonce is checked.
+func (t *Gokrb5Transport) exchangeTGS(req messages.TGSReq, key types.EncryptionKey, step string) (messages.TGSRep, error) {
+	var rep messages.TGSRep
+	b, err := req.Marshal()
+	if err != nil {
+		return rep, fmt.Errorf("failed to encode the %s request: %w", step, err)
+	}
+	rb, err := t.sendToKDC(req.ReqBody.Realm, b)
+	if err != nil {
+		return rep, s4uError(step, err)
+	}
+	if err := rep.Unmarshal(rb); err != nil {
+		return rep, fmt.Errorf("failed to read the %s reply: %w", step, err)
+	}
+	if err := rep.DecryptEncPart(key); err != nil {
+		return rep, fmt.Errorf("failed to decrypt the %s reply: %w", step, err)
+	}
+	if rep.DecryptedEncPart.Nonce != req.ReqBody.Nonce {
+		return rep, fmt.Errorf("the %s reply doesn't match the request (nonce)", step)
+	}
+	return rep, nil
+}
+
+// sendToKDC sends b to the realm's KDCs over TCP in turn and returns the first answer. A
+// KRB-ERROR answer is returned as a messages.KRBError.
+func (t *Gokrb5Transport) sendToKDC(realm string, b []byte) ([]byte, error) {
+	_, kdcs, err := t.client.Config.GetKDCs(realm, true)
+	if err != nil {
+		return nil, &Error{Kind: ErrKDCUnreachable, Msg: fmt.Sprintf("no KDC for %s", realm), Err: err}
+	}
+	var errs []string
+	for i := 1; i <= len(kdcs); i++ {
+		rb, err := sendTCP(kdcs[i], b)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		var krbErr messages.KRBError
+		if krbErr.Unmarshal(rb) == nil {
+			return nil, krbErr
+		}
+		return rb, nil
+	}
+	return nil, &Error{Kind: ErrKDCUnreachable, Msg: "error sending to KDC: " + strings.Join(errs, "; ")}
+}
+
+// sendTCP sends a Kerberos message to addr with the 4-byte length prefix of RFC 4120 7.2.2
+func sendTCP(addr string, b []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", addr, kdcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(kdcTimeout))
+
+	msg := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(b)), uint32(len(b)))
+	if _, err := conn.Write(append(msg, b...)); err != nil {
+		return nil, fmt.Errorf("%s: %w", addr, err)
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, fmt.Errorf("%s: %w", addr, err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > 1<<20 {
+		return nil, fmt.Errorf("%s: bad reply length %d", addr, n)
+	}
+	rb := make([]byte, n)
+	if _, err := io.ReadFull(conn, rb); err != nil {
+		return nil, fmt.Errorf("%s: %w", addr, err)
+	}
+	return rb, nil
+}
+
+// s4uError explains a failed S4U step, with the kind of the KDC's error where there is one
+func s4uError(step string, err error) error {
+	krbErr, ok := err.(messages.KRBError)
+	if !ok {
+		return fmt.Errorf("%s failed: %w", step, err)
+	}
+	msg := fmt.Sprintf("%s refused by the KDC", step)
+	switch krbErr.ErrorCode {
+	case errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN:
+		return &Error{Kind: ErrBadSPN, Msg: msg, Err: krbErr}
+	case errorcode.KRB_AP_ERR_SKEW:
+		return &Error{Kind: ErrClockSkew, Msg: msg, Err: krbErr}
+	case errorcode.KRB_AP_ERR_TKT_EXPIRED:
+		return &Error{Kind: ErrNoTGT, Msg: msg, Err: krbErr}
+	case errorcode.KDC_ERR_BADOPTION, errorcode.KDC_ERR_POLICY:
+		if step == "S4U2Proxy" {
+			msg += " (the service account isn't allowed to delegate to this SPN: check msDS-AllowedToDelegateTo, or msDS-AllowedToActOnBehalfOfOtherIdentity on the backend)"
+		} else {
+			msg += " (the service account may not be allowed to use S4U2Self)"
+		}
+	case errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN:
+		msg += " (unknown user)"
+	}
+	return fmt.Errorf("%s: %w", msg, krbErr)
+}
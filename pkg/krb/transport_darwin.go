@@ -1,10 +1,11 @@
 //go:build darwin
 // +build darwin
 
-// Package main provides XPC transport for GSSCred on macOS 11+.
-// This file contains the cgo bindings for communicating with the GSSCred service
+// This file provides XPC transport for GSSCred on macOS 11+.
+// It contains the cgo bindings for communicating with the GSSCred service
 // via XPC (com.apple.GSSCred) which replaced KCM on macOS Big Sur and later.
-package main
+
+package krb
 
 /*
 #cgo CFLAGS: -x objective-c
@@ -308,16 +309,153 @@ static void gss_free_credentials(gss_cred_info_t *creds, int count) {
     free(creds);
 }
 
-// Get the default principal name using GSS API
-static char* gss_get_default_principal(void) {
-    OM_uint32 major, minor;
+// A credential cache as gss_list_caches reports it
+typedef struct {
+    char *uuid;
+    char *principal;
+    uint32_t lifetime;      // remaining lifetime of its TGT in seconds
+} gss_cache_info_t;
+
+// List the Kerberos caches by UUID with their principals, like klist -l
+static int gss_list_caches(gss_cache_info_t **out_caches, int *out_count) {
+    *out_caches = NULL;
+    *out_count = 0;
+
+    gss_cache_info_t *caches = calloc(MAX_CREDS, sizeof(gss_cache_info_t));
+    if (caches == NULL) {
+        return -1;
+    }
+    __block int count = 0;
+
+    OM_uint32 minor;
+    gss_iter_creds(&minor, 0, GSS_KRB5_MECHANISM, ^(gss_OID mech, gss_cred_id_t cred) {
+        if (cred == GSS_C_NO_CREDENTIAL || count >= MAX_CREDS) {
+            return;
+        }
+
+        CFUUIDRef uuid = GSSCredentialCopyUUID(cred);
+        if (uuid == NULL) {
+            return;
+        }
+        CFStringRef uuid_str = CFUUIDCreateString(NULL, uuid);
+        CFRelease(uuid);
+        char buf[64];
+        Boolean ok = uuid_str != NULL && CFStringGetCString(uuid_str, buf, sizeof(buf), kCFStringEncodingUTF8);
+        if (uuid_str != NULL) {
+            CFRelease(uuid_str);
+        }
+        if (!ok) {
+            return;
+        }
+
+        gss_cache_info_t *info = &caches[count];
+        info->uuid = strdup(buf);
+
+        OM_uint32 min;
+        gss_name_t cred_name = GSS_C_NO_NAME;
+        OM_uint32 lifetime = 0;
+        if (gss_inquire_cred(&min, cred, &cred_name, &lifetime, NULL, NULL) == GSS_S_COMPLETE) {
+            info->principal = gss_name_to_string(cred_name);
+            info->lifetime = lifetime;
+            if (cred_name != GSS_C_NO_NAME) {
+                gss_release_name(&min, &cred_name);
+            }
+        } else {
+            info->principal = strdup("(unknown)");
+        }
+
+        if (gsscred_debug) {
+            fprintf(stderr, "DEBUG: Cache %s: principal=%s, lifetime=%u\n", info->uuid, info->principal, info->lifetime);
+        }
+        count++;
+    });
+
+    if (count == 0) {
+        free(caches);
+        return 0;
+    }
+    *out_caches = caches;
+    *out_count = count;
+    return 0;
+}
+
+// Free cache info array
+static void gss_free_caches(gss_cache_info_t *caches, int count) {
+    if (caches == NULL) {
+        return;
+    }
+    for (int i = 0; i < count; i++) {
+        free(caches[i].uuid);
+        free(caches[i].principal);
+    }
+    free(caches);
+}
+
+// The credential of the cache with the given UUID, or GSS_C_NO_CREDENTIAL; release it
+// with gss_release_cred
+static gss_cred_id_t gss_cache_cred(const char *cache_uuid) {
+    gss_cred_id_t cred = GSS_C_NO_CREDENTIAL;
+    CFStringRef uuid_str = CFStringCreateWithCString(NULL, cache_uuid, kCFStringEncodingUTF8);
+    CFUUIDRef uuid = uuid_str != NULL ? CFUUIDCreateFromString(NULL, uuid_str) : NULL;
+    if (uuid_str != NULL) {
+        CFRelease(uuid_str);
+    }
+    if (uuid != NULL) {
+        cred = GSSCreateCredentialFromUUID(uuid);
+        CFRelease(uuid);
+    }
+    return cred;
+}
+
+// Destroy the cache with the given UUID, or the default cache if cache_uuid is empty, like
+// kdestroy. The credential goes with its cache: the GSS API has GSSCred (KCM before macOS 11)
+// delete it over XPC. Returns -3 if there is no such cache.
+static int gss_destroy_cache(const char *cache_uuid) {
+    OM_uint32 major, minor = 0;
+    gss_cred_id_t cred = GSS_C_NO_CREDENTIAL;
+
+    if (cache_uuid != NULL && cache_uuid[0] != '\0') {
+        cred = gss_cache_cred(cache_uuid);
+    } else {
+        major = gss_acquire_cred(&minor, GSS_C_NO_NAME, GSS_C_INDEFINITE,
+                                 GSS_C_NO_OID_SET, GSS_C_INITIATE, &cred, NULL, NULL);
+        if (major != GSS_S_COMPLETE) {
+            cred = GSS_C_NO_CREDENTIAL;
+        }
+    }
+    if (cred == GSS_C_NO_CREDENTIAL) {
+        return -3;
+    }
+
+    major = gss_destroy_cred(&minor, &cred);
+    if (major != GSS_S_COMPLETE) {
+        if (gsscred_debug) {
+            fprintf(stderr, "DEBUG: gss_destroy_cred failed: major=%u, minor=%u\n", major, minor);
+        }
+        if (cred != GSS_C_NO_CREDENTIAL) {
+            gss_release_cred(&minor, &cred);
+        }
+        return -1;
+    }
+    return 0;
+}
+
+// Get the default principal name using GSS API, or that of the cache with the given UUID
+// if cache_uuid isn't empty
+static char* gss_get_default_principal(const char *cache_uuid) {
+    OM_uint32 major, minor = 0;
     gss_cred_id_t cred = GSS_C_NO_CREDENTIAL;
     gss_name_t name = GSS_C_NO_NAME;
     char *result = NULL;
 
     // Acquire default credential
-    major = gss_acquire_cred(&minor, GSS_C_NO_NAME, GSS_C_INDEFINITE,
-                             GSS_C_NO_OID_SET, GSS_C_INITIATE, &cred, NULL, NULL);
+    if (cache_uuid != NULL && cache_uuid[0] != '\0') {
+        cred = gss_cache_cred(cache_uuid);
+        major = cred != GSS_C_NO_CREDENTIAL ? GSS_S_COMPLETE : GSS_S_NO_CRED;
+    } else {
+        major = gss_acquire_cred(&minor, GSS_C_NO_NAME, GSS_C_INDEFINITE,
+                                 GSS_C_NO_OID_SET, GSS_C_INITIATE, &cred, NULL, NULL);
+    }
     if (major != GSS_S_COMPLETE) {
         if (gsscred_debug) {
             fprintf(stderr, "DEBUG: gss_acquire_cred failed: major=%u, minor=%u\n", major, minor);
@@ -344,7 +482,20 @@ static char* gss_get_default_principal(void) {
 // Get a service ticket for the specified SPN using gss_init_sec_context
 // This is the proper way to get service tickets on macOS
 // Returns the SPNEGO/Kerberos token that can be used for authentication
-static unsigned char* gss_get_service_ticket(const char *spn, int *out_len, int *out_err) {
+// Zero memory that held a token; the volatile writes can't be optimized away before free
+static void secure_zero(void *p, size_t n) {
+    volatile unsigned char *v = (volatile unsigned char *)p;
+    while (n--) {
+        *v++ = 0;
+    }
+}
+
+// Credential imported with gss_import_cred; tickets are requested with it while it is valid
+static gss_cred_id_t imported_cred = GSS_C_NO_CREDENTIAL;
+
+// cache_uuid, if not empty, names the GSSCred cache (its UUID, as klist -l lists it) whose
+// credential is used rather than the default one
+static unsigned char* gss_get_service_ticket(const char *spn, const char *cache_uuid, int *out_len, int *out_err) {
     *out_len = 0;
     *out_err = 0;
 
@@ -364,8 +515,42 @@ static unsigned char* gss_get_service_ticket(const char *spn, int *out_len, int
     // Create a mechanism set containing only Kerberos
     gss_OID_set_desc krb5_mech_set = { 1, GSS_KRB5_MECHANISM };
 
-    major = gss_acquire_cred(&minor, GSS_C_NO_NAME, GSS_C_INDEFINITE,
-                             &krb5_mech_set, GSS_C_INITIATE, &initiator_cred, NULL, NULL);
+    // A cache chosen by UUID is used instead of both the default and the imported credential
+    int use_cache = 0;
+    if (cache_uuid != NULL && cache_uuid[0] != '\0') {
+        initiator_cred = gss_cache_cred(cache_uuid);
+        if (initiator_cred == GSS_C_NO_CREDENTIAL) {
+            if (gsscred_debug) {
+                fprintf(stderr, "DEBUG: No credential in cache %s\n", cache_uuid);
+            }
+            *out_err = -3;
+            return NULL;
+        }
+        use_cache = 1;
+        if (gsscred_debug) {
+            fprintf(stderr, "DEBUG: Using the credential of cache %s\n", cache_uuid);
+        }
+    }
+
+    // An imported credential that is still valid is used instead; it isn't released here
+    int use_imported = 0;
+    if (!use_cache && imported_cred != GSS_C_NO_CREDENTIAL) {
+        OM_uint32 imported_lifetime = 0;
+        major = gss_inquire_cred(&minor, imported_cred, NULL, &imported_lifetime, NULL, NULL);
+        if (major == GSS_S_COMPLETE && imported_lifetime > 0) {
+            initiator_cred = imported_cred;
+            use_imported = 1;
+            if (gsscred_debug) {
+                fprintf(stderr, "DEBUG: Using the imported credential (lifetime: %u seconds)\n", imported_lifetime);
+            }
+        }
+    }
+
+    major = GSS_S_COMPLETE;
+    if (!use_imported && !use_cache) {
+        major = gss_acquire_cred(&minor, GSS_C_NO_NAME, GSS_C_INDEFINITE,
+                                 &krb5_mech_set, GSS_C_INITIATE, &initiator_cred, NULL, NULL);
+    }
     if (major != GSS_S_COMPLETE) {
         if (gsscred_debug) {
             fprintf(stderr, "DEBUG: gss_acquire_cred failed: major=%u (0x%x), minor=%u (0x%x)\n",
@@ -445,7 +630,9 @@ static unsigned char* gss_get_service_ticket(const char *spn, int *out_len, int
         if (gsscred_debug) {
             fprintf(stderr, "DEBUG: gss_import_name failed: major=%u, minor=%u\n", major, minor);
         }
-        gss_release_cred(&minor, &initiator_cred);
+        if (!use_imported) {
+            gss_release_cred(&minor, &initiator_cred);
+        }
         *out_err = -2;
         return NULL;
     }
@@ -514,7 +701,9 @@ static unsigned char* gss_get_service_ticket(const char *spn, int *out_len, int
     }
 
     gss_release_name(&minor, &target_name);
-    gss_release_cred(&minor, &initiator_cred);
+    if (!use_imported) {
+        gss_release_cred(&minor, &initiator_cred);
+    }
 
     if (major != GSS_S_COMPLETE && major != GSS_S_CONTINUE_NEEDED) {
         if (gsscred_debug) {
@@ -564,6 +753,7 @@ static unsigned char* gss_get_service_ticket(const char *spn, int *out_len, int
         } else {
             *out_err = -4;
         }
+        secure_zero(output_token.value, output_token.length);
     }
 
     gss_release_buffer(&minor, &output_token);
@@ -640,26 +830,95 @@ static unsigned char* gss_export_default_cred(int *out_len, int *out_err) {
     return result;
 }
 
+// Import a credential exported by gss_export_cred, replacing any imported before.
+// Returns 0 with its principal (to free) and remaining lifetime, or an error code.
+static int gss_import_saved_cred(const void *data, size_t len, char **out_name, unsigned int *out_lifetime) {
+    *out_name = NULL;
+    *out_lifetime = 0;
+
+    OM_uint32 major, minor;
+    gss_buffer_desc token = { len, (void*)data };
+    gss_cred_id_t cred = GSS_C_NO_CREDENTIAL;
+
+    major = gss_import_cred(&minor, &token, &cred);
+    if (major != GSS_S_COMPLETE) {
+        if (gsscred_debug) {
+            fprintf(stderr, "DEBUG: gss_import_cred failed: major=%u, minor=%u\n", major, minor);
+        }
+        return -1;
+    }
+
+    gss_name_t name = GSS_C_NO_NAME;
+    OM_uint32 lifetime = 0;
+    major = gss_inquire_cred(&minor, cred, &name, &lifetime, NULL, NULL);
+    if (major != GSS_S_COMPLETE || lifetime == 0) {
+        if (gsscred_debug) {
+            fprintf(stderr, "DEBUG: Imported credential is expired: major=%u, minor=%u\n", major, minor);
+        }
+        if (name != GSS_C_NO_NAME) {
+            gss_release_name(&minor, &name);
+        }
+        gss_release_cred(&minor, &cred);
+        return -2;
+    }
+    if (name != GSS_C_NO_NAME) {
+        *out_name = gss_name_to_string(name);
+        gss_release_name(&minor, &name);
+    }
+
+    if (imported_cred != GSS_C_NO_CREDENTIAL) {
+        gss_release_cred(&minor, &imported_cred);
+    }
+    imported_cred = cred;
+    *out_lifetime = lifetime;
+    return 0;
+}
+
+// Go back to acquiring the default credential for each ticket
+static void gss_forget_imported_cred(void) {
+    OM_uint32 minor;
+    if (imported_cred != GSS_C_NO_CREDENTIAL) {
+        gss_release_cred(&minor, &imported_cred);
+        imported_cred = GSS_C_NO_CREDENTIAL;
+    }
+}
+
 */
 import "C"
 
 import (
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
-// GSSCredTransport provides XPC communication with com.apple.GSSCred
-type GSSCredTransport struct {
-	debug bool
+// importedCredMutex keeps the imported credential from being replaced or released while a
+// ticket is requested with it
+var importedCredMutex sync.RWMutex
+
+// gssTransport provides XPC communication with com.apple.GSSCred
+type gssTransport struct {
+	debug     bool
+	legacy    bool   // Before macOS 11 there is no GSSCred; the GSS API talks to KCM itself
+	cacheUUID string // Cache tickets are requested from, the default credential's when empty
 }
 
-// NewGSSCredTransport creates a new GSSCred XPC transport
-func NewGSSCredTransport() *GSSCredTransport {
-	return &GSSCredTransport{}
+func init() {
+	RegisterTransport(TransportNative, newGSSTransport)
+}
+
+// newGSSTransport creates a new GSSCred XPC transport
+func newGSSTransport(opts Options) Transport {
+	t := &gssTransport{legacy: IsLegacyMacOS()}
+	t.SetDebug(opts.Debug)
+	t.SetCCachePath(opts.CCache)
+	return t
 }
 
 // SetDebug enables or disables debug output
-func (t *GSSCredTransport) SetDebug(debug bool) {
+func (t *gssTransport) SetDebug(debug bool) {
 	t.debug = debug
 	if debug {
 		C.gsscred_set_debug(1)
@@ -668,9 +927,18 @@ func (t *GSSCredTransport) SetDebug(debug bool) {
 	}
 }
 
-// SetCCachePath is a no-op on macOS (GSS API manages caches)
-func (t *GSSCredTransport) SetCCachePath(path string) {
-	// macOS GSS API uses system credential cache, path is ignored
+// SetCCachePath selects the GSSCred cache tickets are requested with, by UUID ("API:" prefix
+// optional, as klist -l shows it). Anything else, like a file ccache path meant for gokrb5,
+// leaves the default credential in use.
+func (t *gssTransport) SetCCachePath(path string) {
+	t.cacheUUID = ""
+	if !IsCacheUUID(path) {
+		if path != "" && t.debug {
+			fmt.Printf("DEBUG: Ignoring ccache %s, which isn't a GSSCred cache UUID\n", path)
+		}
+		return
+	}
+	t.cacheUUID = strings.TrimPrefix(path, "API:")
 }
 
 // IsMacOS11OrLater returns true if running on macOS 11 (Big Sur) or later
@@ -678,6 +946,12 @@ func IsMacOS11OrLater() bool {
 	return C.is_macos_11_or_later() != 0
 }
 
+// IsLegacyMacOS returns true before macOS 11, where credentials live in KCM rather than
+// GSSCred. Tickets still come from the GSS API, Heimdal's on these versions.
+func IsLegacyMacOS() bool {
+	return !IsMacOS11OrLater()
+}
+
 // IsWindows returns false on macOS
 func IsWindows() bool {
 	return false
@@ -689,7 +963,10 @@ func IsLinux() bool {
 }
 
 // Connect establishes connection to GSSCred service
-func (t *GSSCredTransport) Connect() error {
+func (t *gssTransport) Connect() error {
+	if t.legacy {
+		return nil
+	}
 	result := C.gsscred_connect()
 	if result != 0 {
 		return fmt.Errorf("failed to connect to GSSCred service")
@@ -698,13 +975,16 @@ func (t *GSSCredTransport) Connect() error {
 }
 
 // Close closes the connection to GSSCred
-func (t *GSSCredTransport) Close() error {
+func (t *gssTransport) Close() error {
 	C.gsscred_close()
 	return nil
 }
 
 // GetDefaultCache returns the default cache name/UUID
-func (t *GSSCredTransport) GetDefaultCache() (string, error) {
+func (t *gssTransport) GetDefaultCache() (string, error) {
+	if t.legacy {
+		return legacyDefaultCache()
+	}
 	cstr := C.gsscred_get_default_cache()
 	if cstr == nil {
 		return "", fmt.Errorf("failed to get default cache from GSSCred")
@@ -713,21 +993,12 @@ func (t *GSSCredTransport) GetDefaultCache() (string, error) {
 	return C.GoString(cstr), nil
 }
 
-// GSSCredInfo holds credential information from GSS API
-type GSSCredInfo struct {
-	ClientPrincipal string
-	ServerPrincipal string
-	Lifetime        uint32
-	AuthTime        int64
-	StartTime       int64
-	EndTime         int64
-	RenewTill       int64
-	KeyType         int32
-}
-
-// GetDefaultPrincipal returns the default principal using GSS API
-func (t *GSSCredTransport) GetDefaultPrincipal() (string, error) {
-	cstr := C.gss_get_default_principal()
+// GetDefaultPrincipal returns the principal of the selected cache, or the default one, using
+// the GSS API
+func (t *gssTransport) GetDefaultPrincipal() (string, error) {
+	cuuid := C.CString(t.cacheUUID)
+	defer C.free(unsafe.Pointer(cuuid))
+	cstr := C.gss_get_default_principal(cuuid)
 	if cstr == nil {
 		return "", fmt.Errorf("no default credential available")
 	}
@@ -736,7 +1007,7 @@ func (t *GSSCredTransport) GetDefaultPrincipal() (string, error) {
 }
 
 // GetCredentials returns all credentials using GSS API
-func (t *GSSCredTransport) GetCredentials() ([]GSSCredInfo, error) {
+func (t *gssTransport) GetCredentials() ([]CredInfo, error) {
 	var cCreds *C.gss_cred_info_t
 	var count C.int
 
@@ -746,16 +1017,16 @@ func (t *GSSCredTransport) GetCredentials() ([]GSSCredInfo, error) {
 	}
 
 	if count == 0 || cCreds == nil {
-		return []GSSCredInfo{}, nil
+		return []CredInfo{}, nil
 	}
 	defer C.gss_free_credentials(cCreds, count)
 
 	// Convert C array to Go slice
-	creds := make([]GSSCredInfo, int(count))
+	creds := make([]CredInfo, int(count))
 	credArray := (*[1 << 20]C.gss_cred_info_t)(unsafe.Pointer(cCreds))[:count:count]
 
 	for i := 0; i < int(count); i++ {
-		creds[i] = GSSCredInfo{
+		creds[i] = CredInfo{
 			ClientPrincipal: C.GoString(credArray[i].client_principal),
 			ServerPrincipal: C.GoString(credArray[i].server_principal),
 			Lifetime:        uint32(credArray[i].lifetime),
@@ -770,9 +1041,67 @@ func (t *GSSCredTransport) GetCredentials() ([]GSSCredInfo, error) {
 	return creds, nil
 }
 
+// ListCaches lists the Kerberos caches in GSSCred (KCM before macOS 11) by UUID, like
+// klist -l. The current one is the cache selected with Options.CCache, else the default.
+func (t *gssTransport) ListCaches() ([]CacheInfo, error) {
+	current := t.cacheUUID
+	if current == "" {
+		name, err := t.GetDefaultCache()
+		if err != nil && t.debug {
+			fmt.Printf("DEBUG: No default cache: %v\n", err)
+		}
+		current = strings.TrimPrefix(name, "API:")
+	}
+
+	var cCaches *C.gss_cache_info_t
+	var count C.int
+	if C.gss_list_caches(&cCaches, &count) != 0 {
+		return nil, fmt.Errorf("failed to list credential caches")
+	}
+	if count == 0 || cCaches == nil {
+		return []CacheInfo{}, nil
+	}
+	defer C.gss_free_caches(cCaches, count)
+
+	now := time.Now()
+	cacheArray := (*[1 << 20]C.gss_cache_info_t)(unsafe.Pointer(cCaches))[:count:count]
+	caches := make([]CacheInfo, int(count))
+	for i, c := range cacheArray {
+		caches[i] = CacheInfo{
+			Name:      C.GoString(c.uuid),
+			Principal: C.GoString(c.principal),
+		}
+		caches[i].Current = strings.EqualFold(caches[i].Name, current)
+		if c.lifetime > 0 {
+			caches[i].TGTExpiry = now.Add(time.Duration(c.lifetime) * time.Second)
+		}
+	}
+	return caches, nil
+}
+
+// DestroyCache destroys the cache selected with Options.CCache, else the default one, and
+// forgets the credential imported from the last run, which would hold the same TGT
+func (t *gssTransport) DestroyCache() error {
+	ForgetImportedCredential()
+
+	cuuid := C.CString(t.cacheUUID)
+	defer C.free(unsafe.Pointer(cuuid))
+	switch C.gss_destroy_cache(cuuid) {
+	case 0:
+	case -3:
+		// Nothing to destroy, as kdestroy after kdestroy
+		if t.debug {
+			fmt.Println("DEBUG: No credential cache to destroy")
+		}
+	default:
+		return fmt.Errorf("failed to destroy the credential cache")
+	}
+	return nil
+}
+
 // ExportCredential exports the default credential using gss_export_cred
 // This returns a serialized credential that may contain ticket and session key data
-func (t *GSSCredTransport) ExportCredential() ([]byte, error) {
+func (t *gssTransport) ExportCredential() ([]byte, error) {
 	var dataLen C.int
 	var errCode C.int
 
@@ -785,21 +1114,75 @@ func (t *GSSCredTransport) ExportCredential() ([]byte, error) {
 	return C.GoBytes(unsafe.Pointer(data), dataLen), nil
 }
 
+// ImportCredential has service tickets requested with a credential ExportCredential returned,
+// e.g. before the app was restarted, instead of the default one, for as long as it is valid.
+// It returns the credential's principal and when it expires.
+func ImportCredential(data []byte) (string, time.Time, error) {
+	if len(data) == 0 {
+		return "", time.Time{}, fmt.Errorf("no credential to import")
+	}
+	cdata := C.CBytes(data)
+	defer func() {
+		C.secure_zero(cdata, C.size_t(len(data)))
+		C.free(cdata)
+	}()
+
+	importedCredMutex.Lock()
+	defer importedCredMutex.Unlock()
+	var cname *C.char
+	var lifetime C.uint
+	switch C.gss_import_saved_cred(cdata, C.size_t(len(data)), &cname, &lifetime) {
+	case 0:
+	case -2:
+		return "", time.Time{}, newError(ErrNoTGT, "imported credential has expired")
+	default:
+		return "", time.Time{}, fmt.Errorf("failed to import credential")
+	}
+	var principal string
+	if cname != nil {
+		principal = C.GoString(cname)
+		C.free(unsafe.Pointer(cname))
+	}
+	return principal, time.Now().Add(time.Duration(lifetime) * time.Second), nil
+}
+
+// ForgetImportedCredential has service tickets requested with the default credential again
+func ForgetImportedCredential() {
+	importedCredMutex.Lock()
+	defer importedCredMutex.Unlock()
+	C.gss_forget_imported_cred()
+}
+
 // GetServiceTicket obtains a service ticket for the specified SPN using gss_init_sec_context
 // The SPN should be in the format "service@hostname" or "service/hostname"
 // Returns the SPNEGO/Kerberos token that can be used for authentication
-func (t *GSSCredTransport) GetServiceTicket(spn string) ([]byte, error) {
+func (t *gssTransport) GetServiceTicket(spn string) ([]byte, error) {
 	cspn := C.CString(spn)
 	defer C.free(unsafe.Pointer(cspn))
+	cuuid := C.CString(t.cacheUUID)
+	defer C.free(unsafe.Pointer(cuuid))
 
 	var dataLen C.int
 	var errCode C.int
 
-	data := C.gss_get_service_ticket(cspn, &dataLen, &errCode)
+	importedCredMutex.RLock()
+	data := C.gss_get_service_ticket(cspn, cuuid, &dataLen, &errCode)
+	importedCredMutex.RUnlock()
 	if data == nil {
+		switch errCode {
+		case -1:
+			return nil, newError(ErrNoTGT, "failed to get service ticket: no credentials available (error %d)", errCode)
+		case -2:
+			return nil, newError(ErrBadSPN, "failed to get service ticket: invalid SPN %s (error %d)", spn, errCode)
+		case -3:
+			return nil, newError(ErrNoTGT, "failed to get service ticket: no credentials in cache %s (error %d)", t.cacheUUID, errCode)
+		}
 		return nil, fmt.Errorf("failed to get service ticket: error %d", errCode)
 	}
-	defer C.free(unsafe.Pointer(data))
+	defer func() {
+		C.secure_zero(unsafe.Pointer(data), C.size_t(dataLen))
+		C.free(unsafe.Pointer(data))
+	}()
 
 	return C.GoBytes(unsafe.Pointer(data), dataLen), nil
 }
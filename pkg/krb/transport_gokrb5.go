@@ -0,0 +1,353 @@
+// This file provides the gokrb5 transport: pure Go, reading a file ccache and krb5.conf.
+// It is the native transport on Linux and can be selected on macOS and Windows for users
+// whose tickets live in a ccache file rather than the platform's store.
+
+package krb
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// Gokrb5Transport provides gokrb5-based authentication
+type Gokrb5Transport struct {
+	debug      bool
+	client     *client.Client
+	ccache     *credentials.CCache
+	ccachePath string
+}
+
+// newGokrb5Transport returns a gokrb5 transport for opts.CCache (or KRB5CCNAME)
+func newGokrb5Transport(opts Options) Transport {
+	t := &Gokrb5Transport{debug: opts.Debug}
+	t.ccachePath = opts.CCache
+	if t.ccachePath == "" {
+		t.ccachePath = os.Getenv("KRB5CCNAME")
+	}
+	return t
+}
+
+// SetDebug enables or disables debug output
+func (t *Gokrb5Transport) SetDebug(debug bool) {
+	t.debug = debug
+}
+
+// SetCCachePath sets the credential cache path to use
+func (t *Gokrb5Transport) SetCCachePath(path string) {
+	t.ccachePath = path
+}
+
+// Connect loads credentials from the ccache and creates a gokrb5 client
+func (t *Gokrb5Transport) Connect() error {
+	ccachePath := ccacheFilePath(t.ccachePath)
+
+	if t.debug {
+		fmt.Printf("DEBUG: Loading credentials from ccache: %s\n", ccachePath)
+	}
+
+	// Load the credential cache
+	ccache, err := credentials.LoadCCache(ccachePath)
+	if err != nil {
+		return &Error{Kind: ErrNoTGT, Msg: fmt.Sprintf("failed to load ccache from %s", ccachePath), Err: err}
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: Loaded ccache for principal: %s@%s\n",
+			ccache.DefaultPrincipal.PrincipalName.PrincipalNameString(),
+			ccache.DefaultPrincipal.Realm)
+	}
+
+	krb5ConfPath := krb5ConfFilePath()
+
+	if t.debug {
+		fmt.Printf("DEBUG: Loading krb5.conf from: %s\n", krb5ConfPath)
+	}
+
+	cfg, err := config.Load(krb5ConfPath)
+	if err != nil {
+		return fmt.Errorf("failed to load krb5.conf from %s: %w", krb5ConfPath, err)
+	}
+
+	// Create client from ccache
+	cl, err := client.NewFromCCache(ccache, cfg, client.DisablePAFXFAST(true))
+	if err != nil {
+		return fmt.Errorf("failed to create client from ccache: %w", err)
+	}
+	t.client = cl
+	t.ccache = ccache
+
+	if t.debug {
+		fmt.Println("DEBUG: Created gokrb5 client from ccache")
+	}
+
+	return nil
+}
+
+// Client returns the gokrb5 client, or nil before Connect. Callers that need more than
+// an AP-REQ token (SSH's gssapi-with-mic, for one) build on it directly.
+func (t *Gokrb5Transport) Client() *client.Client {
+	return t.client
+}
+
+// Close releases the client resources
+func (t *Gokrb5Transport) Close() error {
+	if t.client != nil {
+		t.client.Destroy()
+		t.client = nil
+	}
+	return nil
+}
+
+// GetDefaultCache returns the ccache path
+func (t *Gokrb5Transport) GetDefaultCache() (string, error) {
+	return ccacheFilePath(t.ccachePath), nil
+}
+
+// ListCaches lists the file ccaches the user has: the members of a DIR: collection named by
+// KRB5CCNAME, the /tmp/krb5cc_<uid>* files, and the ccache in use. gokrb5 can't read KEYRING:
+// caches, so they aren't listed.
+func (t *Gokrb5Transport) ListCaches() ([]CacheInfo, error) {
+	current := ccacheFilePath(t.ccachePath)
+	paths := []string{current}
+	if dir, ok := ccacheCollectionDir(os.Getenv("KRB5CCNAME")); ok {
+		members, _ := filepath.Glob(filepath.Join(dir, "tkt*"))
+		paths = append(paths, members...)
+	}
+	others, _ := filepath.Glob(defaultCCachePath() + "*")
+	paths = append(paths, others...)
+
+	var caches []CacheInfo
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		// Anything unreadable isn't a ccache of the user's, e.g. another uid's
+		cc, err := credentials.LoadCCache(path)
+		if err != nil {
+			continue
+		}
+		info := CacheInfo{
+			Name:      path,
+			Principal: cc.DefaultPrincipal.PrincipalName.PrincipalNameString() + "@" + cc.DefaultPrincipal.Realm,
+			Current:   path == current,
+		}
+		for _, c := range cc.GetEntries() {
+			if strings.HasPrefix(c.Server.PrincipalName.PrincipalNameString(), "krbtgt/") && c.EndTime.After(info.TGTExpiry) {
+				info.TGTExpiry = c.EndTime
+			}
+		}
+		caches = append(caches, info)
+	}
+	return caches, nil
+}
+
+// DestroyCache removes the file ccache in use, zeroing it first as kdestroy does; a DIR:
+// collection loses only its primary member. Caches gokrb5 can't read, like KEYRING: and KCM:,
+// are left to kdestroy -c.
+func (t *Gokrb5Transport) DestroyCache() error {
+	name := t.ccachePath
+	if name == "" {
+		name = os.Getenv("KRB5CCNAME")
+	}
+	if kind, _, ok := strings.Cut(name, ":"); ok && kind != "FILE" && kind != "DIR" && filepath.VolumeName(name) == "" {
+		output, err := exec.Command("kdestroy", "-c", name).CombinedOutput()
+		if err != nil {
+			if text := strings.TrimSpace(string(output)); text != "" {
+				return fmt.Errorf("kdestroy -c %s: %s", name, text)
+			}
+			return fmt.Errorf("kdestroy -c %s: %w", name, err)
+		}
+		return nil
+	}
+
+	path := ccacheFilePath(name)
+	if t.debug {
+		fmt.Printf("DEBUG: Destroying ccache: %s\n", path)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		// Overwrite the keys in place, so they aren't left on disk after the unlink
+		if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			_, _ = f.Write(make([]byte, info.Size()))
+			_ = f.Sync()
+			_ = f.Close()
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove ccache %s: %w", path, err)
+	}
+	return nil
+}
+
+// GetDefaultPrincipal returns the principal from the ccache
+func (t *Gokrb5Transport) GetDefaultPrincipal() (string, error) {
+	if t.client == nil {
+		return "", fmt.Errorf("not connected - call Connect() first")
+	}
+	creds := t.client.Credentials
+	return fmt.Sprintf("%s@%s", creds.UserName(), creds.Realm()), nil
+}
+
+// GetCredentials returns the tickets in the ccache, without its configuration entries
+func (t *Gokrb5Transport) GetCredentials() ([]CredInfo, error) {
+	if t.ccache == nil {
+		return nil, fmt.Errorf("not connected - call Connect() first")
+	}
+
+	now := time.Now()
+	entries := t.ccache.GetEntries()
+	creds := make([]CredInfo, 0, len(entries))
+	for _, c := range entries {
+		var lifetime uint32
+		if c.EndTime.After(now) {
+			lifetime = uint32(c.EndTime.Sub(now) / time.Second)
+		}
+		creds = append(creds, CredInfo{
+			ClientPrincipal: c.Client.PrincipalName.PrincipalNameString() + "@" + c.Client.Realm,
+			ServerPrincipal: c.Server.PrincipalName.PrincipalNameString() + "@" + c.Server.Realm,
+			Lifetime:        lifetime,
+			AuthTime:        c.AuthTime.Unix(),
+			StartTime:       c.StartTime.Unix(),
+			EndTime:         c.EndTime.Unix(),
+			RenewTill:       c.RenewTill.Unix(),
+			KeyType:         c.Key.KeyType,
+		})
+	}
+	return creds, nil
+}
+
+// ExportCredential is not supported by gokrb5
+func (t *Gokrb5Transport) ExportCredential() ([]byte, error) {
+	return nil, fmt.Errorf("credential export not supported by the gokrb5 transport")
+}
+
+// GetServiceTicket obtains a service ticket for the specified SPN using gokrb5
+// The SPN should be in the format "HTTP/hostname" or "service/hostname"
+// Returns the SPNEGO token that can be used for authentication
+func (t *Gokrb5Transport) GetServiceTicket(spn string) ([]byte, error) {
+	if t.client == nil {
+		return nil, fmt.Errorf("not connected - call Connect() first")
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: Requesting service ticket for SPN: %s\n", spn)
+	}
+
+	// Parse the SPN into service and hostname
+	// Format: service/hostname or service@hostname
+	var service, hostname string
+	if strings.Contains(spn, "/") {
+		parts := strings.SplitN(spn, "/", 2)
+		service = parts[0]
+		hostname = parts[1]
+	} else if strings.Contains(spn, "@") {
+		parts := strings.SplitN(spn, "@", 2)
+		service = parts[0]
+		hostname = parts[1]
+	} else {
+		return nil, newError(ErrBadSPN, "invalid SPN format: %s (expected service/hostname or service@hostname)", spn)
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: Parsed SPN - service: %s, hostname: %s\n", service, hostname)
+	}
+
+	// Create SPNEGO client and get the initial token
+	spnegoClient := spnego.SPNEGOClient(t.client, spn)
+
+	// Get the SPNEGO token
+	err := spnegoClient.AcquireCred()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire credentials: %w", err)
+	}
+
+	token, err := spnegoClient.InitSecContext()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize security context: %w", err)
+	}
+
+	// Marshal the SPNEGO token, then wipe the AP-REQ it wraps; only the marshaled copy is returned
+	tokenBytes, err := token.Marshal()
+	if st, ok := token.(*spnego.SPNEGOToken); ok {
+		zeroBytes(st.NegTokenInit.MechTokenBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SPNEGO token: %w", err)
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: Got SPNEGO token of %d bytes\n", len(tokenBytes))
+	}
+
+	return tokenBytes, nil
+}
+
+// ccacheFilePath is the file ccache at path, or KRB5CCNAME, or the usual file when both are
+// empty, without a FILE: prefix. A DIR: collection resolves to its primary member.
+func ccacheFilePath(path string) string {
+	if path == "" {
+		path = os.Getenv("KRB5CCNAME")
+		if path == "" {
+			path = defaultCCachePath()
+		}
+	}
+	if member, ok := strings.CutPrefix(path, "DIR::"); ok {
+		return member
+	}
+	if dir, ok := ccacheCollectionDir(path); ok {
+		// MIT Kerberos names the member in use in the collection's primary file
+		primary, err := os.ReadFile(filepath.Join(dir, "primary"))
+		name := strings.TrimSpace(string(primary))
+		if err != nil || name == "" {
+			name = "tkt"
+		}
+		return filepath.Join(dir, name)
+	}
+	return strings.TrimPrefix(path, "FILE:")
+}
+
+// ccacheCollectionDir is the directory of a DIR: collection name, like DIR:/run/user/1000/krb5cc
+// (or a member named as DIR::/run/user/1000/krb5cc/tkt)
+func ccacheCollectionDir(name string) (string, bool) {
+	if member, ok := strings.CutPrefix(name, "DIR::"); ok {
+		return filepath.Dir(member), true
+	}
+	dir, ok := strings.CutPrefix(name, "DIR:")
+	return dir, ok && dir != ""
+}
+
+// krb5ConfFilePath is KRB5_CONFIG, or krb5.conf's usual location
+func krb5ConfFilePath() string {
+	if path := os.Getenv("KRB5_CONFIG"); path != "" {
+		return path
+	}
+	return defaultKrb5ConfPath()
+}
+
+// defaultCCachePath is where MIT Kerberos keeps the file ccache: /tmp/krb5cc_<uid>, or
+// %LOCALAPPDATA%\krb5cc on Windows, which has no uid
+func defaultCCachePath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("LOCALAPPDATA"), "krb5cc")
+	}
+	return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+}
+
+// defaultKrb5ConfPath is krb5.conf's usual location; MIT Kerberos for Windows reads krb5.ini
+func defaultKrb5ConfPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "MIT", "Kerberos5", "krb5.ini")
+	}
+	return "/etc/krb5.conf"
+}
@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+// On Linux the native transport is gokrb5 (transport_gokrb5.go).
+
+package krb
+
+func init() {
+	RegisterTransport(TransportNative, newGokrb5Transport)
+}
+
+// IsMacOS11OrLater returns false on Linux
+func IsMacOS11OrLater() bool {
+	return false
+}
+
+// IsLegacyMacOS returns false on Linux
+func IsLegacyMacOS() bool {
+	return false
+}
+
+// IsWindows returns false on Linux
+func IsWindows() bool {
+	return false
+}
+
+// IsLinux returns true on Linux
+func IsLinux() bool {
+	return true
+}
@@ -0,0 +1,133 @@
+// This file provides the mock transport: canned tokens without a KDC or credential store,
+// for tests and for trying out the tray on machines without Kerberos.
+
+package krb
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TransportMock names the mock transport
+const TransportMock = "mock"
+
+// MockPrincipal is the principal of the mock credentials unless Options.CCache names
+// another one as "MOCK:<principal>"
+const MockPrincipal = "user@MOCK.TEST"
+
+// MockTGTLifetime is how long the mock TGT is valid after the transport connects
+const MockTGTLifetime = 10 * time.Hour
+
+// MockKDCDown makes every mock request fail as if no KDC answered while it is set, as when
+// the VPN goes down
+var MockKDCDown atomic.Bool
+
+// MockCacheDestroyed is set by DestroyCache; while it is set, connecting fails as with an
+// empty cache, until it is cleared as kinit would
+var MockCacheDestroyed atomic.Bool
+
+// MockDelay holds each mock request for this long (a time.Duration), like a slow KDC
+var MockDelay atomic.Int64
+
+// mockTokens numbers the tokens handed out, so a token from the cache can be told from a
+// new one
+var mockTokens atomic.Uint64
+
+// mockTransport hands out "mock:<spn>:<n>" tokens. SPNs for hosts under .invalid fail as
+// unknown to the KDC, and hosts under .unreachable as if no KDC answered, so callers can
+// exercise their error paths.
+type mockTransport struct {
+	principal string
+	connected time.Time
+}
+
+// newMockTransport returns a mock transport for opts.CCache's principal
+func newMockTransport(opts Options) Transport {
+	t := &mockTransport{principal: MockPrincipal}
+	if name, ok := strings.CutPrefix(opts.CCache, "MOCK:"); ok && name != "" {
+		t.principal = name
+	}
+	return t
+}
+
+func (t *mockTransport) Connect() error {
+	if MockCacheDestroyed.Load() {
+		return newError(ErrNoTGT, "no credentials cache found (MOCK:%s)", t.principal)
+	}
+	t.connected = time.Now()
+	return nil
+}
+
+func (t *mockTransport) Close() error {
+	return nil
+}
+
+func (t *mockTransport) GetDefaultCache() (string, error) {
+	return "MOCK:" + t.principal, nil
+}
+
+func (t *mockTransport) GetDefaultPrincipal() (string, error) {
+	return t.principal, nil
+}
+
+// GetCredentials returns the TGT of the principal's realm
+func (t *mockTransport) GetCredentials() ([]CredInfo, error) {
+	realm := t.principal[strings.LastIndex(t.principal, "@")+1:]
+	return []CredInfo{{
+		ClientPrincipal: t.principal,
+		ServerPrincipal: fmt.Sprintf("krbtgt/%s@%s", realm, realm),
+		Lifetime:        uint32(MockTGTLifetime.Seconds()),
+		AuthTime:        t.connected.Unix(),
+		StartTime:       t.connected.Unix(),
+		EndTime:         t.connected.Add(MockTGTLifetime).Unix(),
+	}}, nil
+}
+
+// ListCaches returns the cache of MockPrincipal, and the cache in use if it is another
+func (t *mockTransport) ListCaches() ([]CacheInfo, error) {
+	caches := []CacheInfo{{Name: "MOCK:" + MockPrincipal, Principal: MockPrincipal, Current: t.principal == MockPrincipal}}
+	if t.principal != MockPrincipal {
+		caches = append(caches, CacheInfo{Name: "MOCK:" + t.principal, Principal: t.principal, Current: true})
+	}
+	for i := range caches {
+		caches[i].TGTExpiry = time.Now().Add(MockTGTLifetime)
+	}
+	return caches, nil
+}
+
+// DestroyCache sets MockCacheDestroyed
+func (t *mockTransport) DestroyCache() error {
+	MockCacheDestroyed.Store(true)
+	return nil
+}
+
+func (t *mockTransport) ExportCredential() ([]byte, error) {
+	return nil, fmt.Errorf("the mock transport has no credentials to export")
+}
+
+// GetServiceTicket returns the next mock token for spn
+func (t *mockTransport) GetServiceTicket(spn string) ([]byte, error) {
+	service, host, ok := strings.Cut(spn, "/")
+	if !ok {
+		service, host, ok = strings.Cut(spn, "@")
+	}
+	if !ok || service == "" || host == "" {
+		return nil, newError(ErrBadSPN, "invalid SPN format: %s", spn)
+	}
+	host, _, _ = strings.Cut(host, "@")
+
+	if d := time.Duration(MockDelay.Load()); d > 0 {
+		time.Sleep(d)
+	}
+	switch {
+	case MockKDCDown.Load():
+		return nil, newError(ErrKDCUnreachable, "cannot contact any KDC for realm of %s", host)
+	case strings.HasSuffix(host, ".invalid"):
+		return nil, newError(ErrBadSPN, "KDC_ERR_S_PRINCIPAL_UNKNOWN: server not found in Kerberos database: %s", spn)
+	case strings.HasSuffix(host, ".unreachable"):
+		return nil, newError(ErrKDCUnreachable, "cannot contact any KDC for realm of %s", host)
+	}
+	return []byte(fmt.Sprintf("mock:%s:%d", spn, mockTokens.Add(1))), nil
+}
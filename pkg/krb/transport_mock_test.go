@@ -0,0 +1,28 @@
+package krb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMockTransport covers the mock transport through the package API
+func TestMockTransport(t *testing.T) {
+	opts := Options{Transport: TransportMock}
+	principal, err := DefaultPrincipal(opts)
+	if err != nil || principal != MockPrincipal {
+		t.Errorf("DefaultPrincipal = %q, %v", principal, err)
+	}
+	expiry, err := TGTExpiry(opts)
+	if err != nil || time.Until(expiry) < MockTGTLifetime-time.Minute {
+		t.Errorf("TGTExpiry = %v, %v", expiry, err)
+	}
+	first, _ := ServiceToken("HTTP@app.example.com", opts)
+	second, _ := ServiceToken("HTTP@app.example.com", opts)
+	if !strings.HasPrefix(string(first), "mock:HTTP@app.example.com:") || string(first) == string(second) {
+		t.Errorf("tokens %q and %q", first, second)
+	}
+	if _, err := ServiceToken("HTTP@app.gone.invalid", opts); err == nil {
+		t.Error("ticket for an .invalid host")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !darwin && !windows && !linux
+// +build !darwin,!windows,!linux
+
+// There is no native transport on other platforms; the gokrb5 transport can still be
+// selected.
+
+package krb
+
+// IsMacOS11OrLater returns false on non-macOS platforms
+func IsMacOS11OrLater() bool {
+	return false
+}
+
+// IsLegacyMacOS returns false on non-macOS platforms
+func IsLegacyMacOS() bool {
+	return false
+}
+
+// IsWindows returns false on non-Windows platforms
+func IsWindows() bool {
+	return false
+}
+
+// IsLinux returns false on non-Linux platforms
+func IsLinux() bool {
+	return false
+}
@@ -0,0 +1,205 @@
+//go:build windows
+// +build windows
+
+// This file provides SSPI-based Kerberos authentication on Windows.
+
+package krb
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/alexbrainman/sspi"
+	"github.com/alexbrainman/sspi/kerberos"
+	"github.com/alexbrainman/sspi/negotiate"
+	"golang.org/x/sys/windows"
+)
+
+var enumerateSecurityPackages = secur32.NewProc("EnumerateSecurityPackagesW")
+
+// sspiTransport provides SSPI-based authentication on Windows
+type sspiTransport struct {
+	debug bool
+	pkg   string // PackageNegotiate or PackageKerberos
+	cred  *sspi.Credentials
+}
+
+func init() {
+	RegisterTransport(TransportNative, newSSPITransport)
+}
+
+// newSSPITransport creates a new SSPI transport
+func newSSPITransport(opts Options) Transport {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = PackageNegotiate
+	}
+	return &sspiTransport{debug: opts.Debug, pkg: pkg}
+}
+
+// SecurityPackages lists the SSPI packages installed on this machine
+func SecurityPackages() ([]PackageInfo, error) {
+	var count uint32
+	var infos *sspi.SecPkgInfo
+	if ret, _, _ := enumerateSecurityPackages.Call(uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&infos))); ret != 0 {
+		return nil, fmt.Errorf("EnumerateSecurityPackages: %w", syscall.Errno(ret))
+	}
+	if infos == nil {
+		return nil, nil
+	}
+	defer sspi.FreeContextBuffer((*byte)(unsafe.Pointer(infos)))
+
+	packages := make([]PackageInfo, 0, count)
+	for _, info := range unsafe.Slice(infos, count) {
+		packages = append(packages, PackageInfo{
+			Name:         windows.UTF16PtrToString(info.Name),
+			Comment:      windows.UTF16PtrToString(info.Comment),
+			Capabilities: info.Capabilities,
+			MaxToken:     info.MaxToken,
+		})
+	}
+	return packages, nil
+}
+
+// IsMacOS11OrLater returns false on Windows (not applicable)
+func IsMacOS11OrLater() bool {
+	return false
+}
+
+// IsWindows returns true on Windows
+func IsWindows() bool {
+	return true
+}
+
+// IsLegacyMacOS returns false on Windows
+func IsLegacyMacOS() bool {
+	return false
+}
+
+// IsLinux returns false on Windows
+func IsLinux() bool {
+	return false
+}
+
+// SetDebug enables or disables debug output
+func (t *sspiTransport) SetDebug(debug bool) {
+	t.debug = debug
+}
+
+// SetCCachePath is a no-op on Windows (SSPI manages credentials)
+func (t *sspiTransport) SetCCachePath(path string) {
+	// Windows SSPI uses LSA credential cache, path is ignored
+}
+
+// Connect acquires current user credentials for the transport's SSPI package
+func (t *sspiTransport) Connect() error {
+	var cred *sspi.Credentials
+	var err error
+	switch t.pkg {
+	case PackageNegotiate:
+		cred, err = negotiate.AcquireCurrentUserCredentials()
+	case PackageKerberos:
+		cred, err = kerberos.AcquireCurrentUserCredentials()
+	default:
+		return fmt.Errorf("unknown SSPI package %q (have %s, %s)", t.pkg, PackageNegotiate, PackageKerberos)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire %s credentials: %w", t.pkg, err)
+	}
+	t.cred = cred
+	if t.debug {
+		fmt.Printf("DEBUG: Acquired current user credentials via SSPI (%s)\n", t.pkg)
+	}
+	return nil
+}
+
+// Close releases the credentials
+func (t *sspiTransport) Close() error {
+	if t.cred != nil {
+		t.cred.Release()
+		t.cred = nil
+	}
+	return nil
+}
+
+// GetDefaultCache returns a placeholder on Windows (SSPI doesn't expose cache names)
+func (t *sspiTransport) GetDefaultCache() (string, error) {
+	return "SSPI", nil
+}
+
+// GetDefaultPrincipal returns the client principal of the logon session's TGT, or of its
+// first ticket if there is no TGT
+func (t *sspiTransport) GetDefaultPrincipal() (string, error) {
+	creds, err := queryTicketCache()
+	if err != nil {
+		return "", err
+	}
+	for _, c := range creds {
+		if strings.HasPrefix(c.ServerPrincipal, "krbtgt/") {
+			return c.ClientPrincipal, nil
+		}
+	}
+	if len(creds) > 0 {
+		return creds[0].ClientPrincipal, nil
+	}
+	return "", &Error{Kind: ErrNoTGT, Msg: "no Kerberos tickets in this logon session"}
+}
+
+// GetCredentials returns the tickets of the logon session from the LSA, as klist does
+func (t *sspiTransport) GetCredentials() ([]CredInfo, error) {
+	return queryTicketCache()
+}
+
+// ExportCredential is not supported on Windows via SSPI
+func (t *sspiTransport) ExportCredential() ([]byte, error) {
+	return nil, fmt.Errorf("credential export not supported on Windows")
+}
+
+// GetServiceTicket obtains a service ticket for the specified SPN using SSPI
+// The SPN should be in the format "HTTP/hostname" or "HTTP@hostname"
+// Returns an SPNEGO token with the Negotiate package, or a raw Kerberos one (never NTLM)
+// with the Kerberos package
+func (t *sspiTransport) GetServiceTicket(spn string) ([]byte, error) {
+	if t.cred == nil {
+		return nil, fmt.Errorf("not connected - call Connect() first")
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: Requesting service ticket for SPN: %s\n", spn)
+	}
+
+	// Create a client context for the target SPN
+	// This will request a service ticket from the KDC
+	var token []byte
+	var err error
+	if t.pkg == PackageKerberos {
+		var ctx *kerberos.ClientContext
+		ctx, _, token, err = kerberos.NewClientContext(t.cred, spn)
+		if err == nil {
+			defer ctx.Release()
+		}
+	} else {
+		var ctx *negotiate.ClientContext
+		ctx, token, err = negotiate.NewClientContext(t.cred, spn)
+		if err == nil {
+			defer ctx.Release()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize security context: %w", err)
+	}
+
+	if t.debug {
+		fmt.Printf("DEBUG: SSPI returned token of %d bytes\n", len(token))
+	}
+
+	// The first call to NewClientContext returns the initial token
+	// For Kerberos, this is typically the complete AP-REQ wrapped in SPNEGO
+	if len(token) == 0 {
+		return nil, fmt.Errorf("SSPI returned empty token")
+	}
+
+	return token, nil
+}
@@ -67,6 +67,46 @@ char* showPromptDialog(const char* title, const char* message, const char* defau
     }
 }
 
+// showFileDialog displays an NSSavePanel (save != 0) or NSOpenPanel
+// Returns "1:<path>" if a file was chosen, or "0:" if cancelled
+char* showFileDialog(const char* title, const char* defaultName, int save) {
+    @autoreleasepool {
+        __block NSString* result = nil;
+
+        void (^showPanel)(void) = ^{
+            NSSavePanel *panel;
+            if (save) {
+                panel = [NSSavePanel savePanel];
+                [panel setNameFieldStringValue:[NSString stringWithUTF8String:defaultName]];
+            } else {
+                NSOpenPanel *openPanel = [NSOpenPanel openPanel];
+                [openPanel setCanChooseFiles:YES];
+                [openPanel setCanChooseDirectories:NO];
+                [openPanel setAllowsMultipleSelection:NO];
+                panel = openPanel;
+            }
+            [panel setTitle:[NSString stringWithUTF8String:title]];
+            [NSApp activateIgnoringOtherApps:YES];
+
+            if ([panel runModal] == NSModalResponseOK) {
+                result = [[panel URL] path];
+            }
+        };
+
+        if ([NSThread isMainThread]) {
+            showPanel();
+        } else {
+            dispatch_sync(dispatch_get_main_queue(), showPanel);
+        }
+
+        if (result != nil) {
+            NSString *prefixed = [NSString stringWithFormat:@"1:%@", result];
+            return strdup([prefixed UTF8String]);
+        }
+        return strdup("0:");
+    }
+}
+
 // showConfirmDialog displays a simple Yes/No confirmation dialog
 int showConfirmDialog(const char* title, const char* message) {
     @autoreleasepool {
@@ -93,6 +133,75 @@ int showConfirmDialog(const char* title, const char* message) {
         return confirmed ? 1 : 0;
     }
 }
+// showMessageDialog displays an informational alert with an OK button
+void showMessageDialog(const char* title, const char* message) {
+    @autoreleasepool {
+        void (^showAlert)(void) = ^{
+            NSAlert *alert = [[NSAlert alloc] init];
+            [alert setMessageText:[NSString stringWithUTF8String:title]];
+            [alert setInformativeText:[NSString stringWithUTF8String:message]];
+            [alert addButtonWithTitle:@"OK"];
+            [alert setAlertStyle:NSAlertStyleInformational];
+
+            [alert runModal];
+        };
+
+        if ([NSThread isMainThread]) {
+            showAlert();
+        } else {
+            dispatch_sync(dispatch_get_main_queue(), showAlert);
+        }
+    }
+}
+// showQuickPickDialog displays grid in a monospaced font above a number field. Return
+// picks the typed number and Escape cancels.
+// Returns "1:<input>" if OK was clicked, or "0:" if cancelled
+char* showQuickPickDialog(const char* title, const char* grid) {
+    @autoreleasepool {
+        __block NSString* result = nil;
+
+        void (^showAlert)(void) = ^{
+            NSAlert *alert = [[NSAlert alloc] init];
+            [alert setMessageText:[NSString stringWithUTF8String:title]];
+            [alert addButtonWithTitle:@"OK"];
+            [alert addButtonWithTitle:@"Cancel"];
+            [alert setAlertStyle:NSAlertStyleInformational];
+
+            NSTextField *label = [NSTextField labelWithString:[NSString stringWithUTF8String:grid]];
+            [label setFont:[NSFont monospacedSystemFontOfSize:12 weight:NSFontWeightRegular]];
+            [label sizeToFit];
+            NSSize size = [label frame].size;
+            CGFloat width = MAX(size.width, 300);
+
+            NSTextField *input = [[NSTextField alloc] initWithFrame:NSMakeRect(0, 0, width, 24)];
+            [input setPlaceholderString:@"Number"];
+            [label setFrameOrigin:NSMakePoint(0, 32)];
+
+            NSView *view = [[NSView alloc] initWithFrame:NSMakeRect(0, 0, width, size.height + 32)];
+            [view addSubview:label];
+            [view addSubview:input];
+            [alert setAccessoryView:view];
+            [[alert window] setInitialFirstResponder:input];
+
+            [NSApp activateIgnoringOtherApps:YES];
+            if ([alert runModal] == NSAlertFirstButtonReturn) {
+                result = [input stringValue];
+            }
+        };
+
+        if ([NSThread isMainThread]) {
+            showAlert();
+        } else {
+            dispatch_sync(dispatch_get_main_queue(), showAlert);
+        }
+
+        if (result != nil) {
+            NSString *prefixed = [NSString stringWithFormat:@"1:%@", result];
+            return strdup([prefixed UTF8String]);
+        }
+        return strdup("0:");
+    }
+}
 */
 import "C"
 import (
@@ -138,3 +247,54 @@ func ConfirmDialog(title, message string) bool {
 	result := C.showConfirmDialog(cTitle, cMessage)
 	return result == 1
 }
+
+// ShowMessageDialog shows message in a dialog with an OK button
+func ShowMessageDialog(title, message string) {
+	cTitle := C.CString(title)
+	cMessage := C.CString(message)
+	defer C.free(unsafe.Pointer(cTitle))
+	defer C.free(unsafe.Pointer(cMessage))
+
+	C.showMessageDialog(cTitle, cMessage)
+}
+
+// ChooseFileDialog shows a file picker, for saving (with defaultName filled in) or opening
+// Returns the chosen path and true, or empty string and false if cancelled
+func ChooseFileDialog(title string, save bool, defaultName string) (string, bool) {
+	cTitle := C.CString(title)
+	cDefault := C.CString(defaultName)
+	defer C.free(unsafe.Pointer(cTitle))
+	defer C.free(unsafe.Pointer(cDefault))
+
+	isSave := C.int(0)
+	if save {
+		isSave = C.int(1)
+	}
+
+	cResult := C.showFileDialog(cTitle, cDefault, isSave)
+	defer C.free(unsafe.Pointer(cResult))
+
+	result := C.GoString(cResult)
+	if strings.HasPrefix(result, "1:") {
+		return result[2:], true
+	}
+	return "", false
+}
+
+// QuickPickDialog shows grid, a numbered list of entries, and asks for a number
+// Returns the typed text and true, or empty string and false if cancelled
+func QuickPickDialog(title, grid string) (string, bool) {
+	cTitle := C.CString(title)
+	cGrid := C.CString(grid)
+	defer C.free(unsafe.Pointer(cTitle))
+	defer C.free(unsafe.Pointer(cGrid))
+
+	cResult := C.showQuickPickDialog(cTitle, cGrid)
+	defer C.free(unsafe.Pointer(cResult))
+
+	result := C.GoString(cResult)
+	if strings.HasPrefix(result, "1:") {
+		return result[2:], true
+	}
+	return "", false
+}
@@ -50,11 +50,43 @@ func PromptForInput(title, message, defaultValue string, secure bool) (string, b
 	return "", false
 }
 
+// ChooseFileDialog shows a file picker, for saving (with defaultName filled in) or opening
+// Linux implementation using zenity or kdialog
+func ChooseFileDialog(title string, save bool, defaultName string) (string, bool) {
+	if path, err := exec.LookPath("zenity"); err == nil {
+		args := []string{"--file-selection", "--title", title}
+		if save {
+			args = append(args, "--save", "--confirm-overwrite", "--filename", defaultName)
+		}
+		output, err := exec.Command(path, args...).Output()
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimSpace(string(output)), true
+	}
+
+	if path, err := exec.LookPath("kdialog"); err == nil {
+		args := []string{"--title", title, "--getopenfilename"}
+		if save {
+			args = []string{"--title", title, "--getsavefilename", defaultName}
+		}
+		output, err := exec.Command(path, args...).Output()
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimSpace(string(output)), true
+	}
+
+	LogWarn("No dialog tool found (install zenity or kdialog)")
+	return "", false
+}
+
 // ConfirmDialog shows a Yes/No confirmation dialog
 func ConfirmDialog(title, message string) bool {
 	// Try zenity first
 	if path, err := exec.LookPath("zenity"); err == nil {
-		cmd := exec.Command(path, "--question", "--title", title, "--text", message)
+		// Messages are plain text; commands shown in them often hold <, > or &
+		cmd := exec.Command(path, "--question", "--no-markup", "--title", title, "--text", message)
 		err := cmd.Run()
 		return err == nil
 	}
@@ -68,4 +100,45 @@ func ConfirmDialog(title, message string) bool {
 
 	LogWarn("No dialog tool found (install zenity or kdialog)")
 	return false
+}
+
+// ShowMessageDialog shows message in a dialog with an OK button
+func ShowMessageDialog(title, message string) {
+	if path, err := exec.LookPath("zenity"); err == nil {
+		// --no-markup: JSON and such would otherwise be parsed as Pango markup
+		_ = exec.Command(path, "--info", "--no-markup", "--title", title, "--text", message).Run()
+		return
+	}
+
+	if path, err := exec.LookPath("kdialog"); err == nil {
+		_ = exec.Command(path, "--title", title, "--msgbox", message).Run()
+		return
+	}
+
+	LogWarn("No dialog tool found (install zenity or kdialog)")
+}
+
+// QuickPickDialog shows grid, a numbered list of entries, and asks for a number
+// Linux implementation using zenity or kdialog
+func QuickPickDialog(title, grid string) (string, bool) {
+	if path, err := exec.LookPath("zenity"); err == nil {
+		// zenity parses --text as Pango markup, which also gives the grid a monospaced font
+		markup := "<tt>" + strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(grid) + "</tt>"
+		output, err := exec.Command(path, "--entry", "--title", title, "--text", markup).Output()
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimSpace(string(output)), true
+	}
+
+	if path, err := exec.LookPath("kdialog"); err == nil {
+		output, err := exec.Command(path, "--title", title, "--inputbox", grid, "").Output()
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimSpace(string(output)), true
+	}
+
+	LogWarn("No dialog tool found (install zenity or kdialog)")
+	return "", false
 }
\ No newline at end of file
@@ -2,18 +2,111 @@
 
 package main
 
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
 // PromptForInput shows a dialog asking the user for text input
-// Windows implementation - returns error for now (could use Windows API later)
+// Windows implementation using a WinForms form through PowerShell
 func PromptForInput(title, message, defaultValue string, secure bool) (string, bool) {
-	// TODO: Implement using Windows API (e.g., TaskDialog or custom dialog)
-	// For now, return empty/cancelled
-	LogWarn("Prompt dialog not yet implemented on Windows")
-	return "", false
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	passwordChar := "$false"
+	if secure {
+		passwordChar = "$true"
+	}
+	script := "Add-Type -AssemblyName System.Windows.Forms; " +
+		"$f = New-Object System.Windows.Forms.Form; $f.Text = " + quote(title) + "; " +
+		"$f.Width = 360; $f.Height = 160; $f.FormBorderStyle = 'FixedDialog'; $f.StartPosition = 'CenterScreen'; $f.TopMost = $true; " +
+		"$f.MaximizeBox = $false; $f.MinimizeBox = $false; " +
+		"$l = New-Object System.Windows.Forms.Label; $l.Text = " + quote(message) + "; $l.SetBounds(10, 10, 330, 20); " +
+		"$t = New-Object System.Windows.Forms.TextBox; $t.Text = " + quote(defaultValue) + "; $t.UseSystemPasswordChar = " + passwordChar + "; $t.SetBounds(10, 35, 325, 20); " +
+		"$ok = New-Object System.Windows.Forms.Button; $ok.Text = 'OK'; $ok.DialogResult = 'OK'; $ok.SetBounds(180, 70, 75, 25); " +
+		"$cancel = New-Object System.Windows.Forms.Button; $cancel.Text = 'Cancel'; $cancel.DialogResult = 'Cancel'; $cancel.SetBounds(260, 70, 75, 25); " +
+		"$f.AcceptButton = $ok; $f.CancelButton = $cancel; $f.Controls.AddRange(@($l, $t, $ok, $cancel)); " +
+		"if ($f.ShowDialog() -eq 'OK') { [Console]::Out.Write('1:' + $t.Text) } else { [Console]::Out.Write('0:') }"
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-STA", "-NonInteractive", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	output, err := cmd.Output()
+	if err != nil || !strings.HasPrefix(string(output), "1:") {
+		return "", false
+	}
+	return strings.TrimPrefix(string(output), "1:"), true
+}
+
+// ChooseFileDialog shows a file picker, for saving (with defaultName filled in) or opening
+// Windows implementation using the WinForms dialogs through PowerShell
+func ChooseFileDialog(title string, save bool, defaultName string) (string, bool) {
+	dialog := "OpenFileDialog"
+	if save {
+		dialog = "SaveFileDialog"
+	}
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	script := "Add-Type -AssemblyName System.Windows.Forms; " +
+		"$d = New-Object System.Windows.Forms." + dialog + "; " +
+		"$d.Title = " + quote(title) + "; " +
+		"$d.FileName = " + quote(defaultName) + "; " +
+		"if ($d.ShowDialog() -eq 'OK') { $d.FileName }"
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-STA", "-NonInteractive", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	output, err := cmd.Output()
+	path := strings.TrimSpace(string(output))
+	if err != nil || path == "" {
+		return "", false
+	}
+	return path, true
 }
 
 // ConfirmDialog shows a Yes/No confirmation dialog
+// Windows implementation using a WinForms MessageBox through PowerShell; No is the default
 func ConfirmDialog(title, message string) bool {
-	// TODO: Implement using MessageBox
-	LogWarn("Confirm dialog not yet implemented on Windows")
-	return false
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	script := "Add-Type -AssemblyName System.Windows.Forms; " +
+		"[System.Windows.Forms.MessageBox]::Show(" + quote(message) + ", " + quote(title) + ", 'YesNo', 'Question', 'Button2', 'DefaultDesktopOnly')"
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-STA", "-NonInteractive", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "Yes"
+}
+
+// ShowMessageDialog shows message in a dialog with an OK button
+// Windows implementation using a WinForms MessageBox through PowerShell
+func ShowMessageDialog(title, message string) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-STA", "-NonInteractive", "-Command",
+		"Add-Type -AssemblyName System.Windows.Forms; "+
+			"[void][System.Windows.Forms.MessageBox]::Show($env:KRB5TRAY_MESSAGE, $env:KRB5TRAY_TITLE, 'OK', 'Information', 'Button1', 'DefaultDesktopOnly')")
+	cmd.Env = append(os.Environ(), "KRB5TRAY_TITLE="+title, "KRB5TRAY_MESSAGE="+message)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	_ = cmd.Run()
+}
+
+// QuickPickDialog shows grid, a numbered list of entries, and asks for a number
+// Windows implementation using a WinForms form through PowerShell; Enter picks, Escape cancels
+func QuickPickDialog(title, grid string) (string, bool) {
+	script := "Add-Type -AssemblyName System.Windows.Forms, System.Drawing; " +
+		"$f = New-Object System.Windows.Forms.Form; $f.Text = $env:KRB5TRAY_TITLE; " +
+		"$f.AutoSize = $true; $f.AutoSizeMode = 'GrowAndShrink'; $f.FormBorderStyle = 'FixedDialog'; $f.StartPosition = 'CenterScreen'; $f.TopMost = $true; " +
+		"$f.MaximizeBox = $false; $f.MinimizeBox = $false; $f.Padding = New-Object System.Windows.Forms.Padding(10); " +
+		"$p = New-Object System.Windows.Forms.FlowLayoutPanel; $p.FlowDirection = 'TopDown'; $p.AutoSize = $true; " +
+		"$l = New-Object System.Windows.Forms.Label; $l.Text = $env:KRB5TRAY_MESSAGE; $l.AutoSize = $true; $l.Font = New-Object System.Drawing.Font('Consolas', 10); " +
+		"$t = New-Object System.Windows.Forms.TextBox; $t.Width = 120; " +
+		"$ok = New-Object System.Windows.Forms.Button; $ok.DialogResult = 'OK'; $ok.Size = New-Object System.Drawing.Size(0, 0); " +
+		"$cancel = New-Object System.Windows.Forms.Button; $cancel.DialogResult = 'Cancel'; $cancel.Size = New-Object System.Drawing.Size(0, 0); " +
+		"$p.Controls.AddRange(@($l, $t, $ok, $cancel)); $f.Controls.Add($p); $f.AcceptButton = $ok; $f.CancelButton = $cancel; " +
+		"$f.Add_Shown({ $f.Activate(); $t.Focus() }); " +
+		"if ($f.ShowDialog() -eq 'OK') { [Console]::Out.Write('1:' + $t.Text) } else { [Console]::Out.Write('0:') }"
+
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-STA", "-NonInteractive", "-Command", script)
+	cmd.Env = append(os.Environ(), "KRB5TRAY_TITLE="+title, "KRB5TRAY_MESSAGE="+grid)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	output, err := cmd.Output()
+	if err != nil || !strings.HasPrefix(string(output), "1:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(output), "1:")), true
 }
\ No newline at end of file
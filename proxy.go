@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"krb5tray/internal/httpclient"
+)
+
+// DefaultProxyPort is the default port of the SPNEGO-injecting forward proxy
+const DefaultProxyPort = 47801
+
+// proxyMaxRetryBody is the largest request body buffered so a request can be resent after a 401
+const proxyMaxRetryBody = 1 << 20
+
+// hopHeaders are connection-specific headers that must not be forwarded (RFC 9110 section 7.6.1)
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// proxyUser is the user name in the proxy URL; only the password is checked
+const proxyUser = "krb5tray"
+
+// proxyServer is the running forward proxy
+type proxyServer struct {
+	server    *http.Server
+	transport *http.Transport
+	port      int
+	secret    string // Password every request's Proxy-Authorization must carry
+}
+
+var (
+	activeProxy *proxyServer
+	proxyMutex  sync.Mutex
+)
+
+// ApplyProxyConfig starts, restarts, or stops the forward proxy to match the configuration.
+// Host mappings are read from the current config on each request, so they apply without a restart.
+func ApplyProxyConfig(cfg ProxyConfig) {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	if activeProxy != nil && (!cfg.Enabled || activeProxy.port != cfg.Port) {
+		activeProxy.stop()
+		activeProxy = nil
+	}
+	if !cfg.Enabled || activeProxy != nil {
+		return
+	}
+
+	proxy, err := startProxyServer(cfg.Port)
+	if err != nil {
+		LogError("Failed to start proxy: %v", err)
+		return
+	}
+	if err := os.WriteFile(ProxyURLPath(), []byte(proxy.url()+"\n"), 0600); err != nil {
+		LogError("Failed to write proxy URL: %v", err)
+		proxy.stop()
+		return
+	}
+	activeProxy = proxy
+	LogInfo("Proxy listening on http://127.0.0.1:%d (%d hosts mapped)", cfg.Port, len(cfg.Hosts))
+}
+
+// ProxyURLPath returns the file the proxy URL, with the session's password, is written to
+func ProxyURLPath() string {
+	return filepath.Join(ConfigDir(), "proxy-url")
+}
+
+// ProxyURL returns the URL to set HTTP_PROXY to, or "" if the proxy isn't running
+func ProxyURL() string {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+	if activeProxy == nil {
+		return ""
+	}
+	return activeProxy.url()
+}
+
+// url is the proxy's URL with its credentials, like http://krb5tray:<secret>@127.0.0.1:47801
+func (p *proxyServer) url() string {
+	return fmt.Sprintf("http://%s:%s@127.0.0.1:%d", proxyUser, p.secret, p.port)
+}
+
+// StopProxyServer stops the forward proxy
+func StopProxyServer() {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	if activeProxy != nil {
+		activeProxy.stop()
+		activeProxy = nil
+	}
+	_ = os.Remove(ProxyURLPath())
+}
+
+func startProxyServer(port int) (*proxyServer, error) {
+	// A new password each start, so other local users can't borrow the Kerberos identity
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate proxy password: %w", err)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	// Clone the default transport but never chain to HTTP_PROXY, which may point back here
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+
+	p := &proxyServer{transport: transport, port: port, secret: hex.EncodeToString(b)}
+	p.server = &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go func() {
+		if err := p.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			LogError("Proxy stopped: %v", err)
+		}
+	}()
+	return p, nil
+}
+
+func (p *proxyServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = p.server.Shutdown(ctx)
+	p.transport.CloseIdleConnections()
+}
+
+// proxySPNForHost returns the SPN proxy.hosts maps host to, then spn_map's, or "" if the
+// host isn't mapped
+func proxySPNForHost(cfg *Config, host string) string {
+	host = strings.ToLower(host)
+	for _, entry := range cfg.GetProxyConfigWithDefaults().Hosts {
+		pattern := strings.ToLower(entry.Host)
+		if suffix, wildcard := strings.CutPrefix(pattern, "*."); wildcard {
+			if !strings.HasSuffix(host, "."+suffix) {
+				continue
+			}
+		} else if host != pattern {
+			continue
+		}
+
+		return expandSPNTemplate(cfg, entry.SPN, host)
+	}
+	return cfg.SPNForHost(host)
+}
+
+// authorized reports whether the request's Proxy-Authorization carries the session password
+func (p *proxyServer) authorized(r *http.Request) bool {
+	user, password, ok := parseProxyBasicAuth(r.Header.Get("Proxy-Authorization"))
+	return ok && user != "" && subtle.ConstantTimeCompare([]byte(password), []byte(p.secret)) == 1
+}
+
+// parseProxyBasicAuth parses a Basic Proxy-Authorization header, as http.Request.BasicAuth
+// does for Authorization
+func parseProxyBasicAuth(header string) (string, string, bool) {
+	r := &http.Request{Header: http.Header{"Authorization": {header}}}
+	return r.BasicAuth()
+}
+
+// ServeHTTP proxies one request, attaching a Negotiate header for mapped hosts
+func (p *proxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="krb5tray"`)
+		http.Error(w, "krb5tray proxy: missing or invalid proxy password (see ctl proxy-url)", http.StatusProxyAuthRequired)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	// Only absolute-form requests are proxied; this also stops web pages from using the
+	// proxy by sending ordinary requests to 127.0.0.1
+	if !r.URL.IsAbs() || r.URL.Scheme != "http" {
+		http.Error(w, "krb5tray proxy: only http:// proxy requests are supported", http.StatusBadRequest)
+		return
+	}
+
+	cfg := currentConfig()
+
+	// Like tunnels, plain requests only go to mapped hosts, so the proxy can't be used to
+	// reach the rest of the network
+	spn := proxySPNForHost(cfg, r.URL.Hostname())
+	if spn == "" {
+		http.Error(w, fmt.Sprintf("krb5tray proxy: %s isn't mapped in proxy.hosts or spn_map", r.URL.Hostname()), http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("Authorization") != "" {
+		spn = ""
+	}
+
+	span := StartClientSpan("proxy.request", nil)
+	span.SetAttr("http.method", r.Method)
+	span.SetAttr("server.address", r.URL.Hostname())
+	span.SetAttr("krb5.spn", spn)
+
+	// Buffer small bodies so the request can be resent after a 401
+	body, retryable, err := bufferProxyBody(r)
+	if err != nil {
+		span.End(err)
+		http.Error(w, "krb5tray proxy: failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := p.forward(r, body, cfg, spn, false)
+	if err == nil && spn != "" && retryable && isNegotiateChallenge(resp) {
+		// Cached tokens may be rejected as replays, so retry once with a fresh ticket
+		resp.Body.Close()
+		LogDebug("Proxy got 401 from %s, retrying with a fresh token", r.URL.Host)
+		resp, err = p.forward(r, body, cfg, spn, true)
+	}
+	if err != nil {
+		span.End(err)
+		LogWarn("Proxy request to %s failed: %v", r.URL.Host, err)
+		http.Error(w, fmt.Sprintf("krb5tray proxy: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	span.SetAttr("http.status_code", fmt.Sprintf("%d", resp.StatusCode))
+	span.End(nil)
+
+	LogDebug("Proxy %s %s -> %d (spn: %q)", r.Method, httpclient.RedactURL(r.URL), resp.StatusCode, spn)
+	removeHopHeaders(resp.Header)
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// forward sends the request upstream, with a Negotiate header when spn is set
+func (p *proxyServer) forward(r *http.Request, body io.Reader, cfg *Config, spn string, fresh bool) (*http.Response, error) {
+	if seeker, ok := body.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Body = io.NopCloser(body)
+	if r.Body == nil || r.Body == http.NoBody {
+		out.Body = nil
+	}
+	removeHopHeaders(out.Header)
+
+	if spn != "" {
+		if err := requireSecurityKey(securityKeyTokens, fmt.Sprintf("Send a token for %s through the proxy", spn)); err != nil {
+			return nil, err
+		}
+		token, err := getCachedServiceToken(cfg, spn, fresh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token for %s: %w", spn, err)
+		}
+		out.Header.Set("Authorization", "Negotiate "+token)
+	}
+	return p.transport.RoundTrip(out)
+}
+
+// bufferProxyBody reads up to proxyMaxRetryBody of the request body.
+// Larger bodies are streamed and the request is not retryable.
+func bufferProxyBody(r *http.Request) (io.Reader, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return bytes.NewReader(nil), true, nil
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, proxyMaxRetryBody+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(head) <= proxyMaxRetryBody {
+		return bytes.NewReader(head), true, nil
+	}
+	return io.MultiReader(bytes.NewReader(head), r.Body), false, nil
+}
+
+// isNegotiateChallenge reports whether the response is a 401 asking for Negotiate auth
+func isNegotiateChallenge(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(challenge)), "negotiate") {
+			return true
+		}
+	}
+	return false
+}
+
+func removeHopHeaders(h http.Header) {
+	// Headers named in Connection are hop-by-hop too
+	for _, field := range strings.Split(h.Get("Connection"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			h.Del(field)
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// tunnel relays a CONNECT request unchanged. HTTPS traffic is end-to-end encrypted,
+// so no Negotiate header can be added to it. Only mapped hosts are tunneled to, so the
+// proxy isn't an open relay into the network.
+func (p *proxyServer) tunnel(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if proxySPNForHost(currentConfig(), host) == "" {
+		http.Error(w, fmt.Sprintf("krb5tray proxy: %s isn't mapped in proxy.hosts or spn_map", host), http.StatusForbidden)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("krb5tray proxy: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "krb5tray proxy: tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	LogDebug("Proxy tunneling to %s", r.Host)
+
+	go func() {
+		// Forward anything the client sent after the CONNECT request
+		if n := buffered.Reader.Buffered(); n > 0 {
+			early, _ := buffered.Reader.Peek(n)
+			_, _ = upstream.Write(early)
+		}
+		_, _ = io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+	client.Close()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.design/x/hotkey"
+)
+
+// quickPickKey opens the quick pick when pressed with a category's digit modifiers
+const quickPickKey = hotkey.KeyG
+
+// quickPickNameWidth is how much of an entry's name fits in a grid cell
+const quickPickNameWidth = 28
+
+var (
+	quickPickMutex   sync.Mutex
+	quickPickHotkeys []*hotkey.Hotkey
+	quickPickOpen    atomic.Bool // A quick pick dialog is showing
+)
+
+// quickPickItem is one numbered entry in the quick pick grid
+type quickPickItem struct {
+	Index int
+	Name  string
+}
+
+// quickPickCategory is a set of entries reachable by digit hotkeys
+type quickPickCategory struct {
+	title  string
+	items  func(cfg *Config) []quickPickItem
+	pickBy func(num int)
+}
+
+var quickPickCategories = []quickPickCategory{
+	{
+		title:  "Snippets",
+		items:  snippetItems,
+		pickBy: copySnippetByIndex,
+	},
+	{
+		title:  "URLs",
+		items:  urlItems,
+		pickBy: openURLByIndex,
+	},
+	{
+		title:  "SSH",
+		items:  sshItems,
+		pickBy: openSSHByIndex,
+	},
+}
+
+// snippetItems and urlItems list the entries by index, for the quick pick and the edit
+// dialogs
+func snippetItems(cfg *Config) []quickPickItem {
+	items := make([]quickPickItem, len(cfg.Snippets))
+	for i, s := range cfg.Snippets {
+		items[i] = quickPickItem{s.Index, s.Name}
+	}
+	return items
+}
+
+func urlItems(cfg *Config) []quickPickItem {
+	items := make([]quickPickItem, len(cfg.URLs))
+	for i, u := range cfg.URLs {
+		items[i] = quickPickItem{u.Index, u.Name}
+	}
+	return items
+}
+
+func sshItems(cfg *Config) []quickPickItem {
+	items := make([]quickPickItem, len(cfg.SSH))
+	for i, s := range cfg.SSH {
+		items[i] = quickPickItem{s.Index, s.Name}
+	}
+	return items
+}
+
+// applyQuickPickConfig registers the quick pick hotkeys (snippet, URL and SSH modifiers+G)
+// when hotkeys.quick_pick is enabled, and unregisters them otherwise
+func applyQuickPickConfig(cfg HotkeyConfig) {
+	quickPickMutex.Lock()
+	defer quickPickMutex.Unlock()
+
+	if !cfg.QuickPick {
+		for _, hk := range quickPickHotkeys {
+			hk.Unregister()
+		}
+		quickPickHotkeys = nil
+		return
+	}
+	if quickPickHotkeys != nil {
+		return
+	}
+
+	getters := []func() ([]hotkey.Modifier, string){getSnippetHotkeyModifiers, getURLHotkeyModifiers, getSSHHotkeyModifiers}
+	var names []string
+	for i, get := range getters {
+		mods, desc := get()
+		hk := hotkey.New(mods, quickPickKey)
+		if err := hk.Register(); err != nil {
+			LogWarn("Failed to register quick pick hotkey %s+G: %v", desc, err)
+			continue
+		}
+		quickPickHotkeys = append(quickPickHotkeys, hk)
+		names = append(names, desc+"+G")
+
+		category := quickPickCategories[i]
+		go func(h *hotkey.Hotkey) {
+			for range h.Keydown() {
+				showQuickPick(category)
+			}
+		}(hk)
+	}
+	LogDebug("Registered quick pick hotkeys: %s", strings.Join(names, ", "))
+}
+
+// showQuickPick lists a category's entries by index and runs the one whose index is typed.
+// A second leader press while the dialog is open is ignored.
+func showQuickPick(category quickPickCategory) {
+	noteUserActivity()
+	if !quickPickOpen.CompareAndSwap(false, true) {
+		return
+	}
+	defer quickPickOpen.Store(false)
+
+	cfg := currentConfig()
+	if cfg == nil {
+		return
+	}
+	items := category.items(cfg)
+	if len(items) == 0 {
+		setStatus(fmt.Sprintf("No %s configured", strings.ToLower(category.title)))
+		return
+	}
+
+	input, ok := QuickPickDialog("Quick Pick: "+category.title, quickPickGrid(items))
+	input = strings.TrimSpace(input)
+	if !ok || input == "" {
+		return
+	}
+	num, err := strconv.Atoi(input)
+	if err != nil || num < 0 {
+		setStatus(fmt.Sprintf("Not an index: %s", input))
+		return
+	}
+	category.pickBy(num)
+}
+
+// quickPickGrid lays out items sorted by index in up to three columns, filled top to bottom
+func quickPickGrid(items []quickPickItem) string {
+	sorted := append([]quickPickItem(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	columns := 1
+	switch {
+	case len(sorted) > 30:
+		columns = 3
+	case len(sorted) > 12:
+		columns = 2
+	}
+	rows := (len(sorted) + columns - 1) / columns
+	digits := len(strconv.Itoa(sorted[len(sorted)-1].Index))
+
+	cells := make([]string, len(sorted))
+	for i, item := range sorted {
+		name := item.Name
+		if r := []rune(name); len(r) > quickPickNameWidth {
+			name = string(r[:quickPickNameWidth-1]) + "…"
+		}
+		cells[i] = fmt.Sprintf("%*d  %s", digits, item.Index, name)
+	}
+
+	width := digits + 2 + quickPickNameWidth
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		for col := 0; col < columns; col++ {
+			i := col*rows + row
+			if i >= len(cells) {
+				break
+			}
+			cell := cells[i]
+			if col < columns-1 && i+rows < len(cells) {
+				cell += strings.Repeat(" ", width-len([]rune(cell))+3)
+			}
+			b.WriteString(cell)
+		}
+		if row < rows-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
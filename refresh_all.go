@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/internal/cache"
+	"krb5tray/pkg/krb"
+)
+
+// refreshAllLead is how close to expiry a value cached by a script must be for Refresh All
+// to run the script again
+const refreshAllLead = 15 * time.Minute
+
+// scriptRun is a script with the ctx it ran with
+type scriptRun struct {
+	script string
+	ctx    map[string]string
+}
+
+// key identifies the run, so a script that cached several values runs again only once
+func (r *scriptRun) key() string {
+	keys := make([]string, 0, len(r.ctx))
+	for k := range r.ctx {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(r.script)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\x00%s=%s", k, r.ctx[k])
+	}
+	return b.String()
+}
+
+var (
+	// cachedValueRunsMutex guards cachedValueRuns
+	cachedValueRunsMutex sync.Mutex
+
+	// cachedValueRuns holds the script run that last cached each JWT ("jwt:<key>") and
+	// value set with ktray.cache_set, by cache key
+	cachedValueRuns = map[string]*scriptRun{}
+
+	mRefreshAll *systray.MenuItem
+)
+
+// trackCachedValue remembers that run cached the value under key
+func trackCachedValue(key string, run *scriptRun) {
+	if run == nil {
+		return
+	}
+	cachedValueRunsMutex.Lock()
+	cachedValueRuns[key] = run
+	cachedValueRunsMutex.Unlock()
+}
+
+// refreshAll renews the TGT, requests a new token for every SPN with a cached token (and the
+// selected one), and runs the scripts again whose cached JWTs and values expire within
+// refreshAllLead. It returns a summary of what was refreshed.
+func refreshAll() (string, error) {
+	if trayIdleLocked() {
+		return "", errIdleLocked
+	}
+	cfg := currentConfig()
+	var parts []string
+	failed := false
+
+	// The mock transport has no TGT to renew
+	if cfg.GetTransport() == krb.TransportMock {
+		parts = append(parts, "no TGT (mock transport)")
+	} else if msg, err := renewAnyTGT("for Refresh All"); errors.Is(err, exec.ErrNotFound) {
+		// Nothing to renew it with; the transport may still have a valid one
+		parts = append(parts, "TGT left as is (no kinit)")
+	} else if err != nil {
+		LogWarn("Refresh All: renewing the TGT failed: %v", err)
+		parts = append(parts, "TGT not renewed")
+		failed = true
+	} else {
+		parts = append(parts, msg)
+	}
+
+	if trayOffline() {
+		parts = append(parts, "offline, no tokens requested")
+		failed = true
+	} else if n, errs := refreshCachedTokens(cfg); n+errs > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d tokens", n, n+errs))
+		failed = failed || errs > 0
+	}
+
+	if n, errs := rerunExpiringScripts(); n+errs > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d scripts", n, n+errs))
+		failed = failed || errs > 0
+	}
+
+	summary := "Refreshed: " + strings.Join(parts, ", ")
+	LogAction("refresh_all", summary)
+	if failed {
+		return summary, errors.New(summary)
+	}
+	return summary, nil
+}
+
+// refreshCachedTokens requests new tokens for the SPNs with a cached token, and the selected
+// SPN, a few at a time. It returns how many were refreshed and how many failed.
+func refreshCachedTokens(cfg *Config) (int, int) {
+	stateMutex.RLock()
+	current := currentSPN
+	stateMutex.RUnlock()
+
+	refreshCacheNamespace(cfg)
+	seen := map[string]bool{}
+	var spns []string
+	if current != "" {
+		seen[current] = true
+	}
+	for _, entry := range GetCache().ListEntries() {
+		if entry.Type != "token" {
+			continue
+		}
+		spn := strings.TrimPrefix(entry.Key, cache.PrefixToken)
+		if !seen[spn] {
+			seen[spn] = true
+			spns = append(spns, spn)
+		}
+	}
+
+	var refreshed, errs atomic.Int32
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.GetPrefetchConfigWithDefaults().Concurrency)
+	for _, spn := range spns {
+		wg.Add(1)
+		go func(spn string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if _, err := getCachedServiceToken(cfg, spn, true); err != nil {
+				LogWarn("Refresh All: token request for %s failed: %v", spn, err)
+				errs.Add(1)
+				return
+			}
+			refreshed.Add(1)
+		}(spn)
+	}
+	wg.Wait()
+
+	// The selected SPN goes through refreshToken, which also updates the menu
+	if current != "" {
+		stateMutex.RLock()
+		before := lastTokenTime
+		stateMutex.RUnlock()
+		refreshToken()
+		stateMutex.RLock()
+		ok := lastTokenTime.After(before)
+		stateMutex.RUnlock()
+		if ok {
+			refreshed.Add(1)
+		} else {
+			errs.Add(1)
+		}
+	}
+	return int(refreshed.Load()), int(errs.Load())
+}
+
+// rerunExpiringScripts runs the scripts again that cached a JWT or value that is gone or
+// expires within refreshAllLead. Their result isn't copied. It returns how many ran and
+// how many failed.
+func rerunExpiringScripts() (int, int) {
+	engine := GetLuaEngine()
+	expires := map[string]time.Time{}
+	for _, entry := range GetCache().ListEntries() {
+		expires[entry.Key] = entry.ExpiresAt
+	}
+
+	cachedValueRunsMutex.Lock()
+	var runs []*scriptRun
+	seen := map[string]bool{}
+	keys := make([]string, 0, len(cachedValueRuns))
+	for key := range cachedValueRuns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		run := cachedValueRuns[key]
+		at, found := expires[key]
+		if found && (at.IsZero() || time.Until(at) > refreshAllLead) {
+			continue
+		}
+		if !seen[run.key()] {
+			seen[run.key()] = true
+			runs = append(runs, run)
+		}
+	}
+	cachedValueRunsMutex.Unlock()
+
+	ran, errs := 0, 0
+	for _, run := range runs {
+		_, err := engine.RunScript(run.script, run.ctx)
+		LogScriptExecuted(run.script, "refresh_all", err)
+		if err != nil {
+			LogWarn("Refresh All: script %s failed: %v", run.script, err)
+			errs++
+			continue
+		}
+		ran++
+	}
+	if ran > 0 {
+		updateCacheMenu()
+	}
+	return ran, errs
+}
+
+func handleRefreshAllClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		noteUserActivity()
+		setStatus("Refreshing everything...")
+		summary, err := refreshAll()
+		switch {
+		case summary == "":
+			setStatusError(fmt.Sprintf("Refresh failed: %s", truncateError(err)))
+			continue
+		case err != nil:
+			setStatusError(summary)
+		default:
+			setStatus(summary)
+		}
+		notifyUser("Refresh All", summary)
+	}
+}
+
+func ctlRefreshAll(args []string) (string, error) {
+	return refreshAll()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestHeadlessRefreshAll requests new tokens for the cached SPNs and runs the script of
+// an expiring JWT again, once
+func TestHeadlessRefreshAll(t *testing.T) {
+	h := newHeadlessTray(t, harnessConfig)
+	h.clickSPN("App")
+	if _, err := getCachedServiceToken(currentConfig(), "HTTP/wiki.example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	app, wiki := h.token(), cachedMockToken(t, "HTTP/wiki.example.com")
+
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"me","exp":%d}`, time.Now().Add(time.Minute).Unix())))
+	jwt := "eyJhbGciOiJub25lIn0." + claims + ".sig"
+	script := fmt.Sprintf(`
+local runs = tonumber(ktray.cache_get("runs") or "0") + 1
+ktray.cache_set("runs", tostring(runs), 3600)
+assert(ktray.jwt_set("short", %q))
+`, jwt)
+	if _, err := h.runScript("short_jwt.lua", script); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := refreshAll()
+	if got := h.token(); got == app || !mockTokenFor("HTTP/app.example.com")(got) {
+		t.Errorf("selected SPN: token %q after %q", got, app)
+	}
+	if got := cachedMockToken(t, "HTTP/wiki.example.com"); got == wiki {
+		t.Errorf("cached SPN: token %q wasn't replaced", got)
+	}
+	if runs, _ := GetCache().Get("runs"); runs != "2" {
+		t.Errorf("script ran %s times, want 2", runs)
+	}
+	if err != nil {
+		t.Errorf("refresh all: %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/internal/httpclient"
+)
+
+// maxRecordedResponseBytes bounds how much of a response body View Response keeps
+const maxRecordedResponseBytes = 1 << 20
+
+// hiddenResponseHeaders are response headers whose values View Response doesn't show
+var hiddenResponseHeaders = map[string]bool{
+	"Set-Cookie":         true,
+	"Www-Authenticate":   true,
+	"Authorization":      true,
+	"Proxy-Authenticate": true,
+}
+
+var mViewResponse *systray.MenuItem
+
+// httpResponseRecord is the last response of a ktray.http_* call or URL entry request
+type httpResponseRecord struct {
+	Source     string // Script or URL entry the request was made for, "" if unknown
+	Method     string
+	URL        string // Without the query string and credentials
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Truncated  bool // Body was cut at maxRecordedResponseBytes
+	At         time.Time
+	Elapsed    time.Duration
+}
+
+// summary describes the response in a line, like "GET api.example.com: 200 OK"
+func (r *httpResponseRecord) summary() string {
+	host := r.URL
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return fmt.Sprintf("%s %s: %s", r.Method, host, r.Status)
+}
+
+var lastResponse struct {
+	mu  sync.Mutex
+	rec *httpResponseRecord
+}
+
+// recordHTTPResponse keeps the response for View Response, replacing the one before
+func recordHTTPResponse(source string, req *http.Request, resp *http.Response, body []byte, elapsed time.Duration) {
+	rec := &httpResponseRecord{
+		Source:     source,
+		Method:     req.Method,
+		URL:        httpclient.RedactURL(req.URL),
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		At:         time.Now(),
+		Elapsed:    elapsed,
+	}
+	if len(body) > maxRecordedResponseBytes {
+		body = body[:maxRecordedResponseBytes]
+		rec.Truncated = true
+	}
+	rec.Body = append([]byte(nil), body...)
+
+	lastResponse.mu.Lock()
+	lastResponse.rec = rec
+	lastResponse.mu.Unlock()
+	updateViewResponseItem()
+}
+
+// lastHTTPResponse returns the recorded response, or nil if there is none
+func lastHTTPResponse() *httpResponseRecord {
+	lastResponse.mu.Lock()
+	defer lastResponse.mu.Unlock()
+	return lastResponse.rec
+}
+
+// clearLastResponse forgets the recorded response and removes the page showing it, since
+// API responses may hold tokens
+func clearLastResponse() {
+	lastResponse.mu.Lock()
+	if lastResponse.rec != nil {
+		zeroBytes(lastResponse.rec.Body)
+		lastResponse.rec = nil
+	}
+	lastResponse.mu.Unlock()
+	_ = os.Remove(responseViewPath())
+	updateViewResponseItem()
+}
+
+// updateViewResponseItem names the recorded response in the View Response item
+func updateViewResponseItem() {
+	if mViewResponse == nil {
+		return
+	}
+	rec := lastHTTPResponse()
+	if rec == nil {
+		mViewResponse.SetTitle("View Response")
+		mViewResponse.SetTooltip("Show the response of the last request made by a script or URL entry")
+		mViewResponse.Disable()
+		return
+	}
+	mViewResponse.SetTitle(fmt.Sprintf("View Response (%s)", truncateString(rec.summary(), 40)))
+	mViewResponse.SetTooltip(fmt.Sprintf("%s %s at %s", rec.Method, rec.URL, rec.At.Format("15:04:05")))
+	mViewResponse.Enable()
+}
+
+// formatResponseBody pretty-prints a JSON body, or the results of query on it if query isn't
+// empty. Other bodies are shown as they are, unless they aren't text.
+func formatResponseBody(body []byte, query string) (string, error) {
+	var input interface{}
+	if err := json.Unmarshal(body, &input); err != nil {
+		if query != "" {
+			return "", fmt.Errorf("the response isn't JSON: %w", err)
+		}
+		if !utf8.Valid(body) {
+			return fmt.Sprintf("(%d bytes of binary data)", len(body)), nil
+		}
+		return string(body), nil
+	}
+	if query == "" {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, body, "", "  "); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	results, err := runJQ(input, query)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(results))
+	for i, v := range results {
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		parts[i] = string(out)
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// responseViewHeaders lists the response headers sorted by name, with the ones that carry
+// credentials hidden
+func responseViewHeaders(h http.Header) []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		for _, value := range h[name] {
+			if hiddenResponseHeaders[http.CanonicalHeaderKey(name)] {
+				value = "(hidden)"
+			}
+			lines = append(lines, name+": "+value)
+		}
+	}
+	return lines
+}
+
+var responseViewTemplate = template.Must(template.New("responseview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>krb5tray response</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; margin: 0; background: #1e1e1e; color: #d4d4d4; }
+header { position: sticky; top: 0; padding: 8px 12px; background: #2d2d2d; border-bottom: 1px solid #444; }
+header span { color: #999; font-size: 12px; margin-left: 12px; }
+button { font-size: 13px; padding: 3px 10px; }
+details { padding: 4px 12px; border-bottom: 1px solid #333; font-size: 12px; color: #999; }
+pre { margin: 0; padding: 8px 12px; font: 12px/1.4 Menlo, Consolas, monospace; white-space: pre-wrap; word-break: break-all; }
+.ok { color: #89d185; }
+.error { color: #f48771; }
+.note { color: #dcdcaa; }
+</style>
+</head>
+<body>
+<header>
+<button onclick="copyBody()">Copy</button>
+<span class="{{if lt .StatusCode 400}}ok{{else}}error{{end}}">{{.Status}}</span>
+<span>{{.Method}} {{.URL}}{{if .Source}} &mdash; {{.Source}}{{end}} &mdash; {{.Elapsed}} at {{.At}}</span>
+<span id="copied"></span>
+</header>
+<details><summary>{{len .Headers}} headers</summary><pre>{{range .Headers}}{{.}}
+{{end}}</pre></details>
+{{if .Query}}<pre class="note">jq {{.Query}}</pre>{{end}}
+{{if .Truncated}}<pre class="note">Only the first {{.Kept}} bytes of the response were kept</pre>{{end}}
+<pre id="body">{{.Body}}</pre>
+<script>
+function copyBody() {
+  var text = document.getElementById("body").innerText;
+  var done = function() { document.getElementById("copied").textContent = "Copied"; };
+  if (navigator.clipboard && window.isSecureContext) {
+    navigator.clipboard.writeText(text).then(done);
+    return;
+  }
+  var ta = document.createElement("textarea");
+  ta.value = text;
+  document.body.appendChild(ta);
+  ta.select();
+  document.execCommand("copy");
+  document.body.removeChild(ta);
+  done();
+}
+</script>
+</body>
+</html>
+`))
+
+// renderResponseView renders the response as an HTML page, its body filtered by query
+func renderResponseView(rec *httpResponseRecord, query string) ([]byte, error) {
+	body, err := formatResponseBody(rec.Body, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = responseViewTemplate.Execute(&buf, struct {
+		Source     string
+		Method     string
+		URL        string
+		Status     string
+		StatusCode int
+		At         string
+		Elapsed    string
+		Headers    []string
+		Query      string
+		Truncated  bool
+		Kept       int
+		Body       string
+	}{
+		Source:     rec.Source,
+		Method:     rec.Method,
+		URL:        rec.URL,
+		Status:     rec.Status,
+		StatusCode: rec.StatusCode,
+		At:         rec.At.Format("15:04:05"),
+		Elapsed:    rec.Elapsed.Round(time.Millisecond).String(),
+		Headers:    responseViewHeaders(rec.Header),
+		Query:      query,
+		Truncated:  rec.Truncated,
+		Kept:       maxRecordedResponseBytes,
+		Body:       body,
+	})
+	return buf.Bytes(), err
+}
+
+// responseViewPath is where the page showing the last response is written
+func responseViewPath() string {
+	return filepath.Join(ConfigDir(), "response-view.html")
+}
+
+// openResponseViewer writes the last response to an HTML page and opens it. It returns the
+// response's summary.
+func openResponseViewer(query string) (string, error) {
+	rec := lastHTTPResponse()
+	if rec == nil {
+		return "", fmt.Errorf("no response recorded yet")
+	}
+
+	page, err := renderResponseView(rec, query)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(responseViewPath(), page, 0600); err != nil {
+		return "", err
+	}
+	if err := openBrowser(fileURL(responseViewPath())); err != nil {
+		return "", err
+	}
+	return rec.summary(), nil
+}
+
+func viewResponse() {
+	summary, err := openResponseViewer("")
+	if err != nil {
+		LogError("Failed to open response viewer: %v", err)
+		setStatusError(fmt.Sprintf("View response failed: %v", truncateError(err)))
+		return
+	}
+	setStatus("Opened response: " + summary)
+}
+
+// ctlViewResponse opens the last response, filtered by the jq query if one is given
+func ctlViewResponse(args []string) (string, error) {
+	summary, err := openResponseViewer(strings.Join(args, " "))
+	if err != nil {
+		return "", err
+	}
+	return "Opened response: " + summary, nil
+}
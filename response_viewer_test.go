@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeadlessViewResponse(t *testing.T) {
+	newHeadlessTray(t, harnessConfig)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret"})
+		_, _ = fmt.Fprint(w, `{"items":[{"name":"a"},{"name":"b"}]}`)
+	}))
+	defer server.Close()
+
+	if _, err := httpGet(server.URL+"/api?key=abc", nil, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	rec := lastHTTPResponse()
+	if rec == nil || rec.StatusCode != 200 || strings.Contains(rec.URL, "key=abc") {
+		t.Fatalf("recorded = %+v", rec)
+	}
+
+	page, err := renderResponseView(rec, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), "\n  &#34;items&#34;: [") || strings.Contains(string(page), "s3cret") {
+		t.Errorf("page doesn't show the indented body without the cookie:\n%s", page)
+	}
+	if got, err := formatResponseBody(rec.Body, ".items[].name"); err != nil || got != "\"a\"\n\"b\"" {
+		t.Errorf("jq output = %q, %v", got, err)
+	}
+
+	clearLastResponse()
+	if lastHTTPResponse() != nil {
+		t.Error("response kept after clearing")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// restartEnv marks a tray started by a restart, so it restores the saved selection
+const restartEnv = "KRB5TRAY_RESTARTED"
+
+// restartDelay lets a ctl client read its response before the tray goes away
+const restartDelay = 200 * time.Millisecond
+
+// restartRequested makes onExit start the binary again once shutdown is done
+var restartRequested atomic.Bool
+
+// restartState is what survives a restart, besides what the config and cache already restore
+type restartState struct {
+	SPN     string `json:"spn,omitempty"`
+	SPNName string `json:"spn_name,omitempty"`
+}
+
+func restartStatePath() string {
+	return filepath.Join(ConfigDir(), "restart_state.json")
+}
+
+// restartTray saves the current selection and quits; onExit then re-executes the binary,
+// which picks up a new config or an updated executable
+func restartTray() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// An update may be replacing the binary; don't exit if there's nothing to start
+	if _, err := os.Stat(exe); err != nil {
+		return fmt.Errorf("cannot restart: %w", err)
+	}
+
+	stateMutex.RLock()
+	state := restartState{SPN: currentSPN, SPNName: currentSPNName}
+	stateMutex.RUnlock()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(restartStatePath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	LogInfo("Restarting %s", exe)
+	restartRequested.Store(true)
+	systray.Quit()
+	return nil
+}
+
+// relaunchTray starts the binary again at the end of shutdown, handing the single-instance
+// lock to it. It reports whether the lock was handed over; if not the caller releases it.
+// The running signing settings go along, so a restart can't load a config a reload would refuse.
+func relaunchTray() bool {
+	exe, err := os.Executable()
+	if err == nil {
+		env := []string{restartEnv + "=1"}
+		if pin := signingPin(currentConfig().GetSigningConfigWithDefaults()); pin != "" {
+			env = append(env, pin)
+		}
+		err = execTray(exe, append(withoutEnv(os.Environ(), signingPinEnv), env...))
+	}
+	if err != nil {
+		LogError("Restart failed: %v", err)
+		_ = os.Remove(restartStatePath())
+		return false
+	}
+	return true
+}
+
+// withoutEnv drops the entries for name from env
+func withoutEnv(env []string, name string) []string {
+	kept := env[:0:0]
+	for _, e := range env {
+		if !strings.HasPrefix(e, name+"=") {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// restoreRestartState selects the SPN that was selected before a restart
+func restoreRestartState() {
+	if os.Getenv(restartEnv) == "" {
+		return
+	}
+	_ = os.Unsetenv(restartEnv)
+
+	data, err := os.ReadFile(restartStatePath())
+	_ = os.Remove(restartStatePath())
+	if err != nil {
+		LogWarn("Restarted without saved state: %v", err)
+		return
+	}
+	var state restartState
+	if err := json.Unmarshal(data, &state); err != nil {
+		LogWarn("Ignoring saved state: %v", err)
+		return
+	}
+	LogInfo("Restarted")
+	if state.SPN != "" {
+		setSPN(state.SPN, state.SPNName)
+	}
+}
+
+func handleRestartClick() {
+	for range mRestart.ClickedCh {
+		if err := restartTray(); err != nil {
+			LogError("Restart failed: %v", err)
+			setStatusError(fmt.Sprintf("Restart failed: %s", truncateError(err)))
+		}
+	}
+}
+
+func ctlRestart(args []string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(exe); err != nil {
+		return "", fmt.Errorf("cannot restart: %w", err)
+	}
+	time.AfterFunc(restartDelay, func() {
+		if err := restartTray(); err != nil {
+			LogError("Restart failed: %v", err)
+		}
+	})
+	return "Restarting", nil
+}
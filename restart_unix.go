@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// execTray replaces this process with a new tray, which keeps the PID (so launchd and
+// systemd still track it) and inherits the single-instance lock
+func execTray(exe string, env []string) error {
+	lockEnv, err := handOverSingleInstance()
+	if err != nil {
+		return err
+	}
+	if lockEnv != "" {
+		env = append(env, lockEnv)
+	}
+	return syscall.Exec(exe, []string{exe}, env)
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os/exec"
+
+// execTray starts a new tray process. The mutex is released first, since it can't be
+// passed to another process; this one exits as soon as onExit returns.
+func execTray(exe string, env []string) error {
+	ReleaseSingleInstance()
+	cmd := exec.Command(exe)
+	cmd.Env = env
+	return cmd.Start()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// scpProgress is called as bytes are copied, with the total size of the file
+type scpProgress func(done int64, total int64)
+
+// scpProgressWriter reports the running byte count of writes through it
+type scpProgressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress scpProgress
+}
+
+func (p *scpProgressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if p.progress != nil {
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
+
+// scpDownload copies a single remote file into w using the server's "scp -f" sink protocol
+func scpDownload(client *ssh.Client, remotePath string, w io.Writer, progress scpProgress) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start("scp -f " + shellQuote(remotePath)); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(stdout)
+
+	// A single zero byte asks the source for the next file
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	var size int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("no reply from remote scp: %w", scpSessionError(session, err))
+		}
+		switch line[0] {
+		case 1, 2:
+			return fmt.Errorf("remote: %s", strings.TrimSpace(line[1:]))
+		case 'T':
+			// Timestamps precede the file when the source preserves them
+			if _, err := stdin.Write([]byte{0}); err != nil {
+				return err
+			}
+			continue
+		case 'D':
+			return fmt.Errorf("%s is a directory", remotePath)
+		case 'C':
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+			if len(fields) != 3 {
+				return fmt.Errorf("invalid scp header %q", strings.TrimSpace(line))
+			}
+			size, err = strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid scp file size %q", fields[1])
+			}
+		default:
+			return fmt.Errorf("unexpected scp reply %q", strings.TrimSpace(line))
+		}
+		break
+	}
+
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(0, size)
+	}
+	dst := &scpProgressWriter{w: w, total: size, progress: progress}
+	if _, err := io.CopyN(dst, reader, size); err != nil {
+		return fmt.Errorf("transfer interrupted: %w", err)
+	}
+	if err := readSCPAck(reader); err != nil {
+		return err
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	stdin.Close()
+	return session.Wait()
+}
+
+// scpUpload copies size bytes from r to remotePath using the server's "scp -t" source protocol.
+// name is the file name sent to the server, used when remotePath is a directory.
+func scpUpload(client *ssh.Client, remotePath string, name string, mode uint32, size int64, r io.Reader, progress scpProgress) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start("scp -t " + shellQuote(remotePath)); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(stdout)
+
+	if err := readSCPAck(reader); err != nil {
+		return scpSessionError(session, err)
+	}
+	if _, err := fmt.Fprintf(stdin, "C%04o %d %s\n", mode&0777, size, name); err != nil {
+		return err
+	}
+	if err := readSCPAck(reader); err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(0, size)
+	}
+	dst := &scpProgressWriter{w: stdin, total: size, progress: progress}
+	if _, err := io.CopyN(dst, r, size); err != nil {
+		return fmt.Errorf("transfer interrupted: %w", err)
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	if err := readSCPAck(reader); err != nil {
+		return err
+	}
+	stdin.Close()
+	return session.Wait()
+}
+
+// readSCPAck reads a status byte: 0 is OK, 1 and 2 are followed by an error message
+func readSCPAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		msg = fmt.Sprintf("scp status %d", b)
+	}
+	return fmt.Errorf("remote: %s", msg)
+}
+
+// scpSessionError prefers the remote command's exit status (e.g. scp not installed) when
+// its output ended early
+func scpSessionError(session *ssh.Session, err error) error {
+	if err != io.EOF {
+		return err
+	}
+	if waitErr := session.Wait(); waitErr != nil {
+		if exitErr, ok := waitErr.(*ssh.ExitError); ok && exitErr.ExitStatus() == 127 {
+			return fmt.Errorf("scp not found on the server")
+		}
+		return waitErr
+	}
+	return err
+}
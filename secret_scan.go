@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Values of policy.snippet_secrets
+const (
+	snippetSecretsWarn  = "warn"  // Log and notify, but copy the snippet (default)
+	snippetSecretsBlock = "block" // Refuse to copy or type the snippet
+	snippetSecretsOff   = "off"   // Don't scan snippets
+)
+
+// credentialPatterns recognize well-known credential formats in snippet values
+var credentialPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"a private key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{"an AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{"an AWS secret key", regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}[A-Za-z0-9/+=]{40}`)},
+	{"a GitHub token", regexp.MustCompile(`\b(?:gh[opsur]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"a JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+}
+
+// base64Run finds candidates for long base64 strings, which credentialKind then checks
+var base64Run = regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`)
+
+// credentialKind describes what value looks like if it holds a raw credential, e.g.
+// "an AWS access key", and returns "" otherwise
+func credentialKind(value string) string {
+	for _, p := range credentialPatterns {
+		if p.re.MatchString(value) {
+			return p.kind
+		}
+	}
+	for _, run := range base64Run.FindAllString(value, -1) {
+		if looksRandom(run) {
+			return "a long base64 string"
+		}
+	}
+	return ""
+}
+
+// looksRandom reports whether a base64 run mixes upper and lower case letters and digits
+// as encoded keys do, rather than being a path or identifier with a few separators
+func looksRandom(run string) bool {
+	var upper, lower, digits, separators int
+	for _, r := range run {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsDigit(r):
+			digits++
+		case r == '/' || r == '-' || r == '_':
+			separators++
+		}
+	}
+	return upper >= 4 && lower >= 4 && digits >= 4 && separators*10 < len(run)
+}
+
+// GetSnippetSecretsPolicy returns policy.snippet_secrets, "warn" by default
+func (c *Config) GetSnippetSecretsPolicy() string {
+	if c == nil || c.Policy == nil || c.Policy.SnippetSecrets == "" {
+		return snippetSecretsWarn
+	}
+	return c.Policy.SnippetSecrets
+}
+
+// snippetCredential returns what entry's value looks like if it is a raw credential the
+// policy scans for, and "" otherwise. Its shell variants are scanned as well, and scripted
+// snippets too, since the value is handed to the script.
+func snippetCredential(cfg *Config, entry SnippetEntry) string {
+	if cfg.GetSnippetSecretsPolicy() == snippetSecretsOff {
+		return ""
+	}
+	for _, value := range snippetValues(entry) {
+		if kind := credentialKind(value); kind != "" {
+			return kind
+		}
+	}
+	return ""
+}
+
+// snippetBlocked reports whether the policy forbids copying entry
+func snippetBlocked(cfg *Config, entry SnippetEntry) bool {
+	return cfg.GetSnippetSecretsPolicy() == snippetSecretsBlock && snippetCredential(cfg, entry) != ""
+}
+
+// warnSnippetSecrets logs the snippets that hold what looks like a credential and shows
+// one notification for them, after the config is loaded
+func warnSnippetSecrets(cfg *Config) {
+	if cfg == nil {
+		return
+	}
+	var names []string
+	for _, entry := range cfg.Snippets {
+		if kind := snippetCredential(cfg, entry); kind != "" {
+			LogWarn("Snippet %q looks like it holds %s; keep credentials in secrets instead", entry.Name, kind)
+			names = append(names, entry.Name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	title := "Credentials in snippets"
+	message := fmt.Sprintf("%s look like raw credentials. Keep them in secrets or the keychain instead of plaintext snippets.", strings.Join(names, ", "))
+	if cfg.GetSnippetSecretsPolicy() == snippetSecretsBlock {
+		title = "Snippets blocked"
+		message = fmt.Sprintf("%s look like raw credentials and won't be copied (policy.snippet_secrets is \"block\").", strings.Join(names, ", "))
+	}
+	notifyUser(title, message)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// lockMaxAttempts wrong PINs in a row disable PIN entry for lockBackoff
+	lockMaxAttempts = 5
+	lockBackoff     = 30 * time.Second
+)
+
+// errBiometricUnavailable means there's no Touch ID or Windows Hello to ask, or the user
+// chose to enter the PIN instead
+var errBiometricUnavailable = errors.New("biometric authentication is not available")
+
+// secretsLock tracks whether secrets are unlocked. Unlocking is serialized, so clicks
+// made while a prompt is open don't open more prompts.
+var secretsLock struct {
+	prompt sync.Mutex // Held while asking the user
+
+	mu           sync.Mutex
+	unlocked     bool
+	lastUse      time.Time
+	failures     int
+	blockedUntil time.Time
+	relockTimer  *time.Timer
+}
+
+// mLockSecrets locks the secrets right away; it's shown under Secrets when the lock is enabled
+var mLockSecrets *systray.MenuItem
+
+// unlockSecrets returns nil if secrets may be used: the lock is disabled, it was unlocked
+// recently, or the user authenticates now. reason is shown in the prompt.
+func unlockSecrets(reason string) error {
+	if trayIdleLocked() {
+		return errIdleLocked
+	}
+	if err := requireSecurityKey(securityKeySecrets, reason); err != nil {
+		return err
+	}
+	cfg := currentConfig().GetLockConfigWithDefaults()
+	if !cfg.Enabled {
+		return nil
+	}
+	if touchSecretsUnlock(cfg) {
+		return nil
+	}
+
+	secretsLock.prompt.Lock()
+	defer secretsLock.prompt.Unlock()
+
+	// Another click may have unlocked while this one waited
+	if touchSecretsUnlock(cfg) {
+		return nil
+	}
+	if err := authenticateUser(cfg, "Unlock Secrets", reason); err != nil {
+		return err
+	}
+
+	setSecretsUnlocked(cfg)
+	LogInfo("Secrets unlocked")
+	return nil
+}
+
+// authenticateUser asks for biometrics or the PIN from cfg, whichever is configured and
+// available. The caller holds secretsLock.prompt.
+func authenticateUser(cfg LockConfig, title string, reason string) error {
+	if cfg.Biometric {
+		ok, err := authenticateBiometric(reason)
+		switch {
+		case ok:
+			LogDebug("Authenticated with biometrics")
+			return nil
+		case err == nil:
+			return fmt.Errorf("authentication cancelled")
+		case cfg.PINHash == "":
+			return err
+		}
+		LogDebug("Biometric unlock unavailable, asking for the PIN: %v", err)
+	}
+	if cfg.PINHash == "" {
+		return fmt.Errorf("no pin_hash configured")
+	}
+
+	secretsLock.mu.Lock()
+	wait := time.Until(secretsLock.blockedUntil)
+	secretsLock.mu.Unlock()
+	if wait > 0 {
+		return fmt.Errorf("too many wrong PINs, try again in %ds", int(wait.Seconds())+1)
+	}
+
+	pin, ok := PromptForInput(title, reason, "", true)
+	if !ok {
+		return fmt.Errorf("authentication cancelled")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(cfg.PINHash), []byte(pin)); err != nil {
+		secretsLock.mu.Lock()
+		secretsLock.failures++
+		if secretsLock.failures >= lockMaxAttempts {
+			secretsLock.failures = 0
+			secretsLock.blockedUntil = time.Now().Add(lockBackoff)
+		}
+		secretsLock.mu.Unlock()
+		LogWarn("Wrong PIN entered")
+		return fmt.Errorf("wrong PIN")
+	}
+
+	secretsLock.mu.Lock()
+	secretsLock.failures = 0
+	secretsLock.mu.Unlock()
+	return nil
+}
+
+// touchSecretsUnlock reports whether secrets are unlocked and not idle for too long, and
+// counts this as a use
+func touchSecretsUnlock(cfg LockConfig) bool {
+	secretsLock.mu.Lock()
+	defer secretsLock.mu.Unlock()
+
+	idle := time.Duration(cfg.IdleSec) * time.Second
+	if !secretsLock.unlocked || time.Since(secretsLock.lastUse) >= idle {
+		return false
+	}
+	secretsLock.lastUse = time.Now()
+	secretsLock.relockTimer.Reset(idle)
+	return true
+}
+
+func setSecretsUnlocked(cfg LockConfig) {
+	secretsLock.mu.Lock()
+	idle := time.Duration(cfg.IdleSec) * time.Second
+	secretsLock.unlocked = true
+	secretsLock.lastUse = time.Now()
+	if secretsLock.relockTimer == nil {
+		secretsLock.relockTimer = time.AfterFunc(idle, func() { lockSecrets("idle") })
+	} else {
+		secretsLock.relockTimer.Reset(idle)
+	}
+	secretsLock.mu.Unlock()
+
+	updateLockMenu()
+}
+
+// lockSecrets locks the secrets until the user authenticates again
+func lockSecrets(why string) {
+	secretsLock.mu.Lock()
+	wasUnlocked := secretsLock.unlocked
+	secretsLock.unlocked = false
+	if secretsLock.relockTimer != nil {
+		secretsLock.relockTimer.Stop()
+	}
+	secretsLock.mu.Unlock()
+
+	if wasUnlocked {
+		LogInfo("Secrets locked (%s)", why)
+	}
+	updateLockMenu()
+}
+
+// updateLockMenu shows the "Lock Secrets" item when the lock is enabled, enabled only
+// while the secrets are unlocked
+func updateLockMenu() {
+	if mLockSecrets == nil {
+		return
+	}
+	if !currentConfig().GetLockConfigWithDefaults().Enabled {
+		mLockSecrets.Hide()
+		return
+	}
+	secretsLock.mu.Lock()
+	unlocked := secretsLock.unlocked
+	secretsLock.mu.Unlock()
+	if unlocked {
+		mLockSecrets.SetTitle("Lock Secrets")
+		mLockSecrets.Enable()
+	} else {
+		mLockSecrets.SetTitle("Secrets Locked")
+		mLockSecrets.Disable()
+	}
+	mLockSecrets.Show()
+}
+
+func handleLockSecretsClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		lockSecrets("locked from the menu")
+		setStatus("Secrets locked")
+	}
+}
+
+func ctlLockSecrets(args []string) (string, error) {
+	if !currentConfig().GetLockConfigWithDefaults().Enabled {
+		return "", fmt.Errorf("secrets_lock is not enabled")
+	}
+	lockSecrets("locked with ctl")
+	return "Secrets locked", nil
+}
+
+// runHashPINCommand reads a PIN and prints its bcrypt hash for secrets_lock.pin_hash
+func runHashPINCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) > 0 {
+		_, _ = fmt.Fprintln(stderr, "usage: krb5tray hash-pin")
+		return exitUsage
+	}
+
+	var pin string
+	var err error
+	if fd := int(os.Stdin.Fd()); isTerminal(fd) {
+		_, _ = fmt.Fprint(stderr, "PIN: ")
+		pin, err = readTermPassword(fd)
+		_, _ = fmt.Fprintln(stderr)
+	} else {
+		pin, err = readSecretLine(os.Stdin)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	if strings.TrimSpace(pin) == "" {
+		_, _ = fmt.Fprintln(stderr, "krb5tray: empty PIN")
+		return exitUsage
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	_, _ = fmt.Fprintln(stdout, string(hash))
+	return exitOK
+}
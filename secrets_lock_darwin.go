@@ -0,0 +1,66 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Foundation -framework LocalAuthentication
+
+#import <Foundation/Foundation.h>
+#import <LocalAuthentication/LocalAuthentication.h>
+#include <stdlib.h>
+
+// authenticateTouchID asks for Touch ID with reason shown in the dialog.
+// Returns 1 if the user was verified, 0 if they cancelled or failed, and -1 if Touch ID
+// isn't available or the user chose the fallback button (enter the PIN instead).
+static int authenticateTouchID(const char *reason, int allowFallback) {
+    @autoreleasepool {
+        LAContext *context = [[LAContext alloc] init];
+        context.localizedFallbackTitle = allowFallback ? @"Enter PIN" : @"";
+
+        NSError *error = nil;
+        if (![context canEvaluatePolicy:LAPolicyDeviceOwnerAuthenticationWithBiometrics error:&error]) {
+            return -1;
+        }
+
+        __block int result = 0;
+        dispatch_semaphore_t done = dispatch_semaphore_create(0);
+        [context evaluatePolicy:LAPolicyDeviceOwnerAuthenticationWithBiometrics
+                localizedReason:[NSString stringWithUTF8String:reason]
+                          reply:^(BOOL success, NSError *err) {
+            if (success) {
+                result = 1;
+            } else if (err != nil && (err.code == LAErrorUserFallback || err.code == LAErrorBiometryLockout)) {
+                result = -1;
+            }
+            dispatch_semaphore_signal(done);
+        }];
+        dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+        return result;
+    }
+}
+*/
+import "C"
+
+import "unsafe"
+
+// authenticateBiometric asks for Touch ID. It returns errBiometricUnavailable when there's
+// no sensor, it's locked out, or the user picked "Enter PIN"; false with no error means
+// the user cancelled.
+func authenticateBiometric(reason string) (bool, error) {
+	creason := C.CString(reason)
+	defer C.free(unsafe.Pointer(creason))
+
+	allowFallback := C.int(0)
+	if currentConfig().GetLockConfigWithDefaults().PINHash != "" {
+		allowFallback = 1
+	}
+	switch C.authenticateTouchID(creason, allowFallback) {
+	case 1:
+		return true, nil
+	case -1:
+		return false, errBiometricUnavailable
+	}
+	return false, nil
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package main
+
+// authenticateBiometric is only available with Touch ID and Windows Hello
+func authenticateBiometric(reason string) (bool, error) {
+	return false, errBiometricUnavailable
+}
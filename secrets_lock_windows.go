@@ -0,0 +1,50 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// helloScript asks Windows Hello to verify the user through the WinRT UserConsentVerifier,
+// exiting 0 if verified, 1 if not, and 2 if Windows Hello isn't set up. The reason is
+// passed in the environment so it needs no quoting.
+const helloScript = `
+Add-Type -AssemblyName System.Runtime.WindowsRuntime
+$asTask = [System.WindowsRuntimeSystemExtensions].GetMethods() | Where-Object {
+  $_.Name -eq 'AsTask' -and $_.GetParameters().Count -eq 1 -and $_.GetParameters()[0].ParameterType.Name -eq 'IAsyncOperation` + "`" + `1'
+} | Select-Object -First 1
+function Await($op, [Type]$type) {
+  $task = $asTask.MakeGenericMethod($type).Invoke($null, @($op))
+  $task.Wait() | Out-Null
+  $task.Result
+}
+$verifier = [Windows.Security.Credentials.UI.UserConsentVerifier, Windows.Security.Credentials.UI, ContentType = WindowsRuntime]
+$available = Await ($verifier::CheckAvailabilityAsync()) ([Windows.Security.Credentials.UI.UserConsentVerifierAvailability])
+if ($available -ne 'Available') { exit 2 }
+$result = Await ($verifier::RequestVerificationAsync($env:KRB5TRAY_UNLOCK_REASON)) ([Windows.Security.Credentials.UI.UserConsentVerificationResult])
+if ($result -eq 'Verified') { exit 0 }
+exit 1
+`
+
+// authenticateBiometric asks Windows Hello (fingerprint, face, or the Hello PIN). It
+// returns errBiometricUnavailable if Hello isn't set up; false with no error means the
+// user cancelled or wasn't verified.
+func authenticateBiometric(reason string) (bool, error) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", helloScript)
+	cmd.Env = append(os.Environ(), "KRB5TRAY_UNLOCK_REASON="+reason)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, errBiometricUnavailable
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSecurityKeyRPID is the relying party ID credentials are made for
+	DefaultSecurityKeyRPID = "krb5tray"
+
+	// securityKeyTimeout is how long the key waits for a touch
+	securityKeyTimeout = 30 * time.Second
+)
+
+// Operations that can require a security key touch
+const (
+	securityKeySecrets = "secrets"
+	securityKeyTokens  = "tokens"
+)
+
+// securityKeyOperations lists every operation, which is also the default for require
+var securityKeyOperations = []string{securityKeySecrets, securityKeyTokens}
+
+// errNoSecurityKey means fido2-token lists no FIDO2 device
+var errNoSecurityKey = errors.New("no security key found")
+
+// securityKeyState serializes touches, so operations started while the key is blinking
+// wait for that touch instead of asking for another one
+var securityKeyState struct {
+	prompt sync.Mutex
+
+	mu        sync.Mutex
+	lastTouch time.Time
+}
+
+// requireSecurityKey returns nil if operation may go ahead: security_key doesn't require it,
+// a touch within grace_sec covers it, or the user touches the key now. reason is shown
+// while the key waits.
+func requireSecurityKey(operation string, reason string) error {
+	cfg := currentConfig().GetSecurityKeyConfigWithDefaults()
+	if cfg.Credential == "" || !containsString(cfg.Require, operation) {
+		return nil
+	}
+	if securityKeyTouchedRecently(cfg) {
+		return nil
+	}
+
+	securityKeyState.prompt.Lock()
+	defer securityKeyState.prompt.Unlock()
+	if securityKeyTouchedRecently(cfg) {
+		return nil
+	}
+
+	setStatus("Touch your security key...")
+	notifyUser("Touch your security key", reason)
+	if err := assertSecurityKey(cfg); err != nil {
+		LogWarn("Security key check for %s failed: %v", operation, err)
+		return fmt.Errorf("security key: %w", err)
+	}
+	LogActionWithFields("security_key", fmt.Sprintf("Security key touched: %s", reason), map[string]interface{}{
+		"operation": operation,
+	})
+
+	securityKeyState.mu.Lock()
+	securityKeyState.lastTouch = time.Now()
+	securityKeyState.mu.Unlock()
+	return nil
+}
+
+func securityKeyTouchedRecently(cfg SecurityKeyConfig) bool {
+	if cfg.GraceSec <= 0 {
+		return false
+	}
+	securityKeyState.mu.Lock()
+	defer securityKeyState.mu.Unlock()
+	return !securityKeyState.lastTouch.IsZero() && time.Since(securityKeyState.lastTouch) < time.Duration(cfg.GraceSec)*time.Second
+}
+
+// forgetSecurityKeyTouch makes the next operation ask for a touch, even within grace_sec
+func forgetSecurityKeyTouch() {
+	securityKeyState.mu.Lock()
+	securityKeyState.lastTouch = time.Time{}
+	securityKeyState.mu.Unlock()
+}
+
+// assertSecurityKey has the key sign a random challenge with the enrolled credential,
+// requiring a touch, and checks the signature against the enrolled public key. The key is
+// driven with fido2-assert from libfido2, so nothing has to be linked in.
+func assertSecurityKey(cfg SecurityKeyConfig) error {
+	publicKey, err := parseSecurityKeyPublicKey(cfg.PublicKey)
+	if err != nil {
+		return fmt.Errorf("public_key: %w", err)
+	}
+	device, err := securityKeyDevice(cfg)
+	if err != nil {
+		return err
+	}
+
+	clientDataHash := make([]byte, 32)
+	if _, err := rand.Read(clientDataHash); err != nil {
+		return err
+	}
+	input := strings.Join([]string{
+		base64.StdEncoding.EncodeToString(clientDataHash),
+		cfg.RPID,
+		cfg.Credential,
+	}, "\n") + "\n"
+
+	output, err := runFIDO2Tool(strings.NewReader(input), "fido2-assert", "-G", "-p", device)
+	if err != nil {
+		return err
+	}
+	// Client data hash, relying party ID, authenticator data and signature, one per line
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 4 {
+		return fmt.Errorf("unexpected fido2-assert output")
+	}
+	authData, err := decodeFIDO2Blob(lines[2], true)
+	if err != nil {
+		return fmt.Errorf("authenticator data: %w", err)
+	}
+	signature, err := decodeFIDO2Blob(lines[3], false)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	return verifySecurityKeyAssertion(publicKey, cfg.RPID, clientDataHash, authData, signature)
+}
+
+// verifySecurityKeyAssertion checks that authData is for rpID with the user present and
+// that signature covers it and clientDataHash
+func verifySecurityKeyAssertion(publicKey *ecdsa.PublicKey, rpID string, clientDataHash []byte, authData []byte, signature []byte) error {
+	// RP ID hash (32 bytes), flags (1), signature counter (4)
+	if len(authData) < 37 {
+		return fmt.Errorf("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if subtle.ConstantTimeCompare(authData[:32], rpIDHash[:]) != 1 {
+		return fmt.Errorf("assertion is for another relying party")
+	}
+	if authData[32]&0x01 == 0 {
+		return fmt.Errorf("key wasn't touched")
+	}
+	signed := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash...))
+	if !ecdsa.VerifyASN1(publicKey, signed[:], signature) {
+		return fmt.Errorf("signature doesn't match the enrolled public key")
+	}
+	return nil
+}
+
+// decodeFIDO2Blob decodes a base64 line of fido2-assert output. libfido2 prints the
+// authenticator data as a CBOR byte string, whose header is removed when cbor is set.
+func decodeFIDO2Blob(line string, cbor bool) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil || !cbor {
+		return data, err
+	}
+	if len(data) == 0 || data[0]>>5 != 2 {
+		return nil, fmt.Errorf("not a CBOR byte string")
+	}
+	var length, header int
+	switch info := int(data[0] & 0x1f); {
+	case info < 24:
+		length, header = info, 1
+	case info == 24 && len(data) >= 2:
+		length, header = int(data[1]), 2
+	case info == 25 && len(data) >= 3:
+		length, header = int(data[1])<<8|int(data[2]), 3
+	default:
+		return nil, fmt.Errorf("unsupported CBOR length")
+	}
+	if len(data) != header+length {
+		return nil, fmt.Errorf("CBOR length mismatch")
+	}
+	return data[header:], nil
+}
+
+// parseSecurityKeyPublicKey parses the PEM public key printed by enroll-security-key
+func parseSecurityKeyPublicKey(text string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return nil, fmt.Errorf("not PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ES256 key")
+	}
+	return ecKey, nil
+}
+
+// securityKeyDevice returns the configured device, or the first one fido2-token lists
+func securityKeyDevice(cfg SecurityKeyConfig) (string, error) {
+	if cfg.Device != "" {
+		return cfg.Device, nil
+	}
+	output, err := runFIDO2Tool(nil, "fido2-token", "-L")
+	if err != nil {
+		return "", err
+	}
+	// "/dev/hidraw3: vendor=0x1050, product=0x0407 (Yubico YubiKey OTP+FIDO+CCID)"; macOS
+	// paths ("ioreg://4294969541") contain a colon too, so split at ": "
+	for _, line := range strings.Split(output, "\n") {
+		if path, _, ok := strings.Cut(strings.TrimSpace(line), ": "); ok && path != "" {
+			return path, nil
+		}
+	}
+	return "", errNoSecurityKey
+}
+
+// runFIDO2Tool runs one of the libfido2 command line tools and returns its output
+func runFIDO2Tool(stdin io.Reader, name string, args ...string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found (install libfido2's tools)", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), securityKeyTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("timed out waiting for the security key")
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", name, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
+
+// runEnrollSecurityKeyCommand makes a credential on a security key and prints the
+// security_key config section that uses it
+func runEnrollSecurityKeyCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	cfg := SecurityKeyConfig{RPID: DefaultSecurityKeyRPID}
+	switch len(args) {
+	case 0:
+	case 1:
+		cfg.Device = args[0]
+	default:
+		_, _ = fmt.Fprintln(stderr, "usage: krb5tray enroll-security-key [device]")
+		return exitUsage
+	}
+	device, err := securityKeyDevice(cfg)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+
+	clientDataHash := make([]byte, 32)
+	userID := make([]byte, 32)
+	if _, err := rand.Read(clientDataHash); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	if _, err := rand.Read(userID); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	input := strings.Join([]string{
+		base64.StdEncoding.EncodeToString(clientDataHash),
+		cfg.RPID,
+		"krb5tray",
+		base64.StdEncoding.EncodeToString(userID),
+	}, "\n") + "\n"
+
+	_, _ = fmt.Fprintf(stderr, "Touch the security key (%s)...\n", device)
+	made, err := runFIDO2Tool(strings.NewReader(input), "fido2-cred", "-M", device, "es256")
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	// fido2-cred -V checks the attestation and prints the credential ID and public key
+	verified, err := runFIDO2Tool(strings.NewReader(made), "fido2-cred", "-V", "es256")
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	credential, publicKey, ok := strings.Cut(verified, "\n")
+	if !ok {
+		_, _ = fmt.Fprintln(stderr, "krb5tray: unexpected fido2-cred output")
+		return exitFailure
+	}
+	if _, err := parseSecurityKeyPublicKey(publicKey); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+
+	section := map[string]SecurityKeyConfig{"security_key": {
+		Credential: strings.TrimSpace(credential),
+		PublicKey:  strings.TrimSpace(publicKey) + "\n",
+	}}
+	data, err := json.MarshalIndent(section, "", "  ")
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	_, _ = fmt.Fprintln(stdout, string(data))
+	return exitOK
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+// TestSecurityKeyAssertion covers checking a FIDO2 assertion as fido2-assert prints it
+func TestSecurityKeyAssertion(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := parseSecurityKeyPublicKey(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte("ktray"))
+	authData := append(rpIDHash[:], 0x01, 0, 0, 0, 7) // User present, counter 7
+	clientDataHash := sha256.Sum256([]byte("challenge"))
+	sign := func(authData []byte) []byte {
+		digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+		sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	// libfido2 prints the authenticator data as a CBOR byte string (major type 2, length 37)
+	line := base64.StdEncoding.EncodeToString(append([]byte{0x58, byte(len(authData))}, authData...))
+	decoded, err := decodeFIDO2Blob(line, true)
+	if err != nil || string(decoded) != string(authData) {
+		t.Fatalf("decodeFIDO2Blob = %x, %v", decoded, err)
+	}
+	if err := verifySecurityKeyAssertion(publicKey, "ktray", clientDataHash[:], decoded, sign(decoded)); err != nil {
+		t.Errorf("valid assertion: %v", err)
+	}
+
+	if err := verifySecurityKeyAssertion(publicKey, "other", clientDataHash[:], authData, sign(authData)); err == nil {
+		t.Error("accepted an assertion for another relying party")
+	}
+	untouched := append(append([]byte(nil), authData[:32]...), 0x00, 0, 0, 0, 7)
+	if err := verifySecurityKeyAssertion(publicKey, "ktray", clientDataHash[:], untouched, sign(untouched)); err == nil {
+		t.Error("accepted an assertion without user presence")
+	}
+	if err := verifySecurityKeyAssertion(publicKey, "ktray", make([]byte, 32), authData, sign(authData)); err == nil {
+		t.Error("accepted a signature over another challenge")
+	}
+	if err := verifySecurityKeyAssertion(publicKey, "ktray", clientDataHash[:], authData[:36], nil); err == nil {
+		t.Error("accepted short authenticator data")
+	}
+
+	for name, data := range map[string][]byte{
+		"not a byte string": append([]byte{0x78, 37}, authData...),
+		"length mismatch":   append([]byte{0x58, 40}, authData...),
+		"empty":             {},
+	} {
+		if _, err := decodeFIDO2Blob(base64.StdEncoding.EncodeToString(data), true); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+	if raw, err := decodeFIDO2Blob(base64.StdEncoding.EncodeToString([]byte("sig")), false); err != nil || string(raw) != "sig" {
+		t.Errorf("plain blob = %q, %v", raw, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// serviceName names the per-user login service on every platform
+const serviceName = "krb5tray"
+
+// serviceExecutable returns the resolved path of the running binary, for the service to start
+func serviceExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	// "go run" builds into a temporary directory that is removed when it exits
+	if strings.Contains(exe, "go-build") {
+		return "", fmt.Errorf("%s is a temporary build; install the binary first", exe)
+	}
+	return exe, nil
+}
+
+// runInstallServiceCommand writes the service definition and registers it to start the
+// tray at login, restarting it if it crashes
+func runInstallServiceCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("install-service", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	printOnly := fs.Bool("print", false, "Print the service definition without installing it")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray install-service [--print]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Registers a per-user service that starts the tray at login and restarts it on failure:")
+		_, _ = fmt.Fprintln(stderr, "a systemd user unit on Linux, a LaunchAgent on macOS, or a scheduled task on Windows.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	exe, err := serviceExecutable()
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	path, err := servicePath()
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitUnsupported
+	}
+	definition, err := serviceDefinition(exe)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	if *printOnly {
+		_, _ = io.WriteString(stdout, definition)
+		return exitOK
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	if err := os.WriteFile(path, serviceFileBytes(definition), 0644); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	_, _ = fmt.Fprintf(stdout, "Wrote %s\n", path)
+	if err := registerService(path); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: failed to register the service: %v\n", err)
+		return exitFailure
+	}
+	_, _ = fmt.Fprintf(stdout, "Installed %s: the tray now starts at login\n", serviceName)
+	return exitOK
+}
+
+// runUninstallServiceCommand unregisters the login service (stopping it) and removes its definition
+func runUninstallServiceCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 0 {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray uninstall-service")
+		return exitUsage
+	}
+	path, err := servicePath()
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitUnsupported
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %s is not installed (no %s)\n", serviceName, path)
+		return exitFailure
+	}
+
+	code := exitOK
+	// Keep going so a half-registered service can still be cleaned up
+	if err := unregisterService(path); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: failed to unregister the service: %v\n", err)
+		code = exitFailure
+	}
+	if err := os.Remove(path); err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	_, _ = fmt.Fprintf(stdout, "Removed %s\n", path)
+	return code
+}
+
+// runServiceTool runs a service manager command, including its output in the error
+func runServiceTool(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, msg)
+		}
+		return fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// xmlEscape escapes s for XML text and attribute values
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace(s)
+}
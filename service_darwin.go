@@ -0,0 +1,75 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// launchAgentLabel identifies the LaunchAgent to launchd
+const launchAgentLabel = "com.krb5tray.agent"
+
+// servicePath returns the LaunchAgent plist path
+func servicePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchAgentLabel+".plist"), nil
+}
+
+// serviceDefinition returns a LaunchAgent that starts the tray at login and restarts it
+// when it exits with an error
+func serviceDefinition(exe string) (string, error) {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>%s</string>
+    <key>ProgramArguments</key>
+    <array>
+        <string>%s</string>
+        <string>tray</string>
+    </array>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <dict>
+        <key>SuccessfulExit</key>
+        <false/>
+    </dict>
+    <key>ThrottleInterval</key>
+    <integer>10</integer>
+    <key>ProcessType</key>
+    <string>Interactive</string>
+    <key>LimitLoadToSessionType</key>
+    <string>Aqua</string>
+</dict>
+</plist>
+`, launchAgentLabel, xmlEscape(exe)), nil
+}
+
+func serviceFileBytes(definition string) []byte {
+	return []byte(definition)
+}
+
+// launchdDomain is the current user's GUI session domain
+func launchdDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+// registerService loads the agent into the login session, which starts it (RunAtLoad)
+func registerService(path string) error {
+	// Unload a previous install first so the new definition takes effect
+	_ = runServiceTool("launchctl", "bootout", launchdDomain()+"/"+launchAgentLabel)
+	return runServiceTool("launchctl", "bootstrap", launchdDomain(), path)
+}
+
+// unregisterService unloads the agent, stopping the tray it started
+func unregisterService(path string) error {
+	return runServiceTool("launchctl", "bootout", launchdDomain()+"/"+launchAgentLabel)
+}
@@ -0,0 +1,65 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// servicePath returns the systemd user unit path
+func servicePath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "systemd", "user", serviceName+".service"), nil
+}
+
+// serviceDefinition returns a systemd user unit tied to the graphical session, so the
+// tray starts once the desktop (and its DISPLAY or WAYLAND_DISPLAY) is up
+func serviceDefinition(exe string) (string, error) {
+	return fmt.Sprintf(`[Unit]
+Description=krb5tray Kerberos ticket tray
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+ExecStart=%s tray
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=graphical-session.target
+`, systemdQuote(exe)), nil
+}
+
+// systemdQuote quotes an ExecStart argument, escaping specifiers
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+func serviceFileBytes(definition string) []byte {
+	return []byte(definition)
+}
+
+// registerService enables the unit for future logins and starts it now
+func registerService(path string) error {
+	if err := runServiceTool("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	return runServiceTool("systemctl", "--user", "enable", "--now", serviceName+".service")
+}
+
+// unregisterService stops and disables the unit
+func unregisterService(path string) error {
+	return runServiceTool("systemctl", "--user", "disable", "--now", serviceName+".service")
+}
@@ -0,0 +1,26 @@
+//go:build !darwin && !windows && !linux
+// +build !darwin,!windows,!linux
+
+package main
+
+import "fmt"
+
+func servicePath() (string, error) {
+	return "", fmt.Errorf("login services are not supported on this platform")
+}
+
+func serviceDefinition(exe string) (string, error) {
+	return "", fmt.Errorf("login services are not supported on this platform")
+}
+
+func serviceFileBytes(definition string) []byte {
+	return []byte(definition)
+}
+
+func registerService(path string) error {
+	return fmt.Errorf("login services are not supported on this platform")
+}
+
+func unregisterService(path string) error {
+	return fmt.Errorf("login services are not supported on this platform")
+}
@@ -0,0 +1,91 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"unicode/utf16"
+)
+
+// servicePath returns where the scheduled task's XML definition is kept
+func servicePath() (string, error) {
+	dir := ConfigDir()
+	if dir == "" {
+		return "", fmt.Errorf("cannot determine the config directory")
+	}
+	return filepath.Join(dir, serviceName+"-task.xml"), nil
+}
+
+// serviceDefinition returns a Task Scheduler task that starts the tray when the current
+// user logs on, retrying if it fails
+func serviceDefinition(exe string) (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>krb5tray Kerberos ticket tray</Description>
+  </RegistrationInfo>
+  <Triggers>
+    <LogonTrigger>
+      <Enabled>true</Enabled>
+      <UserId>%[1]s</UserId>
+    </LogonTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <UserId>%[1]s</UserId>
+      <LogonType>InteractiveToken</LogonType>
+      <RunLevel>LeastPrivilege</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <ExecutionTimeLimit>PT0S</ExecutionTimeLimit>
+    <RestartOnFailure>
+      <Interval>PT1M</Interval>
+      <Count>3</Count>
+    </RestartOnFailure>
+    <Enabled>true</Enabled>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>%[2]s</Command>
+      <Arguments>tray</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`, xmlEscape(u.Username), xmlEscape(exe)), nil
+}
+
+// serviceFileBytes encodes the task as UTF-16 with a BOM, which schtasks /XML expects
+func serviceFileBytes(definition string) []byte {
+	units := utf16.Encode([]rune(definition))
+	b := make([]byte, 2+2*len(units))
+	binary.LittleEndian.PutUint16(b, 0xFEFF)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2+2*i:], u)
+	}
+	return b
+}
+
+// registerService creates (or replaces) the task and runs it now
+func registerService(path string) error {
+	if err := runServiceTool("schtasks", "/Create", "/TN", serviceName, "/XML", path, "/F"); err != nil {
+		return err
+	}
+	return runServiceTool("schtasks", "/Run", "/TN", serviceName)
+}
+
+// unregisterService deletes the task. A tray it already started keeps running.
+func unregisterService(path string) error {
+	return runServiceTool("schtasks", "/Delete", "/TN", serviceName, "/F")
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/internal/httpclient"
+)
+
+// Where a session entry's cookies go
+const (
+	sessionTargetHeader  = "header"
+	sessionTargetBrowser = "browser"
+)
+
+const (
+	// sessionLoginTimeout bounds the whole sign-in, redirects and Negotiate rounds included
+	sessionLoginTimeout = 60 * time.Second
+
+	// sessionMaxChallenges is how many Negotiate challenges one sign-in answers: one per
+	// host along the way (the app, then the IdP) is usual, plus a retry with a fresh ticket
+	sessionMaxChallenges = 4
+)
+
+var (
+	mSessionsMenu  *systray.MenuItem
+	sessionMenu    *menuList
+	sessionEntries []SessionEntry
+)
+
+// recordingJar is a cookie jar that also remembers the cookies as the servers set them,
+// with the attributes a jar doesn't give back (domain, expiry, HttpOnly), so they can be
+// recreated in a browser
+type recordingJar struct {
+	http.CookieJar
+
+	mu  sync.Mutex
+	set map[string][]recordedCookie // By name
+}
+
+type recordedCookie struct {
+	cookie *http.Cookie
+	url    *url.URL
+}
+
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.CookieJar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.set == nil {
+		j.set = make(map[string][]recordedCookie)
+	}
+	for _, c := range cookies {
+		j.set[c.Name] = append(j.set[c.Name], recordedCookie{cookie: c, url: u})
+	}
+}
+
+// lookup returns the last Set-Cookie for name that had value
+func (j *recordingJar) lookup(name string, value string) (recordedCookie, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	seen := j.set[name]
+	for i := len(seen) - 1; i >= 0; i-- {
+		if seen[i].cookie.Value == value {
+			return seen[i], true
+		}
+	}
+	return recordedCookie{}, false
+}
+
+// sessionTarget returns the entry's target, defaulting to header
+func sessionTarget(entry SessionEntry) string {
+	if entry.Target == "" {
+		return sessionTargetHeader
+	}
+	return strings.ToLower(entry.Target)
+}
+
+// sessionSPN returns the SPN to answer a Negotiate challenge from host with
+func sessionSPN(cfg *Config, entry SessionEntry, host string) string {
+	spn := entry.SPN
+	if spn == "" {
+		spn = "HTTP/{host}"
+	}
+	return cfg.ResolveSPN(strings.ReplaceAll(spn, "{host}", host))
+}
+
+// sessionLogin signs in to the entry's URL, answering Negotiate challenges with tickets
+// from the tray, and returns the session's cookie jar and the URL the sign-in ended on
+func sessionLogin(entry SessionEntry) (*recordingJar, *url.URL, error) {
+	cfg := currentConfig()
+	session, err := NewHTTPSession(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	jar := &recordingJar{CookieJar: session.jar}
+	session.client.Jar = jar
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionLoginTimeout)
+	defer cancel()
+
+	target := entry.URL
+	authorization := ""
+	answered := map[string]bool{}
+	for challenges := 0; ; challenges++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := session.client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		final := resp.Request.URL
+
+		if !isNegotiateChallenge(resp) {
+			if resp.StatusCode >= 400 {
+				return nil, nil, fmt.Errorf("sign-in at %s failed: %s", final.Host, resp.Status)
+			}
+			LogDebug("Session %s signed in at %s", entry.Name, httpclient.RedactURL(final))
+			return jar, final, nil
+		}
+		if challenges >= sessionMaxChallenges {
+			return nil, nil, fmt.Errorf("%s keeps asking for Kerberos authentication", final.Host)
+		}
+
+		// A second challenge from the same host may be a rejected replay of a cached
+		// token, so it gets a fresh one
+		spn := sessionSPN(cfg, entry, final.Hostname())
+		fresh := answered[final.Host]
+		answered[final.Host] = true
+		token, err := getCachedServiceToken(cfg, spn, fresh)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get token for %s: %w", spn, err)
+		}
+		LogDebug("Session %s: answering Negotiate challenge from %s with %s", entry.Name, final.Host, spn)
+		target = final.String()
+		authorization = "Negotiate " + token
+	}
+}
+
+// sessionCookies returns the cookies the jar sends to the entry's cookie_url (or the URL the
+// sign-in ended on), restricted to the names in cookies if any are set
+func sessionCookies(entry SessionEntry, jar *recordingJar, final *url.URL) (*url.URL, []*http.Cookie, error) {
+	cookieURL := final
+	if entry.CookieURL != "" {
+		u, err := url.Parse(entry.CookieURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cookie_url: %w", err)
+		}
+		cookieURL = u
+	}
+
+	var cookies []*http.Cookie
+	for _, c := range jar.Cookies(cookieURL) {
+		if len(entry.Cookies) > 0 && !containsString(entry.Cookies, c.Name) {
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	if len(cookies) == 0 {
+		if len(entry.Cookies) > 0 {
+			return nil, nil, fmt.Errorf("none of %s were set for %s", strings.Join(entry.Cookies, ", "), cookieURL.Host)
+		}
+		return nil, nil, fmt.Errorf("no cookies were set for %s", cookieURL.Host)
+	}
+	sort.SliceStable(cookies, func(i, j int) bool { return cookies[i].Name < cookies[j].Name })
+	return cookieURL, cookies, nil
+}
+
+// runSession signs in for a session entry and copies its cookies as a Cookie header value,
+// or sets them in the browser. It reports what it did, or false if the copy was declined.
+func runSession(entry SessionEntry, requester string) (string, bool, error) {
+	if err := requireSecurityKey(securityKeyTokens, "Sign in to "+entry.Name); err != nil {
+		return "", false, err
+	}
+	setStatus(fmt.Sprintf("Signing in: %s...", entry.Name))
+	jar, final, err := sessionLogin(entry)
+	if err != nil {
+		return "", false, err
+	}
+	cookieURL, cookies, err := sessionCookies(entry, jar, final)
+	if err != nil {
+		return "", false, err
+	}
+	names := make([]string, len(cookies))
+	for i, c := range cookies {
+		names[i] = c.Name
+	}
+	LogActionWithFields("session_cookies", fmt.Sprintf("Signed in to %s", entry.Name), map[string]interface{}{
+		"session":   entry.Name,
+		"host":      cookieURL.Host,
+		"cookies":   strings.Join(names, ","),
+		"target":    sessionTarget(entry),
+		"requester": requester,
+	})
+
+	if sessionTarget(entry) == sessionTargetBrowser {
+		params := make([]cdpCookie, len(cookies))
+		for i, c := range cookies {
+			if set, ok := jar.lookup(c.Name, c.Value); ok {
+				params[i] = cdpCookieFrom(set.cookie, set.url)
+			} else {
+				params[i] = cdpCookieFrom(c, cookieURL)
+			}
+		}
+		port := entry.DebugPort
+		if port == 0 {
+			port = defaultDebugPort
+		}
+		if err := pushBrowserCookies(port, params, final.String()); err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("Sent %d cookies for %s to the browser", len(cookies), cookieURL.Host), true, nil
+	}
+
+	pairs := make([]string, len(cookies))
+	for i, c := range cookies {
+		pairs[i] = c.Name + "=" + c.Value
+	}
+	copied, err := copySecretToClipboard("Cookies: "+entry.Name, strings.Join(pairs, "; "), requester)
+	if err != nil || !copied {
+		return "", copied, err
+	}
+	return fmt.Sprintf("%s %d cookies for %s", secretCopyVerb(), len(cookies), cookieURL.Host), true, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// findSessionEntry finds a session entry by name (case-insensitive)
+func findSessionEntry(cfg *Config, name string) (SessionEntry, bool) {
+	if cfg == nil {
+		return SessionEntry{}, false
+	}
+	for _, entry := range cfg.Sessions {
+		if strings.EqualFold(entry.Name, name) {
+			return entry, true
+		}
+	}
+	return SessionEntry{}, false
+}
+
+// loadAndBuildSessionsMenu fills the Sessions menu
+func loadAndBuildSessionsMenu() {
+	sessionMenu = newMenuList(mSessionsMenu, handleSessionClick, nil)
+
+	updateSessionsMenu()
+}
+
+// updateSessionsMenu lists the configured sessions
+func updateSessionsMenu() {
+	if sessionMenu == nil {
+		return
+	}
+
+	cfg := currentConfig()
+	var entries []SessionEntry
+	if cfg != nil {
+		entries = cfg.Sessions
+	}
+	stateMutex.Lock()
+	sessionEntries = entries
+	stateMutex.Unlock()
+
+	if len(entries) == 0 {
+		sessionMenu.ShowPlaceholder("No sessions configured", "Edit config file to add sessions")
+		return
+	}
+	sessionMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		entry := entries[i]
+		item.SetTitle(entry.Name)
+		if sessionTarget(entry) == sessionTargetBrowser {
+			item.SetTooltip(fmt.Sprintf("Sign in to %s and send the cookies to the browser", entry.URL))
+		} else {
+			item.SetTooltip(fmt.Sprintf("Sign in to %s and copy the Cookie header", entry.URL))
+		}
+	})
+}
+
+func handleSessionClick(index int) {
+	stateMutex.RLock()
+	var entry SessionEntry
+	if index < len(sessionEntries) {
+		entry = sessionEntries[index]
+	}
+	stateMutex.RUnlock()
+	if entry.URL == "" {
+		return
+	}
+
+	result, done, err := runSession(entry, requesterMenu)
+	switch {
+	case err != nil:
+		LogError("Session %s failed: %v", entry.Name, err)
+		setStatusError(fmt.Sprintf("Sign-in failed: %s", truncateError(err)))
+	case done:
+		setStatus(result)
+	}
+}
+
+func ctlSession(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: session <name>")
+	}
+	entry, ok := findSessionEntry(currentConfig(), args[0])
+	if !ok {
+		return "", fmt.Errorf("no session named %q", args[0])
+	}
+	result, done, err := runSession(entry, requesterCtl)
+	if err != nil {
+		return "", err
+	}
+	if !done {
+		return "", fmt.Errorf("not copied")
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/getlantern/systray"
+)
+
+// StartSignalHandler lets scripts and config management poke the running tray:
+// SIGHUP reloads the config, SIGUSR1 refreshes the current ticket, and SIGTERM or SIGINT
+// quit through the normal shutdown path (releasing hotkeys, sockets, and the lock).
+func StartSignalHandler() {
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		for sig := range signals {
+			LogInfo("Received %v", sig)
+			switch sig {
+			case syscall.SIGHUP:
+				runSignalCommand("reload", ctlReload)
+			case syscall.SIGUSR1:
+				runSignalCommand("refresh", ctlRefresh)
+			case syscall.SIGTERM, syscall.SIGINT:
+				// A second signal while shutting down falls back to the default (exit now)
+				signal.Reset(syscall.SIGTERM, syscall.SIGINT)
+				systray.Quit()
+				return
+			}
+		}
+	}()
+}
+
+// runSignalCommand runs a control command for a signal, serialized with ctl clients
+func runSignalCommand(name string, run func(args []string) (string, error)) {
+	controlMutex.Lock()
+	message, err := run(nil)
+	controlMutex.Unlock()
+
+	LogAction("control_command", "Signal command: "+name)
+	if err != nil {
+		LogError("Signal %s failed: %v", name, err)
+		setStatusError(name + " failed: " + truncateError(err))
+		return
+	}
+	LogInfo("Signal %s: %s", name, message)
+}
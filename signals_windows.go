@@ -0,0 +1,8 @@
+//go:build windows
+// +build windows
+
+package main
+
+// StartSignalHandler does nothing on Windows, which has no SIGHUP or SIGUSR1;
+// use "krb5tray ctl" instead
+func StartSignalHandler() {}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// signatureSuffix is appended to a file's path to find its minisign signature
+const signatureSuffix = ".minisig"
+
+// errNotSigned means a file has no signature next to it
+var errNotSigned = errors.New("not signed")
+
+// minisignKey is an Ed25519 public key in minisign's format
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PublicKey
+}
+
+// parseMinisignKey parses a minisign public key: the base64 line of a minisign.pub file,
+// or the whole file including its comment line
+func parseMinisignKey(text string) (*minisignKey, error) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("not a minisign public key")
+	}
+	k := &minisignKey{key: ed25519.PublicKey(raw[10:])}
+	copy(k.id[:], raw[2:10])
+	return k, nil
+}
+
+// verify checks sig, the contents of a .minisig file, against data. Both the legacy and
+// the prehashed (BLAKE2b) signature formats are accepted, and the trusted comment must be
+// signed too.
+func (k *minisignKey) verify(data []byte, sig []byte) error {
+	lines := strings.Split(strings.ReplaceAll(string(sig), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("malformed signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("malformed signature")
+	}
+	if !bytes.Equal(raw[2:10], k.id[:]) {
+		return fmt.Errorf("signed with another key (%X)", raw[2:10])
+	}
+	signature := raw[10:]
+
+	message := data
+	switch string(raw[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", raw[:2])
+	}
+	if !ed25519.Verify(k.key, message, signature) {
+		return fmt.Errorf("signature does not match, the file was changed after it was signed")
+	}
+
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+	comment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(k.key, append(append([]byte{}, signature...), comment...), global) {
+		return fmt.Errorf("trusted comment does not match its signature")
+	}
+	return nil
+}
+
+// readSignedFile reads path and checks its signature according to cfg. A file without a
+// signature is accepted unless signing is required; one with a bad signature never is.
+// The returned data is what was verified, so it must be used instead of reading the file
+// again.
+func readSignedFile(path string, cfg SigningConfig) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PublicKey == "" {
+		if cfg.RequireSigned {
+			return nil, fmt.Errorf("%s: require_signed is set but signing.public_key is not", path)
+		}
+		return data, nil
+	}
+	key, err := parseMinisignKey(cfg.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing.public_key: %w", err)
+	}
+
+	sig, err := os.ReadFile(path + signatureSuffix)
+	if os.IsNotExist(err) {
+		if cfg.RequireSigned {
+			return nil, fmt.Errorf("%s: %w", path, errNotSigned)
+		}
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := key.verify(data, sig); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// checkConfigRewritable refuses to rewrite the config file while it is signed: a public key
+// is configured, so reloads check its signature, or a .minisig lies next to it. Saving would
+// leave a signature that no longer matches, and every reload after it would fail. what says
+// what to do instead, like "add the hosts".
+func checkConfigRewritable(cfg *Config, what string) error {
+	path := DefaultConfigPath()
+	_, err := os.Stat(path + signatureSuffix)
+	if cfg.GetSigningConfigWithDefaults().PublicKey == "" && os.IsNotExist(err) {
+		return nil
+	}
+	return fmt.Errorf("the config is signed, %s where it is signed and sign it again (minisign -Sm %s)", what, path)
+}
+
+// signingPinEnv hands the running config's signing settings to the tray a restart starts,
+// so the config it loads has to pass the same check a reload would
+const signingPinEnv = "KRB5TRAY_SIGNING_PIN"
+
+// systemSigningKeyPath is where an administrator can install a minisign public key. Users
+// can't write there, so when it exists it is where trust starts: the config, even the one
+// loaded at startup, and every script must be signed with it.
+func systemSigningKeyPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "ktray", "minisign.pub")
+	}
+	return "/etc/ktray/minisign.pub"
+}
+
+// systemSigning returns the signing settings the system key imposes, if one is installed
+func systemSigning() (SigningConfig, bool, error) {
+	path := systemSigningKeyPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return SigningConfig{}, false, nil
+	}
+	if err != nil {
+		return SigningConfig{}, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if _, err := parseMinisignKey(string(data)); err != nil {
+		return SigningConfig{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return SigningConfig{PublicKey: strings.TrimSpace(string(data)), RequireSigned: true}, true, nil
+}
+
+// startupSigning returns the signing settings the config loaded at startup must pass: the
+// system key's, else the ones the tray that restarted this one was running with. It reports
+// false when there are none and the startup config is trusted as is.
+func startupSigning() (SigningConfig, bool, error) {
+	if signing, ok, err := systemSigning(); ok || err != nil {
+		return signing, ok, err
+	}
+	pin := os.Getenv(signingPinEnv)
+	if pin == "" {
+		return SigningConfig{}, false, nil
+	}
+	var signing SigningConfig
+	if err := json.Unmarshal([]byte(pin), &signing); err != nil {
+		return SigningConfig{}, false, fmt.Errorf("bad %s: %w", signingPinEnv, err)
+	}
+	return signing, signing.PublicKey != "", nil
+}
+
+// signingPin is the environment entry that makes a restarted tray check its config like a
+// reload would, or "" if the running config doesn't sign
+func signingPin(signing SigningConfig) string {
+	if signing.PublicKey == "" {
+		return ""
+	}
+	data, err := json.Marshal(signing)
+	if err != nil {
+		return ""
+	}
+	return signingPinEnv + "=" + string(data)
+}
+
+// loadStartupConfig loads the config file at startup, checking its signature when the
+// system key or a restart says it must be signed
+func loadStartupConfig() (*Config, error) {
+	signing, pinned, err := startupSigning()
+	if err != nil {
+		return nil, err
+	}
+	if !pinned {
+		return LoadConfig("")
+	}
+	return loadSignedConfig(signing)
+}
+
+// loadSignedConfig loads the config file for a reload, checking its signature with the
+// running config's signing settings, so a config that requires signing can only be
+// replaced by one signed with the same key. A system key replaces the config's own
+// signing settings, so a config can't sign itself out of it.
+func loadSignedConfig(signing SigningConfig) (*Config, error) {
+	data, err := readSignedFile(DefaultConfigPath(), signing)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	system, ok, err := systemSigning()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cfg.Signing = &system
+	}
+	return cfg, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testSigner signs files the way minisign -S does, with the legacy algorithm
+type testSigner struct {
+	id   [8]byte
+	priv ed25519.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSigner{priv: priv}
+	copy(s.id[:], "testkey!")
+	return s
+}
+
+// publicKey is the base64 line of the signer's minisign.pub
+func (s *testSigner) publicKey() string {
+	raw := append(append([]byte("Ed"), s.id[:]...), s.priv.Public().(ed25519.PublicKey)...)
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// sign writes path's .minisig
+func (s *testSigner) sign(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+signatureSuffix, s.signature(data, "Ed", "timestamp:0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signature is the .minisig of data with the given algorithm ("Ed" legacy, "ED" prehashed)
+func (s *testSigner) signature(data []byte, algorithm string, comment string) []byte {
+	message := data
+	if algorithm == "ED" {
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	}
+	signature := ed25519.Sign(s.priv, message)
+	global := ed25519.Sign(s.priv, append(append([]byte{}, signature...), comment...))
+	return []byte(strings.Join([]string{
+		"untrusted comment: signature from minisign secret key",
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), s.id[:]...), signature...)),
+		"trusted comment: " + comment,
+		base64.StdEncoding.EncodeToString(global),
+		"",
+	}, "\n"))
+}
+
+// TestMinisignVerify covers both signature formats and the ways a signature can be wrong
+func TestMinisignVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	key, err := parseMinisignKey("untrusted comment: minisign public key\n" + signer.publicKey() + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseMinisignKey("RWQ="); err == nil {
+		t.Error("parsed a truncated key")
+	}
+	data := []byte("return {answer = 42}\n")
+
+	for _, algorithm := range []string{"Ed", "ED"} {
+		if err := key.verify(data, signer.signature(data, algorithm, "timestamp:0")); err != nil {
+			t.Errorf("%s signature: %v", algorithm, err)
+		}
+	}
+	if err := key.verify([]byte("return {answer = 43}\n"), signer.signature(data, "Ed", "timestamp:0")); err == nil {
+		t.Error("accepted a changed file")
+	}
+	forged := strings.Replace(string(signer.signature(data, "Ed", "timestamp:0")), "timestamp:0", "timestamp:1", 1)
+	if err := key.verify(data, []byte(forged)); err == nil || !strings.Contains(err.Error(), "trusted comment") {
+		t.Errorf("changed trusted comment: %v", err)
+	}
+	other := newTestSigner(t)
+	copy(other.id[:], "otherkey")
+	if err := key.verify(data, other.signature(data, "Ed", "timestamp:0")); err == nil || !strings.Contains(err.Error(), "another key") {
+		t.Errorf("signature by another key: %v", err)
+	}
+	if err := key.verify(data, []byte("untrusted comment: x\nnot base64\n")); err == nil {
+		t.Error("accepted a malformed signature")
+	}
+}
+
+// TestConfigRewritable covers refusing to rewrite a config whose signature it would break
+func TestConfigRewritable(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(ConfigDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkConfigRewritable(&Config{}, "edit it"); err != nil {
+		t.Errorf("unsigned config: %v", err)
+	}
+	signed := &Config{Signing: &SigningConfig{PublicKey: "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"}}
+	if err := checkConfigRewritable(signed, "edit it"); err == nil {
+		t.Error("config with a public_key was rewritable")
+	}
+	if err := os.WriteFile(DefaultConfigPath()+signatureSuffix, []byte("sig"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkConfigRewritable(&Config{}, "edit it"); err == nil {
+		t.Error("config with a .minisig was rewritable")
+	}
+}
+
+// TestSignedRequire covers require, dofile and loadfile checking signatures like scripts
+func TestSignedRequire(t *testing.T) {
+	signer := newTestSigner(t)
+	h := newHeadlessTray(t, `{"signing": {"public_key": "`+signer.publicKey()+`", "require_signed": true}}`)
+	dir := t.TempDir()
+	module := filepath.Join(dir, "helper.lua")
+	if err := os.WriteFile(module, []byte(`return {answer = 42}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := `package.path = "` + filepath.ToSlash(dir) + `/?.lua"
+local ok, err = pcall(require, "helper")
+if not ok then
+	result = "require: " .. tostring(err)
+else
+	result = "answer " .. require("helper").answer
+end`
+	run := func(name, source string) string {
+		if err := os.MkdirAll(ScriptsDir(), 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(ScriptsDir(), name)
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		signer.sign(t, path)
+		out, err := h.runScript(name, source)
+		if err != nil {
+			t.Fatalf("script: %v", err)
+		}
+		return out
+	}
+
+	if out := run("uses_helper.lua", script); !strings.Contains(out, "rejected") {
+		t.Errorf("unsigned module was loaded: %q", out)
+	}
+	if out := run("loads_helper.lua", `result = tostring(loadfile("`+filepath.ToSlash(module)+`"))`); out != "nil" {
+		t.Errorf("loadfile of an unsigned file = %q", out)
+	}
+	signer.sign(t, module)
+	if out := run("uses_helper.lua", script); out != "answer 42" {
+		t.Errorf("signed module: %q", out)
+	}
+}
+
+// TestStartupSigning covers a restart handing the running signing settings to the new tray
+func TestStartupSigning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(ConfigDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DefaultConfigPath(), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	signer := newTestSigner(t)
+	pin := signingPin(SigningConfig{PublicKey: signer.publicKey(), RequireSigned: true})
+	if pin == "" {
+		t.Fatal("no pin for a signing config")
+	}
+	if signingPin(SigningConfig{}) != "" {
+		t.Error("pin without a public key")
+	}
+
+	t.Setenv(signingPinEnv, "")
+	if _, err := loadStartupConfig(); err != nil {
+		t.Errorf("fresh start: %v", err)
+	}
+	t.Setenv(signingPinEnv, strings.TrimPrefix(pin, signingPinEnv+"="))
+	if _, err := loadStartupConfig(); err == nil {
+		t.Error("restart loaded an unsigned config")
+	}
+	signer.sign(t, DefaultConfigPath())
+	if _, err := loadStartupConfig(); err != nil {
+		t.Errorf("restart with a signed config: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errAlreadyRunning is returned by EnsureSingleInstance when another instance holds the lock
+var errAlreadyRunning = errors.New("another instance of krb5tray is already running")
+
+// pendingTrayRequest is a command given on the first instance's command line, run once
+// the tray is up
+var pendingTrayRequest *controlRequest
+
+// parseTrayArgs converts tray arguments such as "--copy-header" or "--run-script x.lua"
+// to the control command they name. It returns nil when there are none.
+func parseTrayArgs(args []string) (*controlRequest, error) {
+	// macOS adds a process serial number when an app bundle is opened from the Finder
+	if len(args) > 0 && strings.HasPrefix(args[0], "-psn_") {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	name := strings.TrimLeft(args[0], "-")
+	if !strings.HasPrefix(args[0], "-") || name == "" {
+		return nil, fmt.Errorf("unexpected argument: %s", args[0])
+	}
+	if _, ok := controlCommands()[name]; !ok {
+		return nil, fmt.Errorf("unknown option: %s", args[0])
+	}
+	return &controlRequest{Command: name, Args: args[1:]}, nil
+}
+
+// forwardToRunningInstance sends the command line's request to the instance holding the
+// lock, so launching the app again acts on the running one. Without a request it only
+// reports that the tray is already running.
+func forwardToRunningInstance(req *controlRequest, stdout io.Writer, stderr io.Writer) int {
+	if req == nil {
+		_, _ = fmt.Fprintln(stdout, "krb5tray is already running")
+		return exitOK
+	}
+
+	resp, err := sendControlRequest(*req)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v, and its control socket is unavailable: %v\n", errAlreadyRunning, err)
+		return exitNotRunning
+	}
+	if !resp.OK {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %s\n", resp.Message)
+		return exitFailure
+	}
+	if resp.Message != "" {
+		_, _ = fmt.Fprintln(stdout, resp.Message)
+	}
+	return exitOK
+}
+
+// runPendingTrayRequest runs the command the tray was started with
+func runPendingTrayRequest() {
+	req := pendingTrayRequest
+	if req == nil {
+		return
+	}
+	pendingTrayRequest = nil
+
+	controlMutex.Lock()
+	message, err := controlCommands()[req.Command].run(req.Args)
+	controlMutex.Unlock()
+
+	LogAction("control_command", fmt.Sprintf("Startup command: %s", req.Command))
+	if err != nil {
+		LogError("Startup command %s failed: %v", req.Command, err)
+		setStatusError(fmt.Sprintf("%s failed: %s", req.Command, truncateError(err)))
+		return
+	}
+	if message != "" {
+		LogInfo("Startup command %s: %s", req.Command, message)
+	}
+}
@@ -5,10 +5,19 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
+// lockFDEnv passes the locked file descriptor to a restarted instance
+const lockFDEnv = "KRB5TRAY_LOCK_FD"
+
 var lockFile *os.File
 
 // EnsureSingleInstance ensures only one instance of the application is running.
@@ -16,6 +25,12 @@ var lockFile *os.File
 func EnsureSingleInstance() error {
 	lockPath := getLockFilePath()
 
+	// A restart hands over the lock instead of releasing it, so nothing can take it in between
+	if f := inheritedLockFile(lockPath); f != nil {
+		lockFile = f
+		return nil
+	}
+
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(lockPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -32,13 +47,24 @@ func EnsureSingleInstance() error {
 	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
 	if err != nil {
 		f.Close()
-		return fmt.Errorf("another instance of krb5tray is already running")
+		if reason := staleLockReason(lockPath); reason != "" {
+			// flock can stay held on NFS after the holder is gone; a fresh file has no lock
+			f, err = recoverStaleLock(lockPath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "krb5tray: removed stale lock file (%s)\n", reason)
+		} else {
+			return errAlreadyRunning
+		}
 	}
 
-	// Write PID to lock file
+	// Record PID, host and start time, for stale lock detection by the next instance
 	f.Truncate(0)
 	f.Seek(0, 0)
-	fmt.Fprintf(f, "%d\n", os.Getpid())
+	hostname, _ := os.Hostname()
+	started, _ := processStartTime(os.Getpid())
+	fmt.Fprintf(f, "%d\n%s\n%s\n", os.Getpid(), hostname, started)
 
 	// Keep the file open (lock is held as long as file is open)
 	lockFile = f
@@ -56,6 +82,49 @@ func ReleaseSingleInstance() {
 	}
 }
 
+// handOverSingleInstance keeps the lock file open across exec and returns the environment
+// entry that tells the new image its descriptor
+func handOverSingleInstance() (string, error) {
+	if lockFile == nil {
+		return "", nil
+	}
+	fd := lockFile.Fd()
+	if _, err := unix.FcntlInt(fd, unix.F_SETFD, 0); err != nil {
+		return "", fmt.Errorf("failed to pass on the lock file: %w", err)
+	}
+	return fmt.Sprintf("%s=%d", lockFDEnv, fd), nil
+}
+
+// inheritedLockFile returns the lock file handed over by the instance that exec'd this one,
+// or nil if there isn't one
+func inheritedLockFile(lockPath string) *os.File {
+	value := os.Getenv(lockFDEnv)
+	if value == "" {
+		return nil
+	}
+	_ = os.Unsetenv(lockFDEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return nil
+	}
+	f := os.NewFile(uintptr(fd), lockPath)
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	if pathInfo, err := os.Stat(lockPath); err != nil || !os.SameFile(info, pathInfo) {
+		f.Close()
+		return nil
+	}
+	// Re-locking through the same open file succeeds only if it really holds the lock
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil
+	}
+	syscall.CloseOnExec(fd)
+	return f
+}
+
 func getLockFilePath() string {
 	// Use a standard location for the lock file
 	home, err := os.UserHomeDir()
@@ -63,4 +132,127 @@ func getLockFilePath() string {
 		home = os.TempDir()
 	}
 	return filepath.Join(home, ".config", "krb5tray.lock")
-}
\ No newline at end of file
+}
+
+// recoverStaleLock replaces a stale lock file and locks the new one
+func recoverStaleLock(lockPath string) (*os.File, error) {
+	if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale lock file: %w", err)
+	}
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		// Another instance starting at the same time got there first
+		return nil, errAlreadyRunning
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, errAlreadyRunning
+	}
+	return f, nil
+}
+
+// staleLockReason returns why a held lock file is stale, or "" if an instance may really
+// be running. A lock is stale when the PID it records is on this host and is either gone
+// or, since PIDs are reused, a process that started at another time than the one that
+// wrote the lock. Lock files without a start time fall back to comparing the program's
+// name. Locks from other hosts (shared home) and files without a PID (an instance still
+// starting) are trusted.
+func staleLockReason(lockPath string) string {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || pid <= 0 {
+		return ""
+	}
+	if len(lines) > 1 {
+		if hostname, err := os.Hostname(); err == nil && strings.TrimSpace(lines[1]) != hostname {
+			return ""
+		}
+	}
+	if pid == os.Getpid() {
+		return ""
+	}
+
+	// Signal 0 checks for existence; EPERM means it exists but belongs to someone else
+	if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+		return fmt.Sprintf("process %d is not running", pid)
+	}
+	if len(lines) > 2 && strings.TrimSpace(lines[2]) != "" {
+		started, err := processStartTime(pid)
+		if err != nil {
+			return ""
+		}
+		if started != strings.TrimSpace(lines[2]) {
+			return fmt.Sprintf("process %d was started after the lock was taken", pid)
+		}
+		return ""
+	}
+	exe, err := processExecutable(pid)
+	if err != nil {
+		return ""
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if filepath.Base(exe) != filepath.Base(self) {
+		return fmt.Sprintf("process %d is %s", pid, filepath.Base(exe))
+	}
+	return ""
+}
+
+// processStartTime returns when a process started, in a form that is only compared: the
+// clock ticks since boot on Linux, ps's lstart elsewhere
+func processStartTime(pid int) (string, error) {
+	if runtime.GOOS == "linux" {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return "", err
+		}
+		// The command name is in parentheses and may contain spaces; starttime is the 22nd
+		// field, the 20th after it
+		stat := string(data)
+		end := strings.LastIndex(stat, ") ")
+		if end < 0 {
+			return "", fmt.Errorf("unexpected /proc/%d/stat", pid)
+		}
+		fields := strings.Fields(stat[end+2:])
+		if len(fields) < 20 {
+			return "", fmt.Errorf("unexpected /proc/%d/stat", pid)
+		}
+		return fields[19], nil
+	}
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "lstart=").Output()
+	if err != nil {
+		return "", err
+	}
+	started := strings.Join(strings.Fields(string(out)), " ")
+	if started == "" {
+		return "", fmt.Errorf("no process %d", pid)
+	}
+	return started, nil
+}
+
+// processExecutable returns the path of a process's executable
+func processExecutable(pid int) (string, error) {
+	if runtime.GOOS == "linux" {
+		exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+		if err != nil {
+			return "", err
+		}
+		// The binary may have been replaced by an upgrade since it started
+		return strings.TrimSuffix(exe, " (deleted)"), nil
+	}
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "comm=").Output()
+	if err != nil {
+		return "", err
+	}
+	exe := strings.TrimSpace(string(out))
+	if exe == "" {
+		return "", fmt.Errorf("no process %d", pid)
+	}
+	return exe, nil
+}
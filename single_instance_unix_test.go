@@ -0,0 +1,50 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestStaleLockReason covers recognizing a lock whose PID now belongs to another process
+func TestStaleLockReason(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip("no sleep command")
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	pid := cmd.Process.Pid
+	started, err := processStartTime(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	lockPath := filepath.Join(t.TempDir(), "krb5tray.lock")
+	check := func(contents string) string {
+		if err := os.WriteFile(lockPath, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return staleLockReason(lockPath)
+	}
+
+	if reason := check(fmt.Sprintf("%d\n%s\n%s\n", pid, hostname, started)); reason != "" {
+		t.Errorf("lock of the process that took it is stale: %s", reason)
+	}
+	if reason := check(fmt.Sprintf("%d\n%s\n%s\n", pid, hostname, "1")); reason == "" {
+		t.Error("lock whose PID was reused isn't stale")
+	}
+	if reason := check(fmt.Sprintf("%d\n%s\n%s\n", pid, "elsewhere.example.com", "1")); reason != "" {
+		t.Errorf("lock from another host is stale: %s", reason)
+	}
+	// Lock files written before start times were recorded compare the program's name
+	if reason := check(fmt.Sprintf("%d\n%s\n", pid, hostname)); reason == "" {
+		t.Error("lock held by sleep isn't stale")
+	}
+}
@@ -25,7 +25,7 @@ func EnsureSingleInstance() error {
 	handle, err := windows.CreateMutex(nil, false, mutexName)
 	if err != nil {
 		if err == windows.ERROR_ALREADY_EXISTS {
-			return fmt.Errorf("another instance of krb5tray is already running")
+			return errAlreadyRunning
 		}
 		return fmt.Errorf("failed to create mutex: %w", err)
 	}
@@ -36,7 +36,7 @@ func EnsureSingleInstance() error {
 	event, err := windows.WaitForSingleObject(handle, 0)
 	if err != nil || event != windows.WAIT_OBJECT_0 {
 		windows.CloseHandle(handle)
-		return fmt.Errorf("another instance of krb5tray is already running")
+		return errAlreadyRunning
 	}
 
 	lockHandle = handle
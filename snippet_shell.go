@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/getlantern/systray"
+)
+
+// Shells a snippet can have a variant for
+const (
+	snippetShellBash       = "bash"
+	snippetShellZsh        = "zsh"
+	snippetShellPowerShell = "powershell"
+	snippetShellCmd        = "cmd"
+)
+
+// snippetShells lists the shells with their titles in the Shell menu
+var snippetShells = []struct {
+	shell string
+	title string
+}{
+	{snippetShellBash, "bash"},
+	{snippetShellZsh, "zsh"},
+	{snippetShellPowerShell, "PowerShell"},
+	{snippetShellCmd, "cmd"},
+}
+
+var (
+	// snippetShellItemsMutex guards snippetShellItems
+	snippetShellItemsMutex sync.Mutex
+
+	// snippetShellItems holds the Shell checkboxes of the Snippets menu, by shell
+	snippetShellItems map[string]*systray.MenuItem
+)
+
+func validSnippetShell(shell string) bool {
+	for _, s := range snippetShells {
+		if s.shell == shell {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSnippetShell returns the shell whose snippet variants are copied: shell from the
+// config, else PowerShell on Windows and $SHELL (bash unless it is zsh) elsewhere
+func (c *Config) GetSnippetShell() string {
+	if c != nil && c.Shell != "" {
+		return c.Shell
+	}
+	if runtime.GOOS == "windows" {
+		return snippetShellPowerShell
+	}
+	if filepath.Base(os.Getenv("SHELL")) == snippetShellZsh {
+		return snippetShellZsh
+	}
+	return snippetShellBash
+}
+
+// snippetValue returns the value of entry for shell: its variant for the shell, else the
+// one for the other POSIX shell (bash and zsh quote alike), else value. A snippet with
+// only variants falls back to the first one in the Shell menu's order.
+func snippetValue(entry SnippetEntry, shell string) string {
+	if len(entry.Variants) == 0 {
+		return entry.Value
+	}
+	if v, ok := entry.Variants[shell]; ok {
+		return v
+	}
+	switch shell {
+	case snippetShellBash:
+		if v, ok := entry.Variants[snippetShellZsh]; ok {
+			return v
+		}
+	case snippetShellZsh:
+		if v, ok := entry.Variants[snippetShellBash]; ok {
+			return v
+		}
+	}
+	if entry.Value != "" {
+		return entry.Value
+	}
+	for _, s := range snippetShells {
+		if v, ok := entry.Variants[s.shell]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// snippetValues returns the value and every variant of entry, for the credential scan
+func snippetValues(entry SnippetEntry) []string {
+	values := []string{entry.Value}
+	shells := make([]string, 0, len(entry.Variants))
+	for shell := range entry.Variants {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	for _, shell := range shells {
+		values = append(values, entry.Variants[shell])
+	}
+	return values
+}
+
+// snippetShellFooter adds the Shell submenu to the Snippets menu
+func snippetShellFooter(parent *systray.MenuItem) *systray.MenuItem {
+	shellMenu := parent.AddSubMenuItem("Shell", "Shell whose variant is copied for snippets that have them (saved to shell)")
+	items := map[string]*systray.MenuItem{}
+	for _, s := range snippetShells {
+		item := shellMenu.AddSubMenuItemCheckbox(s.title, fmt.Sprintf("Copy the %s variant of snippets", s.title), false)
+		items[s.shell] = item
+		go handleEditClick(item, func(shell string) func() error {
+			return func() error { return setSnippetShell(shell) }
+		}(s.shell))
+	}
+	snippetShellItemsMutex.Lock()
+	snippetShellItems = items
+	snippetShellItemsMutex.Unlock()
+	updateSnippetShellChecks()
+	return shellMenu
+}
+
+// updateSnippetShellChecks checks the shell snippets are copied for
+func updateSnippetShellChecks() {
+	shell := currentConfig().GetSnippetShell()
+	snippetShellItemsMutex.Lock()
+	defer snippetShellItemsMutex.Unlock()
+	for s, item := range snippetShellItems {
+		if s == shell {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+}
+
+// setSnippetShell saves shell as the shell snippets are copied for
+func setSnippetShell(shell string) error {
+	if currentConfig().GetSnippetShell() == shell {
+		updateSnippetShellChecks()
+		return nil
+	}
+	return editConfigFile(func(cfg *Config) (string, error) {
+		cfg.Shell = shell
+		return fmt.Sprintf("Snippets copied for %s", shell), nil
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// defaultSPNTemplate is the SPN used for a matched host when a rule doesn't give one
+const defaultSPNTemplate = "HTTP/{host}"
+
+// matchSPNHost reports whether host matches pattern: a host name, or a glob such as
+// "*.corp.example.com" or "app-??.example.com" ("*" also matches dots)
+func matchSPNHost(pattern string, host string) bool {
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return err == nil && matched
+}
+
+// expandSPNTemplate replaces {host} in template (HTTP/{host} when empty) and resolves the
+// result against the spns list, so a rule can name an entry
+func expandSPNTemplate(cfg *Config, template string, host string) string {
+	if template == "" {
+		template = defaultSPNTemplate
+	}
+	return cfg.ResolveSPN(strings.ReplaceAll(template, "{host}", strings.ToLower(host)))
+}
+
+// SPNForHost returns the SPN spn_map maps host to, or "" if no rule matches. The first
+// matching rule wins.
+func (c *Config) SPNForHost(host string) string {
+	if c == nil {
+		return ""
+	}
+	for _, rule := range c.SPNMap {
+		if matchSPNHost(rule.Host, host) {
+			return expandSPNTemplate(c, rule.SPN, host)
+		}
+	}
+	return ""
+}
+
+// SPNForURL returns the SPN spn_map maps rawURL's host to
+func (c *Config) SPNForURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("%q has no host", rawURL)
+	}
+	spn := c.SPNForHost(u.Hostname())
+	if spn == "" {
+		return "", fmt.Errorf("no spn_map rule matches %s", u.Hostname())
+	}
+	return spn, nil
+}
+
+// luaSPNForURL returns the SPN for a URL: ktray.spn_for_url(url) -> spn, error
+func luaSPNForURL(L *lua.LState) int {
+	spn, err := currentConfig().SPNForURL(L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(spn))
+	return 1
+}
+
+// luaHTTPNegotiate performs an HTTP GET with a Negotiate header for the SPN spn_map maps the
+// URL's host to: ktray.http_negotiate(url, headers, timeout_seconds, skip_verify) -> body, error
+func luaHTTPNegotiate(L *lua.LState) int {
+	rawURL := L.CheckString(1)
+	cfg := currentConfig()
+	spn, err := cfg.SPNForURL(rawURL)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	token, err := getCachedServiceToken(cfg, spn, false)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString("failed to get token: " + err.Error()))
+		return 2
+	}
+
+	// Pass a copy of the headers with Authorization added on to http_get
+	headers := L.NewTable()
+	if given := L.OptTable(2, nil); given != nil {
+		given.ForEach(func(k, v lua.LValue) { headers.RawSet(k, v) })
+	}
+	headers.RawSetString("Authorization", lua.LString("Negotiate "+token))
+	if L.GetTop() >= 2 {
+		L.Replace(2, headers)
+	} else {
+		L.Push(headers)
+	}
+	return luaHTTPGet(L)
+}
+
+// runCurlCommand runs curl with a Negotiate header for the first http(s) URL among its
+// arguments, using spn_map (or --spn) to pick the SPN. URLs no rule matches are requested
+// without one.
+func runCurlCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("curl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	spnFlag := fs.String("spn", "", "SPN (or name from spns) to use instead of spn_map")
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray curl [--spn spn] [--debug] [--] <curl arguments...>")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Runs curl with an Authorization: Negotiate header for the SPN that spn_map")
+		_, _ = fmt.Fprintln(stderr, "maps the URL's host to. Options after the first non-krb5tray one go to curl.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	curlArgs := fs.Args()
+	if len(curlArgs) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	curl, err := exec.LookPath("curl")
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "krb5tray: curl not found")
+		return exitFailure
+	}
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+
+	spn := ""
+	if *spnFlag != "" {
+		spn = cfg.ResolveSPN(*spnFlag)
+	} else {
+		for _, arg := range curlArgs {
+			if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+				spn, _ = cfg.SPNForURL(arg)
+				break
+			}
+		}
+	}
+
+	if spn != "" {
+		token, err := getServiceTicket(spn)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: failed to get ticket for %s: %v\n", spn, err)
+			return ticketErrorExitCode(classifyTicketError(err))
+		}
+		// The header goes through a private file, since arguments are visible to other users
+		header, err := writeCurlHeaderFile(token)
+		zeroBytes(token)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+			return exitFailure
+		}
+		defer os.Remove(header)
+		curlArgs = append([]string{"-H", "@" + header}, curlArgs...)
+	}
+
+	cmd := exec.Command(curl, curlArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// writeCurlHeaderFile writes the Negotiate header for token to a file only the user can
+// read, for curl's -H @file
+func writeCurlHeaderFile(token []byte) (string, error) {
+	f, err := os.CreateTemp("", "krb5tray-curl-*")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	if _, err := fmt.Fprintf(f, "Authorization: Negotiate %s\n", base64.StdEncoding.EncodeToString(token)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(name)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestSPNForURL covers spn_map: globs, the first match winning, templates and SPN names
+func TestSPNForURL(t *testing.T) {
+	cfg := &Config{
+		SPNs: []SPNEntry{{Name: "Wiki", SPN: "HTTP/wiki-lb.corp.example.com"}},
+		SPNMap: []SPNMapRule{
+			{Host: "wiki.corp.example.com", SPN: "Wiki"},
+			{Host: "app-??.example.com", SPN: "HTTP/apps.example.com"},
+			{Host: "*.corp.example.com"},
+			{Host: "*.example.com", SPN: "HTTP@{host}"},
+		},
+	}
+	for rawURL, want := range map[string]string{
+		"https://wiki.corp.example.com/page":  "HTTP/wiki-lb.corp.example.com",
+		"https://APP-01.example.com/":         "HTTP/apps.example.com",
+		"https://app-001.example.com/":        "HTTP@app-001.example.com",
+		"https://Build.Corp.Example.com:8443": "HTTP/build.corp.example.com",
+		"https://a.b.corp.example.com/":       "HTTP/a.b.corp.example.com",
+		"https://example.org/":                "",
+	} {
+		got, err := cfg.SPNForURL(rawURL)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("SPNForURL(%q) = %q, %v, want %q", rawURL, got, err, want)
+		}
+	}
+	if _, err := cfg.SPNForURL("/relative"); err == nil {
+		t.Error("SPN for a URL without a host")
+	}
+	if matchSPNHost("[", "[") {
+		t.Error("a malformed glob matched")
+	}
+}
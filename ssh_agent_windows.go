@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// windowsSSHAgentPipe is the named pipe of the Windows OpenSSH agent service
+const windowsSSHAgentPipe = `\\.\pipe\openssh-ssh-agent`
+
+// dialSSHAgent connects to the OpenSSH agent pipe, or the pipe named by SSH_AUTH_SOCK
+func dialSSHAgent() (io.ReadWriteCloser, error) {
+	pipe := os.Getenv("SSH_AUTH_SOCK")
+	if pipe == "" {
+		pipe = windowsSSHAgentPipe
+	}
+	return os.OpenFile(pipe, os.O_RDWR, 0)
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshModeBuiltin selects the embedded SSH client for an SSH entry
+const sshModeBuiltin = "builtin"
+
+// sshDialTimeout bounds connecting to the server and the SSH handshake
+const sshDialTimeout = 20 * time.Second
+
+// sshAuthOptions supplies credentials that may need the user.
+// prompt is nil when nobody can answer (e.g. no terminal or dialog).
+type sshAuthOptions struct {
+	password func(hop SSHEntry) string                        // Password from a hop's password_secret, "" if unavailable
+	prompt   func(question string, echo bool) (string, error) // Ask the user for a password or passphrase
+	confirm  func(message string) bool                        // Ask whether to trust an unknown host key
+}
+
+// findSSHEntry returns the SSH entry with the given name or index
+func findSSHEntry(cfg *Config, name string) (SSHEntry, bool) {
+	if cfg == nil {
+		return SSHEntry{}, false
+	}
+	for _, entry := range cfg.SSH {
+		if strings.EqualFold(entry.Name, name) || strconv.Itoa(entry.Index) == name {
+			return entry, true
+		}
+	}
+	return SSHEntry{}, false
+}
+
+// sshEntryAddress returns the host:port to dial for a builtin entry
+func sshEntryAddress(entry SSHEntry) string {
+	port := entry.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(entry.Host, strconv.Itoa(port))
+}
+
+// sshEntryUser returns the login name for a builtin entry
+func sshEntryUser(entry SSHEntry) string {
+	if entry.User != "" {
+		return entry.User
+	}
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	// Windows reports DOMAIN\user
+	if i := strings.LastIndex(u.Username, `\`); i >= 0 {
+		return u.Username[i+1:]
+	}
+	return u.Username
+}
+
+// expandHomePath expands a leading ~/ to the user's home directory
+func expandHomePath(path string) string {
+	if strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// dialBuiltinSSH connects and authenticates to a builtin entry's server, through its
+// jump hosts if it has any. Closing the returned client also closes the hops before it.
+func dialBuiltinSSH(entry SSHEntry, opts sshAuthOptions) (*ssh.Client, error) {
+	if entry.Host == "" {
+		return nil, fmt.Errorf("SSH entry %q has no host", entry.Name)
+	}
+
+	var hops []*ssh.Client
+	closeHops := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			hops[i].Close()
+		}
+	}
+	for _, hop := range append(jumpHostEntries(entry), entry) {
+		var via *ssh.Client
+		if len(hops) > 0 {
+			via = hops[len(hops)-1]
+		}
+		client, err := dialSSHHop(via, hop, opts)
+		if err != nil {
+			closeHops()
+			return nil, err
+		}
+		hops = append(hops, client)
+	}
+
+	client := hops[len(hops)-1]
+	if len(hops) > 1 {
+		go func() {
+			_ = client.Wait()
+			closeHops()
+		}()
+	}
+	return client, nil
+}
+
+// dialSSHHop authenticates to one hop, directly or through the previous hop's connection
+func dialSSHHop(via *ssh.Client, hop SSHEntry, opts sshAuthOptions) (*ssh.Client, error) {
+	auth, closeAuth := sshAuthMethods(hop, opts)
+	defer closeAuth()
+
+	config := &ssh.ClientConfig{
+		User:            sshEntryUser(hop),
+		Auth:            auth,
+		HostKeyCallback: sshHostKeyCallback(opts.confirm),
+		Timeout:         sshDialTimeout,
+	}
+	addr := sshEntryAddress(hop)
+	if via == nil {
+		client, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return nil, fmt.Errorf("SSH to %s failed: %w", addr, err)
+		}
+		return client, nil
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("jump host could not reach %s: %w", addr, err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH to %s failed: %w", addr, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshAuthMethods returns the auth methods to offer, in order: GSSAPI-with-MIC (the
+// Kerberos ticket), public keys (agent and key files), password, and keyboard-interactive.
+// The returned func releases the agent connection once authentication is done.
+func sshAuthMethods(entry SSHEntry, opts sshAuthOptions) ([]ssh.AuthMethod, func()) {
+	var methods []ssh.AuthMethod
+	closeAuth := func() {}
+
+	if gss := newSSHGSSAPIClient(); gss != nil {
+		methods = append(methods, ssh.GSSAPIWithMICAuthMethod(gss, entry.Host))
+	}
+
+	// The client tries each method type once, so agent and file keys share one method
+	var agentSigners func() ([]ssh.Signer, error)
+	if conn, err := dialSSHAgent(); err == nil {
+		agentSigners = agent.NewClient(conn).Signers
+		closeAuth = func() { conn.Close() }
+	} else {
+		LogDebug("SSH agent not available: %v", err)
+	}
+	methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		if agentSigners != nil {
+			if s, err := agentSigners(); err == nil {
+				signers = append(signers, s...)
+			}
+		}
+		keys, err := sshKeyFileSigners(entry, opts.prompt)
+		if err != nil {
+			return nil, err
+		}
+		return append(signers, keys...), nil
+	}))
+
+	password := func() (string, error) {
+		if opts.password != nil {
+			if pw := opts.password(entry); pw != "" {
+				return pw, nil
+			}
+		}
+		if opts.prompt == nil {
+			return "", fmt.Errorf("no password available for %s", entry.Name)
+		}
+		return opts.prompt(fmt.Sprintf("%s@%s's password: ", sshEntryUser(entry), entry.Host), false)
+	}
+	if entry.PasswordSecret != "" || opts.prompt != nil {
+		methods = append(methods, ssh.PasswordCallback(password))
+	}
+	if opts.prompt != nil {
+		methods = append(methods, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i, q := range questions {
+				var err error
+				// A lone hidden question is the password prompt
+				if len(questions) == 1 && !echos[i] {
+					answers[i], err = password()
+				} else {
+					answers[i], err = opts.prompt(q, echos[i])
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			return answers, nil
+		}))
+	}
+
+	return methods, closeAuth
+}
+
+// sshKeyFileSigners loads the entry's key file, or the default keys that exist.
+// Encrypted keys are unlocked with a passphrase prompt when one is available.
+func sshKeyFileSigners(entry SSHEntry, prompt func(string, bool) (string, error)) ([]ssh.Signer, error) {
+	paths := []string{expandHomePath(entry.KeyFile)}
+	if entry.KeyFile == "" {
+		paths = []string{
+			expandHomePath("~/.ssh/id_ed25519"),
+			expandHomePath("~/.ssh/id_ecdsa"),
+			expandHomePath("~/.ssh/id_rsa"),
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if entry.KeyFile != "" {
+				return nil, fmt.Errorf("failed to read key file: %w", err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && prompt != nil {
+			passphrase, perr := prompt(fmt.Sprintf("Enter passphrase for key '%s': ", path), false)
+			if perr != nil {
+				return nil, perr
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		}
+		zeroBytes(data)
+		if err != nil {
+			if entry.KeyFile != "" {
+				return nil, fmt.Errorf("failed to load key %s: %w", path, err)
+			}
+			LogDebug("Skipping SSH key %s: %v", path, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// knownHostsPath returns the OpenSSH known_hosts file shared with the ssh command
+func knownHostsPath() string {
+	return expandHomePath("~/.ssh/known_hosts")
+}
+
+// sshHostKeyCallback checks host keys against known_hosts. Unknown hosts are added if
+// confirm approves them; a changed key is always rejected.
+func sshHostKeyCallback(confirm func(string) bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		path := knownHostsPath()
+		check, err := knownhosts.New(path)
+		if err == nil {
+			err = check(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) {
+				return err
+			}
+			if len(keyErr.Want) > 0 {
+				return fmt.Errorf("host key for %s does not match %s:%d (it may have been replaced, or the connection intercepted)",
+					hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		message := fmt.Sprintf("The authenticity of host %s can't be established.\n%s key fingerprint is %s.",
+			hostname, key.Type(), fingerprint)
+		if confirm == nil || !confirm(message) {
+			return fmt.Errorf("host key for %s is not trusted (%s %s)", hostname, key.Type(), fingerprint)
+		}
+		return appendKnownHost(path, hostname, key)
+	}
+}
+
+// appendKnownHost records a host key in known_hosts
+func appendKnownHost(path string, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return err
+}
+
+// traySSHAuthOptions returns auth options for connections made by the tray itself.
+// Prompts and host key confirmations use dialogs since there is no terminal.
+func traySSHAuthOptions(title string) sshAuthOptions {
+	return sshAuthOptions{
+		password: cachedSSHPassword,
+		prompt: func(question string, echo bool) (string, error) {
+			answer, ok := PromptForInput(title, question, "", !echo)
+			if !ok {
+				return "", fmt.Errorf("cancelled")
+			}
+			return answer, nil
+		},
+		confirm: func(message string) bool {
+			return ConfirmDialog(title, message+"\n\nTrust this host and connect?")
+		},
+	}
+}
+
+// runBuiltinSSHExec runs the entry's exec command from the tray and returns its output
+func runBuiltinSSHExec(entry SSHEntry) (string, error) {
+	client, err := dialBuiltinSSH(entry, traySSHAuthOptions("SSH: "+entry.Name))
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(entry.Exec)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// cachedSSHPassword returns the password stored under the entry's password_secret
+func cachedSSHPassword(entry SSHEntry) string {
+	if entry.PasswordSecret == "" {
+		return ""
+	}
+	value, _ := GetCache().Get(entry.PasswordSecret)
+	return value
+}
+
+// builtinSSHCommand returns the command line that runs an entry's session in a terminal.
+// The entry is passed by index so the line needs no quoting inside terminal templates.
+func builtinSSHCommand(entry SSHEntry) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(exe, " ") {
+		exe = `"` + exe + `"`
+	}
+	return fmt.Sprintf("%s ssh-session %d", exe, entry.Index), nil
+}
+
+// runSSHSessionCommand opens an interactive session (or runs a command) for a builtin SSH entry
+func runSSHSessionCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ssh-session", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray ssh-session [--debug] <name> [command...]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Connects to an SSH entry with mode \"builtin\". Without a command the entry's")
+		_, _ = fmt.Fprintln(stderr, "exec command is run, or an interactive shell is opened if it has none.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+	applySSHAutoSync(cfg)
+	entry, ok := findSSHEntry(cfg, fs.Arg(0))
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: no SSH entry named %q\n", fs.Arg(0))
+		return exitUsage
+	}
+	if isConsoleMode(entry.Mode) {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %s is a %s console, not an SSH host\n", entry.Name, entry.Mode)
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		entry.Exec = strings.Join(fs.Args()[1:], " ")
+	}
+
+	opts := sshAuthOptions{
+		password: func(hop SSHEntry) string { return sessionSSHPassword(entry, hop) },
+		prompt:   terminalPrompt(stderr),
+	}
+	if opts.prompt != nil {
+		opts.confirm = func(message string) bool {
+			answer, err := opts.prompt(message+"\nAre you sure you want to continue connecting (yes/no)? ", true)
+			return err == nil && strings.EqualFold(answer, "yes")
+		}
+	}
+	client, err := dialBuiltinSSH(entry, opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	defer client.Close()
+
+	if err := runSSHSession(client, entry, stdout, stderr); err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitStatus()
+		}
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// sessionSSHPassword asks the running tray for a hop's password_secret, since the
+// session runs in its own process without the tray's cache
+func sessionSSHPassword(entry SSHEntry, hop SSHEntry) string {
+	if hop.PasswordSecret == "" {
+		return ""
+	}
+	resp, err := sendControlRequest(controlRequest{Command: "ssh-password", Args: []string{entry.Name, hop.PasswordSecret}})
+	if err != nil || !resp.OK {
+		return ""
+	}
+	return resp.Message
+}
+
+// terminalPrompt returns a prompt that reads answers from the terminal, hiding
+// passwords, or nil when stdin isn't a terminal
+func terminalPrompt(stderr io.Writer) func(string, bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return nil
+	}
+	return func(question string, echo bool) (string, error) {
+		_, _ = io.WriteString(stderr, question)
+		if !echo {
+			answer, err := readTermPassword(fd)
+			_, _ = fmt.Fprintln(stderr)
+			return answer, err
+		}
+		return readSecretLine(os.Stdin)
+	}
+}
+
+// runSSHSession runs the entry's exec command, or an interactive shell that is sent its
+// send_after lines if it has none, wired to this process's stdio. A terminal on stdin
+// gets a pty that follows window resizes.
+func runSSHSession(client *ssh.Client, entry SSHEntry, stdout io.Writer, stderr io.Writer) error {
+	command := entry.Exec
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// send_after lines share stdin with the terminal, so it's copied by hand
+	var input *sessionInput
+	if command == "" && len(entry.SendAfter) > 0 {
+		pipe, err := session.StdinPipe()
+		if err != nil {
+			return err
+		}
+		input = &sessionInput{w: pipe}
+		go func() {
+			_, _ = io.Copy(input, os.Stdin)
+			input.Close()
+		}()
+	} else {
+		session.Stdin = os.Stdin
+	}
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	fd := int(os.Stdin.Fd())
+	if command == "" && isTerminal(fd) {
+		width, height, err := termSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("failed to request a pty: %w", err)
+		}
+
+		state, err := makeTermRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer restoreTerm(fd, state)
+
+		stop := watchTermResize(int(os.Stdout.Fd()), func(width, height int) {
+			_ = session.WindowChange(height, width)
+		})
+		defer stop()
+	}
+
+	if command != "" {
+		return session.Run(command)
+	}
+	if err := session.Shell(); err != nil {
+		return err
+	}
+	if input != nil {
+		// The remote pty expects Enter as a carriage return
+		go runSendAfter(entry.Name, entry.SendAfter, func(line string) error {
+			_, err := io.WriteString(input, line+"\r")
+			return err
+		})
+	}
+	return session.Wait()
+}
+
+// readSecretLine reads a line one byte at a time, so nothing after it is left buffered
+// away from the SSH session's stdin
+func readSecretLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				break
+			}
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
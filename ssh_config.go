@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sshConfigMaxIncludeDepth stops Include loops, as ssh does
+const sshConfigMaxIncludeDepth = 16
+
+// sshConfigHost is a concrete (non-wildcard) Host alias from an ssh_config file
+type sshConfigHost struct {
+	Alias        string
+	HostName     string
+	User         string
+	Port         int
+	IdentityFile string
+	ProxyJump    string
+}
+
+// parseSSHConfigFile returns the concrete host aliases in an ssh_config file, following
+// Include directives. Wildcard patterns and Match blocks only supply defaults to ssh,
+// so they don't become entries.
+func parseSSHConfigFile(path string) ([]sshConfigHost, error) {
+	var hosts []sshConfigHost
+	seen := make(map[string]bool)
+	if err := parseSSHConfigInto(expandHomePath(path), 0, &hosts, seen); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+func parseSSHConfigInto(path string, depth int, hosts *[]sshConfigHost, seen map[string]bool) error {
+	if depth > sshConfigMaxIncludeDepth {
+		return fmt.Errorf("%s: too many nested Include directives", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Indexes into *hosts of the aliases the current Host line declared
+	var current []int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		keyword, args := splitSSHConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			current = nil
+			for _, pattern := range args {
+				if strings.ContainsAny(pattern, "*?!") || seen[strings.ToLower(pattern)] {
+					continue
+				}
+				seen[strings.ToLower(pattern)] = true
+				*hosts = append(*hosts, sshConfigHost{Alias: pattern})
+				current = append(current, len(*hosts)-1)
+			}
+			continue
+		case "match":
+			current = nil
+			continue
+		case "include":
+			for _, pattern := range args {
+				pattern = expandHomePath(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(expandHomePath("~/.ssh"), pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					if err := parseSSHConfigInto(match, depth+1, hosts, seen); err != nil {
+						LogWarn("Skipping included ssh_config %s: %v", match, err)
+					}
+				}
+			}
+			continue
+		}
+
+		if len(current) == 0 || len(args) == 0 {
+			continue
+		}
+		// The first value for a keyword wins, as in ssh
+		for _, i := range current {
+			h := &(*hosts)[i]
+			switch keyword {
+			case "hostname":
+				if h.HostName == "" {
+					h.HostName = args[0]
+				}
+			case "user":
+				if h.User == "" {
+					h.User = args[0]
+				}
+			case "port":
+				if h.Port == 0 {
+					h.Port, _ = strconv.Atoi(args[0])
+				}
+			case "identityfile":
+				if h.IdentityFile == "" {
+					h.IdentityFile = args[0]
+				}
+			case "proxyjump":
+				if h.ProxyJump == "" {
+					h.ProxyJump = args[0]
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// splitSSHConfigLine returns a line's lowercase keyword and its arguments.
+// Both "Keyword value" and "Keyword=value" forms and double-quoted arguments are accepted.
+func splitSSHConfigLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+	return keyword, parseCommandLine(strings.TrimSpace(rest))
+}
+
+// sshEntriesFromHosts returns entries for the hosts not already in existing, numbered
+// after the highest existing index
+func sshEntriesFromHosts(hosts []sshConfigHost, existing []SSHEntry, mode string) []SSHEntry {
+	known := make(map[string]bool)
+	next := 0
+	for _, entry := range existing {
+		known[strings.ToLower(entry.Name)] = true
+		if entry.Command != "" {
+			known[strings.ToLower(strings.TrimSpace(entry.Command))] = true
+		}
+		if entry.Index >= next {
+			next = entry.Index + 1
+		}
+	}
+
+	aliases := make(map[string]sshConfigHost)
+	for _, h := range hosts {
+		aliases[strings.ToLower(h.Alias)] = h
+	}
+
+	var entries []SSHEntry
+	for _, h := range hosts {
+		if known[strings.ToLower(h.Alias)] || known["ssh "+strings.ToLower(h.Alias)] {
+			continue
+		}
+		entry := SSHEntry{Index: next, Name: h.Alias}
+		if mode == sshModeBuiltin {
+			entry.Mode = sshModeBuiltin
+			entry.Host = h.HostName
+			if entry.Host == "" {
+				entry.Host = h.Alias
+			}
+			entry.User = h.User
+			entry.Port = h.Port
+			entry.KeyFile = h.IdentityFile
+			entry.JumpHosts = parseProxyJump(h.ProxyJump)
+			// Jump hosts are often aliases themselves; the builtin client needs their real address
+			for i, jump := range entry.JumpHosts {
+				if a, ok := aliases[strings.ToLower(jump.Host)]; ok {
+					entry.JumpHosts[i] = resolveJumpAlias(jump, a)
+				}
+			}
+		} else {
+			// Let ssh apply the rest of the Host block
+			entry.Command = "ssh " + h.Alias
+		}
+		entries = append(entries, entry)
+		next++
+	}
+	return entries
+}
+
+// applySSHAutoSync adds the ssh_config hosts to cfg.SSH when ssh_import.auto_sync is set.
+// The entries exist only in memory; the config file is not changed.
+func applySSHAutoSync(cfg *Config) {
+	if cfg == nil {
+		return
+	}
+	importCfg := cfg.GetSSHImportConfigWithDefaults()
+	if !importCfg.AutoSync {
+		return
+	}
+	hosts, err := parseSSHConfigFile(importCfg.Path)
+	if err != nil {
+		LogWarn("ssh_config auto-sync failed: %v", err)
+		return
+	}
+	entries := sshEntriesFromHosts(hosts, cfg.SSH, importCfg.Mode)
+	cfg.SSH = append(cfg.SSH, entries...)
+	LogDebug("Added %d SSH entries from %s", len(entries), importCfg.Path)
+}
+
+// importSSHConfigHosts appends the ssh_config hosts missing from the config file to it,
+// reloads, and returns how many were added
+func importSSHConfigHosts() (int, error) {
+	// Work on the file as written, without auto-synced entries
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return 0, fmt.Errorf("config error: %w", err)
+	}
+	// Rewriting a signed config would break its signature
+	if err := checkConfigRewritable(cfg, "add the hosts"); err != nil {
+		return 0, err
+	}
+	importCfg := cfg.GetSSHImportConfigWithDefaults()
+	hosts, err := parseSSHConfigFile(importCfg.Path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read ssh_config: %w", err)
+	}
+
+	entries := sshEntriesFromHosts(hosts, cfg.SSH, importCfg.Mode)
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	cfg.SSH = append(cfg.SSH, entries...)
+	if err := SaveConfig(cfg, ""); err != nil {
+		return 0, fmt.Errorf("failed to save config: %w", err)
+	}
+	LogInfo("Imported %d SSH entries from %s", len(entries), importCfg.Path)
+	reloadConfig()
+	return len(entries), nil
+}
+
+// resolveJumpAlias fills a jump host from the Host block of the alias it names
+func resolveJumpAlias(jump SSHJumpHost, alias sshConfigHost) SSHJumpHost {
+	if alias.HostName != "" {
+		jump.Host = alias.HostName
+	}
+	if jump.User == "" {
+		jump.User = alias.User
+	}
+	if jump.Port == 0 {
+		jump.Port = alias.Port
+	}
+	jump.KeyFile = alias.IdentityFile
+	return jump
+}
@@ -0,0 +1,123 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"golang.org/x/crypto/ssh"
+
+	"krb5tray/pkg/krb"
+)
+
+// sshGSSAPIClient implements gssapi-with-mic (RFC 4462) with gokrb5 and the ccache.
+// Only RFC 4121 MIC tokens are produced, so the service key must be an AES enctype.
+type sshGSSAPIClient struct {
+	transport  *krb.Gokrb5Transport
+	sessionKey types.EncryptionKey
+	micKey     types.EncryptionKey
+	micFlags   byte
+	seqNum     uint64
+}
+
+// newSSHGSSAPIClient returns the GSSAPI client for SSH auth, or nil if there is no usable ccache
+func newSSHGSSAPIClient() ssh.GSSAPIClient {
+	t, err := krb.Open(krbOptions())
+	if err != nil {
+		LogDebug("SSH GSSAPI unavailable: %v", err)
+		return nil
+	}
+	// The MIC needs the session key, which only gokrb5 hands out
+	transport, ok := t.(*krb.Gokrb5Transport)
+	if !ok {
+		_ = t.Close()
+		LogDebug("SSH GSSAPI unavailable with the configured transport")
+		return nil
+	}
+	return &sshGSSAPIClient{transport: transport}
+}
+
+// InitSecContext sends an AP-REQ for host/<server>, then checks the server's AP-REP
+func (c *sshGSSAPIClient) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	if token == nil {
+		// The ssh package names the target "host@server"
+		spn := strings.Replace(target, "@", "/", 1)
+		tkt, key, err := c.transport.Client().GetServiceTicket(spn)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get ticket for %s: %w", spn, err)
+		}
+		krbToken, err := spnego.NewKRB5TokenAPREQ(c.transport.Client(), tkt, key,
+			[]int{gssapi.ContextFlagInteg, gssapi.ContextFlagMutual}, []int{flags.APOptionMutualRequired})
+		if err != nil {
+			return nil, false, err
+		}
+
+		// The MIC sequence number starts at the authenticator's
+		plain, err := crypto.DecryptEncPart(krbToken.APReq.EncryptedAuthenticator, key, keyusage.AP_REQ_AUTHENTICATOR)
+		if err != nil {
+			return nil, false, err
+		}
+		var auth types.Authenticator
+		if err := auth.Unmarshal(plain); err != nil {
+			return nil, false, err
+		}
+		c.sessionKey = key
+		c.micKey = key
+		c.seqNum = uint64(auth.SeqNumber)
+
+		out, err := krbToken.Marshal()
+		return out, true, err
+	}
+
+	var reply spnego.KRB5Token
+	if err := reply.Unmarshal(token); err != nil {
+		return nil, false, err
+	}
+	if reply.IsKRBError() {
+		return nil, false, fmt.Errorf("server rejected the ticket: %s", reply.KRBError.Error())
+	}
+	if !reply.IsAPRep() {
+		return nil, false, fmt.Errorf("unexpected GSSAPI token from server")
+	}
+	plain, err := crypto.DecryptEncPart(reply.APRep.EncPart, c.sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to verify server AP-REP: %w", err)
+	}
+	var part messages.EncAPRepPart
+	if err := part.Unmarshal(plain); err != nil {
+		return nil, false, err
+	}
+	// An acceptor subkey replaces the session key for per-message tokens
+	if part.Subkey.KeyType != 0 {
+		c.micKey = part.Subkey
+		c.micFlags = gssapi.MICTokenFlagAcceptorSubkey
+	}
+	return nil, false, nil
+}
+
+// GetMIC signs the SSH session data with the context key
+func (c *sshGSSAPIClient) GetMIC(micField []byte) ([]byte, error) {
+	mt := gssapi.MICToken{
+		Flags:     c.micFlags,
+		SndSeqNum: c.seqNum,
+		Payload:   micField,
+	}
+	if err := mt.SetChecksum(c.micKey, keyusage.GSSAPI_INITIATOR_SIGN); err != nil {
+		return nil, err
+	}
+	return mt.Marshal()
+}
+
+// DeleteSecContext releases the gokrb5 client
+func (c *sshGSSAPIClient) DeleteSecContext() error {
+	return c.transport.Close()
+}
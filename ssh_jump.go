@@ -0,0 +1,63 @@
+package main
+
+import "strings"
+
+// jumpHostEntries returns an entry's jump hosts as entries for the builtin client, in
+// the order they are dialed
+func jumpHostEntries(entry SSHEntry) []SSHEntry {
+	hops := make([]SSHEntry, 0, len(entry.JumpHosts))
+	for _, jump := range entry.JumpHosts {
+		hops = append(hops, SSHEntry{
+			Name:           entry.Name,
+			Mode:           sshModeBuiltin,
+			Host:           jump.Host,
+			Port:           jump.Port,
+			User:           jump.User,
+			KeyFile:        jump.KeyFile,
+			PasswordSecret: jump.PasswordSecret,
+		})
+	}
+	return hops
+}
+
+// jumpHostChain formats jump hosts as an ssh -J / ProxyJump value
+func jumpHostChain(jumps []SSHJumpHost) string {
+	parts := make([]string, len(jumps))
+	for i, jump := range jumps {
+		parts[i] = jump.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// sshCommandWithJumpHosts adds "-J <chain>" after the ssh program in an entry's command.
+// Commands that don't start with ssh are returned unchanged.
+func sshCommandWithJumpHosts(entry SSHEntry) string {
+	if len(entry.JumpHosts) == 0 {
+		return entry.Command
+	}
+	command := strings.TrimSpace(entry.Command)
+	program, rest, _ := strings.Cut(command, " ")
+	base := strings.Trim(program, `"'`)
+	if i := strings.LastIndexAny(base, `/\`); i >= 0 {
+		base = base[i+1:]
+	}
+	if base != "ssh" && base != "ssh.exe" {
+		LogWarn("SSH %s: jump_hosts ignored, command doesn't start with ssh", entry.Name)
+		return entry.Command
+	}
+	return strings.TrimSpace(program + " -J " + jumpHostChain(entry.JumpHosts) + " " + rest)
+}
+
+// parseProxyJump converts an ssh_config ProxyJump value to jump hosts
+func parseProxyJump(value string) []SSHJumpHost {
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil
+	}
+	var jumps []SSHJumpHost
+	for _, part := range strings.Split(value, ",") {
+		if jump, err := parseJumpHost(part); err == nil {
+			jumps = append(jumps, jump)
+		}
+	}
+	return jumps
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// sshProbeConcurrency bounds the number of hosts probed at once
+const sshProbeConcurrency = 8
+
+// sshProbeOptionsWithValue are the ssh options that take an argument
+const sshProbeOptionsWithValue = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// sshProbeResult is the outcome of the last TCP probe of an address
+type sshProbeResult struct {
+	Reachable bool
+	Latency   time.Duration
+	Err       string
+}
+
+// sshProber probes the SSH menu's hosts on an interval until stopped
+type sshProber struct {
+	cfg  SSHProbeConfig
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	probeMutex  sync.Mutex
+	activeProbe *sshProber
+
+	probeResultsMutex sync.RWMutex
+	probeResults      = make(map[string]sshProbeResult)
+)
+
+// ApplySSHProbeConfig starts, restarts, or stops background probing to match cfg.
+// An unchanged config starts a new round so reloaded entries get a status quickly.
+func ApplySSHProbeConfig(cfg SSHProbeConfig) {
+	probeMutex.Lock()
+	defer probeMutex.Unlock()
+
+	if activeProbe != nil && activeProbe.cfg == cfg {
+		select {
+		case activeProbe.kick <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if activeProbe != nil {
+		close(activeProbe.stop)
+		<-activeProbe.done
+		activeProbe = nil
+	}
+
+	probeResultsMutex.Lock()
+	probeResults = make(map[string]sshProbeResult)
+	probeResultsMutex.Unlock()
+
+	if !cfg.Enabled {
+		refreshSSHMenuStatus()
+		return
+	}
+	activeProbe = &sshProber{
+		cfg:  cfg,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go activeProbe.run()
+	LogDebug("Probing SSH hosts every %ds", cfg.IntervalSec)
+}
+
+// StopSSHProbe stops background probing
+func StopSSHProbe() {
+	probeMutex.Lock()
+	defer probeMutex.Unlock()
+
+	if activeProbe != nil {
+		close(activeProbe.stop)
+		<-activeProbe.done
+		activeProbe = nil
+	}
+}
+
+func (p *sshProber) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(time.Duration(p.cfg.IntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		p.probeAll()
+		select {
+		case <-ticker.C:
+		case <-p.kick:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// probeAll probes every distinct address in the SSH menu, then updates the menu titles
+func (p *sshProber) probeAll() {
+	cfg := currentConfig()
+	if cfg == nil {
+		return
+	}
+
+	aliases := sshConfigAliases(cfg)
+	addresses := make(map[string]bool)
+	for _, entry := range cfg.SSH {
+		if address := sshProbeAddress(entry, aliases); address != "" {
+			addresses[address] = true
+		}
+	}
+
+	timeout := time.Duration(p.cfg.TimeoutMs) * time.Millisecond
+	results := make(map[string]sshProbeResult)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, sshProbeConcurrency)
+	for address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result := probeSSHAddress(address, timeout)
+			mu.Lock()
+			results[address] = result
+			mu.Unlock()
+		}(address)
+	}
+	wg.Wait()
+
+	select {
+	case <-p.stop:
+		// Disabled while probing; don't bring back stale results
+		return
+	default:
+	}
+	probeResultsMutex.Lock()
+	probeResults = results
+	probeResultsMutex.Unlock()
+	refreshSSHMenuStatus()
+}
+
+// probeSSHAddress opens a TCP connection to address and times it
+func probeSSHAddress(address string, timeout time.Duration) sshProbeResult {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		LogTrace("SSH probe %s failed: %v", address, err)
+		return sshProbeResult{Err: err.Error()}
+	}
+	conn.Close()
+	return sshProbeResult{Reachable: true, Latency: time.Since(start)}
+}
+
+// sshConfigAliases returns the ssh_config Host blocks by lowercase alias, for resolving
+// the hosts in "ssh <alias>" commands
+func sshConfigAliases(cfg *Config) map[string]sshConfigHost {
+	aliases := make(map[string]sshConfigHost)
+	hosts, err := parseSSHConfigFile(cfg.GetSSHImportConfigWithDefaults().Path)
+	if err != nil {
+		return aliases
+	}
+	for _, h := range hosts {
+		aliases[strings.ToLower(h.Alias)] = h
+	}
+	return aliases
+}
+
+// sshProbeAliases returns the ssh_config aliases for showing probe results, or nil when
+// there are none to show
+func sshProbeAliases(cfg *Config) map[string]sshConfigHost {
+	probeResultsMutex.RLock()
+	empty := len(probeResults) == 0
+	probeResultsMutex.RUnlock()
+	if empty || cfg == nil {
+		return nil
+	}
+	return sshConfigAliases(cfg)
+}
+
+// sshProbeAddress returns the host:port to probe for an entry: the first jump host if it
+// has any, otherwise the server. Commands that aren't plain ssh invocations (or that use a
+// ProxyCommand) return "".
+func sshProbeAddress(entry SSHEntry, aliases map[string]sshConfigHost) string {
+	if len(entry.JumpHosts) > 0 {
+		return jumpHostAddress(entry.JumpHosts[0], aliases)
+	}
+	switch entry.Mode {
+	case sshModeBuiltin:
+		if entry.Host == "" {
+			return ""
+		}
+		return sshEntryAddress(entry)
+	case sshModeTelnet:
+		if entry.Command != "" || entry.Host == "" {
+			return ""
+		}
+		port := entry.Port
+		if port == 0 {
+			port = 23
+		}
+		return net.JoinHostPort(entry.Host, strconv.Itoa(port))
+	case sshModeSerial:
+		return ""
+	}
+
+	args := parseCommandLine(strings.TrimSpace(entry.Command))
+	if len(args) == 0 {
+		return ""
+	}
+	base := filepath.Base(strings.ReplaceAll(args[0], `\`, "/"))
+	if base != "ssh" && base != "ssh.exe" {
+		return ""
+	}
+
+	var destination, port, jump string
+	for i := 1; i < len(args) && destination == ""; i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				destination = args[i+1]
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			destination = arg
+			break
+		}
+		// Flags can be combined, as in "-vp 2222"; the first one taking a value ends the group
+		flags := arg[1:]
+		for j, flag := range flags {
+			if !strings.ContainsRune(sshProbeOptionsWithValue, flag) {
+				continue
+			}
+			value := flags[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			switch flag {
+			case 'p':
+				port = value
+			case 'J':
+				jump = value
+			case 'o':
+				key, val, _ := strings.Cut(value, "=")
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "proxyjump":
+					jump = strings.TrimSpace(val)
+				case "proxycommand":
+					return ""
+				case "port":
+					port = strings.TrimSpace(val)
+				}
+			}
+			break
+		}
+	}
+	if destination == "" {
+		return ""
+	}
+
+	target, err := parseJumpHost(destination)
+	if err != nil {
+		return ""
+	}
+	host := target.Host
+	if port == "" && target.Port != 0 {
+		port = strconv.Itoa(target.Port)
+	}
+	if alias, ok := aliases[strings.ToLower(host)]; ok {
+		if alias.HostName != "" {
+			host = alias.HostName
+		}
+		if port == "" && alias.Port != 0 {
+			port = strconv.Itoa(alias.Port)
+		}
+		if jump == "" {
+			jump = alias.ProxyJump
+		}
+	}
+	if hops := parseProxyJump(jump); len(hops) > 0 {
+		return jumpHostAddress(hops[0], aliases)
+	}
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// jumpHostAddress returns the host:port of a jump host, resolving ssh_config aliases
+func jumpHostAddress(hop SSHJumpHost, aliases map[string]sshConfigHost) string {
+	if alias, ok := aliases[strings.ToLower(hop.Host)]; ok {
+		hop = resolveJumpAlias(hop, alias)
+	}
+	port := hop.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(hop.Host, strconv.Itoa(port))
+}
+
+// sshProbeStatus returns the title prefix and tooltip note for an entry's probed address,
+// or empty strings when it hasn't been probed (aliases is nil when nothing has been)
+func sshProbeStatus(entry SSHEntry, aliases map[string]sshConfigHost) (string, string) {
+	if aliases == nil {
+		return "", ""
+	}
+	address := sshProbeAddress(entry, aliases)
+	if address == "" {
+		return "", ""
+	}
+	probeResultsMutex.RLock()
+	result, ok := probeResults[address]
+	probeResultsMutex.RUnlock()
+	if !ok {
+		return "", ""
+	}
+	if !result.Reachable {
+		return "○ ", address + " unreachable: " + result.Err
+	}
+	return "● ", fmt.Sprintf("%s reachable in %d ms", address, result.Latency.Milliseconds())
+}
+
+// refreshSSHMenuStatus updates the SSH menu titles with the latest probe results
+func refreshSSHMenuStatus() {
+	if sshMenu == nil {
+		return
+	}
+	stateMutex.RLock()
+	entries := sshEntries
+	stateMutex.RUnlock()
+	cfg := currentConfig()
+	if cfg == nil || len(entries) == 0 {
+		return
+	}
+
+	aliases := sshProbeAliases(cfg)
+	sshMenu.Update(len(entries), func(i int, item *systray.MenuItem) {
+		title, tooltip := sshMenuItemText(entries[i], aliases)
+		item.SetTitle(title)
+		item.SetTooltip(tooltip)
+	})
+}
+
+// sshMenuItemText returns an SSH entry's menu title and tooltip, including its probe status
+func sshMenuItemText(entry SSHEntry, aliases map[string]sshConfigHost) (string, string) {
+	title := sshMenuTitle(entry)
+	tooltip := entry.Command
+	if entry.Mode == sshModeBuiltin {
+		tooltip = "builtin: " + sshEntryAddress(entry)
+	} else if isConsoleMode(entry.Mode) && entry.Command == "" {
+		tooltip = consoleTooltip(entry)
+	}
+	prefix, status := sshProbeStatus(entry, aliases)
+	if status != "" {
+		tooltip += " - " + status
+	}
+	return prefix + title, tooltip
+}
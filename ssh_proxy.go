@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// sshProxyDialTimeout bounds connecting to the gateway and reading its CONNECT response
+const sshProxyDialTimeout = 15 * time.Second
+
+// runSSHProxyCommand tunnels stdin/stdout to host:port through a Kerberos-authenticated
+// HTTP CONNECT gateway, for use as an ssh_config ProxyCommand
+func runSSHProxyCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ssh-proxy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	gateway := fs.String("gateway", "", "Gateway host:port (default: ssh_proxy.gateway from the config)")
+	spn := fs.String("spn", "", "SPN or config name for the gateway (default: ssh_proxy.spn, or HTTP/<gateway host>)")
+	useTLS := fs.Bool("tls", false, "Connect to the gateway over TLS (default: ssh_proxy.tls)")
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray ssh-proxy [--gateway host:port] [--spn spn] [--tls] [--debug] <host> <port>")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintf(stderr, "For ~/.ssh/config:  ProxyCommand krb5tray ssh-proxy %%h %%p\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+	proxyCfg := cfg.GetSSHProxyConfig()
+	if *gateway != "" {
+		proxyCfg.Gateway = *gateway
+	}
+	if *spn != "" {
+		proxyCfg.SPN = *spn
+	}
+	if *useTLS {
+		proxyCfg.TLS = true
+	}
+	if proxyCfg.Gateway == "" {
+		_, _ = fmt.Fprintln(stderr, "krb5tray: no gateway configured (set ssh_proxy.gateway or pass --gateway)")
+		return exitUsage
+	}
+
+	gatewayHost, _, err := net.SplitHostPort(proxyCfg.Gateway)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: invalid gateway %q: %v\n", proxyCfg.Gateway, err)
+		return exitUsage
+	}
+	gatewaySPN := "HTTP/" + gatewayHost
+	if proxyCfg.SPN != "" {
+		gatewaySPN = cfg.ResolveSPN(proxyCfg.SPN)
+	}
+
+	token, err := getServiceTicket(gatewaySPN)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: failed to get ticket for %s: %v\n", gatewaySPN, err)
+		return ticketErrorExitCode(classifyTicketError(err))
+	}
+	encoded := base64.StdEncoding.EncodeToString(token)
+	zeroBytes(token)
+
+	target := net.JoinHostPort(fs.Arg(0), fs.Arg(1))
+	conn, reader, err := dialConnectGateway(proxyCfg, target, encoded)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+	defer conn.Close()
+
+	relaySSHProxy(conn, reader, stdout)
+	return exitOK
+}
+
+// dialConnectGateway opens a CONNECT tunnel to target through the gateway.
+// The returned reader holds any bytes the gateway sent after its response.
+func dialConnectGateway(cfg SSHProxyConfig, target string, token string) (net.Conn, *bufio.Reader, error) {
+	dialer := &net.Dialer{Timeout: sshProxyDialTimeout}
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", cfg.Gateway, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", cfg.Gateway)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to gateway %s: %w", cfg.Gateway, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(sshProxyDialTimeout))
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\nProxy-Authorization: Negotiate %s\r\nUser-Agent: krb5tray/%s\r\n\r\n",
+		target, target, token, Version)
+	if _, err := io.WriteString(conn, req); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to send CONNECT to gateway: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to read gateway response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			return nil, nil, fmt.Errorf("gateway rejected Kerberos authentication: %s", resp.Status)
+		}
+		return nil, nil, fmt.Errorf("gateway refused CONNECT to %s: %s", target, resp.Status)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	return conn, reader, nil
+}
+
+// relaySSHProxy copies stdin to the tunnel and the tunnel to stdout until the server closes
+func relaySSHProxy(conn net.Conn, reader *bufio.Reader, stdout io.Writer) {
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+		// Let the server see EOF while still reading its remaining output
+		if c, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = c.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(stdout, reader)
+}
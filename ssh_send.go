@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// sshSendDefaultDelay is the wait before a send_after step without delay_ms
+const sshSendDefaultDelay = time.Second
+
+// sshSendDelay returns how long to wait before sending a step
+func sshSendDelay(step SSHSendStep) time.Duration {
+	if step.DelayMs > 0 {
+		return time.Duration(step.DelayMs) * time.Millisecond
+	}
+	return sshSendDefaultDelay
+}
+
+// runSendAfter sends each step's line after its delay, stopping at the first failure
+func runSendAfter(name string, steps []SSHSendStep, send func(line string) error) {
+	for i, step := range steps {
+		time.Sleep(sshSendDelay(step))
+		if err := send(step.Text); err != nil {
+			LogWarn("SSH %s: send_after step %d failed: %v", name, i+1, err)
+			return
+		}
+	}
+	LogDebug("SSH %s: sent %d send_after steps", name, len(steps))
+}
+
+// typeSendAfter types an entry's send_after lines into the new terminal, for terminals
+// that can't be driven any other way. The terminal is the window that has the focus at
+// the first step, provided it isn't previous, the one focused before it was opened; a
+// line is only typed while that window still has the focus, so nothing ends up in a
+// window the user switched to.
+func typeSendAfter(entry SSHEntry, previous uint64) {
+	if len(entry.SendAfter) == 0 {
+		return
+	}
+	var target uint64
+	go runSendAfter(entry.Name, entry.SendAfter, func(line string) error {
+		focused, err := focusedWindowPlatform()
+		if err != nil {
+			return err
+		}
+		switch {
+		case target == 0 && focused == previous:
+			err = fmt.Errorf("the terminal never got the focus")
+		case target == 0:
+			target = focused
+		case focused != target:
+			err = fmt.Errorf("the focus moved away from the terminal")
+		}
+		if err != nil {
+			setStatusError(fmt.Sprintf("SSH %s: send_after stopped, %v", entry.Name, err))
+			return err
+		}
+		return typeTextPlatform(line+"\n", time.Duration(clipboardOptions.TypeDelayMs)*time.Millisecond)
+	})
+}
+
+// sessionInput serializes writes to an SSH session's stdin from the terminal and from
+// send_after, so a typed line is never split by keystrokes
+type sessionInput struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func (s *sessionInput) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
+
+func (s *sessionInput) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,12 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// termios ioctl requests (see ssh_term_unix.go)
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
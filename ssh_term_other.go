@@ -0,0 +1,33 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+import "fmt"
+
+// termState is unused: terminal modes aren't supported on this platform
+type termState struct{}
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeTermRaw(fd int) (*termState, error) {
+	return nil, fmt.Errorf("raw terminal mode not supported on this platform")
+}
+
+func restoreTerm(fd int, state *termState) error {
+	return nil
+}
+
+func termSize(fd int) (int, int, error) {
+	return 0, 0, fmt.Errorf("terminal size not supported on this platform")
+}
+
+func readTermPassword(fd int) (string, error) {
+	return "", fmt.Errorf("password prompt not supported on this platform")
+}
+
+func watchTermResize(fd int, fn func(width, height int)) func() {
+	return func() {}
+}
@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// termState is a console's modes before makeTermRaw changed them
+type termState struct {
+	inMode     uint32
+	outMode    uint32
+	outChanged bool
+}
+
+// isTerminal reports whether fd is a console
+func isTerminal(fd int) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(fd), &mode) == nil
+}
+
+// makeTermRaw switches the console to raw VT input and enables VT output processing,
+// so keys go to the server and its escape sequences are rendered
+func makeTermRaw(fd int) (*termState, error) {
+	var state termState
+	if err := windows.GetConsoleMode(windows.Handle(fd), &state.inMode); err != nil {
+		return nil, err
+	}
+	raw := state.inMode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_OUTPUT)
+	raw |= windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(windows.Handle(fd), raw); err != nil {
+		return nil, err
+	}
+
+	out := windows.Handle(os.Stdout.Fd())
+	if windows.GetConsoleMode(out, &state.outMode) == nil {
+		mode := state.outMode | windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING | windows.ENABLE_PROCESSED_OUTPUT
+		state.outChanged = windows.SetConsoleMode(out, mode) == nil
+	}
+	return &state, nil
+}
+
+// restoreTerm restores the modes saved by makeTermRaw
+func restoreTerm(fd int, state *termState) error {
+	if state.outChanged {
+		_ = windows.SetConsoleMode(windows.Handle(os.Stdout.Fd()), state.outMode)
+	}
+	return windows.SetConsoleMode(windows.Handle(fd), state.inMode)
+}
+
+// termSize returns the console window's width and height in characters
+func termSize(fd int) (int, int, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right - info.Window.Left + 1), int(info.Window.Bottom - info.Window.Top + 1), nil
+}
+
+// readTermPassword reads a line from the console without echoing it
+func readTermPassword(fd int) (string, error) {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(fd), &mode); err != nil {
+		return "", err
+	}
+	hidden := (mode &^ windows.ENABLE_ECHO_INPUT) | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+	if err := windows.SetConsoleMode(windows.Handle(fd), hidden); err != nil {
+		return "", err
+	}
+	defer windows.SetConsoleMode(windows.Handle(fd), mode)
+
+	return readSecretLine(os.Stdin)
+}
+
+// watchTermResize polls the console size, since Windows has no resize signal, and calls fn
+// when it changes. The returned func stops watching.
+func watchTermResize(fd int, fn func(width, height int)) func() {
+	done := make(chan struct{})
+	go func() {
+		width, height, _ := termSize(fd)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w, h, err := termSize(fd)
+				if err == nil && (w != width || h != height) {
+					width, height = w, h
+					fn(width, height)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
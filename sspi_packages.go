@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"krb5tray/pkg/krb"
+)
+
+// runSSPIPackagesCommand lists the SSPI packages installed on Windows, marking the ones
+// sspi_package can select
+func runSSPIPackagesCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("sspi-packages", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Print a JSON record per package ({\"name\", \"comment\", \"capabilities\", \"max_token\"})")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray sspi-packages [--json]")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Lists the SSPI security packages installed on Windows. Those marked * can be")
+		_, _ = fmt.Fprintln(stderr, "set as sspi_package, at the top level or per SPN.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	packages, err := krb.SecurityPackages()
+	if errors.Is(err, krb.ErrUnsupported) {
+		_, _ = fmt.Fprintln(stderr, "krb5tray: SSPI packages exist only on Windows")
+		return exitUnsupported
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+		return exitFailure
+	}
+
+	if *asJSON {
+		for _, p := range packages {
+			writeCLIJSON(stdout, stderr, p)
+		}
+		return exitOK
+	}
+	for _, p := range packages {
+		mark := " "
+		if validSSPIPackage(strings.ToLower(p.Name)) {
+			mark = "*"
+		}
+		_, _ = fmt.Fprintf(stdout, "%s %-20s %6d  %s\n", mark, p.Name, p.MaxToken, p.Comment)
+	}
+	return exitOK
+}
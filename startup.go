@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// startupTimings records how long each startup phase took. Phases run in parallel, so
+// their durations don't add up to the total.
+type startupTimings struct {
+	mu     sync.Mutex
+	start  time.Time
+	phases []string
+}
+
+var startup = &startupTimings{start: time.Now()}
+
+var (
+	// startupConfig is the config runTray loaded for the log settings, reused to build the menus
+	startupConfig *Config
+
+	// startupWork is the initialization that runs in the background while the icon comes up
+	startupWork sync.WaitGroup
+)
+
+// timePhase runs fn and records how long it took
+func (t *startupTimings) timePhase(name string, fn func()) {
+	begin := time.Now()
+	fn()
+	t.record(name, time.Since(begin))
+}
+
+func (t *startupTimings) record(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, fmt.Sprintf("%s %s", name, d.Round(time.Millisecond)))
+}
+
+// done logs the phases and the time since the process started
+func (t *startupTimings) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	LogInfo("Startup complete in %s (%s)", time.Since(t.start).Round(time.Millisecond), strings.Join(t.phases, ", "))
+}
+
+// startBackgroundInit starts the initialization the menus don't need: restoring persisted
+// cache entries (which may ask a keystore for the key), looking up the principal, and
+// setting up the Lua engine
+func startBackgroundInit(cfg *Config) {
+	// The cache itself must exist before anything uses it; creating it is cheap
+	InitCache()
+
+	startupWork.Add(2)
+	go func() {
+		defer startupWork.Done()
+		startup.timePhase("cache", func() {
+			refreshCacheNamespace(cfg)
+			ApplyCacheConfig(cfg.GetCacheConfigWithDefaults())
+			ApplyCredentialPersistence(cfg)
+		})
+	}()
+	go func() {
+		defer startupWork.Done()
+		startup.timePhase("lua", func() {
+			if err := InitLuaEngine(); err != nil {
+				LogWarn("Failed to initialize Lua engine: %v", err)
+			}
+		})
+	}()
+}
+
+// finishStartup does what doesn't have to happen before the menu is usable: it runs once
+// the menus are built, so the icon doesn't wait on the KDC, the keystore, or hotkey
+// registration
+func finishStartup() {
+	// Show platform info in status
+	updatePlatformStatus()
+
+	// Accept commands from "krb5tray ctl"
+	if err := StartControlServer(); err != nil {
+		LogWarn("Control socket unavailable: %v", err)
+	}
+
+	// Reload, refresh, and quit on signals (unix)
+	StartSignalHandler()
+
+	hotkeysDone := make(chan struct{})
+	go func() {
+		defer close(hotkeysDone)
+		initHotkeys()
+	}()
+
+	startupWork.Wait()
+	updateCacheMenu() // Show restored entries
+
+	startup.timePhase("spn", func() {
+		// Select the SPN that was selected before a restart
+		restoreRestartState()
+
+		// Check for initial SPN from environment (fallback)
+		stateMutex.RLock()
+		selected := currentSPN != ""
+		stateMutex.RUnlock()
+		if spn := os.Getenv("KRB5_SPN"); spn != "" && !selected {
+			setSPN(spn, "Environment")
+		}
+	})
+
+	go runPendingTrayRequest()
+	go pruneHistory(currentConfig().GetHistoryConfigWithDefaults())
+
+	// Start the localhost REST API and proxy if enabled
+	cfg := currentConfig()
+	ApplyAPIConfig(cfg.GetAPIConfigWithDefaults())
+	ApplyProxyConfig(cfg.GetProxyConfigWithDefaults())
+	ApplySSHProbeConfig(cfg.GetSSHProbeConfigWithDefaults())
+	ApplyPrefetchConfig(cfg.GetPrefetchConfigWithDefaults())
+	ApplyKeytabConfig(cfg)
+	ApplyIdleLockConfig(cfg.GetIdleLockConfigWithDefaults())
+	ApplyVPNConfig(cfg.GetVPNConfigWithDefaults())
+	// Refresh the token after a sleep or a network switch
+	startWakeCheck()
+	renderStatusTemplates()
+	startStatusRefresh()
+
+	<-hotkeysDone
+	startup.done()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// statusPriority orders status updates; a higher one isn't replaced by a lower one right away
+type statusPriority int
+
+const (
+	statusInfo statusPriority = iota
+	statusError
+)
+
+const (
+	// statusMinInterval is the shortest time between two writes to the status item;
+	// updates in between are coalesced and only the last one is shown
+	statusMinInterval = 150 * time.Millisecond
+
+	// statusErrorHold is how long an error stays up before info updates may replace it
+	statusErrorHold = 5 * time.Second
+
+	// statusInfoTimeout and statusErrorTimeout are how long a line is shown before the
+	// default line is restored
+	statusInfoTimeout  = 30 * time.Second
+	statusErrorTimeout = 60 * time.Second
+)
+
+type statusUpdate struct {
+	text     string
+	priority statusPriority
+	at       time.Time
+}
+
+// statusLine coalesces updates of the tray's status item. Background jobs and hotkey
+// input can post many updates a second; writing each one makes the menu flicker and
+// floods the systray IPC.
+type statusLine struct {
+	mu        sync.Mutex
+	shown     statusUpdate
+	isDefault bool
+	pending   *statusUpdate
+	lastWrite time.Time
+	timer     *time.Timer
+}
+
+var trayStatus = &statusLine{isDefault: true}
+
+// setStatus shows text in the status item
+func setStatus(text string) {
+	trayStatus.post(text, statusInfo)
+}
+
+// setStatusError shows an error in the status item; it isn't replaced by info updates
+// for a few seconds, so it can be read
+func setStatusError(text string) {
+	trayStatus.post(text, statusError)
+}
+
+// defaultStatus is the line shown when the last update has timed out: status.format if
+// it is set, the current token's countdown (and since when the tray is offline) otherwise
+func defaultStatus() string {
+	cfg := currentConfig()
+	if format := cfg.GetStatusConfigWithDefaults().Format; format != "" {
+		return renderStatusFormat(cfg, format)
+	}
+
+	countdown := tokenCountdown(cfg)
+	if since := offlineSince(); !since.IsZero() {
+		if countdown != "" {
+			return fmt.Sprintf("Offline since %s - %s", since.Format("15:04"), countdown)
+		}
+		return fmt.Sprintf("Offline since %s", since.Format("15:04"))
+	}
+	if countdown != "" {
+		return countdown
+	}
+	return "Ready"
+}
+
+func (s *statusLine) post(text string, priority statusPriority) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Within one interval the last update wins, unless an earlier one is more important
+	if s.pending == nil || priority >= s.pending.priority {
+		s.pending = &statusUpdate{text: text, priority: priority}
+	}
+	s.flushLocked()
+}
+
+// flushLocked writes the pending update if that's allowed yet, restores the default line
+// if the shown one has timed out, and schedules itself for whichever comes next
+func (s *statusLine) flushLocked() {
+	if mStatus == nil {
+		s.pending = nil
+		return
+	}
+	now := time.Now()
+
+	var next time.Time
+	if s.pending != nil {
+		ready := s.lastWrite.Add(statusMinInterval)
+		if !s.isDefault && s.pending.priority < s.shown.priority {
+			if hold := s.shown.at.Add(statusErrorHold); hold.After(ready) {
+				ready = hold
+			}
+		}
+		if !now.Before(ready) {
+			s.pending.at = now
+			s.write(*s.pending, false)
+			s.pending = nil
+		} else {
+			next = ready
+		}
+	}
+
+	if s.pending == nil && !s.isDefault {
+		timeout := statusInfoTimeout
+		if s.shown.priority == statusError {
+			timeout = statusErrorTimeout
+		}
+		expires := s.shown.at.Add(timeout)
+		if !now.Before(expires) {
+			s.write(statusUpdate{text: defaultStatus(), at: now}, true)
+		} else {
+			next = expires
+		}
+	}
+
+	if next.IsZero() {
+		return
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(next.Sub(now), s.onTimer)
+	} else {
+		s.timer.Stop()
+		s.timer.Reset(next.Sub(now))
+	}
+}
+
+// refreshDefault renders the default line again if it is the one shown
+func (s *statusLine) refreshDefault() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mStatus == nil || !s.isDefault || s.pending != nil {
+		return
+	}
+	s.write(statusUpdate{text: defaultStatus(), at: time.Now()}, true)
+}
+
+func (s *statusLine) write(u statusUpdate, isDefault bool) {
+	if u.text != s.shown.text {
+		mStatus.SetTitle(u.text)
+	}
+	s.shown = u
+	s.isDefault = isDefault
+	s.lastWrite = u.at
+}
+
+func (s *statusLine) onTimer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/pkg/krb"
+)
+
+const (
+	// statusRefreshInterval is how often the default line and tooltip are rendered again,
+	// so ages and countdowns stay current
+	statusRefreshInterval = 30 * time.Second
+
+	// statusCredsMaxAge is how long the principal and TGT expiry are reused before the
+	// credential cache is read again
+	statusCredsMaxAge = time.Minute
+
+	defaultTooltip = "Kerberos Service Ticket Tool"
+)
+
+// statusVariablePattern matches a {name} in a status template
+var statusVariablePattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// statusVariables documents the names a status template can use
+var statusVariables = []string{"spn", "spn_full", "token_age", "token_time", "token_expiry", "tgt_expiry", "principal", "profile", "cached", "offline"}
+
+// statusCreds caches what the templates show about the user's credentials, since reading
+// them means opening the credential cache
+var statusCreds struct {
+	mu        sync.Mutex
+	at        time.Time
+	principal string
+	tgtExpiry time.Time
+	tgtErr    error
+}
+
+var statusRefreshOnce sync.Once
+
+// renderStatusFormat replaces the {name} variables in format. Unknown names are left as
+// they are.
+func renderStatusFormat(cfg *Config, format string) string {
+	stateMutex.RLock()
+	spn := currentSPN
+	name := currentSPNName
+	tokenTime := lastTokenTime
+	stateMutex.RUnlock()
+	if name == "" {
+		name = spn
+	}
+
+	return statusVariablePattern.ReplaceAllStringFunc(format, func(match string) string {
+		switch match[1 : len(match)-1] {
+		case "spn":
+			return orDash(name)
+		case "spn_full":
+			return orDash(spn)
+		case "token_age":
+			if tokenTime.IsZero() {
+				return "no token"
+			}
+			return formatDuration(time.Since(tokenTime))
+		case "token_time":
+			if tokenTime.IsZero() {
+				return "-"
+			}
+			return tokenTime.Format("15:04:05")
+		case "token_expiry":
+			life, ok := currentTokenLife()
+			if !ok {
+				return "no token"
+			}
+			left := time.Until(life.expires)
+			if left <= 0 {
+				return "expired"
+			}
+			return formatDuration(left)
+		case "tgt_expiry":
+			expiry, err := statusTGTExpiry()
+			switch {
+			case errors.Is(err, krb.ErrNoTGT):
+				return "no TGT"
+			case err != nil:
+				return "?"
+			case !expiry.After(time.Now()):
+				return "expired"
+			}
+			return formatDuration(time.Until(expiry).Round(time.Minute))
+		case "principal":
+			return orDash(statusPrincipal())
+		case "profile":
+			return cfg.GetProfile()
+		case "cached":
+			return strconv.Itoa(GetCache().ItemCount())
+		case "offline":
+			if since := offlineSince(); !since.IsZero() {
+				return "offline since " + since.Format("15:04")
+			}
+			return ""
+		}
+		return match
+	})
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// statusLookupCreds reads the principal and TGT expiry unless they were read recently
+func statusLookupCreds() {
+	statusCreds.mu.Lock()
+	defer statusCreds.mu.Unlock()
+	if time.Since(statusCreds.at) < statusCredsMaxAge {
+		return
+	}
+	statusCreds.at = time.Now()
+	statusCreds.principal = currentPrincipal()
+	statusCreds.tgtExpiry, statusCreds.tgtErr = krb.TGTExpiry(krbOptions())
+}
+
+func statusTGTExpiry() (time.Time, error) {
+	statusLookupCreds()
+	statusCreds.mu.Lock()
+	defer statusCreds.mu.Unlock()
+	return statusCreds.tgtExpiry, statusCreds.tgtErr
+}
+
+func statusPrincipal() string {
+	statusLookupCreds()
+	statusCreds.mu.Lock()
+	defer statusCreds.mu.Unlock()
+	return statusCreds.principal
+}
+
+// refreshStatusFormat renders the templated status line and tooltip again, and reads the
+// credentials afresh, since what they show may have just changed
+func refreshStatusFormat() {
+	statusCreds.mu.Lock()
+	statusCreds.at = time.Time{}
+	statusCreds.mu.Unlock()
+	renderStatusTemplates()
+}
+
+// renderStatusTemplates updates the default status line (if it is showing) and the tooltip,
+// which is the token countdown unless status.tooltip is set
+func renderStatusTemplates() {
+	if mStatus == nil {
+		return
+	}
+	cfg := currentConfig()
+	status := cfg.GetStatusConfigWithDefaults()
+	trayStatus.refreshDefault()
+	if status.Tooltip != "" {
+		systray.SetTooltip(renderStatusFormat(cfg, status.Tooltip))
+	} else if countdown := tokenCountdown(cfg); countdown != "" {
+		systray.SetTooltip(countdown)
+	} else {
+		systray.SetTooltip(defaultTooltip)
+	}
+}
+
+// startStatusRefresh keeps the default line and tooltip current, and refreshes the
+// selected SPN's token when it is expiring if status.auto_refresh is set
+func startStatusRefresh() {
+	statusRefreshOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(statusRefreshInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if !autoRefreshExpiringToken(currentConfig()) {
+					renderStatusTemplates()
+				}
+			}
+		}()
+	})
+}
+
+// unknownStatusVariables returns the {name}s in format that aren't status variables
+func unknownStatusVariables(format string) []string {
+	var unknown []string
+	for _, m := range statusVariablePattern.FindAllStringSubmatch(format, -1) {
+		if !containsString(statusVariables, m[1]) && !containsString(unknown, m[1]) {
+			unknown = append(unknown, m[1])
+		}
+	}
+	return unknown
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"sort"
 	"strings"
 )
 
@@ -15,63 +17,161 @@ import (
 //   - Linux alacritty: "/usr/bin/alacritty -e {cmd}"
 //   - Windows cmd: "C:\\Windows\\System32\\cmd.exe /k {cmd}"
 //   - Windows Terminal: "wt.exe {cmd}"
+//
+// If the entry has no terminal, the global "terminal" setting or the detected default is used.
 func openTerminal(entry SSHEntry) error {
+	cfg := currentConfig()
+
+	entry.Terminal = resolveTerminal(cfg, entry)
 	if entry.Terminal == "" {
-		return fmt.Errorf("no terminal configured for SSH connection")
+		return fmt.Errorf("no terminal configured for SSH connection and none detected")
 	}
 
-	// Replace {cmd} placeholder with the actual SSH command
-	cmdLine := strings.Replace(entry.Terminal, "{cmd}", entry.Command, -1)
-
-	LogDebug("Opening terminal: %s", cmdLine)
-
-	// Parse the command line into executable and arguments
-	args := parseCommandLine(cmdLine)
+	args := expandTerminalTemplate(entry.Terminal, entry.Command)
 	if len(args) == 0 {
 		return fmt.Errorf("invalid terminal command")
 	}
+	LogDebug("Opening terminal: %q", args)
 
 	cmd := exec.Command(args[0], args[1:]...)
+	if env := sshEntryEnv(entry); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Dir = sshEntryDir(entry)
 	return cmd.Start()
 }
 
-// parseCommandLine splits a command line into arguments, respecting quotes
+// sshEntryEnv returns the entry's environment as sorted NAME=value pairs.
+// Values may refer to the tray's own environment as $VAR.
+func sshEntryEnv(entry SSHEntry) []string {
+	var env []string
+	for name, value := range entry.Env {
+		env = append(env, name+"="+os.ExpandEnv(value))
+	}
+	sort.Strings(env)
+	return env
+}
+
+// sshEntryDir returns the entry's working directory with ~ and $VAR expanded, or ""
+func sshEntryDir(entry SSHEntry) string {
+	if entry.Cwd == "" {
+		return ""
+	}
+	return expandHomePath(os.ExpandEnv(entry.Cwd))
+}
+
+// expandSSHCommand replaces {NAME} in the entry's command with its env value, and {cwd}
+// with its working directory, for terminals that don't pass the environment on
+func expandSSHCommand(entry SSHEntry) string {
+	command := entry.Command
+	if !strings.Contains(command, "{") {
+		return command
+	}
+	for name, value := range entry.Env {
+		command = strings.ReplaceAll(command, "{"+name+"}", os.ExpandEnv(value))
+	}
+	if entry.Cwd != "" {
+		command = strings.ReplaceAll(command, "{cwd}", sshEntryDir(entry))
+	}
+	return command
+}
+
+// resolveTerminal returns the terminal template for an SSH entry: its own, the config default,
+// or one detected for this platform
+func resolveTerminal(cfg *Config, entry SSHEntry) string {
+	if entry.Terminal != "" {
+		return entry.Terminal
+	}
+	if cfg != nil && cfg.Terminal != "" {
+		return cfg.Terminal
+	}
+	return detectTerminal()
+}
+
+// expandTerminalTemplate returns the terminal's argv with the command substituted.
+// A bare {cmd} argument is replaced by the command's own arguments, so quoting in the
+// command survives. A quoted or embedded {cmd} (as in bash -c '{cmd}' or an AppleScript
+// string) gets the command line as text, with quotes and backslashes escaped where the
+// placeholder itself sits in double quotes inside the argument.
+func expandTerminalTemplate(template string, command string) []string {
+	var args []string
+	templateArgs, quoted := splitCommandLine(template)
+	for i, arg := range templateArgs {
+		switch {
+		case arg == "{cmd}" && !quoted[i]:
+			args = append(args, parseCommandLine(command)...)
+		case strings.Contains(arg, "{cmd}"):
+			arg = strings.ReplaceAll(arg, `"{cmd}"`, `"`+escapeDoubleQuoted(command)+`"`)
+			args = append(args, strings.ReplaceAll(arg, "{cmd}", command))
+		default:
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// escapeDoubleQuoted escapes s for a double-quoted string in AppleScript or a shell
+func escapeDoubleQuoted(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// parseCommandLine splits a command line into arguments on spaces and tabs.
+// Single and double quotes group text (and may appear mid-argument, as in --title="a b"),
+// the other quote character is literal inside them, and empty quotes are an empty argument.
+// A backslash escapes a following quote or space; any other backslash is literal, so
+// Windows paths need no doubling.
 func parseCommandLine(cmdLine string) []string {
+	args, _ := splitCommandLine(cmdLine)
+	return args
+}
+
+// splitCommandLine is parseCommandLine, also reporting which arguments used quotes
+func splitCommandLine(cmdLine string) ([]string, []bool) {
 	var args []string
+	var quoted []bool
 	var current strings.Builder
-	inQuote := false
+	inArg := false
+	wasQuoted := false
 	quoteChar := rune(0)
 
-	for _, r := range cmdLine {
+	runes := []rune(cmdLine)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
 		switch {
-		case r == '"' || r == '\'':
-			if inQuote && r == quoteChar {
-				// End of quoted section
-				inQuote = false
+		case r == '\\' && i+1 < len(runes) && quoteChar != '\'' &&
+			(runes[i+1] == '"' || runes[i+1] == '\'' || runes[i+1] == ' ' && quoteChar == 0):
+			// Escaped quote or space
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quoteChar != 0:
+			if r == quoteChar {
 				quoteChar = 0
-			} else if !inQuote {
-				// Start of quoted section
-				inQuote = true
-				quoteChar = r
 			} else {
-				// Different quote inside quotes, treat as literal
 				current.WriteRune(r)
 			}
-		case r == ' ' && !inQuote:
-			// Space outside quotes - end of argument
-			if current.Len() > 0 {
+		case r == '"' || r == '\'':
+			quoteChar = r
+			inArg = true
+			wasQuoted = true
+		case r == ' ' || r == '\t':
+			if inArg {
 				args = append(args, current.String())
+				quoted = append(quoted, wasQuoted)
 				current.Reset()
+				inArg = false
+				wasQuoted = false
 			}
 		default:
 			current.WriteRune(r)
+			inArg = true
 		}
 	}
 
-	// Don't forget the last argument
-	if current.Len() > 0 {
+	if inArg {
 		args = append(args, current.String())
+		quoted = append(quoted, wasQuoted)
 	}
-
-	return args
-}
\ No newline at end of file
+	return args, quoted
+}
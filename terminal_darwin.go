@@ -0,0 +1,12 @@
+package main
+
+import "os"
+
+// detectTerminal returns a terminal template for macOS, preferring iTerm2 when installed.
+// AppleScript is used because neither app runs a command passed on its command line.
+func detectTerminal() string {
+	if _, err := os.Stat("/Applications/iTerm.app"); err == nil {
+		return `osascript -e 'tell application "iTerm" to create window with default profile command "{cmd}"'`
+	}
+	return `osascript -e 'tell application "Terminal" to do script "{cmd}"' -e 'tell application "Terminal" to activate'`
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// linuxTerminals lists terminal templates in order of preference
+var linuxTerminals = []struct {
+	binary   string
+	template string
+}{
+	{"x-terminal-emulator", "x-terminal-emulator -e {cmd}"}, // Debian/Ubuntu alternatives
+	{"gnome-terminal", "gnome-terminal -- {cmd}"},
+	{"konsole", "konsole -e {cmd}"},
+	{"xfce4-terminal", "xfce4-terminal -x {cmd}"},
+	{"alacritty", "alacritty -e {cmd}"},
+	{"kitty", "kitty {cmd}"},
+	{"xterm", "xterm -e {cmd}"},
+}
+
+// detectTerminal returns a terminal template for the first installed terminal,
+// honoring $TERMINAL if it is set
+func detectTerminal() string {
+	if term := os.Getenv("TERMINAL"); term != "" {
+		if _, err := exec.LookPath(term); err == nil {
+			return term + " -e {cmd}"
+		}
+	}
+	for _, t := range linuxTerminals {
+		if _, err := exec.LookPath(t.binary); err == nil {
+			return t.template
+		}
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !windows && !linux
+// +build !darwin,!windows,!linux
+
+package main
+
+// detectTerminal has no default on this platform
+func detectTerminal() string {
+	return ""
+}
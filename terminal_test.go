@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"ssh admin@prod.example.com", []string{"ssh", "admin@prod.example.com"}},
+		{"  ssh \t -p 2222  host ", []string{"ssh", "-p", "2222", "host"}},
+		{`ssh host "tail -f /var/log/app.log"`, []string{"ssh", "host", "tail -f /var/log/app.log"}},
+		{`ssh host 'echo "$HOME"'`, []string{"ssh", "host", `echo "$HOME"`}},
+		{`ssh host "it's"`, []string{"ssh", "host", "it's"}},
+		{`--title="Prod Server" -e`, []string{"--title=Prod Server", "-e"}},
+		{`a "" b`, []string{"a", "", "b"}},
+		{`a '' b`, []string{"a", "", "b"}},
+		{`echo \"quoted\" two\ words`, []string{"echo", `"quoted"`, "two words"}},
+		{`"say \"hi\""`, []string{`say "hi"`}},
+		{`'single \"quotes\" are literal' x`, []string{`single \"quotes\" are literal`, "x"}},
+		{`C:\Windows\System32\cmd.exe /k ssh host`, []string{`C:\Windows\System32\cmd.exe`, "/k", "ssh", "host"}},
+		{`"C:\Program Files\PowerShell\7\pwsh.exe" -NoExit`, []string{`C:\Program Files\PowerShell\7\pwsh.exe`, "-NoExit"}},
+		{`\\fileserver\tools\plink.exe -serial COM3`, []string{`\\fileserver\tools\plink.exe`, "-serial", "COM3"}},
+		{"", nil},
+		{"   ", nil},
+	}
+	for _, tt := range tests {
+		if got := parseCommandLine(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCommandLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestExpandTerminalTemplate covers the terminal templates documented in the README and
+// the detected defaults
+func TestExpandTerminalTemplate(t *testing.T) {
+	const command = `ssh -t admin@prod.example.com "sudo -i"`
+	cmdArgs := []string{"ssh", "-t", "admin@prod.example.com", "sudo -i"}
+	with := func(prefix ...string) []string {
+		return append(prefix, cmdArgs...)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+	}{
+		{"Terminal.app", "/Applications/Utilities/Terminal.app/Contents/MacOS/Terminal {cmd}",
+			with("/Applications/Utilities/Terminal.app/Contents/MacOS/Terminal")},
+		{"iTerm2", "/Applications/iTerm.app/Contents/MacOS/iTerm2 {cmd}",
+			with("/Applications/iTerm.app/Contents/MacOS/iTerm2")},
+		{"Alacritty macOS", "/Applications/Alacritty.app/Contents/MacOS/alacritty -e {cmd}",
+			with("/Applications/Alacritty.app/Contents/MacOS/alacritty", "-e")},
+		{"gnome-terminal", "/usr/bin/gnome-terminal -- {cmd}", with("/usr/bin/gnome-terminal", "--")},
+		{"alacritty", "/usr/bin/alacritty -e {cmd}", with("/usr/bin/alacritty", "-e")},
+		{"konsole", "/usr/bin/konsole -e {cmd}", with("/usr/bin/konsole", "-e")},
+		{"cmd.exe", `C:\Windows\System32\cmd.exe /k {cmd}`, with(`C:\Windows\System32\cmd.exe`, "/k")},
+		{"Windows Terminal", "wt.exe {cmd}", with("wt.exe")},
+		{"PowerShell", "powershell.exe -NoExit -Command {cmd}", with("powershell.exe", "-NoExit", "-Command")},
+		{"xfce4-terminal", "xfce4-terminal -x {cmd}", with("xfce4-terminal", "-x")},
+		{"kitty", "kitty {cmd}", with("kitty")},
+		{"quoted placeholder", "bash -c '{cmd}; exec bash'", []string{"bash", "-c", command + "; exec bash"}},
+		{"whole quoted placeholder", `sh -c "{cmd}"`, []string{"sh", "-c", command}},
+		{"detected Terminal.app",
+			`osascript -e 'tell application "Terminal" to do script "{cmd}"' -e 'tell application "Terminal" to activate'`,
+			[]string{"osascript",
+				"-e", `tell application "Terminal" to do script "ssh -t admin@prod.example.com \"sudo -i\""`,
+				"-e", `tell application "Terminal" to activate`}},
+		{"detected iTerm2",
+			`osascript -e 'tell application "iTerm" to create window with default profile command "{cmd}"'`,
+			[]string{"osascript",
+				"-e", `tell application "iTerm" to create window with default profile command "ssh -t admin@prod.example.com \"sudo -i\""`}},
+	}
+	for _, tt := range tests {
+		if got := expandTerminalTemplate(tt.template, command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expandTerminalTemplate(%q) =\n  %q\nwant\n  %q", tt.name, tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTerminalTemplateBuiltinCommand(t *testing.T) {
+	// builtinSSHCommand quotes an executable path containing spaces
+	command := `"/Applications/krb5 tray.app/Contents/MacOS/krb5tray" ssh-session 3`
+	got := expandTerminalTemplate("xterm -e {cmd}", command)
+	want := []string{"xterm", "-e", "/Applications/krb5 tray.app/Contents/MacOS/krb5tray", "ssh-session", "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = expandTerminalTemplate(`osascript -e 'tell application "Terminal" to do script "{cmd}"'`, command)
+	script := `tell application "Terminal" to do script "\"/Applications/krb5 tray.app/Contents/MacOS/krb5tray\" ssh-session 3"`
+	if len(got) != 3 || got[2] != script {
+		t.Errorf("got %q, want script %q", got, script)
+	}
+}
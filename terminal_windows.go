@@ -0,0 +1,11 @@
+package main
+
+import "os/exec"
+
+// detectTerminal returns a terminal template for Windows, preferring Windows Terminal
+func detectTerminal() string {
+	if _, err := exec.LookPath("wt.exe"); err == nil {
+		return "wt.exe {cmd}"
+	}
+	return "cmd.exe /k {cmd}"
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/getlantern/systray"
+
+	"krb5tray/internal/cache"
+	"krb5tray/pkg/krb"
+)
+
+var mDestroyCredentials *systray.MenuItem
+
+// purgeTickets removes the logon session's Kerberos tickets (klist purge) and the tokens
+// cached from them, so the next request gets tickets with current group memberships
+func purgeTickets() error {
+	if err := krb.PurgeTickets(); err != nil {
+		return err
+	}
+
+	purged := dropCachedTokens()
+	refreshStatusFormat()
+	updateCredentialsMenu()
+
+	LogAction("tickets_purged", fmt.Sprintf("Kerberos tickets purged, %d cached tokens dropped", purged))
+	return nil
+}
+
+// dropCachedTokens deletes the cached tokens and the current one, and returns how many
+// were cached
+func dropCachedTokens() int {
+	purged := 0
+	for _, entry := range GetCache().ListEntries() {
+		if entry.Type == "token" {
+			GetCache().DeleteToken(strings.TrimPrefix(entry.Key, cache.PrefixToken))
+			purged++
+		}
+	}
+	setLastToken(nil, time.Time{})
+	setTokenItemsEnabled(false)
+	updateCacheMenu()
+	return purged
+}
+
+// destroyCredentials destroys the credential cache tickets are requested from, like
+// kdestroy (the logon session's tickets on Windows, like klist purge), and drops the
+// tokens cached from it. The tokens go even if the cache can't be destroyed.
+func destroyCredentials() (string, error) {
+	purged := dropCachedTokens()
+	krb.ForgetImportedCredential()
+	if credentialPersisting.Load() {
+		if err := deleteSavedCredential(); err != nil && !errors.Is(err, errNoSavedCredential) {
+			LogWarn("Failed to delete the saved Kerberos credential: %v", err)
+		}
+	}
+
+	opts := krbOptions()
+	err := krb.DestroyCache(opts)
+	if errors.Is(err, krb.ErrUnsupported) && krb.IsWindows() {
+		err = krb.PurgeTickets()
+	}
+	refreshStatusFormat()
+	updateCredentialsMenu()
+	updateCachesMenu()
+	if err != nil {
+		LogAction("credentials_destroyed", fmt.Sprintf("%d cached tokens dropped, destroying the credential cache failed: %v", purged, err))
+		return "", fmt.Errorf("%d cached tokens dropped, but the credential cache wasn't destroyed: %w", purged, err)
+	}
+
+	msg := fmt.Sprintf("Credentials destroyed, %d cached tokens dropped", purged)
+	LogActionWithFields("credentials_destroyed", msg, map[string]interface{}{
+		"ccache": valueOrDash(opts.CCache),
+	})
+	if _, ok := keytabConfig(currentConfig()); ok {
+		msg += " (the keytab gets a new TGT within a minute)"
+	}
+	return msg, nil
+}
+
+// renewTGT has the LSA request a new TGT, as kinit -R does elsewhere, and reports when it
+// expires
+func renewTGT() (string, error) {
+	expiry, err := krb.RenewTGT()
+	if err != nil {
+		return "", err
+	}
+	refreshStatusFormat()
+	updateCredentialsMenu()
+	msg := fmt.Sprintf("TGT renewed, valid until %s", expiry.Format("2006-01-02 15:04"))
+	LogAction("tgt_renewed", msg)
+	return msg, nil
+}
+
+// renewAnyTGT renews the TGT through the LSA on Windows, from the keytab if one is
+// configured, and with kinit -R elsewhere, which needs a renewable TGT; why is logged with
+// the renewal
+func renewAnyTGT(why string) (string, error) {
+	if krb.IsWindows() {
+		return renewTGT()
+	}
+	if kt, ok := keytabConfig(currentConfig()); ok {
+		return renewFromKeytab(kt, why)
+	}
+	output, err := exec.Command("kinit", "-R").CombinedOutput()
+	if err != nil {
+		if text := strings.TrimSpace(string(output)); text != "" {
+			return "", fmt.Errorf("kinit -R: %s", text)
+		}
+		return "", fmt.Errorf("kinit -R: %w", err)
+	}
+	// A credential restored from the last run would still hold the old TGT
+	krb.ForgetImportedCredential()
+	refreshStatusFormat()
+	updateCredentialsMenu()
+	LogAction("tgt_renewed", "TGT renewed with kinit -R "+why)
+	return "TGT renewed", nil
+}
+
+func handlePurgeTicketsClick() {
+	for range mPurgeTickets.ClickedCh {
+		noteUserActivity()
+		if err := purgeTickets(); err != nil {
+			LogError("Purging tickets failed: %v", err)
+			setStatusError(fmt.Sprintf("Purge failed: %s", truncateError(err)))
+			continue
+		}
+		setStatus("Tickets purged")
+		notifyUser("Tickets purged", "Kerberos tickets and cached tokens were removed")
+	}
+}
+
+func handleDestroyCredentialsClick() {
+	for range mDestroyCredentials.ClickedCh {
+		noteUserActivity()
+		if !ConfirmDialog("Destroy Credentials", destroyCredentialsPrompt()) {
+			continue
+		}
+		msg, err := destroyCredentials()
+		if err != nil {
+			LogError("Destroying credentials failed: %v", err)
+			setStatusError(fmt.Sprintf("Destroy failed: %s", truncateError(err)))
+			continue
+		}
+		setStatus(msg)
+		notifyUser("Credentials destroyed", "Kerberos tickets and cached tokens were removed")
+	}
+}
+
+// destroyCredentialsPrompt asks to destroy the tickets of the current principal
+func destroyCredentialsPrompt() string {
+	whose := "the Kerberos tickets"
+	if principal := currentPrincipal(); principal != "" {
+		whose = "the Kerberos tickets of " + principal
+	}
+	if krb.IsWindows() {
+		return fmt.Sprintf("Remove %s and the cached tokens? Windows gets a new TGT on the next request.", whose)
+	}
+	return fmt.Sprintf("Destroy %s and the cached tokens? You will need kinit to get new ones.", whose)
+}
+
+func handleRenewTGTClick() {
+	for range mRenewTGT.ClickedCh {
+		noteUserActivity()
+		msg, err := renewTGT()
+		if err != nil {
+			LogError("Renewing the TGT failed: %v", err)
+			setStatusError(fmt.Sprintf("Renew failed: %s", truncateError(err)))
+			continue
+		}
+		setStatus(msg)
+	}
+}
+
+func ctlPurgeTickets(args []string) (string, error) {
+	if err := purgeTickets(); err != nil {
+		return "", err
+	}
+	return "Tickets purged", nil
+}
+
+func ctlDestroy(args []string) (string, error) {
+	return destroyCredentials()
+}
+
+func ctlRenewTGT(args []string) (string, error) {
+	return renewTGT()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"krb5tray/pkg/krb"
+)
+
+// Ticket failure classes, reported as "error_class" in --json output
+const (
+	ticketErrNoTGT          = "no_tgt"          // No (or an expired) TGT: kinit or sign in again
+	ticketErrKDCUnreachable = "kdc_unreachable" // The KDC or domain controller couldn't be reached
+	ticketErrBadSPN         = "bad_spn"         // The SPN is malformed or unknown to the KDC
+	ticketErrClockSkew      = "clock_skew"      // The clock is too far from the KDC's
+	ticketErrUnsupported    = "unsupported"     // Not supported on this platform
+	ticketErrOther          = "error"           // Anything else
+)
+
+// SSPI status codes (winerror.h) that identify a failure class on Windows
+const (
+	secETargetUnknown             = 0x80090303
+	secENoCredentials             = 0x8009030E
+	secENoAuthenticatingAuthority = 0x80090311
+	secEWrongPrincipal            = 0x80090322
+	secEContextExpired            = 0x80090317
+	secETimeSkew                  = 0x80090324
+)
+
+// ticketErrorKinds maps the failure classes to the krb error kinds, in the order they are
+// checked
+var ticketErrorKinds = []struct {
+	class string
+	kind  error
+}{
+	{ticketErrUnsupported, krb.ErrUnsupported},
+	{ticketErrKDCUnreachable, krb.ErrKDCUnreachable},
+	{ticketErrKDCUnreachable, errTicketTimeout},
+	{ticketErrClockSkew, krb.ErrClockSkew},
+	{ticketErrBadSPN, krb.ErrBadSPN},
+	{ticketErrNoTGT, krb.ErrNoTGT},
+}
+
+// Message fragments (lowercase) that identify a failure class. The transports wrap errors
+// from gokrb5, GSS.framework, and SSPI, which don't share error types, so messages are matched.
+var ticketErrorPatterns = []struct {
+	class     string
+	fragments []string
+}{
+	{ticketErrUnsupported, []string{"unsupported platform"}},
+	{ticketErrKDCUnreachable, []string{
+		"cannot contact any kdc", "unable to reach any kdc", "networking_error", "error sending to kdc",
+		"no authority could be contacted", "connection refused", "i/o timeout", "no such host",
+		"network is unreachable",
+	}},
+	{ticketErrClockSkew, []string{"clock skew", "krb_ap_err_skew", "time skew", "skew too great"}},
+	{ticketErrBadSPN, []string{
+		"invalid spn", "principal unknown", "principal_unknown", "server not found in kerberos database",
+		"target is unknown",
+	}},
+	{ticketErrNoTGT, []string{
+		"ccache", "credentials cache", "no credentials", "no kerberos credentials", "no default credential",
+		"ticket expired", "tkt_expired", "credentials have expired",
+	}},
+}
+
+// classifyTicketError returns the failure class of an error from getServiceTicket
+func classifyTicketError(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, k := range ticketErrorKinds {
+		if errors.Is(err, k.kind) {
+			return k.class
+		}
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch uint32(errno) {
+		case secENoCredentials, secEContextExpired:
+			return ticketErrNoTGT
+		case secENoAuthenticatingAuthority:
+			return ticketErrKDCUnreachable
+		case secETargetUnknown, secEWrongPrincipal:
+			return ticketErrBadSPN
+		case secETimeSkew:
+			return ticketErrClockSkew
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, p := range ticketErrorPatterns {
+		for _, fragment := range p.fragments {
+			if strings.Contains(msg, fragment) {
+				return p.class
+			}
+		}
+	}
+	return ticketErrOther
+}
+
+// asTicketError returns err as a krb.Error of its failure class, so callers can test for the
+// kind with errors.Is when the transport only gave a message or an SSPI status
+func asTicketError(err error) error {
+	if err == nil {
+		return nil
+	}
+	class := classifyTicketError(err)
+	for _, k := range ticketErrorKinds {
+		if k.class == class {
+			if errors.Is(err, k.kind) {
+				return err
+			}
+			return &krb.Error{Kind: k.kind, Err: err}
+		}
+	}
+	return err
+}
+
+// ticketErrorHint returns what to do about a failure class, or "" when there is nothing
+// specific to suggest
+func ticketErrorHint(class string) string {
+	switch class {
+	case ticketErrNoTGT:
+		switch runtime.GOOS {
+		case "windows":
+			return "Sign in to Windows again, or use Renew TGT"
+		case "darwin":
+			return "Run kinit, or renew the ticket in Ticket Viewer"
+		}
+		return "Run kinit"
+	case ticketErrKDCUnreachable:
+		return "Connect to the VPN or the corporate network"
+	case ticketErrClockSkew:
+		return "Sync the system clock with the domain"
+	case ticketErrBadSPN:
+		return "Check the SPN spelling"
+	}
+	return ""
+}
+
+// ticketErrorTitles are the short descriptions of the failure classes in the status line
+var ticketErrorTitles = map[string]string{
+	ticketErrNoTGT:          "No valid TGT",
+	ticketErrKDCUnreachable: "KDC unreachable",
+	ticketErrClockSkew:      "Clock skew",
+	ticketErrBadSPN:         "Unknown SPN",
+	ticketErrUnsupported:    "Unsupported platform",
+}
+
+// describeTicketError says what went wrong and what to do about it, for the status line and
+// notifications; unrecognized errors are described by their (truncated) message
+func describeTicketError(err error) string {
+	class := classifyTicketError(err)
+	title, ok := ticketErrorTitles[class]
+	if !ok {
+		return fmt.Sprintf("Error: %s", truncateError(err))
+	}
+	if hint := ticketErrorHint(class); hint != "" {
+		return fmt.Sprintf("%s: %s", title, strings.ToLower(hint[:1])+hint[1:])
+	}
+	return title
+}
+
+// ticketErrorNotice is the error followed by what to do about it, for notifications and
+// the CLI, which have room for the whole message
+func ticketErrorNotice(err error) string {
+	if hint := ticketErrorHint(classifyTicketError(err)); hint != "" {
+		return fmt.Sprintf("%v. %s.", err, hint)
+	}
+	return err.Error()
+}
+
+// ticketErrorExitCode maps a failure class to the CLI exit code
+func ticketErrorExitCode(class string) int {
+	switch class {
+	case "":
+		return exitOK
+	case ticketErrNoTGT:
+		return exitNoTGT
+	case ticketErrKDCUnreachable:
+		return exitKDCUnreachable
+	case ticketErrBadSPN:
+		return exitBadSPN
+	case ticketErrUnsupported:
+		return exitUnsupported
+	case ticketErrClockSkew:
+		return exitClockSkew
+	}
+	return exitFailure
+}
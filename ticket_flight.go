@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// DefaultKDCTimeoutSec is how long a ticket request is waited for unless kdc_timeout_sec
+// says otherwise
+const DefaultKDCTimeoutSec = 30
+
+var (
+	// errTicketTimeout is returned when the KDC didn't answer within kdc_timeout_sec;
+	// it counts as unreachable
+	errTicketTimeout = errors.New("no answer from the KDC")
+
+	// errTicketCancelled is returned to the callers of a request cancelled from the menu
+	// or with ctl cancel
+	errTicketCancelled = errors.New("ticket request cancelled")
+)
+
+// ticketFlight is a ticket request in progress. It runs in its own goroutine, so callers
+// can stop waiting for it when it times out or is cancelled; a transport call that hangs
+// can't be interrupted and is left to finish on its own. Callers asking for the same SPN
+// meanwhile wait for the same request instead of asking the KDC again. Each gets a copy of
+// the token, and the shared one is zeroed once the request is done and every caller has
+// taken its copy or stopped waiting.
+type ticketFlight struct {
+	done     chan struct{}
+	cancel   chan struct{}
+	token    []byte
+	err      error
+	finished bool
+	callers  int
+}
+
+var (
+	// ticketFlightsMutex guards ticketFlights and the fields of each flight
+	ticketFlightsMutex sync.Mutex
+	ticketFlights      = map[string]*ticketFlight{}
+
+	// spnLocksMutex guards spnLocks
+	spnLocksMutex sync.Mutex
+	spnLocks      = map[string]*sync.Mutex{}
+
+	// mCancelTicket is shown while a ticket request is in flight
+	mCancelTicket *systray.MenuItem
+)
+
+// sharedTicketRequest runs request for spn unless a request for it is already in flight,
+// and waits up to timeout for the result
+func sharedTicketRequest(spn string, timeout time.Duration, request func() ([]byte, error)) ([]byte, error) {
+	ticketFlightsMutex.Lock()
+	f, inFlight := ticketFlights[spn]
+	if !inFlight {
+		f = &ticketFlight{done: make(chan struct{}), cancel: make(chan struct{})}
+		ticketFlights[spn] = f
+		go f.run(spn, request)
+	}
+	f.callers++
+	ticketFlightsMutex.Unlock()
+	if inFlight {
+		LogDebug("Waiting for the ticket request already in flight for SPN")
+	}
+	updateCancelTicketItem()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var err error
+	select {
+	case <-f.done:
+	case <-f.cancel:
+		err = errTicketCancelled
+	case <-expired:
+		err = fmt.Errorf("%w within %s", errTicketTimeout, formatDuration(timeout))
+		// The next caller starts over instead of waiting for a KDC that hangs
+		ticketFlightsMutex.Lock()
+		if ticketFlights[spn] == f {
+			delete(ticketFlights, spn)
+		}
+		ticketFlightsMutex.Unlock()
+		updateCancelTicketItem()
+	}
+
+	ticketFlightsMutex.Lock()
+	var token []byte
+	if err == nil {
+		if err = f.err; err == nil {
+			token = append([]byte(nil), f.token...)
+		}
+	}
+	f.callers--
+	last := f.callers == 0 && f.finished
+	ticketFlightsMutex.Unlock()
+	if last {
+		zeroBytes(f.token)
+	}
+	return token, err
+}
+
+// run does the request and wakes the callers still waiting
+func (f *ticketFlight) run(spn string, request func() ([]byte, error)) {
+	token, err := request()
+
+	ticketFlightsMutex.Lock()
+	f.token, f.err = token, err
+	f.finished = true
+	if ticketFlights[spn] == f {
+		delete(ticketFlights, spn)
+	}
+	last := f.callers == 0
+	ticketFlightsMutex.Unlock()
+	close(f.done)
+	if last {
+		// Everyone stopped waiting
+		zeroBytes(token)
+	}
+	updateCancelTicketItem()
+}
+
+// cancelTicketRequests stops waiting for every ticket request in flight and returns how
+// many there were
+func cancelTicketRequests() int {
+	ticketFlightsMutex.Lock()
+	n := len(ticketFlights)
+	for spn, f := range ticketFlights {
+		close(f.cancel)
+		delete(ticketFlights, spn)
+	}
+	ticketFlightsMutex.Unlock()
+	updateCancelTicketItem()
+	if n > 0 {
+		LogAction("ticket_cancelled", fmt.Sprintf("Cancelled %d ticket requests", n))
+	}
+	return n
+}
+
+// updateCancelTicketItem shows Cancel Ticket Request while a request is in flight
+func updateCancelTicketItem() {
+	// Headless subcommands have no tray menu
+	if mCancelTicket == nil {
+		return
+	}
+	ticketFlightsMutex.Lock()
+	n := len(ticketFlights)
+	ticketFlightsMutex.Unlock()
+	if n == 0 {
+		mCancelTicket.Hide()
+		return
+	}
+	mCancelTicket.SetTitle(fmt.Sprintf("Cancel Ticket Request (%d)", n))
+	mCancelTicket.Show()
+}
+
+// handleCancelTicketClick has its own goroutine, since the menu loop may be the one waiting
+// for the KDC
+func handleCancelTicketClick(item *systray.MenuItem) {
+	for range item.ClickedCh {
+		noteUserActivity()
+		if cancelTicketRequests() == 0 {
+			setStatus("No ticket request to cancel")
+		}
+	}
+}
+
+// ctlCancel stops waiting for the ticket requests in flight. handleControlConn runs it
+// without the control mutex.
+func ctlCancel(args []string) (string, error) {
+	n := cancelTicketRequests()
+	if n == 0 {
+		return "No ticket request in flight", nil
+	}
+	return fmt.Sprintf("Cancelled %d ticket requests", n), nil
+}
+
+// lockSPN serializes looking up and requesting the cached token of spn, so a caller that
+// finds nothing cached doesn't request a token another one is about to cache. The returned
+// function unlocks.
+func lockSPN(spn string) func() {
+	spnLocksMutex.Lock()
+	mu := spnLocks[spn]
+	if mu == nil {
+		mu = &sync.Mutex{}
+		spnLocks[spn] = mu
+	}
+	spnLocksMutex.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
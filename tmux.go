@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/getlantern/systray"
+)
+
+// tmuxOwnerOption is a session option set on sessions created by ktray, so they can be
+// listed separately from the user's own sessions
+const tmuxOwnerOption = "@ktray"
+
+var (
+	mTmuxMenu     *systray.MenuItem
+	tmuxMenu      *menuList
+	tmuxMenuNames []string
+)
+
+// runTmux runs a tmux command and returns its trimmed output
+func runTmux(args ...string) (string, error) {
+	out, err := exec.Command("tmux", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("tmux %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// openInTmux runs entry.Command in a window named after the entry in its tmux session.
+// The session is created if needed, an existing window for the entry is reused, and a
+// terminal is opened on the session unless a client is already attached.
+func openInTmux(entry SSHEntry) error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux not found on PATH")
+	}
+	session := entry.Tmux
+	target := "=" + session
+
+	// The tmux server may predate this client, so env and cwd are passed explicitly
+	var extra []string
+	for _, env := range sshEntryEnv(entry) {
+		extra = append(extra, "-e", env)
+	}
+	if dir := sshEntryDir(entry); dir != "" {
+		extra = append(extra, "-c", dir)
+	}
+
+	var window string
+	if _, err := runTmux("has-session", "-t", target); err != nil {
+		args := append([]string{"new-session", "-d", "-P", "-F", "#{window_id}", "-s", session, "-n", entry.Name}, extra...)
+		if window, err = runTmux(append(args, entry.Command)...); err != nil {
+			return err
+		}
+		if _, err := runTmux("set-option", "-t", target+":", tmuxOwnerOption, "1"); err != nil {
+			LogWarn("Failed to mark tmux session %s: %v", session, err)
+		}
+		updateTmuxMenu()
+	} else {
+		windows, err := runTmux("list-windows", "-t", target, "-F", "#{window_index}\t#{window_name}")
+		if err != nil {
+			return err
+		}
+		// Windows are selected by index since names may contain target separators
+		if index, found := tmuxWindowIndex(windows, entry.Name); found {
+			_, err = runTmux("select-window", "-t", target+":"+index)
+		} else {
+			args := append([]string{"new-window", "-P", "-F", "#{window_id}", "-t", target + ":", "-n", entry.Name}, extra...)
+			window, err = runTmux(append(args, entry.Command)...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only new windows get send_after; a reused one is already set up. Builtin sessions
+	// send it themselves.
+	if window != "" && entry.Mode != sshModeBuiltin && len(entry.SendAfter) > 0 {
+		go runSendAfter(entry.Name, entry.SendAfter, func(line string) error {
+			if _, err := runTmux("send-keys", "-t", window, "-l", line); err != nil {
+				return err
+			}
+			_, err := runTmux("send-keys", "-t", window, "Enter")
+			return err
+		})
+	}
+
+	clients, _ := runTmux("list-clients", "-t", target)
+	if clients != "" {
+		LogDebug("tmux session %s already has a client attached", session)
+		return nil
+	}
+	return attachTmuxSession(entry, session)
+}
+
+// attachTmuxSession opens a terminal attached to a tmux session
+func attachTmuxSession(entry SSHEntry, session string) error {
+	target := "=" + session
+	if strings.Contains(target, " ") {
+		target = `"` + target + `"`
+	}
+	entry.Command = "tmux attach-session -t " + target
+	return openTerminal(entry)
+}
+
+// listTmuxSessions returns the names of the tmux sessions created by ktray
+func listTmuxSessions() []string {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return nil
+	}
+	// Fails when no tmux server is running, which just means there are no sessions
+	out, err := runTmux("list-sessions", "-F", "#{session_name}\t#{"+tmuxOwnerOption+"}")
+	if err != nil {
+		return nil
+	}
+	var sessions []string
+	for _, line := range strings.Split(out, "\n") {
+		name, owner, _ := strings.Cut(line, "\t")
+		if owner == "1" {
+			sessions = append(sessions, name)
+		}
+	}
+	return sessions
+}
+
+// tmuxWindowIndex returns the index of the named window in list-windows output
+func tmuxWindowIndex(windows string, name string) (string, bool) {
+	for _, line := range strings.Split(windows, "\n") {
+		index, windowName, _ := strings.Cut(line, "\t")
+		if windowName == name {
+			return index, true
+		}
+	}
+	return "", false
+}
+
+// loadAndBuildTmuxMenu adds the "tmux Sessions" submenu to the SSH menu, above its entries
+func loadAndBuildTmuxMenu() {
+	mTmuxMenu = mSSHMenu.AddSubMenuItem("tmux Sessions", "Attach to tmux sessions opened by ktray")
+	tmuxMenu = newMenuList(mTmuxMenu, handleTmuxClick, nil)
+
+	updateTmuxMenu()
+}
+
+// updateTmuxMenu lists the current ktray tmux sessions
+func updateTmuxMenu() {
+	if tmuxMenu == nil {
+		return
+	}
+
+	sessions := listTmuxSessions()
+	stateMutex.Lock()
+	tmuxMenuNames = sessions
+	stateMutex.Unlock()
+
+	if len(sessions) == 0 {
+		tmuxMenu.ShowPlaceholder("No tmux sessions", "Set \"tmux\" on an SSH entry to open it in a tmux session")
+		return
+	}
+	tmuxMenu.Show(len(sessions), func(i int, item *systray.MenuItem) {
+		item.SetTitle(sessions[i])
+		item.SetTooltip("Attach to tmux session " + sessions[i])
+	})
+}
+
+func handleTmuxClick(index int) {
+	stateMutex.RLock()
+	var name string
+	if index < len(tmuxMenuNames) {
+		name = tmuxMenuNames[index]
+	}
+	stateMutex.RUnlock()
+	if name == "" {
+		return
+	}
+
+	if _, err := runTmux("has-session", "-t", "="+name); err != nil {
+		setStatus(fmt.Sprintf("tmux session %s has ended", name))
+		updateTmuxMenu()
+		return
+	}
+	if err := attachTmuxSession(SSHEntry{Name: name}, name); err != nil {
+		LogError("Failed to attach tmux session %s: %v", name, err)
+		setStatusError(fmt.Sprintf("tmux failed: %s", truncateError(err)))
+	} else {
+		setStatus(fmt.Sprintf("tmux: %s", name))
+	}
+}
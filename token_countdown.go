@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultExpiringMin is how many minutes before the selected SPN's token expires the
+// countdown says it is expiring, unless status.expiring_min is set
+const DefaultExpiringMin = 2
+
+var (
+	// autoRefreshMutex guards autoRefreshedFor
+	autoRefreshMutex sync.Mutex
+
+	// autoRefreshedFor is when the token that was last refreshed for expiring was requested,
+	// so a failed refresh isn't repeated on every tick
+	autoRefreshedFor time.Time
+)
+
+// tokenLife is the selected SPN's current token: who it is for and when it was requested
+// and expires
+type tokenLife struct {
+	name    string
+	issued  time.Time
+	expires time.Time
+}
+
+// currentTokenLife returns the current token's life. The expiry is that of its cache entry,
+// else the SPN's token_ttl_sec after it was requested. It reports false without a token.
+func currentTokenLife() (tokenLife, bool) {
+	stateMutex.RLock()
+	spn := currentSPN
+	name := currentSPNName
+	issued := lastTokenTime
+	stateMutex.RUnlock()
+	if spn == "" || issued.IsZero() {
+		return tokenLife{}, false
+	}
+	if name == "" {
+		name = spn
+	}
+
+	life := tokenLife{name: name, issued: issued, expires: issued.Add(configOrFile().GetTokenTTL(spn))}
+	if expires, found := GetCache().TokenExpiry(spn); found {
+		life.expires = expires
+	}
+	return life, true
+}
+
+// tokenCountdown describes how long the current token has left, e.g. "App – 7m left", and
+// says it is expiring within status.expiring_min. It is empty without a token.
+func tokenCountdown(cfg *Config) string {
+	life, ok := currentTokenLife()
+	if !ok {
+		return ""
+	}
+	left := time.Until(life.expires)
+	switch {
+	case left <= 0:
+		return fmt.Sprintf("%s – token expired", life.name)
+	case left <= cfg.GetStatusConfigWithDefaults().expiringLead():
+		return fmt.Sprintf("%s – expiring in %s", life.name, formatDuration(left))
+	}
+	return fmt.Sprintf("%s – %s left", life.name, formatDuration(left))
+}
+
+// expiringLead is how long before expiry a token counts as expiring
+func (s StatusConfig) expiringLead() time.Duration {
+	return time.Duration(s.ExpiringMin) * time.Minute
+}
+
+// autoRefreshExpiringToken requests a new token for the selected SPN if status.auto_refresh
+// is set and the current one is expiring, once per token. It reports whether it did.
+func autoRefreshExpiringToken(cfg *Config) bool {
+	status := cfg.GetStatusConfigWithDefaults()
+	if !status.AutoRefresh || trayOffline() || trayIdleLocked() {
+		return false
+	}
+	life, ok := currentTokenLife()
+	if !ok {
+		return false
+	}
+	left := time.Until(life.expires)
+	if left > status.expiringLead() {
+		return false
+	}
+
+	autoRefreshMutex.Lock()
+	if autoRefreshedFor.Equal(life.issued) {
+		autoRefreshMutex.Unlock()
+		return false
+	}
+	autoRefreshedFor = life.issued
+	autoRefreshMutex.Unlock()
+
+	if left > 0 {
+		LogAction("token_auto_refresh", fmt.Sprintf("Token for %s expires in %s, requesting a new one", life.name, formatDuration(left)))
+	} else {
+		LogAction("token_auto_refresh", fmt.Sprintf("Token for %s expired, requesting a new one", life.name))
+	}
+	refreshToken()
+	return true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenPrefetcher requests tokens for the configured SPNs on an interval until stopped,
+// so copying a header or serving an API request doesn't wait on the KDC
+type tokenPrefetcher struct {
+	cfg  PrefetchConfig
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	prefetchMutex  sync.Mutex
+	activePrefetch *tokenPrefetcher
+)
+
+// ApplyPrefetchConfig starts, restarts, or stops token prefetching to match cfg.
+// An unchanged config starts a new round so SPNs added by a reload are warmed.
+func ApplyPrefetchConfig(cfg PrefetchConfig) {
+	prefetchMutex.Lock()
+	defer prefetchMutex.Unlock()
+
+	enabled := cfg.IsEnabled()
+	cfg.Enabled = nil // A running prefetcher is enabled, so only the other settings are compared
+	if enabled && activePrefetch != nil && activePrefetch.cfg == cfg {
+		select {
+		case activePrefetch.kick <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if activePrefetch != nil {
+		close(activePrefetch.stop)
+		<-activePrefetch.done
+		activePrefetch = nil
+	}
+
+	if !enabled {
+		return
+	}
+	activePrefetch = &tokenPrefetcher{
+		cfg:  cfg,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go activePrefetch.run()
+	LogDebug("Prefetching tokens every %ds", cfg.IntervalSec)
+}
+
+// StopTokenPrefetch stops token prefetching
+func StopTokenPrefetch() {
+	prefetchMutex.Lock()
+	defer prefetchMutex.Unlock()
+
+	if activePrefetch != nil {
+		close(activePrefetch.stop)
+		<-activePrefetch.done
+		activePrefetch = nil
+	}
+}
+
+func (p *tokenPrefetcher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(time.Duration(p.cfg.IntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		p.prefetchAll()
+		select {
+		case <-ticker.C:
+		case <-p.kick:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// prefetchAll requests a token for each SPN to prefetch (all of them, or those with
+// auto_refresh) whose cached token would expire before the next round. Each request starts
+// after a random delay, so a fleet of trays started at the same time doesn't hit the KDC
+// at once.
+func (p *tokenPrefetcher) prefetchAll() {
+	cfg := currentConfig()
+	if cfg == nil {
+		return
+	}
+	// Requests would only time out; the round after going back online catches up
+	if trayOffline() {
+		LogDebug("Offline, not prefetching tokens")
+		return
+	}
+
+	spns := cfg.PrefetchSPNs()
+	if len(spns) == 0 {
+		return
+	}
+
+	jitter := time.Duration(p.cfg.JitterSec) * time.Second
+	keep := time.Duration(p.cfg.IntervalSec)*time.Second + jitter
+
+	var fetched atomic.Int32
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, p.cfg.Concurrency)
+	for _, spn := range spns {
+		wg.Add(1)
+		go func(spn string) {
+			defer wg.Done()
+			if jitter > 0 {
+				select {
+				case <-time.After(time.Duration(rand.Int63n(int64(jitter)))):
+				case <-p.stop:
+					return
+				}
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			refreshCacheNamespace(cfg)
+			if _, expires, found := GetCache().GetTokenWithExpiry(spn); found && time.Until(expires) > keep {
+				return
+			}
+			// Another request of this round may have found the KDC unreachable
+			if trayOffline() {
+				return
+			}
+			if _, err := getCachedServiceToken(cfg, spn, true); err != nil || trayOffline() {
+				LogDebug("Prefetching token for %s failed: %v", spn, err)
+				return
+			}
+			fetched.Add(1)
+		}(spn)
+	}
+	wg.Wait()
+
+	if n := fetched.Load(); n > 0 {
+		LogInfo("Prefetched %d of %d tokens", n, len(spns))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestHeadlessAutoRefreshSPNs checks that a prefetch round with token_prefetch off requests
+// tokens only for the SPNs with auto_refresh
+func TestHeadlessAutoRefreshSPNs(t *testing.T) {
+	newHeadlessTray(t, `{"spns": [
+    {"name": "App", "spn": "HTTP/app.example.com", "auto_refresh": true},
+    {"name": "Wiki", "spn": "HTTP/wiki.example.com"}
+  ]}`)
+	cfg := currentConfig().GetPrefetchConfigWithDefaults()
+	if !cfg.IsEnabled() {
+		t.Fatal("prefetch isn't enabled by an SPN with auto_refresh")
+	}
+	cfg.JitterSec = 0
+	(&tokenPrefetcher{cfg: cfg, stop: make(chan struct{})}).prefetchAll()
+
+	if got := cachedMockToken(t, "HTTP/app.example.com"); !mockTokenFor("HTTP/app.example.com")(got) {
+		t.Errorf("App token = %q", got)
+	}
+	if _, found := GetCache().GetToken("HTTP/wiki.example.com"); found {
+		t.Error("Wiki, without auto_refresh, got a token")
+	}
+}
+
+// TestPrefetchEnabled checks that token_prefetch.enabled set to false wins over auto_refresh
+func TestPrefetchEnabled(t *testing.T) {
+	spns := `"spns": [{"name": "App", "spn": "HTTP/app.example.com", "auto_refresh": true}]`
+	for cfgJSON, want := range map[string]bool{
+		`{` + spns + `}`: true,
+		`{` + spns + `, "token_prefetch": {"enabled": false}}`: false,
+		`{"token_prefetch": {"enabled": true}}`:                true,
+		`{"token_prefetch": {"interval_sec": 300}}`:            false,
+	} {
+		cfg, err := parseConfig([]byte(cfgJSON))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.GetPrefetchConfigWithDefaults().IsEnabled(); got != want {
+			t.Errorf("%s: enabled = %v, want %v", cfgJSON, got, want)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+var (
+	mTokenSetsMenu  *systray.MenuItem
+	tokenSetMenu    *menuList
+	tokenSetEntries []TokenSet
+)
+
+// tokenSetFile is what a token set is exported as
+type tokenSetFile struct {
+	Set       string           `json:"set"`
+	CreatedAt time.Time        `json:"created_at"`
+	Tokens    []tokenSetRecord `json:"tokens"`
+}
+
+// tokenSetRecord is one SPN of an exported set, and a line of "token-set --json" output
+type tokenSetRecord struct {
+	Name       string     `json:"name"` // As listed in the set
+	SPN        string     `json:"spn"`
+	Header     string     `json:"header,omitempty"` // Negotiate <token>
+	Token      string     `json:"token,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // When the tray would stop reusing the token
+	Error      string     `json:"error,omitempty"`
+	ErrorClass string     `json:"error_class,omitempty"` // One of the ticketErr* classes
+	Hint       string     `json:"hint,omitempty"`
+}
+
+// findTokenSet returns the token set called name (case-insensitive)
+func findTokenSet(cfg *Config, name string) (TokenSet, bool) {
+	if cfg == nil {
+		return TokenSet{}, false
+	}
+	for _, set := range cfg.TokenSets {
+		if strings.EqualFold(set.Name, name) {
+			return set, true
+		}
+	}
+	return TokenSet{}, false
+}
+
+func tokenSetNames(cfg *Config) []string {
+	var names []string
+	if cfg != nil {
+		for _, set := range cfg.TokenSets {
+			names = append(names, set.Name)
+		}
+	}
+	return names
+}
+
+// fetchTokenSet gets a token for each SPN in set with get, which returns the base64 token
+// and when it stops being reused. Failed SPNs get a record with the error, and the first
+// failure is returned.
+func fetchTokenSet(cfg *Config, set TokenSet, get func(spn string) (string, time.Time, error)) ([]tokenSetRecord, error) {
+	records := make([]tokenSetRecord, 0, len(set.SPNs))
+	var first error
+	for _, name := range set.SPNs {
+		spn := cfg.ResolveSPN(name)
+		token, expires, err := get(spn)
+		if err != nil {
+			class := classifyTicketError(err)
+			records = append(records, tokenSetRecord{Name: name, SPN: spn, Error: err.Error(), ErrorClass: class, Hint: ticketErrorHint(class)})
+			if first == nil {
+				first = fmt.Errorf("failed to get token for %s: %w", name, err)
+			}
+			continue
+		}
+		records = append(records, tokenSetRecord{Name: name, SPN: spn, Header: "Negotiate " + token, Token: token, ExpiresAt: &expires})
+	}
+	return records, first
+}
+
+// writeTokenSetFile writes the records to path, replacing it, or to a new temporary file if
+// path is empty. The file is readable only by the user; its path is returned.
+func writeTokenSetFile(path string, set TokenSet, records []tokenSetRecord) (string, error) {
+	data, err := json.MarshalIndent(tokenSetFile{Set: set.Name, CreatedAt: time.Now(), Tokens: records}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+
+	var f *os.File
+	if path == "" {
+		f, err = os.CreateTemp("", "krb5tray-tokens-*.json")
+	} else {
+		path = expandHomePath(path)
+		f, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	}
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	if err := f.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if path == "" {
+		return tmp, nil
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// loadAndBuildTokenSetsMenu fills the Export Token Set menu
+func loadAndBuildTokenSetsMenu() {
+	tokenSetMenu = newMenuList(mTokenSetsMenu, handleTokenSetClick, nil)
+
+	updateTokenSetsMenu()
+}
+
+// updateTokenSetsMenu lists the configured token sets
+func updateTokenSetsMenu() {
+	if tokenSetMenu == nil {
+		return
+	}
+
+	cfg := currentConfig()
+	var sets []TokenSet
+	if cfg != nil {
+		sets = cfg.TokenSets
+	}
+	stateMutex.Lock()
+	tokenSetEntries = sets
+	stateMutex.Unlock()
+
+	if len(sets) == 0 {
+		tokenSetMenu.ShowPlaceholder("No token sets configured", "Edit config file to add token_sets")
+		return
+	}
+	tokenSetMenu.Show(len(sets), func(i int, item *systray.MenuItem) {
+		set := sets[i]
+		target := "a temporary file"
+		if set.File != "" {
+			target = set.File
+		}
+		item.SetTitle(fmt.Sprintf("%s (%d)", set.Name, len(set.SPNs)))
+		item.SetTooltip(fmt.Sprintf("Write tokens for %s to %s and copy its path", strings.Join(set.SPNs, ", "), target))
+	})
+}
+
+func handleTokenSetClick(index int) {
+	stateMutex.RLock()
+	var set TokenSet
+	if index < len(tokenSetEntries) {
+		set = tokenSetEntries[index]
+	}
+	stateMutex.RUnlock()
+	if set.Name == "" {
+		return
+	}
+
+	if err := exportTokenSet(set); err != nil {
+		LogError("Token set %s export failed: %v", set.Name, err)
+		if class := classifyTicketError(err); class != ticketErrOther {
+			setStatusError(describeTicketError(err))
+			return
+		}
+		setStatusError(fmt.Sprintf("Export failed: %s", truncateError(err)))
+	}
+}
+
+// exportTokenSet writes the set's tokens to its file (or a temporary one, deleted when the
+// tokens expire) and copies the path. Nothing is written unless every token was obtained.
+func exportTokenSet(set TokenSet) error {
+	if trayIdleLocked() {
+		return errIdleLocked
+	}
+	if err := requireSecurityKey(securityKeyTokens, fmt.Sprintf("Export the %s token set", set.Name)); err != nil {
+		return err
+	}
+
+	cfg := currentConfig()
+	setStatus(fmt.Sprintf("Requesting %d tokens...", len(set.SPNs)))
+	records, err := fetchTokenSet(cfg, set, func(spn string) (string, time.Time, error) {
+		token, err := getCachedServiceToken(cfg, spn, false)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		expires := time.Now().Add(cfg.GetTokenTTL(spn))
+		if _, cached, found := GetCache().GetTokenWithExpiry(spn); found {
+			expires = cached
+		}
+		return token, expires, nil
+	})
+	if err != nil {
+		return err
+	}
+	path, err := writeTokenSetFile(set.File, set, records)
+	if err != nil {
+		return err
+	}
+
+	if set.File == "" {
+		// The file is no use once the first token has expired
+		expires := *records[0].ExpiresAt
+		for _, r := range records[1:] {
+			if r.ExpiresAt.Before(expires) {
+				expires = *r.ExpiresAt
+			}
+		}
+		time.AfterFunc(time.Until(expires), func() {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				LogWarn("Failed to remove token set file %s: %v", path, err)
+			}
+		})
+	}
+
+	LogActionWithFields("token_set_export", fmt.Sprintf("Exported token set %s to %s", set.Name, path), map[string]interface{}{
+		"set":  set.Name,
+		"spns": set.SPNs,
+	})
+	// The path isn't the value, so it goes to the clipboard without a history entry
+	if err := copyToClipboard(path); err != nil {
+		setStatus(fmt.Sprintf("Wrote %d tokens to %s", len(records), path))
+		return nil
+	}
+	setStatus(fmt.Sprintf("Wrote %d tokens, path copied", len(records)))
+	return nil
+}
+
+// runTokenSetCommand gets tokens for every SPN in a token set and prints them or writes
+// them to a JSON file
+func runTokenSetCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("token-set", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	out := fs.String("out", "", "Write the set to this JSON `file` (readable only by you) instead of printing it")
+	asJSON := fs.Bool("json", false, "Print a JSON record per SPN ({\"name\", \"spn\", \"header\", \"token\"} or {\"name\", \"spn\", \"error\"})")
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray token-set [--out file] [--json] [--debug] <set>")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Gets a token for each SPN in a set from token_sets in the config and prints")
+		_, _ = fmt.Fprintln(stderr, "\"<name>: Negotiate <token>\" per SPN. With --out, the file is written only if")
+		_, _ = fmt.Fprintln(stderr, "every token was obtained.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+	set, ok := findTokenSet(cfg, fs.Arg(0))
+	if !ok {
+		if names := tokenSetNames(cfg); len(names) > 0 {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: no token set %q (configured: %s)\n", fs.Arg(0), strings.Join(names, ", "))
+		} else {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: no token set %q (token_sets is empty)\n", fs.Arg(0))
+		}
+		return exitUsage
+	}
+
+	records, err := fetchTokenSet(cfg, set, func(spn string) (string, time.Time, error) {
+		issued := time.Now()
+		token, err := getServiceTicket(spn)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		defer zeroBytes(token)
+		return base64.StdEncoding.EncodeToString(token), issued.Add(cfg.GetTokenTTL(spn)), nil
+	})
+	code := exitOK
+	for _, r := range records {
+		if r.Error == "" {
+			continue
+		}
+		_, _ = fmt.Fprintf(stderr, "krb5tray: failed to get ticket for %s: %s\n", r.Name, r.Error)
+		if r.Hint != "" {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: %s\n", r.Hint)
+		}
+		if code == exitOK {
+			code = ticketErrorExitCode(r.ErrorClass)
+		}
+	}
+
+	if *out != "" {
+		if err != nil {
+			return code
+		}
+		path, err := writeTokenSetFile(*out, set, records)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "krb5tray: %v\n", err)
+			return exitFailure
+		}
+		_, _ = fmt.Fprintln(stdout, path)
+		return exitOK
+	}
+
+	for _, r := range records {
+		switch {
+		case *asJSON:
+			writeCLIJSON(stdout, stderr, r)
+		case r.Error == "":
+			_, _ = fmt.Fprintf(stdout, "%s: %s\n", r.Name, r.Header)
+		default:
+			_, _ = fmt.Fprintf(stdout, "%s:\n", r.Name)
+		}
+	}
+	return code
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds and status codes from the OTLP trace protocol
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	spanStatusOK    = 1
+	spanStatusError = 2
+)
+
+// Tracing export settings
+const (
+	traceBatchSize     = 64
+	traceFlushInterval = 5 * time.Second
+	traceQueueSize     = 1024
+	traceExportTimeout = 10 * time.Second
+)
+
+// Span is a single timed operation exported to an OTLP collector.
+// A nil *Span is valid and all methods are no-ops, so callers don't need to check
+// whether tracing is enabled.
+type Span struct {
+	name     string
+	kind     int
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	err      error
+}
+
+// tracer batches finished spans and posts them to the configured endpoint
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+	queue    chan *Span
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var (
+	activeTracer *tracer
+	tracerMutex  sync.RWMutex
+)
+
+// ConfigureTracing starts or stops span export based on the logging config
+func ConfigureTracing(cfg LogConfig) {
+	tracerMutex.Lock()
+	old := activeTracer
+	activeTracer = nil
+	if cfg.OTLPEndpoint != "" {
+		activeTracer = newTracer(cfg.OTLPEndpoint, cfg.OTLPHeaders)
+	}
+	tracerMutex.Unlock()
+
+	if old != nil {
+		old.shutdown()
+	}
+	if cfg.OTLPEndpoint != "" {
+		LogInfo("Tracing enabled, exporting to %s", cfg.OTLPEndpoint)
+	}
+}
+
+// ShutdownTracing exports any pending spans and stops the exporter
+func ShutdownTracing() {
+	tracerMutex.Lock()
+	t := activeTracer
+	activeTracer = nil
+	tracerMutex.Unlock()
+
+	if t != nil {
+		t.shutdown()
+	}
+}
+
+// StartSpan starts a root span, or returns nil when tracing is disabled
+func StartSpan(name string) *Span {
+	return startSpan(name, spanKindInternal, nil)
+}
+
+// StartClientSpan starts a span for an outgoing request, optionally as a child of parent
+func StartClientSpan(name string, parent *Span) *Span {
+	return startSpan(name, spanKindClient, parent)
+}
+
+func startSpan(name string, kind int, parent *Span) *Span {
+	tracerMutex.RLock()
+	enabled := activeTracer != nil
+	tracerMutex.RUnlock()
+	if !enabled {
+		return nil
+	}
+
+	s := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+		attrs: make(map[string]string),
+	}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return s
+}
+
+// SetAttr sets a string attribute on the span
+func (s *Span) SetAttr(key string, value string) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+// TraceParent returns the W3C traceparent header value for propagating this span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// End finishes the span, recording err as its status, and queues it for export
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+
+	tracerMutex.RLock()
+	t := activeTracer
+	tracerMutex.RUnlock()
+	if t == nil {
+		return
+	}
+
+	select {
+	case t.queue <- s:
+	default:
+		LogDebug("Trace queue full, dropping span %s", s.name)
+	}
+}
+
+func newTracer(endpoint string, headers map[string]string) *tracer {
+	t := &tracer{
+		endpoint: strings.TrimRight(endpoint, "/") + "/v1/traces",
+		headers:  headers,
+		client:   &http.Client{Timeout: traceExportTimeout},
+		queue:    make(chan *Span, traceQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// run collects spans into batches and exports them periodically
+func (t *tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			LogDebug("Failed to export %d spans: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-t.stop:
+			// Drain whatever is still queued
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown stops the exporter after sending pending spans
+func (t *tracer) shutdown() {
+	close(t.stop)
+	<-t.done
+}
+
+// OTLP/HTTP JSON encoding (https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding)
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func otlpAttr(key string, value string) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	kv.Value.StringValue = value
+	return kv
+}
+
+// export posts a batch of spans to the collector
+func (t *tracer) export(spans []*Span) error {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: fmt.Sprintf("%d", s.start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprintf("%d", s.end.UnixNano()),
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for k, v := range s.attrs {
+			out.Attributes = append(out.Attributes, otlpAttr(k, v))
+		}
+		if s.err != nil {
+			out.Status.Code = spanStatusError
+			out.Status.Message = s.err.Error()
+		} else {
+			out.Status.Code = spanStatusOK
+		}
+		encoded = append(encoded, out)
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpKeyValue{
+						otlpAttr("service.name", "krb5tray"),
+						otlpAttr("service.version", Version),
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "krb5tray"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// transferProgressInterval limits how often transfer progress updates the status line
+const transferProgressInterval = 250 * time.Millisecond
+
+var (
+	mTransfersMenu  *systray.MenuItem
+	transferMenu    *menuList
+	transferEntries []TransferEntry
+
+	// errTransferCancelled is returned when the file picker is dismissed
+	errTransferCancelled = fmt.Errorf("cancelled")
+)
+
+// transferSSHEntry returns the builtin SSH settings for a transfer's host: the named SSH
+// entry (with its credentials and jump hosts), or a "[user@]host[:port]" address
+func transferSSHEntry(cfg *Config, t TransferEntry) (SSHEntry, error) {
+	if entry, ok := findSSHEntry(cfg, t.Host); ok {
+		if isConsoleMode(entry.Mode) {
+			return SSHEntry{}, fmt.Errorf("%s is a %s console, not an SSH host", entry.Name, entry.Mode)
+		}
+		if entry.Host == "" {
+			return SSHEntry{}, fmt.Errorf("SSH entry %s has no host for the builtin client", entry.Name)
+		}
+		entry.Mode = sshModeBuiltin
+		return entry, nil
+	}
+	hop, err := parseJumpHost(t.Host)
+	if err != nil {
+		return SSHEntry{}, err
+	}
+	return SSHEntry{Name: t.Name, Mode: sshModeBuiltin, Host: hop.Host, Port: hop.Port, User: hop.User}, nil
+}
+
+// transferDirection returns the entry's direction, defaulting to download
+func transferDirection(t TransferEntry) string {
+	if t.Direction == "" {
+		return transferDownload
+	}
+	return strings.ToLower(t.Direction)
+}
+
+// runTransfer asks for the local file and copies it to or from the remote path
+func runTransfer(t TransferEntry) error {
+	cfg := currentConfig()
+
+	entry, err := transferSSHEntry(cfg, t)
+	if err != nil {
+		return err
+	}
+	title := "Transfer: " + t.Name
+	download := transferDirection(t) == transferDownload
+
+	var localPath string
+	var ok bool
+	if download {
+		localPath, ok = ChooseFileDialog(title, true, path.Base(t.RemotePath))
+	} else {
+		localPath, ok = ChooseFileDialog(title, false, "")
+	}
+	if !ok || localPath == "" {
+		return errTransferCancelled
+	}
+
+	name := filepath.Base(localPath)
+	if download {
+		name = path.Base(t.RemotePath)
+	}
+	setStatus(fmt.Sprintf("Connecting to %s...", entry.Host))
+	client, err := dialBuiltinSSH(entry, traySSHAuthOptions(title))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	verb := "Uploading"
+	if download {
+		verb = "Downloading"
+	}
+	var last time.Time
+	progress := func(done int64, total int64) {
+		if time.Since(last) < transferProgressInterval && done < total {
+			return
+		}
+		last = time.Now()
+		if total > 0 {
+			setStatus(fmt.Sprintf("%s %s: %d%%", verb, name, done*100/total))
+		} else {
+			setStatus(fmt.Sprintf("%s %s...", verb, name))
+		}
+	}
+
+	if download {
+		f, err := os.Create(localPath)
+		if err != nil {
+			return err
+		}
+		err = scpDownload(client, t.RemotePath, f, progress)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// Don't leave a truncated file behind
+			os.Remove(localPath)
+			return err
+		}
+		LogInfo("Downloaded %s:%s to %s", entry.Host, t.RemotePath, localPath)
+		return nil
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	remotePath := t.RemotePath
+	if strings.HasSuffix(remotePath, "/") {
+		remotePath = strings.TrimSuffix(remotePath, "/")
+		if remotePath == "" {
+			remotePath = "/"
+		}
+	}
+	if err := scpUpload(client, remotePath, name, uint32(info.Mode().Perm()), info.Size(), f, progress); err != nil {
+		return err
+	}
+	LogInfo("Uploaded %s to %s:%s", localPath, entry.Host, t.RemotePath)
+	return nil
+}
+
+// loadAndBuildTransfersMenu fills the Transfers menu
+func loadAndBuildTransfersMenu() {
+	transferMenu = newMenuList(mTransfersMenu, handleTransferClick, nil)
+
+	updateTransfersMenu()
+}
+
+// updateTransfersMenu lists the configured transfers
+func updateTransfersMenu() {
+	if transferMenu == nil {
+		return
+	}
+
+	cfg := currentConfig()
+	var entries []TransferEntry
+	if cfg != nil {
+		entries = cfg.Transfers
+	}
+	stateMutex.Lock()
+	transferEntries = entries
+	stateMutex.Unlock()
+
+	if len(entries) == 0 {
+		transferMenu.ShowPlaceholder("No transfers configured", "Edit config file to add transfers")
+		return
+	}
+	transferMenu.Show(len(entries), func(i int, item *systray.MenuItem) {
+		t := entries[i]
+		arrow := "↓"
+		tooltip := fmt.Sprintf("Download %s:%s", t.Host, t.RemotePath)
+		if transferDirection(t) == transferUpload {
+			arrow = "↑"
+			tooltip = fmt.Sprintf("Upload to %s:%s", t.Host, t.RemotePath)
+		}
+		item.SetTitle(arrow + " " + t.Name)
+		item.SetTooltip(tooltip)
+	})
+}
+
+func handleTransferClick(index int) {
+	stateMutex.RLock()
+	var t TransferEntry
+	if index < len(transferEntries) {
+		t = transferEntries[index]
+	}
+	stateMutex.RUnlock()
+	if t.Name == "" {
+		return
+	}
+
+	err := runTransfer(t)
+	switch {
+	case err == errTransferCancelled:
+		setStatus("Transfer cancelled")
+	case err != nil:
+		LogError("Transfer %s failed: %v", t.Name, err)
+		setStatusError(fmt.Sprintf("Transfer failed: %s", truncateError(err)))
+	default:
+		setStatus(fmt.Sprintf("Transfer complete: %s", t.Name))
+	}
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"krb5tray/pkg/krb"
+)
+
+// trustKDCTimeout is the connect timeout when probing a realm's KDC
+const trustKDCTimeout = 3 * time.Second
+
+// krb5Conf holds the parts of krb5.conf that decide a cross-realm path. The first value
+// of a relation wins, as in MIT Kerberos.
+type krb5Conf struct {
+	path        string
+	defaults    map[string]string              // [libdefaults]
+	realms      map[string]map[string][]string // [realms]: realm -> tag -> values
+	domainRealm map[string]string              // [domain_realm]: lowercase domain -> realm
+	capaths     map[string]map[string][]string // [capaths]: client realm -> server realm -> intermediates
+}
+
+// krb5ConfPaths returns the krb5.conf files to read: KRB5_CONFIG (a list), or the
+// platform's default location
+func krb5ConfPaths() []string {
+	if env := os.Getenv("KRB5_CONFIG"); env != "" {
+		return filepath.SplitList(env)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/Library/Preferences/edu.mit.Kerberos", "/etc/krb5.conf"}
+	case "windows":
+		return []string{
+			filepath.Join(os.Getenv("ProgramData"), "MIT", "Kerberos5", "krb5.ini"),
+			filepath.Join(os.Getenv("SystemRoot"), "krb5.ini"),
+		}
+	}
+	return []string{"/etc/krb5.conf"}
+}
+
+func newKrb5Conf() *krb5Conf {
+	return &krb5Conf{
+		defaults:    map[string]string{},
+		realms:      map[string]map[string][]string{},
+		domainRealm: map[string]string{},
+		capaths:     map[string]map[string][]string{},
+	}
+}
+
+// loadKrb5Conf reads the krb5.conf files that exist. It fails only if none can be read.
+func loadKrb5Conf() (*krb5Conf, error) {
+	conf := newKrb5Conf()
+	var read []string
+	var lastErr error
+	for _, path := range krb5ConfPaths() {
+		if err := conf.parseFile(path, 0); err != nil {
+			lastErr = err
+			continue
+		}
+		read = append(read, path)
+	}
+	if len(read) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no krb5.conf location")
+		}
+		return nil, lastErr
+	}
+	conf.path = strings.Join(read, ", ")
+	return conf, nil
+}
+
+// parseFile reads one krb5.conf file, following include and includedir directives
+func (c *krb5Conf) parseFile(path string, depth int) error {
+	if depth > 8 {
+		return fmt.Errorf("%s: includes nested too deeply", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var section, group string
+	level := 0 // Brace depth; 1 is inside a realm's or capaths entry's { }
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if level == 0 {
+			if name, ok := strings.CutPrefix(line, "include "); ok {
+				_ = c.parseFile(strings.TrimSpace(name), depth+1)
+				continue
+			}
+			if dir, ok := strings.CutPrefix(line, "includedir "); ok {
+				entries, _ := os.ReadDir(strings.TrimSpace(dir))
+				for _, e := range entries {
+					if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+						_ = c.parseFile(filepath.Join(strings.TrimSpace(dir), e.Name()), depth+1)
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(line, "[") {
+				section = strings.Trim(strings.TrimSuffix(line, "*"), "[] ")
+				continue
+			}
+		}
+		if line == "}" {
+			if level > 0 {
+				level--
+			}
+			continue
+		}
+
+		tag, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		tag = strings.TrimSpace(tag)
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "*"))
+		if value == "{" {
+			if level == 0 {
+				group = tag
+			}
+			level++
+			continue
+		}
+
+		switch {
+		case level == 0 && section == "libdefaults":
+			if _, seen := c.defaults[tag]; !seen {
+				c.defaults[tag] = value
+			}
+		case level == 0 && section == "domain_realm":
+			domain := strings.ToLower(tag)
+			if _, seen := c.domainRealm[domain]; !seen {
+				c.domainRealm[domain] = value
+			}
+		case level == 1 && section == "realms":
+			if c.realms[group] == nil {
+				c.realms[group] = map[string][]string{}
+			}
+			c.realms[group][tag] = append(c.realms[group][tag], value)
+		case level == 1 && section == "capaths":
+			if c.capaths[group] == nil {
+				c.capaths[group] = map[string][]string{}
+			}
+			c.capaths[group][tag] = append(c.capaths[group][tag], value)
+		}
+	}
+	return scanner.Err()
+}
+
+// realmForHost returns the realm of host and where it came from: the most specific
+// domain_realm entry, or else the host's domain in upper case (MIT's fallback)
+func (c *krb5Conf) realmForHost(host string) (string, string) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if realm, ok := c.domainRealm[host]; ok {
+		return realm, "domain_realm " + host
+	}
+	for domain := host; ; {
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		if realm, ok := c.domainRealm["."+parent]; ok {
+			return realm, "domain_realm ." + parent
+		}
+		domain = parent
+	}
+	if _, domain, ok := strings.Cut(host, "."); ok && strings.Contains(domain, ".") {
+		return strings.ToUpper(domain), "guessed from the host's domain (no domain_realm entry)"
+	}
+	if realm := c.defaults["default_realm"]; realm != "" {
+		return realm, "default_realm"
+	}
+	return "", ""
+}
+
+// trustPath returns the realms a client in client goes through to reach server, both
+// included, and where the path came from: capaths, or the realm hierarchy otherwise
+func (c *krb5Conf) trustPath(client string, server string) ([]string, string) {
+	if client == server {
+		return []string{client}, "same realm"
+	}
+	if hops, ok := c.capaths[client][server]; ok {
+		path := []string{client}
+		for _, hop := range hops {
+			if hop != "." && hop != client && hop != server {
+				path = append(path, hop)
+			}
+		}
+		return append(path, server), "capaths"
+	}
+	return hierarchicalTrustPath(client, server), "hierarchy (no capaths entry)"
+}
+
+// hierarchicalTrustPath goes up from client to the realm it shares with server and back
+// down: A.CORP.EXAMPLE.COM -> CORP.EXAMPLE.COM -> EXAMPLE.COM -> B.EXAMPLE.COM. Realms
+// without a common parent get a direct trust.
+func hierarchicalTrustPath(client string, server string) []string {
+	cParts := strings.Split(client, ".")
+	sParts := strings.Split(server, ".")
+	common := 0
+	for common < len(cParts) && common < len(sParts) &&
+		cParts[len(cParts)-1-common] == sParts[len(sParts)-1-common] {
+		common++
+	}
+	// A shared top-level domain alone ("COM") isn't a realm
+	if common < 2 {
+		return []string{client, server}
+	}
+
+	path := []string{client}
+	for i := 1; i <= len(cParts)-common; i++ {
+		path = append(path, strings.Join(cParts[i:], "."))
+	}
+	for i := len(sParts) - common - 1; i >= 0; i-- {
+		path = append(path, strings.Join(sParts[i:], "."))
+	}
+	return path
+}
+
+// realmKDCs returns the KDCs of realm as host:port and where they came from: krb5.conf,
+// or DNS SRV records
+func (c *krb5Conf) realmKDCs(realm string) ([]string, string) {
+	if kdcs := c.realms[realm]["kdc"]; len(kdcs) > 0 {
+		out := make([]string, len(kdcs))
+		for i, kdc := range kdcs {
+			if _, _, err := net.SplitHostPort(kdc); err != nil {
+				kdc = net.JoinHostPort(kdc, "88")
+			}
+			out[i] = kdc
+		}
+		return out, "krb5.conf"
+	}
+	for _, proto := range []string{"tcp", "udp"} {
+		_, records, err := net.LookupSRV("kerberos", proto, realm)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		out := make([]string, len(records))
+		for i, r := range records {
+			out[i] = net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port)))
+		}
+		return out, "DNS _kerberos._" + proto
+	}
+	return nil, ""
+}
+
+// trustCheck is one step of a trust path diagnosis
+type trustCheck struct {
+	Step   string `json:"step"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// trustReport is the result of diagnoseTrustPath, and the "trust-path --json" output
+type trustReport struct {
+	SPN         string       `json:"spn"`
+	Client      string       `json:"client,omitempty"`
+	Realm       string       `json:"realm,omitempty"`
+	RealmSource string       `json:"realm_source,omitempty"`
+	Path        []string     `json:"path,omitempty"`
+	PathSource  string       `json:"path_source,omitempty"`
+	Krb5Conf    string       `json:"krb5_conf,omitempty"`
+	Checks      []trustCheck `json:"checks"`
+	OK          bool         `json:"ok"`
+	BreaksAt    string       `json:"breaks_at,omitempty"` // The realm or hop where acquisition fails
+	ErrorClass  string       `json:"error_class,omitempty"`
+}
+
+func (r *trustReport) check(step string, ok bool, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, trustCheck{Step: step, OK: ok, Detail: fmt.Sprintf(format, args...)})
+}
+
+// fail records a failed check and where the path breaks
+func (r *trustReport) fail(step string, breaksAt string, format string, args ...interface{}) {
+	r.check(step, false, format, args...)
+	if r.BreaksAt == "" {
+		r.BreaksAt = breaksAt
+	}
+}
+
+// spnHostRealm splits an SPN ("HTTP/host", "HTTP@host", "HTTP/host@REALM") into its host
+// and explicit realm
+func spnHostRealm(spn string) (string, string) {
+	rest := spn
+	if _, after, ok := strings.Cut(spn, "/"); ok {
+		rest = after
+	} else if _, after, ok := strings.Cut(spn, "@"); ok {
+		return after, ""
+	}
+	host, realm, _ := strings.Cut(rest, "@")
+	host, _, _ = strings.Cut(host, ":")
+	return host, realm
+}
+
+// realmOf returns the realm part of a principal
+func realmOf(principal string) string {
+	if i := strings.LastIndex(principal, "@"); i >= 0 {
+		return principal[i+1:]
+	}
+	return ""
+}
+
+// diagnoseTrustPath works out the cross-realm path to spn's realm from krb5.conf, checks
+// that every realm on it has a reachable KDC, then requests the ticket and uses the
+// cross-realm TGTs in the credential cache to tell which hop it got stuck at
+func diagnoseTrustPath(spn string) trustReport {
+	report := trustReport{SPN: spn}
+
+	principal, err := krb.DefaultPrincipal(krbOptions())
+	if err != nil {
+		report.ErrorClass = classifyTicketError(err)
+		report.fail("credentials", "credentials", "no default credentials: %v", err)
+		return report
+	}
+	report.Client = principal
+	clientRealm := realmOf(principal)
+	report.check("credentials", true, "signed in as %s", principal)
+
+	conf, confErr := loadKrb5Conf()
+	if confErr != nil {
+		// SSPI doesn't need a krb5.conf; AD trusts are then only found through DNS
+		conf = newKrb5Conf()
+		report.check("krb5.conf", runtime.GOOS == "windows", "not read (%v), so KDCs are only looked up in DNS", confErr)
+	} else {
+		report.Krb5Conf = conf.path
+	}
+
+	host, realm := spnHostRealm(spn)
+	if realm != "" {
+		report.RealmSource = "the SPN"
+	} else {
+		realm, report.RealmSource = conf.realmForHost(host)
+	}
+	if realm == "" {
+		report.fail("realm", "realm", "can't tell the realm of %s: add a domain_realm entry or @REALM to the SPN", host)
+		return report
+	}
+	report.Realm = realm
+	report.check("realm", !strings.HasPrefix(report.RealmSource, "guessed"), "%s is in %s (%s)", host, realm, report.RealmSource)
+
+	report.Path, report.PathSource = conf.trustPath(clientRealm, realm)
+	for _, r := range report.Path {
+		kdcs, source := conf.realmKDCs(r)
+		if len(kdcs) == 0 {
+			report.fail("kdc "+r, r, "no KDC for %s in krb5.conf and no _kerberos SRV record", r)
+			continue
+		}
+		var reached string
+		var lastErr error
+		for _, kdc := range kdcs {
+			conn, err := net.DialTimeout("tcp", kdc, trustKDCTimeout)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			_ = conn.Close()
+			reached = kdc
+			break
+		}
+		if reached == "" {
+			report.fail("kdc "+r, r, "none of the KDCs (%s, from %s) is reachable: %v", strings.Join(kdcs, ", "), source, lastErr)
+			continue
+		}
+		report.check("kdc "+r, true, "%s reachable (%s)", reached, source)
+	}
+
+	token, ticketErr := getServiceTicket(spn)
+	zeroBytes(token)
+
+	// Hops whose cross-realm TGT (krbtgt/TO@FROM) is in the cache worked at some point.
+	// gokrb5 keeps tickets in memory, so a missing ticket only counts against a hop when
+	// the service ticket failed.
+	cached := map[string]bool{}
+	if t, err := krb.Open(krbOptions()); err == nil {
+		if creds, err := t.GetCredentials(); err == nil {
+			for _, c := range creds {
+				cached[c.ServerPrincipal] = true
+			}
+		}
+		_ = t.Close()
+	}
+	for i := 1; i < len(report.Path); i++ {
+		from, to := report.Path[i-1], report.Path[i]
+		tgt := "krbtgt/" + to + "@" + from
+		switch {
+		case cached[tgt]:
+			report.check("trust "+from+" -> "+to, true, "%s in the credential cache", tgt)
+		case ticketErr != nil && len(cached) > 0:
+			report.fail("trust "+from+" -> "+to, from+" -> "+to, "no %s: the trust from %s to %s may be missing or one-way", tgt, from, to)
+		}
+	}
+
+	if ticketErr != nil {
+		report.ErrorClass = classifyTicketError(ticketErr)
+		last := report.Path[len(report.Path)-1]
+		if report.ErrorClass == ticketErrBadSPN && report.BreaksAt == "" {
+			report.fail("service ticket", last, "%s's KDC doesn't know %s: %v", last, spn, ticketErr)
+		} else {
+			report.fail("service ticket", last, "%v", ticketErr)
+		}
+		return report
+	}
+	report.check("service ticket", true, "got a ticket for %s", spn)
+	report.OK = report.BreaksAt == ""
+	return report
+}
+
+// trustPathHint suggests trust-path when a failed SPN is in a realm other than the client's
+func trustPathHint(spn string) string {
+	conf, err := loadKrb5Conf()
+	if err != nil {
+		return ""
+	}
+	host, realm := spnHostRealm(spn)
+	if realm == "" {
+		realm, _ = conf.realmForHost(host)
+	}
+	client := conf.defaults["default_realm"]
+	if principal, err := krb.DefaultPrincipal(krbOptions()); err == nil {
+		client = realmOf(principal)
+	}
+	if realm == "" || client == "" || strings.EqualFold(realm, client) {
+		return ""
+	}
+	return fmt.Sprintf("%s is in realm %s, not %s; run \"krb5tray trust-path %s\" to find where the cross-realm path breaks", spn, realm, client, spn)
+}
+
+// runTrustPathCommand prints the trust path diagnosis for an SPN
+func runTrustPathCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("trust-path", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	debug := fs.Bool("debug", false, "Enable transport debug output on stderr")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: krb5tray trust-path [--json] [--debug] <spn-or-name>")
+		_, _ = fmt.Fprintln(stderr, "")
+		_, _ = fmt.Fprintln(stderr, "Follows the cross-realm path from your realm to the SPN's (capaths and domain_realm")
+		_, _ = fmt.Fprintln(stderr, "in krb5.conf) and reports where ticket acquisition breaks.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	SetDebugMode(*debug)
+	cfg, _ := LoadConfig("")
+	report := diagnoseTrustPath(cfg.ResolveSPN(fs.Arg(0)))
+
+	if *asJSON {
+		writeCLIJSON(stdout, stderr, report)
+	} else {
+		writeTrustReport(stdout, report)
+	}
+	if report.OK {
+		return exitOK
+	}
+	if code := ticketErrorExitCode(report.ErrorClass); code != exitOK {
+		return code
+	}
+	return exitFailure
+}
+
+// writeTrustReport prints a trust path diagnosis for people
+func writeTrustReport(w io.Writer, report trustReport) {
+	_, _ = fmt.Fprintf(w, "SPN:       %s\n", report.SPN)
+	if report.Client != "" {
+		_, _ = fmt.Fprintf(w, "Client:    %s\n", report.Client)
+	}
+	if report.Realm != "" {
+		_, _ = fmt.Fprintf(w, "Realm:     %s (%s)\n", report.Realm, report.RealmSource)
+	}
+	if len(report.Path) > 0 {
+		_, _ = fmt.Fprintf(w, "Path:      %s (%s)\n", strings.Join(report.Path, " -> "), report.PathSource)
+	}
+	if report.Krb5Conf != "" {
+		_, _ = fmt.Fprintf(w, "krb5.conf: %s\n", report.Krb5Conf)
+	}
+	_, _ = fmt.Fprintln(w, "")
+
+	width := 0
+	for _, c := range report.Checks {
+		width = max(width, len(c.Step))
+	}
+	for _, c := range report.Checks {
+		mark := "ok  "
+		if !c.OK {
+			mark = "FAIL"
+		}
+		_, _ = fmt.Fprintf(w, "  %s  %-*s  %s\n", mark, width, c.Step, c.Detail)
+	}
+
+	_, _ = fmt.Fprintln(w, "")
+	if report.OK {
+		_, _ = fmt.Fprintln(w, "The trust path works.")
+	} else {
+		_, _ = fmt.Fprintf(w, "Breaks at: %s\n", report.BreaksAt)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestKrb5ConfParse covers the krb5.conf sections the trust path is worked out from,
+// includes, and the first value of a relation winning
+func TestKrb5ConfParse(t *testing.T) {
+	dir := t.TempDir()
+	extra := filepath.Join(dir, "conf.d")
+	if err := os.MkdirAll(extra, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path string, text string) {
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(extra, "partner"), `[domain_realm]
+	.partner.test = PARTNER.TEST
+`)
+	main := filepath.Join(dir, "krb5.conf")
+	write(main, `# Site config
+includedir `+extra+`
+
+[libdefaults]
+	default_realm = CORP.EXAMPLE.COM
+	default_realm = IGNORED.TEST
+
+[realms]
+	CORP.EXAMPLE.COM = {
+		kdc = kdc1.corp.example.com
+		kdc = kdc2.corp.example.com:88
+		admin_server = kdc1.corp.example.com
+	}
+
+[domain_realm]
+	.corp.example.com = CORP.EXAMPLE.COM
+	legacy.corp.example.com = LEGACY.EXAMPLE.COM
+	; comment
+[capaths]
+	CORP.EXAMPLE.COM = {
+		PARTNER.TEST = EXAMPLE.COM
+		PARTNER.TEST = GATEWAY.TEST
+	}
+`)
+	c := newKrb5Conf()
+	if err := c.parseFile(main, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.defaults["default_realm"]; got != "CORP.EXAMPLE.COM" {
+		t.Errorf("default_realm = %q", got)
+	}
+	if got := strings.Join(c.realms["CORP.EXAMPLE.COM"]["kdc"], " "); got != "kdc1.corp.example.com kdc2.corp.example.com:88" {
+		t.Errorf("kdcs = %q", got)
+	}
+	for host, want := range map[string]string{
+		"app.corp.example.com":    "CORP.EXAMPLE.COM",
+		"legacy.corp.example.com": "LEGACY.EXAMPLE.COM",
+		"www.partner.test":        "PARTNER.TEST",
+		"host.other.example.org":  "OTHER.EXAMPLE.ORG",
+		"localhost":               "CORP.EXAMPLE.COM",
+	} {
+		if got, _ := c.realmForHost(host); got != want {
+			t.Errorf("realmForHost(%q) = %q, want %q", host, got, want)
+		}
+	}
+
+	if path, from := c.trustPath("CORP.EXAMPLE.COM", "PARTNER.TEST"); strings.Join(path, " ") != "CORP.EXAMPLE.COM EXAMPLE.COM GATEWAY.TEST PARTNER.TEST" || from != "capaths" {
+		t.Errorf("capaths path = %v (%s)", path, from)
+	}
+	if path, _ := c.trustPath("A.CORP.EXAMPLE.COM", "B.EXAMPLE.COM"); strings.Join(path, " ") != "A.CORP.EXAMPLE.COM CORP.EXAMPLE.COM EXAMPLE.COM B.EXAMPLE.COM" {
+		t.Errorf("hierarchical path = %v", path)
+	}
+	if path, _ := c.trustPath("EXAMPLE.COM", "PARTNER.TEST"); len(path) != 2 {
+		t.Errorf("path without a common parent = %v", path)
+	}
+
+	write(main, "include "+main+"\n")
+	if err := newKrb5Conf().parseFile(main, 0); err != nil {
+		t.Errorf("include loop: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"krb5tray/internal/httpclient"
+)
+
+// How a URL entry with auth_spn authenticates before the browser opens it
+const (
+	urlAuthHeader   = "header"   // Copy a fresh Negotiate header to the clipboard
+	urlAuthExchange = "exchange" // Trade a Negotiate header for a one-time token at a gateway and pass it in the URL
+
+	// urlAuthPreauth requested the URL with ktray's own cookie jar, which gave the browser
+	// no session; it is only recognized to point at sessions entries instead
+	urlAuthPreauth = "preauth"
+)
+
+// urlAuthMaxBody bounds the exchange response read for the token
+const urlAuthMaxBody = 64 << 10
+
+// urlAuthMode returns the entry's auth mode, defaulting to header
+func urlAuthMode(entry URLEntry) string {
+	if entry.AuthMode == "" {
+		return urlAuthHeader
+	}
+	return strings.ToLower(entry.AuthMode)
+}
+
+// urlAuthSPN returns the SPN for the entry's auth_spn, with {host} replaced by the host of
+// the URL the token is for
+func urlAuthSPN(cfg *Config, entry URLEntry, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return cfg.ResolveSPN(strings.ReplaceAll(entry.AuthSPN, "{host}", u.Hostname())), nil
+}
+
+// prepareURLAuth authenticates for a URL entry with auth_spn and returns the URL to open,
+// which carries the one-time token in exchange mode
+func prepareURLAuth(entry URLEntry, requester string) (string, error) {
+	cfg := currentConfig()
+	if err := requireSecurityKey(securityKeyTokens, "Sign in to "+entry.Name); err != nil {
+		return "", err
+	}
+	switch urlAuthMode(entry) {
+	case urlAuthHeader:
+		spn, err := urlAuthSPN(cfg, entry, entry.URL)
+		if err != nil {
+			return "", err
+		}
+		token, err := getCachedServiceToken(cfg, spn, true)
+		if err != nil {
+			return "", fmt.Errorf("failed to get token for %s: %w", spn, err)
+		}
+		// The header is for the browser about to open, not the focused window
+		copied, err := putSecretOnClipboard("HTTP header: "+entry.Name, "Negotiate "+token, requester)
+		if err != nil {
+			return "", err
+		}
+		if copied {
+			LogClipboardCopy("http_header", entry.Name)
+		}
+		return entry.URL, nil
+
+	case urlAuthExchange:
+		body, err := negotiatedGet(cfg, entry, entry.ExchangeURL)
+		if err != nil {
+			return "", err
+		}
+		token, err := exchangeToken(body, entry.TokenField)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", redactURLString(entry.ExchangeURL), err)
+		}
+		u, err := url.Parse(entry.URL)
+		if err != nil {
+			return "", err
+		}
+		param := entry.TokenParam
+		if param == "" {
+			param = "token"
+		}
+		query := u.Query()
+		query.Set(param, token)
+		u.RawQuery = query.Encode()
+		LogAction("url_token_exchange", fmt.Sprintf("One-time token obtained for %s", entry.Name))
+		return u.String(), nil
+	}
+	return "", fmt.Errorf("unknown auth_mode %q", entry.AuthMode)
+}
+
+// negotiatedGet requests rawURL with a Negotiate header for the entry's auth_spn and
+// returns the body. A 401 is retried once with a fresh ticket, since the cached one may
+// be rejected as a replay.
+func negotiatedGet(cfg *Config, entry URLEntry, rawURL string) ([]byte, error) {
+	spn, err := urlAuthSPN(cfg, entry, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for fresh := false; ; fresh = true {
+		token, err := getCachedServiceToken(cfg, spn, fresh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token for %s: %w", spn, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), httpclient.DefaultTimeout)
+		req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Negotiate "+token)
+		start := time.Now()
+		resp, err := httpclient.Client(false).Do(req)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, urlAuthMaxBody))
+		resp.Body.Close()
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		recordHTTPResponse(entry.Name, req, resp, body, time.Since(start))
+
+		switch {
+		case isNegotiateChallenge(resp) && !fresh:
+			LogDebug("%s rejected the token, retrying with a fresh one", req.URL.Host)
+			continue
+		case resp.StatusCode >= 400:
+			return nil, fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+		}
+		return body, nil
+	}
+}
+
+// exchangeToken takes the one-time token from a gateway's response: field of a JSON
+// object (default "token"), or the whole body if it isn't JSON
+func exchangeToken(body []byte, field string) (string, error) {
+	if field == "" {
+		field = "token"
+	}
+	text := strings.TrimSpace(string(body))
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &obj); err == nil {
+		token, ok := obj[field].(string)
+		if !ok || token == "" {
+			return "", fmt.Errorf("response has no %q field", field)
+		}
+		return token, nil
+	}
+	if text == "" || strings.ContainsAny(text, " \n\t<") {
+		return "", fmt.Errorf("response is neither JSON nor a bare token")
+	}
+	return text, nil
+}
+
+// redactURLString is redactURL for a URL that may not parse
+func redactURLString(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "exchange_url"
+	}
+	return httpclient.RedactURL(u)
+}
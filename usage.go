@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of entries whose use is counted
+const (
+	usageSPN     = "spn"
+	usageURL     = "url"
+	usageSnippet = "snippet"
+	usageSSH     = "ssh"
+)
+
+// usageDebounce delays writes so a burst of uses produces a single save
+const usageDebounce = 5 * time.Second
+
+// usageRecord is how often an entry was used and when it was last used
+type usageRecord struct {
+	Count    int       `json:"count"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// usageStats holds the records of each kind of entry, by entry name
+type usageStats map[string]map[string]*usageRecord
+
+var (
+	usageMutex sync.Mutex
+	usageData  usageStats // Read from the usage file on first use
+	usageTimer *time.Timer
+)
+
+// usageKinds lists the counted kinds with their menu titles and entry names, in menu order
+var usageKinds = []struct {
+	kind  string
+	title string
+	names func(cfg *Config) []string
+}{
+	{usageSPN, "SPNs", func(cfg *Config) []string {
+		names := make([]string, len(cfg.SPNs))
+		for i, e := range cfg.SPNs {
+			names[i] = e.Name
+		}
+		return names
+	}},
+	{usageURL, "URLs", func(cfg *Config) []string {
+		names := make([]string, len(cfg.URLs))
+		for i, e := range cfg.URLs {
+			names[i] = e.Name
+		}
+		return names
+	}},
+	{usageSnippet, "Snippets", func(cfg *Config) []string {
+		names := make([]string, len(cfg.Snippets))
+		for i, e := range cfg.Snippets {
+			names[i] = e.Name
+		}
+		return names
+	}},
+	{usageSSH, "SSH", func(cfg *Config) []string {
+		names := make([]string, len(cfg.SSH))
+		for i, e := range cfg.SSH {
+			names[i] = e.Name
+		}
+		return names
+	}},
+}
+
+// UsagePath returns the path of the usage counts file
+func UsagePath() string {
+	return filepath.Join(ConfigDir(), "usage.json")
+}
+
+// loadUsageLocked reads the usage file unless it was already read. The caller holds
+// usageMutex.
+func loadUsageLocked() {
+	if usageData != nil {
+		return
+	}
+	usageData = usageStats{}
+	data, err := os.ReadFile(UsagePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			LogWarn("Failed to read usage counts: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &usageData); err != nil {
+		LogWarn("Ignoring unreadable usage counts: %v", err)
+		usageData = usageStats{}
+	}
+}
+
+// recordUsage counts a use of the named entry, unless usage.disabled is set. A menu sorted
+// by usage is reordered.
+func recordUsage(kind string, name string) {
+	usage := currentConfig().GetUsageConfigWithDefaults()
+	if usage.Disabled || name == "" {
+		return
+	}
+
+	usageMutex.Lock()
+	loadUsageLocked()
+	if usageData[kind] == nil {
+		usageData[kind] = map[string]*usageRecord{}
+	}
+	record := usageData[kind][name]
+	if record == nil {
+		record = &usageRecord{}
+		usageData[kind][name] = record
+	}
+	record.Count++
+	record.LastUsed = time.Now()
+	if usageTimer == nil {
+		usageTimer = time.AfterFunc(usageDebounce, flushUsage)
+	}
+	usageMutex.Unlock()
+
+	if currentConfig().GetMenuSortConfigWithDefaults().order(kind) == menuSortUsage {
+		updateMenuForKind(kind)
+	}
+}
+
+// flushUsage writes pending usage counts to disk
+func flushUsage() {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+	if usageTimer == nil {
+		return
+	}
+	usageTimer.Stop()
+	usageTimer = nil
+	if err := saveUsageLocked(); err != nil {
+		LogWarn("Failed to save usage counts: %v", err)
+	}
+}
+
+// saveUsageLocked atomically writes the usage file. The caller holds usageMutex.
+func saveUsageLocked() error {
+	data, err := json.MarshalIndent(usageData, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := UsagePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// resetUsage forgets all usage counts
+func resetUsage() error {
+	usageMutex.Lock()
+	usageData = usageStats{}
+	if usageTimer != nil {
+		usageTimer.Stop()
+		usageTimer = nil
+	}
+	usageMutex.Unlock()
+
+	if err := os.Remove(UsagePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	sorting := currentConfig().GetMenuSortConfigWithDefaults()
+	for _, k := range usageKinds {
+		if sorting.order(k.kind) == menuSortUsage {
+			updateMenuForKind(k.kind)
+		}
+	}
+	return nil
+}
+
+// usageCount returns how often the named entry was used
+func usageCount(kind string, name string) int {
+	usageMutex.Lock()
+	defer usageMutex.Unlock()
+	loadUsageLocked()
+	return usageCountLocked(kind, name)
+}
+
+// usageReport lists the configured entries of each kind by use, most used first, followed
+// by the entries that were never used
+func usageReport(cfg *Config) string {
+	if cfg == nil {
+		return "No config loaded"
+	}
+	usageMutex.Lock()
+	loadUsageLocked()
+	defer usageMutex.Unlock()
+
+	var b strings.Builder
+	for _, k := range usageKinds {
+		names := k.names(cfg)
+		if len(names) == 0 {
+			continue
+		}
+		var used, unused []string
+		sorted := append([]string(nil), names...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return usageCountLocked(k.kind, sorted[i]) > usageCountLocked(k.kind, sorted[j])
+		})
+		for _, name := range sorted {
+			record := usageData[k.kind][name]
+			if record == nil || record.Count == 0 {
+				unused = append(unused, name)
+				continue
+			}
+			used = append(used, fmt.Sprintf("  %d × %s (last used %s)", record.Count, name, record.LastUsed.Format("2006-01-02")))
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s (%d of %d used)\n", k.title, len(used), len(names))
+		for _, line := range used {
+			b.WriteString(line + "\n")
+		}
+		if len(unused) > 0 {
+			fmt.Fprintf(&b, "  Never used: %s\n", strings.Join(unused, ", "))
+		}
+	}
+	if b.Len() == 0 {
+		return "No SPNs, URLs, snippets or SSH entries configured"
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func usageCountLocked(kind string, name string) int {
+	if record := usageData[kind][name]; record != nil {
+		return record.Count
+	}
+	return 0
+}
+
+// showUsageStats shows the usage report in a dialog
+func showUsageStats() {
+	cfg := currentConfig()
+	if cfg.GetUsageConfigWithDefaults().Disabled {
+		ShowMessageDialog("Usage Statistics", "Usage counting is disabled (usage.disabled in the config)")
+		return
+	}
+	ShowMessageDialog("Usage Statistics", usageReport(cfg))
+}
+
+func ctlUsage(args []string) (string, error) {
+	switch {
+	case len(args) == 0:
+		return usageReport(currentConfig()), nil
+	case len(args) == 1 && args[0] == "reset":
+		if err := resetUsage(); err != nil {
+			return "", err
+		}
+		LogAction("usage_reset", "Usage counts reset")
+		return "Usage counts reset", nil
+	}
+	return "", fmt.Errorf("usage: usage [reset]")
+}
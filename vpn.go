@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// vpnProbeTimeout bounds the probe_url request; through a VPN that is down it usually
+// hangs until then
+const vpnProbeTimeout = 5 * time.Second
+
+// vpnWatcher checks the VPN on an interval until stopped
+type vpnWatcher struct {
+	cfg  VPNConfig
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	vpnMutex  sync.Mutex
+	activeVPN *vpnWatcher
+
+	// vpnState is the outcome of the last check; known is false until the first one
+	vpnState struct {
+		mu        sync.Mutex
+		known     bool
+		connected bool
+		since     time.Time
+		reason    string
+	}
+)
+
+// mVPNStatus shows the VPN's state in the Status menu while detection is configured
+var mVPNStatus *systray.MenuItem
+
+// ApplyVPNConfig starts, restarts, or stops watching the VPN to match cfg. An unchanged
+// config checks again right away.
+func ApplyVPNConfig(cfg VPNConfig) {
+	vpnMutex.Lock()
+	defer vpnMutex.Unlock()
+
+	if activeVPN != nil && activeVPN.cfg == cfg {
+		select {
+		case activeVPN.kick <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if activeVPN != nil {
+		close(activeVPN.stop)
+		<-activeVPN.done
+		activeVPN = nil
+	}
+
+	vpnState.mu.Lock()
+	vpnState.known = false
+	vpnState.mu.Unlock()
+
+	if !cfg.Enabled() {
+		updateVPNMenu()
+		return
+	}
+	activeVPN = &vpnWatcher{
+		cfg:  cfg,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go activeVPN.run()
+	LogDebug("Checking the VPN every %ds", cfg.IntervalSec)
+}
+
+// StopVPNWatch stops watching the VPN
+func StopVPNWatch() {
+	vpnMutex.Lock()
+	defer vpnMutex.Unlock()
+
+	if activeVPN != nil {
+		close(activeVPN.stop)
+		<-activeVPN.done
+		activeVPN = nil
+	}
+}
+
+// kickVPNCheck checks the VPN now instead of at the next interval, e.g. after the network
+// changed
+func kickVPNCheck() {
+	vpnMutex.Lock()
+	defer vpnMutex.Unlock()
+
+	if activeVPN != nil {
+		select {
+		case activeVPN.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *vpnWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(time.Duration(w.cfg.IntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		connected, reason := checkVPN(w.cfg)
+		w.update(connected, reason)
+		select {
+		case <-ticker.C:
+		case <-w.kick:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// update records the outcome of a check and acts on the VPN coming up. The first check
+// only sets the state: a VPN that was connected before the tray started didn't just come up.
+func (w *vpnWatcher) update(connected bool, reason string) {
+	vpnState.mu.Lock()
+	first := !vpnState.known
+	changed := first || vpnState.connected != connected
+	vpnState.known = true
+	vpnState.connected = connected
+	vpnState.reason = reason
+	if changed {
+		vpnState.since = time.Now()
+	}
+	vpnState.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	updateVPNMenu()
+	if first {
+		LogInfo("VPN %s (%s)", vpnStateWord(connected), reason)
+		return
+	}
+	if !connected {
+		LogAction("vpn_disconnected", fmt.Sprintf("VPN disconnected (%s)", reason))
+		setStatus("VPN disconnected")
+		return
+	}
+	LogAction("vpn_connected", fmt.Sprintf("VPN connected (%s)", reason))
+	setStatus("VPN connected")
+	go onVPNConnected(w.cfg)
+}
+
+// onVPNConnected renews the TGT, runs on_connect, and requests the tickets that failed
+// without the VPN
+func onVPNConnected(cfg VPNConfig) {
+	if cfg.RefreshTGT {
+		if msg, err := renewAnyTGT("after the VPN came up"); err != nil {
+			LogWarn("Renewing the TGT after the VPN came up failed: %v", err)
+			setStatusError(fmt.Sprintf("Renew failed: %s", truncateError(err)))
+		} else {
+			setStatus(msg)
+		}
+	}
+
+	if cfg.OnConnect != "" {
+		_, err := GetLuaEngine().RunScript(cfg.OnConnect, map[string]string{"event": "vpn_connected"})
+		LogScriptExecuted(cfg.OnConnect, "vpn", err)
+		if err != nil {
+			setStatusError(fmt.Sprintf("Script error: %s", truncateError(err)))
+		}
+	}
+
+	if trayOffline() {
+		probeKDCNow()
+		return
+	}
+	stateMutex.RLock()
+	missing := currentSPN != "" && lastToken.Len() == 0
+	stateMutex.RUnlock()
+	if missing {
+		refreshToken()
+	}
+}
+
+// checkVPN runs the configured checks and reports whether all of them passed, with what
+// decided it
+func checkVPN(cfg VPNConfig) (bool, string) {
+	var found []string
+	if cfg.Interface != "" || cfg.Network != "" {
+		name, ok := vpnInterface(cfg)
+		if !ok {
+			return false, "no matching interface"
+		}
+		found = append(found, name)
+	}
+	if cfg.ProbeURL != "" {
+		if err := probeVPNURL(cfg.ProbeURL); err != nil {
+			LogDebug("VPN probe failed: %v", err)
+			return false, "probe_url not answering"
+		}
+		found = append(found, "probe_url answers")
+	}
+	return true, strings.Join(found, ", ")
+}
+
+// vpnInterface finds an interface that is up, named after cfg.Interface, and has an
+// address (in cfg.Network if set). macOS keeps a few utun interfaces with only link-local
+// addresses for its own services, so those don't count.
+func vpnInterface(cfg VPNConfig) (string, bool) {
+	var network *net.IPNet
+	if cfg.Network != "" {
+		_, n, err := net.ParseCIDR(cfg.Network)
+		if err != nil {
+			return "", false
+		}
+		network = n
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		LogDebug("Listing interfaces failed: %v", err)
+		return "", false
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if cfg.Interface != "" && !strings.HasPrefix(strings.ToLower(iface.Name), strings.ToLower(cfg.Interface)) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsLoopback() {
+				continue
+			}
+			if network == nil || network.Contains(ipNet.IP) {
+				return iface.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// probeVPNURL requests target without following redirects; any response means it's
+// reachable, even an error status or a redirect to a sign-in page
+func probeVPNURL(target string) error {
+	client := &http.Client{
+		Timeout: vpnProbeTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func vpnStateWord(connected bool) string {
+	if connected {
+		return "connected"
+	}
+	return "disconnected"
+}
+
+// vpnStatus describes the VPN's state for the Status menu and ctl status, or "" if
+// detection isn't configured or hasn't run yet
+func vpnStatus() string {
+	vpnState.mu.Lock()
+	defer vpnState.mu.Unlock()
+	if !vpnState.known {
+		return ""
+	}
+	return fmt.Sprintf("VPN: %s since %s", vpnStateWord(vpnState.connected), vpnState.since.Format("15:04"))
+}
+
+// updateVPNMenu shows the VPN's state in the Status menu, or hides the item when VPN
+// detection is off
+func updateVPNMenu() {
+	// Headless subcommands have no tray menu
+	if mVPNStatus == nil {
+		return
+	}
+	status := vpnStatus()
+	if status == "" {
+		mVPNStatus.Hide()
+		return
+	}
+	vpnState.mu.Lock()
+	reason := vpnState.reason
+	vpnState.mu.Unlock()
+	mVPNStatus.SetTitle(status)
+	mVPNStatus.SetTooltip(reason)
+	mVPNStatus.Show()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"krb5tray/pkg/krb"
+)
+
+// What prompted a wake check
+const (
+	wakeReasonWake    = "wake"
+	wakeReasonNetwork = "network change"
+)
+
+// clockJumpTick is how often the wall clock is compared with the ticker, to notice a
+// sleep that no platform event reported
+const clockJumpTick = 30 * time.Second
+
+// wakeCheck coalesces system events: a wake is usually followed by several network changes
+// while interfaces come up, and one check after they settle is enough
+var wakeCheck struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	reason  string
+	started bool
+}
+
+// startWakeCheck subscribes to the platform's sleep/wake and network change events. Whether
+// a check runs is decided per event, so wake_check can be toggled by a reload.
+func startWakeCheck() {
+	wakeCheck.mu.Lock()
+	defer wakeCheck.mu.Unlock()
+	if wakeCheck.started {
+		return
+	}
+	wakeCheck.started = true
+	watchSystemEvents()
+	go watchClockJumps()
+}
+
+// noteSystemEvent schedules a wake check once events stop arriving for delay_sec
+func noteSystemEvent(reason string) {
+	// The VPN may have just come up or gone down
+	kickVPNCheck()
+
+	cfg := currentConfig().GetWakeCheckConfigWithDefaults()
+	if cfg.Disabled {
+		return
+	}
+	LogDebug("System event: %s", reason)
+
+	wakeCheck.mu.Lock()
+	defer wakeCheck.mu.Unlock()
+	// A wake explains the network changes that follow it
+	if wakeCheck.reason != wakeReasonWake {
+		wakeCheck.reason = reason
+	}
+	delay := time.Duration(cfg.DelaySec) * time.Second
+	if wakeCheck.timer == nil {
+		wakeCheck.timer = time.AfterFunc(delay, runWakeCheck)
+	} else {
+		wakeCheck.timer.Stop()
+		wakeCheck.timer.Reset(delay)
+	}
+}
+
+func runWakeCheck() {
+	wakeCheck.mu.Lock()
+	reason := wakeCheck.reason
+	wakeCheck.reason = ""
+	wakeCheck.mu.Unlock()
+
+	checkKerberosHealth(reason)
+}
+
+// checkKerberosHealth re-validates the credentials and requests a new token for the selected
+// SPN. Tokens minted before a suspend are often rejected afterwards: the TGT may have expired
+// or been renewed, the clock may be off, or the KDC reached through another network.
+func checkKerberosHealth(reason string) {
+	if trayIdleLocked() {
+		return
+	}
+	cfg := currentConfig()
+	// Someone else may have signed in (kinit as another principal) while the lid was shut
+	refreshCacheNamespace(cfg)
+
+	// Windows gets a new TGT with the logon credentials, so an expired one is no failure there
+	if !krb.IsWindows() {
+		// The TGT may have expired while asleep; a keytab gets a new one
+		if kt, ok := keytabConfig(cfg); ok {
+			_, _ = ensureKeytabTGT(kt, "after the "+reason)
+		}
+		expiry, err := krb.TGTExpiry(krbOptions())
+		if err == nil && !time.Now().Before(expiry) {
+			err = &krb.Error{Kind: krb.ErrNoTGT, Msg: fmt.Sprintf("TGT expired at %s", expiry.Format("15:04"))}
+		}
+		if err != nil {
+			// Whatever failed, there is no TGT to use
+			if !errors.Is(err, krb.ErrNoTGT) {
+				err = &krb.Error{Kind: krb.ErrNoTGT, Err: err}
+			}
+			LogWarn("Credentials not valid after %s: %v", reason, err)
+			setStatusError(describeTicketError(err))
+			notifyUser("Kerberos credentials expired", fmt.Sprintf("After the %s: %s", reason, ticketErrorNotice(err)))
+			return
+		}
+	}
+
+	stateMutex.RLock()
+	spn := currentSPN
+	stateMutex.RUnlock()
+	if spn == "" {
+		LogDebug("Credentials valid after %s, no SPN selected", reason)
+		return
+	}
+	refreshToken()
+	LogAction("wake_check", fmt.Sprintf("Credentials checked and token refreshed after %s", reason))
+}
+
+// watchClockJumps notices a sleep from the wall clock moving on much further than the
+// ticker did, for platforms and setups where no wake event arrives
+func watchClockJumps() {
+	last := time.Now()
+	ticker := time.NewTicker(clockJumpTick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		// Round(0) drops the monotonic reading, which doesn't advance during sleep
+		if gap := now.Round(0).Sub(last.Round(0)); gap > clockJumpTick+time.Minute {
+			LogDebug("Wall clock moved %s in one tick, assuming the system slept", gap.Round(time.Second))
+			noteSystemEvent(wakeReasonWake)
+		}
+		last = now
+	}
+}
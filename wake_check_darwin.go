@@ -0,0 +1,29 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa -framework Network
+
+// Implemented in wake_check_darwin.m, since this file exports Go functions
+void startSystemEventObservers(void);
+*/
+import "C"
+
+// watchSystemEvents observes NSWorkspace's wake notification and Network.framework's path
+// updates
+func watchSystemEvents() {
+	C.startSystemEventObservers()
+}
+
+//export krb5traySystemWoke
+func krb5traySystemWoke() {
+	// Called on the notification queue; don't block it
+	go noteSystemEvent(wakeReasonWake)
+}
+
+//export krb5trayNetworkChanged
+func krb5trayNetworkChanged() {
+	go noteSystemEvent(wakeReasonNetwork)
+}
@@ -0,0 +1,38 @@
+#import <Cocoa/Cocoa.h>
+#import <Network/Network.h>
+
+#include "_cgo_export.h"
+
+static id wakeObserver = nil;
+static nw_path_monitor_t pathMonitor = nil;
+
+// startSystemEventObservers reports wakes from NSWorkspace and network changes from a path
+// monitor. The monitor delivers the current path as soon as it starts; only the updates
+// after that are changes.
+void startSystemEventObservers(void) {
+    if (wakeObserver != nil) {
+        return;
+    }
+    NSNotificationCenter *center = [[NSWorkspace sharedWorkspace] notificationCenter];
+    wakeObserver = [center addObserverForName:NSWorkspaceDidWakeNotification
+                                       object:nil
+                                        queue:nil
+                                   usingBlock:^(NSNotification *note) {
+        krb5traySystemWoke();
+    }];
+
+    __block BOOL initial = YES;
+    dispatch_queue_t queue = dispatch_queue_create("krb5tray.network", DISPATCH_QUEUE_SERIAL);
+    pathMonitor = nw_path_monitor_create();
+    nw_path_monitor_set_queue(pathMonitor, queue);
+    nw_path_monitor_set_update_handler(pathMonitor, ^(nw_path_t path) {
+        if (initial) {
+            initial = NO;
+            return;
+        }
+        if (nw_path_get_status(path) == nw_path_status_satisfied) {
+            krb5trayNetworkChanged();
+        }
+    });
+    nw_path_monitor_start(pathMonitor);
+}
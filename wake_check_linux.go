@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"regexp"
+)
+
+// Signals on the system bus that start a wake check: logind's PrepareForSleep(false) once
+// the system has resumed, and NetworkManager reaching site or global connectivity
+var (
+	sleepResumedPattern = regexp.MustCompile(`\.PrepareForSleep \(false,\)`)
+	networkUpPattern    = regexp.MustCompile(`\.StateChanged \(uint32 (60|70),\)`)
+)
+
+// systemEventSources are the services watched with "gdbus monitor"
+var systemEventSources = []struct {
+	dest    string
+	object  string
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{"org.freedesktop.login1", "/org/freedesktop/login1", sleepResumedPattern, wakeReasonWake},
+	{"org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager", networkUpPattern, wakeReasonNetwork},
+}
+
+// watchSystemEvents monitors logind and NetworkManager on the system bus. Without gdbus, or
+// on systems without those services, the clock jump check is all there is.
+func watchSystemEvents() {
+	gdbus, err := exec.LookPath("gdbus")
+	if err != nil {
+		LogDebug("gdbus not found, not watching for wake and network changes")
+		return
+	}
+	for _, source := range systemEventSources {
+		cmd := exec.Command(gdbus, "monitor", "--system", "--dest", source.dest, "--object-path", source.object)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			LogDebug("Not watching %s: %v", source.dest, err)
+			continue
+		}
+		if err := cmd.Start(); err != nil {
+			LogDebug("Not watching %s: %v", source.dest, err)
+			continue
+		}
+		go watchSystemSignals(cmd, bufio.NewScanner(stdout), source.pattern, source.reason)
+	}
+}
+
+func watchSystemSignals(cmd *exec.Cmd, scanner *bufio.Scanner, pattern *regexp.Regexp, reason string) {
+	for scanner.Scan() {
+		if pattern.MatchString(scanner.Text()) {
+			noteSystemEvent(reason)
+		}
+	}
+	err := cmd.Wait()
+	LogDebug("System event monitor exited: %v", err)
+}
@@ -0,0 +1,8 @@
+//go:build !windows && !darwin && !linux
+// +build !windows,!darwin,!linux
+
+package main
+
+// watchSystemEvents has no event source on this platform; the clock jump check still
+// notices a sleep
+func watchSystemEvents() {}
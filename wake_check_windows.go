@@ -0,0 +1,119 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	iphlpapi = syscall.NewLazyDLL("iphlpapi.dll")
+
+	registerClassExW = user32.NewProc("RegisterClassExW")
+	createWindowExW  = user32.NewProc("CreateWindowExW")
+	defWindowProcW   = user32.NewProc("DefWindowProcW")
+	getMessageW      = user32.NewProc("GetMessageW")
+	dispatchMessageW = user32.NewProc("DispatchMessageW")
+	getModuleHandleW = kernel32.NewProc("GetModuleHandleW")
+	notifyAddrChange = iphlpapi.NewProc("NotifyAddrChange")
+)
+
+const (
+	wmPowerBroadcast      = 0x0218
+	pbtAPMResumeSuspend   = 0x0007 // Resumed by the user
+	pbtAPMResumeAutomatic = 0x0012 // Resumed, whether or not the user is present
+)
+
+// wndClassEx is WNDCLASSEXW
+type wndClassEx struct {
+	size       uint32
+	style      uint32
+	wndProc    uintptr
+	clsExtra   int32
+	wndExtra   int32
+	instance   uintptr
+	icon       uintptr
+	cursor     uintptr
+	background uintptr
+	menuName   *uint16
+	className  *uint16
+	iconSm     uintptr
+}
+
+// winMsg is MSG
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// watchSystemEvents listens for resume with a hidden window, since power broadcasts only
+// go to top-level windows, and for address changes with NotifyAddrChange
+func watchSystemEvents() {
+	go watchPowerBroadcasts()
+	go watchAddressChanges()
+}
+
+func watchPowerBroadcasts() {
+	// The window's messages are delivered to the thread that created it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	className, _ := syscall.UTF16PtrFromString("krb5trayWakeCheck")
+	instance, _, _ := getModuleHandleW.Call(0)
+	wc := wndClassEx{
+		wndProc:   syscall.NewCallback(wakeWndProc),
+		instance:  instance,
+		className: className,
+	}
+	wc.size = uint32(unsafe.Sizeof(wc))
+	if atom, _, err := registerClassExW.Call(uintptr(unsafe.Pointer(&wc))); atom == 0 {
+		LogDebug("Not watching for resume: RegisterClassEx: %v", err)
+		return
+	}
+	hwnd, _, err := createWindowExW.Call(0, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+		0, 0, 0, 0, 0, 0, 0, instance, 0)
+	if hwnd == 0 {
+		LogDebug("Not watching for resume: CreateWindowEx: %v", err)
+		return
+	}
+
+	var msg winMsg
+	for {
+		ret, _, _ := getMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+		if int32(ret) <= 0 {
+			return
+		}
+		dispatchMessageW.Call(uintptr(unsafe.Pointer(&msg)))
+	}
+}
+
+func wakeWndProc(hwnd uintptr, msg uint32, wParam uintptr, lParam uintptr) uintptr {
+	if msg == wmPowerBroadcast {
+		// Both are sent on a resume by the user; the check is debounced
+		if wParam == pbtAPMResumeAutomatic || wParam == pbtAPMResumeSuspend {
+			go noteSystemEvent(wakeReasonWake)
+		}
+		return 1
+	}
+	ret, _, _ := defWindowProcW.Call(hwnd, uintptr(msg), wParam, lParam)
+	return ret
+}
+
+// watchAddressChanges blocks in NotifyAddrChange, which returns when any interface's IPv4
+// address changes
+func watchAddressChanges() {
+	for {
+		if ret, _, _ := notifyAddrChange.Call(0, 0); ret != 0 {
+			LogDebug("Not watching for network changes: NotifyAddrChange returned %d", ret)
+			return
+		}
+		noteSystemEvent(wakeReasonNetwork)
+	}
+}